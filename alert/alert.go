@@ -0,0 +1,312 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package alert opens incidents in on-call services like PagerDuty and
+// Opsgenie when bulldozer has systemic problems, such as repeated merge
+// failures in a repository or an open circuit breaker.
+package alert
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/state"
+)
+
+// DefaultMergeFailures is the number of pull requests in a repository whose
+// merges fail in a row that trigger an alert if the threshold is not
+// configured.
+const DefaultMergeFailures = 5
+
+// Alert is an incident to open. Alerts with the same key are the same
+// incident, so triggering an alert again does not open another incident.
+type Alert struct {
+	Key     string
+	Summary string
+	Details map[string]string
+}
+
+// Alerter opens and resolves incidents in an on-call service.
+// Implementations must be safe for concurrent use.
+type Alerter interface {
+	Trigger(ctx context.Context, alert Alert) error
+	Resolve(ctx context.Context, key string) error
+}
+
+// Config configures the services that receive alerts and when alerts are
+// triggered.
+type Config struct {
+	PagerDuty PagerDutyConfig `yaml:"pagerduty"`
+	Opsgenie  OpsgenieConfig  `yaml:"opsgenie"`
+
+	// MergeFailures is the number of different pull requests in a
+	// repository whose merges fail in a row that trigger an alert. Retries
+	// of the same pull request count once. The alert is resolved by the
+	// next successful merge. If zero, DefaultMergeFailures is used; if
+	// negative, failed merges do not trigger alerts.
+	MergeFailures int `yaml:"merge_failures"`
+
+	// CircuitBreaker triggers an alert while the circuit breaker stops
+	// requests to GitHub for an owner.
+	CircuitBreaker bool `yaml:"circuit_breaker"`
+}
+
+// Threshold returns the number of pull requests with failed merges that
+// trigger an alert, or zero if failed merges do not trigger alerts.
+func (c Config) Threshold() int {
+	switch {
+	case c.MergeFailures < 0:
+		return 0
+	case c.MergeFailures == 0:
+		return DefaultMergeFailures
+	}
+	return c.MergeFailures
+}
+
+// Manager sends alerts to all of its alerters. A nil manager discards
+// alerts.
+type Manager struct {
+	Alerters []Alerter
+
+	// Store, if set, records the servers whose circuit for an owner is
+	// open, so that the circuit alert is resolved only when the circuits of
+	// all servers that share the store are closed. Server identifies this
+	// server in the store.
+	Store  state.Store
+	Server string
+}
+
+// New returns a manager for the configured services that shares circuit
+// state with the other servers that use the store, or nil if no service is
+// configured.
+func New(c Config, store state.Store) *Manager {
+	m := Manager{Store: store, Server: serverID()}
+	if c.PagerDuty.Enabled() {
+		m.Alerters = append(m.Alerters, NewPagerDuty(c.PagerDuty))
+	}
+	if c.Opsgenie.Enabled() {
+		m.Alerters = append(m.Alerters, NewOpsgenie(c.Opsgenie))
+	}
+	if len(m.Alerters) == 0 {
+		return nil
+	}
+	return &m
+}
+
+// serverID returns a name for this server that is unique among the servers
+// that share a store.
+func serverID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// Trigger opens the incident of the alert in the background, logging any
+// errors.
+func (m *Manager) Trigger(ctx context.Context, alert Alert) {
+	if m == nil {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	logger.Warn().Msgf("Triggering alert %s: %s", alert.Key, alert.Summary)
+
+	ctx = logger.WithContext(context.Background())
+	go func() {
+		for _, a := range m.Alerters {
+			if err := a.Trigger(ctx, alert); err != nil {
+				logger.Error().Err(err).Msgf("Failed to trigger alert %s", alert.Key)
+			}
+		}
+	}()
+}
+
+// Resolve resolves the incident of the alert with the key in the background,
+// logging any errors.
+func (m *Manager) Resolve(ctx context.Context, key string) {
+	if m == nil {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	logger.Info().Msgf("Resolving alert %s", key)
+
+	ctx = logger.WithContext(context.Background())
+	go func() {
+		for _, a := range m.Alerters {
+			if err := a.Resolve(ctx, key); err != nil {
+				logger.Error().Err(err).Msgf("Failed to resolve alert %s", key)
+			}
+		}
+	}()
+}
+
+// circuitPrefix is the prefix of the state keys that record the servers
+// whose circuit for an owner is open
+const circuitPrefix = "circuit-open/"
+
+// circuitTTL forgets servers that stopped while their circuit was open
+const circuitTTL = 24 * time.Hour
+
+// CircuitKey is the key of the alert for the open circuit of an owner.
+func CircuitKey(owner string) string {
+	return "bulldozer/circuit/" + owner
+}
+
+// CircuitOpened triggers the alert for the open circuit of an owner.
+func (m *Manager) CircuitOpened(ctx context.Context, owner string) {
+	if m == nil {
+		return
+	}
+	if m.Store != nil {
+		if err := m.Store.Set(ctx, circuitPrefix+owner+"/"+m.Server, []byte("open"), circuitTTL); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msgf("Failed to record open circuit for %s", owner)
+		}
+	}
+
+	m.Trigger(ctx, Alert{
+		Key:     CircuitKey(owner),
+		Summary: fmt.Sprintf("bulldozer stopped sending GitHub requests for %s because most of them are failing", owner),
+		Details: map[string]string{"owner": owner},
+	})
+}
+
+// CircuitClosed resolves the alert for the open circuit of an owner, unless
+// the circuit is still open on other servers.
+func (m *Manager) CircuitClosed(ctx context.Context, owner string) {
+	if m == nil {
+		return
+	}
+	if m.Store != nil {
+		logger := zerolog.Ctx(ctx)
+		prefix := circuitPrefix + owner + "/"
+		if err := m.Store.Delete(ctx, prefix+m.Server); err != nil {
+			logger.Error().Err(err).Msgf("Failed to record closed circuit for %s", owner)
+		}
+
+		open, err := m.Store.Keys(ctx, prefix)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to list open circuits for %s", owner)
+			return
+		}
+		if len(open) > 0 {
+			logger.Info().Msgf("Not resolving alert %s while the circuit is open on %d other servers", CircuitKey(owner), len(open))
+			return
+		}
+	}
+
+	m.Resolve(ctx, CircuitKey(owner))
+}
+
+// mergeFailuresPrefix is the prefix of the state keys that track the failed
+// merges of each repository. The key of a repository holds the ID of its
+// current streak of failures, and the keys under it count the pull requests
+// that failed in the streak.
+const mergeFailuresPrefix = "merge-failures/"
+
+// mergeFailuresTTL forgets the failures of repositories without merges
+const mergeFailuresTTL = 7 * 24 * time.Hour
+
+// FailureTracker is an audit sink that counts the different pull requests in
+// each repository whose merges failed since the last successful merge, so
+// that one pull request that fails on every retry does not trigger an alert.
+// It triggers an alert when a count reaches the threshold and resolves it
+// when a merge succeeds.
+type FailureTracker struct {
+	Manager   *Manager
+	Store     state.Store
+	Threshold int
+}
+
+// MergeFailuresKey is the key of the alert for repeated failed merges in a
+// repository.
+func MergeFailuresKey(owner, repo string) string {
+	return "bulldozer/merge-failures/" + owner + "/" + repo
+}
+
+func (t *FailureTracker) Record(ctx context.Context, event audit.Event) error {
+	if event.Type != audit.TypeMerge {
+		return nil
+	}
+
+	key := mergeFailuresPrefix + event.Owner + "/" + event.Repo
+	switch event.Result {
+	case audit.ResultFailed:
+		streak := strconv.FormatInt(time.Now().UnixNano(), 36)
+		if _, err := t.Store.SetIfAbsent(ctx, key, []byte(streak), mergeFailuresTTL); err != nil {
+			return errors.Wrap(err, "failed to start merge failures")
+		}
+		b, ok, err := t.Store.Get(ctx, key)
+		if err != nil || !ok {
+			return errors.Wrap(err, "failed to get merge failures")
+		}
+		streakKey := key + "/" + string(b)
+
+		counted, err := t.Store.SetIfAbsent(ctx, streakKey+"/pulls/"+strconv.Itoa(event.Number), []byte("failed"), mergeFailuresTTL)
+		if err != nil {
+			return errors.Wrap(err, "failed to record merge failure")
+		}
+		if !counted {
+			// retries of a pull request that already failed count once
+			return nil
+		}
+
+		n, err := t.Store.Increment(ctx, streakKey+"/count", mergeFailuresTTL)
+		if err != nil {
+			return errors.Wrap(err, "failed to count merge failures")
+		}
+		if t.Threshold > 0 && n == int64(t.Threshold) {
+			t.Manager.Trigger(ctx, Alert{
+				Key:     MergeFailuresKey(event.Owner, event.Repo),
+				Summary: fmt.Sprintf("bulldozer failed to merge %d different pull requests in a row in %s/%s", n, event.Owner, event.Repo),
+				Details: map[string]string{
+					"owner":      event.Owner,
+					"repository": event.Repo,
+					"last_pull":  strconv.Itoa(event.Number),
+					"last_error": event.Detail,
+				},
+			})
+		}
+
+	case audit.ResultMerged:
+		streak, ok, err := t.Store.Get(ctx, key)
+		if err != nil {
+			return errors.Wrap(err, "failed to get merge failures")
+		}
+		if !ok {
+			return nil
+		}
+		b, _, err := t.Store.Get(ctx, key+"/"+string(streak)+"/count")
+		if err != nil {
+			return errors.Wrap(err, "failed to get merge failures")
+		}
+		if _, err := t.Store.CompareAndDelete(ctx, key, streak); err != nil {
+			return errors.Wrap(err, "failed to reset merge failures")
+		}
+		if n, _ := strconv.Atoi(string(b)); t.Threshold > 0 && n >= t.Threshold {
+			t.Manager.Resolve(ctx, MergeFailuresKey(event.Owner, event.Repo))
+		}
+	}
+	return nil
+}
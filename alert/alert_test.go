@@ -0,0 +1,144 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/state"
+)
+
+type recordingAlerter struct {
+	events chan string
+}
+
+func (a *recordingAlerter) Trigger(ctx context.Context, alert Alert) error {
+	a.events <- "trigger " + alert.Key
+	return nil
+}
+
+func (a *recordingAlerter) Resolve(ctx context.Context, key string) error {
+	a.events <- "resolve " + key
+	return nil
+}
+
+func TestFailureTracker(t *testing.T) {
+	alerter := &recordingAlerter{events: make(chan string, 10)}
+	tracker := &FailureTracker{
+		Manager:   &Manager{Alerters: []Alerter{alerter}},
+		Store:     state.NewMemoryStore(),
+		Threshold: 2,
+	}
+	ctx := context.Background()
+
+	failed := func(number int) audit.Event {
+		return audit.Event{Type: audit.TypeMerge, Result: audit.ResultFailed, Owner: "o", Repo: "r", Number: number}
+	}
+	merged := audit.Event{Type: audit.TypeMerge, Result: audit.ResultMerged, Owner: "o", Repo: "r", Number: 9}
+
+	require.NoError(t, tracker.Record(ctx, failed(1)))
+	require.NoError(t, tracker.Record(ctx, merged))
+	require.NoError(t, tracker.Record(ctx, failed(1)))
+	assert.Empty(t, alerter.events, "failures below the threshold should not alert")
+
+	require.NoError(t, tracker.Record(ctx, failed(1)))
+	require.NoError(t, tracker.Record(ctx, failed(1)))
+	assert.Empty(t, alerter.events, "retries of the same pull request should count once")
+
+	require.NoError(t, tracker.Record(ctx, failed(2)))
+	assert.Equal(t, "trigger bulldozer/merge-failures/o/r", <-alerter.events)
+
+	require.NoError(t, tracker.Record(ctx, failed(3)))
+	require.NoError(t, tracker.Record(ctx, merged))
+	assert.Equal(t, "resolve bulldozer/merge-failures/o/r", <-alerter.events)
+
+	require.NoError(t, tracker.Record(ctx, failed(1)))
+	require.NoError(t, tracker.Record(ctx, merged))
+	assert.Empty(t, alerter.events, "a merge starts a new streak")
+}
+
+func TestCircuitAlert(t *testing.T) {
+	alerter := &recordingAlerter{events: make(chan string, 10)}
+	store := state.NewMemoryStore()
+	ctx := context.Background()
+
+	// two servers share the store
+	m := &Manager{Alerters: []Alerter{alerter}, Store: store, Server: "one"}
+	other := &Manager{Alerters: []Alerter{alerter}, Store: store, Server: "two"}
+
+	m.CircuitOpened(ctx, "o")
+	assert.Equal(t, "trigger bulldozer/circuit/o", <-alerter.events)
+	other.CircuitOpened(ctx, "o")
+	assert.Equal(t, "trigger bulldozer/circuit/o", <-alerter.events)
+
+	m.CircuitClosed(ctx, "o")
+	other.CircuitOpened(ctx, "p")
+	assert.Equal(t, "trigger bulldozer/circuit/p", <-alerter.events, "the circuit is still open on the other server")
+
+	other.CircuitClosed(ctx, "o")
+	assert.Equal(t, "resolve bulldozer/circuit/o", <-alerter.events)
+	assert.Empty(t, alerter.events)
+}
+
+func TestConfigThreshold(t *testing.T) {
+	assert.Equal(t, DefaultMergeFailures, Config{}.Threshold())
+	assert.Equal(t, 3, Config{MergeFailures: 3}.Threshold())
+	assert.Equal(t, 0, Config{MergeFailures: -1}.Threshold())
+}
+
+func TestPagerDuty(t *testing.T) {
+	var events []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	p := NewPagerDuty(PagerDutyConfig{RoutingKey: "key", URL: srv.URL})
+	ctx := context.Background()
+
+	require.NoError(t, p.Trigger(ctx, Alert{Key: "bulldozer/circuit/o", Summary: "circuit open"}))
+	require.NoError(t, p.Resolve(ctx, "bulldozer/circuit/o"))
+
+	require.Len(t, events, 2)
+	assert.Equal(t, "trigger", events[0]["event_action"])
+	assert.Equal(t, "bulldozer/circuit/o", events[0]["dedup_key"])
+	assert.Equal(t, "key", events[0]["routing_key"])
+	assert.Equal(t, "circuit open", events[0]["payload"].(map[string]interface{})["summary"])
+	assert.Equal(t, "resolve", events[1]["event_action"])
+}
+
+func TestOpsgenieClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GenieKey key", r.Header.Get("Authorization"))
+		assert.Equal(t, "/v2/alerts/bulldozer%2Fcircuit%2Fo/close", r.URL.EscapedPath())
+		assert.Equal(t, "alias", r.URL.Query().Get("identifierType"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	o := NewOpsgenie(OpsgenieConfig{APIKey: "key", URL: srv.URL + "/"})
+	require.NoError(t, o.Resolve(context.Background(), "bulldozer/circuit/o"))
+}
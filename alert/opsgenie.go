@@ -0,0 +1,105 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/jsonhttp"
+)
+
+// DefaultOpsgenieURL is the base URL of the Opsgenie API. Accounts in the EU
+// use "https://api.eu.opsgenie.com".
+const DefaultOpsgenieURL = "https://api.opsgenie.com"
+
+// OpsgenieConfig configures creating Opsgenie alerts with the key of an API
+// integration.
+type OpsgenieConfig struct {
+	APIKey string `yaml:"api_key"`
+
+	// Priority of the alerts, "P1" to "P5". Defaults to "P3".
+	Priority string `yaml:"priority"`
+
+	// URL overrides DefaultOpsgenieURL.
+	URL string `yaml:"url"`
+}
+
+func (c OpsgenieConfig) Enabled() bool {
+	return c.APIKey != ""
+}
+
+// Opsgenie creates and closes Opsgenie alerts. Alert keys are used as
+// aliases, which Opsgenie deduplicates.
+type Opsgenie struct {
+	URL      string
+	APIKey   string
+	Priority string
+	Client   *http.Client
+}
+
+func NewOpsgenie(c OpsgenieConfig) *Opsgenie {
+	o := &Opsgenie{
+		URL:      strings.TrimSuffix(c.URL, "/"),
+		APIKey:   c.APIKey,
+		Priority: c.Priority,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if o.URL == "" {
+		o.URL = DefaultOpsgenieURL
+	}
+	if o.Priority == "" {
+		o.Priority = "P3"
+	}
+	return o
+}
+
+func (o *Opsgenie) Trigger(ctx context.Context, alert Alert) error {
+	body := map[string]interface{}{
+		"message":  truncate(alert.Summary, 130),
+		"alias":    alert.Key,
+		"source":   "bulldozer",
+		"priority": o.Priority,
+		"details":  alert.Details,
+	}
+	_, err := jsonhttp.Post(ctx, o.Client, o.URL+"/v2/alerts", o.header(), body)
+	return errors.Wrap(err, "failed to create opsgenie alert")
+}
+
+func (o *Opsgenie) Resolve(ctx context.Context, key string) error {
+	u := o.URL + "/v2/alerts/" + url.PathEscape(key) + "/close?identifierType=alias"
+	body := map[string]interface{}{"source": "bulldozer"}
+	_, err := jsonhttp.Post(ctx, o.Client, u, o.header(), body)
+	return errors.Wrap(err, "failed to close opsgenie alert")
+}
+
+func (o *Opsgenie) header() http.Header {
+	h := make(http.Header)
+	h.Set("Authorization", "GenieKey "+o.APIKey)
+	return h
+}
+
+// truncate shortens the string to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
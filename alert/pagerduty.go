@@ -0,0 +1,96 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/jsonhttp"
+)
+
+// DefaultPagerDutyURL is the endpoint of the PagerDuty Events API v2.
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyConfig configures triggering incidents through the PagerDuty
+// Events API v2 with the integration key of a service.
+type PagerDutyConfig struct {
+	RoutingKey string `yaml:"routing_key"`
+
+	// Severity of the incidents: "critical", "error", "warning", or
+	// "info". Defaults to "error".
+	Severity string `yaml:"severity"`
+
+	// URL overrides DefaultPagerDutyURL.
+	URL string `yaml:"url"`
+}
+
+func (c PagerDutyConfig) Enabled() bool {
+	return c.RoutingKey != ""
+}
+
+// PagerDuty triggers and resolves PagerDuty incidents. Alert keys are used
+// as dedup keys.
+type PagerDuty struct {
+	URL        string
+	RoutingKey string
+	Severity   string
+	Client     *http.Client
+}
+
+func NewPagerDuty(c PagerDutyConfig) *PagerDuty {
+	p := &PagerDuty{
+		URL:        c.URL,
+		RoutingKey: c.RoutingKey,
+		Severity:   c.Severity,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.URL == "" {
+		p.URL = DefaultPagerDutyURL
+	}
+	if p.Severity == "" {
+		p.Severity = "error"
+	}
+	return p
+}
+
+func (p *PagerDuty) Trigger(ctx context.Context, alert Alert) error {
+	event := map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    alert.Key,
+		"payload": map[string]interface{}{
+			"summary":        alert.Summary,
+			"source":         "bulldozer",
+			"severity":       p.Severity,
+			"custom_details": alert.Details,
+		},
+	}
+	_, err := jsonhttp.Post(ctx, p.Client, p.URL, nil, event)
+	return errors.Wrap(err, "failed to trigger pagerduty incident")
+}
+
+func (p *PagerDuty) Resolve(ctx context.Context, key string) error {
+	event := map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "resolve",
+		"dedup_key":    key,
+	}
+	_, err := jsonhttp.Post(ctx, p.Client, p.URL, nil, event)
+	return errors.Wrap(err, "failed to resolve pagerduty incident")
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archive keeps the raw payloads of webhook deliveries for replay and
+// debugging.
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"time"
+
+	"github.com/palantir/bulldozer/aws"
+)
+
+// Record is an archived webhook delivery. The fields match the deliveries in
+// the work queue of the server.
+type Record struct {
+	DeliveryID string          `json:"delivery_id"`
+	EventType  string          `json:"event_type"`
+	Repository string          `json:"repository,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// Key returns the relative path of the record in an archive. Keys sort by
+// the time deliveries were received.
+func (r Record) Key() string {
+	return r.ReceivedAt.UTC().Format("2006/01/02/150405.000000000") + "-" + r.EventType + "-" + r.DeliveryID + ".json"
+}
+
+// Archive stores webhook deliveries.
+type Archive interface {
+	Store(ctx context.Context, r Record) error
+}
+
+// Config configures the archives of webhook deliveries. Deliveries are
+// archived if they match the repository and event filters, or if the
+// filters are empty.
+type Config struct {
+	Directory string       `yaml:"directory"`
+	S3        aws.S3Config `yaml:"s3"`
+
+	// How long records are kept in the directory. If zero, records are kept
+	// forever. Records in S3 are not removed by bulldozer; expire them with a
+	// lifecycle rule on the bucket, so that servers do not each list and
+	// delete them.
+	Retention time.Duration `yaml:"retention"`
+
+	// Repositories are "owner/name" patterns, such as "palantir/*"
+	Repositories []string `yaml:"repositories"`
+	Events       []string `yaml:"events"`
+}
+
+func (c Config) Enabled() bool {
+	return c.Directory != "" || c.S3.Bucket != ""
+}
+
+// Matches returns true if deliveries of the event type in the repository are
+// archived. The repository is empty for events that do not belong to one.
+func (c Config) Matches(eventType, repository string) bool {
+	if len(c.Events) > 0 {
+		found := false
+		for _, e := range c.Events {
+			if e == eventType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(c.Repositories) > 0 {
+		for _, pattern := range c.Repositories {
+			if ok, _ := path.Match(pattern, repository); ok && repository != "" {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// New returns an archive that stores records in every configured location.
+func New(c Config) Archive {
+	var archives MultiArchive
+	if c.Directory != "" {
+		archives = append(archives, &FileArchive{Dir: c.Directory})
+	}
+	if c.S3.Bucket != "" {
+		archives = append(archives, NewS3Archive(c.S3))
+	}
+	if len(archives) == 1 {
+		return archives[0]
+	}
+	return archives
+}
+
+// MultiArchive stores records in several archives. Every archive is tried
+// even if some of them fail.
+type MultiArchive []Archive
+
+func (m MultiArchive) Store(ctx context.Context, r Record) error {
+	var first error
+	for _, a := range m {
+		if err := a.Store(ctx, r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
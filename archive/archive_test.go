@@ -0,0 +1,66 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigMatches(t *testing.T) {
+	all := Config{}
+	assert.True(t, all.Matches("push", "palantir/bulldozer"))
+	assert.True(t, all.Matches("installation", ""))
+
+	filtered := Config{
+		Repositories: []string{"palantir/*", "octo-org/octo-repo"},
+		Events:       []string{"pull_request", "status"},
+	}
+	assert.True(t, filtered.Matches("pull_request", "palantir/bulldozer"))
+	assert.True(t, filtered.Matches("status", "octo-org/octo-repo"))
+	assert.False(t, filtered.Matches("push", "palantir/bulldozer"), "event is not listed")
+	assert.False(t, filtered.Matches("status", "octo-org/other"), "repository is not listed")
+	assert.False(t, filtered.Matches("status", ""), "events without a repository do not match repository filters")
+}
+
+func TestFileArchive(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a := &FileArchive{Dir: dir}
+	old := Record{DeliveryID: "old", EventType: "push", Payload: []byte(`{}`), ReceivedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	recent := Record{DeliveryID: "recent", EventType: "push", Payload: []byte(`{}`), ReceivedAt: time.Now()}
+	require.NoError(t, a.Store(ctx, old))
+	require.NoError(t, a.Store(ctx, recent))
+
+	oldPath := filepath.Join(dir, "2020", "01", "02", "030405.000000000-push-old.json")
+	require.FileExists(t, oldPath)
+	require.NoError(t, os.Chtimes(oldPath, old.ReceivedAt, old.ReceivedAt))
+
+	require.NoError(t, a.Prune(ctx, time.Now().Add(-time.Hour)))
+
+	_, err = os.Stat(filepath.Join(dir, "2020"))
+	assert.True(t, os.IsNotExist(err), "empty directories are removed")
+	assert.FileExists(t, filepath.Join(dir, filepath.FromSlash(recent.Key())))
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FileArchive stores each record as a JSON file under a directory, in
+// subdirectories by day.
+type FileArchive struct {
+	Dir string
+}
+
+func (a *FileArchive) Store(ctx context.Context, r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal archive record")
+	}
+
+	name := filepath.Join(a.Dir, filepath.FromSlash(r.Key()))
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return errors.Wrap(err, "failed to create archive directory")
+	}
+	if err := ioutil.WriteFile(name, b, 0600); err != nil {
+		return errors.Wrapf(err, "failed to archive delivery %s", r.DeliveryID)
+	}
+	return nil
+}
+
+// Prune removes the records last modified before the time, and the
+// directories left empty.
+func (a *FileArchive) Prune(ctx context.Context, before time.Time) error {
+	var dirs []string
+	err := filepath.Walk(a.Dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if name != a.Dir {
+				dirs = append(dirs, name)
+			}
+			return nil
+		}
+		if info.ModTime().Before(before) {
+			return os.Remove(name)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to prune archive")
+	}
+
+	// remove the directories that are now empty, deepest first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if entries, err := ioutil.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+			_ = os.Remove(dirs[i])
+		}
+	}
+	return nil
+}
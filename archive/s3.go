@@ -0,0 +1,88 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/aws"
+)
+
+// S3Archive stores each record as a JSON object in an S3 bucket.
+type S3Archive struct {
+	config aws.S3Config
+	creds  aws.Credentials
+	client *http.Client
+}
+
+// NewS3Archive creates an archive in the bucket. If the credentials are
+// empty, they are read from the standard AWS environment variables.
+func NewS3Archive(c aws.S3Config) *S3Archive {
+	return &S3Archive{
+		config: c,
+		creds:  c.Credentials(),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (a *S3Archive) Store(ctx context.Context, r Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal archive record")
+	}
+
+	key := a.config.Prefix + r.Key()
+	res, err := a.do(ctx, http.MethodPut, key, b)
+	if err != nil {
+		return errors.Wrapf(err, "failed to archive delivery %s", r.DeliveryID)
+	}
+	res.Body.Close()
+	return nil
+}
+
+// do sends a signed request for the key. It returns an error if the
+// response is not successful.
+func (a *S3Archive) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	u, err := a.config.ObjectURL(key, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create S3 URL")
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create S3 request")
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	aws.Sign(req, body, "s3", a.config.Region, a.creds, time.Now())
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		res.Body.Close()
+		return nil, errors.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res, nil
+}
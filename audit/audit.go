@@ -0,0 +1,154 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit records structured events describing the actions bulldozer
+// takes, for compliance and debugging.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	TypeMerge          = "merge"
+	TypeUpdate         = "update"
+	TypeMergeDecision  = "merge_decision"
+	TypeUpdateDecision = "update_decision"
+	TypeRequest        = "github_request"
+	TypeQueue          = "queue"
+	TypeConfig         = "config"
+
+	ResultEligible   = "eligible"
+	ResultIneligible = "ineligible"
+	ResultSucceeded  = "succeeded"
+
+	ResultMerged   = "merged"
+	ResultUpdated  = "updated"
+	ResultSkipped  = "skipped"
+	ResultConflict = "conflict"
+	ResultRejected = "rejected"
+	ResultAborted  = "aborted"
+	ResultFailed   = "failed"
+	ResultDryRun   = "dry_run"
+
+	ResultInvalid   = "invalid"
+	ResultAttempted = "attempted"
+	ResultQueued    = "queued"
+	ResultRemoved   = "removed"
+	ResultReordered = "reordered"
+)
+
+// Event is an audit record of an action taken on a pull request.
+type Event struct {
+	// ID identifies the event. It is assigned once, when the event is
+	// recorded, so that sinks that retry deliver the same ID.
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	SHA    string `json:"sha,omitempty"`
+
+	// Trigger describes the signal that caused the action
+	Trigger string `json:"trigger,omitempty"`
+
+	// ConfigHash identifies the repository configuration used
+	ConfigHash string `json:"config_hash,omitempty"`
+
+	Method string `json:"method,omitempty"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+
+	// MergeSHA is the SHA of the commit created by a merge
+	MergeSHA string `json:"merge_sha,omitempty"`
+
+	// UpdateSHA is the head of the pull request after an update, and Commits
+	// is the number of commits it was behind the base branch, which are the
+	// commits an update incorporates
+	UpdateSHA string `json:"update_sha,omitempty"`
+	Commits   int    `json:"commits,omitempty"`
+
+	// DurationMillis is how long the action took, if it was attempted
+	DurationMillis int64 `json:"duration_ms,omitempty"`
+
+	// Signals and Reasons explain a decision: the signals that matched and
+	// the requirements that are not met
+	Signals []string `json:"signals,omitempty"`
+	Reasons []string `json:"reasons,omitempty"`
+
+	// User is the operator who requested the action through the admin API
+	User string `json:"user,omitempty"`
+
+	// RequestIDs are the GitHub request IDs of the mutating API calls
+	RequestIDs []string `json:"request_ids,omitempty"`
+}
+
+// Sink stores audit events. Implementations must be safe for concurrent use.
+type Sink interface {
+	Record(ctx context.Context, event Event) error
+}
+
+type sinkCtxKey struct{}
+
+// WithSink returns a context that records events to the sink.
+func WithSink(ctx context.Context, sink Sink) context.Context {
+	return context.WithValue(ctx, sinkCtxKey{}, sink)
+}
+
+// Ctx returns the sink associated with the context. If the context has no
+// sink, a sink that discards events is returned.
+func Ctx(ctx context.Context) Sink {
+	if s, ok := ctx.Value(sinkCtxKey{}).(Sink); ok {
+		return s
+	}
+	return nopSink{}
+}
+
+// Record records the event to the sink associated with the context, logging
+// any errors. The ID and time of the event are set if they are empty.
+func Record(ctx context.Context, event Event) {
+	if event.ID == "" {
+		event.ID = NewCloudEventID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if err := Ctx(ctx).Record(ctx, event); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msgf("Failed to record %s audit event", event.Type)
+	}
+}
+
+type nopSink struct{}
+
+func (nopSink) Record(ctx context.Context, event Event) error {
+	return nil
+}
+
+// MultiSink records events to all of its sinks.
+type MultiSink []Sink
+
+func (ms MultiSink) Record(ctx context.Context, event Event) error {
+	var firstErr error
+	for _, s := range ms {
+		if err := s.Record(ctx, event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// bufferMaxPending is the number of events a BufferedSink keeps while its
+// sink is slow or unavailable; recording later events fails
+const bufferMaxPending = 10000
+
+// BufferedSink records events to a sink in the background, so that sinks
+// that send events over the network, like HTTP and S3, do not delay the
+// requests that are audited. Errors recording events are logged with the
+// logger.
+type BufferedSink struct {
+	sink   Sink
+	logger zerolog.Logger
+
+	events chan Event
+	done   chan struct{}
+
+	lock   sync.RWMutex
+	closed bool
+}
+
+// NewBufferedSink returns a sink that records events to sink in the
+// background until it is closed.
+func NewBufferedSink(sink Sink, logger zerolog.Logger) *BufferedSink {
+	s := &BufferedSink{
+		sink:   sink,
+		logger: logger,
+		events: make(chan Event, bufferMaxPending),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *BufferedSink) Record(ctx context.Context, event Event) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closed {
+		return errors.New("audit sink is closed")
+	}
+
+	select {
+	case s.events <- event:
+		return nil
+	default:
+		return errors.New("too many audit events are waiting to be recorded")
+	}
+}
+
+func (s *BufferedSink) run() {
+	defer close(s.done)
+
+	// recording continues after the audited request finishes
+	ctx := s.logger.WithContext(context.Background())
+	for event := range s.events {
+		if err := s.sink.Record(ctx, event); err != nil {
+			s.logger.Error().Err(err).Msgf("Failed to record %s audit event for %s/%s#%d", event.Type, event.Owner, event.Repo, event.Number)
+		}
+	}
+}
+
+// Close records the buffered events and stops the sink, waiting until the
+// context is done. It does nothing if the sink is nil.
+func (s *BufferedSink) Close(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.lock.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "audit events were not recorded before the deadline")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingSink struct {
+	lock    sync.Mutex
+	events  []Event
+	release chan struct{}
+}
+
+func (s *blockingSink) Record(ctx context.Context, event Event) error {
+	<-s.release
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *blockingSink) recorded() []Event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+func TestBufferedSink(t *testing.T) {
+	inner := &blockingSink{release: make(chan struct{})}
+	sink := NewBufferedSink(inner, zerolog.Nop())
+
+	// recording does not wait for the slow sink
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, sink.Record(context.Background(), Event{Type: "merge", Owner: "o", Repo: "r", Number: i}))
+	}
+	assert.Empty(t, inner.recorded())
+
+	close(inner.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, sink.Close(ctx))
+
+	events := inner.recorded()
+	require.Len(t, events, 3)
+	for i, event := range events {
+		assert.Equal(t, i+1, event.Number, "events are recorded in order")
+	}
+
+	assert.Error(t, sink.Record(context.Background(), Event{Type: "merge"}), "closed sinks reject events")
+}
+
+func TestBufferedSinkFull(t *testing.T) {
+	inner := &blockingSink{release: make(chan struct{})}
+	sink := NewBufferedSink(inner, zerolog.Nop())
+	defer close(inner.release)
+
+	// one event is held by the blocked sink, the rest fill the buffer
+	var err error
+	for i := 0; i <= bufferMaxPending+1 && err == nil; i++ {
+		err = sink.Record(context.Background(), Event{Type: "merge", Number: i})
+	}
+	assert.EqualError(t, err, "too many audit events are waiting to be recorded")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, sink.Close(ctx), "closing waits for the blocked sink until the deadline")
+}
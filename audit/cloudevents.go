@@ -0,0 +1,94 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+const (
+	// CloudEventsContentType is the content type of events in the structured
+	// JSON format of CloudEvents
+	CloudEventsContentType = "application/cloudevents+json"
+
+	// CloudEventTypePrefix prefixes the types of all CloudEvents. Audit
+	// events have the type "com.palantir.bulldozer.audit.<type>", such as
+	// "com.palantir.bulldozer.audit.merge".
+	CloudEventTypePrefix = "com.palantir.bulldozer."
+
+	cloudEventsSpecVersion = "1.0"
+)
+
+// CloudEvent is an event in the structured JSON format of the CloudEvents 1.0
+// specification.
+type CloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// NewCloudEvent returns a CloudEvent with the ID for something that happened
+// to a pull request. The source is "/<owner>/<repo>", "/<owner>" for events
+// without a repository, or "/" for events without an owner, and the subject
+// is the number of the pull request, if any.
+func NewCloudEvent(id, eventType, owner, repo string, number int, t time.Time, data interface{}) CloudEvent {
+	var subject string
+	if number > 0 {
+		subject = strconv.Itoa(number)
+	}
+
+	source := "/"
+	switch {
+	case owner != "" && repo != "":
+		source = "/" + owner + "/" + repo
+	case owner != "":
+		source = "/" + owner
+	}
+
+	return CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              id,
+		Source:          source,
+		Type:            CloudEventTypePrefix + eventType,
+		Subject:         subject,
+		Time:            t.UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+}
+
+// AsCloudEvent returns the audit event as a CloudEvent with the ID of the
+// event. Events that were not recorded with Record get a new ID.
+func AsCloudEvent(event Event) CloudEvent {
+	if event.ID == "" {
+		event.ID = NewCloudEventID()
+	}
+	return NewCloudEvent(event.ID, "audit."+event.Type, event.Owner, event.Repo, event.Number, event.Time, event)
+}
+
+// NewCloudEventID returns a random ID for a CloudEvent.
+func NewCloudEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// WriterSink writes events to a writer as JSON lines.
+type WriterSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewWriterSink returns a sink that writes to w. Use os.Stdout to ship events
+// with the logs of the server.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Record(ctx context.Context, event Event) error {
+	b, err := marshalLine(event)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, err := s.w.Write(b); err != nil {
+		return errors.Wrap(err, "failed to write audit event")
+	}
+	return nil
+}
+
+// FileSink appends events to a file as JSON lines. If MaxSize is positive, the
+// file is rotated before it grows beyond MaxSize bytes: the current file is
+// renamed with the suffix ".1", existing backups are shifted, and at most
+// MaxBackups backups are kept.
+type FileSink struct {
+	lock sync.Mutex
+	file *os.File
+	size int64
+
+	path       string
+	maxSize    int64
+	maxBackups int
+}
+
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) Record(ctx context.Context, event Event) error {
+	b, err := marshalLine(event)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(b)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(b)
+	s.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "failed to write audit event")
+	}
+	return nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open audit file %s", s.path)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrapf(err, "failed to stat audit file %s", s.path)
+	}
+
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close audit file %s", s.path)
+	}
+
+	if err := s.shiftBackups(); err != nil {
+		// keep appending to the current file so that later events are not
+		// lost; rotation is tried again with the next event
+		if openErr := s.open(); openErr != nil {
+			return errors.Wrap(openErr, err.Error())
+		}
+		return err
+	}
+	return s.open()
+}
+
+// shiftBackups renames the current file and its backups, or removes the
+// current file if no backups are kept.
+func (s *FileSink) shiftBackups() error {
+	if s.maxBackups > 0 {
+		for i := s.maxBackups - 1; i > 0; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "failed to rotate audit file %s", s.path)
+			}
+		}
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return errors.Wrapf(err, "failed to rotate audit file %s", s.path)
+		}
+	} else if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to rotate audit file %s", s.path)
+	}
+	return nil
+}
+
+func marshalLine(event Event) ([]byte, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal audit event")
+	}
+	return append(b, '\n'), nil
+}
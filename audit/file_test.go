@@ -0,0 +1,78 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSinkRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	event := Event{Type: "merge", Owner: "owner", Repo: "repo", Result: "success"}
+	line, err := marshalLine(event)
+	require.NoError(t, err)
+
+	// each file holds two events
+	sink, err := NewFileSink(path, int64(2*len(line)), 1)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Record(context.Background(), event))
+	}
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	backup, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+
+	lines := strings.Count(string(current), "\n") + strings.Count(string(backup), "\n")
+	assert.Equal(t, 3, lines)
+	assert.Equal(t, 1, strings.Count(string(current), "\n"))
+}
+
+func TestFileSinkRotateFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	// a non-empty directory in place of the backup makes renaming fail
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "blocked"), 0750))
+
+	event := Event{Type: "merge", Owner: "owner", Repo: "repo", Result: "success"}
+	line, err := marshalLine(event)
+	require.NoError(t, err)
+
+	sink, err := NewFileSink(path, int64(2*len(line)), 1)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Record(context.Background(), event))
+	require.NoError(t, sink.Record(context.Background(), event))
+	assert.Error(t, sink.Record(context.Background(), event), "rotation fails")
+
+	// the file stays open, so the sink recovers once rotation succeeds
+	require.NoError(t, os.RemoveAll(path+".1"))
+	require.NoError(t, sink.Record(context.Background(), event))
+
+	backup, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(backup), "\n"))
+}
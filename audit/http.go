@@ -0,0 +1,78 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPSink posts each event as JSON to a URL.
+type HTTPSink struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+
+	// CloudEvents posts events as CloudEvents in the structured JSON format
+	CloudEvents bool
+}
+
+func NewHTTPSink(url string, headers map[string]string) *HTTPSink {
+	return &HTTPSink{
+		URL:     url,
+		Headers: headers,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *HTTPSink) Record(ctx context.Context, event Event) error {
+	var body interface{} = event
+	contentType := "application/json"
+	if s.CloudEvents {
+		body = AsCloudEvent(event)
+		contentType = CloudEventsContentType
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit event")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to create audit request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to post audit event")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf("failed to post audit event: unexpected status %d", res.StatusCode)
+	}
+	return nil
+}
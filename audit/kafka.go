@@ -0,0 +1,344 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/registry"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+const (
+	KafkaFormatJSON = "json"
+	KafkaFormatAvro = "avro"
+
+	// kafkaFlushInterval is the longest time events are buffered before
+	// they are produced
+	kafkaFlushInterval = time.Second
+
+	// kafkaMaxPending is the number of events kept while Kafka is
+	// unavailable; recording later events fails
+	kafkaMaxPending = 10000
+)
+
+// KafkaConfig configures a KafkaSink, which produces messages directly to the
+// brokers of a cluster.
+type KafkaConfig struct {
+	// Brokers are the addresses used to discover the cluster, like
+	// "kafka-1.example.com:9092"
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+
+	// Format is "json" or "avro". Avro messages use AvroEventSchema, which
+	// is registered with the schema registry, and the wire format of the
+	// Confluent schema registry. Defaults to "json".
+	Format string `yaml:"format"`
+
+	// SchemaRegistryURL is the URL of the schema registry used by the "avro"
+	// format
+	SchemaRegistryURL string `yaml:"schema_registry_url"`
+
+	// CloudEvents produces events as CloudEvents in the structured JSON
+	// format. It requires the "json" format.
+	CloudEvents bool `yaml:"cloudevents"`
+
+	// TLS connects to the brokers with TLS
+	TLS bool `yaml:"tls"`
+
+	// Username and Password authenticate to the brokers with SASL/PLAIN,
+	// and to the schema registry with basic authentication, if set
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+func (c KafkaConfig) Enabled() bool {
+	return len(c.Brokers) > 0 && c.Topic != ""
+}
+
+// AvroEventSchema is the Avro schema of events produced in the "avro" format.
+// Every field is present in every message, with empty values for fields that
+// do not apply to the event.
+const AvroEventSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "com.palantir.bulldozer.audit",
+  "fields": [
+    {"name": "time", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "type", "type": "string"},
+    {"name": "owner", "type": "string"},
+    {"name": "repo", "type": "string"},
+    {"name": "number", "type": "int"},
+    {"name": "sha", "type": "string", "default": ""},
+    {"name": "trigger", "type": "string", "default": ""},
+    {"name": "config_hash", "type": "string", "default": ""},
+    {"name": "method", "type": "string", "default": ""},
+    {"name": "result", "type": "string"},
+    {"name": "detail", "type": "string", "default": ""},
+    {"name": "merge_sha", "type": "string", "default": ""},
+    {"name": "update_sha", "type": "string", "default": ""},
+    {"name": "commits", "type": "int", "default": 0},
+    {"name": "duration_ms", "type": "long", "default": 0},
+    {"name": "signals", "type": {"type": "array", "items": "string"}, "default": []},
+    {"name": "reasons", "type": {"type": "array", "items": "string"}, "default": []},
+    {"name": "user", "type": "string", "default": ""},
+    {"name": "request_ids", "type": {"type": "array", "items": "string"}, "default": []}
+  ]
+}`
+
+// avroEvent is an event in the shape of AvroEventSchema.
+type avroEvent struct {
+	Time           time.Time `avro:"time"`
+	Type           string    `avro:"type"`
+	Owner          string    `avro:"owner"`
+	Repo           string    `avro:"repo"`
+	Number         int       `avro:"number"`
+	SHA            string    `avro:"sha"`
+	Trigger        string    `avro:"trigger"`
+	ConfigHash     string    `avro:"config_hash"`
+	Method         string    `avro:"method"`
+	Result         string    `avro:"result"`
+	Detail         string    `avro:"detail"`
+	MergeSHA       string    `avro:"merge_sha"`
+	UpdateSHA      string    `avro:"update_sha"`
+	Commits        int       `avro:"commits"`
+	DurationMillis int64     `avro:"duration_ms"`
+	Signals        []string  `avro:"signals"`
+	Reasons        []string  `avro:"reasons"`
+	User           string    `avro:"user"`
+	RequestIDs     []string  `avro:"request_ids"`
+}
+
+func newAvroEvent(e Event) avroEvent {
+	nonNil := func(s []string) []string {
+		if s == nil {
+			return []string{}
+		}
+		return s
+	}
+
+	return avroEvent{
+		Time:           e.Time,
+		Type:           e.Type,
+		Owner:          e.Owner,
+		Repo:           e.Repo,
+		Number:         e.Number,
+		SHA:            e.SHA,
+		Trigger:        e.Trigger,
+		ConfigHash:     e.ConfigHash,
+		Method:         e.Method,
+		Result:         e.Result,
+		Detail:         e.Detail,
+		MergeSHA:       e.MergeSHA,
+		UpdateSHA:      e.UpdateSHA,
+		Commits:        e.Commits,
+		DurationMillis: e.DurationMillis,
+		Signals:        nonNil(e.Signals),
+		Reasons:        nonNil(e.Reasons),
+		User:           e.User,
+		RequestIDs:     nonNil(e.RequestIDs),
+	}
+}
+
+// kafkaWriter produces messages. It is implemented by kafka.Writer.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// KafkaSink produces each event as a message to a Kafka topic, keyed by the
+// repository so that the events of a repository stay in order. Messages are
+// buffered and produced in batches in the background, so recording never
+// waits for Kafka, and are retried if producing fails.
+type KafkaSink struct {
+	config   KafkaConfig
+	writer   kafkaWriter
+	registry *registry.Client
+	schema   avro.Schema
+	logger   zerolog.Logger
+
+	pending int64
+
+	lock     sync.Mutex
+	schemaID []byte
+}
+
+// NewKafkaSink returns a sink for the configuration. Errors producing
+// messages in the background are logged with the logger.
+func NewKafkaSink(c KafkaConfig, logger zerolog.Logger) (*KafkaSink, error) {
+	switch c.Format {
+	case "":
+		c.Format = KafkaFormatJSON
+	case KafkaFormatJSON, KafkaFormatAvro:
+	default:
+		return nil, errors.Errorf("invalid kafka format %q, expected %q or %q", c.Format, KafkaFormatJSON, KafkaFormatAvro)
+	}
+	if c.CloudEvents && c.Format != KafkaFormatJSON {
+		return nil, errors.Errorf("kafka cloudevents require the %q format", KafkaFormatJSON)
+	}
+
+	s := &KafkaSink{config: c, logger: logger}
+
+	if c.Format == KafkaFormatAvro {
+		if c.SchemaRegistryURL == "" {
+			return nil, errors.Errorf("the kafka %q format requires a schema registry", KafkaFormatAvro)
+		}
+
+		var opts []registry.ClientFunc
+		if c.Username != "" {
+			opts = append(opts, registry.WithBasicAuth(c.Username, c.Password))
+		}
+		client, err := registry.NewClient(c.SchemaRegistryURL, opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid kafka schema registry")
+		}
+		schema, err := avro.Parse(AvroEventSchema)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid avro schema")
+		}
+		s.registry = client
+		s.schema = schema
+	}
+
+	transport := &kafka.Transport{}
+	if c.TLS {
+		transport.TLS = &tls.Config{}
+	}
+	if c.Username != "" {
+		transport.SASL = plain.Mechanism{Username: c.Username, Password: c.Password}
+	}
+
+	s.writer = &kafka.Writer{
+		Addr:         kafka.TCP(c.Brokers...),
+		Topic:        c.Topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: kafkaFlushInterval,
+		RequiredAcks: kafka.RequireAll,
+		Async:        true,
+		Completion:   s.completed,
+		Transport:    transport,
+	}
+	return s, nil
+}
+
+func (s *KafkaSink) Record(ctx context.Context, event Event) error {
+	msg, err := s.message(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	if atomic.AddInt64(&s.pending, 1) > kafkaMaxPending {
+		atomic.AddInt64(&s.pending, -1)
+		return errors.New("too many events are waiting to be produced to kafka")
+	}
+
+	// the writer is asynchronous, so this only fails if it is closed
+	if err := s.writer.WriteMessages(ctx, msg); err != nil {
+		atomic.AddInt64(&s.pending, -1)
+		return errors.Wrap(err, "failed to produce audit event to kafka")
+	}
+	return nil
+}
+
+// completed is called by the writer when messages are produced or when
+// producing them failed after all retries.
+func (s *KafkaSink) completed(messages []kafka.Message, err error) {
+	atomic.AddInt64(&s.pending, -int64(len(messages)))
+	if err != nil {
+		s.logger.Error().Err(err).Msgf("Failed to produce %d audit events to kafka", len(messages))
+	}
+}
+
+// Close produces the buffered events and stops the sink, waiting until the
+// context is done. It does nothing if the sink is nil.
+func (s *KafkaSink) Close(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.writer.Close() }()
+
+	select {
+	case err := <-done:
+		return errors.Wrap(err, "failed to produce audit events to kafka")
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "audit events were not produced to kafka before the deadline")
+	}
+}
+
+func (s *KafkaSink) message(ctx context.Context, e Event) (kafka.Message, error) {
+	msg := kafka.Message{Key: []byte(e.Owner + "/" + e.Repo)}
+
+	var err error
+	switch {
+	case s.config.Format == KafkaFormatAvro:
+		msg.Value, err = s.avroValue(ctx, e)
+	case s.config.CloudEvents:
+		msg.Headers = []kafka.Header{{Key: "content-type", Value: []byte(CloudEventsContentType)}}
+		msg.Value, err = json.Marshal(AsCloudEvent(e))
+	default:
+		msg.Value, err = json.Marshal(e)
+	}
+	if err != nil {
+		return kafka.Message{}, errors.Wrap(err, "failed to encode audit event for kafka")
+	}
+	return msg, nil
+}
+
+// avroValue encodes the event in the wire format of the Confluent schema
+// registry: a zero byte, the schema ID, and the Avro binary encoding.
+func (s *KafkaSink) avroValue(ctx context.Context, e Event) ([]byte, error) {
+	id, err := s.registerSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := avro.Marshal(s.schema, newAvroEvent(e))
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{0}, id...), b...), nil
+}
+
+// registerSchema registers AvroEventSchema for the values of the topic, once,
+// and returns its ID in the wire format.
+func (s *KafkaSink) registerSchema(ctx context.Context) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.schemaID != nil {
+		return s.schemaID, nil
+	}
+
+	id, _, err := s.registry.CreateSchema(ctx, s.config.Topic+"-value", AvroEventSchema)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to register avro schema")
+	}
+
+	s.schemaID = make([]byte, 4)
+	binary.BigEndian.PutUint32(s.schemaID, uint32(id))
+	return s.schemaID, nil
+}
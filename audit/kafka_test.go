@@ -0,0 +1,171 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeKafkaWriter struct {
+	messages []kafka.Message
+	closed   bool
+}
+
+func (w *fakeKafkaWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	if w.closed {
+		return errors.New("kafka.(*Writer): Writer is closed")
+	}
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *fakeKafkaWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func newTestKafkaSink(t *testing.T, c KafkaConfig) (*KafkaSink, *fakeKafkaWriter) {
+	c.Brokers = []string{"localhost:9092"}
+	c.Topic = "bulldozer"
+
+	s, err := NewKafkaSink(c, zerolog.Nop())
+	require.NoError(t, err)
+
+	w := &fakeKafkaWriter{}
+	s.writer = w
+	return s, w
+}
+
+func TestKafkaSinkMessages(t *testing.T) {
+	ctx := context.Background()
+	event := Event{
+		ID:     "event-id",
+		Time:   time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		Type:   "merge",
+		Owner:  "palantir",
+		Repo:   "bulldozer",
+		Number: 12,
+		Result: "success",
+	}
+
+	t.Run("json", func(t *testing.T) {
+		s, w := newTestKafkaSink(t, KafkaConfig{})
+		require.NoError(t, s.Record(ctx, event))
+		require.Len(t, w.messages, 1)
+		assert.Equal(t, "palantir/bulldozer", string(w.messages[0].Key))
+
+		var value Event
+		require.NoError(t, json.Unmarshal(w.messages[0].Value, &value))
+		assert.Equal(t, event, value)
+	})
+
+	t.Run("cloudevents", func(t *testing.T) {
+		s, w := newTestKafkaSink(t, KafkaConfig{CloudEvents: true})
+		require.NoError(t, s.Record(ctx, event))
+		require.NoError(t, s.Record(ctx, event))
+		require.Len(t, w.messages, 2)
+		assert.Equal(t, []kafka.Header{{Key: "content-type", Value: []byte(CloudEventsContentType)}}, w.messages[0].Headers)
+
+		var value CloudEvent
+		require.NoError(t, json.Unmarshal(w.messages[0].Value, &value))
+		assert.Equal(t, CloudEventTypePrefix+"audit.merge", value.Type)
+		assert.Equal(t, "event-id", value.ID)
+		assert.Equal(t, "/palantir/bulldozer", value.Source)
+
+		var again CloudEvent
+		require.NoError(t, json.Unmarshal(w.messages[1].Value, &again))
+		assert.Equal(t, value.ID, again.ID, "the same event keeps its ID")
+	})
+
+	t.Run("avro", func(t *testing.T) {
+		registrations := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/subjects/bulldozer-value/versions", r.URL.Path)
+			registrations++
+			_, _ = w.Write([]byte(`{"id": 7}`))
+		}))
+		defer srv.Close()
+
+		s, w := newTestKafkaSink(t, KafkaConfig{Format: KafkaFormatAvro, SchemaRegistryURL: srv.URL})
+		require.NoError(t, s.Record(ctx, event))
+		require.NoError(t, s.Record(ctx, event))
+		require.Len(t, w.messages, 2)
+		assert.Equal(t, 1, registrations, "the schema is registered once")
+
+		value := w.messages[0].Value
+		require.True(t, len(value) > 5)
+		assert.Equal(t, byte(0), value[0])
+		assert.Equal(t, uint32(7), binary.BigEndian.Uint32(value[1:5]))
+
+		var decoded avroEvent
+		require.NoError(t, avro.Unmarshal(avro.MustParse(AvroEventSchema), value[5:], &decoded))
+		assert.Equal(t, "merge", decoded.Type)
+		assert.Equal(t, 12, decoded.Number)
+		assert.True(t, event.Time.Equal(decoded.Time))
+		assert.Equal(t, []string{}, decoded.Signals)
+	})
+}
+
+func TestAsCloudEventSource(t *testing.T) {
+	assert.Equal(t, "/palantir/bulldozer", AsCloudEvent(Event{Owner: "palantir", Repo: "bulldozer"}).Source)
+	assert.Equal(t, "/palantir", AsCloudEvent(Event{Owner: "palantir"}).Source)
+	assert.Equal(t, "/", AsCloudEvent(Event{}).Source)
+	assert.NotEmpty(t, AsCloudEvent(Event{}).ID)
+}
+
+func TestKafkaSinkPending(t *testing.T) {
+	ctx := context.Background()
+	s, w := newTestKafkaSink(t, KafkaConfig{})
+
+	for i := 0; i < kafkaMaxPending; i++ {
+		require.NoError(t, s.Record(ctx, Event{Type: "merge"}))
+	}
+	assert.Error(t, s.Record(ctx, Event{Type: "merge"}), "events are rejected while too many are waiting")
+
+	// producing fails after all retries
+	s.completed(w.messages[:10], errors.New("leader not available"))
+	require.NoError(t, s.Record(ctx, Event{Type: "merge"}), "failed events no longer count as waiting")
+
+	require.NoError(t, s.Close(ctx))
+	assert.Error(t, s.Record(ctx, Event{Type: "merge"}), "closed sinks reject events")
+	assert.Equal(t, int64(kafkaMaxPending-9), s.pending)
+
+	var nilSink *KafkaSink
+	assert.NoError(t, nilSink.Close(ctx))
+}
+
+func TestNewKafkaSink(t *testing.T) {
+	_, err := NewKafkaSink(KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "t", Format: "xml"}, zerolog.Nop())
+	assert.Error(t, err)
+
+	_, err = NewKafkaSink(KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "t", Format: KafkaFormatAvro}, zerolog.Nop())
+	assert.Error(t, err, "avro requires a schema registry")
+
+	_, err = NewKafkaSink(KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "t", Format: KafkaFormatAvro, CloudEvents: true, SchemaRegistryURL: "http://localhost:8081"}, zerolog.Nop())
+	assert.Error(t, err, "cloudevents require json")
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/aws"
+)
+
+// S3Sink writes each event as a separate JSON object in an S3 bucket. Combined
+// with bucket versioning or object locks, this provides an immutable trail.
+// If the credentials are empty, they are read from the standard AWS
+// environment variables.
+type S3Sink struct {
+	config aws.S3Config
+	creds  aws.Credentials
+	client *http.Client
+}
+
+func NewS3Sink(c aws.S3Config) *S3Sink {
+	return &S3Sink{
+		config: c,
+		creds:  c.Credentials(),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *S3Sink) Record(ctx context.Context, event Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal audit event")
+	}
+
+	key := fmt.Sprintf("%s%s-%s-%s-%d-%s.json",
+		s.config.Prefix,
+		event.Time.UTC().Format("2006/01/02/150405.000000000"),
+		event.Owner, event.Repo, event.Number, event.Type,
+	)
+
+	return s.put(ctx, key, b)
+}
+
+func (s *S3Sink) put(ctx context.Context, key string, body []byte) error {
+	u, err := s.config.ObjectURL(key, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create S3 URL")
+	}
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create S3 request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	aws.Sign(req, body, "s3", s.config.Region, s.creds, time.Now())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to put S3 object")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf("failed to put S3 object %s: unexpected status %d", key, res.StatusCode)
+	}
+	return nil
+}
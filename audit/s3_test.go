@@ -0,0 +1,62 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/aws"
+)
+
+func TestS3Sink(t *testing.T) {
+	var path, auth string
+	var event Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		assert.NotEmpty(t, r.Header.Get("X-Amz-Content-Sha256"))
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &event))
+	}))
+	defer srv.Close()
+
+	sink := NewS3Sink(aws.S3Config{
+		Bucket:          "audit",
+		Region:          "us-east-1",
+		Prefix:          "events/",
+		Endpoint:        srv.URL,
+		AccessKeyID:     "id",
+		SecretAccessKey: "secret",
+	})
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, sink.Record(context.Background(), Event{Time: at, Type: TypeMerge, Owner: "o", Repo: "r", Number: 1, Result: ResultMerged}))
+
+	assert.Equal(t, "/audit/events/2020/01/02/030405.000000000-o-r-1-merge.json", path)
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=id/20"), auth)
+	assert.Equal(t, ResultMerged, event.Result)
+}
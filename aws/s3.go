@@ -0,0 +1,64 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// S3Config configures access to an S3 bucket. If the credentials are empty,
+// they are read from the standard AWS environment variables.
+type S3Config struct {
+	Bucket string `yaml:"bucket"`
+	Region string `yaml:"region"`
+	Prefix string `yaml:"prefix"`
+
+	// Endpoint overrides the default AWS endpoint, for S3-compatible
+	// storage. Requests to custom endpoints use path-style addressing.
+	Endpoint string `yaml:"endpoint"`
+
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+}
+
+// Credentials returns the configured credentials, or the credentials in the
+// environment if none are configured.
+func (c S3Config) Credentials() Credentials {
+	return Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+	}.OrEnvironment()
+}
+
+// ObjectURL returns the URL of the object with the key, or of the bucket if
+// the key is empty.
+func (c S3Config) ObjectURL(key string, query url.Values) (*url.URL, error) {
+	var u *url.URL
+	var err error
+	if c.Endpoint != "" {
+		u, err = url.Parse(strings.TrimSuffix(c.Endpoint, "/") + "/" + c.Bucket + "/" + key)
+	} else {
+		u, err = url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", c.Bucket, c.Region, key))
+	}
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = canonicalQuery(query)
+	return u, nil
+}
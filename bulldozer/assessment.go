@@ -0,0 +1,186 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+// StatusCheckName is the name of the check run that summarizes what bulldozer
+// thinks of a pull request.
+const StatusCheckName = "bulldozer"
+
+// StatusContext is the context of the commit status that summarizes what
+// bulldozer thinks of a pull request, for repositories that prefer statuses
+// to check runs.
+const StatusContext = "bulldozer/ready"
+
+// assessmentPrefix is the prefix of the state keys that remember the last
+// published assessment of each pull request, so that unchanged assessments
+// are not published again
+const assessmentPrefix = "assessments/"
+
+// assessmentTTL forgets the assessments of inactive pull requests
+const assessmentTTL = 7 * 24 * time.Hour
+
+// AssessmentState is what bulldozer is doing with a pull request.
+type AssessmentState string
+
+const (
+	AssessmentWaiting  AssessmentState = "waiting"
+	AssessmentEligible AssessmentState = "eligible"
+	AssessmentQueued   AssessmentState = "queued"
+	AssessmentMerging  AssessmentState = "merging"
+	AssessmentPaused   AssessmentState = "paused"
+)
+
+// Assessment is bulldozer's current view of a pull request.
+type Assessment struct {
+	State AssessmentState
+
+	// Reasons lists the requirements that the pull request does not meet
+	// while it is waiting
+	Reasons []string
+
+	// Approval is the reason, also in Reasons, that policy-bot has not
+	// approved a waiting pull request. It leads the title of the assessment.
+	Approval string
+
+	// Position is the zero-based position of a queued pull request
+	Position int
+
+	// Detail explains why a pull request is paused or eligible but not
+	// merging
+	Detail string
+}
+
+// IsOwnCheck returns true if the check run or status was published by
+// bulldozer, so it is never waited on.
+func IsOwnCheck(name string) bool {
+	return name == StatusCheckName || strings.HasPrefix(name, "bulldozer/")
+}
+
+// checkRunStatus describes the assessment as a completed check run. Waiting
+// and paused pull requests are neutral so that the check run never fails a
+// pull request on its own.
+func (a Assessment) checkRunStatus() CheckRunStatus {
+	switch a.State {
+	case AssessmentWaiting:
+		title := fmt.Sprintf("Waiting on %d requirements", len(a.Reasons))
+		switch {
+		case len(a.Reasons) == 1:
+			title = "Waiting on " + a.Reasons[0]
+		case a.Approval != "" && len(a.Reasons) == 2:
+			title = fmt.Sprintf("Waiting on %s and 1 more requirement", a.Approval)
+		case a.Approval != "":
+			title = fmt.Sprintf("Waiting on %s and %d more requirements", a.Approval, len(a.Reasons)-1)
+		}
+		var summary strings.Builder
+		summary.WriteString("bulldozer will merge this pull request once these requirements are met:\n\n")
+		for _, reason := range a.Reasons {
+			fmt.Fprintf(&summary, "- %s\n", reason)
+		}
+		return CheckRunStatus{Conclusion: "neutral", Title: title, Summary: summary.String()}
+
+	case AssessmentQueued:
+		return CheckRunStatus{
+			Conclusion: "success",
+			Title:      fmt.Sprintf("Queued at position %d", a.Position+1),
+			Summary:    fmt.Sprintf("This pull request meets all requirements and is in the merge queue behind %d other pull requests. See the %s check run for details.", a.Position, QueueCheckName),
+		}
+
+	case AssessmentMerging:
+		return CheckRunStatus{
+			Conclusion: "success",
+			Title:      "Merging",
+			Summary:    "This pull request meets all requirements and is being merged.",
+		}
+
+	case AssessmentPaused:
+		return CheckRunStatus{
+			Conclusion: "neutral",
+			Title:      "Paused",
+			Summary:    fmt.Sprintf("This pull request meets all requirements, but bulldozer is not merging it: %s.", a.Detail),
+		}
+	}
+
+	summary := "This pull request meets all requirements and will be merged."
+	if a.Detail != "" {
+		summary = fmt.Sprintf("This pull request meets all requirements and will be merged: %s.", a.Detail)
+	}
+	return CheckRunStatus{Conclusion: "success", Title: "Ready to merge", Summary: summary}
+}
+
+// commitStatus describes the assessment as a commit status. Statuses have no
+// neutral state, so pull requests that cannot be merged yet are pending.
+func (a Assessment) commitStatus() *github.RepoStatus {
+	status := a.checkRunStatus()
+
+	state := "success"
+	if status.Conclusion != "success" {
+		state = "pending"
+	}
+
+	// GitHub rejects descriptions longer than 140 characters
+	description := status.Title
+	if len(description) > 140 {
+		description = description[:137] + "..."
+	}
+
+	return &github.RepoStatus{
+		State:       github.String(state),
+		Description: github.String(description),
+		Context:     github.String(StatusContext),
+	}
+}
+
+// PublishAssessment updates the StatusCheckName check run or the
+// StatusContext commit status on the head of the pull request, depending on
+// the output, unless it already shows the assessment.
+func PublishAssessment(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest, output AssessmentOutput, assessment Assessment) error {
+	status := assessment.checkRunStatus()
+	sha := pr.GetHead().GetSHA()
+
+	h := sha256.Sum256([]byte(sha + "\x00" + string(output) + "\x00" + status.Conclusion + "\x00" + status.Title + "\x00" + status.Summary))
+	digest := hex.EncodeToString(h[:])
+
+	store := state.Ctx(ctx)
+	key := fmt.Sprintf("%s%s/%s#%d", assessmentPrefix, owner, repo, pr.GetNumber())
+	if last, ok, err := store.Get(ctx, key); err == nil && ok && string(last) == digest {
+		return nil
+	}
+
+	switch output {
+	case AssessmentStatus:
+		if _, _, err := client.Repositories.CreateStatus(ctx, owner, repo, sha, assessment.commitStatus()); err != nil {
+			return errors.Wrapf(err, "cannot create status %s for %s", StatusContext, sha)
+		}
+	default:
+		if err := upsertCheckRun(ctx, client, owner, repo, sha, pr.GetHead().GetRef(), StatusCheckName, status); err != nil {
+			return err
+		}
+	}
+	return errors.Wrapf(store.Set(ctx, key, []byte(digest), assessmentTTL), "failed to record assessment of %s/%s#%d", owner, repo, pr.GetNumber())
+}
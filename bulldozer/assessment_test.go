@@ -0,0 +1,64 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssessmentCheckRunStatus(t *testing.T) {
+	status := Assessment{State: AssessmentWaiting, Reasons: []string{"1 of 2 required approving reviews"}}.checkRunStatus()
+	assert.Equal(t, "neutral", status.Conclusion)
+	assert.Equal(t, "Waiting on 1 of 2 required approving reviews", status.Title)
+
+	status = Assessment{State: AssessmentWaiting, Reasons: []string{"pull request is on hold", "unfulfilled status checks: [ci]"}}.checkRunStatus()
+	assert.Equal(t, "Waiting on 2 requirements", status.Title)
+	assert.Contains(t, status.Summary, "- pull request is on hold\n- unfulfilled status checks: [ci]\n")
+
+	status = Assessment{State: AssessmentWaiting, Reasons: []string{"policy-bot: 0/1 rules approved", "unfulfilled status checks: [ci]"}, Approval: "policy-bot: 0/1 rules approved"}.checkRunStatus()
+	assert.Equal(t, "Waiting on policy-bot: 0/1 rules approved and 1 more requirement", status.Title)
+
+	status = Assessment{State: AssessmentQueued, Position: 2}.checkRunStatus()
+	assert.Equal(t, "success", status.Conclusion)
+	assert.Equal(t, "Queued at position 3", status.Title)
+
+	status = Assessment{State: AssessmentPaused, Detail: "it was removed from the merge queue by admin"}.checkRunStatus()
+	assert.Equal(t, "neutral", status.Conclusion)
+	assert.Contains(t, status.Summary, "removed from the merge queue by admin")
+
+	status = Assessment{State: AssessmentEligible}.checkRunStatus()
+	assert.Equal(t, "Ready to merge", status.Title)
+}
+
+func TestAssessmentCommitStatus(t *testing.T) {
+	status := Assessment{State: AssessmentWaiting, Reasons: []string{"pull request is on hold"}}.commitStatus()
+	assert.Equal(t, "pending", status.GetState())
+	assert.Equal(t, StatusContext, status.GetContext())
+	assert.Equal(t, "Waiting on pull request is on hold", status.GetDescription())
+
+	status = Assessment{State: AssessmentQueued, Position: 1}.commitStatus()
+	assert.Equal(t, "success", status.GetState())
+
+	status = Assessment{State: AssessmentWaiting, Reasons: []string{strings.Repeat("x", 200)}}.commitStatus()
+	assert.Len(t, status.GetDescription(), 140)
+}
+
+func TestStatusPatternIgnoresOwnChecks(t *testing.T) {
+	states := map[string]string{"ci": "success", StatusCheckName: "neutral", StatusContext: "pending", QueueCheckName: "in_progress"}
+	assert.True(t, statusPatternSatisfied("*", states, NeutralChecksFail))
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/pull"
+)
+
+// mergeEvent returns an audit event for a merge attempt of the pull request,
+// with the fields that are known before merging.
+func mergeEvent(ctx context.Context, pullCtx pull.Context, mergeConfig MergeConfig, method MergeMethod) audit.Event {
+	trigger := "whitelisting is disabled"
+	if mergeConfig.Whitelist.Enabled() {
+		// errors are ignored here because the reason describes them
+		_, trigger, _ = IsPRWhitelisted(ctx, pullCtx, mergeConfig.Whitelist)
+	}
+
+	return audit.Event{
+		Type:       audit.TypeMerge,
+		Owner:      pullCtx.Owner(),
+		Repo:       pullCtx.Repo(),
+		Number:     pullCtx.Number(),
+		Trigger:    trigger,
+		ConfigHash: ConfigHash(mergeConfig),
+		Method:     string(method),
+	}
+}
+
+// updateEvent returns an audit event for an update attempt of the pull
+// request, with the fields that are known before updating.
+func updateEvent(pullCtx pull.Context, updateConfig UpdateConfig, trigger UpdateTrigger) audit.Event {
+	method := updateConfig.Method
+	if method == "" {
+		method = UpdateMerge
+	}
+
+	return audit.Event{
+		Type:       audit.TypeUpdate,
+		Owner:      pullCtx.Owner(),
+		Repo:       pullCtx.Repo(),
+		Number:     pullCtx.Number(),
+		Trigger:    string(trigger),
+		ConfigHash: ConfigHash(updateConfig),
+		Method:     string(method),
+	}
+}
+
+// RecordDecision records an audit event of the given type for a merge or
+// update decision about the pull request. The configuration is hashed to
+// identify the settings used.
+func RecordDecision(ctx context.Context, pullCtx pull.Context, eventType string, decision Decision, config interface{}) {
+	event := audit.Event{
+		Type:       eventType,
+		Owner:      pullCtx.Owner(),
+		Repo:       pullCtx.Repo(),
+		Number:     pullCtx.Number(),
+		ConfigHash: ConfigHash(config),
+		Result:     audit.ResultIneligible,
+		Signals:    decision.Signals,
+		Reasons:    decision.Reasons,
+	}
+	if decision.Eligible {
+		event.Result = audit.ResultEligible
+	}
+	audit.Record(ctx, event)
+}
+
+// ConfigHash returns a stable hash identifying the configuration.
+func ConfigHash(config interface{}) string {
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// requestID returns the GitHub request ID of the response, if available.
+func requestID(res *http.Response) string {
+	if res == nil {
+		return ""
+	}
+	return res.Header.Get("X-GitHub-Request-Id")
+}
@@ -0,0 +1,255 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// cherryPickConflictError is returned when a commit cannot be applied to the
+// target branch without conflicts.
+type cherryPickConflictError string
+
+func (err cherryPickConflictError) Error() string {
+	return string(err)
+}
+
+// cherryPick applies the changes introduced by a commit, relative to its
+// first parent, to the target branch and stores the result on a new branch.
+// It returns the SHA of the new commit.
+func cherryPick(ctx context.Context, client *github.Client, owner, repo, sha, target, branch string) (string, error) {
+	commit, _, err := client.Git.GetCommit(ctx, owner, repo, sha)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get commit %s", sha)
+	}
+	if len(commit.Parents) == 0 {
+		return "", errors.Errorf("cannot cherry-pick root commit %s", sha)
+	}
+
+	targetRef, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+target)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get branch %s", target)
+	}
+	targetSHA := targetRef.GetObject().GetSHA()
+
+	ref := "refs/heads/" + branch
+	if _, _, err := client.Git.CreateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String(ref),
+		Object: &github.GitObject{SHA: github.String(targetSHA)},
+	}); err != nil {
+		return "", errors.Wrapf(err, "cannot create branch %s", branch)
+	}
+
+	tree, err := cherryPickTree(ctx, client, owner, repo, branch, targetSHA, sha, commit.Parents[0].GetSHA())
+	if err != nil {
+		if _, ok := errors.Cause(err).(cherryPickConflictError); ok {
+			return "", cherryPickConflictError(fmt.Sprintf("commit %s does not apply cleanly to %s", sha, target))
+		}
+		return "", err
+	}
+
+	picked, _, err := client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: commit.Message,
+		Tree:    &github.Tree{SHA: github.String(tree)},
+		Parents: []github.Commit{{SHA: github.String(targetSHA)}},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create cherry-picked commit")
+	}
+	if err := setRef(ctx, client, owner, repo, ref, picked.GetSHA()); err != nil {
+		return "", err
+	}
+
+	return picked.GetSHA(), nil
+}
+
+// cherryPickTree returns the SHA of the tree that results from applying the
+// changes of the commit, relative to its parent, to the onto commit. The
+// branch is a temporary branch that is moved while applying the commit. If
+// the changes conflict with onto, it returns a cherryPickConflictError.
+//
+// The Git data API has no cherry-pick operation and cannot apply a commit to
+// a different parent, so this creates a temporary commit with the tree of
+// onto and the parent of the commit, then merges the commit into it with the
+// merge API. Because the parent of the commit is the merge base, the merge
+// applies exactly the changes of the commit. Callers create the final commit
+// from the tree with the parents they need.
+func cherryPickTree(ctx context.Context, client *github.Client, owner, repo, branch, onto, sha, parent string) (string, error) {
+	ontoCommit, _, err := client.Git.GetCommit(ctx, owner, repo, onto)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get commit %s", onto)
+	}
+
+	sibling, _, err := client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.String(fmt.Sprintf("Temporary commit to apply %s", sha)),
+		Tree:    ontoCommit.Tree,
+		Parents: []github.Commit{{SHA: github.String(parent)}},
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot create temporary commit for %s", sha)
+	}
+	if err := setRef(ctx, client, owner, repo, "refs/heads/"+branch, sibling.GetSHA()); err != nil {
+		return "", err
+	}
+
+	merged, res, err := client.Repositories.Merge(ctx, owner, repo, &github.RepositoryMergeRequest{
+		Base:          github.String(branch),
+		Head:          github.String(sha),
+		CommitMessage: github.String(fmt.Sprintf("Apply %s", sha)),
+	})
+	if err != nil {
+		if res != nil && res.StatusCode == http.StatusConflict {
+			return "", cherryPickConflictError(fmt.Sprintf("commit %s does not apply cleanly to %s", sha, onto))
+		}
+		return "", errors.Wrapf(err, "cannot apply commit %s", sha)
+	}
+	if res.StatusCode == http.StatusNoContent {
+		// the commit has no changes relative to its parent
+		return ontoCommit.GetTree().GetSHA(), nil
+	}
+	return merged.GetCommit().GetTree().GetSHA(), nil
+}
+
+func setRef(ctx context.Context, client *github.Client, owner, repo, ref, sha string) error {
+	_, _, err := client.Git.UpdateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String(ref),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}, true)
+	return errors.Wrapf(err, "cannot update %s to %s", ref, sha)
+}
+
+// openCherryPickPR cherry-picks a commit on to a new branch based on target
+// and opens a pull request for the branch. The new pull request is labeled
+// with the given labels. If the branch already exists, no pull request is
+// created and the returned pull request is nil.
+func openCherryPickPR(ctx context.Context, client *github.Client, owner, repo, sha, target, branch, title, body string, labels []string) (*github.PullRequest, error) {
+	if _, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+branch); err == nil {
+		return nil, nil
+	} else if rerr, ok := err.(*github.ErrorResponse); !ok || rerr.Response.StatusCode != http.StatusNotFound {
+		return nil, errors.Wrapf(err, "cannot check for existing branch %s", branch)
+	}
+
+	if _, err := cherryPick(ctx, client, owner, repo, sha, target, branch); err != nil {
+		if _, derr := client.Git.DeleteRef(ctx, owner, repo, "refs/heads/"+branch); derr != nil {
+			zerolog.Ctx(ctx).Error().Err(errors.WithStack(derr)).Msgf("Failed to delete branch %s after failed cherry-pick", branch)
+		}
+		return nil, err
+	}
+
+	pr, _, err := client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title: github.String(title),
+		Head:  github.String(branch),
+		Base:  github.String(target),
+		Body:  github.String(body),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot open pull request from %s to %s", branch, target)
+	}
+
+	if len(labels) > 0 {
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, pr.GetNumber(), labels); err != nil {
+			return pr, errors.Wrapf(err, "cannot label pull request #%d", pr.GetNumber())
+		}
+	}
+
+	return pr, nil
+}
+
+// backportPR opens a backport pull request for every backport label on the
+// merged pull request.
+func backportPR(ctx context.Context, client *github.Client, pr *github.PullRequest, sha string, config BackportConfig) {
+	var targets []string
+	for _, label := range pr.Labels {
+		if !strings.HasPrefix(label.GetName(), config.LabelPrefix) {
+			continue
+		}
+
+		target := strings.TrimPrefix(label.GetName(), config.LabelPrefix)
+		if target == "" || target == pr.GetBase().GetRef() {
+			continue
+		}
+		targets = append(targets, target)
+	}
+
+	portPR(ctx, client, pr, sha, targets, "backport", config.Labels)
+}
+
+// forwardPortPR opens a forward-port pull request for every branch configured
+// for the base branch of the merged pull request.
+func forwardPortPR(ctx context.Context, client *github.Client, pr *github.PullRequest, sha string, config ForwardPortConfig) {
+	var targets []string
+	for _, target := range config.Branches[pr.GetBase().GetRef()] {
+		if target != pr.GetBase().GetRef() {
+			targets = append(targets, target)
+		}
+	}
+
+	portPR(ctx, client, pr, sha, targets, "forward-port", config.Labels)
+}
+
+// portPR cherry-picks the merge commit of a pull request to each target
+// branch and opens a pull request for each one. The kind describes the
+// operation in branch names and comments. The results are posted as a
+// comment on the merged pull request.
+func portPR(ctx context.Context, client *github.Client, pr *github.PullRequest, sha string, targets []string, kind string, labels []string) {
+	logger := zerolog.Ctx(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	name := strings.ToUpper(kind[:1]) + kind[1:]
+
+	var results []string
+	for _, target := range targets {
+		branch := fmt.Sprintf("bulldozer/%s-%d-to-%s", kind, pr.GetNumber(), target)
+		title := fmt.Sprintf("[%s] %s", target, pr.GetTitle())
+		body := fmt.Sprintf("%s of #%d to `%s`.\n\n%s", name, pr.GetNumber(), target, pr.GetBody())
+
+		logger.Debug().Msgf("Attempting to %s %s to %s", kind, sha, target)
+		ported, err := openCherryPickPR(ctx, client, owner, repo, sha, target, branch, title, body, labels)
+		switch {
+		case err != nil:
+			if _, ok := errors.Cause(err).(cherryPickConflictError); ok {
+				logger.Info().Msgf("Unable to %s to %s: %s", kind, target, err.Error())
+				results = append(results, fmt.Sprintf("* `%s`: failed, the changes do not apply cleanly", target))
+				continue
+			}
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to %s to %s", kind, target)
+			results = append(results, fmt.Sprintf("* `%s`: failed due to an unexpected error", target))
+		case ported == nil:
+			logger.Debug().Msgf("%s branch %s already exists, skipping", name, branch)
+		default:
+			logger.Info().Msgf("Opened %s pull request #%d to %s", kind, ported.GetNumber(), target)
+			results = append(results, fmt.Sprintf("* `%s`: #%d", target, ported.GetNumber()))
+		}
+	}
+
+	if len(results) == 0 {
+		return
+	}
+
+	comment := &github.IssueComment{
+		Body: github.String(name + "s:\n\n" + strings.Join(results, "\n")),
+	}
+	if _, _, err := client.Issues.CreateComment(ctx, owner, repo, pr.GetNumber(), comment); err != nil {
+		logger.Error().Err(errors.WithStack(err)).Msgf("Failed to comment with %s results", kind)
+	}
+}
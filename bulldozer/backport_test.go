@@ -0,0 +1,226 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createdCommit is the body of a request to create a commit.
+type createdCommit struct {
+	Message string   `json:"message"`
+	Tree    string   `json:"tree"`
+	Parents []string `json:"parents"`
+}
+
+func newCherryPickServer(t *testing.T, mergeStatus int, commits *[]createdCommit) *github.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/commits/fix":
+			_, _ = w.Write([]byte(`{"sha": "fix", "message": "fix: widgets", "parents": [{"sha": "parent"}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/refs/heads/release":
+			_, _ = w.Write([]byte(`{"ref": "refs/heads/release", "object": {"sha": "target"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/commits/target":
+			_, _ = w.Write([]byte(`{"sha": "target", "tree": {"sha": "target-tree"}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/refs":
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/o/r/git/refs/heads/backport":
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/commits":
+			var c createdCommit
+			if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+				t.Errorf("invalid commit: %v", err)
+			}
+			*commits = append(*commits, c)
+			_, _ = w.Write([]byte(`{"sha": "created"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/merges":
+			w.WriteHeader(mergeStatus)
+			if mergeStatus == http.StatusCreated {
+				_, _ = w.Write([]byte(`{"sha": "merged", "commit": {"tree": {"sha": "merged-tree"}}}`))
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+func TestCherryPick(t *testing.T) {
+	t.Run("applied", func(t *testing.T) {
+		var commits []createdCommit
+		client := newCherryPickServer(t, http.StatusCreated, &commits)
+
+		sha, err := cherryPick(context.Background(), client, "o", "r", "fix", "release", "backport")
+		require.NoError(t, err)
+		assert.Equal(t, "created", sha)
+
+		require.Len(t, commits, 2)
+		assert.Equal(t, "target-tree", commits[0].Tree, "the temporary commit has the tree of the target")
+		assert.Equal(t, "parent", commits[0].Parents[0])
+		assert.Equal(t, "merged-tree", commits[1].Tree)
+		assert.Equal(t, "target", commits[1].Parents[0])
+		assert.Equal(t, "fix: widgets", commits[1].Message)
+	})
+
+	t.Run("noChanges", func(t *testing.T) {
+		var commits []createdCommit
+		client := newCherryPickServer(t, http.StatusNoContent, &commits)
+
+		_, err := cherryPick(context.Background(), client, "o", "r", "fix", "release", "backport")
+		require.NoError(t, err)
+		require.Len(t, commits, 2)
+		assert.Equal(t, "target-tree", commits[1].Tree)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		var commits []createdCommit
+		client := newCherryPickServer(t, http.StatusConflict, &commits)
+
+		_, err := cherryPick(context.Background(), client, "o", "r", "fix", "release", "backport")
+		require.Error(t, err)
+		assert.IsType(t, cherryPickConflictError(""), errors.Cause(err))
+		assert.EqualError(t, err, "commit fix does not apply cleanly to release")
+	})
+}
+
+// backportServer serves the API requests made to backport the merge commit
+// "fix" of pull request o/r#1 to the release branch.
+type backportServer struct {
+	branchExists bool
+
+	pulls    []github.NewPullRequest
+	labels   []string
+	comments []string
+}
+
+func (s *backportServer) client(t *testing.T) *github.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/refs/heads/bulldozer/backport-1-to-release":
+			if !s.branchExists {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(`{"ref": "refs/heads/bulldozer/backport-1-to-release", "object": {"sha": "target"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/commits/fix":
+			_, _ = w.Write([]byte(`{"sha": "fix", "message": "fix: widgets", "parents": [{"sha": "parent"}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/refs/heads/release":
+			_, _ = w.Write([]byte(`{"ref": "refs/heads/release", "object": {"sha": "target"}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/commits/target":
+			_, _ = w.Write([]byte(`{"sha": "target", "tree": {"sha": "target-tree"}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/refs":
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/o/r/git/refs/heads/bulldozer/backport-1-to-release":
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/commits":
+			_, _ = w.Write([]byte(`{"sha": "created"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/merges":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"sha": "merged", "commit": {"tree": {"sha": "merged-tree"}}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/pulls":
+			var pr github.NewPullRequest
+			if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+				t.Errorf("invalid pull request: %v", err)
+			}
+			s.pulls = append(s.pulls, pr)
+			_, _ = w.Write([]byte(`{"number": 2}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/issues/2/labels":
+			var labels []string
+			if err := json.NewDecoder(r.Body).Decode(&labels); err != nil {
+				t.Errorf("invalid labels: %v", err)
+			}
+			s.labels = append(s.labels, labels...)
+			_, _ = w.Write([]byte(`[]`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/issues/1/comments":
+			var c github.IssueComment
+			if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+				t.Errorf("invalid comment: %v", err)
+			}
+			s.comments = append(s.comments, c.GetBody())
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+func backportPullRequest() *github.PullRequest {
+	return &github.PullRequest{
+		Number: github.Int(1),
+		Title:  github.String("Fix widgets"),
+		Labels: []*github.Label{
+			{Name: github.String("backport/release")},
+			{Name: github.String("backport/develop")},
+			{Name: github.String("bug")},
+		},
+		Base: &github.PullRequestBranch{
+			Ref: github.String("develop"),
+			Repo: &github.Repository{
+				Name:  github.String("r"),
+				Owner: &github.User{Login: github.String("o")},
+			},
+		},
+	}
+}
+
+func TestBackportPR(t *testing.T) {
+	config := BackportConfig{
+		LabelPrefix: "backport/",
+		Labels:      []string{"merge when ready"},
+	}
+
+	t.Run("opensPullRequests", func(t *testing.T) {
+		srv := &backportServer{}
+
+		backportPR(context.Background(), srv.client(t), backportPullRequest(), "fix", config)
+
+		require.Len(t, srv.pulls, 1, "only labels for other branches request backports")
+		assert.Equal(t, "bulldozer/backport-1-to-release", srv.pulls[0].GetHead())
+		assert.Equal(t, "release", srv.pulls[0].GetBase())
+		assert.Equal(t, "[release] Fix widgets", srv.pulls[0].GetTitle())
+		assert.Equal(t, []string{"merge when ready"}, srv.labels)
+		assert.Equal(t, []string{"Backports:\n\n* `release`: #2"}, srv.comments)
+	})
+
+	t.Run("existingBranch", func(t *testing.T) {
+		srv := &backportServer{branchExists: true}
+
+		backportPR(context.Background(), srv.client(t), backportPullRequest(), "fix", config)
+
+		assert.Empty(t, srv.pulls)
+		assert.Empty(t, srv.comments)
+	})
+}
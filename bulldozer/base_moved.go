@@ -0,0 +1,121 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+// baseMovedMarker identifies comments that report updates after the base
+// branch moved.
+const baseMovedMarker = "<!-- bulldozer:base-moved -->"
+
+// baseMovedTTL is how long the number of updates after the base branch moved
+// is kept after the first update
+const baseMovedTTL = 7 * 24 * time.Hour
+
+// baseMovedKey is the state key counting the updates of a pull request after
+// its base branch moved. The count is kept in the state store rather than in
+// the comment, which users can edit, so that the limit is shared by all
+// server instances and cannot be reset from the pull request.
+func baseMovedKey(owner, repo string, number int) string {
+	return fmt.Sprintf("base-moved/%s/%s#%d", owner, repo, number)
+}
+
+// baseMovedAttempts returns the number of updates of the pull request after
+// its base branch moved.
+func baseMovedAttempts(ctx context.Context, owner, repo string, number int) (int, error) {
+	value, ok, err := state.Ctx(ctx).Get(ctx, baseMovedKey(owner, repo, number))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get base moved attempts")
+	}
+	if !ok {
+		return 0, nil
+	}
+
+	attempts, err := strconv.Atoi(string(value))
+	return attempts, errors.Wrap(err, "invalid base moved attempts")
+}
+
+// isBaseMoved returns true if the merge error indicates that the pull request
+// cannot be merged because its base branch moved.
+func isBaseMoved(pr *github.PullRequest, gerr *github.ErrorResponse) bool {
+	switch gerr.Response.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusConflict:
+	default:
+		return false
+	}
+	return pr.GetMergeableState() == "behind" || strings.Contains(strings.ToLower(gerr.Message), "base branch was modified")
+}
+
+// recoverBaseMoved updates the pull request with its base branch so that the
+// merge can be retried once checks pass on the new head. It stops after the
+// maximum number of attempts.
+func recoverBaseMoved(ctx context.Context, client *github.Client, pr *github.PullRequest, maxAttempts int) error {
+	logger := zerolog.Ctx(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	if problem := headProblem(pr, true); problem != "" {
+		reportHeadProblem(ctx, client, pr, "update", problem)
+		return nil
+	}
+	attempts, err := baseMovedAttempts(ctx, owner, repo, pr.GetNumber())
+	if err != nil {
+		return err
+	}
+
+	if attempts >= maxAttempts {
+		logger.Info().Msgf("Not updating pull request because it was already updated %d times after the base branch moved", attempts)
+		body := fmt.Sprintf("bulldozer stopped updating this pull request after %s moved %d times. Merge it manually. (attempt %d of %d)", pr.GetBase().GetRef(), attempts, attempts, maxAttempts)
+		return upsertMarkedComment(ctx, client, owner, repo, pr.GetNumber(), baseMovedMarker, body)
+	}
+
+	writer, err := headClient(ctx, client, pr)
+	if err != nil {
+		return err
+	}
+	if writer == nil {
+		reportHeadProblem(ctx, client, pr, "update", forkNotInstalledProblem)
+		return nil
+	}
+
+	mergeCommit, err := mergeBaseIntoHead(ctx, client, writer, pr)
+	if err != nil {
+		return errors.Wrapf(err, "cannot merge %s into %s", pr.GetBase().GetRef(), pr.GetHead().GetRef())
+	}
+
+	n, err := state.Ctx(ctx).Increment(ctx, baseMovedKey(owner, repo, pr.GetNumber()), baseMovedTTL)
+	if err != nil {
+		return errors.Wrap(err, "failed to count base moved attempt")
+	}
+	attempts = int(n)
+
+	logger.Info().Msgf("Updated pull request to %s after the base branch moved (attempt %d of %d)", mergeCommit.GetSHA(), attempts, maxAttempts)
+	body := fmt.Sprintf("bulldozer updated this pull request because %s moved. It will retry the merge when the required checks pass. (attempt %d of %d)", pr.GetBase().GetRef(), attempts, maxAttempts)
+	return upsertMarkedComment(ctx, client, owner, repo, pr.GetNumber(), baseMovedMarker, body)
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+func TestBaseMovedAttempts(t *testing.T) {
+	store := state.NewMemoryStore()
+	ctx := state.WithStore(context.Background(), store)
+
+	attempts, err := baseMovedAttempts(ctx, "owner", "repo", 1)
+	require.Nil(t, err)
+	assert.Equal(t, 0, attempts)
+
+	_, err = store.Increment(ctx, baseMovedKey("owner", "repo", 1), baseMovedTTL)
+	require.Nil(t, err)
+	_, err = store.Increment(ctx, baseMovedKey("owner", "repo", 1), baseMovedTTL)
+	require.Nil(t, err)
+
+	attempts, err = baseMovedAttempts(ctx, "owner", "repo", 1)
+	require.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+
+	attempts, err = baseMovedAttempts(ctx, "owner", "repo", 2)
+	require.Nil(t, err)
+	assert.Equal(t, 0, attempts, "attempts are counted per pull request")
+
+	require.Nil(t, store.Set(ctx, baseMovedKey("owner", "repo", 3), []byte("x"), time.Hour))
+	_, err = baseMovedAttempts(ctx, "owner", "repo", 3)
+	assert.Error(t, err)
+}
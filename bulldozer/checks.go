@@ -0,0 +1,80 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// CheckRunStatus describes the state of a check run published by bulldozer.
+// If Conclusion is set, the check run is completed.
+type CheckRunStatus struct {
+	Status     string
+	Conclusion string
+	Title      string
+	Summary    string
+}
+
+// upsertCheckRun creates or updates the check run with the given name on the
+// commit, so that each commit has at most one check run with the name.
+func upsertCheckRun(ctx context.Context, client *github.Client, owner, repo, sha, branch, name string, status CheckRunStatus) error {
+	runs, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, &github.ListCheckRunsOptions{
+		CheckName: github.String(name),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "cannot list check runs for %s", sha)
+	}
+
+	output := &github.CheckRunOutput{
+		Title:   github.String(status.Title),
+		Summary: github.String(status.Summary),
+	}
+
+	var state, conclusion *string
+	var completedAt *github.Timestamp
+	if status.Conclusion != "" {
+		state = github.String("completed")
+		conclusion = github.String(status.Conclusion)
+		completedAt = &github.Timestamp{Time: time.Now()}
+	} else if status.Status != "" {
+		state = github.String(status.Status)
+	}
+
+	if len(runs.CheckRuns) > 0 {
+		_, _, err := client.Checks.UpdateCheckRun(ctx, owner, repo, runs.CheckRuns[0].GetID(), github.UpdateCheckRunOptions{
+			Name:        name,
+			Status:      state,
+			Conclusion:  conclusion,
+			CompletedAt: completedAt,
+			Output:      output,
+		})
+		return errors.Wrapf(err, "cannot update check run %s for %s", name, sha)
+	}
+
+	_, _, err = client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+		Name:        name,
+		HeadBranch:  branch,
+		HeadSHA:     sha,
+		Status:      state,
+		Conclusion:  conclusion,
+		CompletedAt: completedAt,
+		Output:      output,
+	})
+	return errors.Wrapf(err, "cannot create check run %s for %s", name, sha)
+}
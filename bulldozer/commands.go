@@ -0,0 +1,162 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// CommandPrefix starts every comment command.
+const CommandPrefix = "/bulldozer"
+
+// Command is an action requested by a comment on a pull request.
+type Command string
+
+const (
+	// CommandHold prevents the pull request from merging until it is released
+	CommandHold Command = "hold"
+
+	// CommandRelease removes a hold from the pull request
+	CommandRelease Command = "release"
+
+	// CommandMergeNow removes any hold and merges the pull request without
+	// waiting for a whitelist signal or for the merge queue
+	CommandMergeNow Command = "merge now"
+
+	// CommandPauseUpdates stops bulldozer from updating the pull request
+	// until updates are resumed
+	CommandPauseUpdates Command = "pause-updates"
+
+	// CommandResumeUpdates allows bulldozer to update the pull request again
+	CommandResumeUpdates Command = "resume-updates"
+
+	// CommandUpdate updates the pull request once, even if it does not have
+	// the update signal. The author of the pull request may also run it.
+	CommandUpdate Command = "update"
+)
+
+// holdMarker identifies the comment that records a hold on a pull request.
+// While the comment exists, the pull request is not merged.
+const holdMarker = "<!-- bulldozer:hold -->"
+
+// pauseUpdatesMarker identifies the comment that records that updates of a
+// pull request are paused.
+const pauseUpdatesMarker = "<!-- bulldozer:pause-updates -->"
+
+// AuthorMayRun returns true if the author of a pull request may run the
+// command on it without write permission. These commands only change how
+// bulldozer updates the author's own branch, such as pausing updates while
+// the author rebases it.
+func (c Command) AuthorMayRun() bool {
+	switch c {
+	case CommandPauseUpdates, CommandResumeUpdates, CommandUpdate:
+		return true
+	}
+	return false
+}
+
+// Valid returns true if the command is supported.
+func (c Command) Valid() bool {
+	switch c {
+	case CommandHold, CommandRelease, CommandMergeNow, CommandPauseUpdates, CommandResumeUpdates, CommandUpdate:
+		return true
+	}
+	return false
+}
+
+// ParseCommand returns the command in the first line of a comment and true if
+// the comment starts with the command prefix. The returned command may not be
+// valid.
+func ParseCommand(body string) (Command, bool) {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(body), "\n", 2)[0])
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != CommandPrefix {
+		return "", false
+	}
+	return Command(strings.ToLower(strings.Join(fields[1:], " "))), true
+}
+
+// CanRunCommands returns true if the user has write or admin permission on
+// the repository.
+func CanRunCommands(ctx context.Context, client *github.Client, owner, repo, user string) (bool, error) {
+	level, _, err := client.Repositories.GetPermissionLevel(ctx, owner, repo, user)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get permission level of %s", user)
+	}
+
+	switch level.GetPermission() {
+	case "admin", "write":
+		return true, nil
+	}
+	return false, nil
+}
+
+// HoldPR prevents the pull request from merging until it is released.
+func HoldPR(ctx context.Context, client *github.Client, owner, repo string, number int, user string) error {
+	body := fmt.Sprintf("Merging is on hold at the request of @%s. Comment `%s %s` to allow merging again.", user, CommandPrefix, CommandRelease)
+	if err := upsertMarkedComment(ctx, client, owner, repo, number, holdMarker, body); err != nil {
+		return err
+	}
+	recordPause(ctx, Pause{Kind: PauseKindHold, Owner: owner, Repo: repo, Number: number, User: user})
+	return nil
+}
+
+// ReleasePR removes a hold from the pull request, if it has one.
+func ReleasePR(ctx context.Context, client *github.Client, owner, repo string, number int) error {
+	if err := deleteMarkedComment(ctx, client, owner, repo, number, holdMarker); err != nil {
+		return err
+	}
+	forgetPause(ctx, PauseKindHold, owner, repo, number)
+	return nil
+}
+
+// PauseUpdates stops bulldozer from updating the pull request until updates
+// are resumed.
+func PauseUpdates(ctx context.Context, client *github.Client, owner, repo string, number int, user string) error {
+	body := fmt.Sprintf("Updates of this pull request are paused at the request of @%s. Comment `%s %s` to allow updates again.", user, CommandPrefix, CommandResumeUpdates)
+	if err := upsertMarkedComment(ctx, client, owner, repo, number, pauseUpdatesMarker, body); err != nil {
+		return err
+	}
+	recordPause(ctx, Pause{Kind: PauseKindUpdates, Owner: owner, Repo: repo, Number: number, User: user})
+	return nil
+}
+
+// ResumeUpdates allows bulldozer to update the pull request again.
+func ResumeUpdates(ctx context.Context, client *github.Client, owner, repo string, number int) error {
+	if err := deleteMarkedComment(ctx, client, owner, repo, number, pauseUpdatesMarker); err != nil {
+		return err
+	}
+	forgetPause(ctx, PauseKindUpdates, owner, repo, number)
+	return nil
+}
+
+// isUpdatePaused returns true if any of the comments by the login records
+// that updates are paused.
+func isUpdatePaused(comments []pull.Comment, login string) bool {
+	return hasMarkedComment(comments, login, pauseUpdatesMarker)
+}
+
+// isHeld returns true if any of the comments by the login records a hold.
+func isHeld(comments []pull.Comment, login string) bool {
+	return hasMarkedComment(comments, login, holdMarker)
+}
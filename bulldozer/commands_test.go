@@ -0,0 +1,53 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		body    string
+		command Command
+		ok      bool
+	}{
+		{"/bulldozer hold", CommandHold, true},
+		{"  /bulldozer   Merge  Now\nwe need this fix", CommandMergeNow, true},
+		{"/bulldozer release", CommandRelease, true},
+		{"/bulldozer pause-updates", CommandPauseUpdates, true},
+		{"/bulldozer frobnicate", Command("frobnicate"), true},
+		{"/bulldozerhold", "", false},
+		{"please /bulldozer hold", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		command, ok := ParseCommand(test.body)
+		assert.Equal(t, test.ok, ok, "body %q", test.body)
+		assert.Equal(t, test.command, command, "body %q", test.body)
+	}
+}
+
+func TestCommandAuthorMayRun(t *testing.T) {
+	assert.True(t, CommandPauseUpdates.AuthorMayRun())
+	assert.True(t, CommandResumeUpdates.AuthorMayRun())
+	assert.True(t, CommandUpdate.AuthorMayRun())
+	assert.False(t, CommandHold.AuthorMayRun())
+	assert.False(t, CommandRelease.AuthorMayRun())
+	assert.False(t, CommandMergeNow.AuthorMayRun())
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// findMarkedComment returns the first issue comment on the pull request
+// written by bulldozer and containing the marker, or nil if there is no such
+// comment. Markers are usually HTML comments, which are not rendered.
+// Comments by other users are ignored, so that nobody can forge or remove
+// the state bulldozer keeps in comments. It fails if the login of the
+// bulldozer user is unknown, because every upsert would then add a duplicate
+// comment instead of replacing the existing one.
+func findMarkedComment(ctx context.Context, client *github.Client, owner, repo string, number int, marker string) (*github.IssueComment, error) {
+	login, err := BotLogin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if login == "" {
+		return nil, errors.New("the login of the bulldozer user is unknown, so its comments cannot be found")
+	}
+
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, res, err := client.Issues.ListComments(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list issue comments")
+		}
+
+		for _, c := range comments {
+			if c.GetUser().GetLogin() == login && strings.Contains(c.GetBody(), marker) {
+				return c, nil
+			}
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+	return nil, nil
+}
+
+// upsertMarkedComment creates or replaces the issue comment containing the
+// marker. The marker is prepended to the body.
+func upsertMarkedComment(ctx context.Context, client *github.Client, owner, repo string, number int, marker, body string) error {
+	existing, err := findMarkedComment(ctx, client, owner, repo, number, marker)
+	if err != nil {
+		return err
+	}
+
+	comment := &github.IssueComment{
+		Body: github.String(marker + "\n" + body),
+	}
+
+	if existing == nil {
+		_, _, err = client.Issues.CreateComment(ctx, owner, repo, number, comment)
+		return errors.Wrap(err, "failed to create comment")
+	}
+
+	if existing.GetBody() == comment.GetBody() {
+		return nil
+	}
+	_, _, err = client.Issues.EditComment(ctx, owner, repo, existing.GetID(), comment)
+	return errors.Wrap(err, "failed to edit comment")
+}
+
+// deleteMarkedComment deletes the issue comment containing the marker, if it
+// exists.
+func deleteMarkedComment(ctx context.Context, client *github.Client, owner, repo string, number int, marker string) error {
+	existing, err := findMarkedComment(ctx, client, owner, repo, number, marker)
+	if err != nil || existing == nil {
+		return err
+	}
+
+	_, err = client.Issues.DeleteComment(ctx, owner, repo, existing.GetID())
+	return errors.Wrap(err, "failed to delete comment")
+}
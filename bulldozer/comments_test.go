@@ -0,0 +1,75 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCommentServer(t *testing.T, requests *[]string) *github.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/issues/1/comments":
+			_, _ = w.Write([]byte(`[
+				{"id": 10, "body": "<!-- marker -->\nforged", "user": {"login": "mallory"}},
+				{"id": 11, "body": "<!-- marker -->\nold", "user": {"login": "bulldozer[bot]"}}
+			]`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/o/r/issues/comments/11":
+			_, _ = w.Write([]byte(`{"id": 11}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+func TestUpsertMarkedComment(t *testing.T) {
+	t.Run("editsExisting", func(t *testing.T) {
+		var requests []string
+		client := newCommentServer(t, &requests)
+		ctx := WithBotLogin(context.Background(), "bulldozer[bot]")
+
+		err := upsertMarkedComment(ctx, client, "o", "r", 1, "<!-- marker -->", "new")
+		require.Nil(t, err)
+		assert.Equal(t, []string{
+			"GET /repos/o/r/issues/1/comments",
+			"PATCH /repos/o/r/issues/comments/11",
+		}, requests)
+	})
+
+	t.Run("unknownLogin", func(t *testing.T) {
+		var requests []string
+		client := newCommentServer(t, &requests)
+		ctx := WithBotLogin(context.Background(), "")
+
+		err := upsertMarkedComment(ctx, client, "o", "r", 1, "<!-- marker -->", "new")
+		assert.Error(t, err)
+		assert.Empty(t, requests, "no comment may be created without the bot login")
+	})
+}
@@ -17,12 +17,17 @@ package bulldozer
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"regexp"
+	"text/template"
 
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/bulldozer/scm"
+	"github.com/palantir/bulldozer/tracing"
 )
 
 type FetchedConfig struct {
@@ -31,6 +36,11 @@ type FetchedConfig struct {
 	Ref    string
 	Config *Config
 	Error  error
+
+	// Notifications is read leniently from a v1 configuration that exists
+	// but is invalid, so that the repository can be told about the problem.
+	// It is nil if there is no v1 configuration.
+	Notifications *NotificationConfig
 }
 
 func (fc FetchedConfig) Missing() bool {
@@ -66,19 +76,40 @@ func NewConfigFetcher(configurationV1Path string, configurationV0Paths []string)
 // does not exist or is invalid, the returned error is nil and the appropriate
 // fields are set on the FetchedConfig.
 func (cf *ConfigFetcher) ConfigForPR(ctx context.Context, client *github.Client, pr *github.PullRequest) (FetchedConfig, error) {
+	return cf.ConfigForRef(ctx, client, pr.GetBase().GetRepo().GetOwner().GetLogin(), pr.GetBase().GetRepo().GetName(), pr.GetBase().GetRef())
+}
+
+// ConfigForRef fetches the configuration on a branch of a repository, like
+// ConfigForPR does for the base branch of a PR.
+func (cf *ConfigFetcher) ConfigForRef(ctx context.Context, client *github.Client, owner, repo, ref string) (FetchedConfig, error) {
+	return cf.ConfigFromProvider(ctx, scm.NewGitHub(client), owner, repo, ref)
+}
+
+// ConfigFromProvider fetches the configuration on a branch of a repository
+// hosted by any provider, like ConfigForRef does on GitHub.
+func (cf *ConfigFetcher) ConfigFromProvider(ctx context.Context, provider scm.Source, owner, repo, ref string) (FetchedConfig, error) {
 	fc := FetchedConfig{
-		Owner: pr.GetBase().GetRepo().GetOwner().GetLogin(),
-		Repo:  pr.GetBase().GetRepo().GetName(),
-		Ref:   pr.GetBase().GetRef(),
+		Owner: owner,
+		Repo:  repo,
+		Ref:   ref,
 	}
 
+	ctx, span := tracing.Start(ctx, "bulldozer.fetch_config")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("github.repository", owner+"/"+repo),
+		attribute.String("github.ref", ref),
+	)
+
 	logger := zerolog.Ctx(ctx)
 
-	bytes, err := cf.fetchConfigContents(ctx, client, fc.Owner, fc.Repo, fc.Ref, cf.configurationV1Path)
+	var invalidErr error
+	bytes, err := cf.fetchConfigContents(ctx, provider, fc.Owner, fc.Repo, fc.Ref, cf.configurationV1Path)
 	if err == nil && bytes != nil {
 		config, err := cf.unmarshalConfig(bytes)
 		if err != nil {
 			logger.Debug().Msgf("v1 config is invalid")
+			invalidErr = errors.Wrapf(err, "invalid configuration %q", cf.configurationV1Path)
 		} else {
 			fc.Config = config
 			return fc, nil
@@ -87,7 +118,7 @@ func (cf *ConfigFetcher) ConfigForPR(ctx context.Context, client *github.Client,
 
 	for _, configV0Path := range cf.configurationV0Paths {
 		logger.Debug().Msgf("v1 configuration not found; will attempt fetch v0 %s and unmarshal as v0", configV0Path)
-		bytes, err := cf.fetchConfigContents(ctx, client, fc.Owner, fc.Repo, fc.Ref, configV0Path)
+		bytes, err := cf.fetchConfigContents(ctx, provider, fc.Owner, fc.Repo, fc.Ref, configV0Path)
 		if err != nil {
 			continue
 		}
@@ -107,52 +138,163 @@ func (cf *ConfigFetcher) ConfigForPR(ctx context.Context, client *github.Client,
 	}
 
 	fc.Error = errors.New("Unable to find valid v1 or v0 configuration")
+	if invalidErr != nil {
+		fc.Error = invalidErr
+		fc.Notifications = readNotifications(bytes)
+	}
 	return fc, nil
 }
 
+// readNotifications reads the notification configuration of an invalid
+// configuration, ignoring everything else. If the notification configuration
+// cannot be read either, an empty configuration is returned.
+func readNotifications(bytes []byte) *NotificationConfig {
+	var config struct {
+		Notifications NotificationConfig `yaml:"notifications"`
+	}
+	if err := yaml.Unmarshal(bytes, &config); err != nil {
+		return &NotificationConfig{}
+	}
+	return &config.Notifications
+}
+
 // fetchConfigContents returns a nil slice if there is no configuration file
-func (cf *ConfigFetcher) fetchConfigContents(ctx context.Context, client *github.Client, owner, repo, ref, configPath string) ([]byte, error) {
+func (cf *ConfigFetcher) fetchConfigContents(ctx context.Context, provider scm.Source, owner, repo, ref, configPath string) ([]byte, error) {
 	logger := zerolog.Ctx(ctx)
 	logger.Debug().Str("path", configPath).Str("ref", ref).Msg("Attempting to fetch configuration definition")
 
-	opts := &github.RepositoryContentGetOptions{
-		Ref: ref,
+	return provider.FileContents(ctx, owner, repo, ref, configPath)
+}
+
+func (cf *ConfigFetcher) unmarshalConfig(bytes []byte) (*Config, error) {
+	var config Config
+	if err := yaml.UnmarshalStrict(bytes, &config); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal configuration")
+	}
+
+	if config.Version != 1 {
+		return nil, errors.Errorf("unexpected version '%d', expected 1", config.Version)
 	}
 
-	file, _, _, err := client.Repositories.GetContents(ctx, owner, repo, configPath, opts)
-	if err != nil {
-		if rerr, ok := err.(*github.ErrorResponse); ok && rerr.Response.StatusCode == http.StatusNotFound {
-			return nil, nil
+	if name := config.Merge.AfterMerge.Tag.Name; name != "" {
+		if _, err := template.New("tag").Parse(name); err != nil {
+			return nil, errors.Wrap(err, "invalid tag name template")
 		}
-		return nil, errors.Wrapf(err, "failed to fetch content of %q", configPath)
 	}
 
-	// file will be nil if the ref contains a directory at the expected file path
-	if file == nil {
-		return nil, nil
+	switch config.Merge.NeutralChecks {
+	case "", NeutralChecksPass, NeutralChecksFail, NeutralChecksIgnore:
+	default:
+		return nil, errors.Errorf("invalid neutral check policy %q", config.Merge.NeutralChecks)
 	}
 
-	content, err := file.GetContent()
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to decode content of %q", configPath)
+	switch config.Merge.Assessment {
+	case "", AssessmentCheckRun, AssessmentStatus:
+	default:
+		return nil, errors.Errorf("invalid assessment output %q", config.Merge.Assessment)
 	}
 
-	return []byte(content), nil
-}
+	switch config.Merge.StaleApprovals {
+	case "", DismissStaleApprovals, BlockStaleApprovals:
+	default:
+		return nil, errors.Errorf("invalid stale approval policy %q", config.Merge.StaleApprovals)
+	}
 
-func (cf *ConfigFetcher) unmarshalConfig(bytes []byte) (*Config, error) {
-	var config Config
-	if err := yaml.UnmarshalStrict(bytes, &config); err != nil {
-		return nil, errors.Wrapf(err, "failed to unmarshal configuration")
+	switch config.Update.Method {
+	case "", UpdateMerge, UpdateRebase, UpdateBranchAPI:
+	default:
+		return nil, errors.Errorf("invalid update method %q", config.Update.Method)
 	}
 
-	if config.Version != 1 {
-		return nil, errors.Errorf("unexpected version '%d', expected 1", config.Version)
+	if config.Update.Autosquash && config.Update.Method != UpdateRebase {
+		return nil, errors.Errorf("autosquash requires the %q update method", UpdateRebase)
+	}
+
+	switch config.Update.Order {
+	case "", UpdateOrderPriority, UpdateOrderOldest:
+	default:
+		return nil, errors.Errorf("invalid update order %q", config.Update.Order)
+	}
+
+	if config.Update.ConflictComment != "" {
+		if _, err := template.New("conflict").Parse(config.Update.ConflictComment); err != nil {
+			return nil, errors.Wrap(err, "invalid conflict comment template")
+		}
+	}
+
+	if config.Update.Stale.Comment != "" {
+		if _, err := template.New("stale").Parse(config.Update.Stale.Comment); err != nil {
+			return nil, errors.Wrap(err, "invalid stale comment template")
+		}
+	}
+
+	if pattern := config.Merge.AfterMerge.Jira.IssuePattern; pattern != "" {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, errors.Wrap(err, "invalid jira issue pattern")
+		}
+	}
+
+	if pattern := config.Merge.Trailers.TicketPattern; pattern != "" {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, errors.Wrap(err, "invalid ticket pattern")
+		}
+	}
+
+	chatEvents := []NotificationEvent{NotifyMerged, NotifyFailed, NotifyConflict}
+	if err := validateNotificationEvents("slack", config.Notifications.Slack.Events, chatEvents); err != nil {
+		return nil, err
+	}
+	if err := validateNotificationEvents("teams", config.Notifications.Teams.Events, chatEvents); err != nil {
+		return nil, err
+	}
+	if err := validateNotificationEvents("email", config.Notifications.Email.Events, append([]NotificationEvent{NotifyInvalidConfig}, chatEvents...)); err != nil {
+		return nil, err
+	}
+	webhookEvents := append([]NotificationEvent{NotifyInvalidConfig, NotifyMergeAttempted, NotifyUpdated, NotifyQueued}, chatEvents...)
+	for _, webhook := range config.Notifications.Webhooks {
+		if webhook.URL == "" {
+			return nil, errors.New("webhook notifications require a url")
+		}
+		if err := validateNotificationEvents("webhook", webhook.Events, webhookEvents); err != nil {
+			return nil, err
+		}
+	}
+
+	for method, opt := range config.Merge.Options {
+		if opt.CommitMessagePattern != "" {
+			if _, err := regexp.Compile(opt.CommitMessagePattern); err != nil {
+				return nil, errors.Wrapf(err, "invalid commit message pattern for method %s", method)
+			}
+		}
+		if opt.TitleTemplate != "" {
+			if _, err := template.New("title").Parse(opt.TitleTemplate); err != nil {
+				return nil, errors.Wrapf(err, "invalid title template for method %s", method)
+			}
+		}
+		if opt.TitlePattern != "" {
+			if _, err := regexp.Compile(opt.TitlePattern); err != nil {
+				return nil, errors.Wrapf(err, "invalid title pattern for method %s", method)
+			}
+		}
+		for _, pattern := range opt.StripLinePatterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, errors.Wrapf(err, "invalid strip line pattern for method %s", method)
+			}
+		}
 	}
 
 	return &config, nil
 }
 
+func validateNotificationEvents(target string, events, valid []NotificationEvent) error {
+	for _, event := range events {
+		if !event.In(valid) {
+			return errors.Errorf("invalid %s notification event %q", target, event)
+		}
+	}
+	return nil
+}
+
 func (cf *ConfigFetcher) unmarshalConfigV0(bytes []byte) (*Config, error) {
 	var configv0 ConfigV0
 	var config Config
@@ -176,7 +318,7 @@ func (cf *ConfigFetcher) unmarshalConfigV0(bytes []byte) (*Config, error) {
 				DeleteAfterMerge: configv0.DeleteAfterMerge,
 				Method:           configv0.Strategy,
 				Options: map[MergeMethod]MergeOption{
-					configv0.Strategy: {SummarizeCommits},
+					configv0.Strategy: {Body: SummarizeCommits},
 				},
 			},
 		}
@@ -195,7 +337,7 @@ func (cf *ConfigFetcher) unmarshalConfigV0(bytes []byte) (*Config, error) {
 				DeleteAfterMerge: configv0.DeleteAfterMerge,
 				Method:           configv0.Strategy,
 				Options: map[MergeMethod]MergeOption{
-					configv0.Strategy: {SummarizeCommits},
+					configv0.Strategy: {Body: SummarizeCommits},
 				},
 			},
 		}
@@ -214,7 +356,7 @@ func (cf *ConfigFetcher) unmarshalConfigV0(bytes []byte) (*Config, error) {
 				DeleteAfterMerge: configv0.DeleteAfterMerge,
 				Method:           configv0.Strategy,
 				Options: map[MergeMethod]MergeOption{
-					configv0.Strategy: {PullRequestBody},
+					configv0.Strategy: {Body: PullRequestBody},
 				},
 			},
 		}
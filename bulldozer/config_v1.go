@@ -14,8 +14,17 @@
 
 package bulldozer
 
+import (
+	"time"
+)
+
 type MessageStrategy string
 type MergeMethod string
+type StaleApprovalPolicy string
+type NeutralCheckPolicy string
+type UpdateMethod string
+type UpdateOrder string
+type AssessmentOutput string
 
 const (
 	PullRequestBody  MessageStrategy = "pull_request_body"
@@ -25,6 +34,37 @@ const (
 	MergeCommit    MergeMethod = "merge"
 	SquashAndMerge MergeMethod = "squash"
 	RebaseAndMerge MergeMethod = "rebase"
+
+	// FastForwardOnly moves the base branch to the head commit of the pull
+	// request without creating a new commit. It is only possible when the
+	// head is a descendant of the base branch.
+	FastForwardOnly MergeMethod = "fast_forward"
+
+	// Policies for required checks with neutral or skipped conclusions
+	NeutralChecksPass   NeutralCheckPolicy = "pass"
+	NeutralChecksFail   NeutralCheckPolicy = "fail"
+	NeutralChecksIgnore NeutralCheckPolicy = "ignore"
+
+	// Ways of publishing bulldozer's assessment of each pull request
+	AssessmentCheckRun AssessmentOutput = "check_run"
+	AssessmentStatus   AssessmentOutput = "status"
+
+	// Approvals are stale if they were submitted for a commit other than
+	// the current head of the pull request
+	DismissStaleApprovals StaleApprovalPolicy = "dismiss"
+	BlockStaleApprovals   StaleApprovalPolicy = "block"
+
+	// Methods for bringing a pull request up to date with its base branch
+	UpdateMerge  UpdateMethod = "merge"
+	UpdateRebase UpdateMethod = "rebase"
+
+	// UpdateBranchAPI updates pull requests with GitHub's update branch
+	// endpoint
+	UpdateBranchAPI UpdateMethod = "update_branch"
+
+	// Orders in which pull requests are updated after the base branch changes
+	UpdateOrderPriority UpdateOrder = "priority"
+	UpdateOrderOldest   UpdateOrder = "oldest"
 )
 
 type Signals struct {
@@ -43,21 +83,395 @@ type MergeConfig struct {
 
 	DeleteAfterMerge bool `yaml:"delete_after_merge"`
 
+	// Glob patterns for head branches that are never deleted after merging
+	DeleteAfterMergeExclusions []string `yaml:"delete_after_merge_exclusions"`
+
+	// If true, bulldozer comments with the merge it would perform instead of
+	// merging pull requests
+	DryRun bool `yaml:"dry_run"`
+
+	// If true, merge and squash commits are created and signed by the server
+	// instead of through the merge API. Requires a signing key in the server
+	// configuration.
+	SignCommits bool `yaml:"sign_commits"`
+
 	Method  MergeMethod                 `yaml:"method"`
 	Options map[MergeMethod]MergeOption `yaml:"options"`
 
+	// If true, eligible pull requests with the same base branch are merged
+	// one at a time, in the order they became eligible
+	Queue bool `yaml:"queue"`
+
+	// How bulldozer's assessment of each pull request is published and
+	// updated as the pull request changes: "check_run" for the "bulldozer"
+	// check run, or "status" for the "bulldozer/ready" commit status. If
+	// empty, the assessment is not published.
+	Assessment AssessmentOutput `yaml:"assessment"`
+
+	// Labels that cause bulldozer to mark a draft pull request as ready for
+	// review before evaluating it
+	ReadyForReviewLabels []string `yaml:"ready_for_review_labels"`
+
+	// Trailers to append to the messages of merge and squash commits
+	Trailers TrailerConfig `yaml:"trailers"`
+
 	// Additional status checks that bulldozer should require
-	// (even if the branch protection settings doesn't require it)
+	// (even if the branch protection settings doesn't require it). Names
+	// may be glob patterns, which require at least one matching check and
+	// that all matching checks are successful.
 	RequiredStatuses []string `yaml:"required_statuses"`
+
+	// How to treat required checks with neutral or skipped conclusions. If
+	// "pass", they satisfy the requirement; if "ignore", they are not
+	// considered when matching patterns; if "fail" or empty, they do not
+	// satisfy the requirement.
+	NeutralChecks NeutralCheckPolicy `yaml:"neutral_checks"`
+
+	// Environments in which the head commit must be successfully deployed
+	RequiredDeployments []string `yaml:"required_deployments"`
+
+	// The maximum time a required status check may have succeeded before the
+	// last push to the pull request. Older statuses must be re-run before
+	// the pull request can be merged.
+	StaleStatusTolerance time.Duration `yaml:"stale_status_tolerance"`
+
+	// Actions to run after a pull request is merged
+	AfterMerge AfterMergeConfig `yaml:"after_merge"`
+
+	// How to handle approvals that predate the last push. If "dismiss", they
+	// are dismissed before merging; if "block", the pull request is not
+	// merged. If empty, stale approvals are treated like other approvals.
+	StaleApprovals StaleApprovalPolicy `yaml:"stale_approvals"`
+
+	// The number of times bulldozer updates a pull request and retries the
+	// merge after the merge fails because the base branch moved. If zero,
+	// the pull request is not updated.
+	BaseMovedRetries int `yaml:"base_moved_retries"`
+
+	// The minimum time since the last commit on the pull request before it
+	// can be merged, giving reviewers a chance to see late changes
+	RequiredDelayAfterPush time.Duration `yaml:"required_delay_after_push"`
+
+	// If enabled, policy-bot's status must also be successful for the pull
+	// request to be approved, in addition to the approving reviews required
+	// by branch protection
+	PolicyBot PolicyBotConfig `yaml:"policy_bot"`
 }
 
 type MergeOption struct {
 	Body MessageStrategy `yaml:"body"`
+
+	// The following options modify the message when using the
+	// pull_request_body strategy. They are applied in the order listed.
+
+	// If true, HTML comments (e.g. instructions from a PR template) are removed
+	StripHTMLComments bool `yaml:"strip_html_comments"`
+
+	// If set, the body is truncated at the first line equal to this marker
+	MessageDelimiter string `yaml:"message_delimiter"`
+
+	// Lines matching any of these regular expressions are removed
+	StripLinePatterns []string `yaml:"strip_line_patterns"`
+
+	// If positive, the body is truncated to at most this many characters
+	MaxLength int `yaml:"max_length"`
+
+	// TitleTemplate is a Go template for the title of squash commits. If
+	// empty, the default GitHub title is used.
+	TitleTemplate string `yaml:"title_template"`
+
+	// TitlePattern is a regular expression that the title of squash commits
+	// must match, such as a conventional commit pattern. Pull requests with
+	// non-matching titles are not merged.
+	TitlePattern string `yaml:"title_pattern"`
+
+	// CommitMessagePattern is a regular expression that the message of every
+	// commit in the pull request must match. Because rebasing preserves the
+	// individual commits, this is only used with the rebase method.
+	CommitMessagePattern string `yaml:"commit_message_pattern"`
+}
+
+type AfterMergeConfig struct {
+	Backport    BackportConfig    `yaml:"backport"`
+	ForwardPort ForwardPortConfig `yaml:"forward_port"`
+
+	// If true, close open pull requests that make the same changes to the
+	// same base branch as the merged pull request
+	CloseSuperseded bool `yaml:"close_superseded"`
+
+	Tag TagConfig `yaml:"tag"`
+
+	Jira JiraConfig `yaml:"jira"`
+}
+
+type BackportConfig struct {
+	// Labels with this prefix request a backport to the branch named by the
+	// rest of the label, e.g. "backport/release-1.2"
+	LabelPrefix string `yaml:"label_prefix"`
+
+	// Labels to add to backport pull requests, e.g. to merge them with the
+	// same rules as other pull requests
+	Labels []string `yaml:"labels"`
+}
+
+func (bc *BackportConfig) Enabled() bool {
+	return bc.LabelPrefix != ""
+}
+
+type ForwardPortConfig struct {
+	// Branches maps a base branch to the branches that pull requests merged
+	// into it are forward-ported to, e.g. "main: [next]"
+	Branches map[string][]string `yaml:"branches"`
+
+	// Labels to add to forward-port pull requests, e.g. to merge them with
+	// the same rules as other pull requests
+	Labels []string `yaml:"labels"`
+}
+
+func (fc *ForwardPortConfig) Enabled() bool {
+	return len(fc.Branches) > 0
+}
+
+type TagConfig struct {
+	// A text/template for the tag name. See TagData for available fields.
+	Name string `yaml:"name"`
+
+	// A file in the repository containing the version, read at the merge
+	// commit and available to the template as {{.Version}}
+	VersionFile string `yaml:"version_file"`
+
+	// If set, only pull requests with one of these labels are tagged
+	Labels []string `yaml:"labels"`
+
+	// If true, also create a draft release for the tag
+	DraftRelease bool `yaml:"draft_release"`
+}
+
+func (tc *TagConfig) Enabled() bool {
+	return tc.Name != ""
+}
+
+// JiraConfig transitions the Jira issues mentioned by a pull request after
+// it is merged. The Jira server is configured on the server.
+type JiraConfig struct {
+	// The name of the transition, or of the status it leads to, e.g. "Done"
+	Transition string `yaml:"transition"`
+
+	// If set, only issues in these projects are transitioned
+	Projects []string `yaml:"projects"`
+
+	// A regular expression matching issue keys in the head branch name and
+	// title of the pull request. Defaults to DefaultJiraIssuePattern.
+	IssuePattern string `yaml:"issue_pattern"`
+}
+
+func (jc *JiraConfig) Enabled() bool {
+	return jc.Transition != ""
+}
+
+type TrailerConfig struct {
+	// If true, add a "PR: #<number>" trailer
+	PullRequest bool `yaml:"pull_request"`
+
+	// If true, add a "Reviewed-by: <login>" trailer for each approver
+	ReviewedBy bool `yaml:"reviewed_by"`
+
+	// A regular expression matched against the head branch name to extract
+	// a ticket ID. If the expression has a capturing group, the first group
+	// is the ID; otherwise, the full match is the ID.
+	TicketPattern string `yaml:"ticket_pattern"`
+
+	// The trailer key used for ticket IDs. Defaults to "Ticket".
+	TicketKey string `yaml:"ticket_key"`
+}
+
+func (tc *TrailerConfig) Enabled() bool {
+	return tc.PullRequest || tc.ReviewedBy || tc.TicketPattern != ""
 }
 
 type UpdateConfig struct {
 	Whitelist Signals `yaml:"whitelist"`
 	Blacklist Signals `yaml:"blacklist"`
+
+	// How to update pull requests. If "rebase", the commits of the pull
+	// request are recreated on top of the base branch and the head branch
+	// is force-updated; if "update_branch", GitHub's update branch endpoint
+	// merges the base branch; if "merge" or empty, the base branch is merged
+	// into the head branch.
+	Method UpdateMethod `yaml:"method"`
+
+	// If true, "fixup!" and "squash!" commits are folded into the commits
+	// they refer to when rebasing. Requires the "rebase" method.
+	Autosquash bool `yaml:"autosquash"`
+
+	// Glob patterns for branches that are never updated. A pull request is
+	// ignored if either its base or head branch matches a pattern.
+	IgnoreBranches []string `yaml:"ignore_branches"`
+
+	// If true, pull requests are only updated if they also satisfy the
+	// whitelist and blacklist of the merge configuration
+	OnlyWhenMergeable bool `yaml:"only_when_mergeable"`
+
+	// If either is set, pull requests are only updated once they are at
+	// least this many commits behind the base branch, or once the oldest
+	// commit they are missing is at least this old
+	MinCommitsBehind int           `yaml:"min_commits_behind"`
+	MinTimeBehind    time.Duration `yaml:"min_time_behind"`
+
+	// If true, pull requests are not updated while statuses or check runs
+	// for their head commit are still running. The update is retried when
+	// the checks complete.
+	WaitForChecks bool `yaml:"wait_for_checks"`
+
+	// The maximum number of times a pull request is updated in a day. If
+	// zero, updates are not limited.
+	MaxPerDay int `yaml:"max_per_day"`
+
+	// If true, the result of the last update attempt is published as the
+	// "bulldozer/update" check run on the pull request
+	CheckRun bool `yaml:"check_run"`
+
+	// The order in which pull requests are updated after the base branch
+	// changes. If "priority" or empty, pull requests with PriorityLabels are
+	// updated first, followed by pull requests in the merge queue; if
+	// "oldest", pull requests are updated in the order they were opened.
+	Order UpdateOrder `yaml:"order"`
+
+	// Labels that cause pull requests to be updated before others, in order
+	// of decreasing priority
+	PriorityLabels []string `yaml:"priority_labels"`
+
+	// A template for the comment posted when a pull request cannot be
+	// updated because of conflicts. If empty, DefaultConflictComment is used.
+	ConflictComment string `yaml:"conflict_comment"`
+
+	// A label applied to pull requests that cannot be updated because of
+	// conflicts. It is removed when the pull request can be updated again.
+	ConflictLabel string `yaml:"conflict_label"`
+
+	Stale StaleConfig `yaml:"stale"`
+
+	Sync SyncConfig `yaml:"sync"`
+}
+
+// StaleConfig controls how bulldozer handles pull requests that are eligible
+// for updates but have had no activity for a while. The sweep updates them
+// and tells the author about conflicts or failing checks.
+type StaleConfig struct {
+	// The number of days without activity after which a pull request is
+	// stale. If zero, stale pull requests are not handled.
+	Days int `yaml:"days"`
+
+	// A template for the comment posted to the author after the update. If
+	// empty, DefaultStaleComment is used.
+	Comment string `yaml:"comment"`
+}
+
+func (sc StaleConfig) Enabled() bool {
+	return sc.Days > 0
+}
+
+// SyncConfig controls which long-lived branches bulldozer keeps up to date
+// with the default branch of the repository. It is read from the
+// configuration on the default branch.
+type SyncConfig struct {
+	// The branches to keep up to date. When the default branch has commits
+	// that a branch does not, bulldozer opens a pull request that merges
+	// them into the branch.
+	Branches []string `yaml:"branches"`
+
+	// Labels added to new sync pull requests, for example to let bulldozer
+	// merge them
+	Labels []string `yaml:"labels"`
+}
+
+func (sc SyncConfig) Enabled() bool {
+	return len(sc.Branches) > 0
+}
+
+// NotificationEvent is something that happened to a pull request that can be
+// sent as a notification.
+type NotificationEvent string
+
+const (
+	NotifyMerged   NotificationEvent = "merged"
+	NotifyFailed   NotificationEvent = "failed"
+	NotifyConflict NotificationEvent = "conflict"
+
+	// NotifyInvalidConfig is sent at most once a day for a branch whose
+	// configuration exists but is invalid
+	NotifyInvalidConfig NotificationEvent = "invalid_config"
+
+	// Events that are only sent to webhooks
+	NotifyMergeAttempted NotificationEvent = "merge_attempted"
+	NotifyUpdated        NotificationEvent = "updated"
+	NotifyQueued         NotificationEvent = "queued"
+)
+
+// DefaultEmailEvents are the events sent by email if a repository does not
+// choose its events.
+var DefaultEmailEvents = []NotificationEvent{NotifyFailed, NotifyInvalidConfig}
+
+// NotificationConfig controls where notifications about the pull requests of
+// a repository are sent. The services themselves are configured on the
+// server.
+type NotificationConfig struct {
+	Slack SlackNotificationConfig `yaml:"slack"`
+	Teams TeamsNotificationConfig `yaml:"teams"`
+
+	Webhooks []WebhookNotificationConfig `yaml:"webhooks"`
+
+	Email EmailNotificationConfig `yaml:"email"`
+}
+
+type SlackNotificationConfig struct {
+	// The channel that receives notifications. If empty, the default
+	// channel of the server is used.
+	Channel string `yaml:"channel"`
+
+	// The events that are sent. If empty, all events are sent.
+	Events []NotificationEvent `yaml:"events"`
+}
+
+type TeamsNotificationConfig struct {
+	// The name of the webhook in the server configuration that posts to the
+	// channel that receives notifications. If empty, the default channel of
+	// the server is used.
+	Channel string `yaml:"channel"`
+
+	// The events that are sent. If empty, all events are sent.
+	Events []NotificationEvent `yaml:"events"`
+}
+
+type WebhookNotificationConfig struct {
+	// The URL that receives the events. It must be allowed by the server
+	// configuration.
+	URL string `yaml:"url"`
+
+	// The events that are sent. If empty, all events are sent.
+	Events []NotificationEvent `yaml:"events"`
+}
+
+type EmailNotificationConfig struct {
+	// The addresses that receive notifications
+	To []string `yaml:"to"`
+
+	// The events that are sent. If empty, DefaultEmailEvents are sent.
+	Events []NotificationEvent `yaml:"events"`
+}
+
+// In returns true if the event is in the events, or if the events are
+// empty.
+func (e NotificationEvent) In(events []NotificationEvent) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, event := range events {
+		if event == e {
+			return true
+		}
+	}
+	return false
 }
 
 type Config struct {
@@ -65,4 +479,6 @@ type Config struct {
 
 	Merge  MergeConfig  `yaml:"merge"`
 	Update UpdateConfig `yaml:"update"`
+
+	Notifications NotificationConfig `yaml:"notifications"`
 }
@@ -0,0 +1,122 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// DefaultConflictComment is the comment posted when an update fails because
+// the pull request conflicts with its base branch.
+const DefaultConflictComment = "bulldozer cannot update this pull request because it conflicts with `{{.Base}}`. " +
+	"Automatic updates resume once the conflicts are resolved."
+
+// conflictMarker identifies the comment reporting that a pull request could
+// not be updated because of conflicts.
+const conflictMarker = "<!-- bulldozer:conflict -->"
+
+// ConflictData is the data available to conflict comment templates.
+type ConflictData struct {
+	Number int
+	Base   string
+	Head   string
+}
+
+// formatConflictComment renders the conflict comment template, using the
+// default comment if the template is empty.
+func formatConflictComment(data ConflictData, text string) (string, error) {
+	if text == "" {
+		text = DefaultConflictComment
+	}
+
+	tmpl, err := template.New("conflict").Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid conflict comment template %q", text)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrap(err, "cannot render conflict comment")
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// reportConflict comments on the pull request and applies the conflict label,
+// if configured. The comment is only posted once, even if updates fail
+// repeatedly.
+func reportConflict(ctx context.Context, client *github.Client, pr *github.PullRequest, updateConfig UpdateConfig) error {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	existing, err := findMarkedComment(ctx, client, owner, repo, pr.GetNumber(), conflictMarker)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		body, err := formatConflictComment(ConflictData{
+			Number: pr.GetNumber(),
+			Base:   pr.GetBase().GetRef(),
+			Head:   pr.GetHead().GetRef(),
+		}, updateConfig.ConflictComment)
+		if err != nil {
+			return err
+		}
+		if err := upsertMarkedComment(ctx, client, owner, repo, pr.GetNumber(), conflictMarker, body); err != nil {
+			return err
+		}
+	}
+
+	if label := updateConfig.ConflictLabel; label != "" && !hasLabel(pr, label) {
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, pr.GetNumber(), []string{label}); err != nil {
+			return errors.Wrapf(err, "failed to add label %q", label)
+		}
+	}
+	return nil
+}
+
+// clearConflict removes the conflict comment and label from a pull request
+// that can be updated again.
+func clearConflict(ctx context.Context, client *github.Client, pr *github.PullRequest, updateConfig UpdateConfig) {
+	logger := zerolog.Ctx(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	if err := deleteMarkedComment(ctx, client, owner, repo, pr.GetNumber(), conflictMarker); err != nil {
+		logger.Error().Err(errors.WithStack(err)).Msg("Failed to delete conflict comment")
+	}
+
+	if label := updateConfig.ConflictLabel; label != "" && hasLabel(pr, label) {
+		if _, err := client.Issues.RemoveLabelForIssue(ctx, owner, repo, pr.GetNumber(), label); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to remove label %q", label)
+		}
+	}
+}
+
+func hasLabel(pr *github.PullRequest, name string) bool {
+	for _, label := range pr.Labels {
+		if strings.EqualFold(label.GetName(), name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// ReadyDraftPR marks a draft pull request as ready for review if it has one
+// of the configured labels. It returns true if the pull request was changed.
+func ReadyDraftPR(ctx context.Context, pullCtx pull.Context, client *github.Client, mergeConfig MergeConfig) (bool, error) {
+	logger := zerolog.Ctx(ctx)
+
+	if len(mergeConfig.ReadyForReviewLabels) == 0 {
+		return false, nil
+	}
+
+	labels, err := pullCtx.Labels(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to determine pull request labels")
+	}
+	inSlice, idx := anyInSlice(labels, mergeConfig.ReadyForReviewLabels)
+	if !inSlice {
+		return false, nil
+	}
+
+	var query struct {
+		Repository struct {
+			PullRequest struct {
+				ID      string `json:"id"`
+				IsDraft bool   `json:"isDraft"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+	err = graphQL(ctx, client, `query($owner: String!, $name: String!, $number: Int!) {
+		repository(owner: $owner, name: $name) {
+			pullRequest(number: $number) { id isDraft }
+		}
+	}`, map[string]interface{}{
+		"owner":  pullCtx.Owner(),
+		"name":   pullCtx.Repo(),
+		"number": pullCtx.Number(),
+	}, &query)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot determine draft state of %s", pullCtx.Locator())
+	}
+
+	pr := query.Repository.PullRequest
+	if !pr.IsDraft {
+		return false, nil
+	}
+
+	logger.Info().Msgf("Marking draft %s as ready for review because it has label %q", pullCtx.Locator(), mergeConfig.ReadyForReviewLabels[idx])
+
+	var mutation struct{}
+	err = graphQL(ctx, client, `mutation($id: ID!) {
+		markPullRequestReadyForReview(input: {pullRequestId: $id}) { clientMutationId }
+	}`, map[string]interface{}{
+		"id": pr.ID,
+	}, &mutation)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot mark %s as ready for review", pullCtx.Locator())
+	}
+	return true, nil
+}
+
+// graphQL sends a GraphQL request using the REST client, so that requests
+// share the authentication and middleware of other API calls.
+func graphQL(ctx context.Context, client *github.Client, query string, variables map[string]interface{}, data interface{}) error {
+	// GitHub Enterprise serves the REST API at /api/v3/ and GraphQL at
+	// /api/graphql, while github.com serves both from the root
+	path := "graphql"
+	if strings.HasSuffix(client.BaseURL.Path, "/api/v3/") {
+		path = "../graphql"
+	}
+
+	req, err := client.NewRequest("POST", path, map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	var res struct {
+		Data   interface{} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	res.Data = data
+
+	if _, err := client.Do(ctx, req, &res); err != nil {
+		return err
+	}
+
+	if len(res.Errors) > 0 {
+		var messages []string
+		for _, e := range res.Errors {
+			messages = append(messages, e.Message)
+		}
+		return errors.Errorf("graphql request failed: %s", strings.Join(messages, "; "))
+	}
+	return nil
+}
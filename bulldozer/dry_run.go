@@ -0,0 +1,75 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+const dryRunMarker = "<!-- bulldozer:dry-run -->"
+
+// reportDryRun comments on the pull request with a description of the merge
+// bulldozer would perform. The comment is updated in place on later
+// evaluations.
+func reportDryRun(ctx context.Context, pullCtx pull.Context, client *github.Client, mergeConfig MergeConfig, method MergeMethod, commitMessage string) error {
+	pr, _, err := client.PullRequests.Get(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pull request %s", pullCtx.Locator())
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "**bulldozer dry run:** this pull request is eligible and would be merged at `%s`.\n\n", pr.GetHead().GetSHA())
+	fmt.Fprintf(&b, "* Method: `%s`\n", method)
+	if mergeConfig.SignCommits {
+		fmt.Fprintf(&b, "* Signed commit: requested\n")
+	}
+
+	switch {
+	case method == RebaseAndMerge || method == FastForwardOnly:
+		fmt.Fprintf(&b, "* Commit message: commits are preserved\n")
+	case commitMessage == "":
+		fmt.Fprintf(&b, "* Commit message: GitHub default\n")
+	default:
+		fmt.Fprintf(&b, "* Commit message:\n\n```\n%s\n```\n\n", commitMessage)
+	}
+
+	switch {
+	case !mergeConfig.DeleteAfterMerge:
+		fmt.Fprintf(&b, "* Delete `%s`: no, not configured\n", pr.GetHead().GetRef())
+	case pr.GetBase().GetUser().GetLogin() != pr.GetHead().GetUser().GetLogin():
+		fmt.Fprintf(&b, "* Delete `%s`: no, branch is in a fork\n", pr.GetHead().GetRef())
+	default:
+		fmt.Fprintf(&b, "* Delete `%s`: yes, if no open pull requests target it\n", pr.GetHead().GetRef())
+	}
+
+	if mergeConfig.AfterMerge.Backport.Enabled() {
+		fmt.Fprintf(&b, "* Backport: labels with prefix `%s`\n", mergeConfig.AfterMerge.Backport.LabelPrefix)
+	}
+	if mergeConfig.AfterMerge.Tag.Enabled() {
+		fmt.Fprintf(&b, "* Tag: `%s`\n", mergeConfig.AfterMerge.Tag.Name)
+	}
+	if mergeConfig.AfterMerge.CloseSuperseded {
+		fmt.Fprintf(&b, "* Close superseded pull requests: yes\n")
+	}
+
+	return upsertMarkedComment(ctx, client, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number(), dryRunMarker, b.String())
+}
@@ -17,12 +17,16 @@ package bulldozer
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/tracing"
 )
 
 // IsPRBlacklisted returns true if the PR is identified as blacklisted,
@@ -151,52 +155,350 @@ func setDifference(set1, set2 []string) []string {
 	return result
 }
 
-// ShouldMergePR TODO: may want to return a richer type than bool
+// Decision is the result of evaluating whether a pull request should merge.
+// Holds only block a pull request if the login of bulldozer was known when it
+// was evaluated; see EvaluatePR.
+type Decision struct {
+	// Eligible is true if the pull request should be merged
+	Eligible bool
+
+	// Signals describes the whitelist signals that matched the pull request
+	Signals []string
+
+	// Reasons describes each requirement that prevents the pull request from
+	// merging. It is empty if the pull request is eligible.
+	Reasons []string
+
+	// Approval is the reason, also in Reasons, that policy-bot has not
+	// approved the pull request, if policy-bot is enabled
+	Approval string
+}
+
+func (d *Decision) block(reason string) {
+	d.Reasons = append(d.Reasons, reason)
+}
+
+// done returns true if evaluation can stop because the pull request is
+// already blocked and not every reason is needed.
+func (d *Decision) done(all bool) bool {
+	return !all && len(d.Reasons) > 0
+}
+
+// ShouldMergePR returns true if the pull request should be merged. See
+// EvaluatePR for the reasons behind the result.
 func ShouldMergePR(ctx context.Context, pullCtx pull.Context, mergeConfig MergeConfig) (bool, error) {
+	decision, err := EvaluatePR(ctx, pullCtx, mergeConfig)
+	if err != nil {
+		return false, err
+	}
+	return decision.Eligible, nil
+}
+
+// EvaluatePR evaluates the merge requirements for the pull request and
+// returns a Decision listing the matched signals and the first unmet
+// requirement. It stops at the first unmet requirement to limit API calls; use
+// AssessPR to list every unmet requirement. It makes no changes, so it may be
+// used without running the server. If any requirement cannot be evaluated, it
+// returns an error.
+//
+// Holds are recorded in comments by bulldozer, so they are only evaluated if
+// ctx has the login of bulldozer from WithBotLogin. Without it, no comment is
+// trusted and holds are ignored; callers that must respect holds need to set
+// the login.
+func EvaluatePR(ctx context.Context, pullCtx pull.Context, mergeConfig MergeConfig) (Decision, error) {
+	return evaluatePR(ctx, pullCtx, mergeConfig, false)
+}
+
+// AssessPR is like EvaluatePR, but evaluates every merge requirement so that
+// the Decision lists all of the unmet requirements. It makes more API calls
+// than EvaluatePR, so use it only when the reasons are shown to users.
+func AssessPR(ctx context.Context, pullCtx pull.Context, mergeConfig MergeConfig) (Decision, error) {
+	return evaluatePR(ctx, pullCtx, mergeConfig, true)
+}
+
+func evaluatePR(ctx context.Context, pullCtx pull.Context, mergeConfig MergeConfig, all bool) (Decision, error) {
+	ctx, span := tracing.Start(ctx, "bulldozer.evaluate_merge")
+	defer span.End()
+	span.SetAttributes(attribute.String("github.pull_request", pullCtx.Locator()))
+
 	logger := zerolog.Ctx(ctx)
 
+	var decision Decision
+	if err := evaluateMerge(ctx, pullCtx, mergeConfig, &decision, all); err != nil {
+		return Decision{}, err
+	}
+
+	for _, reason := range decision.Reasons {
+		logger.Debug().Msgf("%s is deemed not mergeable: %s", pullCtx.Locator(), reason)
+	}
+
+	decision.Eligible = len(decision.Reasons) == 0
+	span.SetAttributes(attribute.Bool("bulldozer.eligible", decision.Eligible))
+	return decision, nil
+}
+
+// evaluateMerge adds the matched signals and unmet merge requirements to the
+// decision. Unless all is true, it returns after the first unmet requirement.
+func evaluateMerge(ctx context.Context, pullCtx pull.Context, mergeConfig MergeConfig, decision *Decision, all bool) error {
+	logger := zerolog.Ctx(ctx)
+
+	// holds are recorded in comments by bulldozer, so without its login no
+	// comment is trusted and holds are not evaluated
+	if login, err := BotLogin(ctx); err == nil && login != "" {
+		comments, err := pullCtx.AuthoredComments(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list pull request comments")
+		}
+		if isHeld(comments, login) {
+			decision.block("pull request is on hold")
+		}
+	}
+	if decision.done(all) {
+		return nil
+	}
+
 	if mergeConfig.Blacklist.Enabled() {
 		blacklisted, reason, err := IsPRBlacklisted(ctx, pullCtx, mergeConfig.Blacklist)
 		if err != nil {
-			return false, errors.Wrap(err, "failed to determine if pull request is blacklisted")
+			return errors.Wrap(err, "failed to determine if pull request is blacklisted")
 		}
 		if blacklisted {
-			logger.Debug().Msgf("%s is deemed not mergeable because blacklisting is enabled and %s", pullCtx.Locator(), reason)
-			return false, nil
+			decision.block(fmt.Sprintf("blacklisted: %s", reason))
 		}
 	}
+	if decision.done(all) {
+		return nil
+	}
 
 	if mergeConfig.Whitelist.Enabled() {
 		whitelisted, reason, err := IsPRWhitelisted(ctx, pullCtx, mergeConfig.Whitelist)
 		if err != nil {
-			return false, errors.Wrap(err, "failed to determine if pull request is whitelisted")
+			return errors.Wrap(err, "failed to determine if pull request is whitelisted")
 		}
-		if !whitelisted {
-			logger.Debug().Msgf("%s is deemed not mergeable because whitelisting is enabled and no whitelist signal detected", pullCtx.Locator())
-			return false, nil
+		if whitelisted {
+			logger.Debug().Msgf("%s is whitelisted because whitelisting is enabled and %s", pullCtx.Locator(), reason)
+			decision.Signals = append(decision.Signals, reason)
+		} else {
+			decision.block("no whitelist signal detected")
 		}
-
-		logger.Debug().Msgf("%s is whitelisted because whitelisting is enabled and %s", pullCtx.Locator(), reason)
+	}
+	if decision.done(all) {
+		return nil
 	}
 
 	requiredStatuses, err := pullCtx.RequiredStatuses(ctx)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to determine required Github status checks")
+		return errors.Wrap(err, "failed to determine required Github status checks")
+	}
+
+	// policy-bot's status is evaluated on its own, so that its description
+	// explains what approval is missing
+	if mergeConfig.PolicyBot.Enabled {
+		approval, err := policyBotApproval(ctx, pullCtx, mergeConfig.PolicyBot)
+		if err != nil {
+			return err
+		}
+		if approval != "" {
+			decision.Approval = approval
+			decision.block(approval)
+		}
+
+		base, _, err := pullCtx.Branches(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine base branch")
+		}
+		requiredStatuses = setDifference(requiredStatuses, []string{mergeConfig.PolicyBot.StatusName(base)})
+	}
+	if decision.done(all) {
+		return nil
+	}
+	var statusPatterns []string
+	for _, status := range mergeConfig.RequiredStatuses {
+		if isGlob(status) {
+			statusPatterns = append(statusPatterns, status)
+		} else {
+			requiredStatuses = append(requiredStatuses, status)
+		}
 	}
-	requiredStatuses = append(requiredStatuses, mergeConfig.RequiredStatuses...)
 
 	successStatuses, err := pullCtx.CurrentSuccessStatuses(ctx)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to determine currently successful status checks")
+		return errors.Wrap(err, "failed to determine currently successful status checks")
+	}
+
+	var statusStates map[string]string
+	if len(statusPatterns) > 0 || (mergeConfig.NeutralChecks != "" && mergeConfig.NeutralChecks != NeutralChecksFail) {
+		if statusStates, err = pullCtx.StatusStates(ctx); err != nil {
+			return errors.Wrap(err, "failed to determine status check states")
+		}
+	}
+
+	if mergeConfig.NeutralChecks == NeutralChecksPass || mergeConfig.NeutralChecks == NeutralChecksIgnore {
+		for name, state := range statusStates {
+			if isNeutral(state) {
+				successStatuses = append(successStatuses, name)
+			}
+		}
 	}
 
 	unsatisfiedStatuses := setDifference(requiredStatuses, successStatuses)
+	for _, pattern := range statusPatterns {
+		if !statusPatternSatisfied(pattern, statusStates, mergeConfig.NeutralChecks) {
+			unsatisfiedStatuses = append(unsatisfiedStatuses, pattern)
+		}
+	}
+
+	// patterns are included so that stale checks can match them
+	requiredStatuses = append(requiredStatuses, statusPatterns...)
 	if len(unsatisfiedStatuses) > 0 {
-		logger.Debug().Msgf("%s is deemed not mergeable because of unfulfilled status checks: [%s]", pullCtx.Locator(), strings.Join(unsatisfiedStatuses, ","))
-		return false, nil
+		decision.block(fmt.Sprintf("unfulfilled status checks: [%s]", strings.Join(unsatisfiedStatuses, ",")))
+	}
+	if decision.done(all) {
+		return nil
 	}
 
-	// Ignore required reviews and try a merge (which may fail with a 4XX).
+	if len(mergeConfig.RequiredDeployments) > 0 {
+		deployments, err := pullCtx.SuccessfulDeployments(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine successful deployments")
+		}
+
+		missingDeployments := setDifference(mergeConfig.RequiredDeployments, deployments)
+		if len(missingDeployments) > 0 {
+			decision.block(fmt.Sprintf("missing successful deployments to: [%s]", strings.Join(missingDeployments, ",")))
+		}
+	}
+	if decision.done(all) {
+		return nil
+	}
+
+	if mergeConfig.StaleStatusTolerance > 0 {
+		stale, err := staleStatuses(ctx, pullCtx, requiredStatuses, mergeConfig.StaleStatusTolerance)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine stale status checks")
+		}
+		if len(stale) > 0 {
+			decision.block(fmt.Sprintf("status checks succeeded more than %s before the last push: [%s]", mergeConfig.StaleStatusTolerance, strings.Join(stale, ",")))
+		}
+	}
+	if decision.done(all) {
+		return nil
+	}
+
+	remainingDelay, err := RemainingPushDelay(ctx, pullCtx, mergeConfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to determine time since last push")
+	}
+	if remainingDelay > 0 {
+		decision.block(fmt.Sprintf("required delay after the last push has not elapsed (%s remaining)", remainingDelay))
+	}
+	if decision.done(all) {
+		return nil
+	}
+
+	requiredApprovals, err := pullCtx.RequiredApprovals(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to determine required approving reviews")
+	}
+
+	// policy-bot does not replace the reviews required by branch protection,
+	// because GitHub still rejects merges without them
+	if requiredApprovals > 0 {
+		approvers, err := pullCtx.Approvers(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine approving reviews")
+		}
+		if len(approvers) < requiredApprovals {
+			decision.block(fmt.Sprintf("%d of %d required approving reviews", len(approvers), requiredApprovals))
+		}
+	}
+	if decision.done(all) {
+		return nil
+	}
+
+	if mergeConfig.StaleApprovals == BlockStaleApprovals {
+		staleApprovers, err := pullCtx.StaleApprovers(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine stale approving reviews")
+		}
+		if len(staleApprovers) > 0 {
+			decision.block(fmt.Sprintf("approvals by [%s] predate the last push", strings.Join(staleApprovers, ",")))
+		}
+	}
+	return nil
+}
+
+// statusPatternSatisfied returns true if at least one check matches the glob
+// pattern and all matching checks are successful.
+func statusPatternSatisfied(pattern string, states map[string]string, neutralPolicy NeutralCheckPolicy) bool {
+	matched := 0
+	for name, state := range states {
+		if !matchGlob(pattern, name) || IsOwnCheck(name) {
+			continue
+		}
 
-	return true, nil
+		if isNeutral(state) {
+			switch neutralPolicy {
+			case NeutralChecksPass:
+				matched++
+				continue
+			case NeutralChecksIgnore:
+				continue
+			}
+		}
+
+		if state != "success" {
+			return false
+		}
+		matched++
+	}
+	return matched > 0
+}
+
+func isNeutral(state string) bool {
+	return state == "neutral" || state == "skipped"
+}
+
+// staleStatuses returns the names of the required statuses that succeeded more
+// than the tolerance before the last push to the pull request. Required
+// statuses may be glob patterns.
+func staleStatuses(ctx context.Context, pullCtx pull.Context, requiredStatuses []string, tolerance time.Duration) ([]string, error) {
+	statusTimes, err := pullCtx.SuccessStatusTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pushedAt, err := HeadPushedAt(ctx, pullCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []string
+	for status, updatedAt := range statusTimes {
+		if matchAnyGlob(requiredStatuses, status) != "" && pushedAt.Sub(updatedAt) > tolerance {
+			stale = append(stale, status)
+		}
+	}
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// RemainingPushDelay returns the time until the required delay after the last
+// push to the pull request elapses. It returns zero if no delay is configured
+// or if the delay has already elapsed.
+func RemainingPushDelay(ctx context.Context, pullCtx pull.Context, mergeConfig MergeConfig) (time.Duration, error) {
+	if mergeConfig.RequiredDelayAfterPush <= 0 {
+		return 0, nil
+	}
+
+	pushedAt, err := HeadPushedAt(ctx, pullCtx)
+	if err != nil {
+		return 0, err
+	}
+
+	remaining := mergeConfig.RequiredDelayAfterPush - time.Since(pushedAt)
+	if remaining < 0 {
+		return 0, nil
+	}
+	return remaining, nil
 }
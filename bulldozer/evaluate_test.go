@@ -17,12 +17,15 @@ package bulldozer
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/palantir/bulldozer/pull"
 	"github.com/palantir/bulldozer/pull/pulltest"
+	"github.com/palantir/bulldozer/state"
 )
 
 func TestSimpleXListed(t *testing.T) {
@@ -156,7 +159,7 @@ func TestShouldMerge(t *testing.T) {
 		},
 	}
 
-	ctx := context.Background()
+	ctx := WithBotLogin(context.Background(), "bulldozer[bot]")
 
 	t.Run("fullCommentShouldMerge", func(t *testing.T) {
 		pc := &pulltest.MockPullContext{
@@ -169,6 +172,42 @@ func TestShouldMerge(t *testing.T) {
 		assert.True(t, actualShouldMerge)
 	})
 
+	t.Run("holdShouldntMerge", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			CommentValue:         []string{"FULL_COMMENT_PLZ_MERGE"},
+			AuthoredCommentValue: []pull.Comment{{Author: "bulldozer[bot]", Body: holdMarker + "\nMerging is on hold"}},
+		}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, mergeConfig)
+
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("forgedHoldIgnored", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			CommentValue:         []string{"FULL_COMMENT_PLZ_MERGE"},
+			AuthoredCommentValue: []pull.Comment{{Author: "mallory", Body: holdMarker + "\nMerging is on hold"}},
+		}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, mergeConfig)
+
+		require.Nil(t, err)
+		assert.True(t, actualShouldMerge)
+	})
+
+	t.Run("unknownLoginIgnoresHolds", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			CommentValue:         []string{"FULL_COMMENT_PLZ_MERGE"},
+			AuthoredCommentValue: []pull.Comment{{Author: "bulldozer[bot]", Body: holdMarker + "\nMerging is on hold"}},
+		}
+
+		actualShouldMerge, err := ShouldMergePR(context.Background(), pc, mergeConfig)
+
+		require.Nil(t, err, "pull requests can be evaluated without the login of bulldozer")
+		assert.True(t, actualShouldMerge, "no comment is trusted without the login of bulldozer")
+	})
+
 	t.Run("partialCommentShouldntMerge", func(t *testing.T) {
 		pc := &pulltest.MockPullContext{
 			CommentValue: []string{"This is not a FULL_COMMENT_PLZ_MERGE"},
@@ -333,4 +372,442 @@ func TestShouldMerge(t *testing.T) {
 		require.Nil(t, err)
 		assert.False(t, actualShouldMerge)
 	})
+
+	t.Run("requiredApprovalsMet", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:             []string{"LABEL_MERGE"},
+			RequiredApprovalsValue: 2,
+			ApproversValue:         []string{"alice", "bob"},
+		}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, mergeConfig)
+
+		require.Nil(t, err)
+		assert.True(t, actualShouldMerge)
+	})
+
+	t.Run("requiredApprovalsNotMet", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:             []string{"LABEL_MERGE"},
+			RequiredApprovalsValue: 2,
+			ApproversValue:         []string{"alice"},
+		}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, mergeConfig)
+
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("failClosedOnApproversErr", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:             []string{"LABEL_MERGE"},
+			RequiredApprovalsValue: 1,
+			ApproversErrValue:      errors.New("failure"),
+		}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, mergeConfig)
+
+		require.NotNil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("requiredDelayAfterPushNotElapsed", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:           []string{"LABEL_MERGE"},
+			HeadCommittedAtValue: time.Now().Add(-1 * time.Minute),
+		}
+
+		delayedConfig := mergeConfig
+		delayedConfig.RequiredDelayAfterPush = 10 * time.Minute
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, delayedConfig)
+
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("statusPatternSatisfied", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:           []string{"LABEL_MERGE"},
+			SuccessStatusesValue: []string{"build (linux, amd64)", "build (linux, arm64)"},
+			StatusStatesValue: map[string]string{
+				"build (linux, amd64)": "success",
+				"build (linux, arm64)": "success",
+				"build (windows)":      "failure",
+			},
+		}
+
+		globConfig := mergeConfig
+		globConfig.RequiredStatuses = []string{"build (linux, *)"}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, globConfig)
+
+		require.Nil(t, err)
+		assert.True(t, actualShouldMerge)
+	})
+
+	t.Run("statusPatternFailedMatch", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:           []string{"LABEL_MERGE"},
+			SuccessStatusesValue: []string{"ci/test"},
+			StatusStatesValue: map[string]string{
+				"ci/test": "success",
+				"ci/lint": "pending",
+			},
+		}
+
+		globConfig := mergeConfig
+		globConfig.RequiredStatuses = []string{"ci/*"}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, globConfig)
+
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("statusPatternNoMatch", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:        []string{"LABEL_MERGE"},
+			StatusStatesValue: map[string]string{},
+		}
+
+		globConfig := mergeConfig
+		globConfig.RequiredStatuses = []string{"ci/*"}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, globConfig)
+
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("neutralChecks", func(t *testing.T) {
+		states := map[string]string{
+			"ci/test":   "success",
+			"ci/deploy": "skipped",
+		}
+
+		for policy, expected := range map[NeutralCheckPolicy]bool{
+			NeutralChecksFail:   false,
+			NeutralChecksPass:   true,
+			NeutralChecksIgnore: true,
+		} {
+			pc := &pulltest.MockPullContext{
+				LabelValue:           []string{"LABEL_MERGE"},
+				SuccessStatusesValue: []string{"ci/test"},
+				StatusStatesValue:    states,
+			}
+
+			neutralConfig := mergeConfig
+			neutralConfig.RequiredStatuses = []string{"ci/*"}
+			neutralConfig.NeutralChecks = policy
+
+			actualShouldMerge, err := ShouldMergePR(ctx, pc, neutralConfig)
+
+			require.Nil(t, err)
+			assert.Equal(t, expected, actualShouldMerge, "policy %q", policy)
+		}
+	})
+
+	t.Run("requiredDeploymentMissing", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:                 []string{"LABEL_MERGE"},
+			SuccessfulDeploymentsValue: []string{"production"},
+		}
+
+		deployConfig := mergeConfig
+		deployConfig.RequiredDeployments = []string{"staging-preview"}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, deployConfig)
+
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("requiredDeploymentSucceeded", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:                 []string{"LABEL_MERGE"},
+			SuccessfulDeploymentsValue: []string{"staging-preview"},
+		}
+
+		deployConfig := mergeConfig
+		deployConfig.RequiredDeployments = []string{"staging-preview"}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, deployConfig)
+
+		require.Nil(t, err)
+		assert.True(t, actualShouldMerge)
+	})
+
+	t.Run("staleApprovalsBlocked", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:          []string{"LABEL_MERGE"},
+			ApproversValue:      []string{"alice", "bob"},
+			StaleApproversValue: []string{"bob"},
+		}
+
+		blockConfig := mergeConfig
+		blockConfig.StaleApprovals = BlockStaleApprovals
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, blockConfig)
+
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("staleApprovalsIgnoredByDefault", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:          []string{"LABEL_MERGE"},
+			ApproversValue:      []string{"alice", "bob"},
+			StaleApproversValue: []string{"bob"},
+		}
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, mergeConfig)
+
+		require.Nil(t, err)
+		assert.True(t, actualShouldMerge)
+	})
+
+	t.Run("staleStatusRejected", func(t *testing.T) {
+		pushedAt := time.Now()
+		pc := &pulltest.MockPullContext{
+			LabelValue:            []string{"LABEL_MERGE"},
+			RequiredStatusesValue: []string{"ci"},
+			SuccessStatusesValue:  []string{"ci"},
+			SuccessStatusTimesValue: map[string]time.Time{
+				"ci": pushedAt.Add(-2 * time.Hour),
+			},
+			HeadCommittedAtValue: pushedAt,
+		}
+
+		staleConfig := mergeConfig
+		staleConfig.StaleStatusTolerance = 30 * time.Minute
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, staleConfig)
+
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("staleStatusAfterRecordedPush", func(t *testing.T) {
+		ctx := state.WithStore(ctx, state.NewMemoryStore())
+		pushedAt := time.Now()
+		RecordPush(ctx, "owner", "repo", "abc123", pushedAt)
+
+		pc := &pulltest.MockPullContext{
+			OwnerValue:            "owner",
+			RepoValue:             "repo",
+			HeadSHAValue:          "abc123",
+			LabelValue:            []string{"LABEL_MERGE"},
+			RequiredStatusesValue: []string{"ci"},
+			SuccessStatusesValue:  []string{"ci"},
+			SuccessStatusTimesValue: map[string]time.Time{
+				"ci": pushedAt.Add(-2 * time.Hour),
+			},
+			// the commit was authored before the statuses ran on an older head
+			HeadCommittedAtValue: pushedAt.Add(-3 * time.Hour),
+		}
+
+		staleConfig := mergeConfig
+		staleConfig.StaleStatusTolerance = 30 * time.Minute
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, staleConfig)
+
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+	})
+
+	t.Run("recentStatusAccepted", func(t *testing.T) {
+		pushedAt := time.Now()
+		pc := &pulltest.MockPullContext{
+			LabelValue:            []string{"LABEL_MERGE"},
+			RequiredStatusesValue: []string{"ci"},
+			SuccessStatusesValue:  []string{"ci"},
+			SuccessStatusTimesValue: map[string]time.Time{
+				"ci": pushedAt.Add(-10 * time.Minute),
+			},
+			HeadCommittedAtValue: pushedAt,
+		}
+
+		staleConfig := mergeConfig
+		staleConfig.StaleStatusTolerance = 30 * time.Minute
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, staleConfig)
+
+		require.Nil(t, err)
+		assert.True(t, actualShouldMerge)
+	})
+
+	t.Run("requiredDelayAfterPushElapsed", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:           []string{"LABEL_MERGE"},
+			HeadCommittedAtValue: time.Now().Add(-1 * time.Hour),
+		}
+
+		delayedConfig := mergeConfig
+		delayedConfig.RequiredDelayAfterPush = 10 * time.Minute
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, delayedConfig)
+
+		require.Nil(t, err)
+		assert.True(t, actualShouldMerge)
+	})
+
+	t.Run("requiredDelayAfterRecordedPush", func(t *testing.T) {
+		ctx := state.WithStore(ctx, state.NewMemoryStore())
+		RecordPush(ctx, "owner", "repo", "abc123", time.Now().Add(-1*time.Minute))
+
+		pc := &pulltest.MockPullContext{
+			OwnerValue:   "owner",
+			RepoValue:    "repo",
+			HeadSHAValue: "abc123",
+			LabelValue:   []string{"LABEL_MERGE"},
+			// an old commit pushed a minute ago
+			HeadCommittedAtValue: time.Now().Add(-24 * time.Hour),
+		}
+
+		delayedConfig := mergeConfig
+		delayedConfig.RequiredDelayAfterPush = 10 * time.Minute
+
+		actualShouldMerge, err := ShouldMergePR(ctx, pc, delayedConfig)
+		require.Nil(t, err)
+		assert.False(t, actualShouldMerge)
+
+		remaining, err := RemainingPushDelay(ctx, pc, delayedConfig)
+		require.Nil(t, err)
+		assert.True(t, remaining > 8*time.Minute)
+	})
+}
+
+func TestEvaluatePR(t *testing.T) {
+	mergeConfig := MergeConfig{
+		Whitelist: Signals{
+			Labels: []string{"LABEL_MERGE"},
+		},
+		Blacklist: Signals{
+			Labels: []string{"LABEL_NOMERGE"},
+		},
+	}
+
+	ctx := WithBotLogin(context.Background(), "bulldozer[bot]")
+
+	t.Run("eligible", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue: []string{"LABEL_MERGE"},
+		}
+
+		decision, err := EvaluatePR(ctx, pc, mergeConfig)
+
+		require.Nil(t, err)
+		assert.True(t, decision.Eligible)
+		assert.Equal(t, []string{"PR label matches one of specified whitelist labels: \"LABEL_MERGE\""}, decision.Signals)
+		assert.Empty(t, decision.Reasons)
+	})
+
+	t.Run("firstReason", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:             []string{"LABEL_NOMERGE"},
+			RequiredStatusesValue:  []string{"ci"},
+			RequiredApprovalsValue: 1,
+		}
+
+		decision, err := EvaluatePR(ctx, pc, mergeConfig)
+
+		require.Nil(t, err)
+		assert.False(t, decision.Eligible)
+		assert.Equal(t, []string{
+			"blacklisted: PR label matches one of specified blacklist labels: \"LABEL_NOMERGE\"",
+		}, decision.Reasons)
+	})
+
+	t.Run("allReasons", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:             []string{"LABEL_NOMERGE"},
+			RequiredStatusesValue:  []string{"ci"},
+			RequiredApprovalsValue: 1,
+		}
+
+		decision, err := AssessPR(ctx, pc, mergeConfig)
+
+		require.Nil(t, err)
+		assert.False(t, decision.Eligible)
+		assert.Empty(t, decision.Signals)
+		assert.Equal(t, []string{
+			"blacklisted: PR label matches one of specified blacklist labels: \"LABEL_NOMERGE\"",
+			"no whitelist signal detected",
+			"unfulfilled status checks: [ci]",
+			"0 of 1 required approving reviews",
+		}, decision.Reasons)
+	})
+
+	t.Run("policyBot", func(t *testing.T) {
+		policyBotConfig := mergeConfig
+		policyBotConfig.PolicyBot = PolicyBotConfig{Enabled: true}
+
+		pc := &pulltest.MockPullContext{
+			LabelValue:            []string{"LABEL_MERGE"},
+			BranchBase:            "develop",
+			RequiredStatusesValue: []string{"ci", "policy-bot: develop"},
+			SuccessStatusesValue:  []string{"ci"},
+			StatusStatesValue:     map[string]string{"ci": "success", "policy-bot: develop": "pending"},
+			StatusesValue: map[string]pull.Status{
+				"policy-bot: develop": {State: "pending", Description: "0/1 rules approved", Creator: "policy-bot[bot]"},
+			},
+			RequiredApprovalsValue: 1,
+			ApproversValue:         []string{"alice"},
+		}
+
+		decision, err := AssessPR(ctx, pc, policyBotConfig)
+
+		require.Nil(t, err)
+		assert.False(t, decision.Eligible)
+		assert.Equal(t, "policy-bot: 0/1 rules approved", decision.Approval)
+		assert.Equal(t, []string{"policy-bot: 0/1 rules approved"}, decision.Reasons)
+
+		pc.StatusStatesValue["policy-bot: develop"] = "success"
+		pc.StatusesValue["policy-bot: develop"] = pull.Status{State: "success", Creator: "policy-bot[bot]"}
+		pc.SuccessStatusesValue = append(pc.SuccessStatusesValue, "policy-bot: develop")
+
+		decision, err = EvaluatePR(ctx, pc, policyBotConfig)
+
+		require.Nil(t, err)
+		assert.True(t, decision.Eligible)
+		assert.Empty(t, decision.Approval)
+
+		pc.ApproversValue = nil
+
+		decision, err = EvaluatePR(ctx, pc, policyBotConfig)
+
+		require.Nil(t, err)
+		assert.False(t, decision.Eligible, "policy-bot does not replace approving reviews required by branch protection")
+		assert.Equal(t, []string{"0 of 1 required approving reviews"}, decision.Reasons)
+
+		pc.ApproversValue = []string{"alice"}
+		pc.StatusesValue["policy-bot: develop"] = pull.Status{State: "success", Creator: "mallory"}
+
+		decision, err = EvaluatePR(ctx, pc, policyBotConfig)
+
+		require.Nil(t, err)
+		assert.False(t, decision.Eligible, "statuses posted by other users must not approve")
+		assert.Equal(t, []string{"policy-bot: no status from policy-bot[bot]"}, decision.Reasons)
+
+		delete(pc.StatusesValue, "policy-bot: develop")
+
+		decision, err = EvaluatePR(ctx, pc, policyBotConfig)
+
+		require.Nil(t, err)
+		assert.Equal(t, []string{"policy-bot: no status yet"}, decision.Reasons)
+	})
+}
+
+func TestPolicyBotConfig(t *testing.T) {
+	config := PolicyBotConfig{Enabled: true}
+	assert.Equal(t, "policy-bot: develop", config.StatusName("develop"))
+	assert.True(t, config.IsStatus("policy-bot: develop"))
+	assert.False(t, config.IsStatus("ci"))
+
+	config.Context = "approvals"
+	assert.Equal(t, "approvals: develop", config.StatusName("develop"))
+	assert.True(t, config.IsStatus("approvals: develop"))
+	assert.False(t, config.IsStatus("policy-bot: develop"))
 }
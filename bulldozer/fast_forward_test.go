@@ -0,0 +1,101 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFastForwardServer(t *testing.T, behindBy int, updates *[]string) *github.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/compare/develop...head":
+			_, _ = fmt.Fprintf(w, `{"behind_by": %d}`, behindBy)
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/o/r/git/refs/heads/develop":
+			var body struct {
+				SHA   string `json:"sha"`
+				Force bool   `json:"force"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("invalid ref update: %v", err)
+			}
+			if body.Force {
+				t.Errorf("ref update must not be forced")
+			}
+			*updates = append(*updates, body.SHA)
+			_, _ = fmt.Fprintf(w, `{"ref": "refs/heads/develop", "object": {"sha": %q}}`, body.SHA)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+func fastForwardPullRequest() *github.PullRequest {
+	return &github.PullRequest{
+		Number: github.Int(1),
+		Base: &github.PullRequestBranch{
+			Ref: github.String("develop"),
+			Repo: &github.Repository{
+				Name:  github.String("r"),
+				Owner: &github.User{Login: github.String("o")},
+			},
+		},
+		Head: &github.PullRequestBranch{
+			SHA: github.String("head"),
+		},
+	}
+}
+
+func TestFastForward(t *testing.T) {
+	t.Run("updatesBase", func(t *testing.T) {
+		var updates []string
+		client := newFastForwardServer(t, 0, &updates)
+
+		sha, err := fastForward(context.Background(), client, fastForwardPullRequest())
+		require.Nil(t, err)
+
+		assert.Equal(t, "head", sha)
+		assert.Equal(t, []string{"head"}, updates)
+	})
+
+	t.Run("behindBase", func(t *testing.T) {
+		var updates []string
+		client := newFastForwardServer(t, 2, &updates)
+
+		_, err := fastForward(context.Background(), client, fastForwardPullRequest())
+		require.NotNil(t, err)
+
+		_, ok := errors.Cause(err).(notFastForwardError)
+		assert.True(t, ok, "expected notFastForwardError, got %v", err)
+		assert.Empty(t, updates, "base must not be updated when the head is behind")
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// isGlob returns true if the pattern contains glob wildcards.
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?")
+}
+
+// matchGlob returns true if the name matches the glob pattern. In patterns,
+// "*" matches any sequence of characters except "/", "**" matches any
+// sequence of characters, and "?" matches any single character except "/".
+func matchGlob(pattern, name string) bool {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.MustCompile(expr.String()).MatchString(name)
+}
+
+// matchAnyGlob returns the first pattern that matches the name, or an empty
+// string if no pattern matches.
+func matchAnyGlob(patterns []string, name string) string {
+	for _, p := range patterns {
+		if matchGlob(p, name) {
+			return p
+		}
+	}
+	return ""
+}
+
+// MatchesBranchRule returns true if the branch is covered by a branch
+// protection rule with the pattern.
+func MatchesBranchRule(pattern, branch string) bool {
+	return matchGlob(pattern, branch)
+}
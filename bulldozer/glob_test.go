@@ -0,0 +1,43 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"develop", "develop", true},
+		{"develop", "develop2", false},
+		{"release/*", "release/1.0", true},
+		{"release/*", "release/1.0/hotfix", false},
+		{"release/**", "release/1.0/hotfix", true},
+		{"v?.x", "v1.x", true},
+		{"v?.x", "v10.x", false},
+		{"ci/*.yml", "ci/build.yml", true},
+		{"ci/*.yml", "ci/buildxyml", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.match, matchGlob(test.pattern, test.name), "pattern %q, name %q", test.pattern, test.name)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// headMarker identifies comments about problems with the head of a pull request
+const headMarker = "<!-- bulldozer:head -->"
+
+// headProblem returns a description of why bulldozer cannot act on the head
+// of the pull request, or an empty string if there is no problem. If write is
+// true, the action requires pushing to the head branch.
+func headProblem(pr *github.PullRequest, write bool) string {
+	headRepo := pr.GetHead().GetRepo()
+	if headRepo == nil {
+		return "the head repository of the pull request was deleted"
+	}
+	if write && isFork(pr) && !pr.GetMaintainerCanModify() {
+		return "the pull request is from a fork that does not allow edits by maintainers"
+	}
+	return ""
+}
+
+// isFork returns true if the head branch of the pull request is in a
+// different repository than the base branch.
+func isFork(pr *github.PullRequest) bool {
+	return pr.GetHead().GetRepo().GetID() != pr.GetBase().GetRepo().GetID()
+}
+
+// headBranchName returns the name of the head branch returned by
+// pull.Context.Branches without the "owner:" prefix of branches from forks.
+func headBranchName(head string) string {
+	return head[strings.Index(head, ":")+1:]
+}
+
+// reportHeadProblem comments on the pull request to explain why bulldozer
+// cannot perform the action. Repeated reports update the same comment.
+func reportHeadProblem(ctx context.Context, client *github.Client, pr *github.PullRequest, action, problem string) {
+	logger := zerolog.Ctx(ctx)
+	logger.Info().Msgf("Cannot %s pull request because %s", action, problem)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	body := fmt.Sprintf("bulldozer cannot %s this pull request because %s.", action, problem)
+
+	if err := upsertMarkedComment(ctx, client, owner, repo, pr.GetNumber(), headMarker, body); err != nil {
+		logger.Error().Err(errors.WithStack(err)).Msg("Failed to comment on pull request head problem")
+	}
+}
+
+// InstallationClients returns a client for the installation of the app on a
+// repository, or nil if the app is not installed on the repository.
+type InstallationClients func(ctx context.Context, owner, repo string) (*github.Client, error)
+
+type installationClientsKey struct{}
+
+// WithInstallationClients returns a context that creates clients for the
+// forks that pull requests are opened from with the function.
+func WithInstallationClients(ctx context.Context, clients InstallationClients) context.Context {
+	return context.WithValue(ctx, installationClientsKey{}, clients)
+}
+
+// headClient returns a client that can push to the head branch of the pull
+// request, or nil if there is none. Pull requests from the base repository
+// use the client of the base repository. Installation tokens cannot push to
+// forks, even if maintainers may edit them, so pull requests from forks need
+// an installation of the app on the fork.
+func headClient(ctx context.Context, client *github.Client, pr *github.PullRequest) (*github.Client, error) {
+	if !isFork(pr) {
+		return client, nil
+	}
+
+	clients, ok := ctx.Value(installationClientsKey{}).(InstallationClients)
+	if !ok {
+		return nil, nil
+	}
+	owner := pr.GetHead().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetHead().GetRepo().GetName()
+
+	forkClient, err := clients(ctx, owner, repo)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create client for fork %s/%s", owner, repo)
+	}
+	return forkClient, nil
+}
+
+// forkNotInstalledProblem explains why bulldozer cannot push to a fork
+const forkNotInstalledProblem = "the pull request is from a fork that bulldozer is not installed on"
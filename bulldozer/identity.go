@@ -0,0 +1,59 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+type botLoginCtxKey struct{}
+
+// WithBotLogin returns a context with the login of the user that bulldozer
+// acts as, such as "bulldozer[bot]" for a GitHub App. Only comments by this
+// user are trusted to record holds, paused updates, and other state. An
+// empty login trusts no comments.
+func WithBotLogin(ctx context.Context, login string) context.Context {
+	return context.WithValue(ctx, botLoginCtxKey{}, login)
+}
+
+// BotLogin returns the login of the user that bulldozer acts as. It returns
+// an error if the context does not have a login, so that state recorded in
+// comments is never trusted by mistake.
+func BotLogin(ctx context.Context) (string, error) {
+	login, ok := ctx.Value(botLoginCtxKey{}).(string)
+	if !ok {
+		return "", errors.New("the login of the bulldozer user is unknown")
+	}
+	return login, nil
+}
+
+// hasMarkedComment returns true if any comment by the login contains the
+// marker.
+func hasMarkedComment(comments []pull.Comment, login, marker string) bool {
+	if login == "" {
+		return false
+	}
+	for _, c := range comments {
+		if c.Author == login && strings.Contains(c.Body, marker) {
+			return true
+		}
+	}
+	return false
+}
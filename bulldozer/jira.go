@@ -0,0 +1,108 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/jira"
+)
+
+// DefaultJiraIssuePattern matches Jira issue keys like "PROJ-123".
+const DefaultJiraIssuePattern = `\b[A-Z][A-Z0-9_]+-[1-9][0-9]*\b`
+
+// JiraIssueKeys returns the Jira issue keys in the head branch name and
+// title of the pull request, in order of appearance and without duplicates.
+func JiraIssueKeys(pr *github.PullRequest, config JiraConfig) ([]string, error) {
+	pattern := config.IssuePattern
+	if pattern == "" {
+		pattern = DefaultJiraIssuePattern
+	}
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid jira issue pattern")
+	}
+
+	var keys []string
+	seen := make(map[string]bool)
+	for _, text := range []string{pr.GetHead().GetRef(), pr.GetTitle()} {
+		for _, key := range r.FindAllString(text, -1) {
+			key = strings.ToUpper(key)
+			if seen[key] || !inJiraProjects(key, config.Projects) {
+				continue
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func inJiraProjects(key string, projects []string) bool {
+	if len(projects) == 0 {
+		return true
+	}
+	project, ok := jira.Project(key)
+	if !ok {
+		return false
+	}
+	for _, p := range projects {
+		if strings.EqualFold(p, project) {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionJiraIssues transitions the Jira issues of a merged pull request,
+// logging any errors.
+func transitionJiraIssues(ctx context.Context, pr *github.PullRequest, config JiraConfig) {
+	logger := zerolog.Ctx(ctx)
+
+	client := jira.Ctx(ctx)
+	if client == nil {
+		logger.Warn().Msg("Configuration requires Jira transitions, but the server has no Jira configuration")
+		return
+	}
+
+	keys, err := JiraIssueKeys(pr, config)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to find Jira issues")
+		return
+	}
+
+	for _, key := range keys {
+		if !client.Allowed(key) {
+			logger.Warn().Msgf("Not transitioning Jira issue %s, its project is not allowed by the server", key)
+			continue
+		}
+
+		ok, err := client.Transition(ctx, key, config.Transition)
+		switch {
+		case err != nil:
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to transition Jira issue %s", key)
+		case !ok:
+			logger.Info().Msgf("Jira issue %s has no transition %q, it may already be done", key, config.Transition)
+		default:
+			logger.Info().Msgf("Transitioned Jira issue %s to %q", key, config.Transition)
+		}
+	}
+}
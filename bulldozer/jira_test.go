@@ -0,0 +1,46 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJiraIssueKeys(t *testing.T) {
+	pr := &github.PullRequest{
+		Title: github.String("PROJ-12: fix UTF-8 handling, see OPS-7 and PROJ-12"),
+		Head:  &github.PullRequestBranch{Ref: github.String("feature/PROJ-3-parser")},
+	}
+
+	keys, err := JiraIssueKeys(pr, JiraConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PROJ-3", "PROJ-12", "UTF-8", "OPS-7"}, keys)
+
+	keys, err = JiraIssueKeys(pr, JiraConfig{Projects: []string{"proj"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PROJ-3", "PROJ-12"}, keys, "projects filter keys")
+
+	keys, err = JiraIssueKeys(pr, JiraConfig{IssuePattern: `(?i)ops-\d+`})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"OPS-7"}, keys)
+
+	keys, err = JiraIssueKeys(pr, JiraConfig{IssuePattern: `PROJ\d*`, Projects: []string{"proj"}})
+	require.NoError(t, err)
+	assert.Empty(t, keys, "keys without a project do not match projects")
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultKillSwitchPath is the file in the ".github" repository of an
+	// organization that stops merges in the organization while it exists
+	DefaultKillSwitchPath = "bulldozer-stop"
+
+	// DefaultKillSwitchTTL is how long the state of a kill switch is cached
+	DefaultKillSwitchTTL = 30 * time.Second
+
+	killSwitchRepo = ".github"
+)
+
+// HaltFunc returns true if merges must stop, for example because a kill
+// switch is engaged or the repository was paused.
+type HaltFunc func(ctx context.Context) (bool, error)
+
+// KillSwitch stops all merges in an organization while a file exists in the
+// ".github" repository of the organization. The content of the file is the
+// reason for the stop. The state of each organization is cached for TTL, so
+// that a stop takes effect within TTL without a request for every merge. A
+// nil KillSwitch is never engaged.
+//
+// If the ".github" repository does not exist or the app cannot read it, the
+// kill switch cannot be engaged. This is logged as a warning, or, if
+// RequireRepository is set, treated as an error so that merges stop until
+// the repository is readable.
+type KillSwitch struct {
+	Path              string
+	TTL               time.Duration
+	RequireRepository bool
+
+	lock   sync.Mutex
+	cache  map[string]killSwitchState
+	warned map[string]bool
+}
+
+type killSwitchState struct {
+	engaged bool
+	reason  string
+	expires time.Time
+}
+
+// Engaged returns true and the reason if the kill switch of the owner is
+// engaged. Errors other than a missing file are returned, so that callers can
+// refuse to merge when the state is unknown; a missing or unreadable
+// repository is only an error if RequireRepository is set.
+func (k *KillSwitch) Engaged(ctx context.Context, client *github.Client, owner string) (bool, string, error) {
+	if k == nil {
+		return false, "", nil
+	}
+
+	k.lock.Lock()
+	s, ok := k.cache[owner]
+	k.lock.Unlock()
+	if ok && time.Now().Before(s.expires) {
+		return s.engaged, s.reason, nil
+	}
+
+	path := k.Path
+	if path == "" {
+		path = DefaultKillSwitchPath
+	}
+	ttl := k.TTL
+	if ttl <= 0 {
+		ttl = DefaultKillSwitchTTL
+	}
+
+	s = killSwitchState{expires: time.Now().Add(ttl)}
+	file, _, _, err := client.Repositories.GetContents(ctx, owner, killSwitchRepo, path, nil)
+	switch {
+	case err != nil:
+		if !isNotFound(err) {
+			return false, "", errors.Wrapf(err, "failed to check kill switch of %s", owner)
+		}
+
+		// the file and the repository both return 404 if they are missing
+		_, _, err := client.Repositories.Get(ctx, owner, killSwitchRepo)
+		switch {
+		case err == nil:
+		case !isNotFound(err):
+			return false, "", errors.Wrapf(err, "failed to check kill switch of %s", owner)
+		case k.RequireRepository:
+			return false, "", errors.Errorf("kill switch of %s is unavailable: the %s repository does not exist or is not readable by the app", owner, killSwitchRepo)
+		default:
+			k.warnUnavailable(ctx, owner)
+		}
+	case file != nil:
+		s.engaged = true
+		if content, err := file.GetContent(); err == nil {
+			s.reason = strings.TrimSpace(content)
+		}
+	}
+
+	k.lock.Lock()
+	if k.cache == nil {
+		k.cache = make(map[string]killSwitchState)
+	}
+	k.cache[owner] = s
+	k.lock.Unlock()
+
+	return s.engaged, s.reason, nil
+}
+
+// warnUnavailable logs once per owner that the kill switch cannot be engaged.
+func (k *KillSwitch) warnUnavailable(ctx context.Context, owner string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if k.warned[owner] {
+		return
+	}
+	if k.warned == nil {
+		k.warned = make(map[string]bool)
+	}
+	k.warned[owner] = true
+	zerolog.Ctx(ctx).Warn().Msgf("The kill switch of %s cannot be engaged: the %s repository does not exist or is not readable by the app", owner, killSwitchRepo)
+}
+
+func isNotFound(err error) bool {
+	rerr, ok := err.(*github.ErrorResponse)
+	return ok && rerr.Response.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKillSwitchEngaged(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/stopped/.github/contents/bulldozer-stop":
+			_, _ = w.Write([]byte(`{"type": "file", "encoding": "base64", "content": "SU5DLTEyMwo="}`))
+		case "/repos/running/.github":
+			_, _ = w.Write([]byte(`{"name": ".github"}`))
+		case "/repos/broken/.github/contents/bulldozer-stop":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	ctx := context.Background()
+
+	k := &KillSwitch{}
+	engaged, reason, err := k.Engaged(ctx, client, "stopped")
+	require.NoError(t, err)
+	assert.True(t, engaged)
+	assert.Equal(t, "INC-123", reason)
+
+	engaged, _, err = k.Engaged(ctx, client, "running")
+	require.NoError(t, err)
+	assert.False(t, engaged, "a missing file in a readable repository is not engaged")
+
+	engaged, _, err = k.Engaged(ctx, client, "missing")
+	require.NoError(t, err)
+	assert.False(t, engaged, "a missing repository only warns by default")
+
+	_, _, err = k.Engaged(ctx, client, "broken")
+	assert.Error(t, err)
+
+	strict := &KillSwitch{RequireRepository: true}
+	_, _, err = strict.Engaged(ctx, client, "missing")
+	assert.Error(t, err, "a missing repository fails closed if the repository is required")
+
+	engaged, _, err = strict.Engaged(ctx, client, "running")
+	require.NoError(t, err)
+	assert.False(t, engaged)
+}
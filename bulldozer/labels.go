@@ -0,0 +1,161 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	DefaultLabelColor       = "ededed"
+	DefaultLabelDescription = "Used by bulldozer"
+
+	// labelCheckTTL is how long bulldozer trusts that the labels of a
+	// configuration exist before checking again, in case they were deleted
+	labelCheckTTL = 24 * time.Hour
+)
+
+// LabelStyle is the color and description of a label created by bulldozer.
+type LabelStyle struct {
+	Color       string `yaml:"color"`
+	Description string `yaml:"description"`
+}
+
+// LabelCreator creates the labels that a configuration relies on, but that do
+// not exist in the repository yet. Labels are created with the style in
+// Labels for their name, or with Default otherwise. A nil LabelCreator does
+// nothing.
+type LabelCreator struct {
+	Default LabelStyle
+	Labels  map[string]LabelStyle
+}
+
+// TriggerLabels returns the labels the configuration looks for on pull
+// requests, sorted and without duplicates.
+func (c *Config) TriggerLabels() []string {
+	var all []string
+	all = append(all, c.Merge.Whitelist.Labels...)
+	all = append(all, c.Merge.Blacklist.Labels...)
+	all = append(all, c.Merge.ReadyForReviewLabels...)
+	all = append(all, c.Merge.AfterMerge.Tag.Labels...)
+	all = append(all, c.Update.Whitelist.Labels...)
+	all = append(all, c.Update.Blacklist.Labels...)
+	all = append(all, c.Update.PriorityLabels...)
+
+	seen := make(map[string]bool)
+	var labels []string
+	for _, label := range all {
+		key := strings.ToLower(label)
+		if label == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// CreateMissing creates the trigger labels of the configuration that do not
+// exist in the repository and returns their names. After the labels of a
+// configuration are checked, they are not checked again for a day.
+func (lc *LabelCreator) CreateMissing(ctx context.Context, client *github.Client, owner, repo string, config *Config) ([]string, error) {
+	if lc == nil {
+		return nil, nil
+	}
+
+	labels := config.TriggerLabels()
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	store := state.Ctx(ctx)
+	key := "labels/" + owner + "/" + repo
+	hash := ConfigHash(labels)
+	if checked, ok, err := store.Get(ctx, key); err != nil {
+		return nil, errors.Wrap(err, "failed to read label check")
+	} else if ok && string(checked) == hash {
+		return nil, nil
+	}
+
+	existing := make(map[string]bool)
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		page, res, err := client.Issues.ListLabels(ctx, owner, repo, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list labels")
+		}
+		for _, label := range page {
+			existing[strings.ToLower(label.GetName())] = true
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+
+	var created []string
+	for _, name := range labels {
+		if existing[strings.ToLower(name)] {
+			continue
+		}
+
+		style := lc.style(name)
+		label := &github.Label{
+			Name:        github.String(name),
+			Color:       github.String(style.Color),
+			Description: github.String(style.Description),
+		}
+		if _, _, err := client.Issues.CreateLabel(ctx, owner, repo, label); err != nil {
+			return created, errors.Wrapf(err, "failed to create label %q", name)
+		}
+		zerolog.Ctx(ctx).Info().Msgf("Created missing label %q in %s/%s", name, owner, repo)
+		created = append(created, name)
+	}
+
+	if err := store.Set(ctx, key, []byte(hash), labelCheckTTL); err != nil {
+		return created, errors.Wrap(err, "failed to record label check")
+	}
+	return created, nil
+}
+
+func (lc *LabelCreator) style(name string) LabelStyle {
+	style := lc.Default
+	if s, ok := lc.Labels[name]; ok {
+		if s.Color != "" {
+			style.Color = s.Color
+		}
+		if s.Description != "" {
+			style.Description = s.Description
+		}
+	}
+	if style.Color == "" {
+		style.Color = DefaultLabelColor
+	}
+	if style.Description == "" {
+		style.Description = DefaultLabelDescription
+	}
+	style.Color = strings.TrimPrefix(style.Color, "#")
+	return style
+}
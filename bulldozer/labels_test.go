@@ -0,0 +1,51 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriggerLabels(t *testing.T) {
+	config := Config{
+		Merge: MergeConfig{
+			Whitelist:            Signals{Labels: []string{"merge when ready"}},
+			Blacklist:            Signals{Labels: []string{"do not merge", "WIP"}},
+			ReadyForReviewLabels: []string{"Merge When Ready"},
+		},
+		Update: UpdateConfig{
+			Whitelist:      Signals{Labels: []string{"update me"}},
+			PriorityLabels: []string{"wip"},
+		},
+	}
+
+	assert.Equal(t, []string{"WIP", "do not merge", "merge when ready", "update me"}, config.TriggerLabels())
+	assert.Empty(t, (&Config{}).TriggerLabels())
+}
+
+func TestLabelStyle(t *testing.T) {
+	lc := &LabelCreator{
+		Default: LabelStyle{Color: "#0e8a16"},
+		Labels: map[string]LabelStyle{
+			"do not merge": {Color: "b60205", Description: "Blocks bulldozer"},
+		},
+	}
+
+	assert.Equal(t, LabelStyle{Color: "0e8a16", Description: DefaultLabelDescription}, lc.style("merge when ready"))
+	assert.Equal(t, LabelStyle{Color: "b60205", Description: "Blocks bulldozer"}, lc.style("do not merge"))
+	assert.Equal(t, LabelStyle{Color: DefaultLabelColor, Description: DefaultLabelDescription}, (&LabelCreator{}).style("x"))
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 	"time"
 
@@ -25,29 +26,43 @@ import (
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 
+	"github.com/palantir/bulldozer/audit"
 	"github.com/palantir/bulldozer/pull"
 )
 
 const MaxPullRequestPollCount = 5
 
-func MergePR(ctx context.Context, pullCtx pull.Context, client *github.Client, mergeConfig MergeConfig) error {
+// mergePollInterval is the time between attempts to merge a pull request.
+var mergePollInterval = 4 * time.Second
+
+// MergePR merges the pull request according to the configuration. If signer
+// is non-nil, it is used to sign commits for configurations that require it.
+// It waits for GitHub to determine whether the pull request is mergeable and
+// returns when the merge and the actions after it finish or are abandoned,
+// which may take several seconds; callers that must not wait run it in the
+// background. The result is recorded as an audit event. If halted is non-nil,
+// it is checked immediately before every merge attempt, and the merge is
+// aborted if it returns true.
+func MergePR(ctx context.Context, pullCtx pull.Context, client *github.Client, signer CommitSigner, mergeConfig MergeConfig, halted HaltFunc) error {
 	logger := zerolog.Ctx(ctx)
 
 	mergeOpts := &github.PullRequestOptions{}
 
 	switch mergeConfig.Method {
-	case SquashAndMerge, MergeCommit, RebaseAndMerge:
+	case SquashAndMerge, MergeCommit, RebaseAndMerge, FastForwardOnly:
 		mergeOpts.MergeMethod = string(mergeConfig.Method)
 	default:
 		mergeOpts.MergeMethod = string(MergeCommit)
 	}
 
+	event := mergeEvent(ctx, pullCtx, mergeConfig, MergeMethod(mergeOpts.MergeMethod))
+
 	commitMessage := ""
 	if mergeConfig.Method == SquashAndMerge {
 		opt, ok := mergeConfig.Options[SquashAndMerge]
 		if !ok {
 			logger.Error().Msgf("Unable to find matching %s in merge option configuration; using default %s", SquashAndMerge, EmptyBody)
-			opt = MergeOption{EmptyBody}
+			opt = MergeOption{Body: EmptyBody}
 		}
 
 		switch opt.Body {
@@ -56,7 +71,10 @@ func MergePR(ctx context.Context, pullCtx pull.Context, client *github.Client, m
 			if err != nil {
 				return errors.Wrap(err, "failed to determine pull request body")
 			}
-			commitMessage = body
+			commitMessage, err = formatPullRequestBody(body, opt)
+			if err != nil {
+				return errors.Wrap(err, "failed to format pull request body")
+			}
 		case SummarizeCommits:
 			summarizedMessages, err := summarizeCommitMessages(ctx, pullCtx, client)
 			if err != nil {
@@ -67,97 +85,468 @@ func MergePR(ctx context.Context, pullCtx pull.Context, client *github.Client, m
 		case EmptyBody:
 		default:
 		}
+
+		title, valid, err := squashTitle(ctx, pullCtx, opt)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine squash commit title")
+		}
+		if !valid {
+			logger.Info().Msgf("Not merging %q because squash commit title %q does not match pattern %q", pullCtx.Locator(), title, opt.TitlePattern)
+
+			comment := fmt.Sprintf("bulldozer did not merge this pull request because the commit title `%s` does not match the required pattern `%s`. Edit the pull request title to continue.", title, opt.TitlePattern)
+			if err := upsertMarkedComment(ctx, client, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number(), titleMarker, comment); err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msg("Failed to comment on invalid squash commit title")
+			}
+
+			event.Result = audit.ResultRejected
+			event.Detail = fmt.Sprintf("title %q does not match pattern %q", title, opt.TitlePattern)
+			audit.Record(ctx, event)
+			return nil
+		}
+		if opt.TitlePattern != "" {
+			if err := deleteMarkedComment(ctx, client, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number(), titleMarker); err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msg("Failed to delete comment on invalid squash commit title")
+			}
+		}
+		if opt.TitleTemplate != "" {
+			mergeOpts.CommitTitle = title
+		}
 	}
 
-	go func(ctx context.Context) {
-		ticker := time.NewTicker(4 * time.Second)
-		defer ticker.Stop()
+	if mergeConfig.Trailers.Enabled() && (mergeConfig.Method == SquashAndMerge || mergeConfig.Method == MergeCommit) {
+		trailers, err := commitTrailers(ctx, pullCtx, mergeConfig.Trailers)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine commit message trailers")
+		}
 
-		for i := 0; i < MaxPullRequestPollCount; i++ {
-			<-ticker.C
+		// GitHub uses the title as the default message of merge commits
+		if commitMessage == "" && mergeConfig.Method == MergeCommit {
+			if commitMessage, err = pullCtx.Title(ctx); err != nil {
+				return errors.Wrap(err, "failed to determine pull request title")
+			}
+		}
+		commitMessage = AppendTrailers(commitMessage, trailers)
+	}
 
-			pr, _, err := client.PullRequests.Get(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+	if mergeConfig.Method == RebaseAndMerge {
+		if opt, ok := mergeConfig.Options[RebaseAndMerge]; ok && opt.CommitMessagePattern != "" {
+			invalid, err := commitsNotMatching(ctx, pullCtx, client, opt.CommitMessagePattern)
 			if err != nil {
-				logger.Error().Err(errors.WithStack(err)).Msgf("Failed to retrieve pull request %q", pullCtx.Locator())
-				return
+				return errors.Wrap(err, "failed to validate pull request commit messages")
 			}
+			if len(invalid) > 0 {
+				logger.Info().Msgf("Not merging %q with method %s because commits [%s] do not match pattern %q", pullCtx.Locator(), RebaseAndMerge, strings.Join(invalid, ","), opt.CommitMessagePattern)
 
-			if pr.GetState() == "closed" {
-				logger.Debug().Msg("Pull request already closed")
-				return
+				event.Result = audit.ResultRejected
+				event.Detail = fmt.Sprintf("commits [%s] do not match pattern %q", strings.Join(invalid, ","), opt.CommitMessagePattern)
+				audit.Record(ctx, event)
+				return nil
 			}
+		}
+	}
+
+	if mergeConfig.DryRun {
+		logger.Info().Msgf("Dry run enabled, reporting merge of %q with method %s instead of merging", pullCtx.Locator(), mergeOpts.MergeMethod)
+
+		event.Result = audit.ResultDryRun
+		audit.Record(ctx, event)
+		return reportDryRun(ctx, pullCtx, client, mergeConfig, MergeMethod(mergeOpts.MergeMethod), commitMessage)
+	}
 
-			if pr.Mergeable == nil {
-				logger.Debug().Msg("Pull request mergeability not yet known")
+	signCommits := mergeConfig.SignCommits
+	if signCommits {
+		switch {
+		case signer == nil:
+			logger.Warn().Msg("Configuration requires signed commits, but the server has no signing key; using the merge API")
+			signCommits = false
+		case mergeConfig.Method != MergeCommit && mergeConfig.Method != SquashAndMerge:
+			logger.Warn().Msgf("Signed commits are not supported with method %s; using the merge API", mergeConfig.Method)
+			signCommits = false
+		}
+	}
+
+	attempt := event
+	attempt.Result = audit.ResultAttempted
+	audit.Record(ctx, attempt)
+
+	ticker := time.NewTicker(mergePollInterval)
+	defer ticker.Stop()
+
+	record := func(result, detail string) {
+		event.Result = result
+		event.Detail = detail
+		audit.Record(ctx, event)
+	}
+
+	dismissed := false
+
+	for i := 0; i < MaxPullRequestPollCount; i++ {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			record(audit.ResultAborted, "merge was canceled")
+			return errors.Wrap(ctx.Err(), "merge was canceled")
+		}
+
+		pr, _, err := client.PullRequests.Get(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+		if err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to retrieve pull request %q", pullCtx.Locator())
+			record(audit.ResultFailed, err.Error())
+			return nil
+		}
+
+		if pr.GetState() == "closed" {
+			logger.Debug().Msg("Pull request already closed")
+			record(audit.ResultAborted, "pull request already closed")
+			return nil
+		}
+
+		if problem := headProblem(pr, false); problem != "" {
+			reportHeadProblem(ctx, client, pr, "merge", problem)
+			record(audit.ResultAborted, problem)
+			return nil
+		}
+
+		if pr.Mergeable == nil {
+			logger.Debug().Msg("Pull request mergeability not yet known")
+			continue
+		}
+
+		if !pr.GetMergeable() {
+			logger.Debug().Msg("Pull request is not mergeable")
+			record(audit.ResultRejected, "pull request is not mergeable")
+			return nil
+		}
+
+		// Dismissing approvals may leave too few approvals to merge, which
+		// is detected by the evaluation below
+		if mergeConfig.StaleApprovals == DismissStaleApprovals && !dismissed {
+			if err := dismissStaleApprovals(ctx, pullCtx, client, pr.GetHead().GetSHA()); err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msg("Failed to dismiss stale approvals")
 				continue
 			}
+			dismissed = true
+		}
 
-			if !pr.GetMergeable() {
-				logger.Debug().Msg("Pull request is not mergeable")
-				return
+		// Signals may have changed since the evaluation that triggered
+		// this merge, so evaluate again using fresh data
+		freshCtx := pull.NewGithubContext(client, pr, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+		shouldMerge, err := ShouldMergePR(ctx, freshCtx, mergeConfig)
+		if err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Failed to re-evaluate pull request before merging")
+			continue
+		}
+		if !shouldMerge {
+			logger.Info().Msg("Pull request is no longer eligible for merging; aborting merge")
+			record(audit.ResultAborted, "pull request is no longer eligible for merging")
+			return nil
+		}
+
+		// Only merge the head commit that was just evaluated
+		mergeOpts.SHA = pr.GetHead().GetSHA()
+		event.SHA = pr.GetHead().GetSHA()
+
+		// a kill switch or pause stops merges that are already waiting
+		if halted != nil {
+			stop, err := halted(ctx)
+			if err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msg("Failed to determine if merges are halted")
+				continue
+			}
+			if stop {
+				logger.Info().Msg("Merges were halted; aborting merge")
+				record(audit.ResultAborted, "merges were halted by the kill switch or a pause")
+				return nil
 			}
+		}
 
-			// Try a merge, a 405 is expected if required reviews are not satisfied
-			logger.Info().Msgf("Attempting to merge pull request with method %s", mergeOpts.MergeMethod)
-			result, _, err := client.PullRequests.Merge(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number(), commitMessage, mergeOpts)
+		if mergeOpts.MergeMethod == string(FastForwardOnly) {
+			logger.Info().Msgf("Attempting to fast-forward %s to %s", pr.GetBase().GetRef(), pr.GetHead().GetSHA())
+			sha, err := fastForward(ctx, client, pr)
 			if err != nil {
-				gerr, ok := err.(*github.ErrorResponse)
-				if !ok {
-					logger.Error().Err(errors.WithStack(err)).Msg("Merge failed unexpectedly")
-					continue
+				if _, ok := errors.Cause(err).(notFastForwardError); ok {
+					logger.Info().Msgf("Fast-forward rejected: %s", err.Error())
+					record(audit.ResultRejected, err.Error())
+					return nil
 				}
+				logger.Error().Err(errors.WithStack(err)).Msg("Fast-forward failed unexpectedly")
+				continue
+			}
+
+			logger.Info().Msgf("Successfully fast-forwarded %s to sha %s", pr.GetBase().GetRef(), sha)
+			event.MergeSHA = sha
+			record(audit.ResultMerged, "")
+			afterMerge(ctx, client, pullCtx, pr, sha, mergeConfig)
+			return nil
+		}
 
-				switch gerr.Response.StatusCode {
-				case http.StatusMethodNotAllowed:
-					logger.Info().Msgf("Merge rejected due to unsatisfied condition %q", gerr.Message)
-					return
-				case http.StatusConflict:
-					logger.Info().Msgf("Merge rejected due to being invalid %q", gerr.Message)
-					return
-				default:
-					logger.Error().Err(errors.WithStack(err)).Msgf("Merge failed unexpectedly %q", gerr.Message)
+		if signCommits {
+			logger.Info().Msgf("Attempting to merge pull request with signed commit using method %s", mergeConfig.Method)
+			sha, err := mergeSigned(ctx, client, signer, pr, mergeConfig.Method, signedCommitMessage(pr, mergeConfig.Method, mergeOpts.CommitTitle, commitMessage))
+			if err != nil {
+				if sha != "" {
+					logger.Error().Err(errors.WithStack(err)).Msgf("Merged pull request as signed commit %s, but failed to finalize", sha)
+					event.MergeSHA = sha
+					record(audit.ResultMerged, err.Error())
+					return nil
+				}
+				if _, ok := errors.Cause(err).(staleTestMergeError); ok {
+					logger.Info().Msgf("Test merge is out of date, retrying: %s", err.Error())
 					continue
 				}
+				logger.Error().Err(errors.WithStack(err)).Msg("Signed merge failed unexpectedly")
+				continue
 			}
 
-			logger.Info().Msgf("Successfully merged pull request for sha %s with message %q", result.GetSHA(), result.GetMessage())
+			logger.Info().Msgf("Successfully merged pull request as signed commit %s", sha)
+			event.MergeSHA = sha
+			record(audit.ResultMerged, "")
+			afterMerge(ctx, client, pullCtx, pr, sha, mergeConfig)
+			return nil
+		}
 
-			// Delete ref if owner of BASE and HEAD match
-			// otherwise, its from a fork that we cannot delete
-			if pr.GetBase().GetUser().GetLogin() == pr.GetHead().GetUser().GetLogin() {
-				if mergeConfig.DeleteAfterMerge {
-					ref := fmt.Sprintf("refs/heads/%s", pr.Head.GetRef())
+		// Try a merge, a 405 is expected if required reviews are not satisfied
+		logger.Info().Msgf("Attempting to merge pull request with method %s", mergeOpts.MergeMethod)
+		result, res, err := client.PullRequests.Merge(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number(), commitMessage, mergeOpts)
+		if res != nil {
+			if id := requestID(res.Response); id != "" {
+				event.RequestIDs = append(event.RequestIDs, id)
+			}
+		}
+		if err != nil {
+			gerr, ok := err.(*github.ErrorResponse)
+			if !ok {
+				logger.Error().Err(errors.WithStack(err)).Msg("Merge failed unexpectedly")
+				continue
+			}
 
-					// check other open PRs to make sure that nothing is trying to merge into the ref we're about to delete
-					prs, err := pull.ListOpenPullRequestsForRef(ctx, client, pullCtx.Owner(), pullCtx.Repo(), ref)
-					if err != nil {
-						logger.Error().Err(errors.WithStack(err)).Msgf("Unable to list open prs against ref %s to compare delete request", ref)
-						return
-					}
+			if mergeConfig.BaseMovedRetries > 0 && isBaseMoved(pr, gerr) {
+				logger.Info().Msgf("Merge rejected because %s moved: %q", pr.GetBase().GetRef(), gerr.Message)
+				if err := recoverBaseMoved(ctx, client, pr, mergeConfig.BaseMovedRetries); err != nil {
+					logger.Error().Err(errors.WithStack(err)).Msg("Failed to update pull request after base branch moved")
+				}
+				record(audit.ResultRejected, fmt.Sprintf("base branch moved: %s", gerr.Message))
+				return nil
+			}
 
-					if len(prs) > 0 {
-						logger.Info().Msgf("Unable to delete ref %s after merging %q because there are open PRs against this ref", ref, pullCtx.Locator())
-						return
-					}
+			switch gerr.Response.StatusCode {
+			case http.StatusMethodNotAllowed:
+				if mergeOpts.MergeMethod == string(RebaseAndMerge) && pr.GetMergeableState() == "clean" {
+					// GitHub reports rebase failures (e.g. conflicts that a
+					// merge commit could resolve) as a generic 405
+					logger.Info().Msgf("Merge rejected because the pull request cannot be rebased onto %s: %q", pr.GetBase().GetRef(), gerr.Message)
+					record(audit.ResultRejected, fmt.Sprintf("cannot rebase onto %s: %s", pr.GetBase().GetRef(), gerr.Message))
+					return nil
+				}
+				logger.Info().Msgf("Merge rejected due to unsatisfied condition %q", gerr.Message)
+				record(audit.ResultRejected, gerr.Message)
+				return nil
+			case http.StatusConflict:
+				logger.Info().Msgf("Merge rejected due to being invalid %q", gerr.Message)
+				record(audit.ResultRejected, gerr.Message)
+				return nil
+			default:
+				logger.Error().Err(errors.WithStack(err)).Msgf("Merge failed unexpectedly %q", gerr.Message)
+				continue
+			}
+		}
 
-					logger.Debug().Msgf("Attempting to delete ref %s", ref)
-					_, err = client.Git.DeleteRef(ctx, pullCtx.Owner(), pullCtx.Repo(), ref)
-					if err != nil {
-						logger.Error().Err(errors.WithStack(err)).Msgf("Failed to delete ref %s on %q", pr.Head.GetRef(), pullCtx.Locator())
-						return
-					}
+		logger.Info().Msgf("Successfully merged pull request for sha %s with message %q", result.GetSHA(), result.GetMessage())
+		event.MergeSHA = result.GetSHA()
+		record(audit.ResultMerged, "")
 
-					logger.Info().Msgf("Successfully deleted ref %s on %q", pr.Head.GetRef(), pullCtx.Locator())
-				}
-			} else {
-				logger.Debug().Msg("Pull Request is from a fork, not deleting")
+		afterMerge(ctx, client, pullCtx, pr, result.GetSHA(), mergeConfig)
+		return nil
+	}
+
+	record(audit.ResultFailed, fmt.Sprintf("pull request was not merged after %d attempts", MaxPullRequestPollCount))
+	return nil
+}
+
+// afterMerge runs all configured actions for a pull request that was merged
+// as the commit with the given SHA.
+func afterMerge(ctx context.Context, client *github.Client, pullCtx pull.Context, pr *github.PullRequest, sha string, mergeConfig MergeConfig) {
+	logger := zerolog.Ctx(ctx)
+
+	if mergeConfig.AfterMerge.Backport.Enabled() {
+		switch mergeConfig.Method {
+		case RebaseAndMerge, FastForwardOnly:
+			logger.Warn().Msgf("Backports are not supported with method %s", mergeConfig.Method)
+		default:
+			backportPR(ctx, client, pr, sha, mergeConfig.AfterMerge.Backport)
+		}
+	}
+
+	if mergeConfig.AfterMerge.ForwardPort.Enabled() {
+		switch mergeConfig.Method {
+		case RebaseAndMerge, FastForwardOnly:
+			logger.Warn().Msgf("Forward-ports are not supported with method %s", mergeConfig.Method)
+		default:
+			forwardPortPR(ctx, client, pr, sha, mergeConfig.AfterMerge.ForwardPort)
+		}
+	}
+
+	if mergeConfig.AfterMerge.Tag.Enabled() {
+		if err := tagMergeCommit(ctx, client, pr, sha, mergeConfig.AfterMerge.Tag); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Failed to tag merge commit")
+		}
+	}
+
+	if mergeConfig.AfterMerge.Jira.Enabled() {
+		transitionJiraIssues(ctx, pr, mergeConfig.AfterMerge.Jira)
+	}
+
+	if mergeConfig.AfterMerge.CloseSuperseded {
+		if err := closeSupersededPRs(ctx, client, pr); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Failed to close superseded pull requests")
+		}
+	}
+
+	deleteHeadAfterMerge(ctx, client, pullCtx, pr, mergeConfig)
+}
+
+// deleteHeadAfterMerge deletes the head branch of a merged pull request if
+// configured and if it is safe to delete the branch.
+func deleteHeadAfterMerge(ctx context.Context, client *github.Client, pullCtx pull.Context, pr *github.PullRequest, mergeConfig MergeConfig) {
+	logger := zerolog.Ctx(ctx)
+
+	// Delete ref if owner of BASE and HEAD match
+	// otherwise, its from a fork that we cannot delete
+	if pr.GetBase().GetUser().GetLogin() == pr.GetHead().GetUser().GetLogin() {
+		if mergeConfig.DeleteAfterMerge {
+			ref := fmt.Sprintf("refs/heads/%s", pr.Head.GetRef())
+
+			reason, err := unsafeToDelete(ctx, client, pullCtx, pr, mergeConfig.DeleteAfterMergeExclusions)
+			if err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msgf("Unable to determine if ref %s is safe to delete", ref)
+				return
+			}
+
+			if reason != "" {
+				logger.Info().Msgf("Unable to delete ref %s after merging %q because %s", ref, pullCtx.Locator(), reason)
+				return
 			}
 
-			return
+			logger.Debug().Msgf("Attempting to delete ref %s", ref)
+			_, err = client.Git.DeleteRef(ctx, pullCtx.Owner(), pullCtx.Repo(), ref)
+			if err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msgf("Failed to delete ref %s on %q", pr.Head.GetRef(), pullCtx.Locator())
+				return
+			}
+
+			logger.Info().Msgf("Successfully deleted ref %s on %q", pr.Head.GetRef(), pullCtx.Locator())
 		}
-	}(zerolog.Ctx(ctx).WithContext(context.Background()))
+	} else {
+		logger.Debug().Msg("Pull Request is from a fork, not deleting")
+	}
+}
 
-	return nil
+// unsafeToDelete returns the reason the head branch of the pull request must
+// not be deleted, or an empty string if it is safe to delete.
+func unsafeToDelete(ctx context.Context, client *github.Client, pullCtx pull.Context, pr *github.PullRequest, exclusions []string) (string, error) {
+	branch := pr.GetHead().GetRef()
+
+	if pattern := matchAnyGlob(exclusions, branch); pattern != "" {
+		return fmt.Sprintf("it matches the exclusion %q", pattern), nil
+	}
+
+	if branch == pr.GetHead().GetRepo().GetDefaultBranch() {
+		return "it is the default branch", nil
+	}
+
+	_, _, err := client.Repositories.GetBranchProtection(ctx, pullCtx.Owner(), pullCtx.Repo(), branch)
+	if err == nil {
+		return "it is protected", nil
+	}
+	if rerr, ok := err.(*github.ErrorResponse); !ok || rerr.Response.StatusCode != http.StatusNotFound {
+		return "", errors.Wrapf(err, "cannot get branch protection for %s", branch)
+	}
+
+	prs, err := pull.ListOpenPullRequests(ctx, client, pullCtx.Owner(), pullCtx.Repo())
+	if err != nil {
+		return "", err
+	}
+
+	for _, other := range prs {
+		if other.GetNumber() == pr.GetNumber() {
+			continue
+		}
+		if other.GetBase().GetRef() == branch {
+			return fmt.Sprintf("open PR #%d targets it", other.GetNumber()), nil
+		}
+		if other.GetHead().GetRef() == branch && other.GetHead().GetRepo().GetID() == pr.GetHead().GetRepo().GetID() {
+			return fmt.Sprintf("open PR #%d originates from it", other.GetNumber()), nil
+		}
+	}
+
+	return "", nil
+}
+
+// notFastForwardError is returned when the base branch cannot be
+// fast-forwarded to the head of a pull request.
+type notFastForwardError string
+
+func (err notFastForwardError) Error() string {
+	return string(err)
+}
+
+// fastForward updates the base branch of the pull request to point at the
+// head commit, returning the new SHA of the base branch.
+func fastForward(ctx context.Context, client *github.Client, pr *github.PullRequest) (string, error) {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	baseRef := pr.GetBase().GetRef()
+	headSHA := pr.GetHead().GetSHA()
+
+	comparison, _, err := client.Repositories.CompareCommits(ctx, owner, repo, baseRef, headSHA)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot compare %s and %s", baseRef, headSHA)
+	}
+	if comparison.GetBehindBy() > 0 {
+		return "", notFastForwardError(fmt.Sprintf("head %s is %d commits behind %s", headSHA, comparison.GetBehindBy(), baseRef))
+	}
+
+	ref := &github.Reference{
+		Ref: github.String(fmt.Sprintf("refs/heads/%s", baseRef)),
+		Object: &github.GitObject{
+			SHA: github.String(headSHA),
+		},
+	}
+
+	updated, _, err := client.Git.UpdateRef(ctx, owner, repo, ref, false)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot update %s to %s", baseRef, headSHA)
+	}
+	return updated.GetObject().GetSHA(), nil
+}
+
+// titleMarker identifies comments about invalid squash commit titles
+const titleMarker = "<!-- bulldozer:commit-title -->"
+
+// squashTitle returns the title of the squash commit for the pull request and
+// whether it matches the title pattern of the merge option.
+func squashTitle(ctx context.Context, pullCtx pull.Context, opt MergeOption) (string, bool, error) {
+	title, err := pullCtx.Title(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	_, head, err := pullCtx.Branches(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	labels, err := pullCtx.Labels(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	return formatSquashTitle(TitleData{
+		Number:  pullCtx.Number(),
+		Title:   title,
+		HeadRef: headBranchName(head),
+		Labels:  labels,
+	}, opt)
 }
 
 func summarizeCommitMessages(ctx context.Context, pullCtx pull.Context, client *github.Client) (string, error) {
@@ -174,6 +563,75 @@ func summarizeCommitMessages(ctx context.Context, pullCtx pull.Context, client *
 	return builder.String(), nil
 }
 
+// commitTrailers returns the trailers to add to the commit message of the
+// pull request.
+func commitTrailers(ctx context.Context, pullCtx pull.Context, config TrailerConfig) ([]Trailer, error) {
+	var trailers []Trailer
+
+	if config.PullRequest {
+		trailers = append(trailers, Trailer{Key: "PR", Value: fmt.Sprintf("#%d", pullCtx.Number())})
+	}
+
+	if config.ReviewedBy {
+		approvers, err := pullCtx.Approvers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, approver := range approvers {
+			trailers = append(trailers, Trailer{Key: "Reviewed-by", Value: approver})
+		}
+	}
+
+	if config.TicketPattern != "" {
+		r, err := regexp.Compile(config.TicketPattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid ticket pattern %q", config.TicketPattern)
+		}
+
+		_, head, err := pullCtx.Branches(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if m := r.FindStringSubmatch(headBranchName(head)); m != nil {
+			ticket := m[0]
+			if len(m) > 1 {
+				ticket = m[1]
+			}
+
+			key := config.TicketKey
+			if key == "" {
+				key = "Ticket"
+			}
+			trailers = append(trailers, Trailer{Key: key, Value: ticket})
+		}
+	}
+
+	return trailers, nil
+}
+
+// commitsNotMatching returns the SHAs of all commits in the pull request with
+// messages that do not match the pattern.
+func commitsNotMatching(ctx context.Context, pullCtx pull.Context, client *github.Client, pattern string) ([]string, error) {
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid commit message pattern %q", pattern)
+	}
+
+	repositoryCommits, err := allCommits(ctx, pullCtx, client)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot list commits for %q", pullCtx.Locator())
+	}
+
+	var invalid []string
+	for _, repositoryCommit := range repositoryCommits {
+		if !r.MatchString(repositoryCommit.Commit.GetMessage()) {
+			invalid = append(invalid, repositoryCommit.GetSHA())
+		}
+	}
+	return invalid, nil
+}
+
 func allCommits(ctx context.Context, pullCtx pull.Context, client *github.Client) ([]*github.RepositoryCommit, error) {
 	var repositoryCommits []*github.RepositoryCommit
 	opts := &github.ListOptions{
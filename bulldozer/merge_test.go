@@ -0,0 +1,215 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/pull/pulltest"
+)
+
+// mergeRequest is the body of a request to merge a pull request.
+type mergeRequest struct {
+	SHA         string `json:"sha"`
+	MergeMethod string `json:"merge_method"`
+}
+
+// mergeServer serves the API requests made to merge pull request o/r#1,
+// which has the given labels when it is retrieved before merging.
+type mergeServer struct {
+	labels []string
+
+	mu     sync.Mutex
+	merges []mergeRequest
+}
+
+func (s *mergeServer) client(t *testing.T) *github.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/pulls/1":
+			labels, _ := json.Marshal(s.labelObjects())
+			_, _ = fmt.Fprintf(w, `{
+				"number": 1,
+				"state": "open",
+				"mergeable": true,
+				"labels": %s,
+				"base": {"ref": "develop", "repo": {"id": 1, "name": "r", "owner": {"login": "o"}}},
+				"head": {"ref": "feature", "sha": "fresh", "repo": {"id": 1, "name": "r", "owner": {"login": "o"}}}
+			}`, labels)
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/pulls/1/comments":
+			_, _ = w.Write([]byte(`[]`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/issues/1/comments":
+			_, _ = w.Write([]byte(`[]`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/branches/develop/protection":
+			http.NotFound(w, r)
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/commits/fresh/status":
+			_, _ = w.Write([]byte(`{"statuses": []}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/commits/fresh/check-runs":
+			_, _ = w.Write([]byte(`{"total_count": 0, "check_runs": []}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/repos/o/r/pulls/1/merge":
+			var m mergeRequest
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+				t.Errorf("invalid merge: %v", err)
+			}
+			s.mu.Lock()
+			s.merges = append(s.merges, m)
+			s.mu.Unlock()
+			_, _ = w.Write([]byte(`{"sha": "merged", "merged": true}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+func (s *mergeServer) labelObjects() []*github.Label {
+	var labels []*github.Label
+	for _, name := range s.labels {
+		labels = append(labels, &github.Label{Name: github.String(name)})
+	}
+	return labels
+}
+
+func (s *mergeServer) recordedMerges() []mergeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]mergeRequest(nil), s.merges...)
+}
+
+// resultSink sends the audit events that finish a merge to a channel.
+type resultSink chan audit.Event
+
+func (s resultSink) Record(ctx context.Context, event audit.Event) error {
+	if event.Result != audit.ResultAttempted {
+		s <- event
+	}
+	return nil
+}
+
+// mergeAndWait merges the pull request and returns the audit event that
+// records the result.
+func mergeAndWait(t *testing.T, client *github.Client, mergeConfig MergeConfig, halted HaltFunc) audit.Event {
+	interval := mergePollInterval
+	mergePollInterval = time.Millisecond
+	t.Cleanup(func() { mergePollInterval = interval })
+
+	results := make(resultSink, 1)
+	ctx := audit.WithSink(WithBotLogin(context.Background(), "bulldozer[bot]"), results)
+
+	pullCtx := &pulltest.MockPullContext{
+		OwnerValue:   "o",
+		RepoValue:    "r",
+		NumberValue:  1,
+		HeadSHAValue: "stale",
+		LabelValue:   []string{"merge when ready"},
+	}
+
+	err := MergePR(ctx, pullCtx, client, nil, mergeConfig, halted)
+	require.Nil(t, err)
+
+	select {
+	case event := <-results:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("merge did not finish")
+		return audit.Event{}
+	}
+}
+
+func TestMergePRReevaluates(t *testing.T) {
+	mergeConfig := MergeConfig{
+		Method: MergeCommit,
+		Whitelist: Signals{
+			Labels: []string{"merge when ready"},
+		},
+	}
+
+	t.Run("mergesEvaluatedHead", func(t *testing.T) {
+		srv := &mergeServer{labels: []string{"merge when ready"}}
+
+		event := mergeAndWait(t, srv.client(t), mergeConfig, nil)
+
+		assert.Equal(t, audit.ResultMerged, event.Result)
+		assert.Equal(t, "fresh", event.SHA)
+		assert.Equal(t, []mergeRequest{{SHA: "fresh", MergeMethod: "merge"}}, srv.recordedMerges())
+	})
+
+	t.Run("abortsWhenNoLongerEligible", func(t *testing.T) {
+		srv := &mergeServer{}
+
+		event := mergeAndWait(t, srv.client(t), mergeConfig, nil)
+
+		assert.Equal(t, audit.ResultAborted, event.Result)
+		assert.Empty(t, srv.recordedMerges(), "pull request must not be merged after the label is removed")
+	})
+}
+
+func TestMergePRHalted(t *testing.T) {
+	mergeConfig := MergeConfig{
+		Method: MergeCommit,
+		Whitelist: Signals{
+			Labels: []string{"merge when ready"},
+		},
+	}
+
+	t.Run("aborts", func(t *testing.T) {
+		srv := &mergeServer{labels: []string{"merge when ready"}}
+		halted := func(ctx context.Context) (bool, error) {
+			return true, nil
+		}
+
+		event := mergeAndWait(t, srv.client(t), mergeConfig, halted)
+
+		assert.Equal(t, audit.ResultAborted, event.Result)
+		assert.Empty(t, srv.recordedMerges(), "pull request must not be merged while merges are halted")
+	})
+
+	t.Run("checksEveryAttempt", func(t *testing.T) {
+		srv := &mergeServer{labels: []string{"merge when ready"}}
+		checks := 0
+		halted := func(ctx context.Context) (bool, error) {
+			checks++
+			if checks == 1 {
+				return false, errors.New("kill switch is unavailable")
+			}
+			return false, nil
+		}
+
+		event := mergeAndWait(t, srv.client(t), mergeConfig, halted)
+
+		assert.Equal(t, audit.ResultMerged, event.Result)
+		assert.Equal(t, 2, checks, "the merge is retried if the halt check fails")
+		assert.Len(t, srv.recordedMerges(), 1)
+	})
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	htmlCommentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+	blankLinesPattern  = regexp.MustCompile(`\n{3,}`)
+)
+
+// formatPullRequestBody transforms a pull request body into a commit message
+// body according to the formatting settings in the merge option.
+func formatPullRequestBody(body string, opt MergeOption) (string, error) {
+	body = strings.Replace(body, "\r\n", "\n", -1)
+
+	if opt.StripHTMLComments {
+		body = htmlCommentPattern.ReplaceAllString(body, "")
+	}
+
+	lines := strings.Split(body, "\n")
+
+	if opt.MessageDelimiter != "" {
+		for i, line := range lines {
+			if strings.TrimSpace(line) == opt.MessageDelimiter {
+				lines = lines[:i]
+				break
+			}
+		}
+	}
+
+	if len(opt.StripLinePatterns) > 0 {
+		patterns := make([]*regexp.Regexp, len(opt.StripLinePatterns))
+		for i, p := range opt.StripLinePatterns {
+			r, err := regexp.Compile(p)
+			if err != nil {
+				return "", errors.Wrapf(err, "invalid strip line pattern %q", p)
+			}
+			patterns[i] = r
+		}
+
+		kept := lines[:0]
+		for _, line := range lines {
+			if !matchesAny(patterns, line) {
+				kept = append(kept, line)
+			}
+		}
+		lines = kept
+	}
+
+	body = strings.Join(lines, "\n")
+	body = blankLinesPattern.ReplaceAllString(body, "\n\n")
+	body = strings.TrimSpace(body)
+
+	if opt.MaxLength > 0 && utf8.RuneCountInString(body) > opt.MaxLength {
+		body = strings.TrimSpace(string([]rune(body)[:opt.MaxLength]))
+	}
+
+	return body, nil
+}
+
+// DefaultSquashTitle is the template for squash commit titles used by GitHub.
+const DefaultSquashTitle = "{{.Title}} (#{{.Number}})"
+
+// TitleData is the data available to squash commit title templates.
+type TitleData struct {
+	Number  int
+	Title   string
+	HeadRef string
+	Labels  []string
+}
+
+// formatSquashTitle renders the title of a squash commit using the title
+// template of the merge option. It returns false if the title does not match
+// the title pattern of the merge option.
+func formatSquashTitle(data TitleData, opt MergeOption) (string, bool, error) {
+	text := opt.TitleTemplate
+	if text == "" {
+		text = DefaultSquashTitle
+	}
+
+	tmpl, err := template.New("title").Parse(text)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "invalid title template %q", text)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", false, errors.Wrap(err, "cannot render title")
+	}
+	title := strings.TrimSpace(buf.String())
+
+	if opt.TitlePattern != "" {
+		r, err := regexp.Compile(opt.TitlePattern)
+		if err != nil {
+			return "", false, errors.Wrapf(err, "invalid title pattern %q", opt.TitlePattern)
+		}
+		if !r.MatchString(title) {
+			return title, false, nil
+		}
+	}
+
+	return title, true, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, p := range patterns {
+		if p.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/pull/pulltest"
+)
+
+func TestFormatPullRequestBody(t *testing.T) {
+	body := "Fixes the widget.\r\n\r\n<!-- describe your change -->\r\nMore details.\r\n\r\n\r\n\r\n- [x] tests added\r\n---\r\nReviewer notes"
+
+	t.Run("noOptions", func(t *testing.T) {
+		msg, err := formatPullRequestBody(body, MergeOption{})
+		require.Nil(t, err)
+		assert.Equal(t, "Fixes the widget.\n\n<!-- describe your change -->\nMore details.\n\n- [x] tests added\n---\nReviewer notes", msg)
+	})
+
+	t.Run("allOptions", func(t *testing.T) {
+		msg, err := formatPullRequestBody(body, MergeOption{
+			StripHTMLComments: true,
+			MessageDelimiter:  "---",
+			StripLinePatterns: []string{`^- \[[ xX]\]`},
+		})
+		require.Nil(t, err)
+		assert.Equal(t, "Fixes the widget.\n\nMore details.", msg)
+	})
+
+	t.Run("multilineComment", func(t *testing.T) {
+		msg, err := formatPullRequestBody("<!--\ntemplate\ninstructions\n-->\nSummary", MergeOption{StripHTMLComments: true})
+		require.Nil(t, err)
+		assert.Equal(t, "Summary", msg)
+	})
+
+	t.Run("maxLength", func(t *testing.T) {
+		msg, err := formatPullRequestBody("héllo world", MergeOption{MaxLength: 6})
+		require.Nil(t, err)
+		assert.Equal(t, "héllo", msg)
+	})
+
+	t.Run("invalidPattern", func(t *testing.T) {
+		_, err := formatPullRequestBody(body, MergeOption{StripLinePatterns: []string{"("}})
+		assert.NotNil(t, err)
+	})
+}
+
+func TestFormatSquashTitle(t *testing.T) {
+	data := TitleData{Number: 42, Title: "feat: add widgets", HeadRef: "feature/widgets"}
+	conventional := `^(feat|fix|chore)(\(\w+\))?!?: .+`
+
+	t.Run("default", func(t *testing.T) {
+		title, valid, err := formatSquashTitle(data, MergeOption{})
+		require.Nil(t, err)
+		assert.True(t, valid)
+		assert.Equal(t, "feat: add widgets (#42)", title)
+	})
+
+	t.Run("matchingPattern", func(t *testing.T) {
+		_, valid, err := formatSquashTitle(data, MergeOption{TitlePattern: conventional})
+		require.Nil(t, err)
+		assert.True(t, valid)
+	})
+
+	t.Run("nonMatchingPattern", func(t *testing.T) {
+		title, valid, err := formatSquashTitle(TitleData{Number: 7, Title: "Add widgets"}, MergeOption{TitlePattern: conventional})
+		require.Nil(t, err)
+		assert.False(t, valid)
+		assert.Equal(t, "Add widgets (#7)", title)
+	})
+
+	t.Run("template", func(t *testing.T) {
+		title, valid, err := formatSquashTitle(TitleData{Number: 7, Title: "Add widgets"}, MergeOption{
+			TitleTemplate: "chore: {{.Title}} (#{{.Number}})",
+			TitlePattern:  conventional,
+		})
+		require.Nil(t, err)
+		assert.True(t, valid)
+		assert.Equal(t, "chore: Add widgets (#7)", title)
+	})
+}
+
+func TestSquashTitleFromFork(t *testing.T) {
+	pc := &pulltest.MockPullContext{
+		NumberValue: 7,
+		TitleValue:  "Add widgets",
+		BranchBase:  "develop",
+		BranchName:  "contributor:feature/widgets",
+	}
+
+	title, valid, err := squashTitle(context.Background(), pc, MergeOption{
+		TitleTemplate: "{{.Title}} [{{.HeadRef}}]",
+		TitlePattern:  `\[feature/`,
+	})
+	require.Nil(t, err)
+	assert.True(t, valid, "patterns see the branch without the fork owner")
+	assert.Equal(t, "Add widgets [feature/widgets]", title)
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"time"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/palantir/bulldozer/audit"
+)
+
+const (
+	// MetricsKeyUpdates counts update attempts; the result and the trigger
+	// of the attempt are appended to the key
+	MetricsKeyUpdates = "bulldozer.updates"
+
+	// MetricsKeyUpdateCommits counts the commits from base branches that
+	// updates incorporated into pull requests
+	MetricsKeyUpdateCommits = "bulldozer.updates.commits"
+
+	// MetricsKeyUpdateDuration times successful updates
+	MetricsKeyUpdateDuration = "bulldozer.updates.duration"
+)
+
+// recordUpdate records the update event to the audit sink and the metrics
+// registry associated with the context.
+func recordUpdate(ctx context.Context, event audit.Event) {
+	audit.Record(ctx, event)
+
+	registry := baseapp.MetricsCtx(ctx)
+	metrics.GetOrRegisterCounter(MetricsKeyUpdates+"."+event.Result, registry).Inc(1)
+	if event.Trigger != "" {
+		metrics.GetOrRegisterCounter(MetricsKeyUpdates+".trigger."+event.Trigger, registry).Inc(1)
+	}
+	if event.Result == audit.ResultUpdated {
+		metrics.GetOrRegisterCounter(MetricsKeyUpdateCommits, registry).Inc(int64(event.Commits))
+		metrics.GetOrRegisterTimer(MetricsKeyUpdateDuration, registry).Update(time.Duration(event.DurationMillis) * time.Millisecond)
+	}
+}
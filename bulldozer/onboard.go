@@ -0,0 +1,194 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/scm"
+)
+
+const (
+	DefaultOnboardingBranch = "bulldozer-onboarding"
+	DefaultOnboardingTitle  = "Add bulldozer configuration"
+)
+
+// Onboarding opens pull requests that add a configuration file to
+// repositories that do not have one yet.
+type Onboarding struct {
+	// Fetcher determines the path of the new file and the paths of existing
+	// configuration files
+	Fetcher ConfigFetcher
+
+	// Config is the content of the new configuration file
+	Config []byte
+
+	// Repositories are glob patterns of the names of the repositories to
+	// onboard. If empty, every repository is onboarded.
+	Repositories []string
+
+	Branch string
+	Title  string
+	Body   string
+
+	// DryRun reports the pull requests that would be opened without
+	// opening them
+	DryRun bool
+}
+
+// OnboardingResult is the outcome of onboarding a repository.
+type OnboardingResult struct {
+	Repository  string `json:"repository"`
+	PullRequest string `json:"pull_request,omitempty"`
+	Skipped     string `json:"skipped,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Validate returns an error if the configuration is not a valid v1
+// configuration, so that mistakes are found before opening any pull request.
+func (o *Onboarding) Validate() error {
+	if o.Fetcher.configurationV1Path == "" {
+		return errors.New("no configuration path is set")
+	}
+	if _, err := o.Fetcher.unmarshalConfig(o.Config); err != nil {
+		return errors.Wrap(err, "onboarding configuration is invalid")
+	}
+	return nil
+}
+
+// Run onboards the repositories that match the patterns. Archived
+// repositories, repositories that already have a configuration file, and
+// repositories with an existing onboarding branch are skipped.
+func (o *Onboarding) Run(ctx context.Context, client *github.Client, repositories []*github.Repository) []OnboardingResult {
+	logger := zerolog.Ctx(ctx)
+
+	var results []OnboardingResult
+	for _, repository := range repositories {
+		if ctx.Err() != nil {
+			break
+		}
+		if len(o.Repositories) > 0 && matchAnyGlob(o.Repositories, repository.GetName()) == "" {
+			continue
+		}
+
+		result := OnboardingResult{Repository: repository.GetFullName()}
+		if repository.GetArchived() {
+			result.Skipped = "repository is archived"
+		} else {
+			url, skipped, err := o.onboard(ctx, client, repository)
+			switch {
+			case err != nil:
+				logger.Error().Err(err).Msgf("Failed to onboard %s", result.Repository)
+				result.Error = err.Error()
+			case skipped != "":
+				result.Skipped = skipped
+			default:
+				result.PullRequest = url
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// onboard opens the pull request for a repository and returns its URL, or the
+// reason the repository was skipped.
+func (o *Onboarding) onboard(ctx context.Context, client *github.Client, repository *github.Repository) (string, string, error) {
+	owner := repository.GetOwner().GetLogin()
+	repo := repository.GetName()
+	base := repository.GetDefaultBranch()
+
+	paths := append([]string{o.Fetcher.configurationV1Path}, o.Fetcher.configurationV0Paths...)
+	for _, path := range paths {
+		content, err := o.Fetcher.fetchConfigContents(ctx, scm.NewGitHub(client), owner, repo, base, path)
+		if err != nil {
+			return "", "", err
+		}
+		if content != nil {
+			return "", fmt.Sprintf("%s already exists", path), nil
+		}
+	}
+
+	branch := o.Branch
+	if branch == "" {
+		branch = DefaultOnboardingBranch
+	}
+	if _, _, err := client.Repositories.GetBranch(ctx, owner, repo, branch); err == nil {
+		return "", fmt.Sprintf("branch %s already exists", branch), nil
+	} else if rerr, ok := err.(*github.ErrorResponse); !ok || rerr.Response.StatusCode != http.StatusNotFound {
+		return "", "", errors.Wrapf(err, "failed to check for branch %s", branch)
+	}
+
+	if o.DryRun {
+		return fmt.Sprintf("(dry run) %s into %s", branch, base), "", nil
+	}
+
+	baseRef, _, err := client.Git.GetRef(ctx, owner, repo, "heads/"+base)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to get default branch %s", base)
+	}
+	ref := &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: baseRef.GetObject().SHA},
+	}
+	if _, _, err := client.Git.CreateRef(ctx, owner, repo, ref); err != nil {
+		return "", "", errors.Wrapf(err, "failed to create branch %s", branch)
+	}
+
+	url, err := o.openPullRequest(ctx, client, owner, repo, base, branch)
+	if err != nil {
+		// a branch left behind would skip the repository in later runs
+		if _, derr := client.Git.DeleteRef(ctx, owner, repo, "heads/"+branch); derr != nil {
+			zerolog.Ctx(ctx).Error().Err(derr).Msgf("Failed to delete branch %s of %s/%s", branch, owner, repo)
+		}
+		return "", "", err
+	}
+	return url, "", nil
+}
+
+// openPullRequest adds the configuration file to the new branch and opens the
+// pull request, returning its URL.
+func (o *Onboarding) openPullRequest(ctx context.Context, client *github.Client, owner, repo, base, branch string) (string, error) {
+
+	title := o.Title
+	if title == "" {
+		title = DefaultOnboardingTitle
+	}
+	file := &github.RepositoryContentFileOptions{
+		Message: github.String(title),
+		Content: o.Config,
+		Branch:  github.String(branch),
+	}
+	if _, _, err := client.Repositories.CreateFile(ctx, owner, repo, o.Fetcher.configurationV1Path, file); err != nil {
+		return "", errors.Wrapf(err, "failed to create %s", o.Fetcher.configurationV1Path)
+	}
+
+	pr, _, err := client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title: github.String(title),
+		Head:  github.String(branch),
+		Base:  github.String(base),
+		Body:  github.String(o.Body),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open pull request")
+	}
+	return pr.GetHTMLURL(), nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// onboardingServer is a GitHub API for a repository without a configuration
+// file. It records the branches that are created and deleted.
+type onboardingServer struct {
+	branchExists bool
+	fileStatus   int
+
+	created []string
+	deleted []string
+}
+
+func (s *onboardingServer) client(t *testing.T) *github.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/contents/.bulldozer.yml":
+			http.NotFound(w, r)
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/branches/bulldozer-onboarding":
+			if !s.branchExists {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(`{"name": "bulldozer-onboarding"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/refs/heads/main":
+			_, _ = w.Write([]byte(`{"ref": "refs/heads/main", "object": {"sha": "base"}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/refs":
+			s.created = append(s.created, "bulldozer-onboarding")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/repos/o/r/git/refs/heads/bulldozer-onboarding":
+			s.deleted = append(s.deleted, "bulldozer-onboarding")
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPut && r.URL.Path == "/repos/o/r/contents/.bulldozer.yml":
+			w.WriteHeader(s.fileStatus)
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/pulls":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"html_url": "https://github.com/o/r/pull/1"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+func TestOnboardingRun(t *testing.T) {
+	ctx := context.Background()
+	repositories := []*github.Repository{{
+		Owner:         &github.User{Login: github.String("o")},
+		Name:          github.String("r"),
+		FullName:      github.String("o/r"),
+		DefaultBranch: github.String("main"),
+	}}
+	onboarding := &Onboarding{
+		Fetcher: NewConfigFetcher(".bulldozer.yml", nil),
+		Config:  []byte("version: 1\n"),
+	}
+
+	t.Run("opened", func(t *testing.T) {
+		s := &onboardingServer{fileStatus: http.StatusCreated}
+
+		results := onboarding.Run(ctx, s.client(t), repositories)
+
+		require.Len(t, results, 1)
+		assert.Equal(t, OnboardingResult{Repository: "o/r", PullRequest: "https://github.com/o/r/pull/1"}, results[0])
+		assert.Equal(t, []string{"bulldozer-onboarding"}, s.created)
+		assert.Empty(t, s.deleted)
+	})
+
+	t.Run("branchExists", func(t *testing.T) {
+		s := &onboardingServer{branchExists: true}
+
+		results := onboarding.Run(ctx, s.client(t), repositories)
+
+		require.Len(t, results, 1)
+		assert.Equal(t, "branch bulldozer-onboarding already exists", results[0].Skipped)
+		assert.Empty(t, s.created)
+	})
+
+	t.Run("deletesBranchOnFailure", func(t *testing.T) {
+		s := &onboardingServer{fileStatus: http.StatusInternalServerError}
+
+		results := onboarding.Run(ctx, s.client(t), repositories)
+
+		require.Len(t, results, 1)
+		assert.Contains(t, results[0].Error, "failed to create .bulldozer.yml")
+		assert.Equal(t, []string{"bulldozer-onboarding"}, s.created)
+		assert.Equal(t, []string{"bulldozer-onboarding"}, s.deleted, "the branch is deleted so the next run retries")
+	})
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+// PauseKind identifies what a pause stops bulldozer from doing.
+type PauseKind string
+
+const (
+	PauseKindHold    PauseKind = "hold"
+	PauseKindUpdates PauseKind = "updates"
+)
+
+// pausePrefix is the prefix of the state keys that record pauses
+const pausePrefix = "paused/"
+
+// Pause records that a user stopped bulldozer from merging or updating a
+// pull request. Comments on the pull request decide whether it is paused;
+// pauses are also kept in the state store so that they can be listed.
+type Pause struct {
+	Kind   PauseKind `json:"kind"`
+	Owner  string    `json:"owner"`
+	Repo   string    `json:"repo"`
+	Number int       `json:"number"`
+	User   string    `json:"user"`
+	Since  time.Time `json:"since"`
+}
+
+// pauseKey returns the key of a pause. GitHub owner and repository names are
+// case-insensitive, so keys use lower case.
+func pauseKey(kind PauseKind, owner, repo string, number int) string {
+	return fmt.Sprintf("%s%s/%s/%s#%d", pausePrefix, kind, strings.ToLower(owner), strings.ToLower(repo), number)
+}
+
+// recordPause stores the pause, logging any errors.
+func recordPause(ctx context.Context, pause Pause) {
+	if pause.Since.IsZero() {
+		pause.Since = time.Now().UTC()
+	}
+
+	b, err := json.Marshal(pause)
+	if err == nil {
+		err = state.Ctx(ctx).Set(ctx, pauseKey(pause.Kind, pause.Owner, pause.Repo, pause.Number), b, 0)
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(errors.WithStack(err)).Msg("Failed to record pause")
+	}
+}
+
+// forgetPause removes a stored pause, logging any errors.
+func forgetPause(ctx context.Context, kind PauseKind, owner, repo string, number int) {
+	if err := state.Ctx(ctx).Delete(ctx, pauseKey(kind, owner, repo, number)); err != nil {
+		zerolog.Ctx(ctx).Error().Err(errors.WithStack(err)).Msg("Failed to remove pause")
+	}
+}
+
+// ForgetPauses removes the stored pauses of a pull request that was closed.
+func ForgetPauses(ctx context.Context, owner, repo string, number int) {
+	forgetPause(ctx, PauseKindHold, owner, repo, number)
+	forgetPause(ctx, PauseKindUpdates, owner, repo, number)
+}
+
+// ListPauses returns the stored pauses of all pull requests.
+func ListPauses(ctx context.Context) ([]Pause, error) {
+	store := state.Ctx(ctx)
+
+	keys, err := store.Keys(ctx, pausePrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pauses")
+	}
+
+	var pauses []Pause
+	for _, key := range keys {
+		b, ok, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get pause %q", key)
+		}
+		if !ok {
+			continue
+		}
+
+		var pause Pause
+		if err := json.Unmarshal(b, &pause); err != nil {
+			return nil, errors.Wrapf(err, "invalid pause %q", key)
+		}
+		pauses = append(pauses, pause)
+	}
+	return pauses, nil
+}
+
+// repositoryPausePrefix is the prefix of the state keys that record paused
+// repositories and organizations. It must not start with pausePrefix.
+const repositoryPausePrefix = "paused-repositories/"
+
+// RepositoryPause records that an operator stopped bulldozer from merging
+// and updating pull requests in a repository, or in every repository of an
+// owner if Repo is empty.
+type RepositoryPause struct {
+	Owner  string    `json:"owner"`
+	Repo   string    `json:"repo,omitempty"`
+	User   string    `json:"user"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+func (p RepositoryPause) String() string {
+	if p.Repo == "" {
+		return p.Owner
+	}
+	return p.Owner + "/" + p.Repo
+}
+
+// repositoryPauseKey returns the key of the pause of a repository or owner.
+// GitHub owner and repository names are case-insensitive, so keys use lower
+// case.
+func repositoryPauseKey(owner, repo string) string {
+	if repo == "" {
+		return repositoryPausePrefix + strings.ToLower(owner)
+	}
+	return repositoryPausePrefix + strings.ToLower(owner) + "/" + strings.ToLower(repo)
+}
+
+// PauseRepository stops bulldozer from processing pull requests in the
+// repository, or in every repository of the owner if the repository is
+// empty, until ResumeRepository is called.
+func PauseRepository(ctx context.Context, pause RepositoryPause) error {
+	if pause.Since.IsZero() {
+		pause.Since = time.Now().UTC()
+	}
+
+	b, err := json.Marshal(pause)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal repository pause")
+	}
+	return errors.Wrapf(state.Ctx(ctx).Set(ctx, repositoryPauseKey(pause.Owner, pause.Repo), b, 0), "failed to pause %s", pause)
+}
+
+// ResumeRepository removes the pause of the repository, or of the owner if
+// the repository is empty. Pauses of an owner and its repositories are
+// independent.
+func ResumeRepository(ctx context.Context, owner, repo string) error {
+	return errors.Wrapf(state.Ctx(ctx).Delete(ctx, repositoryPauseKey(owner, repo)), "failed to resume %s", RepositoryPause{Owner: owner, Repo: repo})
+}
+
+// RepositoryPaused returns the pause that stops bulldozer from processing
+// pull requests in the repository, either of the repository itself or of its
+// owner, or nil if it is not paused.
+func RepositoryPaused(ctx context.Context, owner, repo string) (*RepositoryPause, error) {
+	store := state.Ctx(ctx)
+
+	for _, key := range []string{repositoryPauseKey(owner, repo), repositoryPauseKey(owner, "")} {
+		b, ok, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get repository pause %q", key)
+		}
+		if !ok {
+			continue
+		}
+
+		var pause RepositoryPause
+		if err := json.Unmarshal(b, &pause); err != nil {
+			return nil, errors.Wrapf(err, "invalid repository pause %q", key)
+		}
+		return &pause, nil
+	}
+	return nil, nil
+}
+
+// ListRepositoryPauses returns the paused repositories and owners.
+func ListRepositoryPauses(ctx context.Context) ([]RepositoryPause, error) {
+	store := state.Ctx(ctx)
+
+	keys, err := store.Keys(ctx, repositoryPausePrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list repository pauses")
+	}
+
+	var pauses []RepositoryPause
+	for _, key := range keys {
+		b, ok, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get repository pause %q", key)
+		}
+		if !ok {
+			continue
+		}
+
+		var pause RepositoryPause
+		if err := json.Unmarshal(b, &pause); err != nil {
+			return nil, errors.Wrapf(err, "invalid repository pause %q", key)
+		}
+		pauses = append(pauses, pause)
+	}
+	return pauses, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+func TestRepositoryPause(t *testing.T) {
+	ctx := state.WithStore(context.Background(), state.NewMemoryStore())
+
+	pause, err := RepositoryPaused(ctx, "owner", "repo")
+	require.NoError(t, err)
+	assert.Nil(t, pause)
+
+	require.NoError(t, PauseRepository(ctx, RepositoryPause{Owner: "owner", Repo: "repo", User: "admin"}))
+	pause, err = RepositoryPaused(ctx, "owner", "repo")
+	require.NoError(t, err)
+	require.NotNil(t, pause)
+	assert.Equal(t, "owner/repo", pause.String())
+
+	pause, err = RepositoryPaused(ctx, "Owner", "Repo")
+	require.NoError(t, err)
+	assert.NotNil(t, pause, "names are case-insensitive")
+
+	pause, err = RepositoryPaused(ctx, "owner", "other")
+	require.NoError(t, err)
+	assert.Nil(t, pause, "other repositories of the owner are not paused")
+
+	require.NoError(t, PauseRepository(ctx, RepositoryPause{Owner: "OWNER", User: "admin"}))
+	pause, err = RepositoryPaused(ctx, "owner", "other")
+	require.NoError(t, err)
+	require.NotNil(t, pause, "pausing the owner pauses all of its repositories")
+	assert.Equal(t, "OWNER", pause.String())
+
+	pauses, err := ListRepositoryPauses(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pauses, 2)
+
+	require.NoError(t, ResumeRepository(ctx, "owner", ""))
+	pause, err = RepositoryPaused(ctx, "owner", "repo")
+	require.NoError(t, err)
+	assert.NotNil(t, pause, "resuming the owner keeps repository pauses")
+
+	require.NoError(t, ResumeRepository(ctx, "owner", "repo"))
+	pause, err = RepositoryPaused(ctx, "owner", "repo")
+	require.NoError(t, err)
+	assert.Nil(t, pause)
+
+	paused, err := ListPauses(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, paused, "repository pauses are not pull request pauses")
+}
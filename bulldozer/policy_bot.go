@@ -0,0 +1,109 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// DefaultPolicyBotContext is the prefix of the status context that
+// policy-bot posts when its "status_check_context" option is not set.
+const DefaultPolicyBotContext = "policy-bot"
+
+// DefaultPolicyBotLogin is the login of the policy-bot GitHub App hosted as
+// "policy-bot".
+const DefaultPolicyBotLogin = "policy-bot[bot]"
+
+// PolicyBotConfig makes the status of policy-bot
+// (https://github.com/palantir/policy-bot) the authoritative approval signal
+// for a repository.
+type PolicyBotConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Context is the prefix of policy-bot's status context, which is
+	// followed by ": " and the base branch. If empty,
+	// DefaultPolicyBotContext is used.
+	Context string `yaml:"context"`
+
+	// Login is the login of the user or app that posts policy-bot's
+	// statuses, with the "[bot]" suffix for apps. Statuses with the context
+	// posted by anyone else are ignored. If empty, DefaultPolicyBotLogin is
+	// used.
+	Login string `yaml:"login"`
+}
+
+func (c PolicyBotConfig) context() string {
+	if c.Context == "" {
+		return DefaultPolicyBotContext
+	}
+	return c.Context
+}
+
+func (c PolicyBotConfig) login() string {
+	if c.Login == "" {
+		return DefaultPolicyBotLogin
+	}
+	return c.Login
+}
+
+// StatusName returns the name of the status policy-bot posts for pull
+// requests to the base branch.
+func (c PolicyBotConfig) StatusName(base string) string {
+	return c.context() + ": " + base
+}
+
+// IsStatus returns true if the status has the context of policy-bot for any
+// base branch.
+func (c PolicyBotConfig) IsStatus(name string) bool {
+	return strings.HasPrefix(name, c.context()+": ")
+}
+
+// policyBotApproval returns why policy-bot has not approved the pull request,
+// using the description of its status, or an empty string if it approved.
+// Statuses with policy-bot's context that were not posted by policy-bot are
+// treated as missing.
+func policyBotApproval(ctx context.Context, pullCtx pull.Context, config PolicyBotConfig) (string, error) {
+	base, _, err := pullCtx.Branches(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine base branch")
+	}
+	name := config.StatusName(base)
+
+	statuses, err := pullCtx.Statuses(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine status checks")
+	}
+
+	status, ok := statuses[name]
+	switch {
+	case !ok:
+		return "policy-bot: no status yet", nil
+	case !strings.EqualFold(status.Creator, config.login()):
+		zerolog.Ctx(ctx).Warn().Msgf("Ignoring status %q posted by %q instead of %q", name, status.Creator, config.login())
+		return "policy-bot: no status from " + config.login(), nil
+	case status.State == "success":
+		return "", nil
+	case status.Description != "":
+		return "policy-bot: " + status.Description, nil
+	default:
+		return "policy-bot: " + status.State, nil
+	}
+}
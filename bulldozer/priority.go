@@ -0,0 +1,75 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"sort"
+
+	"github.com/google/go-github/github"
+)
+
+// SortForUpdate sorts pull requests in the order they should be updated.
+// queuePositions maps the numbers of pull requests in the merge queue to their
+// zero-based positions.
+//
+// With the "oldest" order, pull requests are sorted by number. Otherwise, pull
+// requests with priority labels come first, ordered by the first matching
+// label in the configuration, followed by queued pull requests in queue order,
+// followed by all others by number.
+func SortForUpdate(prs []*github.PullRequest, queuePositions map[int]int, updateConfig UpdateConfig) {
+	if updateConfig.Order == UpdateOrderOldest {
+		sort.SliceStable(prs, func(i, j int) bool {
+			return prs[i].GetNumber() < prs[j].GetNumber()
+		})
+		return
+	}
+
+	type rank struct {
+		label    int
+		position int
+		number   int
+	}
+
+	ranks := make(map[int]rank, len(prs))
+	for _, pr := range prs {
+		r := rank{
+			label:    len(updateConfig.PriorityLabels),
+			position: len(prs),
+			number:   pr.GetNumber(),
+		}
+		for i, label := range updateConfig.PriorityLabels {
+			if hasLabel(pr, label) {
+				r.label = i
+				break
+			}
+		}
+		if position, ok := queuePositions[pr.GetNumber()]; ok {
+			r.position = position
+		}
+		ranks[pr.GetNumber()] = r
+	}
+
+	sort.SliceStable(prs, func(i, j int) bool {
+		ri, rj := ranks[prs[i].GetNumber()], ranks[prs[j].GetNumber()]
+		switch {
+		case ri.label != rj.label:
+			return ri.label < rj.label
+		case ri.position != rj.position:
+			return ri.position < rj.position
+		default:
+			return ri.number < rj.number
+		}
+	})
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/scm"
+	"github.com/palantir/bulldozer/state"
+)
+
+// mergeFailurePrefix is the prefix of the state keys that remember the last
+// merge failure of each pull request of a provider, so that repeated
+// failures are only commented on once
+const mergeFailurePrefix = "provider-merge-failures/"
+
+// mergeFailureTTL forgets the failures of inactive pull requests
+const mergeFailureTTL = 7 * 24 * time.Hour
+
+// ProcessProviderPR evaluates a pull request of any provider with the
+// configuration on its base branch, then merges it if it is eligible or
+// updates it if the update configuration allows it. Unlike the GitHub
+// handlers, it supports the requirements of the merge configuration and the
+// merge method, message, and branch deletion settings, but not merge queues,
+// signed commits, or actions after merging. Requirements that need features
+// the provider does not support block the merge, and updates with an
+// unsupported method are skipped.
+func ProcessProviderPR(ctx context.Context, provider scm.Provider, fetcher ConfigFetcher, owner, repo string, number int) error {
+	logger := zerolog.Ctx(ctx)
+
+	// comment commands are only supported on GitHub, so no comments on
+	// other providers can record holds or paused updates
+	ctx = WithBotLogin(ctx, "")
+
+	pullCtx, err := provider.PullContext(ctx, owner, repo, number)
+	if err != nil {
+		return err
+	}
+	base, _, err := pullCtx.Branches(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to determine branches")
+	}
+
+	fc, err := fetcher.ConfigFromProvider(ctx, provider, owner, repo, base)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch configuration")
+	}
+	switch {
+	case fc.Missing():
+		logger.Debug().Msgf("No bulldozer configuration for %q", fc.String())
+		return nil
+	case fc.Invalid():
+		logger.Debug().Err(fc.Error).Msgf("Bulldozer configuration is invalid for %q", fc.String())
+		return nil
+	}
+	config := *fc.Config
+
+	decision, err := EvaluatePR(ctx, pullCtx, config.Merge)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine merge status")
+	}
+	for _, setting := range unsupportedRequirements(provider, config.Merge) {
+		decision.block(fmt.Sprintf("%s is not supported on %s", setting, provider.Name()))
+		decision.Eligible = false
+	}
+	RecordDecision(ctx, pullCtx, audit.TypeMergeDecision, decision, config.Merge)
+	if decision.Eligible {
+		return mergeWithProvider(ctx, provider, pullCtx, config.Merge)
+	}
+
+	update, err := EvaluateUpdate(ctx, pullCtx, config.Update, config.Merge)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine update status")
+	}
+	RecordDecision(ctx, pullCtx, audit.TypeUpdateDecision, update, config.Update)
+	if update.Eligible {
+		method, feature := scm.UpdateMerge, scm.FeatureUpdateMerge
+		if config.Update.Method == UpdateRebase {
+			method, feature = scm.UpdateRebase, scm.FeatureUpdateRebase
+		}
+		if !provider.Supports(feature) {
+			logger.Warn().Msgf("Not updating %q because update method %q is not supported on %s", pullCtx.Locator(), method, provider.Name())
+			return nil
+		}
+
+		event := updateEvent(pullCtx, config.Update, TriggerProviderEvent)
+		updated, err := provider.Update(ctx, owner, repo, number, method)
+		switch {
+		case err != nil:
+			event.Result = audit.ResultFailed
+			event.Detail = err.Error()
+		case updated:
+			event.Result = audit.ResultUpdated
+		default:
+			return nil
+		}
+		audit.Record(ctx, event)
+		return err
+	}
+	return nil
+}
+
+// unsupportedRequirements returns the settings of the merge configuration
+// that require features the provider does not support. Pull requests are
+// not merged while these settings are used, because the provider cannot
+// enforce them.
+func unsupportedRequirements(provider scm.Provider, mergeConfig MergeConfig) []string {
+	var settings []string
+	if len(mergeConfig.RequiredDeployments) > 0 && !provider.Supports(scm.FeatureDeployments) {
+		settings = append(settings, "required_deployments")
+	}
+	if mergeConfig.StaleApprovals == BlockStaleApprovals && !provider.Supports(scm.FeatureStaleApprovals) {
+		settings = append(settings, "stale_approvals")
+	}
+	if mergeConfig.Method == FastForwardOnly && !provider.Supports(scm.FeatureFastForward) {
+		settings = append(settings, "method: fast_forward")
+	}
+	return settings
+}
+
+// mergeWithProvider merges an eligible pull request with the method and
+// message of the merge configuration.
+func mergeWithProvider(ctx context.Context, provider scm.Provider, pullCtx pull.Context, mergeConfig MergeConfig) error {
+	logger := zerolog.Ctx(ctx)
+
+	options := scm.MergeOptions{
+		Method:     scm.MergeCommit,
+		SHA:        pullCtx.HeadSHA(),
+		DeleteHead: mergeConfig.DeleteAfterMerge,
+	}
+	switch mergeConfig.Method {
+	case SquashAndMerge:
+		options.Method = scm.Squash
+	case RebaseAndMerge:
+		options.Method = scm.Rebase
+	case FastForwardOnly:
+		options.Method = scm.FastForward
+	}
+	event := mergeEvent(ctx, pullCtx, mergeConfig, MergeMethod(options.Method))
+
+	if mergeConfig.Method == SquashAndMerge {
+		opt, ok := mergeConfig.Options[SquashAndMerge]
+		if !ok {
+			opt = MergeOption{Body: EmptyBody}
+		}
+
+		title, valid, err := squashTitle(ctx, pullCtx, opt)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine squash commit title")
+		}
+		if !valid {
+			logger.Info().Msgf("Not merging %q because squash commit title %q does not match pattern %q", pullCtx.Locator(), title, opt.TitlePattern)
+			event.Result = audit.ResultRejected
+			event.Detail = fmt.Sprintf("title %q does not match pattern %q", title, opt.TitlePattern)
+			audit.Record(ctx, event)
+			return nil
+		}
+		options.Title = title
+
+		if opt.Body == PullRequestBody {
+			body, err := pullCtx.Body(ctx)
+			if err != nil {
+				return errors.Wrap(err, "failed to determine pull request body")
+			}
+			if options.Message, err = formatPullRequestBody(body, opt); err != nil {
+				return errors.Wrap(err, "failed to format pull request body")
+			}
+		}
+	}
+
+	if mergeConfig.Trailers.Enabled() && options.Method != scm.Rebase && options.Method != scm.FastForward {
+		trailers, err := commitTrailers(ctx, pullCtx, mergeConfig.Trailers)
+		if err != nil {
+			return errors.Wrap(err, "failed to determine commit message trailers")
+		}
+		if options.Title == "" {
+			if options.Title, err = pullCtx.Title(ctx); err != nil {
+				return errors.Wrap(err, "failed to determine pull request title")
+			}
+		}
+		options.Message = AppendTrailers(options.Message, trailers)
+	}
+
+	if mergeConfig.DryRun {
+		logger.Info().Msgf("Dry run enabled, not merging %q with method %s", pullCtx.Locator(), options.Method)
+		event.Result = audit.ResultDryRun
+		audit.Record(ctx, event)
+		return nil
+	}
+
+	sha, err := provider.Merge(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number(), options)
+	if err != nil {
+		event.Result = audit.ResultFailed
+		event.Detail = err.Error()
+		audit.Record(ctx, event)
+		commentOnMergeFailure(ctx, provider, pullCtx, err)
+		return err
+	}
+
+	logger.Info().Msgf("Successfully merged %q as %s", pullCtx.Locator(), sha)
+	event.Result = audit.ResultMerged
+	event.MergeSHA = sha
+	audit.Record(ctx, event)
+	return nil
+}
+
+// commentOnMergeFailure tells the author of the pull request that it could
+// not be merged, unless the last failure had the same error.
+func commentOnMergeFailure(ctx context.Context, provider scm.Provider, pullCtx pull.Context, mergeErr error) {
+	logger := zerolog.Ctx(ctx)
+	store := state.Ctx(ctx)
+
+	key := fmt.Sprintf("%s%s/%s#%d", mergeFailurePrefix, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+	marker := mergeErr.Error()
+	if last, ok, err := store.Get(ctx, key); err != nil || (ok && string(last) == marker) {
+		return
+	}
+
+	body := fmt.Sprintf("bulldozer could not merge this pull request: %s", mergeErr)
+	if err := provider.Comment(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number(), body); err != nil {
+		logger.Warn().Err(err).Msg("Failed to comment on failed merge")
+		return
+	}
+	if err := store.Set(ctx, key, []byte(marker), mergeFailureTTL); err != nil {
+		logger.Warn().Err(err).Msg("Failed to record comment on failed merge")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/pull/pulltest"
+	"github.com/palantir/bulldozer/scm"
+)
+
+// testProvider records merges and supports the features in its set
+type testProvider struct {
+	features map[scm.Feature]bool
+	merged   []scm.MergeOptions
+}
+
+func (p *testProvider) Name() string {
+	return "test"
+}
+
+func (p *testProvider) FileContents(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+	return nil, nil
+}
+
+func (p *testProvider) Supports(feature scm.Feature) bool {
+	return p.features[feature]
+}
+
+func (p *testProvider) PullContext(ctx context.Context, owner, repo string, number int) (pull.Context, error) {
+	return nil, nil
+}
+
+func (p *testProvider) Merge(ctx context.Context, owner, repo string, number int, options scm.MergeOptions) (string, error) {
+	p.merged = append(p.merged, options)
+	return "merged", nil
+}
+
+func (p *testProvider) Update(ctx context.Context, owner, repo string, number int, method string) (bool, error) {
+	return false, nil
+}
+
+func (p *testProvider) Comment(ctx context.Context, owner, repo string, number int, body string) error {
+	return nil
+}
+
+func TestMergeWithProvider(t *testing.T) {
+	ctx := context.Background()
+	pullCtx := &pulltest.MockPullContext{
+		OwnerValue:   "org",
+		RepoValue:    "repo",
+		NumberValue:  3,
+		HeadSHAValue: "abc123",
+	}
+
+	t.Run("expectsEvaluatedHead", func(t *testing.T) {
+		provider := &testProvider{}
+		err := mergeWithProvider(ctx, provider, pullCtx, MergeConfig{Method: MergeCommit})
+
+		require.Nil(t, err)
+		require.Len(t, provider.merged, 1)
+		assert.Equal(t, "abc123", provider.merged[0].SHA)
+		assert.Equal(t, scm.MergeCommit, provider.merged[0].Method)
+	})
+
+	t.Run("fastForward", func(t *testing.T) {
+		provider := &testProvider{}
+		err := mergeWithProvider(ctx, provider, pullCtx, MergeConfig{Method: FastForwardOnly})
+
+		require.Nil(t, err)
+		require.Len(t, provider.merged, 1)
+		assert.Equal(t, scm.FastForward, provider.merged[0].Method)
+	})
+}
+
+func TestUnsupportedRequirements(t *testing.T) {
+	mergeConfig := MergeConfig{Method: FastForwardOnly}
+
+	settings := unsupportedRequirements(&testProvider{}, mergeConfig)
+	assert.Equal(t, []string{"method: fast_forward"}, settings)
+
+	settings = unsupportedRequirements(&testProvider{features: map[scm.Feature]bool{scm.FeatureFastForward: true}}, mergeConfig)
+	assert.Empty(t, settings)
+}
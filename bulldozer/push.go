@@ -0,0 +1,77 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/state"
+)
+
+// pushPrefix is the prefix of the state keys that record when commits were
+// pushed
+const pushPrefix = "pushes/"
+
+// pushTTL is how long push times are kept. Pull requests whose head was
+// pushed before this fall back to the committer date of the head commit.
+const pushTTL = 30 * 24 * time.Hour
+
+func pushKey(owner, repo, sha string) string {
+	return fmt.Sprintf("%s%s/%s/%s", pushPrefix, owner, repo, sha)
+}
+
+// RecordPush stores the time at which the head of a pull request was pushed,
+// as reported by a webhook, logging any errors. Commits carry only the dates
+// set by their authors, so this is the only reliable source of push times.
+func RecordPush(ctx context.Context, owner, repo, sha string, pushedAt time.Time) {
+	if sha == "" {
+		return
+	}
+	if pushedAt.IsZero() {
+		pushedAt = time.Now()
+	}
+
+	b, err := pushedAt.UTC().MarshalText()
+	if err == nil {
+		err = state.Ctx(ctx).Set(ctx, pushKey(owner, repo, sha), b, pushTTL)
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(errors.WithStack(err)).Msg("Failed to record push time")
+	}
+}
+
+// HeadPushedAt returns the time at which the head of the pull request was
+// pushed. If no push was recorded, for example because the pull request was
+// opened with its current head or the push predates bulldozer, it returns the
+// committer date of the head commit.
+func HeadPushedAt(ctx context.Context, pullCtx pull.Context) (time.Time, error) {
+	b, ok, err := state.Ctx(ctx).Get(ctx, pushKey(pullCtx.Owner(), pullCtx.Repo(), pullCtx.HeadSHA()))
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to get push time")
+	}
+	if ok {
+		var pushedAt time.Time
+		if err := pushedAt.UnmarshalText(b); err == nil {
+			return pushedAt, nil
+		}
+	}
+	return pullCtx.HeadCommittedAt(ctx)
+}
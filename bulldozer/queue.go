@@ -0,0 +1,235 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// QueueCheckName is the name of the check run that shows the position of a
+// pull request in the merge queue.
+const QueueCheckName = "bulldozer/queue"
+
+// QueueEntry is a pull request waiting in a merge queue.
+type QueueEntry struct {
+	Number     int
+	HeadSHA    string
+	HeadRef    string
+	EnqueuedAt time.Time
+}
+
+// MergeQueue serializes merges of pull requests with the same base branch.
+// Only the pull request at the head of a queue is merged; others wait until
+// the pull requests ahead of them leave the queue. It is safe for concurrent
+// use.
+//
+// Queues are kept in the memory of a single server. They are not shared with
+// other servers that use the same state store and are lost on restart, so
+// run a single server when merge queues are enabled; queued pull requests
+// rejoin their queue the next time they are evaluated.
+type MergeQueue struct {
+	lock sync.Mutex
+
+	queues map[string][]QueueEntry
+
+	// headSince is the time the current head of each queue reached the head
+	headSince map[string]time.Time
+
+	// headDuration is a moving average of the time pull requests spend at
+	// the head of each queue, used to estimate waiting times
+	headDuration map[string]time.Duration
+}
+
+func NewMergeQueue() *MergeQueue {
+	return &MergeQueue{
+		queues:       make(map[string][]QueueEntry),
+		headSince:    make(map[string]time.Time),
+		headDuration: make(map[string]time.Duration),
+	}
+}
+
+// QueueKey returns the key of the queue for a base branch.
+func QueueKey(owner, repo, base string) string {
+	return fmt.Sprintf("%s/%s:%s", owner, repo, base)
+}
+
+// Add adds the pull request to the end of the queue if it is not already
+// queued and returns its zero-based position. If the pull request is already
+// queued, its head is updated.
+func (q *MergeQueue) Add(key string, entry QueueEntry) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	entries := q.queues[key]
+	for i, e := range entries {
+		if e.Number == entry.Number {
+			entries[i].HeadSHA = entry.HeadSHA
+			entries[i].HeadRef = entry.HeadRef
+			return i
+		}
+	}
+
+	if entry.EnqueuedAt.IsZero() {
+		entry.EnqueuedAt = time.Now()
+	}
+	if len(entries) == 0 {
+		q.headSince[key] = time.Now()
+	}
+	q.queues[key] = append(entries, entry)
+	return len(entries)
+}
+
+// Remove removes the pull request from the queue, returning the removed entry,
+// its zero-based position before it was removed, and true if it was queued.
+func (q *MergeQueue) Remove(key string, number int) (QueueEntry, int, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	entries := q.queues[key]
+	for i, e := range entries {
+		if e.Number != number {
+			continue
+		}
+
+		if i == 0 {
+			d := time.Since(q.headSince[key])
+			if avg := q.headDuration[key]; avg > 0 {
+				d = (3*avg + d) / 4
+			}
+			q.headDuration[key] = d
+			q.headSince[key] = time.Now()
+		}
+
+		entries = append(entries[:i:i], entries[i+1:]...)
+		if len(entries) == 0 {
+			delete(q.queues, key)
+			delete(q.headSince, key)
+		} else {
+			q.queues[key] = entries
+		}
+		return e, i, true
+	}
+	return QueueEntry{}, -1, false
+}
+
+// Move moves the pull request to the zero-based position in the queue,
+// returning its new position and true if it was queued. Positions past the
+// end of the queue move the pull request to the end.
+func (q *MergeQueue) Move(key string, number, position int) (int, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	entries := q.queues[key]
+	for i, e := range entries {
+		if e.Number != number {
+			continue
+		}
+
+		if position < 0 {
+			position = 0
+		}
+		if position > len(entries)-1 {
+			position = len(entries) - 1
+		}
+		if position == i {
+			return i, true
+		}
+
+		entries = append(entries[:i:i], entries[i+1:]...)
+		entries = append(entries[:position:position], append([]QueueEntry{e}, entries[position:]...)...)
+		q.queues[key] = entries
+		if i == 0 || position == 0 {
+			q.headSince[key] = time.Now()
+		}
+		return position, true
+	}
+	return 0, false
+}
+
+// Entries returns a copy of the entries in the queue, head first.
+func (q *MergeQueue) Entries(key string) []QueueEntry {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return append([]QueueEntry(nil), q.queues[key]...)
+}
+
+// Keys returns the keys of all non-empty queues.
+func (q *MergeQueue) Keys() []string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	keys := make([]string, 0, len(q.queues))
+	for key := range q.queues {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// EstimatedWait returns the estimated time until the pull request at the
+// position reaches the head of the queue, or zero if there is not enough
+// history to make an estimate.
+func (q *MergeQueue) EstimatedWait(key string, position int) time.Duration {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	avg := q.headDuration[key]
+	if avg == 0 || position == 0 {
+		return 0
+	}
+
+	wait := time.Duration(position)*avg - time.Since(q.headSince[key])
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// PublishQueuePosition updates the queue check run of the entry at the
+// position in the queue entries.
+func PublishQueuePosition(ctx context.Context, client *github.Client, owner, repo string, entries []QueueEntry, position int, wait time.Duration) error {
+	entry := entries[position]
+
+	status := CheckRunStatus{Status: "queued"}
+	if position == 0 {
+		status.Status = "in_progress"
+		status.Title = "Merging"
+		status.Summary = "This pull request is at the head of the merge queue and is being merged."
+	} else {
+		estimate := "unknown"
+		if wait > 0 {
+			estimate = fmt.Sprintf("about %s", wait.Round(time.Minute))
+		}
+		status.Title = fmt.Sprintf("Position %d in the merge queue", position+1)
+		status.Summary = fmt.Sprintf("Waiting for #%d to merge. There are %d pull requests ahead of this one.\n\nEstimated wait: %s", entries[position-1].Number, position, estimate)
+	}
+
+	return upsertCheckRun(ctx, client, owner, repo, entry.HeadSHA, entry.HeadRef, QueueCheckName, status)
+}
+
+// CompleteQueueCheck completes the queue check run of an entry that left the
+// queue.
+func CompleteQueueCheck(ctx context.Context, client *github.Client, owner, repo string, entry QueueEntry, conclusion, summary string) error {
+	return upsertCheckRun(ctx, client, owner, repo, entry.HeadSHA, entry.HeadRef, QueueCheckName, CheckRunStatus{
+		Conclusion: conclusion,
+		Title:      "Left the merge queue",
+		Summary:    summary,
+	})
+}
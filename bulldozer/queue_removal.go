@@ -0,0 +1,96 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+// queueRemovalPrefix is the prefix of the state keys that record pull
+// requests removed from merge queues
+const queueRemovalPrefix = "queue-removals/"
+
+// QueueRemoval records that an operator removed a pull request from a merge
+// queue. The pull request is not queued or merged again until its head
+// changes, so it does not rejoin the queue on its next event.
+type QueueRemoval struct {
+	Owner   string    `json:"owner"`
+	Repo    string    `json:"repo"`
+	Number  int       `json:"number"`
+	HeadSHA string    `json:"head_sha"`
+	User    string    `json:"user"`
+	Reason  string    `json:"reason,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+func queueRemovalKey(owner, repo string, number int) string {
+	return fmt.Sprintf("%s%s/%s#%d", queueRemovalPrefix, owner, repo, number)
+}
+
+// RecordQueueRemoval stores the removal.
+func RecordQueueRemoval(ctx context.Context, removal QueueRemoval) error {
+	if removal.Since.IsZero() {
+		removal.Since = time.Now().UTC()
+	}
+
+	b, err := json.Marshal(removal)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal queue removal")
+	}
+	key := queueRemovalKey(removal.Owner, removal.Repo, removal.Number)
+	return errors.Wrapf(state.Ctx(ctx).Set(ctx, key, b, 0), "failed to record removal of %s/%s#%d", removal.Owner, removal.Repo, removal.Number)
+}
+
+// QueueRemoved returns the removal of the pull request from its merge queue
+// if it was removed at the head SHA, or nil otherwise. Removals at a
+// different head SHA are forgotten.
+func QueueRemoved(ctx context.Context, owner, repo string, number int, headSHA string) (*QueueRemoval, error) {
+	store := state.Ctx(ctx)
+	key := queueRemovalKey(owner, repo, number)
+
+	b, ok, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get queue removal %q", key)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	var removal QueueRemoval
+	if err := json.Unmarshal(b, &removal); err != nil {
+		return nil, errors.Wrapf(err, "invalid queue removal %q", key)
+	}
+	if removal.HeadSHA != headSHA {
+		ForgetQueueRemoval(ctx, owner, repo, number)
+		return nil, nil
+	}
+	return &removal, nil
+}
+
+// ForgetQueueRemoval removes the stored removal of a pull request, logging
+// any errors.
+func ForgetQueueRemoval(ctx context.Context, owner, repo string, number int) {
+	if err := state.Ctx(ctx).Delete(ctx, queueRemovalKey(owner, repo, number)); err != nil {
+		zerolog.Ctx(ctx).Error().Err(errors.WithStack(err)).Msg("Failed to remove queue removal")
+	}
+}
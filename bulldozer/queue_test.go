@@ -0,0 +1,147 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+func TestMergeQueue(t *testing.T) {
+	q := NewMergeQueue()
+	key := QueueKey("owner", "repo", "develop")
+
+	assert.Equal(t, 0, q.Add(key, QueueEntry{Number: 1, HeadSHA: "a"}))
+	assert.Equal(t, 1, q.Add(key, QueueEntry{Number: 2, HeadSHA: "b"}))
+	assert.Equal(t, 2, q.Add(key, QueueEntry{Number: 3, HeadSHA: "c"}))
+
+	assert.Equal(t, 1, q.Add(key, QueueEntry{Number: 2, HeadSHA: "b2"}), "re-adding keeps the position")
+	assert.Equal(t, "b2", q.Entries(key)[1].HeadSHA, "re-adding updates the head")
+
+	assert.Zero(t, q.EstimatedWait(key, 1), "no estimate without history")
+
+	_, _, ok := q.Remove(key, 4)
+	assert.False(t, ok)
+
+	entry, position, ok := q.Remove(key, 1)
+	assert.True(t, ok)
+	assert.Equal(t, 1, entry.Number)
+	assert.Equal(t, 0, position)
+
+	_, position, ok = q.Remove(key, 3)
+	assert.True(t, ok)
+	assert.Equal(t, 1, position)
+	q.Add(key, QueueEntry{Number: 3, HeadSHA: "c"})
+
+	var numbers []int
+	for _, e := range q.Entries(key) {
+		numbers = append(numbers, e.Number)
+	}
+	assert.Equal(t, []int{2, 3}, numbers)
+
+	q.Remove(key, 2)
+	q.Remove(key, 3)
+	assert.Empty(t, q.Entries(key))
+	assert.Empty(t, q.Keys())
+}
+
+func TestMergeQueueMove(t *testing.T) {
+	q := NewMergeQueue()
+	key := QueueKey("owner", "repo", "develop")
+	for i := 1; i <= 4; i++ {
+		q.Add(key, QueueEntry{Number: i})
+	}
+
+	numbers := func() []int {
+		var numbers []int
+		for _, e := range q.Entries(key) {
+			numbers = append(numbers, e.Number)
+		}
+		return numbers
+	}
+
+	_, ok := q.Move(key, 5, 0)
+	assert.False(t, ok)
+
+	position, ok := q.Move(key, 3, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 0, position)
+	assert.Equal(t, []int{3, 1, 2, 4}, numbers())
+
+	position, _ = q.Move(key, 3, 2)
+	assert.Equal(t, 2, position)
+	assert.Equal(t, []int{1, 2, 3, 4}, numbers())
+
+	position, _ = q.Move(key, 1, 10)
+	assert.Equal(t, 3, position, "positions past the end move to the end")
+	assert.Equal(t, []int{2, 3, 4, 1}, numbers())
+
+	position, _ = q.Move(key, 4, -1)
+	assert.Equal(t, 0, position)
+	assert.Equal(t, []int{4, 2, 3, 1}, numbers())
+}
+
+func TestQueueRemoval(t *testing.T) {
+	ctx := state.WithStore(context.Background(), state.NewMemoryStore())
+
+	removal, err := QueueRemoved(ctx, "owner", "repo", 1, "a")
+	require.NoError(t, err)
+	assert.Nil(t, removal)
+
+	require.NoError(t, RecordQueueRemoval(ctx, QueueRemoval{Owner: "owner", Repo: "repo", Number: 1, HeadSHA: "a", User: "admin"}))
+
+	removal, err = QueueRemoved(ctx, "owner", "repo", 1, "a")
+	require.NoError(t, err)
+	require.NotNil(t, removal)
+	assert.Equal(t, "admin", removal.User)
+
+	removal, err = QueueRemoved(ctx, "owner", "repo", 1, "b")
+	require.NoError(t, err)
+	assert.Nil(t, removal, "a new head ends the removal")
+
+	removal, err = QueueRemoved(ctx, "owner", "repo", 1, "a")
+	require.NoError(t, err)
+	assert.Nil(t, removal, "ended removals are forgotten")
+}
+
+func TestMergeQueueConcurrentRemove(t *testing.T) {
+	q := NewMergeQueue()
+	key := QueueKey("owner", "repo", "develop")
+	q.Add(key, QueueEntry{Number: 1})
+	q.Add(key, QueueEntry{Number: 2})
+
+	var wg sync.WaitGroup
+	var heads int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, position, ok := q.Remove(key, 1); ok && position == 0 {
+				atomic.AddInt32(&heads, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), heads, "only one removal may advance the queue")
+	assert.Len(t, q.Entries(key), 1)
+}
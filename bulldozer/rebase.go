@@ -0,0 +1,239 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// rebaseConflictError is returned when a commit of the pull request cannot be
+// applied to the base branch without conflicts.
+type rebaseConflictError struct {
+	sha string
+}
+
+func (e rebaseConflictError) Error() string {
+	return fmt.Sprintf("commit %s conflicts with the base branch", e.sha)
+}
+
+// rebaseStep applies one commit of the pull request during a rebase.
+type rebaseStep struct {
+	commit *github.RepositoryCommit
+
+	// fold combines the commit with the previous step instead of creating a
+	// separate commit
+	fold bool
+
+	// message is the message of the resulting commit
+	message string
+}
+
+// planRebase returns the steps to rebase the commits, in order. If autosquash
+// is true, commits with "fixup!" or "squash!" subjects are moved after the
+// commit they refer to and folded into it, like "git rebase --autosquash".
+func planRebase(commits []*github.RepositoryCommit, autosquash bool) []rebaseStep {
+	steps := make([]rebaseStep, 0, len(commits))
+	if !autosquash {
+		for _, c := range commits {
+			steps = append(steps, rebaseStep{commit: c, message: c.GetCommit().GetMessage()})
+		}
+		return steps
+	}
+
+	// folded commits are attached to the index of their target
+	targets := make(map[int][]*github.RepositoryCommit)
+	var order []int
+	for i, c := range commits {
+		kind, subject := autosquashSubject(c.GetCommit().GetMessage())
+		if kind != "" {
+			if target := findAutosquashTarget(commits[:i], subject); target >= 0 {
+				targets[target] = append(targets[target], c)
+				continue
+			}
+		}
+		order = append(order, i)
+	}
+
+	for _, i := range order {
+		message := commits[i].GetCommit().GetMessage()
+		steps = append(steps, rebaseStep{commit: commits[i], message: message})
+
+		for _, c := range targets[i] {
+			kind, _ := autosquashSubject(c.GetCommit().GetMessage())
+			if kind == "squash" {
+				if body := messageBody(c.GetCommit().GetMessage()); body != "" {
+					message = strings.TrimRight(message, "\n") + "\n\n" + body
+				}
+			}
+			steps = append(steps, rebaseStep{commit: c, fold: true, message: message})
+		}
+	}
+	return steps
+}
+
+// autosquashSubject returns "fixup" or "squash" and the subject the message
+// refers to, or empty strings if the message is not a fixup or squash
+// message. Repeated prefixes are removed.
+func autosquashSubject(message string) (string, string) {
+	subject := strings.SplitN(message, "\n", 2)[0]
+
+	kind := ""
+	for {
+		switch {
+		case strings.HasPrefix(subject, "fixup! "):
+			if kind == "" {
+				kind = "fixup"
+			}
+			subject = strings.TrimPrefix(subject, "fixup! ")
+		case strings.HasPrefix(subject, "squash! "):
+			if kind == "" {
+				kind = "squash"
+			}
+			subject = strings.TrimPrefix(subject, "squash! ")
+		default:
+			return kind, strings.TrimSpace(subject)
+		}
+	}
+}
+
+// findAutosquashTarget returns the index of the first commit that is not a
+// fixup or squash commit and whose subject starts with the subject, or -1.
+func findAutosquashTarget(commits []*github.RepositoryCommit, subject string) int {
+	if subject == "" {
+		return -1
+	}
+	for i, c := range commits {
+		kind, candidate := autosquashSubject(c.GetCommit().GetMessage())
+		if kind == "" && strings.HasPrefix(candidate, subject) {
+			return i
+		}
+	}
+	return -1
+}
+
+func messageBody(message string) string {
+	parts := strings.SplitN(message, "\n", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+// rebaseHeadOntoBase recreates the commits of the pull request on top of the
+// base branch and force-updates the head branch to the last new commit,
+// returning its SHA. The head branch is only updated, with the head writer,
+// if it still points at the head of the pull request.
+func rebaseHeadOntoBase(ctx context.Context, client, headWriter *github.Client, pr *github.PullRequest, autosquash bool) (string, error) {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	commits, err := listPullRequestCommits(ctx, client, owner, repo, pr.GetNumber())
+	if err != nil {
+		return "", err
+	}
+	for _, c := range commits {
+		if len(c.Parents) != 1 {
+			return "", errors.Errorf("cannot rebase merge commit %s", c.GetSHA())
+		}
+	}
+
+	baseRef, _, err := client.Git.GetRef(ctx, owner, repo, fmt.Sprintf("heads/%s", pr.GetBase().GetRef()))
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get base branch %s", pr.GetBase().GetRef())
+	}
+	current := baseRef.GetObject().GetSHA()
+
+	tempBranch := fmt.Sprintf("bulldozer/rebase-%d", pr.GetNumber())
+	_, cleanup, err := createTempBranch(ctx, client, owner, repo, tempBranch, current)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	// the parent of the current commit, used when folding commits
+	var currentParent string
+
+	for _, step := range planRebase(commits, autosquash) {
+		tree, err := cherryPickTree(ctx, client, owner, repo, tempBranch, current, step.commit.GetSHA(), step.commit.Parents[0].GetSHA())
+		if err != nil {
+			if _, ok := errors.Cause(err).(cherryPickConflictError); ok {
+				return "", rebaseConflictError{sha: step.commit.GetSHA()}
+			}
+			return "", err
+		}
+
+		parent := current
+		if step.fold {
+			parent = currentParent
+		}
+
+		commit, _, err := client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+			Message: github.String(step.message),
+			Author:  step.commit.GetCommit().Author,
+			Tree:    &github.Tree{SHA: github.String(tree)},
+			Parents: []github.Commit{{SHA: github.String(parent)}},
+		})
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot create rebased commit for %s", step.commit.GetSHA())
+		}
+		currentParent = parent
+		current = commit.GetSHA()
+	}
+
+	// the head branch of a pull request from a fork is pushed in the fork,
+	// which shares objects with the base repository
+	headOwner := pr.GetHead().GetRepo().GetOwner().GetLogin()
+	headRepo := pr.GetHead().GetRepo().GetName()
+
+	headRef, _, err := headWriter.Git.GetRef(ctx, headOwner, headRepo, fmt.Sprintf("heads/%s", pr.GetHead().GetRef()))
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get head branch %s", pr.GetHead().GetRef())
+	}
+	if headRef.GetObject().GetSHA() != pr.GetHead().GetSHA() {
+		return "", headChangedError{message: fmt.Sprintf("the head of the pull request moved to %s while rebasing", headRef.GetObject().GetSHA())}
+	}
+
+	headRef.Object = &github.GitObject{SHA: github.String(current)}
+	if _, _, err := headWriter.Git.UpdateRef(ctx, headOwner, headRepo, headRef, true); err != nil {
+		return "", errors.Wrapf(err, "cannot update head branch %s", pr.GetHead().GetRef())
+	}
+	return current, nil
+}
+
+// listPullRequestCommits returns the commits of the pull request, oldest
+// first.
+func listPullRequestCommits(ctx context.Context, client *github.Client, owner, repo string, number int) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, res, err := client.PullRequests.ListCommits(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot list commits of pull request %d", number)
+		}
+		commits = append(commits, page...)
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+	return commits, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRebase(t *testing.T) {
+	newCommit := func(sha, message string) *github.RepositoryCommit {
+		return &github.RepositoryCommit{
+			SHA:    github.String(sha),
+			Commit: &github.Commit{Message: github.String(message)},
+		}
+	}
+
+	commits := []*github.RepositoryCommit{
+		newCommit("a", "Add widget\n\nWidgets are useful."),
+		newCommit("b", "Add gadget"),
+		newCommit("c", "fixup! Add widget"),
+		newCommit("d", "squash! Add gadget\n\nGadgets need tests."),
+		newCommit("e", "fixup! Unknown commit"),
+		newCommit("f", "fixup! fixup! Add widget"),
+	}
+
+	type step struct {
+		sha     string
+		fold    bool
+		message string
+	}
+	simplify := func(steps []rebaseStep) []step {
+		var s []step
+		for _, rs := range steps {
+			s = append(s, step{rs.commit.GetSHA(), rs.fold, rs.message})
+		}
+		return s
+	}
+
+	assert.Equal(t, []step{
+		{"a", false, "Add widget\n\nWidgets are useful."},
+		{"b", false, "Add gadget"},
+		{"c", false, "fixup! Add widget"},
+		{"d", false, "squash! Add gadget\n\nGadgets need tests."},
+		{"e", false, "fixup! Unknown commit"},
+		{"f", false, "fixup! fixup! Add widget"},
+	}, simplify(planRebase(commits, false)))
+
+	assert.Equal(t, []step{
+		{"a", false, "Add widget\n\nWidgets are useful."},
+		{"c", true, "Add widget\n\nWidgets are useful."},
+		{"f", true, "Add widget\n\nWidgets are useful."},
+		{"b", false, "Add gadget"},
+		{"d", true, "Add gadget\n\nGadgets need tests."},
+		{"e", false, "fixup! Unknown commit"},
+	}, simplify(planRebase(commits, true)))
+}
+
+func TestRebaseHeadOntoBaseDeletesTempBranch(t *testing.T) {
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/pulls/7/commits":
+			_, _ = w.Write([]byte(`[{"sha": "c1", "commit": {"message": "change"}, "parents": [{"sha": "p1"}]}]`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/refs/heads/develop":
+			_, _ = w.Write([]byte(`{"ref": "refs/heads/develop", "object": {"sha": "base"}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/refs":
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/commits/base":
+			_, _ = w.Write([]byte(`{"sha": "base", "tree": {"sha": "tree"}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/commits":
+			_, _ = w.Write([]byte(`{"sha": "sibling"}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/o/r/git/refs/heads/bulldozer/rebase-7":
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/merges":
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"message": "Merge conflict"}`))
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	repo := &github.Repository{Name: github.String("r"), Owner: &github.User{Login: github.String("o")}}
+	pr := &github.PullRequest{
+		Number: github.Int(7),
+		Base:   &github.PullRequestBranch{Ref: github.String("develop"), Repo: repo},
+		Head:   &github.PullRequestBranch{Ref: github.String("feature"), SHA: github.String("c1"), Repo: repo},
+	}
+
+	_, err := rebaseHeadOntoBase(context.Background(), client, client, pr, false)
+	require.Error(t, err)
+	assert.True(t, isUpdateConflict(err))
+	assert.Equal(t, []string{"/repos/o/r/git/refs/heads/bulldozer/rebase-7"}, deleted, "the temporary branch is deleted when rebasing fails")
+}
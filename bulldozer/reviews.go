@@ -0,0 +1,52 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// dismissStaleApprovals dismisses all approving reviews of the pull request
+// that were submitted for a commit other than the current head.
+func dismissStaleApprovals(ctx context.Context, pullCtx pull.Context, client *github.Client, headSHA string) error {
+	logger := zerolog.Ctx(ctx)
+
+	reviews, err := pull.LatestReviews(ctx, client, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+	if err != nil {
+		return errors.Wrapf(err, "cannot list reviews for %s", pullCtx.Locator())
+	}
+
+	for _, r := range reviews {
+		if r.GetState() != "APPROVED" || r.GetCommitID() == headSHA {
+			continue
+		}
+
+		logger.Info().Msgf("Dismissing approval by %s for commit %s because it predates the head %s", r.GetUser().GetLogin(), r.GetCommitID(), headSHA)
+		dismissal := &github.PullRequestReviewDismissalRequest{
+			Message: github.String(fmt.Sprintf("Dismissed by bulldozer because this approval was for %s, not the current head %s.", r.GetCommitID(), headSHA)),
+		}
+		if _, _, err := client.PullRequests.DismissReview(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number(), r.GetID(), dismissal); err != nil {
+			return errors.Wrapf(err, "cannot dismiss review %d by %s", r.GetID(), r.GetUser().GetLogin())
+		}
+	}
+	return nil
+}
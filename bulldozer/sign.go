@@ -0,0 +1,242 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultGPGProgram = "gpg"
+
+	// DefaultGPGTimeout is the longest time the GPG program may take to sign
+	// a commit if the timeout is not configured, so that a hung agent does
+	// not block merges
+	DefaultGPGTimeout = 10 * time.Second
+)
+
+// CommitSigner signs commits created by bulldozer.
+type CommitSigner interface {
+	// Identity returns the name and email used as the author and committer
+	// of signed commits. The signing key must be associated with the email.
+	Identity() (name string, email string)
+
+	// Sign returns an ASCII-armored detached signature of the payload. It
+	// stops when the context is done.
+	Sign(ctx context.Context, payload []byte) (string, error)
+}
+
+// GPGSigner is a CommitSigner that invokes an external GPG program with a
+// key from the keyring of the server.
+type GPGSigner struct {
+	Program string
+	KeyID   string
+	Name    string
+	Email   string
+
+	// Timeout limits how long the program may run. If zero,
+	// DefaultGPGTimeout is used.
+	Timeout time.Duration
+}
+
+func (s *GPGSigner) Identity() (string, string) {
+	return s.Name, s.Email
+}
+
+func (s *GPGSigner) Sign(ctx context.Context, payload []byte) (string, error) {
+	program := s.Program
+	if program == "" {
+		program = DefaultGPGProgram
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultGPGTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, program, "--batch", "--yes", "--armor", "--detach-sign", "--local-user", s.KeyID)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", errors.Wrapf(ctx.Err(), "failed to sign commit: %s did not finish", program)
+		}
+		return "", errors.Wrapf(err, "failed to sign commit: %s", strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// signedCommitRequest is the body of a create commit request. The client does
+// not support the signature field, so this replaces the default request.
+type signedCommitRequest struct {
+	Message   string               `json:"message"`
+	Tree      string               `json:"tree"`
+	Parents   []string             `json:"parents"`
+	Author    *github.CommitAuthor `json:"author"`
+	Committer *github.CommitAuthor `json:"committer"`
+	Signature string               `json:"signature"`
+}
+
+// staleTestMergeError is returned when the test merge commit of a pull
+// request was not computed from the current head and base branch. GitHub
+// computes a new test merge after a push, so the merge can be retried.
+type staleTestMergeError string
+
+func (err staleTestMergeError) Error() string {
+	return string(err)
+}
+
+// mergeSigned creates a signed merge or squash commit for the pull request
+// using the Git data API and moves the base branch to the new commit. The
+// tree of the commit is taken from the test merge commit computed by GitHub,
+// which must merge the current head of the pull request into the current base
+// branch. It returns the SHA of the new commit.
+func mergeSigned(ctx context.Context, client *github.Client, signer CommitSigner, pr *github.PullRequest, method MergeMethod, message string) (string, error) {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	testMerge, _, err := client.Git.GetCommit(ctx, owner, repo, pr.GetMergeCommitSHA())
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get test merge commit %s", pr.GetMergeCommitSHA())
+	}
+	if len(testMerge.Parents) != 2 {
+		return "", errors.Errorf("test merge commit %s has %d parents instead of 2", pr.GetMergeCommitSHA(), len(testMerge.Parents))
+	}
+
+	// the tree is only correct for the commits the test merge was computed
+	// from, which may be older than the current head or base
+	headSHA := pr.GetHead().GetSHA()
+	if testHead := testMerge.Parents[1].GetSHA(); testHead != headSHA {
+		return "", staleTestMergeError(fmt.Sprintf("test merge commit %s merges %s instead of head %s", pr.GetMergeCommitSHA(), testHead, headSHA))
+	}
+	base, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+pr.GetBase().GetRef())
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get base branch %s", pr.GetBase().GetRef())
+	}
+	if testBase, baseSHA := testMerge.Parents[0].GetSHA(), base.GetObject().GetSHA(); testBase != baseSHA {
+		return "", staleTestMergeError(fmt.Sprintf("test merge commit %s merges into %s instead of %s at %s", pr.GetMergeCommitSHA(), testBase, pr.GetBase().GetRef(), baseSHA))
+	}
+
+	var parents []string
+	switch method {
+	case MergeCommit:
+		parents = []string{testMerge.Parents[0].GetSHA(), headSHA}
+	case SquashAndMerge:
+		parents = []string{testMerge.Parents[0].GetSHA()}
+	default:
+		return "", errors.Errorf("signed commits are not supported for method %s", method)
+	}
+
+	name, email := signer.Identity()
+	now := time.Now().UTC().Truncate(time.Second)
+	identity := &github.CommitAuthor{
+		Name:  github.String(name),
+		Email: github.String(email),
+		Date:  &now,
+	}
+
+	var payload bytes.Buffer
+	fmt.Fprintf(&payload, "tree %s\n", testMerge.GetTree().GetSHA())
+	for _, parent := range parents {
+		fmt.Fprintf(&payload, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&payload, "author %s <%s> %d +0000\n", name, email, now.Unix())
+	fmt.Fprintf(&payload, "committer %s <%s> %d +0000\n", name, email, now.Unix())
+	fmt.Fprintf(&payload, "\n%s", message)
+
+	signature, err := signer.Sign(ctx, payload.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	req, err := client.NewRequest("POST", fmt.Sprintf("repos/%v/%v/git/commits", owner, repo), &signedCommitRequest{
+		Message:   message,
+		Tree:      testMerge.GetTree().GetSHA(),
+		Parents:   parents,
+		Author:    identity,
+		Committer: identity,
+		Signature: signature,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create commit request")
+	}
+
+	commit := new(github.Commit)
+	if _, err := client.Do(ctx, req, commit); err != nil {
+		return "", errors.Wrap(err, "cannot create signed commit")
+	}
+
+	ref := &github.Reference{
+		Ref: github.String(fmt.Sprintf("refs/heads/%s", pr.GetBase().GetRef())),
+		Object: &github.GitObject{
+			SHA: commit.SHA,
+		},
+	}
+	if _, _, err := client.Git.UpdateRef(ctx, owner, repo, ref, false); err != nil {
+		return "", errors.Wrapf(err, "cannot update %s to signed commit %s", pr.GetBase().GetRef(), commit.GetSHA())
+	}
+
+	// a squash commit does not contain the head of the pull request, so
+	// GitHub will not mark the pull request as merged
+	if method == SquashAndMerge {
+		comment := &github.IssueComment{
+			Body: github.String(fmt.Sprintf("Squashed and merged as %s.", commit.GetSHA())),
+		}
+		if _, _, err := client.Issues.CreateComment(ctx, owner, repo, pr.GetNumber(), comment); err != nil {
+			return commit.GetSHA(), errors.Wrap(err, "cannot comment on squashed pull request")
+		}
+
+		closed := &github.PullRequest{State: github.String("closed")}
+		if _, _, err := client.PullRequests.Edit(ctx, owner, repo, pr.GetNumber(), closed); err != nil {
+			return commit.GetSHA(), errors.Wrap(err, "cannot close squashed pull request")
+		}
+	}
+
+	return commit.GetSHA(), nil
+}
+
+// signedCommitMessage returns the full message for a signed commit, matching
+// the messages GitHub creates for the corresponding merge method. If title is
+// non-empty, it replaces the default title.
+func signedCommitMessage(pr *github.PullRequest, method MergeMethod, title, body string) string {
+	switch {
+	case title != "":
+	case method == SquashAndMerge:
+		title = fmt.Sprintf("%s (#%d)", pr.GetTitle(), pr.GetNumber())
+	default:
+		title = fmt.Sprintf("Merge pull request #%d from %s", pr.GetNumber(), pr.GetHead().GetLabel())
+		if body == "" {
+			body = pr.GetTitle()
+		}
+	}
+
+	if body == "" {
+		return title
+	}
+	return title + "\n\n" + body
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFakeGPG(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "gpg")
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755)
+	require.Nil(t, err)
+	return path
+}
+
+func TestGPGSigner(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("signs", func(t *testing.T) {
+		signer := &GPGSigner{
+			Program: writeFakeGPG(t, `cat > /dev/null; echo "signature for $6"`),
+			KeyID:   "ABCDEF",
+		}
+
+		signature, err := signer.Sign(ctx, []byte("payload"))
+		require.Nil(t, err)
+		assert.Equal(t, "signature for ABCDEF\n", signature)
+	})
+
+	t.Run("reportsFailures", func(t *testing.T) {
+		signer := &GPGSigner{
+			Program: writeFakeGPG(t, `echo "no secret key" >&2; exit 2`),
+			KeyID:   "ABCDEF",
+		}
+
+		_, err := signer.Sign(ctx, []byte("payload"))
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "no secret key")
+	})
+
+	t.Run("timesOut", func(t *testing.T) {
+		signer := &GPGSigner{
+			Program: writeFakeGPG(t, `exec sleep 10`),
+			KeyID:   "ABCDEF",
+			Timeout: 50 * time.Millisecond,
+		}
+
+		start := time.Now()
+		_, err := signer.Sign(ctx, []byte("payload"))
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "did not finish")
+		assert.True(t, time.Since(start) < 5*time.Second, "signing was not stopped at the timeout")
+	})
+}
+
+type fakeSigner struct{}
+
+func (fakeSigner) Identity() (string, string) {
+	return "bulldozer", "bulldozer@example.com"
+}
+
+func (fakeSigner) Sign(ctx context.Context, payload []byte) (string, error) {
+	return "signature", nil
+}
+
+// newSignedMergeServer serves the API requests made to merge pull request
+// o/r#1 as a signed commit. The test merge commit merges testHead into
+// testBase, while the base branch points at base.
+func newSignedMergeServer(t *testing.T, testBase, testHead, base string, commits *[]signedCommitRequest) *github.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/commits/test-merge":
+			_, _ = fmt.Fprintf(w, `{"sha": "test-merge", "tree": {"sha": "test-tree"}, "parents": [{"sha": %q}, {"sha": %q}]}`, testBase, testHead)
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/refs/heads/develop":
+			_, _ = fmt.Fprintf(w, `{"ref": "refs/heads/develop", "object": {"sha": %q}}`, base)
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/commits":
+			var c signedCommitRequest
+			if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+				t.Errorf("invalid commit: %v", err)
+			}
+			*commits = append(*commits, c)
+			_, _ = w.Write([]byte(`{"sha": "signed"}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/o/r/git/refs/heads/develop":
+			_, _ = w.Write([]byte(`{"ref": "refs/heads/develop", "object": {"sha": "signed"}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+func TestMergeSigned(t *testing.T) {
+	pr := &github.PullRequest{
+		Number:         github.Int(1),
+		MergeCommitSHA: github.String("test-merge"),
+		Base: &github.PullRequestBranch{
+			Ref: github.String("develop"),
+			Repo: &github.Repository{
+				Name:  github.String("r"),
+				Owner: &github.User{Login: github.String("o")},
+			},
+		},
+		Head: &github.PullRequestBranch{
+			SHA: github.String("head"),
+		},
+	}
+
+	t.Run("merges", func(t *testing.T) {
+		var commits []signedCommitRequest
+		client := newSignedMergeServer(t, "base", "head", "base", &commits)
+
+		sha, err := mergeSigned(context.Background(), client, fakeSigner{}, pr, MergeCommit, "Merge pull request #1")
+		require.Nil(t, err)
+		assert.Equal(t, "signed", sha)
+
+		require.Len(t, commits, 1)
+		assert.Equal(t, "test-tree", commits[0].Tree)
+		assert.Equal(t, []string{"base", "head"}, commits[0].Parents)
+		assert.Equal(t, "signature", commits[0].Signature)
+	})
+
+	t.Run("staleHead", func(t *testing.T) {
+		var commits []signedCommitRequest
+		client := newSignedMergeServer(t, "base", "old-head", "base", &commits)
+
+		_, err := mergeSigned(context.Background(), client, fakeSigner{}, pr, SquashAndMerge, "Fix widgets")
+		require.NotNil(t, err)
+
+		_, ok := errors.Cause(err).(staleTestMergeError)
+		assert.True(t, ok, "expected staleTestMergeError, got %v", err)
+		assert.Empty(t, commits, "commits must not be created from an outdated test merge")
+	})
+
+	t.Run("staleBase", func(t *testing.T) {
+		var commits []signedCommitRequest
+		client := newSignedMergeServer(t, "old-base", "head", "base", &commits)
+
+		_, err := mergeSigned(context.Background(), client, fakeSigner{}, pr, MergeCommit, "Merge pull request #1")
+		require.NotNil(t, err)
+
+		_, ok := errors.Cause(err).(staleTestMergeError)
+		assert.True(t, ok, "expected staleTestMergeError, got %v", err)
+		assert.Empty(t, commits, "commits must not be created from an outdated test merge")
+	})
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/state"
+)
+
+// DefaultStaleComment is the comment posted to the author of a stale pull
+// request after bulldozer tried to update it.
+const DefaultStaleComment = `@{{.Author}}, this pull request has had no activity for {{.Days}} days.
+{{if .Conflict}}bulldozer could not update it because it conflicts with ` + "`{{.Base}}`" + `.
+{{else}}bulldozer updated it with the latest changes from ` + "`{{.Base}}`" + `.
+{{end}}{{if .FailedChecks}}These checks fail after the update:
+{{range .FailedChecks}}* {{.}}
+{{end}}{{end}}`
+
+// staleTTL is how long bulldozer waits for the update of a stale pull request
+// and its checks before giving up on the nudge.
+const staleTTL = 24 * time.Hour
+
+// StaleData is the data available to stale comment templates.
+type StaleData struct {
+	Number       int
+	Author       string
+	Base         string
+	Head         string
+	Days         int
+	Conflict     bool
+	FailedChecks []string
+}
+
+// formatStaleComment renders the stale comment template, using the default
+// comment if the template is empty.
+func formatStaleComment(data StaleData, text string) (string, error) {
+	if text == "" {
+		text = DefaultStaleComment
+	}
+
+	tmpl, err := template.New("stale").Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid stale comment template %q", text)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrap(err, "cannot render stale comment")
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// IsStale returns true if the pull request has had no activity for at least
+// the number of days in the configuration.
+func IsStale(pr *github.PullRequest, staleConfig StaleConfig, now time.Time) bool {
+	if !staleConfig.Enabled() {
+		return false
+	}
+	return now.Sub(pr.GetUpdatedAt()) >= time.Duration(staleConfig.Days)*24*time.Hour
+}
+
+func staleKey(pullCtx pull.Context) string {
+	return "stale/" + pullCtx.Locator()
+}
+
+// MarkStale records that the pull request is stale and is about to be
+// updated, so that NudgeStalePR can tell its author about the result.
+func MarkStale(ctx context.Context, pullCtx pull.Context, pr *github.PullRequest) error {
+	if err := state.Ctx(ctx).Set(ctx, staleKey(pullCtx), []byte(pr.GetHead().GetSHA()), staleTTL); err != nil {
+		return errors.Wrap(err, "failed to record stale pull request")
+	}
+	return nil
+}
+
+// NudgeStalePR comments on a pull request marked with MarkStale once the
+// result of its update is known: either the update failed because of
+// conflicts, or the update succeeded and the checks on the new head are
+// complete. Until then, it does nothing.
+func NudgeStalePR(ctx context.Context, pullCtx pull.Context, client *github.Client, updateConfig UpdateConfig, mergeConfig MergeConfig) error {
+	logger := zerolog.Ctx(ctx)
+	store := state.Ctx(ctx)
+
+	staleHead, ok, err := store.Get(ctx, staleKey(pullCtx))
+	if err != nil {
+		return errors.Wrap(err, "failed to get stale pull request")
+	}
+	if !ok {
+		return nil
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+	if err != nil {
+		return errors.Wrapf(err, "failed to retrieve pull request %q", pullCtx.Locator())
+	}
+	if pr.GetState() == "closed" {
+		return store.Delete(ctx, staleKey(pullCtx))
+	}
+
+	conflict, err := findMarkedComment(ctx, client, pullCtx.Owner(), pullCtx.Repo(), pr.GetNumber(), conflictMarker)
+	if err != nil {
+		return err
+	}
+
+	data := StaleData{
+		Number:   pr.GetNumber(),
+		Author:   pr.GetUser().GetLogin(),
+		Base:     pr.GetBase().GetRef(),
+		Head:     pr.GetHead().GetRef(),
+		Days:     updateConfig.Stale.Days,
+		Conflict: conflict != nil,
+	}
+
+	if !data.Conflict {
+		if pr.GetHead().GetSHA() == string(staleHead) {
+			logger.Debug().Msg("Stale pull request was not updated yet, not nudging")
+			return nil
+		}
+
+		running, err := checksInProgress(ctx, client, pullCtx.Owner(), pullCtx.Repo(), pr.GetHead().GetSHA(), mergeConfig.PolicyBot)
+		if err != nil {
+			return err
+		}
+		if len(running) > 0 {
+			logger.Debug().Msgf("Waiting for checks on stale pull request to finish: [%s]", strings.Join(running, ","))
+			return nil
+		}
+
+		if data.FailedChecks, err = failedChecks(ctx, client, pullCtx.Owner(), pullCtx.Repo(), pr.GetHead().GetSHA()); err != nil {
+			return err
+		}
+	}
+
+	body, err := formatStaleComment(data, updateConfig.Stale.Comment)
+	if err != nil {
+		return err
+	}
+
+	comment := &github.IssueComment{Body: github.String(body)}
+	if _, _, err := client.Issues.CreateComment(ctx, pullCtx.Owner(), pullCtx.Repo(), pr.GetNumber(), comment); err != nil {
+		return errors.Wrap(err, "failed to comment on stale pull request")
+	}
+	logger.Info().Msgf("Nudged author of stale pull request (conflict: %t, failed checks: %d)", data.Conflict, len(data.FailedChecks))
+
+	return store.Delete(ctx, staleKey(pullCtx))
+}
+
+// failedChecks returns the names of the statuses and check runs that failed
+// for the commit.
+func failedChecks(ctx context.Context, client *github.Client, owner, repo, sha string) ([]string, error) {
+	var failed []string
+
+	status, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get statuses for %s", sha)
+	}
+	for _, s := range status.Statuses {
+		if s.GetState() == "failure" || s.GetState() == "error" {
+			failed = append(failed, s.GetContext())
+		}
+	}
+
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, res, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot list check runs for %s", sha)
+		}
+		for _, run := range runs.CheckRuns {
+			if IsOwnCheck(run.GetName()) {
+				continue
+			}
+			switch run.GetConclusion() {
+			case "failure", "timed_out", "cancelled":
+				failed = append(failed, run.GetName())
+			}
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	return failed, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsStale(t *testing.T) {
+	now := time.Now()
+	updatedAt := now.Add(-10 * 24 * time.Hour)
+	pr := &github.PullRequest{UpdatedAt: &updatedAt}
+
+	assert.False(t, IsStale(pr, StaleConfig{}, now))
+	assert.True(t, IsStale(pr, StaleConfig{Days: 7}, now))
+	assert.False(t, IsStale(pr, StaleConfig{Days: 14}, now))
+}
+
+func TestFormatStaleComment(t *testing.T) {
+	data := StaleData{
+		Number: 42,
+		Author: "octocat",
+		Base:   "develop",
+		Head:   "feature",
+		Days:   14,
+	}
+
+	body, err := formatStaleComment(data, "")
+	require.NoError(t, err)
+	assert.Equal(t, "@octocat, this pull request has had no activity for 14 days.\nbulldozer updated it with the latest changes from `develop`.", body)
+
+	data.FailedChecks = []string{"ci/build", "lint"}
+	body, err = formatStaleComment(data, "")
+	require.NoError(t, err)
+	assert.Equal(t, "@octocat, this pull request has had no activity for 14 days.\nbulldozer updated it with the latest changes from `develop`.\nThese checks fail after the update:\n* ci/build\n* lint", body)
+
+	data.Conflict = true
+	data.FailedChecks = nil
+	body, err = formatStaleComment(data, "")
+	require.NoError(t, err)
+	assert.Equal(t, "@octocat, this pull request has had no activity for 14 days.\nbulldozer could not update it because it conflicts with `develop`.", body)
+
+	body, err = formatStaleComment(data, "#{{.Number}} is stale{{if .Conflict}} and conflicts{{end}}")
+	require.NoError(t, err)
+	assert.Equal(t, "#42 is stale and conflicts", body)
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// closeSupersededPRs closes open pull requests that make the same changes to
+// the same base branch as the merged pull request. Only pull requests with the
+// same head branch name or title are compared, which covers pull requests
+// recreated by bots like Dependabot.
+func closeSupersededPRs(ctx context.Context, client *github.Client, pr *github.PullRequest) error {
+	logger := zerolog.Ctx(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	openPRs, err := pull.ListOpenPullRequests(ctx, client, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	var mergedFiles []string
+	for _, other := range openPRs {
+		if other.GetNumber() == pr.GetNumber() || other.GetBase().GetRef() != pr.GetBase().GetRef() {
+			continue
+		}
+		if other.GetHead().GetRef() != pr.GetHead().GetRef() && other.GetTitle() != pr.GetTitle() {
+			continue
+		}
+
+		if mergedFiles == nil {
+			if mergedFiles, err = changedFiles(ctx, client, owner, repo, pr.GetNumber()); err != nil {
+				return err
+			}
+		}
+
+		otherFiles, err := changedFiles(ctx, client, owner, repo, other.GetNumber())
+		if err != nil {
+			return err
+		}
+		if !stringSlicesEqual(mergedFiles, otherFiles) {
+			continue
+		}
+
+		logger.Info().Msgf("Closing pull request #%d because it is superseded by #%d", other.GetNumber(), pr.GetNumber())
+
+		comment := &github.IssueComment{
+			Body: github.String(fmt.Sprintf("Closing because this pull request makes the same changes as #%d, which was merged.", pr.GetNumber())),
+		}
+		if _, _, err := client.Issues.CreateComment(ctx, owner, repo, other.GetNumber(), comment); err != nil {
+			return errors.Wrapf(err, "cannot comment on superseded pull request #%d", other.GetNumber())
+		}
+
+		closed := &github.PullRequest{State: github.String("closed")}
+		if _, _, err := client.PullRequests.Edit(ctx, owner, repo, other.GetNumber(), closed); err != nil {
+			return errors.Wrapf(err, "cannot close superseded pull request #%d", other.GetNumber())
+		}
+	}
+
+	return nil
+}
+
+// changedFiles returns a sorted description of the files changed by a pull
+// request, including the resulting blob SHA of each file.
+func changedFiles(ctx context.Context, client *github.Client, owner, repo string, number int) ([]string, error) {
+	var files []string
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		commitFiles, res, err := client.PullRequests.ListFiles(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot list files for pull request #%d", number)
+		}
+
+		for _, f := range commitFiles {
+			files = append(files, fmt.Sprintf("%s:%s:%s", f.GetFilename(), f.GetStatus(), f.GetSHA()))
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
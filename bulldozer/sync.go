@@ -0,0 +1,162 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// SyncBranchPrefix is the prefix of the branches of sync pull requests. The
+// name of the target branch follows the prefix.
+const SyncBranchPrefix = "bulldozer/sync/"
+
+// syncConflictMarker identifies the comment reporting that the source branch
+// could not be merged into the sync branch.
+const syncConflictMarker = "<!-- bulldozer:sync-conflict -->"
+
+// SyncBranch brings the target branch up to date with the source branch with
+// a pull request. The head of the pull request is a sync branch that points
+// at the source branch.
+//
+// If the pull request is already open, the sync branch is fast-forwarded to
+// the source branch. If commits were pushed to the sync branch, for example
+// to resolve conflicts, the branches have diverged and the source branch is
+// merged into the sync branch instead, so that those commits are never
+// overwritten. If the merge conflicts, a comment on the pull request asks
+// for the conflicts to be resolved. If no pull request is open, the previous
+// one was merged or closed, and the sync branch is reset to the source
+// branch before a new pull request is opened.
+func SyncBranch(ctx context.Context, client *github.Client, owner, repo, source, target string, syncConfig SyncConfig) error {
+	logger := zerolog.Ctx(ctx)
+
+	comparison, _, err := client.Repositories.CompareCommits(ctx, owner, repo, target, source)
+	if err != nil {
+		return errors.Wrapf(err, "cannot compare %s and %s", target, source)
+	}
+	if comparison.GetAheadBy() == 0 {
+		logger.Debug().Msgf("Branch %s contains every commit on %s, not syncing", target, source)
+		return nil
+	}
+
+	sourceRef, _, err := client.Git.GetRef(ctx, owner, repo, fmt.Sprintf("heads/%s", source))
+	if err != nil {
+		return errors.Wrapf(err, "cannot get branch %s", source)
+	}
+	sourceSHA := sourceRef.GetObject().GetSHA()
+
+	syncBranch := SyncBranchPrefix + target
+	syncRef := &github.Reference{
+		Ref:    github.String(fmt.Sprintf("refs/heads/%s", syncBranch)),
+		Object: &github.GitObject{SHA: github.String(sourceSHA)},
+	}
+
+	prs, _, err := client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+		State: "open",
+		Head:  fmt.Sprintf("%s:%s", owner, syncBranch),
+		Base:  target,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "cannot list pull requests for sync branch %s", syncBranch)
+	}
+
+	existing, _, err := client.Git.GetRef(ctx, owner, repo, fmt.Sprintf("heads/%s", syncBranch))
+	if err != nil {
+		if rerr, ok := err.(*github.ErrorResponse); !ok || rerr.Response.StatusCode != http.StatusNotFound {
+			return errors.Wrapf(err, "cannot get sync branch %s", syncBranch)
+		}
+		if _, _, err := client.Git.CreateRef(ctx, owner, repo, syncRef); err != nil {
+			return errors.Wrapf(err, "cannot create sync branch %s", syncBranch)
+		}
+	} else if existing.GetObject().GetSHA() != sourceSHA {
+		if len(prs) > 0 {
+			return updateSyncBranch(ctx, client, owner, repo, source, prs[0], syncRef)
+		}
+
+		// the commits on the sync branch were merged into the target with
+		// the last sync pull request, or abandoned when it was closed
+		if _, _, err := client.Git.UpdateRef(ctx, owner, repo, syncRef, true); err != nil {
+			return errors.Wrapf(err, "cannot reset sync branch %s", syncBranch)
+		}
+		logger.Info().Msgf("Reset sync branch %s to %s", syncBranch, source)
+	}
+
+	if len(prs) > 0 {
+		logger.Debug().Msgf("Sync pull request #%d for %s is already open", prs[0].GetNumber(), target)
+		return nil
+	}
+
+	pr, _, err := client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title: github.String(fmt.Sprintf("Sync %s with %s", target, source)),
+		Head:  github.String(syncBranch),
+		Base:  github.String(target),
+		Body:  github.String(fmt.Sprintf("bulldozer opened this pull request to merge the commits on `%s` into `%s`. It is kept up to date as `%s` changes.", source, target, source)),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "cannot open sync pull request for %s", target)
+	}
+	logger.Info().Msgf("Opened sync pull request #%d to merge %s into %s", pr.GetNumber(), source, target)
+
+	if len(syncConfig.Labels) > 0 {
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, pr.GetNumber(), syncConfig.Labels); err != nil {
+			return errors.Wrapf(err, "cannot label sync pull request #%d", pr.GetNumber())
+		}
+	}
+	return nil
+}
+
+// updateSyncBranch brings the sync branch of the open pull request up to
+// date with the source branch. It fast-forwards the sync branch if possible
+// and merges the source branch into it if the branches have diverged. If the
+// merge conflicts, it reports the conflict on the pull request.
+func updateSyncBranch(ctx context.Context, client *github.Client, owner, repo, source string, pr *github.PullRequest, syncRef *github.Reference) error {
+	logger := zerolog.Ctx(ctx)
+	syncBranch := pr.GetHead().GetRef()
+
+	_, _, err := client.Git.UpdateRef(ctx, owner, repo, syncRef, false)
+	if err == nil {
+		logger.Info().Msgf("Fast-forwarded sync branch %s to %s", syncBranch, source)
+		return deleteMarkedComment(ctx, client, owner, repo, pr.GetNumber(), syncConflictMarker)
+	}
+	if rerr, ok := err.(*github.ErrorResponse); !ok || rerr.Response.StatusCode != http.StatusUnprocessableEntity {
+		return errors.Wrapf(err, "cannot update sync branch %s", syncBranch)
+	}
+
+	// the sync branch has commits that are not on the source branch
+	_, res, err := client.Repositories.Merge(ctx, owner, repo, &github.RepositoryMergeRequest{
+		Base:          github.String(syncBranch),
+		Head:          github.String(syncRef.GetObject().GetSHA()),
+		CommitMessage: github.String(fmt.Sprintf("Merge %s into %s", source, syncBranch)),
+	})
+	switch {
+	case err == nil:
+		logger.Info().Msgf("Merged %s into diverged sync branch %s", source, syncBranch)
+		return deleteMarkedComment(ctx, client, owner, repo, pr.GetNumber(), syncConflictMarker)
+
+	case res != nil && res.StatusCode == http.StatusConflict:
+		logger.Warn().Msgf("Sync branch %s conflicts with %s", syncBranch, source)
+		body := fmt.Sprintf("bulldozer cannot bring `%s` up to date with `%s` because they conflict. "+
+			"Merge `%s` into `%s` and resolve the conflicts to continue syncing.", syncBranch, source, source, syncBranch)
+		return upsertMarkedComment(ctx, client, owner, repo, pr.GetNumber(), syncConflictMarker, body)
+
+	default:
+		return errors.Wrapf(err, "cannot merge %s into sync branch %s", source, syncBranch)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncBranch(t *testing.T) {
+	tests := map[string]struct {
+		SyncSHA     string
+		OpenPR      bool
+		FastForward bool
+		MergeStatus int
+
+		Requests []string
+		Force    bool
+	}{
+		"new": {
+			Requests: []string{"POST /repos/o/r/git/refs", "POST /repos/o/r/pulls", "POST /repos/o/r/issues/5/labels"},
+		},
+		"fastForward": {
+			SyncSHA:     "old",
+			OpenPR:      true,
+			FastForward: true,
+			Requests:    []string{"PATCH /repos/o/r/git/refs/heads/bulldozer/sync/develop", "GET /repos/o/r/issues/5/comments"},
+		},
+		"diverged": {
+			SyncSHA:     "resolved",
+			OpenPR:      true,
+			MergeStatus: http.StatusCreated,
+			Requests:    []string{"PATCH /repos/o/r/git/refs/heads/bulldozer/sync/develop", "POST /repos/o/r/merges", "GET /repos/o/r/issues/5/comments"},
+		},
+		"divergedConflict": {
+			SyncSHA:     "resolved",
+			OpenPR:      true,
+			MergeStatus: http.StatusConflict,
+			Requests:    []string{"PATCH /repos/o/r/git/refs/heads/bulldozer/sync/develop", "POST /repos/o/r/merges", "GET /repos/o/r/issues/5/comments", "POST /repos/o/r/issues/5/comments"},
+		},
+		"previousMerged": {
+			SyncSHA:  "resolved",
+			Requests: []string{"PATCH /repos/o/r/git/refs/heads/bulldozer/sync/develop", "POST /repos/o/r/pulls", "POST /repos/o/r/issues/5/labels"},
+			Force:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var requests []string
+			var force bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				route := r.Method + " " + r.URL.Path
+				switch route {
+				case "GET /repos/o/r/compare/develop...main":
+					_, _ = w.Write([]byte(`{"ahead_by": 2}`))
+					return
+				case "GET /repos/o/r/git/refs/heads/main":
+					_, _ = w.Write([]byte(`{"object": {"sha": "new"}}`))
+					return
+				case "GET /repos/o/r/pulls":
+					assert.Equal(t, "o:bulldozer/sync/develop", r.URL.Query().Get("head"))
+					if test.OpenPR {
+						_, _ = w.Write([]byte(`[{"number": 5, "head": {"ref": "bulldozer/sync/develop"}}]`))
+					} else {
+						_, _ = w.Write([]byte(`[]`))
+					}
+					return
+				case "GET /repos/o/r/git/refs/heads/bulldozer/sync/develop":
+					if test.SyncSHA == "" {
+						http.NotFound(w, r)
+					} else {
+						_, _ = w.Write([]byte(`{"object": {"sha": "` + test.SyncSHA + `"}}`))
+					}
+					return
+				}
+
+				requests = append(requests, route)
+				switch route {
+				case "PATCH /repos/o/r/git/refs/heads/bulldozer/sync/develop":
+					var body struct {
+						SHA   string `json:"sha"`
+						Force bool   `json:"force"`
+					}
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+					assert.Equal(t, "new", body.SHA)
+					force = body.Force
+					if !body.Force && !test.FastForward {
+						w.WriteHeader(http.StatusUnprocessableEntity)
+						_, _ = w.Write([]byte(`{"message": "Update is not a fast forward"}`))
+						return
+					}
+					_, _ = w.Write([]byte(`{}`))
+				case "POST /repos/o/r/merges":
+					var body github.RepositoryMergeRequest
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+					assert.Equal(t, "bulldozer/sync/develop", body.GetBase())
+					assert.Equal(t, "new", body.GetHead())
+					w.WriteHeader(test.MergeStatus)
+					_, _ = w.Write([]byte(`{}`))
+				case "POST /repos/o/r/pulls":
+					_, _ = w.Write([]byte(`{"number": 5}`))
+				case "GET /repos/o/r/issues/5/comments", "POST /repos/o/r/issues/5/labels":
+					_, _ = w.Write([]byte(`[]`))
+				default:
+					_, _ = w.Write([]byte(`{}`))
+				}
+			}))
+			defer srv.Close()
+
+			client := github.NewClient(nil)
+			client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+			ctx := WithBotLogin(context.Background(), "bulldozer[bot]")
+			err := SyncBranch(ctx, client, "o", "r", "main", "develop", SyncConfig{Branches: []string{"develop"}, Labels: []string{"sync"}})
+			require.NoError(t, err)
+			assert.Equal(t, test.Requests, requests)
+			assert.Equal(t, test.Force, force)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// TagData is the data available to tag name templates.
+type TagData struct {
+	Number  int
+	Title   string
+	HeadRef string
+	SHA     string
+
+	// Version is the trimmed content of the configured version file at the
+	// merge commit, or empty if no version file is configured
+	Version string
+}
+
+// tagMergeCommit creates a tag, and optionally a draft release, pointing at
+// the merge commit of the pull request.
+func tagMergeCommit(ctx context.Context, client *github.Client, pr *github.PullRequest, sha string, config TagConfig) error {
+	logger := zerolog.Ctx(ctx)
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	if len(config.Labels) > 0 {
+		var labels []string
+		for _, label := range pr.Labels {
+			labels = append(labels, label.GetName())
+		}
+		if match, _ := anyInSlice(labels, config.Labels); !match {
+			logger.Debug().Msg("Pull request has none of the tag labels, not creating a tag")
+			return nil
+		}
+	}
+
+	data := TagData{
+		Number:  pr.GetNumber(),
+		Title:   pr.GetTitle(),
+		HeadRef: pr.GetHead().GetRef(),
+		SHA:     sha,
+	}
+
+	if config.VersionFile != "" {
+		file, _, _, err := client.Repositories.GetContents(ctx, owner, repo, config.VersionFile, &github.RepositoryContentGetOptions{Ref: sha})
+		if err != nil {
+			return errors.Wrapf(err, "cannot get version file %q", config.VersionFile)
+		}
+		if file == nil {
+			return errors.Errorf("version file %q is a directory", config.VersionFile)
+		}
+
+		content, err := file.GetContent()
+		if err != nil {
+			return errors.Wrapf(err, "cannot decode version file %q", config.VersionFile)
+		}
+		data.Version = strings.TrimSpace(content)
+	}
+
+	tmpl, err := template.New("tag").Parse(config.Name)
+	if err != nil {
+		return errors.Wrapf(err, "invalid tag name template %q", config.Name)
+	}
+
+	var name bytes.Buffer
+	if err := tmpl.Execute(&name, data); err != nil {
+		return errors.Wrap(err, "cannot render tag name")
+	}
+
+	tag := strings.TrimSpace(name.String())
+	if tag == "" {
+		return errors.Errorf("tag name template %q rendered an empty name", config.Name)
+	}
+
+	logger.Debug().Msgf("Attempting to create tag %s at %s", tag, sha)
+	if _, _, err := client.Git.CreateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String("refs/tags/" + tag),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}); err != nil {
+		return errors.Wrapf(err, "cannot create tag %s", tag)
+	}
+	logger.Info().Msgf("Successfully created tag %s at %s", tag, sha)
+
+	if config.DraftRelease {
+		release, _, err := client.Repositories.CreateRelease(ctx, owner, repo, &github.RepositoryRelease{
+			TagName:         github.String(tag),
+			TargetCommitish: github.String(sha),
+			Name:            github.String(tag),
+			Body:            github.String(pr.GetBody()),
+			Draft:           github.Bool(true),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "cannot create draft release for tag %s", tag)
+		}
+		logger.Info().Msgf("Successfully created draft release %s", release.GetHTMLURL())
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// tempBranchCleanupTimeout limits deleting a temporary branch, which happens
+// even if the context of the update was canceled
+const tempBranchCleanupTimeout = 10 * time.Second
+
+// createTempBranch creates the branch at the commit and returns a function
+// that deletes it, which callers defer. A branch with the same name left by
+// an earlier attempt that failed to clean up is moved to the commit instead,
+// so that a leaked branch does not make every later attempt fail.
+func createTempBranch(ctx context.Context, client *github.Client, owner, repo, branch, sha string) (*github.Reference, func(), error) {
+	ref := &github.Reference{
+		Ref:    github.String(fmt.Sprintf("refs/heads/%s", branch)),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}
+
+	_, _, err := client.Git.CreateRef(ctx, owner, repo, ref)
+	if rerr, ok := err.(*github.ErrorResponse); ok && rerr.Response.StatusCode == http.StatusUnprocessableEntity {
+		zerolog.Ctx(ctx).Warn().Msgf("Resetting temporary branch %s left by an earlier attempt", branch)
+		_, _, err = client.Git.UpdateRef(ctx, owner, repo, ref, true)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot create temporary branch %s", branch)
+	}
+
+	cleanup := func() {
+		logger := zerolog.Ctx(ctx)
+
+		// delete the branch even if the update was canceled
+		deleteCtx, cancel := context.WithTimeout(logger.WithContext(context.Background()), tempBranchCleanupTimeout)
+		defer cancel()
+
+		if _, err := client.Git.DeleteRef(deleteCtx, owner, repo, fmt.Sprintf("heads/%s", branch)); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to delete temporary branch %s", branch)
+		}
+	}
+	return ref, cleanup, nil
+}
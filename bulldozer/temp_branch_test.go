@@ -0,0 +1,78 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTempBranch(t *testing.T) {
+	branches := map[string]bool{"bulldozer/update-2": true}
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/refs":
+			var ref github.Reference
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&ref))
+			branch := strings.TrimPrefix(ref.GetRef(), "refs/heads/")
+			if branches[branch] {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(`{"message": "Reference already exists"}`))
+				return
+			}
+			branches[branch] = true
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodPatch:
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodDelete:
+			delete(branches, strings.TrimPrefix(r.URL.Path, "/repos/o/r/git/refs/heads/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, cleanup, err := createTempBranch(ctx, client, "o", "r", "bulldozer/update-1", "abc")
+	require.NoError(t, err)
+	assert.True(t, branches["bulldozer/update-1"])
+
+	// the update was canceled before it finished
+	cancel()
+	cleanup()
+	assert.False(t, branches["bulldozer/update-1"], "branches are deleted even if the context was canceled")
+
+	requests = nil
+	_, cleanup, err = createTempBranch(context.Background(), client, "o", "r", "bulldozer/update-2", "abc")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"POST /repos/o/r/git/refs", "PATCH /repos/o/r/git/refs/heads/bulldozer/update-2"}, requests, "leaked branches are reset")
+	cleanup()
+	assert.Empty(t, branches)
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var trailerPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*):\s+(.*)$`)
+
+// Trailer is a "Key: value" line at the end of a commit message.
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+func (t Trailer) String() string {
+	return t.Key + ": " + t.Value
+}
+
+// ParseTrailers splits a commit message into the message body and the
+// trailers in its final paragraph. If the final paragraph contains any line
+// that is not a trailer, the message has no trailers.
+func ParseTrailers(message string) (string, []Trailer) {
+	message = strings.TrimRight(message, "\n")
+
+	start := strings.LastIndex(message, "\n\n")
+	paragraph := message[start+1:]
+	if start < 0 {
+		paragraph = message
+	}
+
+	var trailers []Trailer
+	for _, line := range strings.Split(strings.TrimSpace(paragraph), "\n") {
+		m := trailerPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			return message, nil
+		}
+		trailers = append(trailers, Trailer{Key: m[1], Value: strings.TrimSpace(m[2])})
+	}
+
+	if start < 0 {
+		return "", trailers
+	}
+	return strings.TrimRight(message[:start], "\n"), trailers
+}
+
+// FormatTrailers appends trailers to a commit message body, separated by a
+// blank line. Trailers with the same key (ignoring case) and value are only
+// included once.
+func FormatTrailers(body string, trailers []Trailer) string {
+	seen := make(map[Trailer]bool)
+
+	var lines []string
+	for _, t := range trailers {
+		k := Trailer{Key: strings.ToLower(t.Key), Value: t.Value}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		lines = append(lines, t.String())
+	}
+
+	if len(lines) == 0 {
+		return body
+	}
+	if body == "" {
+		return strings.Join(lines, "\n")
+	}
+	return body + "\n\n" + strings.Join(lines, "\n")
+}
+
+// AppendTrailers adds trailers to a message, merging them with any trailers
+// already present and removing duplicates.
+func AppendTrailers(message string, trailers []Trailer) string {
+	body, existing := ParseTrailers(message)
+	return FormatTrailers(body, append(existing, trailers...))
+}
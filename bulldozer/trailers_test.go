@@ -0,0 +1,58 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTrailers(t *testing.T) {
+	t.Run("noTrailers", func(t *testing.T) {
+		body, trailers := ParseTrailers("Fix the widget\n\nIt was broken: badly.\nVery badly.")
+		assert.Equal(t, "Fix the widget\n\nIt was broken: badly.\nVery badly.", body)
+		assert.Empty(t, trailers)
+	})
+
+	t.Run("trailers", func(t *testing.T) {
+		body, trailers := ParseTrailers("Fix the widget\n\nDetails\n\nPR: #12\nReviewed-by:  alice\n")
+		assert.Equal(t, "Fix the widget\n\nDetails", body)
+		assert.Equal(t, []Trailer{{"PR", "#12"}, {"Reviewed-by", "alice"}}, trailers)
+	})
+
+	t.Run("onlyTrailers", func(t *testing.T) {
+		body, trailers := ParseTrailers("Signed-off-by: bob")
+		assert.Equal(t, "", body)
+		assert.Equal(t, []Trailer{{"Signed-off-by", "bob"}}, trailers)
+	})
+}
+
+func TestAppendTrailers(t *testing.T) {
+	t.Run("emptyMessage", func(t *testing.T) {
+		msg := AppendTrailers("", []Trailer{{"PR", "#12"}})
+		assert.Equal(t, "PR: #12", msg)
+	})
+
+	t.Run("newParagraph", func(t *testing.T) {
+		msg := AppendTrailers("Fix the widget", []Trailer{{"PR", "#12"}, {"Reviewed-by", "alice"}})
+		assert.Equal(t, "Fix the widget\n\nPR: #12\nReviewed-by: alice", msg)
+	})
+
+	t.Run("deduplicates", func(t *testing.T) {
+		msg := AppendTrailers("Fix the widget\n\nreviewed-by: alice\nPR: #12", []Trailer{{"PR", "#12"}, {"Reviewed-by", "alice"}, {"Reviewed-by", "bob"}})
+		assert.Equal(t, "Fix the widget\n\nreviewed-by: alice\nPR: #12\nReviewed-by: bob", msg)
+	})
+}
@@ -16,98 +16,603 @@ package bulldozer
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/palantir/bulldozer/audit"
 	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/state"
+	"github.com/palantir/bulldozer/tracing"
 )
 
-func ShouldUpdatePR(ctx context.Context, pullCtx pull.Context, updateConfig UpdateConfig) (bool, error) {
+// UpdateTrigger describes why bulldozer attempted to update a pull request.
+type UpdateTrigger string
+
+const (
+	TriggerPush             UpdateTrigger = "push"
+	TriggerSweep            UpdateTrigger = "sweep"
+	TriggerChecksCompleted  UpdateTrigger = "checks_completed"
+	TriggerBranchProtection UpdateTrigger = "branch_protection"
+	TriggerCommand          UpdateTrigger = "command"
+	TriggerRetry            UpdateTrigger = "retry"
+
+	// TriggerProviderEvent is an event from a provider other than GitHub
+	TriggerProviderEvent UpdateTrigger = "provider_event"
+)
+
+// UpdateCheckName is the name of the check run that shows the result of the
+// last update of a pull request.
+const UpdateCheckName = "bulldozer/update"
+
+// maxUpdateAborts is how many times an update is attempted again after the
+// head of the pull request changed during the update
+const maxUpdateAborts = 2
+
+// ShouldUpdatePR returns true if the pull request should be updated. See
+// EvaluateUpdate for the reasons behind the result.
+func ShouldUpdatePR(ctx context.Context, pullCtx pull.Context, updateConfig UpdateConfig, mergeConfig MergeConfig) (bool, error) {
+	decision, err := EvaluateUpdate(ctx, pullCtx, updateConfig, mergeConfig)
+	if err != nil {
+		return false, err
+	}
+	return decision.Eligible, nil
+}
+
+// EvaluateUpdate evaluates every update requirement for the pull request and
+// returns a Decision listing the matched signals and unmet requirements. It
+// does not consider whether the pull request is behind its base branch or
+// the conditions that delay updates; see LastUpdateAttempt for the result of
+// the most recent update. If any requirement cannot be evaluated, it returns
+// an error.
+func EvaluateUpdate(ctx context.Context, pullCtx pull.Context, updateConfig UpdateConfig, mergeConfig MergeConfig) (Decision, error) {
+	ctx, span := tracing.Start(ctx, "bulldozer.evaluate_update")
+	defer span.End()
+	span.SetAttributes(attribute.String("github.pull_request", pullCtx.Locator()))
+
 	logger := zerolog.Ctx(ctx)
 
+	var decision Decision
+
+	login, err := BotLogin(ctx)
+	if err != nil {
+		return Decision{}, err
+	}
+	comments, err := pullCtx.AuthoredComments(ctx)
+	if err != nil {
+		return Decision{}, errors.Wrap(err, "failed to list pull request comments")
+	}
+	if isUpdatePaused(comments, login) {
+		decision.block("updates are paused")
+	}
+
+	if len(updateConfig.IgnoreBranches) > 0 {
+		base, head, err := pullCtx.Branches(ctx)
+		if err != nil {
+			return Decision{}, errors.Wrap(err, "failed to determine pull request branches")
+		}
+		for _, branch := range []string{base, headBranchName(head)} {
+			if pattern := matchAnyGlob(updateConfig.IgnoreBranches, branch); pattern != "" {
+				decision.block(fmt.Sprintf("branch %s matches the ignored pattern %q", branch, pattern))
+			}
+		}
+	}
+
 	if updateConfig.Blacklist.Enabled() {
 		blacklisted, reason, err := IsPRBlacklisted(ctx, pullCtx, updateConfig.Blacklist)
 		if err != nil {
-			return false, errors.Wrap(err, "failed to determine if pull request is blacklisted")
+			return Decision{}, errors.Wrap(err, "failed to determine if pull request is blacklisted")
 		}
 		if blacklisted {
-			logger.Debug().Msgf("%s is deemed not updateable because blacklisting is enabled and %s", pullCtx.Locator(), reason)
-			return false, nil
+			decision.block(fmt.Sprintf("blacklisted: %s", reason))
 		}
 	}
 
 	if updateConfig.Whitelist.Enabled() {
 		whitelisted, reason, err := IsPRWhitelisted(ctx, pullCtx, updateConfig.Whitelist)
 		if err != nil {
-			return false, errors.Wrap(err, "failed to determine if pull request is whitelisted")
+			return Decision{}, errors.Wrap(err, "failed to determine if pull request is whitelisted")
+		}
+		if whitelisted {
+			logger.Debug().Msgf("%s is whitelisted for updates because %s", pullCtx.Locator(), reason)
+			decision.Signals = append(decision.Signals, reason)
+		} else {
+			decision.block("no whitelist signal detected")
+		}
+	}
+
+	if updateConfig.OnlyWhenMergeable {
+		if mergeConfig.Blacklist.Enabled() {
+			blacklisted, reason, err := IsPRBlacklisted(ctx, pullCtx, mergeConfig.Blacklist)
+			if err != nil {
+				return Decision{}, errors.Wrap(err, "failed to determine if pull request is blacklisted for merging")
+			}
+			if blacklisted {
+				decision.block(fmt.Sprintf("blacklisted for merging: %s", reason))
+			}
 		}
-		if !whitelisted {
-			logger.Debug().Msgf("%s is deemed not updateable because whitelisting is enabled and no whitelist signal detected", pullCtx.Locator())
-			return false, nil
+
+		if mergeConfig.Whitelist.Enabled() {
+			whitelisted, _, err := IsPRWhitelisted(ctx, pullCtx, mergeConfig.Whitelist)
+			if err != nil {
+				return Decision{}, errors.Wrap(err, "failed to determine if pull request is whitelisted for merging")
+			}
+			if !whitelisted {
+				decision.block("no merge whitelist signal detected")
+			}
 		}
+	}
 
-		logger.Debug().Msgf("%s is whitelisted because whitelisting is enabled and %s", pullCtx.Locator(), reason)
+	for _, reason := range decision.Reasons {
+		logger.Debug().Msgf("%s is deemed not updateable: %s", pullCtx.Locator(), reason)
 	}
 
-	return true, nil
+	decision.Eligible = len(decision.Reasons) == 0
+	span.SetAttributes(attribute.Bool("bulldozer.eligible", decision.Eligible))
+	return decision, nil
 }
 
-func UpdatePR(ctx context.Context, pullCtx pull.Context, client *github.Client, updateConfig UpdateConfig, baseRef string) error {
+// UpdatePR brings the pull request up to date with the base branch. It blocks
+// until the pull request is updated or it is determined that no update is
+// possible, so callers usually run it in a separate goroutine. Every attempt
+// is recorded as an audit event with the trigger.
+//
+// If the update is skipped because the pull request is not far enough behind
+// its base branch or reached its daily limit, UpdatePR returns the time after
+// which it should be tried again, which is zero if only another push to the
+// base branch can change the result.
+func UpdatePR(ctx context.Context, pullCtx pull.Context, client *github.Client, updateConfig UpdateConfig, mergeConfig MergeConfig, baseRef string, trigger UpdateTrigger) (time.Duration, error) {
 	logger := zerolog.Ctx(ctx)
 
+	event := updateEvent(pullCtx, updateConfig, trigger)
+	record := func(result, detail string) {
+		event.Result = result
+		event.Detail = detail
+		recordUpdate(ctx, event)
+
+		logger.Info().
+			Str("trigger", event.Trigger).
+			Str("result", event.Result).
+			Str("detail", event.Detail).
+			Int("behind_by", event.Commits).
+			Msgf("Update attempt %s", event.Result)
+
+		if err := saveUpdateAttempt(ctx, pullCtx, event); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Failed to save update attempt")
+		}
+	}
+
 	//todo: should the updateConfig struct provide any other details here?
 
-	go func(ctx context.Context, baseRef string) {
-		ticker := time.NewTicker(2 * time.Second)
-		defer ticker.Stop()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
 
-		for i := 0; i < MaxPullRequestPollCount; i++ {
-			<-ticker.C
+	aborted := 0
+	for i := 0; i < MaxPullRequestPollCount; i++ {
+		<-ticker.C
 
-			pr, _, err := client.PullRequests.Get(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
-			if err != nil {
-				logger.Error().Err(errors.WithStack(err)).Msgf("Failed to retrieve pull request %q", pullCtx.Locator())
+		pr, _, err := client.PullRequests.Get(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to retrieve pull request %q", pullCtx.Locator())
+		}
+
+		if pr.GetState() == "closed" {
+			logger.Debug().Msg("Pull request already closed")
+			return 0, nil
+		}
+
+		report := func(sha, conclusion, title, summary string) {
+			if !updateConfig.CheckRun {
 				return
 			}
+			status := CheckRunStatus{Conclusion: conclusion, Title: title, Summary: summary}
+			if err := upsertCheckRun(ctx, client, pullCtx.Owner(), pullCtx.Repo(), sha, pr.GetHead().GetRef(), UpdateCheckName, status); err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msg("Failed to publish update check run")
+			}
+		}
+		head := pr.GetHead().GetSHA()
+		event.SHA = head
 
-			if pr.GetState() == "closed" {
-				logger.Debug().Msg("Pull request already closed")
-				return
+		if problem := headProblem(pr, true); problem != "" {
+			reportHeadProblem(ctx, client, pr, "update", problem)
+			report(head, "neutral", "Not updated", fmt.Sprintf("This pull request cannot be updated because %s.", problem))
+			record(audit.ResultSkipped, problem)
+			return 0, nil
+		}
+
+		comparison, _, err := client.Repositories.CompareCommits(ctx, pullCtx.Owner(), pullCtx.Repo(), baseRef, pr.GetHead().GetSHA())
+		if err != nil {
+			return 0, errors.Wrapf(err, "cannot compare %s and %s for %q", baseRef, pr.GetHead().GetSHA(), pullCtx.Locator())
+		}
+		event.Commits = comparison.GetBehindBy()
+		if comparison.GetBehindBy() == 0 {
+			logger.Debug().Msg("Pull request is not out of date, not updating")
+			clearConflict(ctx, client, pr, updateConfig)
+			report(head, "success", "Up to date", fmt.Sprintf("This pull request contains every commit on `%s`.", baseRef))
+			return 0, nil
+		}
+
+		logger.Debug().Msg("Pull request is not up to date")
+
+		if updateConfig.MinCommitsBehind > 0 || updateConfig.MinTimeBehind > 0 {
+			// the comparison lists at most 250 commits, but behind_by
+			// counts all of them
+			now := time.Now()
+			var behindSince time.Time
+			if updateConfig.MinTimeBehind > 0 {
+				if behindSince, err = firstSeenBehind(ctx, pullCtx, comparison.GetMergeBaseCommit().GetSHA(), now); err != nil {
+					return 0, err
+				}
 			}
 
-			if pr.Head.Repo.GetFork() {
-				logger.Debug().Msg("Pull request is from a fork, cannot keep it up to date with base ref")
-				return
+			if !isBehindEnough(comparison.GetBehindBy(), behindSince, now, updateConfig) {
+				logger.Debug().Msgf("Pull request is only %d commits behind base ref %s, not updating", comparison.GetBehindBy(), baseRef)
+				report(head, "neutral", "Not updated", fmt.Sprintf("This pull request is %d commits behind `%s`, which is not far enough behind to update it.", comparison.GetBehindBy(), baseRef))
+				record(audit.ResultSkipped, "not far enough behind the base branch")
+
+				var retry time.Duration
+				if updateConfig.MinTimeBehind > 0 {
+					retry = behindSince.Add(updateConfig.MinTimeBehind).Sub(now)
+				}
+				return retry, nil
 			}
+		}
 
-			comparison, _, err := client.Repositories.CompareCommits(ctx, pullCtx.Owner(), pullCtx.Repo(), baseRef, pr.GetHead().GetSHA())
+		if updateConfig.MaxPerDay > 0 {
+			count, err := updateCount(ctx, pullCtx)
 			if err != nil {
-				logger.Error().Err(errors.WithStack(err)).Msgf("cannot compare %s and %s for %q", baseRef, pr.GetHead().GetSHA(), pullCtx.Locator())
+				return 0, err
 			}
-			if comparison.GetBehindBy() > 0 {
-				logger.Debug().Msg("Pull request is not up to date")
+			if count >= updateConfig.MaxPerDay {
+				logger.Info().Msgf("Pull request was already updated %d times in the last day, not updating", count)
+				report(head, "neutral", "Not updated", fmt.Sprintf("This pull request was already updated %d times in the last day.", count))
+				record(audit.ResultSkipped, "daily update limit reached")
+				return updateCountReset(ctx, pullCtx), nil
+			}
+		}
 
-				mergeRequest := &github.RepositoryMergeRequest{
-					Base: github.String(pr.Head.GetRef()),
-					Head: github.String(baseRef),
-				}
+		if updateConfig.WaitForChecks {
+			running, err := checksInProgress(ctx, client, pullCtx.Owner(), pullCtx.Repo(), pr.GetHead().GetSHA(), mergeConfig.PolicyBot)
+			if err != nil {
+				return 0, err
+			}
+			if len(running) > 0 {
+				logger.Debug().Msgf("Deferring update until running checks finish: [%s]", strings.Join(running, ","))
+				report(head, "neutral", "Waiting for checks", fmt.Sprintf("This pull request will be updated when these checks finish: %s", strings.Join(running, ", ")))
+				record(audit.ResultSkipped, fmt.Sprintf("waiting for checks: %s", strings.Join(running, ", ")))
+				return 0, nil
+			}
+		}
 
-				mergeCommit, _, err := client.Repositories.Merge(ctx, pullCtx.Owner(), pullCtx.Repo(), mergeRequest)
-				if err != nil {
-					logger.Error().Err(errors.WithStack(err)).Msg("Merge failed unexpectedly")
-				}
+		// the update branch API pushes as GitHub, the other methods push
+		// with a client that can write to the head branch
+		var writer *github.Client
+		if updateConfig.Method != UpdateBranchAPI {
+			if writer, err = headClient(ctx, client, pr); err != nil {
+				return 0, err
+			}
+			if writer == nil {
+				reportHeadProblem(ctx, client, pr, "update", forkNotInstalledProblem)
+				report(head, "neutral", "Not updated", fmt.Sprintf("This pull request cannot be updated because %s. Install bulldozer on the fork or use the `%s` update method.", forkNotInstalledProblem, UpdateBranchAPI))
+				record(audit.ResultSkipped, forkNotInstalledProblem)
+				return 0, nil
+			}
+		}
+
+		started := time.Now()
 
+		switch updateConfig.Method {
+		case UpdateBranchAPI:
+			err = updateBranch(ctx, client, pr)
+			if err == nil {
+				logger.Info().Msgf("Requested update of pull request from base ref %s", baseRef)
+				report(head, "success", "Update requested", fmt.Sprintf("GitHub is merging `%s` into this pull request.", baseRef))
+			}
+		case UpdateRebase:
+			var sha string
+			if sha, err = rebaseHeadOntoBase(ctx, client, writer, pr, updateConfig.Autosquash); err == nil {
+				logger.Info().Msgf("Successfully rebased pull request onto base ref %s as %s", baseRef, sha)
+				event.UpdateSHA = sha
+				report(sha, "success", "Updated", fmt.Sprintf("Rebased this pull request onto `%s` as %s.", baseRef, sha))
+			}
+		default:
+			var mergeCommit *github.RepositoryCommit
+			if mergeCommit, err = mergeBaseIntoHead(ctx, client, writer, pr); err == nil {
 				logger.Info().Msgf("Successfully updated pull request from base ref %s as merge %s", baseRef, mergeCommit.GetSHA())
-			} else {
-				logger.Debug().Msg("Pull request is not out of date, not updating")
+				event.UpdateSHA = mergeCommit.GetSHA()
+				report(mergeCommit.GetSHA(), "success", "Updated", fmt.Sprintf("Merged `%s` into this pull request as %s.", baseRef, mergeCommit.GetSHA()))
 			}
+		}
+		event.DurationMillis = int64(time.Since(started) / time.Millisecond)
 
-			return
+		switch {
+		case err == nil:
+			record(audit.ResultUpdated, "")
+			if updateConfig.MaxPerDay > 0 {
+				if err := countUpdate(ctx, pullCtx); err != nil {
+					logger.Error().Err(errors.WithStack(err)).Msg("Failed to record update")
+				}
+			}
+			clearConflict(ctx, client, pr, updateConfig)
+		case isUpdateConflict(err):
+			logger.Info().Msgf("Cannot update pull request from base ref %s because of conflicts: %s", baseRef, err.Error())
+			if err := reportConflict(ctx, client, pr, updateConfig); err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msg("Failed to report update conflict")
+			}
+			report(head, "failure", "Conflicts", fmt.Sprintf("This pull request cannot be updated because it conflicts with `%s`: %s", baseRef, err.Error()))
+			record(audit.ResultConflict, err.Error())
+		default:
+			if _, ok := errors.Cause(err).(headChangedError); ok {
+				// the author pushed while updating; evaluate the new head
+				logger.Info().Msgf("Did not update pull request from base ref %s because the head changed: %s", baseRef, err.Error())
+				report(head, "neutral", "Not updated", fmt.Sprintf("The update was abandoned because the head of this pull request changed: %s", err.Error()))
+				record(audit.ResultAborted, err.Error())
+				if aborted++; aborted >= maxUpdateAborts {
+					logger.Info().Msgf("Giving up on updating pull request after the head changed %d times", aborted)
+					return 0, nil
+				}
+				continue
+			}
+			report(head, "failure", "Update failed", "The update failed unexpectedly. It will be retried when the base branch changes.")
+			record(audit.ResultFailed, err.Error())
+			return 0, errors.Wrap(err, "update failed unexpectedly")
 		}
-	}(zerolog.Ctx(ctx).WithContext(context.Background()), baseRef)
 
+		return 0, nil
+	}
+
+	return 0, nil
+}
+
+// lastUpdateKey is the state key of the last update attempt of a pull request.
+func lastUpdateKey(pullCtx pull.Context) string {
+	return "last-update/" + pullCtx.Locator()
+}
+
+// saveUpdateAttempt stores the event as the last update attempt of the pull
+// request.
+func saveUpdateAttempt(ctx context.Context, pullCtx pull.Context, event audit.Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal update attempt")
+	}
+	return state.Ctx(ctx).Set(ctx, lastUpdateKey(pullCtx), b, 7*24*time.Hour)
+}
+
+// LastUpdateAttempt returns the audit event of the most recent update attempt
+// of the pull request and true, or false if no attempt was made in the last
+// week or since the server started.
+func LastUpdateAttempt(ctx context.Context, pullCtx pull.Context) (audit.Event, bool, error) {
+	b, ok, err := state.Ctx(ctx).Get(ctx, lastUpdateKey(pullCtx))
+	if err != nil || !ok {
+		return audit.Event{}, false, errors.Wrap(err, "failed to get last update attempt")
+	}
+
+	var event audit.Event
+	if err := json.Unmarshal(b, &event); err != nil {
+		return audit.Event{}, false, errors.Wrap(err, "failed to unmarshal last update attempt")
+	}
+	return event, true, nil
+}
+
+// updateCountKey is the state key counting the updates of a pull request in
+// the current day. The counter resets a day after the first update.
+func updateCountKey(pullCtx pull.Context) string {
+	return "updates/" + pullCtx.Locator()
+}
+
+// updateResetKey is the state key of the time at which the update counter of
+// a pull request resets.
+func updateResetKey(pullCtx pull.Context) string {
+	return "updates-reset/" + pullCtx.Locator()
+}
+
+// countUpdate counts an update of the pull request in the current day.
+func countUpdate(ctx context.Context, pullCtx pull.Context) error {
+	store := state.Ctx(ctx)
+
+	n, err := store.Increment(ctx, updateCountKey(pullCtx), 24*time.Hour)
+	if err != nil {
+		return errors.Wrap(err, "failed to count update")
+	}
+	if n == 1 {
+		b, err := time.Now().Add(24 * time.Hour).UTC().MarshalText()
+		if err == nil {
+			err = store.Set(ctx, updateResetKey(pullCtx), b, 24*time.Hour)
+		}
+		return errors.Wrap(err, "failed to record when the update count resets")
+	}
 	return nil
 }
+
+// updateCountReset returns the time until the update counter of the pull
+// request resets, or a day if it is not known.
+func updateCountReset(ctx context.Context, pullCtx pull.Context) time.Duration {
+	b, ok, err := state.Ctx(ctx).Get(ctx, updateResetKey(pullCtx))
+	if err != nil || !ok {
+		return 24 * time.Hour
+	}
+
+	var reset time.Time
+	if err := reset.UnmarshalText(b); err != nil {
+		return 24 * time.Hour
+	}
+	if remaining := time.Until(reset); remaining > 0 {
+		return remaining
+	}
+	return time.Minute
+}
+
+// updateCount returns the number of times the pull request was updated in
+// the current day.
+func updateCount(ctx context.Context, pullCtx pull.Context) (int, error) {
+	value, ok, err := state.Ctx(ctx).Get(ctx, updateCountKey(pullCtx))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get update count")
+	}
+	if !ok {
+		return 0, nil
+	}
+
+	count, err := strconv.Atoi(string(value))
+	return count, errors.Wrap(err, "invalid update count")
+}
+
+// isBehindEnough returns true if a pull request that is behindBy commits
+// behind its base branch, and was first seen behind at behindSince, exceeds
+// either of the configured thresholds.
+func isBehindEnough(behindBy int, behindSince, now time.Time, updateConfig UpdateConfig) bool {
+	if updateConfig.MinCommitsBehind > 0 && behindBy >= updateConfig.MinCommitsBehind {
+		return true
+	}
+	if updateConfig.MinTimeBehind > 0 && !behindSince.IsZero() && now.Sub(behindSince) >= updateConfig.MinTimeBehind {
+		return true
+	}
+	return false
+}
+
+// behindSinceTTL is how long the time a pull request was first seen behind
+// its base branch is kept
+const behindSinceTTL = 30 * 24 * time.Hour
+
+// firstSeenBehind returns the time at which bulldozer first saw the pull
+// request behind its base branch with the merge base, recording now if it was
+// not seen before. Commit dates are set by their authors, so they cannot tell
+// how long the base branch has moved on. The time resets when the pull
+// request is updated, which changes the merge base, but not when its author
+// pushes to it.
+func firstSeenBehind(ctx context.Context, pullCtx pull.Context, mergeBase string, now time.Time) (time.Time, error) {
+	store := state.Ctx(ctx)
+	key := fmt.Sprintf("behind-since/%s/%s", pullCtx.Locator(), mergeBase)
+
+	b, err := now.UTC().MarshalText()
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to marshal time")
+	}
+	if _, err := store.SetIfAbsent(ctx, key, b, behindSinceTTL); err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to record when the pull request fell behind")
+	}
+
+	b, ok, err := store.Get(ctx, key)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to get when the pull request fell behind")
+	}
+
+	var since time.Time
+	if !ok || since.UnmarshalText(b) != nil {
+		return now, nil
+	}
+	return since, nil
+}
+
+// checksInProgress returns the names of the pending statuses and incomplete
+// check runs for the commit. Check runs created by bulldozer and the status
+// of policy-bot are ignored.
+func checksInProgress(ctx context.Context, client *github.Client, owner, repo, sha string, policyBot PolicyBotConfig) ([]string, error) {
+	var running []string
+
+	status, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot get statuses for %s", sha)
+	}
+	for _, s := range status.Statuses {
+		// policy-bot is pending while it waits for reviews, not for a build
+		if s.GetState() == "pending" && !IsOwnCheck(s.GetContext()) && !policyBot.IsStatus(s.GetContext()) {
+			running = append(running, s.GetContext())
+		}
+	}
+
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, res, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot list check runs for %s", sha)
+		}
+		for _, run := range runs.CheckRuns {
+			if run.GetStatus() != "completed" && !IsOwnCheck(run.GetName()) {
+				running = append(running, run.GetName())
+			}
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	return running, nil
+}
+
+// isUpdateConflict returns true if the error from an update means that the
+// pull request conflicts with its base branch.
+func isUpdateConflict(err error) bool {
+	switch err := errors.Cause(err).(type) {
+	case rebaseConflictError:
+		return true
+	case headChangedError:
+		return strings.Contains(strings.ToLower(err.message), "conflict")
+	case *github.ErrorResponse:
+		return err.Response.StatusCode == http.StatusConflict
+	}
+	return false
+}
+
+// mergeBaseIntoHead updates the head branch of the pull request by merging
+// the base branch into it, returning the new merge commit. The merge API can
+// only merge into a branch, so the merge is created on a temporary branch at
+// the head of the pull request and the head branch is fast-forwarded to it
+// with the head writer, so that the update fails with headChangedError
+// instead of landing on top of commits pushed in the meantime. The temporary
+// branch triggers push webhooks like any other branch; CI that runs on every
+// branch should ignore "bulldozer/update-*".
+func mergeBaseIntoHead(ctx context.Context, client, headWriter *github.Client, pr *github.PullRequest) (*github.RepositoryCommit, error) {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	tempBranch := fmt.Sprintf("bulldozer/update-%d", pr.GetNumber())
+	_, cleanup, err := createTempBranch(ctx, client, owner, repo, tempBranch, pr.GetHead().GetSHA())
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	mergeCommit, _, err := client.Repositories.Merge(ctx, owner, repo, &github.RepositoryMergeRequest{
+		Base:          github.String(tempBranch),
+		Head:          github.String(pr.GetBase().GetRef()),
+		CommitMessage: github.String(fmt.Sprintf("Merge branch '%s' into %s", pr.GetBase().GetRef(), pr.GetHead().GetRef())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the head branch of a pull request from a fork is pushed in the fork,
+	// which shares objects with the base repository
+	headRef := &github.Reference{
+		Ref:    github.String(fmt.Sprintf("refs/heads/%s", pr.GetHead().GetRef())),
+		Object: &github.GitObject{SHA: mergeCommit.SHA},
+	}
+	headOwner := pr.GetHead().GetRepo().GetOwner().GetLogin()
+	headRepo := pr.GetHead().GetRepo().GetName()
+
+	if _, _, err := headWriter.Git.UpdateRef(ctx, headOwner, headRepo, headRef, false); err != nil {
+		// GitHub rejects fast-forwards for other reasons too, such as branch
+		// protection on the head branch, so only a head that actually moved
+		// abandons the update quietly
+		if rerr, ok := err.(*github.ErrorResponse); ok && rerr.Response.StatusCode == http.StatusUnprocessableEntity {
+			current, _, gerr := headWriter.Git.GetRef(ctx, headOwner, headRepo, fmt.Sprintf("heads/%s", pr.GetHead().GetRef()))
+			if gerr == nil && current.GetObject().GetSHA() != pr.GetHead().GetSHA() {
+				return nil, headChangedError{message: fmt.Sprintf("the head of the pull request moved to %s while updating", current.GetObject().GetSHA())}
+			}
+		}
+		return nil, errors.Wrapf(err, "cannot update head branch %s", pr.GetHead().GetRef())
+	}
+	return mergeCommit, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// updateBranchPreview enables the update branch endpoint, which is not yet
+// part of the stable API.
+const updateBranchPreview = "application/vnd.github.lydian-preview+json"
+
+type updateBranchRequest struct {
+	ExpectedHeadSHA string `json:"expected_head_sha"`
+}
+
+// headChangedError is returned when an update is abandoned because the head
+// of the pull request changed after bulldozer read it. The update branch
+// endpoint also returns it when the update conflicts with the base branch.
+type headChangedError struct {
+	message string
+}
+
+func (e headChangedError) Error() string {
+	return e.message
+}
+
+// updateBranch asks GitHub to merge the base branch into the head branch of
+// the pull request with the update branch endpoint. The update is only
+// performed if the head of the pull request is still the head in pr. GitHub
+// performs the update asynchronously, so this returns before the head changes.
+func updateBranch(ctx context.Context, client *github.Client, pr *github.PullRequest) error {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+
+	u := fmt.Sprintf("repos/%v/%v/pulls/%d/update-branch", owner, repo, pr.GetNumber())
+	req, err := client.NewRequest("PUT", u, &updateBranchRequest{ExpectedHeadSHA: pr.GetHead().GetSHA()})
+	if err != nil {
+		return errors.Wrap(err, "cannot create update branch request")
+	}
+	req.Header.Set("Accept", updateBranchPreview)
+
+	_, err = client.Do(ctx, req, nil)
+	switch err := err.(type) {
+	case nil, *github.AcceptedError:
+		return nil
+	case *github.ErrorResponse:
+		if err.Response.StatusCode == http.StatusUnprocessableEntity {
+			return headChangedError{message: err.Message}
+		}
+	}
+	return errors.Wrapf(err, "cannot update branch of pull request %d", pr.GetNumber())
+}
@@ -0,0 +1,340 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bulldozer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/pull/pulltest"
+	"github.com/palantir/bulldozer/state"
+)
+
+func TestShouldUpdatePR(t *testing.T) {
+	updateConfig := UpdateConfig{
+		Whitelist: Signals{
+			Labels: []string{"update me"},
+		},
+	}
+	mergeConfig := MergeConfig{
+		Whitelist: Signals{
+			Labels: []string{"merge when ready"},
+		},
+	}
+
+	ctx := WithBotLogin(context.Background(), "bulldozer[bot]")
+
+	t.Run("updateSignalOnly", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue: []string{"update me"},
+		}
+
+		shouldUpdate, err := ShouldUpdatePR(ctx, pc, updateConfig, mergeConfig)
+		require.Nil(t, err)
+		assert.True(t, shouldUpdate)
+
+		mergeableConfig := updateConfig
+		mergeableConfig.OnlyWhenMergeable = true
+
+		shouldUpdate, err = ShouldUpdatePR(ctx, pc, mergeableConfig, mergeConfig)
+		require.Nil(t, err)
+		assert.False(t, shouldUpdate)
+	})
+
+	t.Run("pausedShouldntUpdate", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:           []string{"update me"},
+			AuthoredCommentValue: []pull.Comment{{Author: "bulldozer[bot]", Body: pauseUpdatesMarker + "\nUpdates of this pull request are paused"}},
+		}
+
+		shouldUpdate, err := ShouldUpdatePR(ctx, pc, updateConfig, mergeConfig)
+		require.Nil(t, err)
+		assert.False(t, shouldUpdate)
+	})
+
+	t.Run("forgedPauseIgnored", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue:           []string{"update me"},
+			AuthoredCommentValue: []pull.Comment{{Author: "mallory", Body: pauseUpdatesMarker + "\nUpdates of this pull request are paused"}},
+		}
+
+		shouldUpdate, err := ShouldUpdatePR(ctx, pc, updateConfig, mergeConfig)
+		require.Nil(t, err)
+		assert.True(t, shouldUpdate)
+	})
+
+	t.Run("ignoredBranchShouldntUpdate", func(t *testing.T) {
+		ignoreConfig := updateConfig
+		ignoreConfig.IgnoreBranches = []string{"release/*", "wip/*"}
+
+		pc := &pulltest.MockPullContext{
+			LabelValue: []string{"update me"},
+			BranchBase: "develop",
+			BranchName: "feature/update",
+		}
+
+		shouldUpdate, err := ShouldUpdatePR(ctx, pc, ignoreConfig, mergeConfig)
+		require.Nil(t, err)
+		assert.True(t, shouldUpdate)
+
+		pc.BranchBase = "release/1.0"
+		shouldUpdate, err = ShouldUpdatePR(ctx, pc, ignoreConfig, mergeConfig)
+		require.Nil(t, err)
+		assert.False(t, shouldUpdate)
+
+		pc.BranchBase = "develop"
+		pc.BranchName = "wip/update"
+		shouldUpdate, err = ShouldUpdatePR(ctx, pc, ignoreConfig, mergeConfig)
+		require.Nil(t, err)
+		assert.False(t, shouldUpdate)
+
+		pc.BranchName = "contributor:wip/update"
+		shouldUpdate, err = ShouldUpdatePR(ctx, pc, ignoreConfig, mergeConfig)
+		require.Nil(t, err)
+		assert.False(t, shouldUpdate, "branches from forks match without the owner")
+	})
+
+	t.Run("updateAndMergeSignals", func(t *testing.T) {
+		pc := &pulltest.MockPullContext{
+			LabelValue: []string{"update me", "merge when ready"},
+		}
+
+		mergeableConfig := updateConfig
+		mergeableConfig.OnlyWhenMergeable = true
+
+		shouldUpdate, err := ShouldUpdatePR(ctx, pc, mergeableConfig, mergeConfig)
+		require.Nil(t, err)
+		assert.True(t, shouldUpdate)
+	})
+}
+
+func TestEvaluateUpdate(t *testing.T) {
+	updateConfig := UpdateConfig{
+		Whitelist: Signals{
+			Labels: []string{"update me"},
+		},
+		IgnoreBranches:    []string{"release/*"},
+		OnlyWhenMergeable: true,
+	}
+	mergeConfig := MergeConfig{
+		Whitelist: Signals{
+			Labels: []string{"merge when ready"},
+		},
+	}
+
+	pc := &pulltest.MockPullContext{
+		BranchBase:           "release/1.0",
+		BranchName:           "feature",
+		AuthoredCommentValue: []pull.Comment{{Author: "bulldozer[bot]", Body: pauseUpdatesMarker + "\nUpdates of this pull request are paused"}},
+	}
+
+	decision, err := EvaluateUpdate(WithBotLogin(context.Background(), "bulldozer[bot]"), pc, updateConfig, mergeConfig)
+	require.Nil(t, err)
+	assert.False(t, decision.Eligible)
+	assert.Equal(t, []string{
+		"updates are paused",
+		"branch release/1.0 matches the ignored pattern \"release/*\"",
+		"no whitelist signal detected",
+		"no merge whitelist signal detected",
+	}, decision.Reasons)
+}
+
+func TestIsBehindEnough(t *testing.T) {
+	now := time.Now()
+
+	commitsConfig := UpdateConfig{MinCommitsBehind: 5}
+	assert.False(t, isBehindEnough(4, time.Time{}, now, commitsConfig))
+	assert.True(t, isBehindEnough(5, time.Time{}, now, commitsConfig))
+
+	timeConfig := UpdateConfig{MinTimeBehind: 24 * time.Hour}
+	assert.False(t, isBehindEnough(100, now.Add(-time.Hour), now, timeConfig))
+	assert.True(t, isBehindEnough(1, now.Add(-25*time.Hour), now, timeConfig))
+
+	bothConfig := UpdateConfig{MinCommitsBehind: 5, MinTimeBehind: 24 * time.Hour}
+	assert.False(t, isBehindEnough(1, now.Add(-time.Hour), now, bothConfig))
+	assert.True(t, isBehindEnough(5, now.Add(-time.Hour), now, bothConfig))
+	assert.True(t, isBehindEnough(1, now.Add(-25*time.Hour), now, bothConfig))
+}
+
+func TestFirstSeenBehind(t *testing.T) {
+	ctx := state.WithStore(context.Background(), state.NewMemoryStore())
+	pc := &pulltest.MockPullContext{LocatorValue: "owner/repo#1"}
+	first := time.Now().Add(-time.Hour).UTC()
+
+	since, err := firstSeenBehind(ctx, pc, "base1", first)
+	require.Nil(t, err)
+	assert.True(t, first.Equal(since))
+
+	since, err = firstSeenBehind(ctx, pc, "base1", time.Now())
+	require.Nil(t, err)
+	assert.True(t, first.Equal(since), "the first time is kept while the merge base is the same")
+
+	now := time.Now().UTC()
+	since, err = firstSeenBehind(ctx, pc, "base2", now)
+	require.Nil(t, err)
+	assert.True(t, now.Equal(since), "updates change the merge base and restart the time")
+}
+
+func TestUpdateCountReset(t *testing.T) {
+	ctx := state.WithStore(context.Background(), state.NewMemoryStore())
+	pc := &pulltest.MockPullContext{LocatorValue: "owner/repo#1"}
+
+	assert.Equal(t, 24*time.Hour, updateCountReset(ctx, pc), "unknown resets wait a day")
+
+	require.Nil(t, countUpdate(ctx, pc))
+	require.Nil(t, countUpdate(ctx, pc))
+
+	count, err := updateCount(ctx, pc)
+	require.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	reset := updateCountReset(ctx, pc)
+	assert.True(t, reset > 23*time.Hour && reset <= 24*time.Hour, "the counter resets a day after the first update")
+}
+
+func TestSortForUpdate(t *testing.T) {
+	newPR := func(number int, labels ...string) *github.PullRequest {
+		pr := &github.PullRequest{Number: github.Int(number)}
+		for _, label := range labels {
+			pr.Labels = append(pr.Labels, &github.Label{Name: github.String(label)})
+		}
+		return pr
+	}
+
+	numbers := func(prs []*github.PullRequest) []int {
+		var n []int
+		for _, pr := range prs {
+			n = append(n, pr.GetNumber())
+		}
+		return n
+	}
+
+	updateConfig := UpdateConfig{
+		PriorityLabels: []string{"hotfix", "important"},
+	}
+	queuePositions := map[int]int{6: 1, 4: 0}
+
+	prs := []*github.PullRequest{newPR(7), newPR(6), newPR(5, "important"), newPR(4), newPR(3), newPR(2, "hotfix"), newPR(1)}
+	SortForUpdate(prs, queuePositions, updateConfig)
+	assert.Equal(t, []int{2, 5, 4, 6, 1, 3, 7}, numbers(prs))
+
+	updateConfig.Order = UpdateOrderOldest
+	SortForUpdate(prs, queuePositions, updateConfig)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7}, numbers(prs))
+}
+
+func TestHeadClient(t *testing.T) {
+	ctx := context.Background()
+	baseClient := github.NewClient(nil)
+	forkClient := github.NewClient(nil)
+
+	base := &github.PullRequestBranch{Repo: &github.Repository{ID: github.Int64(1)}}
+	pr := &github.PullRequest{
+		Base: base,
+		Head: &github.PullRequestBranch{Repo: &github.Repository{ID: github.Int64(1)}},
+	}
+	client, err := headClient(ctx, baseClient, pr)
+	require.Nil(t, err)
+	assert.True(t, client == baseClient, "pull requests from the base repository use its client")
+
+	fork := &github.PullRequest{
+		Base: base,
+		Head: &github.PullRequestBranch{Repo: &github.Repository{
+			ID:    github.Int64(2),
+			Name:  github.String("repo"),
+			Owner: &github.User{Login: github.String("fork")},
+		}},
+	}
+	client, err = headClient(ctx, baseClient, fork)
+	require.Nil(t, err)
+	assert.Nil(t, client, "forks need an installation on the fork")
+
+	ctx = WithInstallationClients(ctx, func(ctx context.Context, owner, repo string) (*github.Client, error) {
+		if owner == "fork" && repo == "repo" {
+			return forkClient, nil
+		}
+		return nil, nil
+	})
+	client, err = headClient(ctx, baseClient, fork)
+	require.Nil(t, err)
+	assert.True(t, client == forkClient, "forks use the installation on the fork")
+}
+
+func newMergeBaseServer(t *testing.T, currentHead string) *github.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/git/refs":
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/repos/o/r/git/refs/heads/bulldozer/update-1":
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && r.URL.Path == "/repos/o/r/merges":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"sha": "merged"}`))
+		case r.Method == http.MethodPatch && r.URL.Path == "/repos/o/r/git/refs/heads/feature":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"message": "Update is not a fast forward"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/repos/o/r/git/refs/heads/feature":
+			_, _ = fmt.Fprintf(w, `{"ref": "refs/heads/feature", "object": {"sha": %q}}`, currentHead)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return client
+}
+
+func TestMergeBaseIntoHead(t *testing.T) {
+	repo := &github.Repository{
+		Name:  github.String("r"),
+		Owner: &github.User{Login: github.String("o")},
+	}
+	pr := &github.PullRequest{
+		Number: github.Int(1),
+		Base:   &github.PullRequestBranch{Ref: github.String("develop"), Repo: repo},
+		Head:   &github.PullRequestBranch{Ref: github.String("feature"), SHA: github.String("head"), Repo: repo},
+	}
+
+	t.Run("headMoved", func(t *testing.T) {
+		client := newMergeBaseServer(t, "pushed")
+
+		_, err := mergeBaseIntoHead(context.Background(), client, client, pr)
+		_, ok := errors.Cause(err).(headChangedError)
+		assert.True(t, ok, "expected headChangedError, got %v", err)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		client := newMergeBaseServer(t, "head")
+
+		_, err := mergeBaseIntoHead(context.Background(), client, client, pr)
+		require.NotNil(t, err)
+		_, ok := errors.Cause(err).(headChangedError)
+		assert.False(t, ok, "a rejected update of an unchanged head is an error")
+	})
+}
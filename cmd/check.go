@@ -0,0 +1,122 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/bulldozer/server"
+	"github.com/palantir/bulldozer/server/handler"
+)
+
+var checkCmdConfig struct {
+	Path        string
+	Owner       string
+	Repo        string
+	PullRequest int
+	JSON        bool
+}
+
+var CheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Prints how bulldozer evaluates a pull request.",
+	Long: "Authenticates as the GitHub App in the server configuration, fetches the repository configuration and the " +
+		"state of the pull request, and prints the merge and update decisions with their signals and reasons. " +
+		"Nothing is changed on GitHub.",
+
+	RunE: checkCmd,
+}
+
+func checkCmd(cmd *cobra.Command, args []string) error {
+	if checkCmdConfig.Owner == "" || checkCmdConfig.Repo == "" || checkCmdConfig.PullRequest <= 0 {
+		return errors.New("--owner, --repo, and --pr are required")
+	}
+
+	cfg, err := readServerConfig(checkCmdConfig.Path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read server config")
+	}
+
+	level := zerolog.WarnLevel
+	if IsDebugMode() {
+		level = zerolog.DebugLevel
+	}
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(level).With().Timestamp().Logger()
+
+	status, err := server.CheckPullRequest(logger.WithContext(context.Background()), cfg, checkCmdConfig.Owner, checkCmdConfig.Repo, checkCmdConfig.PullRequest)
+	if err != nil {
+		return err
+	}
+
+	if checkCmdConfig.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	printCheck(os.Stdout, status)
+	return nil
+}
+
+func printCheck(w io.Writer, status *handler.PullRequestState) {
+	fmt.Fprintf(w, "Configuration: %s\n", status.Config)
+	if !status.Valid {
+		fmt.Fprintf(w, "Not evaluated: %s\n", status.Error)
+		return
+	}
+
+	printDecision(w, "Merge", status.Merge)
+	printDecision(w, "Update", status.Update)
+
+	if status.Queue != nil {
+		fmt.Fprintf(w, "Merge queue: position %d in %s\n", status.Queue.Position+1, status.Queue.Key)
+	}
+}
+
+func printDecision(w io.Writer, name string, d *handler.DecisionStatus) {
+	if d == nil {
+		return
+	}
+
+	verdict := "not eligible"
+	if d.Eligible {
+		verdict = "eligible"
+	}
+	fmt.Fprintf(w, "%s: %s\n", name, verdict)
+	if len(d.Signals) > 0 {
+		fmt.Fprintf(w, "  signals: %s\n", strings.Join(d.Signals, ", "))
+	}
+	for _, reason := range d.Reasons {
+		fmt.Fprintf(w, "  - %s\n", reason)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(CheckCmd)
+
+	CheckCmd.Flags().StringVarP(&checkCmdConfig.Path, "config", "c", "config/bulldozer.yml", "configuration file for bulldozer")
+	CheckCmd.Flags().StringVar(&checkCmdConfig.Owner, "owner", "", "owner of the repository")
+	CheckCmd.Flags().StringVar(&checkCmdConfig.Repo, "repo", "", "name of the repository")
+	CheckCmd.Flags().IntVar(&checkCmdConfig.PullRequest, "pr", 0, "number of the pull request")
+	CheckCmd.Flags().BoolVar(&checkCmdConfig.JSON, "json", false, "print the result as JSON")
+}
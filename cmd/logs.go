@@ -0,0 +1,121 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/bulldozer/server/handler"
+)
+
+var logsCmdConfig struct {
+	CorrelationID string
+	DeliveryID    string
+	PullRequest   string
+}
+
+var LogsCmd = &cobra.Command{
+	Use:   "logs [file...]",
+	Short: "Prints the server log lines for a delivery or pull request.",
+	Long: "Reads JSON server logs from the files, or from standard input if no files are given, and prints the lines " +
+		"that match all of the filters. Lines that are not JSON are skipped.",
+
+	RunE: logsCmd,
+}
+
+func logsCmd(cmd *cobra.Command, args []string) error {
+	if logsCmdConfig.CorrelationID == "" && logsCmdConfig.DeliveryID == "" && logsCmdConfig.PullRequest == "" {
+		return errors.New("at least one of --correlation-id, --delivery, or --pr is required")
+	}
+
+	if len(args) == 0 {
+		return filterLogs(os.Stdin, os.Stdout)
+	}
+	for _, path := range args {
+		f, err := os.Open(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open log file %s", path)
+		}
+		err = filterLogs(f, os.Stdout)
+		_ = f.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to read log file %s", path)
+		}
+	}
+	return nil
+}
+
+func filterLogs(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var fields map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil {
+			continue
+		}
+		if matchesLogFilters(fields) {
+			if _, err := fmt.Fprintln(w, scanner.Text()); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func matchesLogFilters(fields map[string]interface{}) bool {
+	correlationID, _ := fields[handler.LogKeyCorrelationID].(string)
+
+	if id := logsCmdConfig.CorrelationID; id != "" && correlationID != id {
+		return false
+	}
+
+	if id := logsCmdConfig.DeliveryID; id != "" {
+		deliveryID, _ := fields[githubapp.LogKeyDeliveryID].(string)
+		if deliveryID != id && !strings.HasPrefix(correlationID, id+":") {
+			return false
+		}
+	}
+
+	if pr := logsCmdConfig.PullRequest; pr != "" {
+		owner, _ := fields[githubapp.LogKeyRepositoryOwner].(string)
+		repo, _ := fields[githubapp.LogKeyRepositoryName].(string)
+		number, _ := fields[githubapp.LogKeyPRNum].(float64)
+		logged := fmt.Sprintf("%s/%s#%d", owner, repo, int(number))
+
+		if logged != pr && correlationID != pr && !strings.HasSuffix(correlationID, ":"+pr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func init() {
+	RootCmd.AddCommand(LogsCmd)
+
+	LogsCmd.Flags().StringVar(&logsCmdConfig.CorrelationID, "correlation-id", "", "print lines with this correlation ID")
+	LogsCmd.Flags().StringVar(&logsCmdConfig.DeliveryID, "delivery", "", "print lines for this webhook delivery")
+	LogsCmd.Flags().StringVar(&logsCmdConfig.PullRequest, "pr", "", "print lines for this pull request, as owner/repo#number")
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/server"
+)
+
+const defaultOnboardingBody = "This pull request adds a configuration file for bulldozer, which merges " +
+	"and updates pull requests automatically. Review the configuration and merge this pull request to " +
+	"enable bulldozer in this repository."
+
+var onboardCmdConfig struct {
+	Path         string
+	Owner        string
+	Template     string
+	Repositories []string
+	Branch       string
+	Title        string
+	Body         string
+	DryRun       bool
+	JSON         bool
+}
+
+var OnboardCmd = &cobra.Command{
+	Use:   "onboard",
+	Short: "Opens pull requests that add a bulldozer configuration to repositories.",
+	Long: "Authenticates as the GitHub App in the server configuration and opens a pull request that adds the " +
+		"template configuration to every repository of the owner that the App is installed in and that matches " +
+		"the --repo patterns. Archived repositories, repositories that already have a configuration file, and " +
+		"repositories with an existing onboarding branch are skipped, so the command can be run again safely.",
+
+	RunE: onboardCmd,
+}
+
+func onboardCmd(cmd *cobra.Command, args []string) error {
+	if onboardCmdConfig.Owner == "" || onboardCmdConfig.Template == "" {
+		return errors.New("--owner and --template are required")
+	}
+
+	cfg, err := readServerConfig(onboardCmdConfig.Path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read server config")
+	}
+
+	template, err := ioutil.ReadFile(onboardCmdConfig.Template)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read template configuration")
+	}
+
+	level := zerolog.WarnLevel
+	if IsDebugMode() {
+		level = zerolog.DebugLevel
+	}
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(level).With().Timestamp().Logger()
+
+	onboarding := &bulldozer.Onboarding{
+		Config:       template,
+		Repositories: onboardCmdConfig.Repositories,
+		Branch:       onboardCmdConfig.Branch,
+		Title:        onboardCmdConfig.Title,
+		Body:         onboardCmdConfig.Body,
+		DryRun:       onboardCmdConfig.DryRun,
+	}
+
+	results, err := server.OnboardRepositories(logger.WithContext(context.Background()), cfg, onboardCmdConfig.Owner, onboarding)
+	if err != nil {
+		return err
+	}
+
+	if onboardCmdConfig.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	printOnboarding(os.Stdout, results)
+	return nil
+}
+
+func printOnboarding(w io.Writer, results []bulldozer.OnboardingResult) {
+	var opened, skipped, failed int
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			failed++
+			fmt.Fprintf(w, "%s: failed: %s\n", r.Repository, r.Error)
+		case r.Skipped != "":
+			skipped++
+			fmt.Fprintf(w, "%s: skipped: %s\n", r.Repository, r.Skipped)
+		default:
+			opened++
+			fmt.Fprintf(w, "%s: %s\n", r.Repository, r.PullRequest)
+		}
+	}
+	fmt.Fprintf(w, "%d pull requests opened, %d repositories skipped, %d failed\n", opened, skipped, failed)
+}
+
+func init() {
+	RootCmd.AddCommand(OnboardCmd)
+
+	OnboardCmd.Flags().StringVarP(&onboardCmdConfig.Path, "config", "c", "config/bulldozer.yml", "configuration file for bulldozer")
+	OnboardCmd.Flags().StringVar(&onboardCmdConfig.Owner, "owner", "", "organization or user that owns the repositories")
+	OnboardCmd.Flags().StringVar(&onboardCmdConfig.Template, "template", "", "repository configuration file to add")
+	OnboardCmd.Flags().StringSliceVar(&onboardCmdConfig.Repositories, "repo", nil, "glob pattern of repository names to onboard; may be repeated (default all)")
+	OnboardCmd.Flags().StringVar(&onboardCmdConfig.Branch, "branch", bulldozer.DefaultOnboardingBranch, "branch for the pull requests")
+	OnboardCmd.Flags().StringVar(&onboardCmdConfig.Title, "title", bulldozer.DefaultOnboardingTitle, "title of the pull requests and commits")
+	OnboardCmd.Flags().StringVar(&onboardCmdConfig.Body, "body", defaultOnboardingBody, "body of the pull requests")
+	OnboardCmd.Flags().BoolVar(&onboardCmdConfig.DryRun, "dry-run", false, "list the repositories that would be onboarded without changing them")
+	OnboardCmd.Flags().BoolVar(&onboardCmdConfig.JSON, "json", false, "print the results as JSON")
+}
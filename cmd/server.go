@@ -25,7 +25,8 @@ import (
 )
 
 var serverCmdConfig struct {
-	Path string
+	Path   string
+	DryRun bool
 }
 
 var ServerCmd = &cobra.Command{
@@ -67,6 +68,9 @@ func serverCmd(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to read server config")
 	}
+	if serverCmdConfig.DryRun {
+		cfg.Options.DryRun = true
+	}
 
 	s, err := server.New(cfg)
 	if err != nil {
@@ -80,4 +84,5 @@ func init() {
 	RootCmd.AddCommand(ServerCmd)
 
 	ServerCmd.Flags().StringVarP(&serverCmdConfig.Path, "config", "c", "config/bulldozer.yml", "configuration file for bulldozer")
+	ServerCmd.Flags().BoolVar(&serverCmdConfig.DryRun, "dry-run", false, "evaluate pull requests without changing anything on GitHub")
 }
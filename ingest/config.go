@@ -0,0 +1,42 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Config configures where webhook deliveries are received from, in addition
+// to the webhook route of the server.
+type Config struct {
+	SQS    SQSConfig    `yaml:"sqs"`
+	PubSub PubSubConfig `yaml:"pubsub"`
+}
+
+// Sources returns the configured sources.
+func (c Config) Sources() ([]Source, error) {
+	var sources []Source
+	if c.SQS.QueueURL != "" {
+		sources = append(sources, NewSQSSource(c.SQS))
+	}
+	if c.PubSub.Subscription != "" {
+		s, err := NewPubSubSource(c.PubSub)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize Pub/Sub source")
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ingest receives webhook deliveries from message queues, for
+// servers that cannot accept webhooks from GitHub directly.
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// receiveBackoff is how long to wait after failing to receive messages
+	receiveBackoff = 5 * time.Second
+)
+
+// Message is a webhook delivery published by a relay. It holds the headers
+// and the body of the original request, so that the signature of the
+// delivery can be verified.
+type Message struct {
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// Received is a message received from a source, with the handle used to
+// acknowledge it.
+type Received struct {
+	ID     string
+	Data   []byte
+	Handle string
+}
+
+// Source is a queue of messages. Messages that are not acknowledged are
+// delivered again.
+type Source interface {
+	// Receive waits for messages until some arrive or the source's poll
+	// time ends, and returns the messages, which may be empty.
+	Receive(ctx context.Context) ([]Received, error)
+
+	// Ack removes the message from the queue.
+	Ack(ctx context.Context, r Received) error
+}
+
+// Consumer sends the messages of a source to a webhook handler, as if the
+// deliveries were received over HTTP. Messages are acknowledged after they
+// are handled, so each delivery is handled at least once, and the handler
+// must finish its work before it responds. Duplicate deliveries are skipped
+// by the handler, like duplicates received over HTTP.
+type Consumer struct {
+	Source  Source
+	Handler http.Handler
+}
+
+// Run receives and handles messages until the context is canceled.
+func (c *Consumer) Run(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	for ctx.Err() == nil {
+		messages, err := c.Source.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error().Err(err).Msg("Failed to receive webhook messages")
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(receiveBackoff):
+			}
+			continue
+		}
+
+		for _, m := range messages {
+			c.Handle(ctx, m)
+		}
+	}
+}
+
+// Handle handles a message and acknowledges it, unless handling failed in a
+// way that may succeed if the message is delivered again.
+func (c *Consumer) Handle(ctx context.Context, r Received) {
+	logger := zerolog.Ctx(ctx)
+
+	var m Message
+	if err := json.Unmarshal(r.Data, &m); err != nil {
+		logger.Error().Err(err).Msgf("Discarding invalid webhook message %s", r.ID)
+		c.ack(ctx, r)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, githubapp.DefaultWebhookRoute, strings.NewReader(m.Body))
+	if err != nil {
+		logger.Error().Err(err).Msgf("Discarding invalid webhook message %s", r.ID)
+		c.ack(ctx, r)
+		return
+	}
+	for name, value := range m.Headers {
+		req.Header.Set(name, value)
+	}
+
+	deliveryID := req.Header.Get("X-GitHub-Delivery")
+	dlogger := logger.With().Str(githubapp.LogKeyDeliveryID, deliveryID).Logger()
+	logger = &dlogger
+	ctx = logger.WithContext(ctx)
+
+	rec := &statusRecorder{header: make(http.Header), status: http.StatusOK}
+	c.Handler.ServeHTTP(rec, req.WithContext(ctx))
+
+	// rejected deliveries, such as those with invalid signatures, fail
+	// every time, so only server errors are retried
+	if rec.status >= 500 {
+		logger.Warn().Msgf("Handling message %s failed with status %d, it will be delivered again", r.ID, rec.status)
+		return
+	}
+	if rec.status >= 400 {
+		logger.Warn().Msgf("Discarding message %s rejected with status %d", r.ID, rec.status)
+	}
+	c.ack(ctx, r)
+}
+
+func (c *Consumer) ack(ctx context.Context, r Received) {
+	if err := c.Source.Ack(ctx, r); err != nil {
+		zerolog.Ctx(ctx).Error().Err(errors.WithStack(err)).Msgf("Failed to acknowledge message %s", r.ID)
+	}
+}
+
+// statusRecorder is a ResponseWriter that keeps only the status code.
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (r *statusRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+}
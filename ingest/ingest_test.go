@@ -0,0 +1,89 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	acked []string
+}
+
+func (s *fakeSource) Receive(ctx context.Context) ([]Received, error) {
+	return nil, nil
+}
+
+func (s *fakeSource) Ack(ctx context.Context, r Received) error {
+	s.acked = append(s.acked, r.ID)
+	return nil
+}
+
+func message(t *testing.T, id, deliveryID string) Received {
+	b, err := json.Marshal(Message{
+		Headers: map[string]string{
+			"X-GitHub-Event":    "push",
+			"X-GitHub-Delivery": deliveryID,
+		},
+		Body: `{"ref":"refs/heads/develop"}`,
+	})
+	require.NoError(t, err)
+	return Received{ID: id, Data: b}
+}
+
+func TestConsumerHandle(t *testing.T) {
+	ctx := context.Background()
+	source := &fakeSource{}
+
+	status := http.StatusOK
+	var handled []string
+	c := &Consumer{
+		Source: source,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Equal(t, "push", r.Header.Get("X-GitHub-Event"))
+			assert.Equal(t, `{"ref":"refs/heads/develop"}`, string(body))
+			handled = append(handled, r.Header.Get("X-GitHub-Delivery"))
+			w.WriteHeader(status)
+		}),
+	}
+
+	c.Handle(ctx, message(t, "m1", "d1"))
+	assert.Equal(t, []string{"d1"}, handled)
+	assert.Equal(t, []string{"m1"}, source.acked)
+
+	status = http.StatusInternalServerError
+	c.Handle(ctx, message(t, "m2", "d2"))
+	assert.Equal(t, []string{"m1"}, source.acked, "failed messages are not acknowledged")
+
+	status = http.StatusOK
+	c.Handle(ctx, message(t, "m2", "d2"))
+	assert.Equal(t, []string{"d1", "d2", "d2"}, handled, "failed deliveries are handled again")
+	assert.Equal(t, []string{"m1", "m2"}, source.acked)
+
+	status = http.StatusUnauthorized
+	c.Handle(ctx, message(t, "m3", "d3"))
+	assert.Equal(t, []string{"m1", "m2", "m3"}, source.acked, "rejected messages are discarded")
+
+	c.Handle(ctx, Received{ID: "m4", Data: []byte("not json")})
+	assert.Equal(t, []string{"m1", "m2", "m3", "m4"}, source.acked, "invalid messages are discarded")
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	DefaultPubSubEndpoint = "https://pubsub.googleapis.com"
+
+	pubSubScope = "https://www.googleapis.com/auth/pubsub"
+)
+
+// PubSubConfig configures a PubSubSource. Requests are authenticated with
+// the service account key in CredentialsFile, or with the application
+// default credentials, like the service account of the instance, if it is
+// empty.
+type PubSubConfig struct {
+	// Subscription is the full name, "projects/<project>/subscriptions/<name>"
+	Subscription    string `yaml:"subscription"`
+	CredentialsFile string `yaml:"credentials_file"`
+
+	// Endpoint overrides the default Pub/Sub endpoint, for emulators
+	Endpoint string `yaml:"endpoint"`
+}
+
+// PubSubSource receives messages from a Google Cloud Pub/Sub subscription.
+type PubSubSource struct {
+	config PubSubConfig
+	client *http.Client
+}
+
+func NewPubSubSource(c PubSubConfig) (*PubSubSource, error) {
+	if c.Endpoint == "" {
+		c.Endpoint = DefaultPubSubEndpoint
+	}
+
+	ctx := context.Background()
+
+	var creds *google.Credentials
+	if c.CredentialsFile != "" {
+		b, err := ioutil.ReadFile(c.CredentialsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read Pub/Sub credentials")
+		}
+		creds, err = google.CredentialsFromJSONWithType(ctx, b, google.ServiceAccount, pubSubScope)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse Pub/Sub credentials")
+		}
+	} else {
+		var err error
+		creds, err = google.FindDefaultCredentials(ctx, pubSubScope)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find Pub/Sub credentials")
+		}
+	}
+
+	// the client adds access tokens to requests, refreshing them as needed
+	client := oauth2.NewClient(ctx, creds.TokenSource)
+	client.Timeout = 90 * time.Second
+
+	return &PubSubSource{config: c, client: client}, nil
+}
+
+type pubSubPullResponse struct {
+	ReceivedMessages []struct {
+		AckID   string `json:"ackId"`
+		Message struct {
+			MessageID string `json:"messageId"`
+			Data      []byte `json:"data"`
+		} `json:"message"`
+	} `json:"receivedMessages"`
+}
+
+func (s *PubSubSource) Receive(ctx context.Context) ([]Received, error) {
+	var response pubSubPullResponse
+	if err := s.do(ctx, "pull", map[string]interface{}{"maxMessages": 10}, &response); err != nil {
+		return nil, errors.Wrap(err, "failed to pull Pub/Sub messages")
+	}
+
+	messages := make([]Received, 0, len(response.ReceivedMessages))
+	for _, m := range response.ReceivedMessages {
+		messages = append(messages, Received{ID: m.Message.MessageID, Data: m.Message.Data, Handle: m.AckID})
+	}
+	return messages, nil
+}
+
+func (s *PubSubSource) Ack(ctx context.Context, r Received) error {
+	if err := s.do(ctx, "acknowledge", map[string]interface{}{"ackIds": []string{r.Handle}}, nil); err != nil {
+		return errors.Wrap(err, "failed to acknowledge Pub/Sub message")
+	}
+	return nil
+}
+
+func (s *PubSubSource) do(ctx context.Context, method string, body interface{}, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal request")
+	}
+
+	u := strings.TrimSuffix(s.config.Endpoint, "/") + "/v1/" + s.config.Subscription + ":" + method
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.Errorf("unexpected status %d", res.StatusCode)
+	}
+	if out != nil {
+		return errors.Wrap(json.NewDecoder(res.Body).Decode(out), "failed to parse response")
+	}
+	return nil
+}
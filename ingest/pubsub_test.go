@@ -0,0 +1,92 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubSubSource(t *testing.T) {
+	var acked []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.FormValue("grant_type"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token": "token", "token_type": "Bearer", "expires_in": 3600}`))
+	})
+	mux.HandleFunc("/v1/projects/p/subscriptions/s:pull", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"receivedMessages": [{"ackId": "ack-1", "message": {"messageId": "1", "data": "e30="}}]}`))
+	})
+	mux.HandleFunc("/v1/projects/p/subscriptions/s:acknowledge", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		var body struct {
+			AckIDs []string `json:"ackIds"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		acked = append(acked, body.AckIDs...)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	creds, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "bulldozer@p.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    srv.URL + "/token",
+	})
+	require.NoError(t, err)
+
+	credsFile := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, ioutil.WriteFile(credsFile, creds, 0600))
+
+	s, err := NewPubSubSource(PubSubConfig{
+		Subscription:    "projects/p/subscriptions/s",
+		CredentialsFile: credsFile,
+		Endpoint:        srv.URL,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	received, err := s.Receive(ctx)
+	require.NoError(t, err)
+	require.Len(t, received, 1)
+	assert.Equal(t, Received{ID: "1", Data: []byte("{}"), Handle: "ack-1"}, received[0])
+
+	require.NoError(t, s.Ack(ctx, received[0]))
+	assert.Equal(t, []string{"ack-1"}, acked)
+
+	_, err = NewPubSubSource(PubSubConfig{Subscription: "projects/p/subscriptions/s", CredentialsFile: filepath.Join(t.TempDir(), "missing.json")})
+	assert.Error(t, err, "missing credentials files are errors")
+}
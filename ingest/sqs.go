@@ -0,0 +1,129 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ingest
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/aws"
+)
+
+// sqsWaitSeconds is how long a receive request waits for messages.
+const sqsWaitSeconds = 20
+
+// SQSConfig configures an SQSSource. If the credentials are empty, they are
+// read from the standard AWS environment variables.
+type SQSConfig struct {
+	QueueURL string `yaml:"queue_url"`
+	Region   string `yaml:"region"`
+
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	SessionToken    string `yaml:"session_token"`
+}
+
+// SQSSource receives messages from an Amazon SQS queue with long polling.
+type SQSSource struct {
+	config SQSConfig
+	creds  aws.Credentials
+	client *http.Client
+}
+
+func NewSQSSource(c SQSConfig) *SQSSource {
+	creds := aws.Credentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+	}
+	return &SQSSource{
+		config: c,
+		creds:  creds.OrEnvironment(),
+		client: &http.Client{Timeout: (sqsWaitSeconds + 10) * time.Second},
+	}
+}
+
+type sqsReceiveResponse struct {
+	Messages []struct {
+		MessageID     string `xml:"MessageId"`
+		ReceiptHandle string `xml:"ReceiptHandle"`
+		Body          string `xml:"Body"`
+	} `xml:"ReceiveMessageResult>Message"`
+}
+
+func (s *SQSSource) Receive(ctx context.Context) ([]Received, error) {
+	res, err := s.do(ctx, url.Values{
+		"Action":              {"ReceiveMessage"},
+		"MaxNumberOfMessages": {"10"},
+		"WaitTimeSeconds":     {strconv.Itoa(sqsWaitSeconds)},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to receive SQS messages")
+	}
+	defer res.Body.Close()
+
+	var response sqsReceiveResponse
+	if err := xml.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, errors.Wrap(err, "failed to parse SQS messages")
+	}
+
+	messages := make([]Received, 0, len(response.Messages))
+	for _, m := range response.Messages {
+		messages = append(messages, Received{ID: m.MessageID, Data: []byte(m.Body), Handle: m.ReceiptHandle})
+	}
+	return messages, nil
+}
+
+func (s *SQSSource) Ack(ctx context.Context, r Received) error {
+	res, err := s.do(ctx, url.Values{
+		"Action":        {"DeleteMessage"},
+		"ReceiptHandle": {r.Handle},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete SQS message")
+	}
+	return res.Body.Close()
+}
+
+// do sends a signed request to the queue with the parameters in the body.
+func (s *SQSSource) do(ctx context.Context, params url.Values) (*http.Response, error) {
+	params.Set("Version", "2012-11-05")
+	body := []byte(params.Encode())
+
+	req, err := http.NewRequest(http.MethodPost, s.config.QueueURL, strings.NewReader(string(body)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create SQS request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	aws.Sign(req, body, "sqs", s.config.Region, s.creds, time.Now())
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		res.Body.Close()
+		return nil, errors.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jira transitions Jira issues using the Jira REST API.
+package jira
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/jsonhttp"
+)
+
+// Config configures the Jira server and credentials used by all
+// repositories. If Username is set, Token is an API token used with basic
+// authentication, as on Jira Cloud; otherwise Token is a personal access
+// token, as on Jira Server and Data Center. Because repositories choose the
+// issues to transition, only issues in Projects are transitioned.
+type Config struct {
+	URL      string   `yaml:"url"`
+	Username string   `yaml:"username"`
+	Token    string   `yaml:"token"`
+	Projects []string `yaml:"projects"`
+}
+
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
+
+// Client calls the Jira REST API. It is safe for concurrent use.
+type Client struct {
+	URL      string
+	Username string
+	Token    string
+	Projects []string
+	HTTP     *http.Client
+}
+
+func NewClient(c Config) *Client {
+	return &Client{
+		URL:      strings.TrimSuffix(c.URL, "/"),
+		Username: c.Username,
+		Token:    c.Token,
+		Projects: c.Projects,
+		HTTP:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Project returns the project of an issue key, the part before the last
+// dash, and false if the key has no project.
+func Project(key string) (string, bool) {
+	i := strings.LastIndex(key, "-")
+	if i <= 0 {
+		return "", false
+	}
+	return key[:i], true
+}
+
+// Allowed returns true if the client may transition the issue, because it is
+// in one of the client's projects.
+func (c *Client) Allowed(key string) bool {
+	project, ok := Project(key)
+	if !ok {
+		return false
+	}
+	for _, p := range c.Projects {
+		if strings.EqualFold(p, project) {
+			return true
+		}
+	}
+	return false
+}
+
+type clientCtxKey struct{}
+
+// WithClient returns a context that uses the client.
+func WithClient(ctx context.Context, c *Client) context.Context {
+	return context.WithValue(ctx, clientCtxKey{}, c)
+}
+
+// Ctx returns the client associated with the context, or nil if the context
+// has no client.
+func Ctx(ctx context.Context) *Client {
+	c, _ := ctx.Value(clientCtxKey{}).(*Client)
+	return c
+}
+
+// Transition moves the issue to the status reached by the transition with
+// the name, which may also be the name of the target status. It returns
+// false if the issue has no such transition, usually because it already has
+// the status, and an error if the issue is not in one of the client's
+// projects.
+func (c *Client) Transition(ctx context.Context, key, name string) (bool, error) {
+	if !c.Allowed(key) {
+		return false, errors.Errorf("issue %s is not in a project allowed by the server", key)
+	}
+
+	var transitions struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+
+	path := fmt.Sprintf("/rest/api/2/issue/%s/transitions", url.PathEscape(key))
+	if err := c.do(ctx, http.MethodGet, path, nil, &transitions); err != nil {
+		return false, errors.Wrapf(err, "failed to get transitions of %s", key)
+	}
+
+	for _, t := range transitions.Transitions {
+		if !strings.EqualFold(t.Name, name) && !strings.EqualFold(t.To.Name, name) {
+			continue
+		}
+
+		body := map[string]interface{}{
+			"transition": map[string]string{"id": t.ID},
+		}
+		if err := c.do(ctx, http.MethodPost, path, body, nil); err != nil {
+			return false, errors.Wrapf(err, "failed to transition %s to %q", key, name)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	if c.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Token))
+		header.Set("Authorization", "Basic "+auth)
+	} else if c.Token != "" {
+		header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	b, err := jsonhttp.Do(ctx, c.HTTP, method, c.URL+path, header, body)
+	if err != nil {
+		return err
+	}
+	if result != nil {
+		if err := json.Unmarshal(b, result); err != nil {
+			return errors.Wrap(err, "failed to decode response")
+		}
+	}
+	return nil
+}
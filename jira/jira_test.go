@@ -0,0 +1,76 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransition(t *testing.T) {
+	var transitioned []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "bot@example.com", user)
+		assert.Equal(t, "token", token)
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/issue/PROJ-1/transitions":
+			_, _ = w.Write([]byte(`{"transitions": [{"id": "11", "name": "Start", "to": {"name": "In Progress"}}, {"id": "31", "name": "Resolve", "to": {"name": "Done"}}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/rest/api/2/issue/PROJ-2/transitions":
+			_, _ = w.Write([]byte(`{"transitions": []}`))
+		case r.Method == http.MethodPost:
+			var body struct {
+				Transition struct {
+					ID string `json:"id"`
+				} `json:"transition"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			transitioned = append(transitioned, body.Transition.ID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(Config{URL: srv.URL + "/", Username: "bot@example.com", Token: "token", Projects: []string{"proj"}})
+	ctx := context.Background()
+
+	ok, err := c.Transition(ctx, "PROJ-1", "done")
+	require.NoError(t, err)
+	assert.True(t, ok, "transitions match the name of the target status")
+	assert.Equal(t, []string{"31"}, transitioned)
+
+	ok, err = c.Transition(ctx, "PROJ-2", "Done")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = c.Transition(ctx, "PROJ-3", "Done")
+	assert.Error(t, err)
+
+	_, err = c.Transition(ctx, "OPS-1", "Done")
+	assert.Error(t, err, "issues outside the server's projects are not transitioned")
+	_, err = c.Transition(ctx, "PROJ1", "Done")
+	assert.Error(t, err, "keys without a project are not transitioned")
+	assert.Equal(t, []string{"31"}, transitioned)
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jsonhttp sends JSON requests to the HTTP APIs of the services that
+// bulldozer notifies, such as chat, on-call, and issue tracking services.
+package jsonhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxResponseSize limits the responses that are read
+	maxResponseSize = 1 << 20
+
+	// maxErrorSize limits the part of an unsuccessful response that is
+	// included in the error
+	maxErrorSize = 512
+)
+
+// Do sends a request with the payload as JSON, unless it is nil, and returns
+// the body of the response, which must have a successful status.
+func Do(ctx context.Context, client *http.Client, method, url string, header http.Header, payload interface{}) ([]byte, error) {
+	if payload == nil {
+		return send(ctx, client, method, url, header, nil)
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal payload")
+	}
+	return send(ctx, client, method, url, header, b)
+}
+
+// Post posts the payload as JSON and returns the body of the response, which
+// must have a successful status.
+func Post(ctx context.Context, client *http.Client, url string, header http.Header, payload interface{}) ([]byte, error) {
+	return Do(ctx, client, http.MethodPost, url, header, payload)
+}
+
+// PostBody posts the encoded JSON body and returns the body of the response,
+// which must have a successful status.
+func PostBody(ctx context.Context, client *http.Client, url string, header http.Header, b []byte) ([]byte, error) {
+	return send(ctx, client, http.MethodPost, url, header, b)
+}
+
+func send(ctx context.Context, client *http.Client, method, url string, header http.Header, b []byte) ([]byte, error) {
+	var r io.Reader
+	if b != nil {
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if b != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read response")
+	}
+	if res.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > maxErrorSize {
+			msg = msg[:maxErrorSize]
+		}
+		return nil, errors.Errorf("unexpected status %d: %s", res.StatusCode, msg)
+	}
+	return body, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonhttp
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/post":
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/json; charset=utf-8", r.Header.Get("Content-Type"))
+			assert.Equal(t, "secret", r.Header.Get("Authorization"))
+
+			var payload map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+			assert.Equal(t, map[string]string{"text": "hello"}, payload)
+			_, _ = w.Write([]byte(`ok`))
+		case "/get":
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Empty(t, r.Header.Get("Content-Type"))
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Empty(t, body)
+			_, _ = w.Write([]byte(`{"id": 1}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(strings.Repeat("x", 1000)))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	header := http.Header{}
+	header.Set("Authorization", "secret")
+
+	body, err := Post(ctx, srv.Client(), srv.URL+"/post", header, map[string]string{"text": "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+
+	body, err = Do(ctx, srv.Client(), http.MethodGet, srv.URL+"/get", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `{"id": 1}`, string(body))
+
+	_, err = PostBody(ctx, srv.Client(), srv.URL+"/fail", nil, []byte(`{}`))
+	assert.EqualError(t, err, "unexpected status 400: "+strings.Repeat("x", 512))
+}
@@ -0,0 +1,255 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/bulldozer"
+)
+
+const (
+	// DefaultSMTPPort is the port used if the SMTP port is not set.
+	DefaultSMTPPort = 587
+
+	// smtpTimeout limits connecting to the SMTP server and sending an
+	// email, so that an unresponsive server does not hold up notifications
+	smtpTimeout = 30 * time.Second
+)
+
+// DefaultEmailSubjects and DefaultEmailBodies are the templates of the
+// emails sent for each event. Templates are executed with an Event.
+var (
+	DefaultEmailSubjects = map[bulldozer.NotificationEvent]string{
+		bulldozer.NotifyMerged:        "[bulldozer] Merged {{.Owner}}/{{.Repo}}#{{.Number}}",
+		bulldozer.NotifyFailed:        "[bulldozer] Failed to {{.Action}} {{.Owner}}/{{.Repo}}#{{.Number}}",
+		bulldozer.NotifyConflict:      "[bulldozer] {{.Owner}}/{{.Repo}}#{{.Number}} conflicts with its base branch",
+		bulldozer.NotifyInvalidConfig: "[bulldozer] Invalid configuration in {{.Owner}}/{{.Repo}}",
+	}
+
+	DefaultEmailBodies = map[bulldozer.NotificationEvent]string{
+		bulldozer.NotifyMerged:        "Bulldozer merged {{.URL}}.\n",
+		bulldozer.NotifyFailed:        "Bulldozer failed to {{.Action}} {{.URL}} and will not try again until the pull request changes.\n\n{{.Detail}}\n",
+		bulldozer.NotifyConflict:      "Bulldozer cannot update {{.URL}} because it conflicts with its base branch.\n\n{{.Detail}}\n",
+		bulldozer.NotifyInvalidConfig: "The bulldozer configuration of {{.Owner}}/{{.Repo}} is invalid, so bulldozer does not merge or update its pull requests, such as {{.URL}}.\n\n{{.Detail}}\n",
+	}
+)
+
+// EmailConfig configures sending notifications by email through an SMTP
+// server. The connection is upgraded with STARTTLS if the server supports it.
+type EmailConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+
+	// AllowedDomains are the domains of the addresses that repositories may
+	// send email to. It is required, so that repositories cannot use the
+	// server to send email to any address.
+	AllowedDomains []string `yaml:"allowed_domains"`
+
+	// Subjects and Bodies override the templates in DefaultEmailSubjects
+	// and DefaultEmailBodies.
+	Subjects map[bulldozer.NotificationEvent]string `yaml:"subjects"`
+	Bodies   map[bulldozer.NotificationEvent]string `yaml:"bodies"`
+}
+
+func (c EmailConfig) Enabled() bool {
+	return c.Host != ""
+}
+
+// SendMailFunc sends an email, like smtp.SendMail.
+type SendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// Email sends notifications by email to the addresses of each repository.
+type Email struct {
+	Addr           string
+	Auth           smtp.Auth
+	From           string
+	AllowedDomains []string
+	Subjects       map[bulldozer.NotificationEvent]*template.Template
+	Bodies         map[bulldozer.NotificationEvent]*template.Template
+	SendMail       SendMailFunc
+}
+
+func NewEmail(c EmailConfig) (*Email, error) {
+	if c.From == "" {
+		return nil, errors.New("email requires a from address")
+	}
+	if len(c.AllowedDomains) == 0 {
+		return nil, errors.New("email requires allowed domains")
+	}
+
+	port := c.Port
+	if port == 0 {
+		port = DefaultSMTPPort
+	}
+
+	e := &Email{
+		Addr:           net.JoinHostPort(c.Host, strconv.Itoa(port)),
+		From:           c.From,
+		AllowedDomains: c.AllowedDomains,
+		SendMail:       sendMail,
+	}
+	if c.Username != "" {
+		e.Auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+
+	var err error
+	if e.Subjects, err = parseMessages(DefaultEmailSubjects, c.Subjects); err != nil {
+		return nil, err
+	}
+	if e.Bodies, err = parseMessages(DefaultEmailBodies, c.Bodies); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Email) Notify(ctx context.Context, event Event, config bulldozer.NotificationConfig) error {
+	if _, ok := e.Subjects[event.Kind]; !ok {
+		return nil
+	}
+
+	events := config.Email.Events
+	if len(events) == 0 {
+		events = bulldozer.DefaultEmailEvents
+	}
+	if !event.Kind.In(events) {
+		return nil
+	}
+
+	var to []string
+	for _, address := range config.Email.To {
+		if e.allowed(address) {
+			to = append(to, address)
+		}
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	subject, err := renderMessage(e.Subjects, event)
+	if err != nil {
+		return err
+	}
+	body, err := renderMessage(e.Bodies, event)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject), " ")))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	if err := e.SendMail(e.Addr, e.Auth, e.From, to, msg.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to send email")
+	}
+	return nil
+}
+
+// allowed returns true if the address is in one of the allowed domains.
+func (e *Email) allowed(address string) bool {
+	if strings.ContainsAny(address, "\r\n") {
+		return false
+	}
+
+	i := strings.LastIndex(address, "@")
+	if i < 0 {
+		return false
+	}
+	domain := address[i+1:]
+	for _, allowed := range e.AllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendMail sends an email like smtp.SendMail, but fails if connecting or
+// sending takes longer than smtpTimeout.
+func sendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support authentication")
+		}
+		if err := c.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, address := range to {
+		if err := c.Rcpt(address); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notify sends notifications about merges, failures, and conflicts
+// to chat and other services, routed by the configuration of each
+// repository.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/bulldozer"
+)
+
+// DefaultWebURL is the base URL used to link to pull requests if the GitHub
+// web URL is not configured.
+const DefaultWebURL = "https://github.com"
+
+// Event is a notification about a pull request.
+type Event struct {
+	// ID identifies the notification, and is the same for every notifier
+	// and every attempt to send it
+	ID   string                      `json:"id"`
+	Kind bulldozer.NotificationEvent `json:"kind"`
+	Time time.Time                   `json:"time"`
+
+	// Action is what bulldozer was doing, "merge" or "update"
+	Action string `json:"action"`
+
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+
+	SHA      string `json:"sha,omitempty"`
+	MergeSHA string `json:"merge_sha,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// Notifier sends notifications to a service. The configuration is the
+// notification configuration of the repository of the pull request.
+// Implementations must be safe for concurrent use.
+type Notifier interface {
+	Notify(ctx context.Context, event Event, config bulldozer.NotificationConfig) error
+}
+
+// Config configures the services that receive notifications.
+type Config struct {
+	Slack    SlackConfig   `yaml:"slack"`
+	Teams    TeamsConfig   `yaml:"teams"`
+	Webhooks WebhookConfig `yaml:"webhooks"`
+	Email    EmailConfig   `yaml:"email"`
+
+	// QueueSize is the number of notifications that wait to be sent. If
+	// zero, DefaultQueueSize is used.
+	QueueSize int `yaml:"queue_size"`
+
+	// Workers is the number of notifications sent at once. If zero,
+	// DefaultQueueWorkers is used.
+	Workers int `yaml:"workers"`
+}
+
+// NewQueue returns the queue that sends notifications in the background.
+func NewQueue(c Config) *Queue {
+	return &Queue{Size: c.QueueSize, Workers: c.Workers}
+}
+
+// New returns the notifiers of the configured services, or nil if no
+// service is configured.
+func New(c Config) ([]Notifier, error) {
+	var notifiers []Notifier
+	if c.Slack.Enabled() {
+		slack, err := NewSlack(c.Slack)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid slack configuration")
+		}
+		notifiers = append(notifiers, slack)
+	}
+	if c.Teams.Enabled() {
+		teams, err := NewTeams(c.Teams)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid teams configuration")
+		}
+		notifiers = append(notifiers, teams)
+	}
+	if c.Webhooks.Enabled() {
+		webhook, err := NewWebhook(c.Webhooks)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid webhook configuration")
+		}
+		notifiers = append(notifiers, webhook)
+	}
+	if c.Email.Enabled() {
+		email, err := NewEmail(c.Email)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid email configuration")
+		}
+		notifiers = append(notifiers, email)
+	}
+	return notifiers, nil
+}
+
+// Dispatcher turns audit events into notifications and sends them to its
+// notifiers.
+type Dispatcher struct {
+	Notifiers []Notifier
+
+	// WebURL is the base URL of the GitHub web interface, used to link to
+	// pull requests. If empty, DefaultWebURL is used.
+	WebURL string
+
+	// Queue, if set, sends notifications in the background. Otherwise they
+	// are sent before Notify returns.
+	Queue *Queue
+}
+
+// Sink returns an audit sink that records events to next and sends
+// notifications for the events that have one using the notification
+// configuration of a repository. If the dispatcher is nil, next is returned.
+func (d *Dispatcher) Sink(next audit.Sink, config bulldozer.NotificationConfig) audit.Sink {
+	if d == nil || len(d.Notifiers) == 0 {
+		return next
+	}
+	return &sink{dispatcher: d, next: next, config: config}
+}
+
+// Notify sends the notification for the audit event, if there is one, to
+// all notifiers, logging any errors.
+func (d *Dispatcher) Notify(ctx context.Context, event audit.Event, config bulldozer.NotificationConfig) {
+	n, ok := d.event(event)
+	if !ok {
+		return
+	}
+
+	if d.Queue != nil {
+		d.Queue.add(ctx, d.Notifiers, n, config)
+		return
+	}
+	send(ctx, d.Notifiers, n, config)
+}
+
+// event returns the notification for the audit event, or false if the event
+// is not notified.
+func (d *Dispatcher) event(event audit.Event) (Event, bool) {
+	var kind bulldozer.NotificationEvent
+	switch {
+	case event.Type == audit.TypeMerge && event.Result == audit.ResultAttempted:
+		kind = bulldozer.NotifyMergeAttempted
+	case event.Type == audit.TypeMerge && event.Result == audit.ResultMerged:
+		kind = bulldozer.NotifyMerged
+	case (event.Type == audit.TypeMerge || event.Type == audit.TypeUpdate) && event.Result == audit.ResultFailed:
+		kind = bulldozer.NotifyFailed
+	case event.Type == audit.TypeUpdate && event.Result == audit.ResultUpdated:
+		kind = bulldozer.NotifyUpdated
+	case event.Type == audit.TypeUpdate && event.Result == audit.ResultConflict:
+		kind = bulldozer.NotifyConflict
+	case event.Type == audit.TypeQueue && event.Result == audit.ResultQueued:
+		kind = bulldozer.NotifyQueued
+	case event.Type == audit.TypeConfig && event.Result == audit.ResultInvalid:
+		kind = bulldozer.NotifyInvalidConfig
+	default:
+		return Event{}, false
+	}
+
+	webURL := d.WebURL
+	if webURL == "" {
+		webURL = DefaultWebURL
+	}
+
+	return Event{
+		ID:       audit.NewCloudEventID(),
+		Kind:     kind,
+		Time:     event.Time,
+		Action:   event.Type,
+		Owner:    event.Owner,
+		Repo:     event.Repo,
+		Number:   event.Number,
+		URL:      fmt.Sprintf("%s/%s/%s/pull/%d", strings.TrimSuffix(webURL, "/"), event.Owner, event.Repo, event.Number),
+		SHA:      event.SHA,
+		MergeSHA: event.MergeSHA,
+		Detail:   event.Detail,
+	}, true
+}
+
+type sink struct {
+	dispatcher *Dispatcher
+	next       audit.Sink
+	config     bulldozer.NotificationConfig
+}
+
+func (s *sink) Record(ctx context.Context, event audit.Event) error {
+	err := s.next.Record(ctx, event)
+	s.dispatcher.Notify(ctx, event, s.config)
+	return err
+}
+
+// parseMessages parses the message templates for each event, using the
+// defaults for events without an override.
+func parseMessages(defaults, overrides map[bulldozer.NotificationEvent]string) (map[bulldozer.NotificationEvent]*template.Template, error) {
+	for kind := range overrides {
+		if _, ok := defaults[kind]; !ok {
+			return nil, errors.Errorf("unknown notification event %q", kind)
+		}
+	}
+
+	messages := make(map[bulldozer.NotificationEvent]*template.Template)
+	for kind, text := range defaults {
+		if m, ok := overrides[kind]; ok {
+			text = m
+		}
+		t, err := template.New(string(kind)).Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s message template", kind)
+		}
+		messages[kind] = t
+	}
+	return messages, nil
+}
+
+// renderMessage executes the message template of the event.
+func renderMessage(messages map[bulldozer.NotificationEvent]*template.Template, event Event) (string, error) {
+	var b bytes.Buffer
+	if err := messages[event.Kind].Execute(&b, event); err != nil {
+		return "", errors.Wrapf(err, "failed to render %s message", event.Kind)
+	}
+	return b.String(), nil
+}
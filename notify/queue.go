@@ -0,0 +1,137 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/bulldozer"
+)
+
+const (
+	// DefaultQueueSize is the number of notifications that wait to be sent
+	// if the queue size is not configured
+	DefaultQueueSize = 1000
+
+	// DefaultQueueWorkers is the number of notifications sent at once if the
+	// number of workers is not configured
+	DefaultQueueWorkers = 4
+)
+
+// Queue sends notifications in the background with a fixed number of
+// workers, so that slow services do not delay merges. Notifications wait in
+// a queue of Size; when it is full, new notifications are dropped.
+type Queue struct {
+	Size    int
+	Workers int
+
+	once sync.Once
+	work chan notification
+}
+
+type notification struct {
+	ctx       context.Context
+	notifiers []Notifier
+	event     Event
+	config    bulldozer.NotificationConfig
+}
+
+func (q *Queue) init() {
+	q.once.Do(func() {
+		size := q.Size
+		if size <= 0 {
+			size = DefaultQueueSize
+		}
+		q.work = make(chan notification, size)
+	})
+}
+
+// add queues the notification, or drops it if the queue is full.
+func (q *Queue) add(ctx context.Context, notifiers []Notifier, event Event, config bulldozer.NotificationConfig) {
+	q.init()
+
+	n := notification{
+		// sending continues after the caller finishes
+		ctx:       zerolog.Ctx(ctx).WithContext(context.Background()),
+		notifiers: notifiers,
+		event:     event,
+		config:    config,
+	}
+
+	select {
+	case q.work <- n:
+	default:
+		zerolog.Ctx(ctx).Warn().Msgf("Dropped %s notification for %s/%s#%d, the notification queue is full", event.Kind, event.Owner, event.Repo, event.Number)
+	}
+}
+
+// Start starts the workers, which run until the context is canceled. It
+// returns immediately.
+func (q *Queue) Start(ctx context.Context) {
+	q.init()
+
+	workers := q.Workers
+	if workers <= 0 {
+		workers = DefaultQueueWorkers
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case n := <-q.work:
+					n.send()
+				}
+			}
+		}()
+	}
+}
+
+// Flush sends the notifications waiting in the queue until it is empty or
+// the context is canceled.
+func (q *Queue) Flush(ctx context.Context) error {
+	if q == nil {
+		return nil
+	}
+	q.init()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n := <-q.work:
+			n.send()
+		default:
+			return nil
+		}
+	}
+}
+
+func (n notification) send() {
+	send(n.ctx, n.notifiers, n.event, n.config)
+}
+
+// send sends the notification to all notifiers, logging any errors.
+func send(ctx context.Context, notifiers []Notifier, n Event, config bulldozer.NotificationConfig) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, n, config); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msgf("Failed to send %s notification for %s/%s#%d", n.Kind, n.Owner, n.Repo, n.Number)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/jsonhttp"
+)
+
+// DefaultSlackAPIURL is the Slack method used to post messages with a token.
+const DefaultSlackAPIURL = "https://slack.com/api/chat.postMessage"
+
+// DefaultSlackMessages are the templates of the messages posted for each
+// event, in Slack's mrkdwn format. Templates are executed with an Event.
+var DefaultSlackMessages = map[bulldozer.NotificationEvent]string{
+	bulldozer.NotifyMerged:   ":white_check_mark: Merged <{{.URL}}|{{.Owner}}/{{.Repo}}#{{.Number}}>",
+	bulldozer.NotifyFailed:   ":x: Failed to {{.Action}} <{{.URL}}|{{.Owner}}/{{.Repo}}#{{.Number}}>: {{.Detail}}",
+	bulldozer.NotifyConflict: ":warning: <{{.URL}}|{{.Owner}}/{{.Repo}}#{{.Number}}> cannot be updated because it conflicts with its base branch",
+}
+
+// SlackConfig configures posting notifications to Slack, either through an
+// incoming webhook or with the token of a Slack App. Only a token can post
+// to the channels of repositories; incoming webhooks created for Slack Apps
+// always post to their own channel.
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	Token      string `yaml:"token"`
+
+	// DefaultChannel receives the notifications of repositories that do not
+	// set a channel. If empty, those repositories are not notified.
+	DefaultChannel string `yaml:"default_channel"`
+
+	// Messages overrides the templates in DefaultSlackMessages.
+	Messages map[bulldozer.NotificationEvent]string `yaml:"messages"`
+}
+
+func (c SlackConfig) Enabled() bool {
+	return c.WebhookURL != "" || c.Token != ""
+}
+
+// Slack posts notifications to Slack channels.
+type Slack struct {
+	WebhookURL     string
+	Token          string
+	APIURL         string
+	DefaultChannel string
+	Messages       map[bulldozer.NotificationEvent]*template.Template
+	Client         *http.Client
+}
+
+func NewSlack(c SlackConfig) (*Slack, error) {
+	s := &Slack{
+		WebhookURL:     c.WebhookURL,
+		Token:          c.Token,
+		APIURL:         DefaultSlackAPIURL,
+		DefaultChannel: c.DefaultChannel,
+		Client:         &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var err error
+	if s.Messages, err = parseMessages(DefaultSlackMessages, c.Messages); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Slack) Notify(ctx context.Context, event Event, config bulldozer.NotificationConfig) error {
+	channel := config.Slack.Channel
+	if channel == "" {
+		channel = s.DefaultChannel
+	}
+	// events without a message, like queued pull requests, are only sent
+	// to webhooks
+	if _, ok := s.Messages[event.Kind]; !ok {
+		return nil
+	}
+	if channel == "" || !event.Kind.In(config.Slack.Events) {
+		return nil
+	}
+
+	text, err := renderMessage(s.Messages, event)
+	if err != nil {
+		return err
+	}
+
+	message := map[string]interface{}{
+		"channel":      channel,
+		"text":         text,
+		"unfurl_links": false,
+	}
+
+	url := s.WebhookURL
+	header := make(http.Header)
+	if s.Token != "" {
+		url = s.APIURL
+		header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	body, err := jsonhttp.Post(ctx, s.Client, url, header, message)
+	if err != nil {
+		return errors.Wrap(err, "failed to post slack message")
+	}
+
+	// the Web API reports errors in the body of successful responses
+	if s.Token != "" {
+		var result struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return errors.Wrap(err, "failed to decode slack response")
+		}
+		if !result.OK {
+			return errors.Errorf("failed to post slack message: %s", result.Error)
+		}
+	}
+	return nil
+}
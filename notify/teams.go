@@ -0,0 +1,128 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/jsonhttp"
+)
+
+// DefaultTeamsMessages are the templates of the messages posted for each
+// event, in the Markdown supported by Teams. Templates are executed with an
+// Event.
+var DefaultTeamsMessages = map[bulldozer.NotificationEvent]string{
+	bulldozer.NotifyMerged:   "✅ Merged [{{.Owner}}/{{.Repo}}#{{.Number}}]({{.URL}})",
+	bulldozer.NotifyFailed:   "❌ Failed to {{.Action}} [{{.Owner}}/{{.Repo}}#{{.Number}}]({{.URL}}): {{.Detail}}",
+	bulldozer.NotifyConflict: "⚠️ [{{.Owner}}/{{.Repo}}#{{.Number}}]({{.URL}}) cannot be updated because it conflicts with its base branch",
+}
+
+// teamsColors are the accent colors of the cards for each event.
+var teamsColors = map[bulldozer.NotificationEvent]string{
+	bulldozer.NotifyMerged:   "2EB67D",
+	bulldozer.NotifyFailed:   "E01E5A",
+	bulldozer.NotifyConflict: "ECB22E",
+}
+
+// TeamsConfig configures posting notifications to Microsoft Teams through
+// incoming webhooks. Each webhook posts to one channel, so the webhooks are
+// named here and repositories select one by name, keeping the webhook URLs
+// out of repository configuration.
+type TeamsConfig struct {
+	Webhooks map[string]string `yaml:"webhooks"`
+
+	// DefaultChannel is the name of the webhook that receives the
+	// notifications of repositories that do not set a channel. If empty,
+	// those repositories are not notified.
+	DefaultChannel string `yaml:"default_channel"`
+
+	// Messages overrides the templates in DefaultTeamsMessages.
+	Messages map[bulldozer.NotificationEvent]string `yaml:"messages"`
+}
+
+func (c TeamsConfig) Enabled() bool {
+	return len(c.Webhooks) > 0
+}
+
+// Teams posts notifications to Microsoft Teams channels as message cards.
+type Teams struct {
+	Webhooks       map[string]string
+	DefaultChannel string
+	Messages       map[bulldozer.NotificationEvent]*template.Template
+	Client         *http.Client
+}
+
+func NewTeams(c TeamsConfig) (*Teams, error) {
+	if c.DefaultChannel != "" {
+		if _, ok := c.Webhooks[c.DefaultChannel]; !ok {
+			return nil, errors.Errorf("default channel %q has no webhook", c.DefaultChannel)
+		}
+	}
+
+	t := &Teams{
+		Webhooks:       c.Webhooks,
+		DefaultChannel: c.DefaultChannel,
+		Client:         &http.Client{Timeout: 10 * time.Second},
+	}
+
+	var err error
+	if t.Messages, err = parseMessages(DefaultTeamsMessages, c.Messages); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *Teams) Notify(ctx context.Context, event Event, config bulldozer.NotificationConfig) error {
+	channel := config.Teams.Channel
+	if channel == "" {
+		channel = t.DefaultChannel
+	}
+	// events without a message, like queued pull requests, are only sent
+	// to webhooks
+	if _, ok := t.Messages[event.Kind]; !ok {
+		return nil
+	}
+	if channel == "" || !event.Kind.In(config.Teams.Events) {
+		return nil
+	}
+
+	url, ok := t.Webhooks[channel]
+	if !ok {
+		return errors.Errorf("no teams webhook for channel %q", channel)
+	}
+
+	text, err := renderMessage(t.Messages, event)
+	if err != nil {
+		return err
+	}
+
+	card := map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    text,
+		"themeColor": teamsColors[event.Kind],
+		"text":       text,
+	}
+	if _, err := jsonhttp.Post(ctx, t.Client, url, nil, card); err != nil {
+		return errors.Wrap(err, "failed to post teams message")
+	}
+	return nil
+}
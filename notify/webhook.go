@@ -0,0 +1,182 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/jsonhttp"
+)
+
+const (
+	// WebhookSignatureHeader is the header with the HMAC-SHA256 signature of
+	// the body of a webhook, in the form "sha256=<hex digest>", like the
+	// signatures of GitHub webhooks
+	WebhookSignatureHeader = "X-Bulldozer-Signature-256"
+
+	// WebhookEventHeader is the header with the kind of the event
+	WebhookEventHeader = "X-Bulldozer-Event"
+
+	// WebhookDeliveryHeader is the header with a unique ID of each delivery
+	WebhookDeliveryHeader = "X-Bulldozer-Delivery"
+)
+
+// WebhookConfig configures sending events as signed JSON webhooks.
+type WebhookConfig struct {
+	// Secret signs the body of every webhook. It is required.
+	Secret string `yaml:"secret"`
+
+	// Endpoints receive the events of every repository.
+	Endpoints []bulldozer.WebhookNotificationConfig `yaml:"endpoints"`
+
+	// AllowedURLs are the URLs that repositories may send their events to.
+	// A repository URL is allowed if it has the scheme and host of an
+	// allowed URL and its path is the same or below the allowed path. If
+	// empty, the webhooks of repositories are ignored.
+	AllowedURLs []string `yaml:"allowed_urls"`
+
+	// CloudEvents sends events as CloudEvents in the structured JSON format,
+	// with the types "com.palantir.bulldozer.notification.<kind>".
+	CloudEvents bool `yaml:"cloudevents"`
+}
+
+func (c WebhookConfig) Enabled() bool {
+	return len(c.Endpoints) > 0 || len(c.AllowedURLs) > 0
+}
+
+// Webhook posts events as JSON to the endpoints of the server and the
+// repository.
+type Webhook struct {
+	Secret      string
+	Endpoints   []bulldozer.WebhookNotificationConfig
+	AllowedURLs []string
+	CloudEvents bool
+	Client      *http.Client
+}
+
+func NewWebhook(c WebhookConfig) (*Webhook, error) {
+	if c.Secret == "" {
+		return nil, errors.New("webhooks require a secret")
+	}
+	for _, endpoint := range c.Endpoints {
+		if endpoint.URL == "" {
+			return nil, errors.New("webhook endpoints require a url")
+		}
+	}
+	for _, allowed := range c.AllowedURLs {
+		if u, err := url.Parse(allowed); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, errors.Errorf("invalid allowed webhook url %q", allowed)
+		}
+	}
+
+	return &Webhook{
+		Secret:      c.Secret,
+		Endpoints:   c.Endpoints,
+		AllowedURLs: c.AllowedURLs,
+		CloudEvents: c.CloudEvents,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (w *Webhook) Notify(ctx context.Context, event Event, config bulldozer.NotificationConfig) error {
+	var firstErr error
+	for _, endpoint := range append(append([]bulldozer.WebhookNotificationConfig(nil), w.Endpoints...), w.allowed(config.Webhooks)...) {
+		if !event.Kind.In(endpoint.Events) {
+			continue
+		}
+		if err := w.post(ctx, endpoint.URL, event); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "failed to post webhook to %s", endpoint.URL)
+		}
+	}
+	return firstErr
+}
+
+// allowed returns the webhooks of a repository whose URLs are allowed.
+func (w *Webhook) allowed(webhooks []bulldozer.WebhookNotificationConfig) []bulldozer.WebhookNotificationConfig {
+	var allowed []bulldozer.WebhookNotificationConfig
+	for _, webhook := range webhooks {
+		for _, prefix := range w.AllowedURLs {
+			if urlAllowed(webhook.URL, prefix) {
+				allowed = append(allowed, webhook)
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+// urlAllowed returns true if the URL has the scheme and host of the allowed
+// URL and a path at or below its path.
+func urlAllowed(raw, allowed string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.User != nil || u.Opaque != "" {
+		return false
+	}
+	a, err := url.Parse(allowed)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(u.Scheme, a.Scheme) || !strings.EqualFold(u.Host, a.Host) {
+		return false
+	}
+
+	p := path.Clean("/" + u.Path)
+	prefix := strings.TrimSuffix(path.Clean("/"+a.Path), "/")
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func (w *Webhook) post(ctx context.Context, url string, event Event) error {
+	var body interface{} = event
+	if w.CloudEvents {
+		body = audit.NewCloudEvent(event.ID, "notification."+string(event.Kind), event.Owner, event.Repo, event.Number, event.Time, event)
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+
+	header := make(http.Header)
+	header.Set(WebhookSignatureHeader, Sign(w.Secret, b))
+	header.Set(WebhookEventHeader, string(event.Kind))
+	header.Set(WebhookDeliveryHeader, event.ID)
+	if w.CloudEvents {
+		header.Set("Content-Type", audit.CloudEventsContentType)
+	}
+
+	_, err = jsonhttp.PostBody(ctx, w.Client, url, header, b)
+	return err
+}
+
+// Sign returns the signature of the body with the secret, in the form of
+// the WebhookSignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
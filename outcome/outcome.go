@@ -0,0 +1,215 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outcome writes a machine-readable record of every evaluation of a
+// pull request, for analysis of the behavior of bulldozer across many
+// repositories.
+package outcome
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ResultMerged        = "merged"
+	ResultIneligible    = "ineligible"
+	ResultQueued        = "queued"
+	ResultDropped       = "dropped"
+	ResultHalted        = "halted"
+	ResultPaused        = "paused"
+	ResultMissingConfig = "missing_config"
+	ResultInvalidConfig = "invalid_config"
+	ResultFailed        = "failed"
+)
+
+// Record describes a completed evaluation of a pull request.
+type Record struct {
+	Time       time.Time `json:"time"`
+	DeliveryID string    `json:"delivery_id,omitempty"`
+
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+
+	// ConfigHash identifies the repository configuration used, like in
+	// audit events
+	ConfigHash string `json:"config_hash,omitempty"`
+
+	Result   string   `json:"result"`
+	Eligible bool     `json:"eligible"`
+	Signals  []string `json:"signals,omitempty"`
+	Reasons  []string `json:"reasons,omitempty"`
+	Error    string   `json:"error,omitempty"`
+
+	// DurationMillis is the time spent on the whole evaluation, including
+	// waiting for locks; EvaluationMillis and MergeMillis are the time spent
+	// deciding whether to merge and merging, if those steps ran
+	DurationMillis   int64 `json:"duration_ms"`
+	EvaluationMillis int64 `json:"evaluation_ms,omitempty"`
+	MergeMillis      int64 `json:"merge_ms,omitempty"`
+
+	// APICalls is the number of GitHub API requests made
+	APICalls int64 `json:"api_calls"`
+}
+
+// Config configures where records are written. Records are not written if
+// no destination is set.
+type Config struct {
+	Stdout bool   `yaml:"stdout"`
+	File   string `yaml:"file"`
+}
+
+// Log writes records to a writer as JSON lines.
+type Log struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewLog returns a log that writes to w.
+func NewLog(w io.Writer) *Log {
+	return &Log{w: w}
+}
+
+// New returns a log for the configuration, or nil if no destination is set.
+// The file is opened for appending, so it can be rotated by truncating it.
+func New(c Config) (*Log, error) {
+	var writers []io.Writer
+	if c.Stdout {
+		writers = append(writers, os.Stdout)
+	}
+	if c.File != "" {
+		f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open outcome file %s", c.File)
+		}
+		writers = append(writers, f)
+	}
+
+	switch len(writers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return NewLog(writers[0]), nil
+	default:
+		return NewLog(io.MultiWriter(writers...)), nil
+	}
+}
+
+// Write writes the record as a single line. The time of the record is set if
+// it is zero.
+func (l *Log) Write(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal outcome")
+	}
+	b = append(b, '\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if _, err := l.w.Write(b); err != nil {
+		return errors.Wrap(err, "failed to write outcome")
+	}
+	return nil
+}
+
+// Tracker collects a record while a pull request is evaluated. The methods of
+// a nil Tracker do nothing, so callers do not need to check if outcomes are
+// enabled.
+type Tracker struct {
+	Record
+
+	start time.Time
+	calls int64
+}
+
+type trackerCtxKey struct{}
+
+// Start returns a tracker for a new evaluation and a context that counts the
+// GitHub API requests made with it.
+func Start(ctx context.Context, owner, repo string, number int) (context.Context, *Tracker) {
+	t := &Tracker{
+		Record: Record{Owner: owner, Repo: repo, Number: number},
+		start:  time.Now(),
+	}
+	return context.WithValue(ctx, trackerCtxKey{}, t), t
+}
+
+// CountRequest counts an API request for the evaluation tracked in the
+// context, if any.
+func CountRequest(ctx context.Context) {
+	if t, ok := ctx.Value(trackerCtxKey{}).(*Tracker); ok {
+		atomic.AddInt64(&t.calls, 1)
+	}
+}
+
+// SetResult sets the result of the evaluation.
+func (t *Tracker) SetResult(result string) {
+	if t != nil {
+		t.Result = result
+	}
+}
+
+// Evaluated records the decision on whether to merge the pull request and
+// the time it took.
+func (t *Tracker) Evaluated(eligible bool, signals, reasons []string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.Eligible = eligible
+	t.Signals = signals
+	t.Reasons = reasons
+	t.EvaluationMillis = millis(d)
+	if !eligible {
+		t.Result = ResultIneligible
+	}
+}
+
+// Merged records the time it took to merge the pull request.
+func (t *Tracker) Merged(d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.Result = ResultMerged
+	t.MergeMillis = millis(d)
+}
+
+// Finish returns the record of the evaluation. If err is not nil, the result
+// is ResultFailed.
+func (t *Tracker) Finish(err error) Record {
+	r := t.Record
+	r.DurationMillis = millis(time.Since(t.start))
+	r.APICalls = atomic.LoadInt64(&t.calls)
+	if err != nil {
+		r.Result = ResultFailed
+		r.Error = err.Error()
+	}
+	return r
+}
+
+func millis(d time.Duration) int64 {
+	return d.Nanoseconds() / int64(time.Millisecond)
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outcome
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracker(t *testing.T) {
+	ctx, tracker := Start(context.Background(), "palantir", "bulldozer", 42)
+	CountRequest(ctx)
+	CountRequest(ctx)
+	CountRequest(context.Background())
+
+	tracker.Evaluated(false, []string{"label"}, []string{"status check is pending"}, 0)
+	r := tracker.Finish(nil)
+	assert.Equal(t, ResultIneligible, r.Result)
+	assert.Equal(t, int64(2), r.APICalls)
+	assert.Equal(t, []string{"status check is pending"}, r.Reasons)
+
+	tracker.Evaluated(true, nil, nil, 0)
+	tracker.Merged(0)
+	assert.Equal(t, ResultMerged, tracker.Finish(nil).Result)
+
+	r = tracker.Finish(errors.New("merge failed"))
+	assert.Equal(t, ResultFailed, r.Result)
+	assert.Equal(t, "merge failed", r.Error)
+
+	var nilTracker *Tracker
+	nilTracker.SetResult(ResultPaused)
+	nilTracker.Merged(0)
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := NewLog(&buf)
+	require.NoError(t, log.Write(Record{Owner: "palantir", Repo: "bulldozer", Number: 1, Result: ResultQueued}))
+	require.NoError(t, log.Write(Record{Owner: "palantir", Repo: "bulldozer", Number: 2, Result: ResultMerged}))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var r Record
+	require.NoError(t, json.Unmarshal(lines[1], &r))
+	assert.Equal(t, 2, r.Number)
+	assert.Equal(t, ResultMerged, r.Result)
+	assert.False(t, r.Time.IsZero())
+}
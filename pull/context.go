@@ -16,8 +16,27 @@ package pull
 
 import (
 	"context"
+	"time"
 )
 
+// Comment is a comment on a pull request.
+type Comment struct {
+	// Author is the login of the user who wrote the comment. Bots have the
+	// "[bot]" suffix, as in the REST API.
+	Author string
+	Body   string
+}
+
+// Status is the latest commit status of a context.
+type Status struct {
+	State       string
+	Description string
+
+	// Creator is the login of the user that posted the status. The logins
+	// of GitHub Apps end in "[bot]", as in the REST API.
+	Creator string
+}
+
 // Context is the context for a pull request. It defines methods to get
 // information about the pull request. It is assumed that the implementation
 // is not thread safe.
@@ -34,6 +53,9 @@ type Context interface {
 	// The Pull Request Number
 	Number() int
 
+	// HeadSHA returns the SHA of the head commit of the pull request
+	HeadSHA() string
+
 	// Locator returns a locator string for the pull request. The locator
 	// string is formatted as "<owner>/<repository>#<number>"
 	Locator() string
@@ -49,15 +71,54 @@ type Context interface {
 	RequiredStatuses(ctx context.Context) ([]string, error)
 
 	// CurrentSuccessStatuses returns the names of all currently
-	// successful status checks for the pull request.
+	// successful status checks and check runs for the pull request.
 	CurrentSuccessStatuses(ctx context.Context) ([]string, error)
 
+	// StatusStates returns the state of every status check and check run for
+	// the pull request, keyed by name. Completed check runs use their
+	// conclusion as the state.
+	StatusStates(ctx context.Context) (map[string]string, error)
+
+	// Statuses returns every commit status of the pull request, keyed by
+	// context. Check runs are not included.
+	Statuses(ctx context.Context) (map[string]Status, error)
+
+	// SuccessStatusTimes returns the time each currently successful status
+	// check for the pull request was last updated, keyed by name.
+	SuccessStatusTimes(ctx context.Context) (map[string]time.Time, error)
+
+	// SuccessfulDeployments returns the environments in which the most recent
+	// deployment of the head commit of the pull request succeeded.
+	SuccessfulDeployments(ctx context.Context) ([]string, error)
+
+	// RequiredApprovals returns the number of approving reviews required by
+	// the protection rules of the base branch.
+	RequiredApprovals(ctx context.Context) (int, error)
+
+	// Approvers returns the logins of all users whose most recent review on
+	// the pull request is an approval and who have write access to the
+	// repository.
+	Approvers(ctx context.Context) ([]string, error)
+
+	// StaleApprovers returns the logins of all approvers whose approval was
+	// submitted for a commit other than the current head of the pull request.
+	StaleApprovers(ctx context.Context) ([]string, error)
+
 	// Comments lists all comments on a Pull Request
 	Comments(ctx context.Context) ([]string, error)
 
+	// AuthoredComments lists all comments on a Pull Request with the logins
+	// of their authors, in the same order as Comments
+	AuthoredComments(ctx context.Context) ([]Comment, error)
+
 	// Labels lists all labels on a Pull Request
 	Labels(ctx context.Context) ([]string, error)
 
+	// HeadCommittedAt returns the committer date of the head commit of the
+	// pull request. The date is set by the author of the commit and may be
+	// long before the commit was pushed.
+	HeadCommittedAt(ctx context.Context) (time.Time, error)
+
 	// Branches returns the base (also known as target) and head branch names
 	// of this pull request. Branches in this repository have no prefix, while
 	// branches in forks are prefixed with the owner of the fork and a colon.
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/pkg/errors"
@@ -34,9 +35,17 @@ type GithubContext struct {
 	pr     *github.PullRequest
 
 	// cached fields
-	comments         []string
-	requiredStatuses []string
-	successStatuses  []string
+	comments        []Comment
+	protection      *github.Protection
+	successStatuses []string
+	statusTimes     map[string]time.Time
+	statusStates    map[string]string
+	statuses        map[string]Status
+	deployments     []string
+	approvers       []string
+	staleApprovers  []string
+	canWrite        map[string]bool
+	headCommittedAt *time.Time
 }
 
 func NewGithubContext(client *github.Client, pr *github.PullRequest, owner, repo string, number int) Context {
@@ -62,6 +71,10 @@ func (ghc *GithubContext) Number() int {
 	return ghc.number
 }
 
+func (ghc *GithubContext) HeadSHA() string {
+	return ghc.pr.GetHead().GetSHA()
+}
+
 func (ghc *GithubContext) Locator() string {
 	return fmt.Sprintf("%s/%s#%d", ghc.owner, ghc.repo, ghc.number)
 }
@@ -75,7 +88,21 @@ func (ghc *GithubContext) Body(ctx context.Context) (string, error) {
 }
 
 func (ghc *GithubContext) Comments(ctx context.Context) ([]string, error) {
+	comments, err := ghc.AuthoredComments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bodies := []string{}
+	for _, c := range comments {
+		bodies = append(bodies, c.Body)
+	}
+	return bodies, nil
+}
+
+func (ghc *GithubContext) AuthoredComments(ctx context.Context) ([]Comment, error) {
 	if ghc.comments == nil {
+		all := []Comment{}
 
 		prCommentOpts := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
 		for {
@@ -85,7 +112,7 @@ func (ghc *GithubContext) Comments(ctx context.Context) ([]string, error) {
 			}
 
 			for _, c := range comments {
-				ghc.comments = append(ghc.comments, c.GetBody())
+				all = append(all, Comment{Author: c.GetUser().GetLogin(), Body: c.GetBody()})
 			}
 
 			if res.NextPage == 0 {
@@ -102,7 +129,7 @@ func (ghc *GithubContext) Comments(ctx context.Context) ([]string, error) {
 			}
 
 			for _, c := range comments {
-				ghc.comments = append(ghc.comments, c.GetBody())
+				all = append(all, Comment{Author: c.GetUser().GetLogin(), Body: c.GetBody()})
 			}
 
 			if res.NextPage == 0 {
@@ -110,25 +137,120 @@ func (ghc *GithubContext) Comments(ctx context.Context) ([]string, error) {
 			}
 			issueCommentOpts.Page = res.NextPage
 		}
+
+		ghc.comments = all
 	}
 
 	return ghc.comments, nil
 }
 
 func (ghc *GithubContext) RequiredStatuses(ctx context.Context) ([]string, error) {
-	if ghc.requiredStatuses == nil {
-		requiredStatuses, _, err := ghc.client.Repositories.GetRequiredStatusChecks(ctx, ghc.owner, ghc.repo, ghc.pr.GetBase().GetRef())
+	protection, err := ghc.branchProtection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if protection.RequiredStatusChecks == nil {
+		return nil, nil
+	}
+	return protection.RequiredStatusChecks.Contexts, nil
+}
+
+func (ghc *GithubContext) RequiredApprovals(ctx context.Context) (int, error) {
+	protection, err := ghc.branchProtection(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if protection.RequiredPullRequestReviews == nil {
+		return 0, nil
+	}
+	return protection.RequiredPullRequestReviews.RequiredApprovingReviewCount, nil
+}
+
+// branchProtection returns the protection rules of the base branch. If the
+// branch is not protected, an empty Protection is returned.
+func (ghc *GithubContext) branchProtection(ctx context.Context) (*github.Protection, error) {
+	if ghc.protection == nil {
+		protection, _, err := ghc.client.Repositories.GetBranchProtection(ctx, ghc.owner, ghc.repo, ghc.pr.GetBase().GetRef())
+		if err != nil {
+			if !isNotFound(err) {
+				return nil, errors.Wrapf(err, "cannot get branch protection for %s", ghc.Locator())
+			}
+			// Github returns 404 when there are no branch protections
+			protection = &github.Protection{}
+		}
+		ghc.protection = protection
+	}
+
+	return ghc.protection, nil
+}
+
+func (ghc *GithubContext) Approvers(ctx context.Context) ([]string, error) {
+	if err := ghc.loadReviews(ctx); err != nil {
+		return nil, err
+	}
+	return ghc.writers(ctx, ghc.approvers)
+}
+
+func (ghc *GithubContext) StaleApprovers(ctx context.Context) ([]string, error) {
+	if err := ghc.loadReviews(ctx); err != nil {
+		return nil, err
+	}
+	return ghc.writers(ctx, ghc.staleApprovers)
+}
+
+// writers returns the users in logins with write or admin permission on the
+// repository. Like branch protection, bulldozer ignores approvals by users
+// who cannot push to the repository.
+func (ghc *GithubContext) writers(ctx context.Context, logins []string) ([]string, error) {
+	if ghc.canWrite == nil {
+		ghc.canWrite = make(map[string]bool)
+	}
+
+	writers := []string{}
+	for _, login := range logins {
+		canWrite, ok := ghc.canWrite[login]
+		if !ok {
+			level, _, err := ghc.client.Repositories.GetPermissionLevel(ctx, ghc.owner, ghc.repo, login)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot get permission of %s on %s/%s", login, ghc.owner, ghc.repo)
+			}
+			switch level.GetPermission() {
+			case "admin", "write":
+				canWrite = true
+			}
+			ghc.canWrite[login] = canWrite
+		}
+		if canWrite {
+			writers = append(writers, login)
+		}
+	}
+	return writers, nil
+}
+
+func (ghc *GithubContext) loadReviews(ctx context.Context) error {
+	if ghc.approvers == nil {
+		latest, err := LatestReviews(ctx, ghc.client, ghc.owner, ghc.repo, ghc.number)
 		if err != nil {
-			if isNotFound(err) {
-				// Github returns 404 when there are no branch protections
-				return nil, nil
+			return errors.Wrapf(err, "cannot list reviews for %s", ghc.Locator())
+		}
+
+		approvers := []string{}
+		var staleApprovers []string
+		for _, r := range latest {
+			if r.GetState() == "APPROVED" {
+				approvers = append(approvers, r.GetUser().GetLogin())
+				if r.GetCommitID() != ghc.pr.GetHead().GetSHA() {
+					staleApprovers = append(staleApprovers, r.GetUser().GetLogin())
+				}
 			}
-			return ghc.requiredStatuses, errors.Wrapf(err, "cannot get required status checks for %s", ghc.Locator())
 		}
-		ghc.requiredStatuses = requiredStatuses.Contexts
+		ghc.approvers = approvers
+		ghc.staleApprovers = staleApprovers
 	}
 
-	return ghc.requiredStatuses, nil
+	return nil
 }
 
 func isNotFound(err error) bool {
@@ -137,19 +259,57 @@ func isNotFound(err error) bool {
 }
 
 func (ghc *GithubContext) CurrentSuccessStatuses(ctx context.Context) ([]string, error) {
-	if ghc.successStatuses == nil {
+	if err := ghc.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return ghc.successStatuses, nil
+}
+
+func (ghc *GithubContext) StatusStates(ctx context.Context) (map[string]string, error) {
+	if err := ghc.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return ghc.statusStates, nil
+}
+
+func (ghc *GithubContext) Statuses(ctx context.Context) (map[string]Status, error) {
+	if err := ghc.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return ghc.statuses, nil
+}
+
+func (ghc *GithubContext) SuccessStatusTimes(ctx context.Context) (map[string]time.Time, error) {
+	if err := ghc.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return ghc.statusTimes, nil
+}
+
+func (ghc *GithubContext) loadStatuses(ctx context.Context) error {
+	if ghc.statusTimes == nil {
 		opts := &github.ListOptions{PerPage: 100}
 		var successStatuses []string
+		statusTimes := make(map[string]time.Time)
+		statusStates := make(map[string]string)
+		statuses := make(map[string]Status)
 
 		for {
 			combinedStatus, res, err := ghc.client.Repositories.GetCombinedStatus(ctx, ghc.owner, ghc.repo, ghc.pr.GetHead().GetSHA(), opts)
 			if err != nil {
-				return ghc.successStatuses, errors.Wrapf(err, "cannot get combined status for SHA %s on %s", ghc.pr.GetHead().GetSHA(), ghc.Locator())
+				return errors.Wrapf(err, "cannot get combined status for SHA %s on %s", ghc.pr.GetHead().GetSHA(), ghc.Locator())
 			}
 
 			for _, s := range combinedStatus.Statuses {
+				statusStates[s.GetContext()] = s.GetState()
+				statuses[s.GetContext()] = Status{
+					State:       s.GetState(),
+					Description: s.GetDescription(),
+					Creator:     s.GetCreator().GetLogin(),
+				}
 				if s.GetState() == "success" {
 					successStatuses = append(successStatuses, s.GetContext())
+					statusTimes[s.GetContext()] = s.GetUpdatedAt()
 				}
 			}
 
@@ -159,10 +319,94 @@ func (ghc *GithubContext) CurrentSuccessStatuses(ctx context.Context) ([]string,
 			opts.Page = res.NextPage
 		}
 
+		checkOpts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			checkRuns, res, err := ghc.client.Checks.ListCheckRunsForRef(ctx, ghc.owner, ghc.repo, ghc.pr.GetHead().GetSHA(), checkOpts)
+			if err != nil {
+				return errors.Wrapf(err, "cannot list check runs for SHA %s on %s", ghc.pr.GetHead().GetSHA(), ghc.Locator())
+			}
+
+			for _, r := range checkRuns.CheckRuns {
+				state := r.GetStatus()
+				if state == "completed" {
+					state = r.GetConclusion()
+				}
+				statusStates[r.GetName()] = state
+				if state == "success" {
+					successStatuses = append(successStatuses, r.GetName())
+					statusTimes[r.GetName()] = r.GetCompletedAt().Time
+				}
+			}
+
+			if res.NextPage == 0 {
+				break
+			}
+			checkOpts.Page = res.NextPage
+		}
+
 		ghc.successStatuses = successStatuses
+		ghc.statusTimes = statusTimes
+		ghc.statusStates = statusStates
+		ghc.statuses = statuses
 	}
 
-	return ghc.successStatuses, nil
+	return nil
+}
+
+func (ghc *GithubContext) SuccessfulDeployments(ctx context.Context) ([]string, error) {
+	if ghc.deployments == nil {
+		sha := ghc.pr.GetHead().GetSHA()
+		seen := make(map[string]bool)
+		deployments := []string{}
+
+		opts := &github.DeploymentsListOptions{SHA: sha, ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			page, res, err := ghc.client.Repositories.ListDeployments(ctx, ghc.owner, ghc.repo, opts)
+			if err != nil {
+				return nil, errors.Wrapf(err, "cannot list deployments for SHA %s on %s", sha, ghc.Locator())
+			}
+
+			// deployments are returned newest first, so only the first
+			// deployment to each environment is considered
+			for _, d := range page {
+				env := d.GetEnvironment()
+				if seen[env] {
+					continue
+				}
+				seen[env] = true
+
+				statuses, _, err := ghc.client.Repositories.ListDeploymentStatuses(ctx, ghc.owner, ghc.repo, d.GetID(), &github.ListOptions{PerPage: 1})
+				if err != nil {
+					return nil, errors.Wrapf(err, "cannot list statuses of deployment %d on %s", d.GetID(), ghc.Locator())
+				}
+				if len(statuses) > 0 && statuses[0].GetState() == "success" {
+					deployments = append(deployments, env)
+				}
+			}
+
+			if res.NextPage == 0 {
+				break
+			}
+			opts.Page = res.NextPage
+		}
+
+		ghc.deployments = deployments
+	}
+
+	return ghc.deployments, nil
+}
+
+func (ghc *GithubContext) HeadCommittedAt(ctx context.Context) (time.Time, error) {
+	if ghc.headCommittedAt == nil {
+		commit, _, err := ghc.client.Git.GetCommit(ctx, ghc.owner, ghc.repo, ghc.pr.GetHead().GetSHA())
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "cannot get head commit %s for %s", ghc.pr.GetHead().GetSHA(), ghc.Locator())
+		}
+		committedAt := commit.GetCommitter().GetDate()
+		ghc.headCommittedAt = &committedAt
+	}
+
+	return *ghc.headCommittedAt, nil
 }
 
 func (ghc *GithubContext) Branches(ctx context.Context) (base string, head string, err error) {
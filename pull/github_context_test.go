@@ -0,0 +1,71 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApproversRequireWriteAccess(t *testing.T) {
+	permissions := map[string]string{
+		"alice": "admin",
+		"bob":   "write",
+		"carol": "read",
+	}
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Path == "/repos/palantir/bulldozer/pulls/7/reviews":
+			_, _ = w.Write([]byte(`[
+				{"id": 1, "user": {"login": "alice"}, "state": "APPROVED", "commit_id": "9f8e7d"},
+				{"id": 2, "user": {"login": "bob"}, "state": "APPROVED", "commit_id": "0a1b2c"},
+				{"id": 3, "user": {"login": "carol"}, "state": "APPROVED", "commit_id": "0a1b2c"}
+			]`))
+		case strings.HasPrefix(r.URL.Path, "/repos/palantir/bulldozer/collaborators/"):
+			login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/repos/palantir/bulldozer/collaborators/"), "/permission")
+			_, _ = w.Write([]byte(`{"permission": "` + permissions[login] + `"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	ctx := context.Background()
+	pr := &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String("9f8e7d")}}
+	pullCtx := NewGithubContext(client, pr, "palantir", "bulldozer", 7)
+
+	approvers, err := pullCtx.Approvers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, approvers, "approvals by users without write access do not count")
+
+	stale, err := pullCtx.StaleApprovers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, stale)
+	assert.Equal(t, 4, requests, "reviews and permissions are fetched once")
+}
@@ -90,3 +90,43 @@ func ListOpenPullRequests(ctx context.Context, client *github.Client, owner, rep
 
 	return results, nil
 }
+
+// LatestReviews returns the most recent approving, rejecting, or dismissed
+// review by each reviewer of the pull request, in the order reviewers first
+// submitted such a review. Comment-only reviews are ignored.
+func LatestReviews(ctx context.Context, client *github.Client, owner, repoName string, number int) ([]*github.PullRequestReview, error) {
+	// reviews are returned in chronological order, so later reviews by the
+	// same user replace earlier ones
+	latest := make(map[string]*github.PullRequestReview)
+	var order []string
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, res, err := client.PullRequests.ListReviews(ctx, owner, repoName, number, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range reviews {
+			login := r.GetUser().GetLogin()
+			switch r.GetState() {
+			case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+				if _, ok := latest[login]; !ok {
+					order = append(order, login)
+				}
+				latest[login] = r
+			}
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	results := make([]*github.PullRequestReview, 0, len(order))
+	for _, login := range order {
+		results = append(results, latest[login])
+	}
+	return results, nil
+}
@@ -16,15 +16,17 @@ package pulltest
 
 import (
 	"context"
+	"time"
 
 	"github.com/palantir/bulldozer/pull"
 )
 
 // MockPullContext is a dummy Context implementation.
 type MockPullContext struct {
-	OwnerValue  string
-	RepoValue   string
-	NumberValue int
+	OwnerValue   string
+	RepoValue    string
+	NumberValue  int
+	HeadSHAValue string
 
 	TitleValue    string
 	TitleErrValue error
@@ -40,12 +42,40 @@ type MockPullContext struct {
 	CommentValue    []string
 	CommentErrValue error
 
+	// AuthoredCommentValue are comments with authors, which come before the
+	// comments of CommentValue
+	AuthoredCommentValue []pull.Comment
+
 	RequiredStatusesValue    []string
 	RequiredStatusesErrValue error
 
 	SuccessStatusesValue    []string
 	SuccessStatusesErrValue error
 
+	StatusStatesValue    map[string]string
+	StatusStatesErrValue error
+
+	StatusesValue    map[string]pull.Status
+	StatusesErrValue error
+
+	SuccessStatusTimesValue    map[string]time.Time
+	SuccessStatusTimesErrValue error
+
+	SuccessfulDeploymentsValue    []string
+	SuccessfulDeploymentsErrValue error
+
+	RequiredApprovalsValue    int
+	RequiredApprovalsErrValue error
+
+	ApproversValue    []string
+	ApproversErrValue error
+
+	StaleApproversValue    []string
+	StaleApproversErrValue error
+
+	HeadCommittedAtValue    time.Time
+	HeadCommittedAtErrValue error
+
 	BranchBase     string
 	BranchName     string
 	BranchErrValue error
@@ -63,6 +93,10 @@ func (c *MockPullContext) Number() int {
 	return c.NumberValue
 }
 
+func (c *MockPullContext) HeadSHA() string {
+	return c.HeadSHAValue
+}
+
 func (c *MockPullContext) Locator() string {
 	if c.LocatorValue != "" {
 		return c.LocatorValue
@@ -79,7 +113,25 @@ func (c *MockPullContext) Body(ctx context.Context) (string, error) {
 }
 
 func (c *MockPullContext) Comments(ctx context.Context) ([]string, error) {
-	return c.CommentValue, c.CommentErrValue
+	if c.AuthoredCommentValue == nil {
+		return c.CommentValue, c.CommentErrValue
+	}
+
+	var bodies []string
+	for _, comment := range c.AuthoredCommentValue {
+		bodies = append(bodies, comment.Body)
+	}
+	return append(bodies, c.CommentValue...), c.CommentErrValue
+}
+
+// AuthoredComments returns AuthoredCommentValue followed by the comments of
+// CommentValue, which have no author.
+func (c *MockPullContext) AuthoredComments(ctx context.Context) ([]pull.Comment, error) {
+	comments := append([]pull.Comment(nil), c.AuthoredCommentValue...)
+	for _, body := range c.CommentValue {
+		comments = append(comments, pull.Comment{Body: body})
+	}
+	return comments, c.CommentErrValue
 }
 
 func (c *MockPullContext) RequiredStatuses(ctx context.Context) ([]string, error) {
@@ -90,6 +142,38 @@ func (c *MockPullContext) CurrentSuccessStatuses(ctx context.Context) ([]string,
 	return c.SuccessStatusesValue, c.SuccessStatusesErrValue
 }
 
+func (c *MockPullContext) StatusStates(ctx context.Context) (map[string]string, error) {
+	return c.StatusStatesValue, c.StatusStatesErrValue
+}
+
+func (c *MockPullContext) Statuses(ctx context.Context) (map[string]pull.Status, error) {
+	return c.StatusesValue, c.StatusesErrValue
+}
+
+func (c *MockPullContext) SuccessStatusTimes(ctx context.Context) (map[string]time.Time, error) {
+	return c.SuccessStatusTimesValue, c.SuccessStatusTimesErrValue
+}
+
+func (c *MockPullContext) SuccessfulDeployments(ctx context.Context) ([]string, error) {
+	return c.SuccessfulDeploymentsValue, c.SuccessfulDeploymentsErrValue
+}
+
+func (c *MockPullContext) RequiredApprovals(ctx context.Context) (int, error) {
+	return c.RequiredApprovalsValue, c.RequiredApprovalsErrValue
+}
+
+func (c *MockPullContext) Approvers(ctx context.Context) ([]string, error) {
+	return c.ApproversValue, c.ApproversErrValue
+}
+
+func (c *MockPullContext) StaleApprovers(ctx context.Context) ([]string, error) {
+	return c.StaleApproversValue, c.StaleApproversErrValue
+}
+
+func (c *MockPullContext) HeadCommittedAt(ctx context.Context) (time.Time, error) {
+	return c.HeadCommittedAtValue, c.HeadCommittedAtErrValue
+}
+
 func (c *MockPullContext) Branches(ctx context.Context) (base string, head string, err error) {
 	return c.BranchBase, c.BranchName, c.BranchErrValue
 }
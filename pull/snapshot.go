@@ -0,0 +1,345 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// snapshotQuery fetches the data used to evaluate a pull request. Lists are
+// limited to one page; data from truncated lists is loaded with the REST API
+// when it is needed.
+const snapshotQuery = `query($owner: String!, $repo: String!, $number: Int!) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      baseRef {
+        branchProtectionRule {
+          requiresStatusChecks
+          requiredStatusCheckContexts
+          requiresApprovingReviews
+          requiredApprovingReviewCount
+        }
+      }
+      comments(first: 100) {
+        pageInfo { hasNextPage }
+        nodes { author { __typename login } body }
+      }
+      reviews(first: 100) {
+        pageInfo { hasNextPage }
+        nodes {
+          author { login }
+          state
+          commit { oid }
+          comments(first: 100) {
+            pageInfo { hasNextPage }
+            nodes { author { __typename login } body }
+          }
+        }
+      }
+      commits(last: 1) {
+        nodes {
+          commit {
+            oid
+            committedDate
+            status {
+              contexts { context state description createdAt creator { __typename login } }
+            }
+            checkSuites(first: 50) {
+              pageInfo { hasNextPage }
+              nodes {
+                checkRuns(first: 100, filterBy: {checkType: LATEST}) {
+                  pageInfo { hasNextPage }
+                  nodes { name status conclusion completedAt }
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type pageInfo struct {
+	HasNextPage bool `json:"hasNextPage"`
+}
+
+type snapshotComments struct {
+	PageInfo pageInfo `json:"pageInfo"`
+	Nodes    []struct {
+		Author *snapshotActor `json:"author"`
+		Body   string         `json:"body"`
+	} `json:"nodes"`
+}
+
+type snapshotActor struct {
+	Typename string `json:"__typename"`
+	Login    string `json:"login"`
+}
+
+// restLogin returns the login of the actor as the REST API reports it. The
+// GraphQL API omits the "[bot]" suffix of the logins of bots.
+func (a *snapshotActor) restLogin() string {
+	if a == nil {
+		return ""
+	}
+	if a.Typename == "Bot" {
+		return a.Login + "[bot]"
+	}
+	return a.Login
+}
+
+type snapshotPullRequest struct {
+	BaseRef *struct {
+		BranchProtectionRule *struct {
+			RequiresStatusChecks         bool     `json:"requiresStatusChecks"`
+			RequiredStatusCheckContexts  []string `json:"requiredStatusCheckContexts"`
+			RequiresApprovingReviews     bool     `json:"requiresApprovingReviews"`
+			RequiredApprovingReviewCount int      `json:"requiredApprovingReviewCount"`
+		} `json:"branchProtectionRule"`
+	} `json:"baseRef"`
+
+	Comments snapshotComments `json:"comments"`
+
+	Reviews struct {
+		PageInfo pageInfo `json:"pageInfo"`
+		Nodes    []struct {
+			Author *struct {
+				Login string `json:"login"`
+			} `json:"author"`
+			State  string `json:"state"`
+			Commit *struct {
+				OID string `json:"oid"`
+			} `json:"commit"`
+			Comments snapshotComments `json:"comments"`
+		} `json:"nodes"`
+	} `json:"reviews"`
+
+	Commits struct {
+		Nodes []struct {
+			Commit struct {
+				OID           string    `json:"oid"`
+				CommittedDate time.Time `json:"committedDate"`
+				Status        *struct {
+					Contexts []struct {
+						Context     string         `json:"context"`
+						State       string         `json:"state"`
+						Description string         `json:"description"`
+						CreatedAt   time.Time      `json:"createdAt"`
+						Creator     *snapshotActor `json:"creator"`
+					} `json:"contexts"`
+				} `json:"status"`
+				CheckSuites struct {
+					PageInfo pageInfo `json:"pageInfo"`
+					Nodes    []struct {
+						CheckRuns struct {
+							PageInfo pageInfo `json:"pageInfo"`
+							Nodes    []struct {
+								Name        string     `json:"name"`
+								Status      string     `json:"status"`
+								Conclusion  string     `json:"conclusion"`
+								CompletedAt *time.Time `json:"completedAt"`
+							} `json:"nodes"`
+						} `json:"checkRuns"`
+					} `json:"nodes"`
+				} `json:"checkSuites"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"commits"`
+}
+
+type snapshotResponse struct {
+	Data struct {
+		Repository struct {
+			PullRequest *snapshotPullRequest `json:"pullRequest"`
+		} `json:"repository"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// NewSnapshotContext returns a Context for the pull request that loads the
+// comments, reviews, statuses, check runs, branch protection, and head commit
+// of the pull request with a single GraphQL query, so that evaluation makes
+// one request instead of several and sees a consistent view of the pull
+// request. Data that is not part of the snapshot, such as deployments, is
+// loaded with the REST API when it is needed.
+func NewSnapshotContext(ctx context.Context, client *github.Client, pr *github.PullRequest, owner, repo string, number int) (Context, error) {
+	ghc := NewGithubContext(client, pr, owner, repo, number).(*GithubContext)
+
+	body := map[string]interface{}{
+		"query": snapshotQuery,
+		"variables": map[string]interface{}{
+			"owner":  owner,
+			"repo":   repo,
+			"number": number,
+		},
+	}
+
+	// the GraphQL endpoint is next to the REST API root, both on GitHub.com
+	// and GitHub Enterprise
+	req, err := client.NewRequest("POST", "../graphql", body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create snapshot request")
+	}
+
+	var res snapshotResponse
+	if _, err := client.Do(ctx, req, &res); err != nil {
+		return nil, errors.Wrapf(err, "failed to get snapshot of %s", ghc.Locator())
+	}
+	if len(res.Errors) > 0 {
+		return nil, errors.Errorf("failed to get snapshot of %s: %s", ghc.Locator(), res.Errors[0].Message)
+	}
+	if res.Data.Repository.PullRequest == nil {
+		return nil, errors.Errorf("failed to get snapshot of %s: pull request not found", ghc.Locator())
+	}
+
+	if err := ghc.applySnapshot(res.Data.Repository.PullRequest); err != nil {
+		return nil, err
+	}
+	return ghc, nil
+}
+
+// applySnapshot fills the cached fields of the context from the snapshot.
+// Fields whose data was truncated are left empty, so they are loaded with the
+// REST API.
+func (ghc *GithubContext) applySnapshot(snap *snapshotPullRequest) error {
+	if len(snap.Commits.Nodes) == 0 {
+		return errors.Errorf("snapshot of %s has no commits", ghc.Locator())
+	}
+	head := snap.Commits.Nodes[0].Commit
+	if head.OID != ghc.pr.GetHead().GetSHA() {
+		return errors.Errorf("snapshot of %s is for commit %s, not %s", ghc.Locator(), head.OID, ghc.pr.GetHead().GetSHA())
+	}
+
+	protection := &github.Protection{}
+	if snap.BaseRef != nil && snap.BaseRef.BranchProtectionRule != nil {
+		rule := snap.BaseRef.BranchProtectionRule
+		if rule.RequiresStatusChecks {
+			protection.RequiredStatusChecks = &github.RequiredStatusChecks{Contexts: rule.RequiredStatusCheckContexts}
+		}
+		if rule.RequiresApprovingReviews {
+			protection.RequiredPullRequestReviews = &github.PullRequestReviewsEnforcement{RequiredApprovingReviewCount: rule.RequiredApprovingReviewCount}
+		}
+	}
+	ghc.protection = protection
+
+	truncatedComments := snap.Comments.PageInfo.HasNextPage || snap.Reviews.PageInfo.HasNextPage
+	comments := []Comment{}
+	for _, c := range snap.Comments.Nodes {
+		comments = append(comments, Comment{Author: c.Author.restLogin(), Body: c.Body})
+	}
+
+	latest := make(map[string]string)
+	latestCommit := make(map[string]string)
+	var order []string
+	for _, r := range snap.Reviews.Nodes {
+		for _, c := range r.Comments.Nodes {
+			comments = append(comments, Comment{Author: c.Author.restLogin(), Body: c.Body})
+		}
+		truncatedComments = truncatedComments || r.Comments.PageInfo.HasNextPage
+
+		if r.Author == nil {
+			continue
+		}
+		switch r.State {
+		case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+			if _, ok := latest[r.Author.Login]; !ok {
+				order = append(order, r.Author.Login)
+			}
+			latest[r.Author.Login] = r.State
+			latestCommit[r.Author.Login] = ""
+			if r.Commit != nil {
+				latestCommit[r.Author.Login] = r.Commit.OID
+			}
+		}
+	}
+	if !truncatedComments {
+		ghc.comments = comments
+	}
+	if !snap.Reviews.PageInfo.HasNextPage {
+		approvers := []string{}
+		var staleApprovers []string
+		for _, login := range order {
+			if latest[login] == "APPROVED" {
+				approvers = append(approvers, login)
+				if latestCommit[login] != head.OID {
+					staleApprovers = append(staleApprovers, login)
+				}
+			}
+		}
+		ghc.approvers = approvers
+		ghc.staleApprovers = staleApprovers
+	}
+
+	truncatedChecks := head.CheckSuites.PageInfo.HasNextPage
+	var successStatuses []string
+	statusTimes := make(map[string]time.Time)
+	statusStates := make(map[string]string)
+	statuses := make(map[string]Status)
+	if head.Status != nil {
+		for _, s := range head.Status.Contexts {
+			state := strings.ToLower(s.State)
+			statusStates[s.Context] = state
+			statuses[s.Context] = Status{
+				State:       state,
+				Description: s.Description,
+				Creator:     s.Creator.restLogin(),
+			}
+			if state == "success" {
+				// the REST API uses the updated_at time of the status. The
+				// GraphQL API has no such field, but statuses are never
+				// modified: a new status replaces the previous status for
+				// the context, so the creation time of the latest status is
+				// the same time
+				successStatuses = append(successStatuses, s.Context)
+				statusTimes[s.Context] = s.CreatedAt
+			}
+		}
+	}
+	for _, suite := range head.CheckSuites.Nodes {
+		truncatedChecks = truncatedChecks || suite.CheckRuns.PageInfo.HasNextPage
+		for _, r := range suite.CheckRuns.Nodes {
+			state := strings.ToLower(r.Status)
+			if state == "completed" {
+				state = strings.ToLower(r.Conclusion)
+			}
+			statusStates[r.Name] = state
+			if state == "success" {
+				successStatuses = append(successStatuses, r.Name)
+				if r.CompletedAt != nil {
+					statusTimes[r.Name] = *r.CompletedAt
+				}
+			}
+		}
+	}
+	if !truncatedChecks {
+		ghc.successStatuses = successStatuses
+		ghc.statusTimes = statusTimes
+		ghc.statusStates = statusStates
+		ghc.statuses = statuses
+	}
+
+	committedAt := head.CommittedDate
+	ghc.headCommittedAt = &committedAt
+
+	return nil
+}
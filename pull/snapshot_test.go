@@ -0,0 +1,200 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pull
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadSnapshot(t *testing.T, name string) snapshotResponse {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+
+	var res snapshotResponse
+	require.NoError(t, json.Unmarshal(data, &res))
+	return res
+}
+
+func snapshotTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestApplySnapshot(t *testing.T) {
+	tests := map[string]struct {
+		File string
+		SHA  string
+
+		Error           string
+		Protection      *github.Protection
+		Comments        []Comment
+		Approvers       []string
+		StaleApprovers  []string
+		SuccessStatuses []string
+		StatusTimes     map[string]time.Time
+		StatusStates    map[string]string
+		Statuses        map[string]Status
+	}{
+		"complete": {
+			File: "snapshot.json",
+			SHA:  "9f8e7d",
+			Protection: &github.Protection{
+				RequiredStatusChecks:       &github.RequiredStatusChecks{Contexts: []string{"ci", "policy-bot: develop"}},
+				RequiredPullRequestReviews: &github.PullRequestReviewsEnforcement{RequiredApprovingReviewCount: 2},
+			},
+			Comments: []Comment{
+				{Author: "alice", Body: "LGTM"},
+				{Author: "renovate[bot]", Body: "Rebased"},
+				{Author: "", Body: "from a deleted user"},
+				{Author: "bob", Body: "nit"},
+				{Author: "carol", Body: "why?"},
+			},
+			Approvers:       []string{"bob", "alice"},
+			StaleApprovers:  []string{"alice"},
+			SuccessStatuses: []string{"ci", "test"},
+			StatusTimes: map[string]time.Time{
+				"ci":   snapshotTime("2026-10-01T09:10:00Z"),
+				"test": snapshotTime("2026-10-01T09:20:00Z"),
+			},
+			StatusStates: map[string]string{
+				"ci":                  "success",
+				"policy-bot: develop": "pending",
+				"lint":                "error",
+				"test":                "success",
+				"e2e":                 "in_progress",
+				"vet":                 "failure",
+			},
+			Statuses: map[string]Status{
+				"ci":                  {State: "success", Description: "Build passed", Creator: "jenkins"},
+				"policy-bot: develop": {State: "pending", Description: "1/2 approvals required by policy", Creator: "policy-bot[bot]"},
+				"lint":                {State: "error"},
+			},
+		},
+		"truncatedCommentsAndChecks": {
+			File:       "snapshot_truncated.json",
+			SHA:        "9f8e7d",
+			Protection: &github.Protection{},
+			Approvers:  []string{"alice"},
+		},
+		"truncatedReviews": {
+			File:         "snapshot_reviews_truncated.json",
+			SHA:          "9f8e7d",
+			Protection:   &github.Protection{},
+			StatusTimes:  map[string]time.Time{},
+			StatusStates: map[string]string{},
+			Statuses:     map[string]Status{},
+		},
+		"staleHead": {
+			File:  "snapshot_stale.json",
+			SHA:   "9f8e7d",
+			Error: "snapshot of palantir/bulldozer#7 is for commit 0a1b2c, not 9f8e7d",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := loadSnapshot(t, test.File)
+			require.NotNil(t, res.Data.Repository.PullRequest)
+
+			pr := &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String(test.SHA)}}
+			ghc := NewGithubContext(nil, pr, "palantir", "bulldozer", 7).(*GithubContext)
+
+			err := ghc.applySnapshot(res.Data.Repository.PullRequest)
+			if test.Error != "" {
+				require.EqualError(t, err, test.Error)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, test.Protection, ghc.protection, "protection")
+			assert.Equal(t, test.Comments, ghc.comments, "comments")
+			assert.Equal(t, test.Approvers, ghc.approvers, "approvers")
+			assert.Equal(t, test.StaleApprovers, ghc.staleApprovers, "stale approvers")
+			assert.Equal(t, test.SuccessStatuses, ghc.successStatuses, "success statuses")
+			assert.Equal(t, test.StatusTimes, ghc.statusTimes, "status times")
+			assert.Equal(t, test.StatusStates, ghc.statusStates, "status states")
+			assert.Equal(t, test.Statuses, ghc.statuses, "statuses")
+
+			committedAt := snapshotTime("2026-10-01T09:00:00Z")
+			assert.Equal(t, &committedAt, ghc.headCommittedAt, "head committed at")
+		})
+	}
+}
+
+func TestApplySnapshotNoCommits(t *testing.T) {
+	pr := &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String("9f8e7d")}}
+	ghc := NewGithubContext(nil, pr, "palantir", "bulldozer", 7).(*GithubContext)
+
+	err := ghc.applySnapshot(&snapshotPullRequest{})
+	assert.EqualError(t, err, "snapshot of palantir/bulldozer#7 has no commits")
+}
+
+func TestNewSnapshotContext(t *testing.T) {
+	var response string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/api/graphql", r.URL.Path)
+
+		var body struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, snapshotQuery, body.Query)
+		assert.Equal(t, map[string]interface{}{"owner": "palantir", "repo": "bulldozer", "number": float64(7)}, body.Variables)
+
+		data, err := ioutil.ReadFile(filepath.Join("testdata", response))
+		require.NoError(t, err)
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/api/v3/")
+
+	ctx := context.Background()
+	pr := &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String("9f8e7d")}}
+
+	response = "snapshot.json"
+	pullCtx, err := NewSnapshotContext(ctx, client, pr, "palantir", "bulldozer", 7)
+	require.NoError(t, err)
+
+	statuses, err := pullCtx.Statuses(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1/2 approvals required by policy", statuses["policy-bot: develop"].Description)
+
+	required, err := pullCtx.RequiredStatuses(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ci", "policy-bot: develop"}, required)
+
+	response = "snapshot_errors.json"
+	_, err = NewSnapshotContext(ctx, client, pr, "palantir", "bulldozer", 7)
+	assert.EqualError(t, err, "failed to get snapshot of palantir/bulldozer#7: Could not resolve to a Repository with the name 'palantir/missing'.")
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package report sends errors and panics that stop bulldozer from processing
+// an event or pull request to an error tracking service.
+package report
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// Details describes what bulldozer was doing when an error occurred.
+type Details struct {
+	EventType  string
+	DeliveryID string
+
+	Owner  string
+	Repo   string
+	Number int
+
+	// ConfigHash identifies the repository configuration used, like in
+	// audit events
+	ConfigHash string
+
+	// Panic is true if the error was recovered from a panic, in which case
+	// Stack is the stack of the panicking goroutine
+	Panic bool
+	Stack string
+}
+
+// ErrorReporter sends errors to an error tracking service. Implementations
+// must be safe for concurrent use.
+type ErrorReporter interface {
+	Report(ctx context.Context, err error, details Details) error
+}
+
+type reporterCtxKey struct{}
+
+// WithReporter returns a context that reports errors to the reporter.
+func WithReporter(ctx context.Context, r ErrorReporter) context.Context {
+	return context.WithValue(ctx, reporterCtxKey{}, r)
+}
+
+// Ctx returns the reporter associated with the context. If the context has
+// no reporter, a reporter that discards errors is returned.
+func Ctx(ctx context.Context) ErrorReporter {
+	if r, ok := ctx.Value(reporterCtxKey{}).(ErrorReporter); ok {
+		return r
+	}
+	return nopReporter{}
+}
+
+// Report reports the error to the reporter associated with the context,
+// logging any errors.
+func Report(ctx context.Context, err error, details Details) {
+	if err == nil {
+		return
+	}
+	if rerr := Ctx(ctx).Report(ctx, err, details); rerr != nil {
+		zerolog.Ctx(ctx).Error().Err(rerr).Msg("Failed to report error")
+	}
+}
+
+type nopReporter struct{}
+
+func (nopReporter) Report(ctx context.Context, err error, details Details) error {
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+)
+
+// SentryConfig configures reporting to Sentry. Reporting is disabled unless a
+// DSN is set.
+type SentryConfig struct {
+	DSN         string `yaml:"dsn"`
+	Environment string `yaml:"environment"`
+}
+
+// SentryReporter sends errors to a Sentry project with the Sentry SDK. Events
+// are sent in the background.
+type SentryReporter struct {
+	client *sentry.Client
+}
+
+// NewSentryReporter returns a reporter for the project identified by the DSN
+// in the configuration, like "https://<key>@sentry.example.com/<project>".
+func NewSentryReporter(c SentryConfig, release string) (*SentryReporter, error) {
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         c.DSN,
+		Environment: c.Environment,
+		Release:     release,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid Sentry DSN")
+	}
+	return &SentryReporter{client: client}, nil
+}
+
+func (r *SentryReporter) Report(ctx context.Context, err error, details Details) error {
+	scope := sentry.NewScope()
+	scope.SetLevel(sentry.LevelError)
+	if details.Panic {
+		scope.SetLevel(sentry.LevelFatal)
+		scope.SetContext("panic", sentry.Context{"stack": details.Stack})
+	}
+
+	setTag := func(key, value string) {
+		if value != "" {
+			scope.SetTag(key, value)
+		}
+	}
+	setTag("event_type", details.EventType)
+	setTag("delivery_id", details.DeliveryID)
+	setTag("config_hash", details.ConfigHash)
+	if details.Owner != "" {
+		setTag("repository", details.Owner+"/"+details.Repo)
+	}
+	if details.Number > 0 {
+		setTag("pull_request", fmt.Sprintf("%s/%s#%d", details.Owner, details.Repo, details.Number))
+	}
+
+	// the SDK includes the stack of errors created by github.com/pkg/errors
+	if id := r.client.CaptureException(err, &sentry.EventHint{Context: ctx}, scope); id == nil {
+		return errors.New("failed to send Sentry event: the event was dropped")
+	}
+	return nil
+}
+
+// Flush waits until the reported events are sent or the context is done. It
+// does nothing if the reporter is nil.
+func (r *SentryReporter) Flush(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	if !r.client.FlushWithContext(ctx) {
+		return errors.New("failed to send Sentry events before the deadline")
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSentryReporter(t *testing.T) {
+	_, err := NewSentryReporter(SentryConfig{DSN: "https://public@sentry.example.com/42"}, "1.0.0")
+	require.NoError(t, err)
+
+	_, err = NewSentryReporter(SentryConfig{DSN: "https://sentry.example.com/42"}, "1.0.0")
+	assert.Error(t, err, "DSNs must have a key")
+
+	_, err = NewSentryReporter(SentryConfig{DSN: "https://public@sentry.example.com/"}, "1.0.0")
+	assert.Error(t, err, "DSNs must have a project")
+}
+
+type sentryEvent struct {
+	Level       string `json:"level"`
+	Environment string `json:"environment"`
+	Release     string `json:"release"`
+	Exception   []struct {
+		Value string `json:"value"`
+	} `json:"exception"`
+	Tags     map[string]string                 `json:"tags"`
+	Contexts map[string]map[string]interface{} `json:"contexts"`
+}
+
+func TestSentryReport(t *testing.T) {
+	events := make(chan sentryEvent, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/42/envelope/", r.URL.Path)
+
+		// an envelope is a header line followed by item header and payload
+		// lines
+		var lines []string
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		for i := 1; i+1 < len(lines); i += 2 {
+			if strings.Contains(lines[i], `"type":"event"`) {
+				var event sentryEvent
+				require.NoError(t, json.Unmarshal([]byte(lines[i+1]), &event))
+				events <- event
+			}
+		}
+	}))
+	defer srv.Close()
+
+	r, err := NewSentryReporter(SentryConfig{DSN: "http://public@" + srv.Listener.Addr().String() + "/42", Environment: "test"}, "1.0.0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, r.Report(ctx, errors.New("merge failed"), Details{
+		Owner:      "palantir",
+		Repo:       "bulldozer",
+		Number:     12,
+		ConfigHash: "abc",
+	}))
+	require.NoError(t, r.Flush(ctx))
+
+	event := <-events
+	require.Len(t, event.Exception, 1)
+	assert.Equal(t, "merge failed", event.Exception[0].Value)
+	assert.Equal(t, "error", event.Level)
+	assert.Equal(t, "test", event.Environment)
+	assert.Equal(t, "1.0.0", event.Release)
+	assert.Equal(t, "palantir/bulldozer", event.Tags["repository"])
+	assert.Equal(t, "palantir/bulldozer#12", event.Tags["pull_request"])
+	assert.Equal(t, "abc", event.Tags["config_hash"])
+
+	require.NoError(t, r.Report(ctx, errors.New("nil pointer dereference"), Details{Panic: true, Stack: "goroutine 1"}))
+	require.NoError(t, r.Flush(ctx))
+
+	event = <-events
+	assert.Equal(t, "fatal", event.Level)
+	assert.Equal(t, "goroutine 1", event.Contexts["panic"]["stack"])
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// GiteaConfig configures the Gitea or Forgejo server that bulldozer merges
+// pull requests on.
+type GiteaConfig struct {
+	// URL of the Gitea server, like "https://gitea.example.com"
+	URL string `yaml:"url"`
+
+	// Token is an access token of the bot user with read and write access
+	// to repositories and issues
+	Token string `yaml:"token"`
+
+	// WebhookSecret is the secret of the webhooks that Gitea sends to
+	// bulldozer
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+func (c GiteaConfig) Enabled() bool {
+	return c.URL != "" && c.Token != ""
+}
+
+// Gitea is the provider for a Gitea or Forgejo server, whose API is modeled
+// on GitHub's.
+type Gitea struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func NewGitea(c GiteaConfig) *Gitea {
+	return &Gitea{
+		URL:    strings.TrimSuffix(c.URL, "/"),
+		Token:  c.Token,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (g *Gitea) Name() string {
+	return "gitea"
+}
+
+// Supports returns true for the features of Gitea's API. Gitea has no
+// deployments API.
+func (g *Gitea) Supports(feature Feature) bool {
+	return feature != FeatureDeployments
+}
+
+// do sends a request to the Gitea API and decodes the JSON response into out,
+// if it is not nil.
+func (g *Gitea) do(ctx context.Context, method, path string, body, out interface{}) error {
+	header := make(http.Header)
+	header.Set("Authorization", "token "+g.Token)
+	return doJSON(ctx, g.Client, method, g.URL+"/api/v1/"+path, header, body, out)
+}
+
+func repoPath(owner, repo string) string {
+	return fmt.Sprintf("repos/%s/%s", url.PathEscape(owner), url.PathEscape(repo))
+}
+
+func (g *Gitea) FileContents(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+	var content []byte
+	p := fmt.Sprintf("%s/raw/%s?ref=%s", repoPath(owner, repo), url.PathEscape(path), url.QueryEscape(ref))
+	if err := g.do(ctx, http.MethodGet, p, nil, &content); err != nil {
+		if isStatus(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to fetch content of %q", path)
+	}
+	return content, nil
+}
+
+// giteaPullRequest is the subset of a Gitea pull request that bulldozer
+// uses.
+type giteaPullRequest struct {
+	Number         int    `json:"number"`
+	Title          string `json:"title"`
+	Body           string `json:"body"`
+	State          string `json:"state"`
+	MergeBase      string `json:"merge_base"`
+	MergeCommitSHA string `json:"merge_commit_sha"`
+	Head           struct {
+		Ref    string `json:"ref"`
+		SHA    string `json:"sha"`
+		RepoID int64  `json:"repo_id"`
+		Repo   struct {
+			Owner struct {
+				Login string `json:"login"`
+			} `json:"owner"`
+		} `json:"repo"`
+	} `json:"head"`
+	Base struct {
+		Ref    string `json:"ref"`
+		RepoID int64  `json:"repo_id"`
+	} `json:"base"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+func (g *Gitea) pullRequest(ctx context.Context, owner, repo string, number int) (*giteaPullRequest, error) {
+	var pr giteaPullRequest
+	if err := g.do(ctx, http.MethodGet, fmt.Sprintf("%s/pulls/%d", repoPath(owner, repo), number), nil, &pr); err != nil {
+		return nil, errors.Wrapf(err, "failed to get pull request %s/%s#%d", owner, repo, number)
+	}
+	return &pr, nil
+}
+
+func (g *Gitea) PullContext(ctx context.Context, owner, repo string, number int) (pull.Context, error) {
+	pr, err := g.pullRequest(ctx, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	return &giteaContext{gitea: g, pr: pr, owner: owner, repo: repo}, nil
+}
+
+// OpenPullRequestsForSHA returns the numbers of the open pull requests whose
+// head is the commit, among the 50 most recently updated.
+func (g *Gitea) OpenPullRequestsForSHA(ctx context.Context, owner, repo, sha string) ([]int, error) {
+	var prs []giteaPullRequest
+	if err := g.do(ctx, http.MethodGet, repoPath(owner, repo)+"/pulls?state=open&sort=recentupdate&limit=50", nil, &prs); err != nil {
+		return nil, errors.Wrap(err, "failed to list open pull requests")
+	}
+
+	var numbers []int
+	for _, pr := range prs {
+		if pr.Head.SHA == sha {
+			numbers = append(numbers, pr.Number)
+		}
+	}
+	return numbers, nil
+}
+
+func (g *Gitea) Merge(ctx context.Context, owner, repo string, number int, options MergeOptions) (string, error) {
+	style := "merge"
+	switch options.Method {
+	case Squash:
+		style = "squash"
+	case Rebase:
+		style = "rebase"
+	case FastForward:
+		style = "fast-forward-only"
+	}
+
+	body := map[string]interface{}{
+		"Do":                        style,
+		"delete_branch_after_merge": options.DeleteHead,
+	}
+	if options.Title != "" {
+		body["MergeTitleField"] = options.Title
+	}
+	if options.Message != "" {
+		body["MergeMessageField"] = options.Message
+	}
+	if options.SHA != "" {
+		body["head_commit_id"] = options.SHA
+	}
+
+	if err := g.do(ctx, http.MethodPost, fmt.Sprintf("%s/pulls/%d/merge", repoPath(owner, repo), number), body, nil); err != nil {
+		return "", errors.Wrapf(err, "failed to merge pull request %s/%s#%d", owner, repo, number)
+	}
+
+	pr, err := g.pullRequest(ctx, owner, repo, number)
+	if err != nil {
+		return "", err
+	}
+	return pr.MergeCommitSHA, nil
+}
+
+// Update merges the base branch into the head branch of the pull request, or
+// rebases the head branch onto it, if the base branch moved since the head
+// branch was created or last updated.
+func (g *Gitea) Update(ctx context.Context, owner, repo string, number int, method string) (bool, error) {
+	pr, err := g.pullRequest(ctx, owner, repo, number)
+	if err != nil {
+		return false, err
+	}
+
+	var branch struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	if err := g.do(ctx, http.MethodGet, fmt.Sprintf("%s/branches/%s", repoPath(owner, repo), url.PathEscape(pr.Base.Ref)), nil, &branch); err != nil {
+		return false, errors.Wrapf(err, "failed to get base branch %q", pr.Base.Ref)
+	}
+	if branch.Commit.ID == pr.MergeBase {
+		return false, nil
+	}
+
+	p := fmt.Sprintf("%s/pulls/%d/update?style=%s", repoPath(owner, repo), number, url.QueryEscape(method))
+	if err := g.do(ctx, http.MethodPost, p, nil, nil); err != nil {
+		return false, errors.Wrapf(err, "failed to update pull request %s/%s#%d", owner, repo, number)
+	}
+	return true, nil
+}
+
+func (g *Gitea) Comment(ctx context.Context, owner, repo string, number int, body string) error {
+	p := fmt.Sprintf("%s/issues/%d/comments", repoPath(owner, repo), number)
+	err := g.do(ctx, http.MethodPost, p, map[string]string{"body": body}, nil)
+	return errors.Wrapf(err, "failed to comment on pull request %s/%s#%d", owner, repo, number)
+}
+
+// type assertion
+var _ Provider = &Gitea{}
@@ -0,0 +1,333 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// giteaPageSize is the number of items requested per page. Servers may
+// return fewer if their maximum page size is smaller.
+const giteaPageSize = 50
+
+// giteaContext is the pull.Context of a Gitea pull request. Like
+// GithubContext, it caches what it loads.
+type giteaContext struct {
+	gitea *Gitea
+	pr    *giteaPullRequest
+	owner string
+	repo  string
+
+	comments        []pull.Comment
+	protection      *giteaProtection
+	statusStates    map[string]string
+	statuses        map[string]pull.Status
+	statusTimes     map[string]time.Time
+	approvers       []string
+	staleApprovers  []string
+	reviewsLoaded   bool
+	headCommittedAt *time.Time
+}
+
+type giteaProtection struct {
+	EnableStatusCheck   bool     `json:"enable_status_check"`
+	StatusCheckContexts []string `json:"status_check_contexts"`
+	RequiredApprovals   int      `json:"required_approvals"`
+}
+
+func (c *giteaContext) Owner() string {
+	return c.owner
+}
+
+func (c *giteaContext) Repo() string {
+	return c.repo
+}
+
+func (c *giteaContext) Number() int {
+	return c.pr.Number
+}
+
+func (c *giteaContext) HeadSHA() string {
+	return c.pr.Head.SHA
+}
+
+func (c *giteaContext) Locator() string {
+	return fmt.Sprintf("%s/%s#%d", c.owner, c.repo, c.pr.Number)
+}
+
+func (c *giteaContext) Title(ctx context.Context) (string, error) {
+	return c.pr.Title, nil
+}
+
+func (c *giteaContext) Body(ctx context.Context) (string, error) {
+	return c.pr.Body, nil
+}
+
+func (c *giteaContext) path(format string, args ...interface{}) string {
+	return repoPath(c.owner, c.repo) + fmt.Sprintf(format, args...)
+}
+
+func (c *giteaContext) Comments(ctx context.Context) ([]string, error) {
+	return commentBodies(c.AuthoredComments(ctx))
+}
+
+func (c *giteaContext) AuthoredComments(ctx context.Context) ([]pull.Comment, error) {
+	if c.comments == nil {
+		var comments []struct {
+			User struct {
+				Login string `json:"login"`
+			} `json:"user"`
+			Body string `json:"body"`
+		}
+		if err := c.gitea.do(ctx, http.MethodGet, c.path("/issues/%d/comments", c.pr.Number), nil, &comments); err != nil {
+			return nil, errors.Wrap(err, "failed to list pull request comments")
+		}
+		c.comments = []pull.Comment{}
+		for _, comment := range comments {
+			c.comments = append(c.comments, pull.Comment{Author: comment.User.Login, Body: comment.Body})
+		}
+	}
+	return c.comments, nil
+}
+
+// loadProtection loads the protection of the base branch. Branches without
+// protection have an empty protection.
+func (c *giteaContext) loadProtection(ctx context.Context) error {
+	if c.protection != nil {
+		return nil
+	}
+
+	var protection giteaProtection
+	if err := c.gitea.do(ctx, http.MethodGet, c.path("/branch_protections/%s", url.PathEscape(c.pr.Base.Ref)), nil, &protection); err != nil && !isStatus(err, http.StatusNotFound) {
+		return errors.Wrap(err, "failed to get branch protection")
+	}
+	c.protection = &protection
+	return nil
+}
+
+func (c *giteaContext) RequiredStatuses(ctx context.Context) ([]string, error) {
+	if err := c.loadProtection(ctx); err != nil {
+		return nil, err
+	}
+	if !c.protection.EnableStatusCheck {
+		return nil, nil
+	}
+	return c.protection.StatusCheckContexts, nil
+}
+
+func (c *giteaContext) RequiredApprovals(ctx context.Context) (int, error) {
+	if err := c.loadProtection(ctx); err != nil {
+		return 0, err
+	}
+	return c.protection.RequiredApprovals, nil
+}
+
+func (c *giteaContext) CurrentSuccessStatuses(ctx context.Context) ([]string, error) {
+	if err := c.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, state := range c.statusStates {
+		if state == "success" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (c *giteaContext) StatusStates(ctx context.Context) (map[string]string, error) {
+	if err := c.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return c.statusStates, nil
+}
+
+func (c *giteaContext) Statuses(ctx context.Context) (map[string]pull.Status, error) {
+	if err := c.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return c.statuses, nil
+}
+
+func (c *giteaContext) SuccessStatusTimes(ctx context.Context) (map[string]time.Time, error) {
+	if err := c.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return c.statusTimes, nil
+}
+
+// loadStatuses loads the latest status of each context on the head commit.
+// Gitea's "warning" state is treated as a failure.
+func (c *giteaContext) loadStatuses(ctx context.Context) error {
+	if c.statusStates != nil {
+		return nil
+	}
+
+	states := make(map[string]string)
+	details := make(map[string]pull.Status)
+	times := make(map[string]time.Time)
+	for page := 1; ; page++ {
+		var statuses []struct {
+			Context     string    `json:"context"`
+			Status      string    `json:"status"`
+			Description string    `json:"description"`
+			UpdatedAt   time.Time `json:"updated_at"`
+			Creator     struct {
+				Login string `json:"login"`
+			} `json:"creator"`
+		}
+		p := c.path("/commits/%s/statuses?sort=recentupdate&limit=%d&page=%d", c.pr.Head.SHA, giteaPageSize, page)
+		if err := c.gitea.do(ctx, http.MethodGet, p, nil, &statuses); err != nil {
+			return errors.Wrap(err, "failed to list commit statuses")
+		}
+
+		for _, s := range statuses {
+			if _, ok := states[s.Context]; ok {
+				continue
+			}
+			state := s.Status
+			if state == "warning" {
+				state = "failure"
+			}
+			states[s.Context] = state
+			details[s.Context] = pull.Status{State: state, Description: s.Description, Creator: s.Creator.Login}
+			if state == "success" {
+				times[s.Context] = s.UpdatedAt
+			}
+		}
+		if len(statuses) < giteaPageSize {
+			break
+		}
+	}
+
+	c.statusStates = states
+	c.statuses = details
+	c.statusTimes = times
+	return nil
+}
+
+// SuccessfulDeployments always returns no environments, because Gitea has no
+// deployments (see FeatureDeployments).
+func (c *giteaContext) SuccessfulDeployments(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+// loadReviews finds the users whose latest review is an approval that was
+// not dismissed, and those whose approval is for an earlier head.
+func (c *giteaContext) loadReviews(ctx context.Context) error {
+	if c.reviewsLoaded {
+		return nil
+	}
+
+	var reviews []struct {
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		State     string `json:"state"`
+		CommitID  string `json:"commit_id"`
+		Stale     bool   `json:"stale"`
+		Dismissed bool   `json:"dismissed"`
+	}
+	if err := c.gitea.do(ctx, http.MethodGet, c.path("/pulls/%d/reviews", c.pr.Number), nil, &reviews); err != nil {
+		return errors.Wrap(err, "failed to list pull request reviews")
+	}
+
+	// reviews are listed oldest first; comments do not replace approvals
+	latest := make(map[string]int)
+	var order []string
+	for i, r := range reviews {
+		if r.State != "APPROVED" && r.State != "REQUEST_CHANGES" {
+			continue
+		}
+		if _, ok := latest[r.User.Login]; !ok {
+			order = append(order, r.User.Login)
+		}
+		latest[r.User.Login] = i
+	}
+
+	for _, login := range order {
+		r := reviews[latest[login]]
+		if r.State != "APPROVED" || r.Dismissed {
+			continue
+		}
+		c.approvers = append(c.approvers, login)
+		if r.Stale || r.CommitID != c.pr.Head.SHA {
+			c.staleApprovers = append(c.staleApprovers, login)
+		}
+	}
+	c.reviewsLoaded = true
+	return nil
+}
+
+func (c *giteaContext) Approvers(ctx context.Context) ([]string, error) {
+	if err := c.loadReviews(ctx); err != nil {
+		return nil, err
+	}
+	return c.approvers, nil
+}
+
+func (c *giteaContext) StaleApprovers(ctx context.Context) ([]string, error) {
+	if err := c.loadReviews(ctx); err != nil {
+		return nil, err
+	}
+	return c.staleApprovers, nil
+}
+
+func (c *giteaContext) Labels(ctx context.Context) ([]string, error) {
+	var labels []string
+	for _, label := range c.pr.Labels {
+		labels = append(labels, label.Name)
+	}
+	return labels, nil
+}
+
+func (c *giteaContext) HeadCommittedAt(ctx context.Context) (time.Time, error) {
+	if c.headCommittedAt == nil {
+		var commit struct {
+			Commit struct {
+				Committer struct {
+					Date time.Time `json:"date"`
+				} `json:"committer"`
+			} `json:"commit"`
+		}
+		if err := c.gitea.do(ctx, http.MethodGet, c.path("/git/commits/%s", c.pr.Head.SHA), nil, &commit); err != nil {
+			return time.Time{}, errors.Wrap(err, "failed to get head commit")
+		}
+		c.headCommittedAt = &commit.Commit.Committer.Date
+	}
+	return *c.headCommittedAt, nil
+}
+
+// Branches returns the base and head branches. Like on GitHub, head branches
+// in forks are prefixed with the owner of the fork.
+func (c *giteaContext) Branches(ctx context.Context) (base string, head string, err error) {
+	base = c.pr.Base.Ref
+	if c.pr.Head.RepoID == c.pr.Base.RepoID {
+		return base, c.pr.Head.Ref, nil
+	}
+	return base, c.pr.Head.Repo.Owner.Login + ":" + c.pr.Head.Ref, nil
+}
+
+// type assertion
+var _ pull.Context = &giteaContext{}
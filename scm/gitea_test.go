@@ -0,0 +1,132 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGiteaPullContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token secret", r.Header.Get("Authorization"))
+
+		switch r.URL.Path {
+		case "/api/v1/repos/org/repo/pulls/3":
+			_, _ = w.Write([]byte(`{"number": 3, "title": "Fix bug", "head": {"ref": "fix", "sha": "abc", "repo_id": 2, "repo": {"owner": {"login": "fork"}}}, "base": {"ref": "main", "repo_id": 1}, "labels": [{"name": "merge when ready"}]}`))
+		case "/api/v1/repos/org/repo/branch_protections/main":
+			_, _ = w.Write([]byte(`{"enable_status_check": true, "status_check_contexts": ["ci"], "required_approvals": 1}`))
+		case "/api/v1/repos/org/repo/commits/abc/statuses":
+			_, _ = w.Write([]byte(`[{"context": "ci", "status": "success", "updated_at": "2020-01-02T00:00:00Z"}, {"context": "lint", "status": "warning", "updated_at": "2020-01-02T00:00:00Z"}, {"context": "ci", "status": "failure", "updated_at": "2020-01-01T00:00:00Z"}]`))
+		case "/api/v1/repos/org/repo/pulls/3/reviews":
+			_, _ = w.Write([]byte(`[
+				{"user": {"login": "alice"}, "state": "REQUEST_CHANGES", "commit_id": "old"},
+				{"user": {"login": "bob"}, "state": "APPROVED", "commit_id": "old"},
+				{"user": {"login": "alice"}, "state": "APPROVED", "commit_id": "abc"},
+				{"user": {"login": "alice"}, "state": "COMMENT", "commit_id": "abc"},
+				{"user": {"login": "carol"}, "state": "APPROVED", "commit_id": "abc", "dismissed": true}
+			]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	pullCtx, err := NewGitea(GiteaConfig{URL: srv.URL + "/", Token: "secret"}).PullContext(ctx, "org", "repo", 3)
+	require.NoError(t, err)
+
+	base, head, err := pullCtx.Branches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "main", base)
+	assert.Equal(t, "fork:fix", head)
+
+	required, err := pullCtx.RequiredStatuses(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ci"}, required)
+
+	states, err := pullCtx.StatusStates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ci": "success", "lint": "failure"}, states)
+
+	approvers, err := pullCtx.Approvers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, approvers)
+
+	stale, err := pullCtx.StaleApprovers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob"}, stale)
+}
+
+func TestGiteaUpdate(t *testing.T) {
+	var updated string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/repos/org/repo/pulls/3":
+			_, _ = w.Write([]byte(`{"number": 3, "merge_base": "base1", "base": {"ref": "main"}}`))
+		case r.URL.Path == "/api/v1/repos/org/repo/pulls/4":
+			_, _ = w.Write([]byte(`{"number": 4, "merge_base": "base2", "base": {"ref": "main"}}`))
+		case r.URL.Path == "/api/v1/repos/org/repo/branches/main":
+			_, _ = w.Write([]byte(`{"commit": {"id": "base2"}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/repos/org/repo/pulls/3/update":
+			updated = r.URL.Query().Get("style")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	g := NewGitea(GiteaConfig{URL: srv.URL, Token: "secret"})
+	ctx := context.Background()
+
+	ok, err := g.Update(ctx, "org", "repo", 4, UpdateRebase)
+	require.NoError(t, err)
+	assert.False(t, ok, "pull request based on the head of the base branch should not be updated")
+
+	ok, err = g.Update(ctx, "org", "repo", 3, UpdateRebase)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "rebase", updated)
+}
+
+func TestGiteaMerge(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/repos/org/repo/pulls/3/merge":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		case r.URL.Path == "/api/v1/repos/org/repo/pulls/3":
+			_, _ = w.Write([]byte(`{"number": 3, "merge_commit_sha": "abc"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	sha, err := NewGitea(GiteaConfig{URL: srv.URL, Token: "secret"}).Merge(context.Background(), "org", "repo", 3, MergeOptions{
+		Method: FastForward,
+		SHA:    "abc",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "abc", sha)
+	assert.Equal(t, "fast-forward-only", body["Do"])
+	assert.Equal(t, "abc", body["head_commit_id"])
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+)
+
+// GitHub reads files with a GitHub installation client.
+type GitHub struct {
+	Client *github.Client
+}
+
+func NewGitHub(client *github.Client) *GitHub {
+	return &GitHub{Client: client}
+}
+
+func (g *GitHub) Name() string {
+	return "github"
+}
+
+func (g *GitHub) FileContents(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+	file, _, _, err := g.Client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: ref})
+	if err != nil {
+		if rerr, ok := err.(*github.ErrorResponse); ok && rerr.Response.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to fetch content of %q", path)
+	}
+
+	// file will be nil if the ref contains a directory at the path
+	if file == nil {
+		return nil, nil
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode content of %q", path)
+	}
+	return []byte(content), nil
+}
+
+// type assertion
+var _ Source = &GitHub{}
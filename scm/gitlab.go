@@ -0,0 +1,218 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// DefaultGitLabURL is the URL of GitLab.com.
+const DefaultGitLabURL = "https://gitlab.com"
+
+// GitLabConfig configures the GitLab server that bulldozer merges merge
+// requests on.
+type GitLabConfig struct {
+	// URL of the GitLab server. Defaults to DefaultGitLabURL.
+	URL string `yaml:"url"`
+
+	// Token is a personal, group, or project access token with the "api"
+	// scope, used to read and merge merge requests
+	Token string `yaml:"token"`
+
+	// WebhookSecret is the secret token of the webhooks that GitLab sends to
+	// bulldozer
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+func (c GitLabConfig) Enabled() bool {
+	return c.Token != ""
+}
+
+// GitLab is the provider for a GitLab server. Owners are the full paths of
+// groups or users, and numbers are the internal IDs of merge requests.
+type GitLab struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func NewGitLab(c GitLabConfig) *GitLab {
+	g := &GitLab{
+		URL:    strings.TrimSuffix(c.URL, "/"),
+		Token:  c.Token,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+	if g.URL == "" {
+		g.URL = DefaultGitLabURL
+	}
+	return g
+}
+
+func (g *GitLab) Name() string {
+	return "gitlab"
+}
+
+// projectPath returns the escaped ID of the project for API paths.
+func projectPath(owner, repo string) string {
+	return "projects/" + url.PathEscape(owner+"/"+repo)
+}
+
+// do sends a request to the GitLab API and decodes the JSON response into
+// out, if it is not nil.
+func (g *GitLab) do(ctx context.Context, method, path string, body, out interface{}) error {
+	header := make(http.Header)
+	header.Set("PRIVATE-TOKEN", g.Token)
+	return doJSON(ctx, g.Client, method, g.URL+"/api/v4/"+path, header, body, out)
+}
+
+// Supports returns true for the features of GitLab's REST API. GitLab can
+// only update merge requests by rebasing them, and does not record the
+// commit that was approved.
+func (g *GitLab) Supports(feature Feature) bool {
+	switch feature {
+	case FeatureUpdateMerge, FeatureStaleApprovals, FeatureFastForward:
+		return false
+	}
+	return true
+}
+
+func (g *GitLab) FileContents(ctx context.Context, owner, repo, ref, path string) ([]byte, error) {
+	var content []byte
+	p := fmt.Sprintf("%s/repository/files/%s/raw?ref=%s", projectPath(owner, repo), url.PathEscape(path), url.QueryEscape(ref))
+	if err := g.do(ctx, http.MethodGet, p, nil, &content); err != nil {
+		if isStatus(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to fetch content of %q", path)
+	}
+	return content, nil
+}
+
+func (g *GitLab) PullContext(ctx context.Context, owner, repo string, number int) (pull.Context, error) {
+	mr, err := g.mergeRequest(ctx, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	return &gitlabContext{gitlab: g, mr: mr, owner: owner, repo: repo}, nil
+}
+
+// gitlabMergeRequest is the subset of a GitLab merge request that bulldozer
+// uses.
+type gitlabMergeRequest struct {
+	IID             int      `json:"iid"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	State           string   `json:"state"`
+	SHA             string   `json:"sha"`
+	SourceBranch    string   `json:"source_branch"`
+	TargetBranch    string   `json:"target_branch"`
+	SourceProjectID int      `json:"source_project_id"`
+	TargetProjectID int      `json:"target_project_id"`
+	Labels          []string `json:"labels"`
+	HeadPipeline    *struct {
+		Status string `json:"status"`
+	} `json:"head_pipeline"`
+	DivergedCommitsCount int `json:"diverged_commits_count"`
+}
+
+func (g *GitLab) mergeRequest(ctx context.Context, owner, repo string, number int) (*gitlabMergeRequest, error) {
+	var mr gitlabMergeRequest
+	p := fmt.Sprintf("%s/merge_requests/%d?include_diverged_commits_count=true", projectPath(owner, repo), number)
+	if err := g.do(ctx, http.MethodGet, p, nil, &mr); err != nil {
+		return nil, errors.Wrapf(err, "failed to get merge request %s/%s!%d", owner, repo, number)
+	}
+	return &mr, nil
+}
+
+func (g *GitLab) Merge(ctx context.Context, owner, repo string, number int, options MergeOptions) (string, error) {
+	body := map[string]interface{}{
+		"should_remove_source_branch": options.DeleteHead,
+	}
+	if options.SHA != "" {
+		body["sha"] = options.SHA
+	}
+
+	message := options.Title
+	if options.Message != "" {
+		message += "\n\n" + options.Message
+	}
+	if options.Method == Squash {
+		body["squash"] = true
+		if message != "" {
+			body["squash_commit_message"] = message
+		}
+	} else if message != "" && options.Method != Rebase {
+		body["merge_commit_message"] = message
+	}
+
+	var result struct {
+		MergeCommitSHA  string `json:"merge_commit_sha"`
+		SquashCommitSHA string `json:"squash_commit_sha"`
+		SHA             string `json:"sha"`
+	}
+	p := fmt.Sprintf("%s/merge_requests/%d/merge", projectPath(owner, repo), number)
+	if err := g.do(ctx, http.MethodPut, p, body, &result); err != nil {
+		return "", errors.Wrapf(err, "failed to merge merge request %s/%s!%d", owner, repo, number)
+	}
+
+	switch {
+	case result.MergeCommitSHA != "":
+		return result.MergeCommitSHA, nil
+	case result.SquashCommitSHA != "":
+		return result.SquashCommitSHA, nil
+	}
+	return result.SHA, nil
+}
+
+// Update rebases the source branch of the merge request onto its target
+// branch, which is the only way GitLab updates merge requests. GitLab
+// rebases asynchronously, so this returns before the head changes.
+func (g *GitLab) Update(ctx context.Context, owner, repo string, number int, method string) (bool, error) {
+	if method != UpdateRebase {
+		return false, errors.Errorf("unsupported update method %q", method)
+	}
+
+	mr, err := g.mergeRequest(ctx, owner, repo, number)
+	if err != nil {
+		return false, err
+	}
+	if mr.DivergedCommitsCount == 0 {
+		return false, nil
+	}
+
+	p := fmt.Sprintf("%s/merge_requests/%d/rebase", projectPath(owner, repo), number)
+	if err := g.do(ctx, http.MethodPut, p, nil, nil); err != nil {
+		return false, errors.Wrapf(err, "failed to rebase merge request %s/%s!%d", owner, repo, number)
+	}
+	return true, nil
+}
+
+func (g *GitLab) Comment(ctx context.Context, owner, repo string, number int, body string) error {
+	p := fmt.Sprintf("%s/merge_requests/%d/notes", projectPath(owner, repo), number)
+	err := g.do(ctx, http.MethodPost, p, map[string]string{"body": body}, nil)
+	return errors.Wrapf(err, "failed to comment on merge request %s/%s!%d", owner, repo, number)
+}
+
+// type assertion
+var _ Provider = &GitLab{}
@@ -0,0 +1,360 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// PipelineStatus is the name of the status that holds the state of the head
+// pipeline of a merge request. It is required if the project only allows
+// merges when pipelines succeed.
+const PipelineStatus = "pipeline"
+
+// gitlabContext is the pull.Context of a GitLab merge request. Like
+// GithubContext, it caches what it loads.
+type gitlabContext struct {
+	gitlab *GitLab
+	mr     *gitlabMergeRequest
+	owner  string
+	repo   string
+
+	comments        []pull.Comment
+	requireSuccess  *bool
+	statusStates    map[string]string
+	statuses        map[string]pull.Status
+	statusTimes     map[string]time.Time
+	approvals       *gitlabApprovals
+	headCommittedAt *time.Time
+	sourceNamespace string
+}
+
+type gitlabApprovals struct {
+	ApprovalsRequired int `json:"approvals_required"`
+	ApprovedBy        []struct {
+		User struct {
+			Username string `json:"username"`
+		} `json:"user"`
+	} `json:"approved_by"`
+}
+
+func (c *gitlabContext) Owner() string {
+	return c.owner
+}
+
+func (c *gitlabContext) Repo() string {
+	return c.repo
+}
+
+func (c *gitlabContext) Number() int {
+	return c.mr.IID
+}
+
+func (c *gitlabContext) HeadSHA() string {
+	return c.mr.SHA
+}
+
+func (c *gitlabContext) Locator() string {
+	return fmt.Sprintf("%s/%s#%d", c.owner, c.repo, c.mr.IID)
+}
+
+func (c *gitlabContext) Title(ctx context.Context) (string, error) {
+	return c.mr.Title, nil
+}
+
+func (c *gitlabContext) Body(ctx context.Context) (string, error) {
+	return c.mr.Description, nil
+}
+
+func (c *gitlabContext) path(format string, args ...interface{}) string {
+	return projectPath(c.owner, c.repo) + fmt.Sprintf(format, args...)
+}
+
+func (c *gitlabContext) Comments(ctx context.Context) ([]string, error) {
+	return commentBodies(c.AuthoredComments(ctx))
+}
+
+func (c *gitlabContext) AuthoredComments(ctx context.Context) ([]pull.Comment, error) {
+	if c.comments == nil {
+		comments := []pull.Comment{}
+		for page := 1; ; page++ {
+			var notes []struct {
+				Author struct {
+					Username string `json:"username"`
+				} `json:"author"`
+				Body   string `json:"body"`
+				System bool   `json:"system"`
+			}
+			if err := c.gitlab.do(ctx, http.MethodGet, c.path("/merge_requests/%d/notes?per_page=100&page=%d", c.mr.IID, page), nil, &notes); err != nil {
+				return nil, errors.Wrap(err, "failed to list merge request notes")
+			}
+			for _, note := range notes {
+				if !note.System {
+					comments = append(comments, pull.Comment{Author: note.Author.Username, Body: note.Body})
+				}
+			}
+			if len(notes) < 100 {
+				break
+			}
+		}
+		c.comments = comments
+	}
+	return c.comments, nil
+}
+
+// RequiredStatuses returns PipelineStatus if the project only allows merges
+// when pipelines succeed. GitLab has no other required statuses.
+func (c *gitlabContext) RequiredStatuses(ctx context.Context) ([]string, error) {
+	if c.requireSuccess == nil {
+		var project struct {
+			OnlyAllowMergeIfPipelineSucceeds bool `json:"only_allow_merge_if_pipeline_succeeds"`
+		}
+		if err := c.gitlab.do(ctx, http.MethodGet, projectPath(c.owner, c.repo), nil, &project); err != nil {
+			return nil, errors.Wrap(err, "failed to get project")
+		}
+		c.requireSuccess = &project.OnlyAllowMergeIfPipelineSucceeds
+	}
+
+	if *c.requireSuccess {
+		return []string{PipelineStatus}, nil
+	}
+	return nil, nil
+}
+
+func (c *gitlabContext) CurrentSuccessStatuses(ctx context.Context) ([]string, error) {
+	if err := c.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, state := range c.statusStates {
+		if state == "success" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (c *gitlabContext) StatusStates(ctx context.Context) (map[string]string, error) {
+	if err := c.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return c.statusStates, nil
+}
+
+func (c *gitlabContext) Statuses(ctx context.Context) (map[string]pull.Status, error) {
+	if err := c.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return c.statuses, nil
+}
+
+func (c *gitlabContext) SuccessStatusTimes(ctx context.Context) (map[string]time.Time, error) {
+	if err := c.loadStatuses(ctx); err != nil {
+		return nil, err
+	}
+	return c.statusTimes, nil
+}
+
+// loadStatuses loads the commit statuses of the head commit, which include
+// the jobs of its pipelines, and the state of the head pipeline. GitLab
+// states are translated to GitHub states and conclusions.
+func (c *gitlabContext) loadStatuses(ctx context.Context) error {
+	if c.statusStates != nil {
+		return nil
+	}
+
+	states := make(map[string]string)
+	details := make(map[string]pull.Status)
+	times := make(map[string]time.Time)
+	for page := 1; ; page++ {
+		var statuses []struct {
+			Name        string     `json:"name"`
+			Status      string     `json:"status"`
+			Description string     `json:"description"`
+			CreatedAt   time.Time  `json:"created_at"`
+			FinishedAt  *time.Time `json:"finished_at"`
+			Author      struct {
+				Username string `json:"username"`
+			} `json:"author"`
+		}
+		if err := c.gitlab.do(ctx, http.MethodGet, c.path("/repository/commits/%s/statuses?per_page=100&page=%d", c.mr.SHA, page), nil, &statuses); err != nil {
+			return errors.Wrap(err, "failed to list commit statuses")
+		}
+
+		// statuses are listed newest first, so only the first of each name
+		// is current
+		for _, s := range statuses {
+			if _, ok := states[s.Name]; ok {
+				continue
+			}
+			states[s.Name] = gitlabState(s.Status)
+			details[s.Name] = pull.Status{State: states[s.Name], Description: s.Description, Creator: s.Author.Username}
+			if states[s.Name] == "success" {
+				times[s.Name] = s.CreatedAt
+				if s.FinishedAt != nil {
+					times[s.Name] = *s.FinishedAt
+				}
+			}
+		}
+		if len(statuses) < 100 {
+			break
+		}
+	}
+
+	if c.mr.HeadPipeline != nil {
+		states[PipelineStatus] = gitlabState(c.mr.HeadPipeline.Status)
+	}
+
+	c.statusStates = states
+	c.statuses = details
+	c.statusTimes = times
+	return nil
+}
+
+// gitlabState translates the status of a GitLab job or pipeline to the
+// state of a GitHub status or the conclusion of a check run.
+func gitlabState(status string) string {
+	switch status {
+	case "success":
+		return "success"
+	case "failed":
+		return "failure"
+	case "canceled":
+		return "cancelled"
+	case "skipped":
+		return "skipped"
+	case "manual":
+		return "action_required"
+	}
+	return "pending"
+}
+
+// SuccessfulDeployments returns the environments in which the most recent
+// deployment of the head commit succeeded, among the latest 100 deployments
+// of the project.
+func (c *gitlabContext) SuccessfulDeployments(ctx context.Context) ([]string, error) {
+	var deployments []struct {
+		SHA         string `json:"sha"`
+		Status      string `json:"status"`
+		Environment struct {
+			Name string `json:"name"`
+		} `json:"environment"`
+	}
+	if err := c.gitlab.do(ctx, http.MethodGet, c.path("/deployments?order_by=id&sort=desc&per_page=100"), nil, &deployments); err != nil {
+		return nil, errors.Wrap(err, "failed to list deployments")
+	}
+
+	seen := make(map[string]bool)
+	var environments []string
+	for _, d := range deployments {
+		if d.SHA != c.mr.SHA || seen[d.Environment.Name] {
+			continue
+		}
+		seen[d.Environment.Name] = true
+		if d.Status == "success" {
+			environments = append(environments, d.Environment.Name)
+		}
+	}
+	return environments, nil
+}
+
+func (c *gitlabContext) loadApprovals(ctx context.Context) error {
+	if c.approvals != nil {
+		return nil
+	}
+
+	var approvals gitlabApprovals
+	if err := c.gitlab.do(ctx, http.MethodGet, c.path("/merge_requests/%d/approvals", c.mr.IID), nil, &approvals); err != nil {
+		return errors.Wrap(err, "failed to get merge request approvals")
+	}
+	c.approvals = &approvals
+	return nil
+}
+
+func (c *gitlabContext) RequiredApprovals(ctx context.Context) (int, error) {
+	if err := c.loadApprovals(ctx); err != nil {
+		return 0, err
+	}
+	return c.approvals.ApprovalsRequired, nil
+}
+
+func (c *gitlabContext) Approvers(ctx context.Context) ([]string, error) {
+	if err := c.loadApprovals(ctx); err != nil {
+		return nil, err
+	}
+
+	var approvers []string
+	for _, a := range c.approvals.ApprovedBy {
+		approvers = append(approvers, a.User.Username)
+	}
+	return approvers, nil
+}
+
+// StaleApprovers always returns no approvers, because GitLab does not record
+// the commit that was approved (see FeatureStaleApprovals). Projects can reset
+// approvals on push instead.
+func (c *gitlabContext) StaleApprovers(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+func (c *gitlabContext) Labels(ctx context.Context) ([]string, error) {
+	return c.mr.Labels, nil
+}
+
+func (c *gitlabContext) HeadCommittedAt(ctx context.Context) (time.Time, error) {
+	if c.headCommittedAt == nil {
+		var commit struct {
+			CommittedDate time.Time `json:"committed_date"`
+		}
+		if err := c.gitlab.do(ctx, http.MethodGet, c.path("/repository/commits/%s", c.mr.SHA), nil, &commit); err != nil {
+			return time.Time{}, errors.Wrap(err, "failed to get head commit")
+		}
+		c.headCommittedAt = &commit.CommittedDate
+	}
+	return *c.headCommittedAt, nil
+}
+
+// Branches returns the target and source branches of the merge request.
+// Source branches in forks are prefixed with the namespace of the fork.
+func (c *gitlabContext) Branches(ctx context.Context) (base string, head string, err error) {
+	base = c.mr.TargetBranch
+	if c.mr.SourceProjectID == c.mr.TargetProjectID {
+		return base, c.mr.SourceBranch, nil
+	}
+
+	if c.sourceNamespace == "" {
+		var project struct {
+			Namespace struct {
+				FullPath string `json:"full_path"`
+			} `json:"namespace"`
+		}
+		if err := c.gitlab.do(ctx, http.MethodGet, fmt.Sprintf("projects/%d", c.mr.SourceProjectID), nil, &project); err != nil {
+			return "", "", errors.Wrap(err, "failed to get source project")
+		}
+		c.sourceNamespace = project.Namespace.FullPath
+	}
+	return base, c.sourceNamespace + ":" + c.mr.SourceBranch, nil
+}
+
+// type assertion
+var _ pull.Context = &gitlabContext{}
@@ -0,0 +1,125 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitLabPullContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("PRIVATE-TOKEN"))
+
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fsub%2Fproject/merge_requests/7":
+			_, _ = w.Write([]byte(`{"iid": 7, "title": "Add feature", "sha": "abc", "source_branch": "feature", "target_branch": "main", "source_project_id": 1, "target_project_id": 1, "labels": ["merge when ready"], "head_pipeline": {"status": "running"}}`))
+		case "/api/v4/projects/group%2Fsub%2Fproject":
+			_, _ = w.Write([]byte(`{"only_allow_merge_if_pipeline_succeeds": true}`))
+		case "/api/v4/projects/group%2Fsub%2Fproject/repository/commits/abc/statuses":
+			_, _ = w.Write([]byte(`[{"name": "test", "status": "success", "created_at": "2020-01-01T00:00:00Z"}, {"name": "lint", "status": "failed", "created_at": "2020-01-01T00:00:00Z"}, {"name": "test", "status": "failed", "created_at": "2019-12-31T00:00:00Z"}]`))
+		case "/api/v4/projects/group%2Fsub%2Fproject/merge_requests/7/approvals":
+			_, _ = w.Write([]byte(`{"approvals_required": 2, "approved_by": [{"user": {"username": "alice"}}]}`))
+		case "/api/v4/projects/group%2Fsub%2Fproject/merge_requests/7/notes":
+			_, _ = w.Write([]byte(`[{"body": "LGTM", "system": false}, {"body": "added 1 commit", "system": true}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	pullCtx, err := NewGitLab(GitLabConfig{URL: srv.URL, Token: "token"}).PullContext(ctx, "group/sub", "project", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "group/sub/project#7", pullCtx.Locator())
+
+	base, head, err := pullCtx.Branches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "main", base)
+	assert.Equal(t, "feature", head)
+
+	required, err := pullCtx.RequiredStatuses(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{PipelineStatus}, required)
+
+	states, err := pullCtx.StatusStates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"test": "success", "lint": "failure", PipelineStatus: "pending"}, states)
+
+	approvalsRequired, err := pullCtx.RequiredApprovals(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, approvalsRequired)
+
+	approvers, err := pullCtx.Approvers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alice"}, approvers)
+
+	comments, err := pullCtx.Comments(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"LGTM"}, comments)
+}
+
+func TestGitLabFileContents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() == "/api/v4/projects/group%2Fproject/repository/files/.bulldozer.v1.yml/raw" && r.URL.Query().Get("ref") == "main" {
+			_, _ = w.Write([]byte("version: 1\n"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	g := NewGitLab(GitLabConfig{URL: srv.URL, Token: "token"})
+	ctx := context.Background()
+
+	content, err := g.FileContents(ctx, "group", "project", "main", ".bulldozer.v1.yml")
+	require.NoError(t, err)
+	assert.Equal(t, "version: 1\n", string(content))
+
+	content, err = g.FileContents(ctx, "group", "project", "other", ".bulldozer.v1.yml")
+	require.NoError(t, err)
+	assert.Nil(t, content)
+}
+
+func TestGitLabMerge(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/api/v4/projects/group%2Fproject/merge_requests/7/merge", r.URL.EscapedPath())
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		_, _ = w.Write([]byte(`{"merge_commit_sha": null, "squash_commit_sha": "def"}`))
+	}))
+	defer srv.Close()
+
+	sha, err := NewGitLab(GitLabConfig{URL: srv.URL, Token: "token"}).Merge(context.Background(), "group", "project", 7, MergeOptions{
+		Method:     Squash,
+		Title:      "Add feature (!7)",
+		Message:    "Details",
+		SHA:        "abc",
+		DeleteHead: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "def", sha)
+	assert.Equal(t, true, body["squash"])
+	assert.Equal(t, "Add feature (!7)\n\nDetails", body["squash_commit_message"])
+	assert.Equal(t, "abc", body["sha"])
+	assert.Equal(t, true, body["should_remove_source_branch"])
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// apiError is returned for unsuccessful responses from the REST APIs of
+// providers.
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err apiError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", err.StatusCode, err.Message)
+}
+
+// isStatus returns true if the error is an unsuccessful response with the
+// status.
+func isStatus(err error, status int) bool {
+	aerr, ok := errors.Cause(err).(apiError)
+	return ok && aerr.StatusCode == status
+}
+
+// doJSON sends a request with a JSON body, if it is not nil, and decodes the
+// JSON response into out, if it is not nil. If out is a *[]byte, it receives
+// the raw response.
+func doJSON(ctx context.Context, client *http.Client, method, url string, header http.Header, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal request")
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return apiError{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+	if out == nil {
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw, err = ioutil.ReadAll(res.Body)
+		return err
+	}
+	return errors.Wrap(json.NewDecoder(res.Body).Decode(out), "failed to decode response")
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scm abstracts the source code management services that bulldozer
+// merges pull requests on, so that the same configuration and merge
+// requirements work on GitLab merge requests and Gitea pull requests. GitHub
+// pull requests are handled by the GitHub webhook handlers, so GitHub is only
+// a Source of configuration files.
+package scm
+
+import (
+	"context"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// Merge methods understood by providers. Only providers that support
+// FeatureFastForward merge with FastForward.
+const (
+	MergeCommit = "merge"
+	Squash      = "squash"
+	Rebase      = "rebase"
+	FastForward = "fast_forward"
+)
+
+// Methods of updating a pull request with its base branch.
+const (
+	UpdateMerge  = "merge"
+	UpdateRebase = "rebase"
+)
+
+// Feature is an optional capability of a provider. Configurations that rely
+// on features a provider does not support are not applied silently.
+type Feature string
+
+const (
+	// FeatureUpdateMerge updates pull requests by merging the base branch
+	// into the head branch
+	FeatureUpdateMerge Feature = "update_merge"
+
+	// FeatureUpdateRebase updates pull requests by rebasing the head branch
+	// onto the base branch
+	FeatureUpdateRebase Feature = "update_rebase"
+
+	// FeatureDeployments reports the deployments of the head commit for
+	// "required_deployments"
+	FeatureDeployments Feature = "deployments"
+
+	// FeatureStaleApprovals reports approvals of commits other than the
+	// head for "stale_approvals"
+	FeatureStaleApprovals Feature = "stale_approvals"
+
+	// FeatureFastForward merges by moving the base branch to the head of the
+	// pull request
+	FeatureFastForward Feature = "fast_forward"
+)
+
+// MergeOptions configures how a pull request is merged.
+type MergeOptions struct {
+	Method string
+
+	// Title and Message of the merge or squash commit. If empty, the
+	// provider's default is used.
+	Title   string
+	Message string
+
+	// SHA is the expected head of the pull request. The merge fails if the
+	// head changed.
+	SHA string
+
+	// DeleteHead deletes the head branch after merging.
+	DeleteHead bool
+}
+
+// Source is a source code management service that bulldozer reads
+// configuration files from. Repositories are identified by an owner, which
+// may be a nested group on GitLab, and a name. Implementations must be safe
+// for concurrent use.
+type Source interface {
+	// Name returns the name of the service, like "github"
+	Name() string
+
+	// FileContents returns the contents of the file at the ref, or nil if
+	// the file does not exist
+	FileContents(ctx context.Context, owner, repo, ref, path string) ([]byte, error)
+}
+
+// Provider is a source code management service that bulldozer evaluates,
+// merges, and updates pull requests on. Pull requests are identified by
+// their number in the repository.
+type Provider interface {
+	Source
+
+	// Supports returns true if the provider supports the feature
+	Supports(feature Feature) bool
+
+	// PullContext returns the context for evaluating the pull request
+	PullContext(ctx context.Context, owner, repo string, number int) (pull.Context, error)
+
+	// Merge merges the pull request and returns the SHA of the resulting
+	// commit
+	Merge(ctx context.Context, owner, repo string, number int, options MergeOptions) (string, error)
+
+	// Update brings the head branch of the pull request up to date with its
+	// base branch with the method, which must be supported. It returns false
+	// if the branch was already up to date.
+	Update(ctx context.Context, owner, repo string, number int, method string) (bool, error)
+
+	// Comment adds a comment to the pull request
+	Comment(ctx context.Context, owner, repo string, number int, body string) error
+}
+
+// commentBodies returns the bodies of the comments, for implementing
+// pull.Context.Comments with pull.Context.AuthoredComments.
+func commentBodies(comments []pull.Comment, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	bodies := []string{}
+	for _, c := range comments {
+		bodies = append(bodies, c.Body)
+	}
+	return bodies, nil
+}
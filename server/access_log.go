@@ -0,0 +1,192 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultAccessLogMaxPayloadBytes = 4096
+
+	redacted = "[REDACTED]"
+)
+
+// AccessLogConfig configures a log line for each webhook delivery, with the
+// delivery, the repository, the response status, and the time it took.
+type AccessLogConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// If true, payloads and headers are included after redacting secrets.
+	// Payloads larger than MaxPayloadBytes are omitted.
+	Payloads        bool `yaml:"payloads"`
+	MaxPayloadBytes int  `yaml:"max_payload_bytes"`
+}
+
+var (
+	// sensitiveKey matches the names of headers and payload fields that hold
+	// credentials
+	sensitiveKey = regexp.MustCompile(`(?i)token|secret|password|authorization|signature|private_key|cookie`)
+
+	// githubToken matches GitHub access tokens appearing in any value
+	githubToken = regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,}|v1\.[0-9a-f]{40})\b`)
+
+	// queryParam matches the parameters of query strings in URLs appearing in
+	// any value, so that parameters with sensitive names can be redacted
+	queryParam = regexp.MustCompile(`[?&][^=&#\s]+=[^&#\s"]*`)
+)
+
+// accessLogHandler logs each webhook delivery handled by h.
+func accessLogHandler(c AccessLogConfig, h http.Handler) http.Handler {
+	maxPayload := c.MaxPayloadBytes
+	if maxPayload <= 0 {
+		maxPayload = DefaultAccessLogMaxPayloadBytes
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+
+		var payload struct {
+			Action     string `json:"action"`
+			Repository struct {
+				FullName string `json:"full_name"`
+			} `json:"repository"`
+		}
+		_ = json.Unmarshal(body, &payload)
+
+		event := zerolog.Ctx(r.Context()).Info().
+			Str(githubapp.LogKeyDeliveryID, r.Header.Get("X-GitHub-Delivery")).
+			Str(githubapp.LogKeyEventType, r.Header.Get("X-GitHub-Event")).
+			Str("action", payload.Action).
+			Str("repository", payload.Repository.FullName).
+			Int("status", rec.status).
+			Str("outcome", deliveryOutcome(rec.status)).
+			Dur("elapsed", time.Since(start)).
+			Int("payload_size", len(body))
+
+		if c.Payloads {
+			headers := make(map[string]string, len(r.Header))
+			for name := range r.Header {
+				headers[name] = redactValue(name, r.Header.Get(name))
+			}
+			event = event.Interface("headers", headers)
+
+			if len(body) > maxPayload {
+				event = event.Bool("payload_omitted", true)
+			} else {
+				event = event.RawJSON("payload", redactPayload(body))
+			}
+		}
+
+		event.Msg("Webhook delivery handled")
+	})
+}
+
+func deliveryOutcome(status int) string {
+	switch {
+	case status >= 500:
+		return "failed"
+	case status >= 400:
+		return "rejected"
+	default:
+		return "processed"
+	}
+}
+
+// redactPayload replaces the values of sensitive fields and any GitHub
+// tokens in a JSON payload. Payloads that are not JSON are omitted.
+func redactPayload(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return []byte(`"` + redacted + `"`)
+	}
+
+	b, err := json.Marshal(redactJSON("", v))
+	if err != nil {
+		return []byte(`"` + redacted + `"`)
+	}
+	return b
+}
+
+// redactJSON redacts a decoded JSON value stored under the key. Values of
+// sensitive keys are replaced entirely, even if they are objects or arrays.
+func redactJSON(key string, v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return redactValue(key, s)
+	}
+	if v != nil && key != "" && sensitiveKey.MatchString(key) {
+		return redacted
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = redactJSON(k, elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = redactJSON(key, elem)
+		}
+	}
+	return v
+}
+
+// redactValue redacts a header or string field value. Values of sensitive
+// keys are replaced entirely; otherwise GitHub tokens and sensitive query
+// parameters in the value are replaced.
+func redactValue(key, value string) string {
+	if value != "" && sensitiveKey.MatchString(key) {
+		return redacted
+	}
+
+	value = githubToken.ReplaceAllString(value, redacted)
+	return queryParam.ReplaceAllStringFunc(value, func(param string) string {
+		i := strings.IndexByte(param, '=')
+		if sensitiveKey.MatchString(param[1:i]) {
+			return param[:i+1] + redacted
+		}
+		return param
+	})
+}
+
+// statusRecorder records the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
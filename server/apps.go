@@ -0,0 +1,403 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/palantir/bulldozer/alert"
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/jira"
+	"github.com/palantir/bulldozer/notify"
+	"github.com/palantir/bulldozer/outcome"
+	"github.com/palantir/bulldozer/report"
+	"github.com/palantir/bulldozer/server/handler"
+	"github.com/palantir/bulldozer/state"
+	"github.com/palantir/bulldozer/version"
+)
+
+// AppConfig configures an additional GitHub App served by the same server,
+// for example the installation of bulldozer on a GitHub Enterprise instance.
+type AppConfig struct {
+	// Name identifies the app in webhook routes, admin routes, and the keys
+	// of its queued and failed deliveries
+	Name   string           `yaml:"name"`
+	Github githubapp.Config `yaml:"github"`
+
+	// SweepRepositories are the "owner/name" repositories of the app to
+	// sweep, using the sweep interval of the server options
+	SweepRepositories []string `yaml:"sweep_repositories"`
+
+	// PreviousWebhookSecrets are also accepted when verifying webhooks of
+	// the app, while its secret is rotated
+	PreviousWebhookSecrets []string `yaml:"previous_webhook_secrets"`
+}
+
+// appServices are the parts of the server shared by all GitHub Apps.
+type appServices struct {
+	registry      metrics.Registry
+	stateStore    state.Store
+	auditSink     audit.Sink
+	errorReporter report.ErrorReporter
+	tracer        *sdktrace.TracerProvider
+	statsd        *statsdEmitter
+	operations    *handler.Operations
+	webhookPool   *handler.WebhookPool
+	mergeLimiter  *handler.MergeLimiter
+	archive       *payloadArchive
+	admin         bool
+	outcomes      *outcome.Log
+	notifiers     []notify.Notifier
+	notifyQueue   *notify.Queue
+	jira          *jira.Client
+	alerts        *alert.Manager
+}
+
+// githubApp is a GitHub App served by the server, with its own clients,
+// handlers, and queues.
+type githubApp struct {
+	name          string
+	config        githubapp.Config
+	clientCreator githubapp.ClientCreator
+	store         state.Store
+	base          handler.Base
+	activity      *handler.Activity
+	stats         *handler.InstallationStats
+	deadLetters   *handler.DeadLetters
+	workQueue     *handler.WorkQueue
+	sweep         *handler.UpdateSweep
+	catchUp       *handler.CatchUp
+	maintenance   *handler.Maintenance
+	scheduler     *handler.Scheduler
+	dispatcher    http.Handler
+}
+
+// newGithubApp creates the clients and handlers of an app. The primary app
+// has an empty name.
+func newGithubApp(c *Config, name string, gh githubapp.Config, sweepRepositories, previousSecrets []string, s appServices) (*githubApp, error) {
+	// the state of additional apps is kept apart, so that repositories with
+	// the same name on different GitHub hosts do not share locks, pauses, or
+	// cached responses, and each app only processes its own deliveries and
+	// scheduled tasks
+	appStore := s.stateStore
+	if name != "" {
+		appStore = state.WithPrefix(s.stateStore, "apps/"+name+"/")
+	}
+
+	auditSink := s.auditSink
+	var activity *handler.Activity
+	var stats *handler.InstallationStats
+	if s.admin {
+		activity = &handler.Activity{Store: appStore}
+		stats = &handler.InstallationStats{Store: appStore}
+		auditSink = addSinks(auditSink, activity, stats)
+	}
+
+	var alerts *alert.Manager
+	if s.alerts != nil {
+		appAlerts := *s.alerts
+		appAlerts.Store = appStore
+		alerts = &appAlerts
+
+		if threshold := c.Alerts.Threshold(); threshold > 0 {
+			auditSink = addSinks(auditSink, &alert.FailureTracker{Manager: alerts, Store: appStore, Threshold: threshold})
+		}
+	}
+
+	userAgent := fmt.Sprintf("%s/%s", c.Options.AppName, version.GetVersion())
+	middleware := []githubapp.ClientMiddleware{
+		githubapp.ClientLogging(zerolog.DebugLevel),
+		githubapp.ClientMetrics(s.registry),
+	}
+	rateLimits := handler.NewRateLimits(c.Options.RateLimitReserve)
+	rateLimits.Registry = s.registry
+	middleware = append(middleware, rateLimits.Middleware())
+	if cb := c.Options.CircuitBreaker; cb.Enabled {
+		breaker := &handler.CircuitBreaker{
+			Window:       cb.Window,
+			MinRequests:  cb.MinRequests,
+			FailureRatio: cb.FailureRatio,
+			Cooldown:     cb.Cooldown,
+			Registry:     s.registry,
+		}
+		if alerts != nil && c.Alerts.CircuitBreaker {
+			breaker.OnOpen = alerts.CircuitOpened
+			breaker.OnClose = alerts.CircuitClosed
+		}
+		middleware = append(middleware, breaker.Middleware())
+	}
+	if auditSink != nil {
+		middleware = append(middleware, auditMiddleware(auditSink))
+	}
+	if s.tracer != nil {
+		middleware = append(middleware, tracingMiddleware())
+	}
+	if s.outcomes != nil {
+		middleware = append(middleware, outcomeMiddleware())
+	}
+	if c.Options.ResponseCache.Enabled {
+		middleware = append(middleware, responseCacheMiddleware(appStore, c.Options.ResponseCache.TTL, s.registry))
+	}
+	if c.Options.DryRun {
+		middleware = append(middleware, dryRunMiddleware())
+	}
+
+	clientCreator, err := githubapp.NewDefaultCachingClientCreator(
+		gh,
+		githubapp.WithClientUserAgent(userAgent),
+		githubapp.WithClientMiddleware(middleware...),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Github client creator")
+	}
+
+	scheduler := &handler.Scheduler{Store: appStore, Operations: s.operations}
+
+	baseHandler := handler.Base{
+		ClientCreator:    clientCreator,
+		ConfigFetcher:    bulldozer.NewConfigFetcher(c.Options.ConfigurationPath, c.Options.ConfigurationV0Paths),
+		Scheduler:        scheduler,
+		UpdateScheduler:  handler.NewUpdateScheduler(c.Options.Updates.Delay, c.Options.Updates.MaxDelay, c.Options.Updates.MaxConcurrent, c.Options.Updates.MaxConcurrentPerRepo),
+		MergeQueue:       bulldozer.NewMergeQueue(),
+		AuditSink:        auditSink,
+		StateStore:       appStore,
+		Registry:         s.registry,
+		Operations:       s.operations,
+		RateLimits:       rateLimits,
+		GraphQLSnapshots: c.Options.GraphQLSnapshots,
+		ErrorReporter:    s.errorReporter,
+		MergeLimiter:     s.mergeLimiter,
+		Outcomes:         s.outcomes,
+		Jira:             s.jira,
+		Identity:         &handler.AppIdentity{ClientCreator: clientCreator},
+	}
+	baseHandler.UpdateScheduler.RateLimits = rateLimits
+
+	if cl := c.Options.CreateLabels; cl.Enabled {
+		baseHandler.LabelCreator = &bulldozer.LabelCreator{
+			Default: bulldozer.LabelStyle{Color: cl.Color, Description: cl.Description},
+			Labels:  cl.Labels,
+		}
+	}
+
+	if len(s.notifiers) > 0 {
+		baseHandler.Notifications = &notify.Dispatcher{Notifiers: s.notifiers, WebURL: gh.WebURL, Queue: s.notifyQueue}
+	}
+
+	if ks := c.Options.KillSwitch; ks.Enabled {
+		baseHandler.KillSwitch = &bulldozer.KillSwitch{Path: ks.Path, TTL: ks.CacheTTL, RequireRepository: ks.RequireRepository}
+	}
+
+	if signing := c.Options.Signing; signing.KeyID != "" {
+		baseHandler.CommitSigner = &bulldozer.GPGSigner{
+			Program: signing.GPGProgram,
+			KeyID:   signing.KeyID,
+			Name:    signing.Name,
+			Email:   signing.Email,
+			Timeout: signing.Timeout,
+		}
+	}
+
+	scheduler.Register(handler.TaskEvaluate, baseHandler.RunEvaluationTask)
+	scheduler.Register(handler.TaskUpdate, baseHandler.RunUpdateTask)
+
+	eventHandlers := []githubapp.EventHandler{
+		&handler.BranchProtectionRule{Base: baseHandler},
+		&handler.CheckRun{Base: baseHandler},
+		&handler.DeploymentStatus{Base: baseHandler},
+		&handler.IssueComment{Base: baseHandler},
+		&handler.PullRequest{Base: baseHandler},
+		&handler.PullRequestReview{Base: baseHandler},
+		&handler.Push{Base: baseHandler},
+		&handler.Status{Base: baseHandler},
+	}
+
+	for i, h := range eventHandlers {
+		eventHandlers[i] = handler.Correlate(h)
+	}
+	if s.errorReporter != nil {
+		for i, h := range eventHandlers {
+			eventHandlers[i] = reportHandler(s.errorReporter, h)
+		}
+	}
+	if s.tracer != nil {
+		for i, h := range eventHandlers {
+			eventHandlers[i] = traceHandler(s.tracer, h)
+		}
+	}
+	if s.statsd != nil {
+		for i, h := range eventHandlers {
+			eventHandlers[i] = metricsHandler(s.registry, s.statsd, h)
+		}
+	}
+
+	if stats != nil {
+		for i, h := range eventHandlers {
+			eventHandlers[i] = stats.Wrap(h)
+		}
+	}
+
+	deadLetters := &handler.DeadLetters{Store: appStore, TTL: c.Options.DeadLetterTTL}
+	for i, h := range eventHandlers {
+		eventHandlers[i] = deadLetters.Wrap(h)
+	}
+
+	if s.webhookPool != nil {
+		for i, h := range eventHandlers {
+			eventHandlers[i] = s.webhookPool.Wrap(h)
+		}
+	}
+
+	var workQueue *handler.WorkQueue
+	if c.Options.WorkQueue.Enabled {
+		workQueue = &handler.WorkQueue{Store: appStore, Workers: c.Options.WorkQueue.Workers, Operations: s.operations}
+		for i, h := range eventHandlers {
+			eventHandlers[i] = workQueue.Wrap(h)
+		}
+	}
+
+	if c.Options.DeliveryDedupTTL >= 0 {
+		dedup := &handler.Deduplicator{Store: appStore, TTL: c.Options.DeliveryDedupTTL}
+		for i, h := range eventHandlers {
+			eventHandlers[i] = dedup.Wrap(h)
+		}
+	}
+
+	maintenance := &handler.Maintenance{Store: appStore, Operations: s.operations}
+	for i, h := range eventHandlers {
+		eventHandlers[i] = maintenance.Wrap(h)
+	}
+	if c.Options.Maintenance.Enabled {
+		if err := maintenance.Enable(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.archive != nil {
+		for i, h := range eventHandlers {
+			eventHandlers[i] = s.archive.Wrap(h)
+		}
+	}
+
+	var sweep *handler.UpdateSweep
+	if interval := c.Options.Updates.SweepInterval; interval > 0 && len(sweepRepositories) > 0 {
+		sweep = &handler.UpdateSweep{
+			Base:         baseHandler,
+			Interval:     interval,
+			Repositories: sweepRepositories,
+		}
+	}
+
+	var catchUp *handler.CatchUp
+	if c.Options.CatchUp.Enabled {
+		catchUp = &handler.CatchUp{
+			Base:     baseHandler,
+			Interval: c.Options.CatchUp.Interval,
+		}
+	}
+
+	return &githubApp{
+		name:          name,
+		config:        gh,
+		clientCreator: clientCreator,
+		store:         appStore,
+		base:          baseHandler,
+		activity:      activity,
+		stats:         stats,
+		deadLetters:   deadLetters,
+		workQueue:     workQueue,
+		sweep:         sweep,
+		catchUp:       catchUp,
+		maintenance:   maintenance,
+		scheduler:     scheduler,
+		dispatcher:    newSignatureDispatcher(append([]string{gh.App.WebhookSecret}, previousSecrets...), eventHandlers...),
+	}, nil
+}
+
+// inline handles deliveries before responding, even when webhooks are
+// otherwise processed in the background, so that message queue consumers
+// acknowledge messages only after they are handled.
+func inline(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(handler.WithInline(r.Context())))
+	})
+}
+
+// webhookRouter sends each webhook to the app it was sent to, identified by
+// the App ID and the GitHub Enterprise host in its headers. Webhooks that do
+// not identify an app are sent to the first app.
+func webhookRouter(apps []*githubApp) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.Header.Get("X-GitHub-Hook-Installation-Target-ID")
+		host := r.Header.Get("X-GitHub-Enterprise-Host")
+
+		// App IDs are only unique on a single GitHub host, so the host must
+		// match as well; deliveries from github.com carry no host header
+		app := apps[0]
+		for _, a := range apps {
+			if !a.matchesHost(host) {
+				continue
+			}
+			if target != "" && target == strconv.Itoa(a.config.App.IntegrationID) {
+				app = a
+				break
+			}
+			if host != "" {
+				app = a
+			}
+		}
+		app.dispatcher.ServeHTTP(w, r)
+	})
+}
+
+// matchesHost returns true if deliveries with the given
+// X-GitHub-Enterprise-Host header may come from the app.
+func (a *githubApp) matchesHost(host string) bool {
+	if host == "" {
+		return a.host() == "" || a.host() == "github.com"
+	}
+	return host == a.host()
+}
+
+// addSinks appends sinks to the audit sink, which may be nil.
+func addSinks(sink audit.Sink, sinks ...audit.Sink) audit.Sink {
+	if sink == nil {
+		if len(sinks) == 1 {
+			return sinks[0]
+		}
+		return audit.MultiSink(sinks)
+	}
+	return audit.MultiSink(append([]audit.Sink{sink}, sinks...))
+}
+
+// host returns the host of the GitHub web URL of the app.
+func (a *githubApp) host() string {
+	u, err := url.Parse(a.config.WebURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
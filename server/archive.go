@@ -0,0 +1,111 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/archive"
+	"github.com/palantir/bulldozer/server/handler"
+)
+
+// archivePruneInterval is how often records older than the retention are
+// removed from the archive directory.
+const archivePruneInterval = time.Hour
+
+// payloadArchive stores the deliveries that match the configuration before
+// they are handled.
+type payloadArchive struct {
+	config     archive.Config
+	archive    archive.Archive
+	operations *handler.Operations
+}
+
+func newPayloadArchive(c archive.Config, operations *handler.Operations) *payloadArchive {
+	return &payloadArchive{config: c, archive: archive.New(c), operations: operations}
+}
+
+// Wrap returns a handler that archives deliveries for h. Deliveries are
+// archived in the background, so slow storage does not delay webhooks, and
+// failures are logged without failing the delivery. The server waits for
+// pending records to be stored before it stops.
+func (a *payloadArchive) Wrap(h githubapp.EventHandler) githubapp.EventHandler {
+	return &archivingHandler{EventHandler: h, archive: a}
+}
+
+type archivingHandler struct {
+	githubapp.EventHandler
+	archive *payloadArchive
+}
+
+func (h *archivingHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+	}
+	_ = json.Unmarshal(payload, &event)
+
+	if h.archive.config.Matches(eventType, event.Repository.FullName) {
+		record := archive.Record{
+			DeliveryID: deliveryID,
+			EventType:  eventType,
+			Repository: event.Repository.FullName,
+			Payload:    json.RawMessage(payload),
+			ReceivedAt: time.Now().UTC(),
+		}
+
+		logger := zerolog.Ctx(ctx)
+		h.archive.operations.Go(func() {
+			if err := h.archive.archive.Store(logger.WithContext(context.Background()), record); err != nil {
+				logger.Error().Err(err).Msgf("Failed to archive delivery %s", deliveryID)
+			}
+		})
+	}
+
+	return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+}
+
+// Run removes records older than the retention from the archive directory
+// every prune interval until the context is canceled. It returns immediately
+// if records are kept forever or there is no directory. Each server prunes
+// its own directory; records in S3 are expired by the bucket's lifecycle
+// rules.
+func (a *payloadArchive) Run(ctx context.Context) {
+	if a.config.Retention <= 0 || a.config.Directory == "" {
+		return
+	}
+	files := &archive.FileArchive{Dir: a.config.Directory}
+
+	ticker := time.NewTicker(archivePruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := files.Prune(ctx, time.Now().Add(-a.config.Retention)); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to prune webhook archive")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/archive"
+	"github.com/palantir/bulldozer/server/handler"
+)
+
+// slowArchive takes a while to store each record.
+type slowArchive struct {
+	lock   sync.Mutex
+	stored []string
+}
+
+func (a *slowArchive) Store(ctx context.Context, r archive.Record) error {
+	time.Sleep(50 * time.Millisecond)
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.stored = append(a.stored, r.DeliveryID)
+	return nil
+}
+
+type noopHandler struct{}
+
+func (noopHandler) Handles() []string {
+	return []string{"push"}
+}
+
+func (noopHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	return nil
+}
+
+func TestPayloadArchiveDrain(t *testing.T) {
+	store := &slowArchive{}
+	operations := &handler.Operations{}
+	payloads := &payloadArchive{archive: store, operations: operations}
+
+	h := payloads.Wrap(noopHandler{})
+	require.NoError(t, h.Handle(context.Background(), "push", "d1", []byte(`{"repository":{"full_name":"o/r"}}`)))
+
+	require.NoError(t, operations.Drain(context.Background()))
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	assert.Equal(t, []string{"d1"}, store.stored, "the server waits for pending records before it stops")
+}
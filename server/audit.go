@@ -0,0 +1,93 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/audit"
+)
+
+// auditMiddleware records an audit event for every GitHub request that may
+// change something, so that comments, labels, and other side effects are
+// recorded along with merges and updates.
+func auditMiddleware(sink audit.Sink) githubapp.ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if isReadOnlyRequest(r) {
+				return next.RoundTrip(r)
+			}
+
+			start := time.Now()
+			res, err := next.RoundTrip(r)
+
+			event := audit.Event{
+				Type:           audit.TypeRequest,
+				Method:         r.Method,
+				Detail:         r.URL.Path,
+				Result:         audit.ResultSucceeded,
+				DurationMillis: time.Since(start).Nanoseconds() / int64(time.Millisecond),
+			}
+			event.Owner, event.Repo, event.Number = requestTarget(r.URL.Path)
+
+			switch err.(type) {
+			case nil:
+			case dryRunError:
+				event.Result = audit.ResultDryRun
+			default:
+				event.Result = audit.ResultFailed
+				event.Detail += ": " + err.Error()
+			}
+			if res != nil && res.StatusCode >= 400 {
+				event.Result = audit.ResultFailed
+				event.Detail += ": " + res.Status
+			}
+			if res != nil {
+				if id := res.Header.Get("X-GitHub-Request-Id"); id != "" {
+					event.RequestIDs = []string{id}
+				}
+			}
+
+			event.Time = time.Now().UTC()
+			if err := sink.Record(r.Context(), event); err != nil {
+				zerolog.Ctx(r.Context()).Error().Err(err).Msgf("Failed to record %s audit event", event.Type)
+			}
+			return res, err
+		})
+	}
+}
+
+// requestTarget returns the repository and the issue or pull request number
+// of a GitHub API path, if they are present.
+func requestTarget(path string) (owner, repo string, number int) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] != "repos" {
+			continue
+		}
+		owner, repo = parts[i+1], parts[i+2]
+		if i+4 < len(parts) && (parts[i+3] == "pulls" || parts[i+3] == "issues") {
+			number, _ = strconv.Atoi(parts[i+4])
+		}
+		break
+	}
+	return owner, repo, number
+}
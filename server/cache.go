@@ -0,0 +1,156 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	DefaultResponseCacheTTL = 1 * time.Hour
+
+	// maxCachedResponseSize is the largest response body that is cached
+	maxCachedResponseSize = 1 << 20
+
+	responseCachePrefix = "response-cache/"
+
+	MetricsKeyResponseCacheHits   = "bulldozer.github.response_cache.hits"
+	MetricsKeyResponseCacheMisses = "bulldozer.github.response_cache.misses"
+)
+
+// cachedResponse is a GitHub response stored in the state store.
+type cachedResponse struct {
+	ETag   string      `json:"etag"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// responseCacheMiddleware sends conditional requests for GETs that were
+// answered before. GitHub does not count requests answered with "304 Not
+// Modified" against the rate limit, so repeated reads of unchanged pull
+// requests, reviews, and statuses are free. Callers see the cached response
+// as if it was sent again.
+func responseCacheMiddleware(store state.Store, ttl time.Duration, registry metrics.Registry) githubapp.ClientMiddleware {
+	if ttl <= 0 {
+		ttl = DefaultResponseCacheTTL
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if r.Method != http.MethodGet || r.Header.Get("If-None-Match") != "" {
+				return next.RoundTrip(r)
+			}
+
+			ctx := r.Context()
+			logger := zerolog.Ctx(ctx)
+			key := responseCacheKey(r)
+
+			var cached *cachedResponse
+			if b, ok, err := store.Get(ctx, key); err != nil {
+				logger.Warn().Err(err).Msg("Failed to read cached GitHub response")
+			} else if ok {
+				cached = &cachedResponse{}
+				if err := json.Unmarshal(b, cached); err != nil {
+					logger.Warn().Err(err).Msg("Failed to decode cached GitHub response")
+					cached = nil
+				}
+			}
+
+			if cached != nil {
+				r = r.Clone(ctx)
+				r.Header.Set("If-None-Match", cached.ETag)
+			}
+
+			res, err := next.RoundTrip(r)
+			if err != nil {
+				return res, err
+			}
+
+			if cached != nil && res.StatusCode == http.StatusNotModified {
+				metrics.GetOrRegisterCounter(MetricsKeyResponseCacheHits, registry).Inc(1)
+				_ = res.Body.Close()
+
+				// keep headers of the new response, like rate limits
+				header := cached.Header.Clone()
+				for k, v := range res.Header {
+					header[k] = v
+				}
+
+				res.StatusCode = http.StatusOK
+				res.Status = "200 OK"
+				res.Header = header
+				res.Body = ioutil.NopCloser(bytes.NewReader(cached.Body))
+				res.ContentLength = int64(len(cached.Body))
+				return res, nil
+			}
+
+			metrics.GetOrRegisterCounter(MetricsKeyResponseCacheMisses, registry).Inc(1)
+
+			etag := res.Header.Get("ETag")
+			if res.StatusCode != http.StatusOK || etag == "" || res.ContentLength > maxCachedResponseSize {
+				return res, nil
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxCachedResponseSize+1))
+			if err != nil {
+				_ = res.Body.Close()
+				return nil, err
+			}
+			if len(body) > maxCachedResponseSize {
+				res.Body = readCloser{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+				return res, nil
+			}
+			_ = res.Body.Close()
+			res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			b, err := json.Marshal(cachedResponse{ETag: etag, Header: res.Header, Body: body})
+			if err == nil {
+				err = store.Set(ctx, key, b, ttl)
+			}
+			if err != nil {
+				logger.Warn().Err(err).Msg("Failed to cache GitHub response")
+			}
+			return res, nil
+		})
+	}
+}
+
+// responseCacheKey identifies a response by its URL and the media type that
+// was requested, which selects between different representations. Responses
+// are shared between installations: GitHub only answers a conditional
+// request with "304 Not Modified" if the installation can read the resource
+// and its content is the same.
+func responseCacheKey(r *http.Request) string {
+	sum := sha256.Sum256([]byte(r.Header.Get("Accept") + " " + r.URL.String()))
+	return responseCachePrefix + hex.EncodeToString(sum[:])
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+// fakeGitHub answers requests with a fixed body and ETag, and with "304 Not
+// Modified" to conditional requests for that ETag.
+type fakeGitHub struct {
+	body     string
+	etag     string
+	requests []*http.Request
+}
+
+func (g *fakeGitHub) RoundTrip(r *http.Request) (*http.Response, error) {
+	g.requests = append(g.requests, r)
+
+	w := httptest.NewRecorder()
+	w.Header().Set("X-RateLimit-Remaining", "4999")
+	if g.etag != "" {
+		w.Header().Set("ETag", g.etag)
+	}
+	if g.etag != "" && r.Header.Get("If-None-Match") == g.etag {
+		w.WriteHeader(http.StatusNotModified)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.WriteString(g.body)
+	}
+	return w.Result(), nil
+}
+
+func get(t *testing.T, rt http.RoundTripper, url string) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.Nil(t, err)
+
+	res, err := rt.RoundTrip(req)
+	require.Nil(t, err)
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	return res, string(b)
+}
+
+func TestResponseCache(t *testing.T) {
+	store := state.NewMemoryStore()
+	registry := metrics.NewRegistry()
+	github := &fakeGitHub{body: `{"number": 1}`, etag: `"abc"`}
+	rt := responseCacheMiddleware(store, time.Hour, registry)(github)
+
+	res, body := get(t, rt, "https://api.github.com/repos/o/r/pulls/1")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, `{"number": 1}`, body)
+	assert.Empty(t, github.requests[0].Header.Get("If-None-Match"))
+
+	res, body = get(t, rt, "https://api.github.com/repos/o/r/pulls/1")
+	assert.Equal(t, http.StatusOK, res.StatusCode, "not modified responses are answered from the cache")
+	assert.Equal(t, `{"number": 1}`, body)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	assert.Equal(t, "4999", res.Header.Get("X-RateLimit-Remaining"))
+	assert.Equal(t, `"abc"`, github.requests[1].Header.Get("If-None-Match"))
+
+	assert.Equal(t, int64(1), metrics.GetOrRegisterCounter(MetricsKeyResponseCacheHits, registry).Count())
+	assert.Equal(t, int64(1), metrics.GetOrRegisterCounter(MetricsKeyResponseCacheMisses, registry).Count())
+}
+
+func TestResponseCacheChanged(t *testing.T) {
+	store := state.NewMemoryStore()
+	github := &fakeGitHub{body: `{"number": 1}`, etag: `"abc"`}
+	rt := responseCacheMiddleware(store, time.Hour, metrics.NewRegistry())(github)
+
+	get(t, rt, "https://api.github.com/repos/o/r/pulls/1")
+
+	github.body, github.etag = `{"number": 2}`, `"def"`
+	_, body := get(t, rt, "https://api.github.com/repos/o/r/pulls/1")
+	assert.Equal(t, `{"number": 2}`, body)
+
+	_, body = get(t, rt, "https://api.github.com/repos/o/r/pulls/1")
+	assert.Equal(t, `{"number": 2}`, body, "the changed response replaces the cached one")
+	assert.Equal(t, `"def"`, github.requests[2].Header.Get("If-None-Match"))
+}
+
+func TestResponseCacheSkipped(t *testing.T) {
+	tests := map[string]struct {
+		github *fakeGitHub
+		method string
+	}{
+		"no etag": {
+			github: &fakeGitHub{body: `{}`},
+			method: http.MethodGet,
+		},
+		"large body": {
+			github: &fakeGitHub{body: `"` + strings.Repeat("a", maxCachedResponseSize) + `"`, etag: `"abc"`},
+			method: http.MethodGet,
+		},
+		"not a read": {
+			github: &fakeGitHub{body: `{}`, etag: `"abc"`},
+			method: http.MethodPost,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := state.NewMemoryStore()
+			rt := responseCacheMiddleware(store, time.Hour, metrics.NewRegistry())(test.github)
+
+			req, err := http.NewRequest(test.method, "https://api.github.com/repos/o/r/pulls/1", nil)
+			require.Nil(t, err)
+			res, err := rt.RoundTrip(req)
+			require.Nil(t, err)
+
+			b, err := ioutil.ReadAll(res.Body)
+			require.Nil(t, err)
+			assert.Equal(t, test.github.body, string(b), "the whole body is returned")
+
+			keys, err := store.Keys(req.Context(), responseCachePrefix)
+			require.Nil(t, err)
+			assert.Empty(t, keys)
+		})
+	}
+}
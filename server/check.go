@@ -0,0 +1,55 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/server/handler"
+	"github.com/palantir/bulldozer/state"
+	"github.com/palantir/bulldozer/version"
+)
+
+// CheckPullRequest evaluates a pull request with the GitHub App and options
+// of the configuration, like the status API of a running server. Requests
+// that would change anything on GitHub are blocked, and nothing is read from
+// or written to the configured state store.
+func CheckPullRequest(ctx context.Context, c *Config, owner, repo string, number int) (*handler.PullRequestState, error) {
+	c.Options.fillDefaults()
+
+	clientCreator, err := githubapp.NewDefaultCachingClientCreator(
+		c.Github,
+		githubapp.WithClientUserAgent(fmt.Sprintf("%s/%s", c.Options.AppName, version.GetVersion())),
+		githubapp.WithClientMiddleware(dryRunMiddleware()),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Github client creator")
+	}
+
+	base := handler.Base{
+		ClientCreator:    clientCreator,
+		ConfigFetcher:    bulldozer.NewConfigFetcher(c.Options.ConfigurationPath, c.Options.ConfigurationV0Paths),
+		StateStore:       state.NewMemoryStore(),
+		Registry:         metrics.NewRegistry(),
+		GraphQLSnapshots: c.Options.GraphQLSnapshots,
+	}
+	return base.CheckPullRequest(ctx, owner, repo, number)
+}
@@ -15,35 +15,340 @@
 package server
 
 import (
+	"time"
+
 	"github.com/palantir/go-baseapp/baseapp"
 	"github.com/palantir/go-baseapp/baseapp/datadog"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
+
+	"github.com/palantir/bulldozer/alert"
+	"github.com/palantir/bulldozer/archive"
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/aws"
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/ingest"
+	"github.com/palantir/bulldozer/jira"
+	"github.com/palantir/bulldozer/notify"
+	"github.com/palantir/bulldozer/outcome"
+	"github.com/palantir/bulldozer/report"
+	"github.com/palantir/bulldozer/scm"
+	"github.com/palantir/bulldozer/server/handler"
+	"github.com/palantir/bulldozer/state"
+	"github.com/palantir/bulldozer/tracing"
 )
 
 const (
 	DefaultAppName             = "bulldozer"
 	DefaultConfigurationV1Path = ".bulldozer.v1.yml"
+	DefaultShutdownTimeout     = 30 * time.Second
 )
 
 type Config struct {
-	Server  baseapp.HTTPConfig `yaml:"server"`
-	Github  githubapp.Config   `yaml:"github"`
-	Options Options            `yaml:"options"`
-	Logging LoggingConfig      `yaml:"logging"`
-	Datadog datadog.Config     `yaml:"datadog"`
+	Server  baseapp.HTTPConfig  `yaml:"server"`
+	Github  githubapp.Config    `yaml:"github"`
+	Apps    []AppConfig         `yaml:"apps"`
+	Options Options             `yaml:"options"`
+	Logging LoggingConfig       `yaml:"logging"`
+	Datadog datadog.Config      `yaml:"datadog"`
+	Statsd  StatsdConfig        `yaml:"statsd"`
+	Audit   AuditConfig         `yaml:"audit"`
+	Admin   AdminConfig         `yaml:"admin"`
+	State   StateConfig         `yaml:"state"`
+	Tracing tracing.Config      `yaml:"tracing"`
+	Sentry  report.SentryConfig `yaml:"sentry"`
+	Archive archive.Config      `yaml:"archive"`
+	Ingest  ingest.Config       `yaml:"ingest"`
+
+	// Outcomes receives a JSON line for every evaluation of a pull request,
+	// separately from the logs of the server
+	Outcomes outcome.Config `yaml:"outcomes"`
+
+	// Notifications configures the services that receive notifications
+	// about merges and failures. Repositories choose where their
+	// notifications go.
+	Notifications notify.Config `yaml:"notifications"`
+
+	// Jira configures the Jira server that repositories transition issues
+	// on after merging
+	Jira jira.Config `yaml:"jira"`
+
+	// Alerts configures the on-call services that are alerted about
+	// systemic problems, like repeated merge failures in a repository
+	Alerts alert.Config `yaml:"alerts"`
+
+	// GitLab configures a GitLab server whose merge requests are merged
+	// with the same repository configuration as pull requests on GitHub
+	GitLab scm.GitLabConfig `yaml:"gitlab"`
+
+	// Gitea configures a Gitea or Forgejo server whose pull requests are
+	// merged with the same repository configuration
+	Gitea scm.GiteaConfig `yaml:"gitea"`
+}
+
+// StateConfig configures where bulldozer keeps data between events. If no
+// backend is configured, data is kept in memory and lost on restart.
+type StateConfig struct {
+	Redis state.RedisConfig `yaml:"redis"`
+}
+
+// AdminConfig configures the pages and endpoints for operators of the server.
+// They are disabled unless a password is set.
+type AdminConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// Debug exposes the pprof and expvar handlers and a dump of the queues,
+	// protected by the admin credentials
+	Debug bool `yaml:"debug"`
+}
+
+func (c AdminConfig) Enabled() bool {
+	return c.Password != ""
 }
 
 type LoggingConfig struct {
-	Level string `yaml:"level"`
-	Text  bool   `yaml:"text"`
+	Level  string          `yaml:"level"`
+	Text   bool            `yaml:"text"`
+	Access AccessLogConfig `yaml:"access"`
+}
+
+// AuditConfig configures the sinks that receive audit events. Events are
+// recorded to every configured sink.
+type AuditConfig struct {
+	Stdout bool `yaml:"stdout"`
+
+	// File is rotated when it reaches FileMaxSizeMB megabytes, if positive,
+	// keeping FileMaxBackups previous files
+	File           string `yaml:"file"`
+	FileMaxSizeMB  int    `yaml:"file_max_size_mb"`
+	FileMaxBackups int    `yaml:"file_max_backups"`
+
+	HTTP AuditHTTPConfig `yaml:"http"`
+	S3   aws.S3Config    `yaml:"s3"`
+
+	Kafka audit.KafkaConfig `yaml:"kafka"`
+}
+
+type AuditHTTPConfig struct {
+	URL         string            `yaml:"url"`
+	Headers     map[string]string `yaml:"headers"`
+	CloudEvents bool              `yaml:"cloudevents"`
 }
 
 type Options struct {
-	AppName              string   `yaml:"app_name"`
-	ConfigurationPath    string   `yaml:"configuration_path"`
-	ConfigurationV0Paths []string `yaml:"configuration_v0_paths"`
+	AppName              string        `yaml:"app_name"`
+	ConfigurationPath    string        `yaml:"configuration_path"`
+	ConfigurationV0Paths []string      `yaml:"configuration_v0_paths"`
+	Signing              SigningConfig `yaml:"signing"`
+	Updates              UpdateOptions `yaml:"updates"`
+
+	// If true, pull requests are evaluated as usual but no requests that
+	// change anything are sent to GitHub
+	DryRun bool `yaml:"dry_run"`
+
+	// PreviousWebhookSecrets are also accepted when verifying webhooks, so
+	// that the webhook secret of the app can be rotated without rejecting
+	// deliveries signed with the old secret
+	PreviousWebhookSecrets []string `yaml:"previous_webhook_secrets"`
+
+	// How long webhook deliveries that fail processing are kept for replay.
+	// If zero, handler.DefaultDeadLetterTTL is used.
+	DeadLetterTTL time.Duration `yaml:"dead_letter_ttl"`
+
+	// How long the IDs of webhook deliveries are remembered to skip
+	// duplicates. If zero, handler.DefaultDeliveryDedupTTL is used; if
+	// negative, duplicates are not detected.
+	DeliveryDedupTTL time.Duration `yaml:"delivery_dedup_ttl"`
+
+	WorkQueue WorkQueueOptions `yaml:"work_queue"`
+
+	// How long to wait for running merges and updates to finish when the
+	// server is asked to stop
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// The fraction of each installation's GitHub rate limit kept for merges.
+	// Updates and sweeps are deferred until the limit resets when fewer
+	// requests remain. If zero, handler.DefaultRateLimitReserve is used.
+	RateLimitReserve float64 `yaml:"rate_limit_reserve"`
+
+	// If true, the data used to evaluate a pull request is loaded with a
+	// single GraphQL query instead of several REST requests
+	GraphQLSnapshots bool `yaml:"graphql_snapshots"`
+
+	ResponseCache ResponseCacheOptions `yaml:"response_cache"`
+
+	CatchUp CatchUpOptions `yaml:"catch_up"`
+
+	Concurrency ConcurrencyOptions `yaml:"concurrency"`
+
+	Maintenance MaintenanceOptions `yaml:"maintenance"`
+
+	KillSwitch KillSwitchOptions `yaml:"kill_switch"`
+
+	CircuitBreaker CircuitBreakerOptions `yaml:"circuit_breaker"`
+
+	CreateLabels CreateLabelsOptions `yaml:"create_labels"`
+}
+
+// CreateLabelsOptions configures the creation of labels that repository
+// configurations rely on but that do not exist.
+type CreateLabelsOptions struct {
+	Enabled bool `yaml:"enabled"`
+
+	// The color, as a hex code, and description of created labels. If
+	// empty, bulldozer.DefaultLabelColor and DefaultLabelDescription are
+	// used.
+	Color       string `yaml:"color"`
+	Description string `yaml:"description"`
+
+	// Styles for specific labels, by name
+	Labels map[string]bulldozer.LabelStyle `yaml:"labels"`
+}
+
+// CircuitBreakerOptions configures when requests to GitHub for an owner are
+// stopped because too many of them fail. Zero values use the defaults in the
+// handler package.
+type CircuitBreakerOptions struct {
+	Enabled bool `yaml:"enabled"`
+
+	// The circuit opens when at least MinRequests requests were sent in a
+	// Window and at least FailureRatio of them failed with a server error or
+	// a timeout
+	Window       time.Duration `yaml:"window"`
+	MinRequests  int           `yaml:"min_requests"`
+	FailureRatio float64       `yaml:"failure_ratio"`
+
+	// How long requests are stopped before GitHub is probed again
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// KillSwitchOptions configures the file that stops all merges in an
+// organization while it exists in the ".github" repository of the
+// organization.
+type KillSwitchOptions struct {
+	Enabled bool `yaml:"enabled"`
+
+	// The path of the file. If empty, bulldozer.DefaultKillSwitchPath is used.
+	Path string `yaml:"path"`
+
+	// How long the state of an organization is cached. If zero,
+	// bulldozer.DefaultKillSwitchTTL is used.
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+
+	// If true, merges stop in organizations whose ".github" repository is
+	// missing or not readable by the app, instead of logging a warning.
+	RequireRepository bool `yaml:"require_repository"`
+}
+
+// MaintenanceOptions configures maintenance mode, in which webhook deliveries
+// are buffered in the state store instead of being processed, and processed
+// when maintenance ends.
+type MaintenanceOptions struct {
+	// If true, the server starts in maintenance mode, as do the servers that
+	// share its state store
+	Enabled bool `yaml:"enabled"`
+}
+
+// ConcurrencyOptions configures how many webhooks and merges are processed at
+// the same time and how much work may wait. Updates are limited by
+// UpdateOptions.
+type ConcurrencyOptions struct {
+	Webhooks WebhookConcurrencyOptions `yaml:"webhooks"`
+	Merges   MergeConcurrencyOptions   `yaml:"merges"`
+}
+
+// WebhookConcurrencyOptions configures the workers that process webhooks. If
+// Workers is zero, each webhook is processed in the request that delivered
+// it. With the work queue enabled, WorkQueueOptions.Workers is used instead.
+type WebhookConcurrencyOptions struct {
+	Workers   int `yaml:"workers"`
+	QueueSize int `yaml:"queue_size"`
+
+	// What happens when the queue is full: "block" (the default) holds the
+	// webhook request until there is room, "drop" rejects the delivery
+	Overflow handler.OverflowPolicy `yaml:"overflow"`
+}
+
+// MergeConcurrencyOptions limits the merges that run at the same time. Zero
+// values are unlimited.
+type MergeConcurrencyOptions struct {
+	Workers    int `yaml:"workers"`
+	MaxPerRepo int `yaml:"max_per_repo"`
+
+	// The number of merges that may wait for a free worker before Overflow
+	// applies: "block" (the default) keeps waiting, "drop" skips the merge
+	// until the next event for the pull request
+	QueueSize int                    `yaml:"queue_size"`
+	Overflow  handler.OverflowPolicy `yaml:"overflow"`
+}
+
+// CatchUpOptions configures the scan of open pull requests in all installed
+// repositories, which merges pull requests whose events were missed while the
+// server was down. If enabled, the scan runs when the server starts.
+type CatchUpOptions struct {
+	Enabled bool `yaml:"enabled"`
+
+	// If positive, the scan is repeated at this interval
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ResponseCacheOptions configures the cache of GitHub responses. If enabled,
+// responses are kept in the state store and requested again with their ETag,
+// so unchanged resources do not count against the rate limit.
+type ResponseCacheOptions struct {
+	Enabled bool `yaml:"enabled"`
+
+	// How long responses are kept. If zero, DefaultResponseCacheTTL is used.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// WorkQueueOptions configures the queue of webhook deliveries. If enabled,
+// deliveries are stored in the state store and processed in the background
+// by a fixed number of workers.
+type WorkQueueOptions struct {
+	Enabled bool `yaml:"enabled"`
+	Workers int  `yaml:"workers"`
+}
+
+// UpdateOptions configures how updates of pull requests are scheduled when
+// their base branches change.
+type UpdateOptions struct {
+	// The time to wait after the last push to a base branch before updating
+	// a pull request, so that bursts of pushes cause a single update
+	Delay time.Duration `yaml:"delay"`
+
+	// The maximum time to wait after the first push of a burst, so that
+	// pull requests are updated even if pushes do not stop for Delay
+	MaxDelay time.Duration `yaml:"max_delay"`
+
+	// The maximum number of updates that run at the same time across all
+	// repositories
+	MaxConcurrent int `yaml:"max_concurrent"`
+
+	// The maximum number of updates that run at the same time in each
+	// repository
+	MaxConcurrentPerRepo int `yaml:"max_concurrent_per_repo"`
+
+	// If positive, the open pull requests in SweepRepositories are checked
+	// for updates at this interval, in addition to when pushes happen
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+
+	// The "owner/name" repositories to check periodically
+	SweepRepositories []string `yaml:"sweep_repositories"`
+}
+
+// SigningConfig configures the GPG key used to sign commits. Signing is
+// disabled if KeyID is empty.
+type SigningConfig struct {
+	KeyID      string `yaml:"key_id"`
+	GPGProgram string `yaml:"gpg_program"`
+	Name       string `yaml:"name"`
+	Email      string `yaml:"email"`
+
+	// Timeout limits how long the GPG program may take to sign a commit
+	Timeout time.Duration `yaml:"timeout"`
 }
 
 func (o *Options) fillDefaults() {
@@ -54,6 +359,10 @@ func (o *Options) fillDefaults() {
 	if o.ConfigurationPath == "" {
 		o.ConfigurationPath = DefaultConfigurationV1Path
 	}
+
+	if o.ShutdownTimeout <= 0 {
+		o.ShutdownTimeout = DefaultShutdownTimeout
+	}
 }
 
 func ParseConfig(bytes []byte) (*Config, error) {
@@ -0,0 +1,93 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"goji.io"
+	"goji.io/pat"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/server/handler"
+)
+
+// queueDump is the state of the queues of the server served by the debug
+// endpoints.
+type queueDump struct {
+	Goroutines  int                        `json:"goroutines"`
+	WebhookPool *int                       `json:"webhook_pool_depth,omitempty"`
+	Merges      *handler.MergeLimiterStats `json:"merges,omitempty"`
+	Apps        map[string]appQueueDump    `json:"apps"`
+}
+
+type appQueueDump struct {
+	MergeQueues map[string][]bulldozer.QueueEntry `json:"merge_queues"`
+	Updates     *handler.UpdateSchedulerStats     `json:"updates,omitempty"`
+}
+
+// registerDebugRoutes adds the pprof and expvar handlers and a dump of the
+// queues under /admin/debug. auth wraps every handler.
+func registerDebugRoutes(mux *goji.Mux, auth func(http.Handler) http.Handler, apps []*githubApp, webhooks *handler.WebhookPool, merges *handler.MergeLimiter) {
+	mux.Handle(pat.Get("/debug/pprof/cmdline"), auth(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle(pat.Get("/debug/pprof/profile"), auth(http.HandlerFunc(pprof.Profile)))
+	mux.Handle(pat.Get("/debug/pprof/symbol"), auth(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle(pat.Post("/debug/pprof/symbol"), auth(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle(pat.Get("/debug/pprof/trace"), auth(http.HandlerFunc(pprof.Trace)))
+	mux.Handle(pat.Get("/debug/pprof/*"), auth(http.HandlerFunc(pprof.Index)))
+	mux.Handle(pat.Get("/debug/vars"), auth(expvar.Handler()))
+
+	mux.Handle(pat.Get("/admin/debug/queues"), auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dump := queueDump{
+			Goroutines: runtime.NumGoroutine(),
+			Apps:       make(map[string]appQueueDump, len(apps)),
+		}
+		if webhooks != nil {
+			depth := webhooks.Depth()
+			dump.WebhookPool = &depth
+		}
+		if merges != nil {
+			stats := merges.Stats()
+			dump.Merges = &stats
+		}
+
+		for _, app := range apps {
+			appDump := appQueueDump{
+				MergeQueues: make(map[string][]bulldozer.QueueEntry),
+			}
+			if app.base.UpdateScheduler != nil {
+				updates := app.base.UpdateScheduler.Stats()
+				appDump.Updates = &updates
+			}
+			if app.base.MergeQueue != nil {
+				for _, key := range app.base.MergeQueue.Keys() {
+					appDump.MergeQueues[key] = app.base.MergeQueue.Entries(key)
+				}
+			}
+
+			name := app.name
+			if name == "" {
+				name = "default"
+			}
+			dump.Apps[name] = appDump
+		}
+
+		baseapp.WriteJSON(w, http.StatusOK, dump)
+	})))
+}
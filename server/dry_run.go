@@ -0,0 +1,69 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+)
+
+// dryRunMiddleware prevents GitHub clients from sending requests that change
+// anything. Reads and GraphQL queries are sent; other requests fail with an
+// error after being logged, so callers stop before taking further actions.
+func dryRunMiddleware() githubapp.ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			if isReadOnlyRequest(r) {
+				return next.RoundTrip(r)
+			}
+
+			zerolog.Ctx(r.Context()).Info().
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Msg("Dry run enabled, not sending request that changes GitHub")
+			return nil, dryRunError{method: r.Method, path: r.URL.Path}
+		})
+	}
+}
+
+// dryRunError is returned instead of sending a request in dry run mode.
+type dryRunError struct {
+	method string
+	path   string
+}
+
+func (err dryRunError) Error() string {
+	return fmt.Sprintf("dry run: %s %s was not sent", err.method, err.path)
+}
+
+func isReadOnlyRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return strings.HasSuffix(r.URL.Path, "/graphql")
+	}
+	return false
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
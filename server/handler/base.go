@@ -16,24 +16,136 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"time"
 
 	"github.com/google/go-github/github"
+	"github.com/palantir/go-baseapp/baseapp"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
 	"github.com/rs/zerolog"
 
+	"github.com/palantir/bulldozer/audit"
 	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/jira"
+	"github.com/palantir/bulldozer/notify"
+	"github.com/palantir/bulldozer/outcome"
 	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/report"
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	// lockTTL limits how long a lock is held if the server holding it stops
+	lockTTL = 10 * time.Minute
+
+	// lockWait is how long to wait for a lock held by another event or
+	// server before giving up
+	lockWait = 2 * time.Minute
+
+	// lockRetryDelay is how long to wait before evaluating a pull request
+	// again if it was being processed when an event arrived
+	lockRetryDelay = 15 * time.Second
 )
 
 type Base struct {
 	githubapp.ClientCreator
 	bulldozer.ConfigFetcher
+
+	// CommitSigner signs merge commits, if configured
+	CommitSigner bulldozer.CommitSigner
+
+	// Scheduler runs delayed and recurring work, such as re-evaluating
+	// pull requests that are waiting for a delay to elapse. If nil, pull
+	// requests are only evaluated on events.
+	Scheduler *Scheduler
+
+	// AuditSink records audit events, if configured
+	AuditSink audit.Sink
+
+	// Registry receives metrics about updates. If nil, the default registry
+	// is used.
+	Registry metrics.Registry
+
+	// StateStore keeps data between events. If nil, a shared in-memory store
+	// is used.
+	StateStore state.Store
+
+	// UpdateScheduler coalesces and throttles updates of pull requests. If
+	// nil, every update runs immediately.
+	UpdateScheduler *UpdateScheduler
+
+	// MergeQueue serializes merges for repositories that enable queueing. If
+	// nil, pull requests are merged as soon as they are eligible.
+	MergeQueue *bulldozer.MergeQueue
+
+	// Operations tracks background merges and updates, so that shutdown
+	// can wait for them. If nil, they are not tracked.
+	Operations *Operations
+
+	// RateLimits defers sweeps of owners that are close to their GitHub
+	// rate limit. If nil, sweeps always run.
+	RateLimits *RateLimits
+
+	// GraphQLSnapshots loads the data used to evaluate pull requests with a
+	// single GraphQL query instead of several REST requests
+	GraphQLSnapshots bool
+
+	// ErrorReporter receives errors and panics that stop pull requests from
+	// being processed, if configured
+	ErrorReporter report.ErrorReporter
+
+	// MergeLimiter, if set, limits the number of merges that run at the
+	// same time
+	MergeLimiter *MergeLimiter
+
+	// KillSwitch, if set, stops merges in organizations that engage it
+	KillSwitch *bulldozer.KillSwitch
+
+	// Outcomes, if set, receives a record of every evaluation of a pull
+	// request
+	Outcomes *outcome.Log
+
+	// LabelCreator, if set, creates the labels that a repository
+	// configuration relies on if they do not exist
+	LabelCreator *bulldozer.LabelCreator
+
+	// Notifications, if set, sends notifications about merges, failures,
+	// and conflicts, routed by the configuration of each repository
+	Notifications *notify.Dispatcher
+
+	// Jira, if set, is used by repositories that transition Jira issues
+	// after merging
+	Jira *jira.Client
+
+	// Identity finds the login of the app, so that only comments written by
+	// bulldozer are trusted to record holds and other state. If nil or if
+	// the login cannot be found, pull requests are not evaluated.
+	Identity *AppIdentity
 }
 
-func (b *Base) ProcessPullRequest(ctx context.Context, pullCtx pull.Context, client *github.Client, pr *github.PullRequest) error {
+func (b *Base) ProcessPullRequest(ctx context.Context, pullCtx pull.Context, client *github.Client, pr *github.PullRequest) (err error) {
+	ctx = withCorrelationID(b.withServices(ctx), pullCtx)
 	logger := zerolog.Ctx(ctx)
 
+	var configHash string
+	var tracker *outcome.Tracker
+	if b.Outcomes != nil {
+		ctx, tracker = outcome.Start(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+		defer b.recordOutcome(ctx, tracker, &configHash, &err)
+	}
+	defer b.reportFailure(ctx, pullCtx, &configHash, &err)
+
+	if paused, err := b.repositoryPaused(ctx, pullCtx); err != nil || paused {
+		if paused {
+			tracker.SetResult(outcome.ResultPaused)
+		}
+		return err
+	}
+
 	bulldozerConfig, err := b.ConfigForPR(ctx, client, pr)
 	if err != nil {
 		return errors.Wrap(err, "failed to fetch configuration")
@@ -42,19 +154,141 @@ func (b *Base) ProcessPullRequest(ctx context.Context, pullCtx pull.Context, cli
 	switch {
 	case bulldozerConfig.Missing():
 		logger.Debug().Msgf("No bulldozer configuration for %q", bulldozerConfig.String())
+		tracker.SetResult(outcome.ResultMissingConfig)
 	case bulldozerConfig.Invalid():
 		logger.Debug().Msgf("Bulldozer configuration is invalid for %q", bulldozerConfig.String())
+		tracker.SetResult(outcome.ResultInvalidConfig)
+		b.recordInvalidConfig(ctx, pullCtx, bulldozerConfig)
 	default:
 		logger.Debug().Msgf("Bulldozer configuration is valid for %q", bulldozerConfig.String())
 		config := *bulldozerConfig.Config
-		shouldMerge, err := bulldozer.ShouldMergePR(ctx, pullCtx, config.Merge)
+		configHash = bulldozer.ConfigHash(config.Merge)
+		ctx = b.withNotifications(ctx, config.Notifications)
+
+		if _, err := b.LabelCreator.CreateMissing(ctx, client, pullCtx.Owner(), pullCtx.Repo(), &config); err != nil {
+			logger.Warn().Err(err).Msg("Failed to create missing labels")
+		}
+
+		// webhooks for a pull request that is being processed are not held
+		// up waiting for the lock; the pull request is evaluated again after
+		// the current evaluation, which may not have seen this event
+		var unlock func()
+		if b.Scheduler != nil {
+			var locked bool
+			if unlock, locked, err = state.TryLock(ctx, state.Ctx(ctx), pullRequestLock(pullCtx), lockTTL); err != nil {
+				return err
+			}
+			if !locked {
+				logger.Debug().Msg("Pull request is being processed, evaluating it again later")
+				b.scheduleEvaluation(ctx, pullCtx, client, lockRetryDelay)
+				return nil
+			}
+		} else if unlock, err = b.lock(ctx, pullRequestLock(pullCtx)); err != nil {
+			return err
+		}
+		// a merge started below takes over the lock and releases it when
+		// it finishes
+		defer func() { unlock() }()
+
+		if _, err := bulldozer.ReadyDraftPR(ctx, pullCtx, client, config.Merge); err != nil {
+			return errors.Wrap(err, "failed to mark draft pull request as ready for review")
+		}
+
+		if err := requireBotLogin(ctx); err != nil {
+			return err
+		}
+
+		// every reason is only needed when it is published in the assessment
+		evaluate := bulldozer.EvaluatePR
+		if config.Merge.Assessment != "" {
+			evaluate = bulldozer.AssessPR
+		}
+
+		start := time.Now()
+		decision, err := evaluate(ctx, pullCtx, config.Merge)
 		if err != nil {
 			return errors.Wrap(err, "unable to determine merge status")
 		}
+		bulldozer.RecordDecision(ctx, pullCtx, audit.TypeMergeDecision, decision, config.Merge)
+		tracker.Evaluated(decision.Eligible, decision.Signals, decision.Reasons, time.Since(start))
+
+		assessment := bulldozer.Assessment{State: bulldozer.AssessmentEligible}
+		if !decision.Eligible {
+			assessment = bulldozer.Assessment{State: bulldozer.AssessmentWaiting, Reasons: decision.Reasons, Approval: decision.Approval}
+		}
+		if config.Merge.Assessment != "" {
+			defer b.publishAssessment(ctx, client, pullCtx, pr, config.Merge.Assessment, &assessment)
+		}
+
+		shouldMerge := decision.Eligible
+		queued := config.Merge.Queue && b.MergeQueue != nil
 		if shouldMerge {
 			logger.Debug().Msg("Pull request should be merged")
-			if err := bulldozer.MergePR(ctx, pullCtx, client, config.Merge); err != nil {
-				return errors.Wrap(err, "failed to merge pull request")
+			if queued {
+				removal, err := bulldozer.QueueRemoved(ctx, pullCtx.Owner(), pullCtx.Repo(), pr.GetNumber(), pr.GetHead().GetSHA())
+				if err != nil {
+					return err
+				}
+				if removal != nil {
+					logger.Info().Msgf("Pull request was removed from the merge queue by %s, skipping merge until its head changes", removal.User)
+					tracker.SetResult(outcome.ResultPaused)
+					assessment = bulldozer.Assessment{State: bulldozer.AssessmentPaused, Detail: fmt.Sprintf("it was removed from the merge queue by %s", removal.User)}
+					return nil
+				}
+				if position := b.enqueue(ctx, client, pr); position > 0 {
+					logger.Debug().Msgf("Pull request is at position %d in the merge queue", position+1)
+					tracker.SetResult(outcome.ResultQueued)
+					assessment = bulldozer.Assessment{State: bulldozer.AssessmentQueued, Position: position}
+					return nil
+				}
+			}
+			release, err := b.MergeLimiter.Acquire(ctx, pullCtx.Owner()+"/"+pullCtx.Repo())
+			if err != nil {
+				if errors.Cause(err) == ErrQueueFull {
+					logger.Warn().Msg("Too many merges are waiting, skipping merge until the next event")
+					tracker.SetResult(outcome.ResultDropped)
+					assessment.Detail = "too many merges are waiting, so it will be retried on the next event"
+					return nil
+				}
+				return err
+			}
+			defer func() { release() }()
+
+			unlockBase, err := b.lock(ctx, baseBranchLock(pullCtx, pr))
+			if err != nil {
+				return err
+			}
+			if halted, err := b.mergeHalted(ctx, client, pullCtx); err != nil || halted {
+				unlockBase()
+				if halted {
+					tracker.SetResult(outcome.ResultHalted)
+					assessment = bulldozer.Assessment{State: bulldozer.AssessmentPaused, Detail: "merges were halted by the kill switch or a pause"}
+				}
+				return err
+			}
+			start := time.Now()
+			if !b.startMerge(ctx, pullCtx, client, config.Merge, config.Notifications, unlockBase, unlock, release) {
+				unlockBase()
+				logger.Info().Msg("Server is shutting down, skipping merge until the next event")
+				tracker.SetResult(outcome.ResultDropped)
+				assessment.Detail = "the server is shutting down, so it will be retried on the next event"
+				return nil
+			}
+			// the merge releases the locks and its slot when it finishes
+			unlock, release = func() {}, func() {}
+			tracker.Merged(time.Since(start))
+			assessment = bulldozer.Assessment{State: bulldozer.AssessmentMerging}
+		} else if queued {
+			b.dequeue(ctx, client, pr, "neutral", "This pull request is no longer eligible to merge.")
+		}
+
+		if !shouldMerge && config.Merge.RequiredDelayAfterPush > 0 {
+			delay, err := bulldozer.RemainingPushDelay(ctx, pullCtx, config.Merge)
+			if err != nil {
+				return errors.Wrap(err, "unable to determine remaining delay after push")
+			}
+			if delay > 0 {
+				b.scheduleEvaluation(ctx, pullCtx, client, delay)
 			}
 		}
 	}
@@ -62,9 +296,318 @@ func (b *Base) ProcessPullRequest(ctx context.Context, pullCtx pull.Context, cli
 	return nil
 }
 
-func (b *Base) UpdatePullRequest(ctx context.Context, pullCtx pull.Context, client *github.Client, pr *github.PullRequest, baseRef string) error {
+// publishAssessment updates the bulldozer check run or status of the pull
+// request, logging any errors.
+func (b *Base) publishAssessment(ctx context.Context, client *github.Client, pullCtx pull.Context, pr *github.PullRequest, output bulldozer.AssessmentOutput, assessment *bulldozer.Assessment) {
+	if err := bulldozer.PublishAssessment(ctx, client, pullCtx.Owner(), pullCtx.Repo(), pr, output, *assessment); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to publish assessment")
+	}
+}
+
+// lock acquires the named lock in the state store, waiting up to lockWait
+// for other events or servers to release it.
+func (b *Base) lock(ctx context.Context, name string) (func(), error) {
+	waitCtx, cancel := context.WithTimeout(ctx, lockWait)
+	defer cancel()
+	return state.WaitLock(waitCtx, state.Ctx(ctx), name, lockTTL)
+}
+
+// pullRequestLock is the name of the lock held while merging or updating a
+// pull request.
+func pullRequestLock(pullCtx pull.Context) string {
+	return "pr/" + pullCtx.Locator()
+}
+
+// baseBranchLock is the name of the lock held while merging into the base
+// branch of a pull request.
+func baseBranchLock(pullCtx pull.Context, pr *github.PullRequest) string {
+	return "base/" + bulldozer.QueueKey(pullCtx.Owner(), pullCtx.Repo(), pr.GetBase().GetRef())
+}
+
+// withServices returns a context with the audit sink, state store, metrics
+// registry, error reporter, and Jira client of the handler, if they are
+// configured.
+func (b *Base) withServices(ctx context.Context) context.Context {
+	if b.AuditSink != nil {
+		ctx = audit.WithSink(ctx, b.AuditSink)
+	}
+	if b.StateStore != nil {
+		ctx = state.WithStore(ctx, b.StateStore)
+	}
+	if b.Registry != nil {
+		ctx = baseapp.WithMetricsCtx(ctx, b.Registry)
+	}
+	if b.ErrorReporter != nil {
+		ctx = report.WithReporter(ctx, b.ErrorReporter)
+	}
+	if b.Jira != nil {
+		ctx = jira.WithClient(ctx, b.Jira)
+	}
+	if b.ClientCreator != nil {
+		ctx = bulldozer.WithInstallationClients(ctx, b.repositoryClient)
+	}
+	if b.Identity != nil {
+		login, err := b.Identity.Login(ctx)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to determine the login of the app")
+		} else {
+			ctx = bulldozer.WithBotLogin(ctx, login)
+		}
+	}
+	return ctx
+}
+
+// startMerge merges the pull request in the background, tracked by the
+// Operations of the handler. The release functions, like the unlock functions
+// of the locks held for the merge and the release of its MergeLimiter slot,
+// are called when the merge finishes. If the server is shutting down, the
+// merge is not started, the release functions are not called, and startMerge
+// returns false.
+func (b *Base) startMerge(ctx context.Context, pullCtx pull.Context, client *github.Client, mergeConfig bulldozer.MergeConfig, notifications bulldozer.NotificationConfig, release ...func()) bool {
+	mergeCtx := b.mergeContext(ctx, notifications)
+	return b.Operations.Go(func() {
+		defer func() {
+			for _, r := range release {
+				r()
+			}
+		}()
+		halted := func(ctx context.Context) (bool, error) {
+			return b.mergeHalted(ctx, client, pullCtx)
+		}
+		if err := bulldozer.MergePR(mergeCtx, pullCtx, client, b.CommitSigner, mergeConfig, halted); err != nil {
+			zerolog.Ctx(mergeCtx).Error().Err(errors.WithStack(err)).Msg("Failed to merge pull request")
+		}
+	})
+}
+
+// mergeContext returns a context for a merge that runs in the background
+// after the event that started it is handled. It has the logger, services,
+// and notifications of ctx, but not its cancellation.
+func (b *Base) mergeContext(ctx context.Context, config bulldozer.NotificationConfig) context.Context {
+	return b.withNotifications(b.withServices(zerolog.Ctx(ctx).WithContext(context.Background())), config)
+}
+
+// requireBotLogin returns an error if the context does not have the login of
+// the app. Evaluations without the login ignore holds, so the server does not
+// evaluate pull requests until the login is known.
+func requireBotLogin(ctx context.Context) error {
+	_, err := bulldozer.BotLogin(ctx)
+	return errors.Wrap(err, "cannot evaluate pull request")
+}
+
+// withNotifications returns a context whose audit sink also sends the
+// notifications of the repository configuration, if notifications are
+// configured. It must be called after withServices.
+func (b *Base) withNotifications(ctx context.Context, config bulldozer.NotificationConfig) context.Context {
+	if b.Notifications == nil {
+		return ctx
+	}
+	return audit.WithSink(ctx, b.Notifications.Sink(audit.Ctx(ctx), config))
+}
+
+// invalidConfigTTL is how long an invalid configuration is not recorded
+// again after it was recorded, so that its owners are not notified on every
+// event.
+const invalidConfigTTL = 24 * time.Hour
+
+// recordInvalidConfig records an audit event for a configuration that exists
+// but is invalid, which notifies the repository, at most once a day for each
+// branch.
+func (b *Base) recordInvalidConfig(ctx context.Context, pullCtx pull.Context, fc bulldozer.FetchedConfig) {
+	if fc.Notifications == nil {
+		return
+	}
+
+	key := fmt.Sprintf("invalid-configs/%s/%s/%s", fc.Owner, fc.Repo, fc.Ref)
+	if n, err := state.Ctx(ctx).Increment(ctx, key, invalidConfigTTL); err != nil || n > 1 {
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(errors.WithStack(err)).Msg("Failed to record invalid configuration")
+		}
+		return
+	}
+
+	audit.Record(b.withNotifications(ctx, *fc.Notifications), audit.Event{
+		Type:   audit.TypeConfig,
+		Owner:  pullCtx.Owner(),
+		Repo:   pullCtx.Repo(),
+		Number: pullCtx.Number(),
+		Result: audit.ResultInvalid,
+		Detail: fc.Error.Error(),
+	})
+}
+
+// repositoryPaused returns true if an operator paused processing of pull
+// requests in the repository of the pull request or its owner.
+func (b *Base) repositoryPaused(ctx context.Context, pullCtx pull.Context) (bool, error) {
+	pause, err := bulldozer.RepositoryPaused(ctx, pullCtx.Owner(), pullCtx.Repo())
+	if err != nil {
+		return false, err
+	}
+	if pause != nil {
+		zerolog.Ctx(ctx).Info().Msgf("Skipping %s because processing of %s was paused by %s", pullCtx.Locator(), pause, pause.User)
+		return true, nil
+	}
+	return false, nil
+}
+
+// mergeHalted returns true if the kill switch of the owner is engaged or the
+// repository was paused after processing started. It is checked before a merge
+// starts and immediately before each merge attempt.
+func (b *Base) mergeHalted(ctx context.Context, client *github.Client, pullCtx pull.Context) (bool, error) {
+	engaged, reason, err := b.KillSwitch.Engaged(ctx, client, pullCtx.Owner())
+	if err != nil {
+		return false, err
+	}
+	if engaged {
+		zerolog.Ctx(ctx).Warn().Msgf("Not merging %s because the kill switch of %s is engaged: %s", pullCtx.Locator(), pullCtx.Owner(), reason)
+		return true, nil
+	}
+	return b.repositoryPaused(ctx, pullCtx)
+}
+
+// reportFailure reports the error returned by processing the pull request,
+// or a panic, which is recovered and returned as the error. It must be
+// deferred.
+func (b *Base) reportFailure(ctx context.Context, pullCtx pull.Context, configHash *string, err *error) {
+	details := report.Details{
+		Owner:      pullCtx.Owner(),
+		Repo:       pullCtx.Repo(),
+		Number:     pullCtx.Number(),
+		ConfigHash: *configHash,
+	}
+	details.DeliveryID, _ = ctx.Value(deliveryIDCtxKey{}).(string)
+
+	if r := recover(); r != nil {
+		details.Panic = true
+		details.Stack = string(debug.Stack())
+		*err = errors.Errorf("panic processing %s: %v", pullCtx.Locator(), r)
+	}
+	report.Report(ctx, *err, details)
+}
+
+// recordOutcome writes the record of an evaluation to the outcome log.
+func (b *Base) recordOutcome(ctx context.Context, tracker *outcome.Tracker, configHash *string, err *error) {
+	record := tracker.Finish(*err)
+	record.ConfigHash = *configHash
+	record.DeliveryID, _ = ctx.Value(deliveryIDCtxKey{}).(string)
+
+	if werr := b.Outcomes.Write(record); werr != nil {
+		zerolog.Ctx(ctx).Error().Err(werr).Msg("Failed to write evaluation outcome")
+	}
+}
+
+// TaskEvaluate is the kind of scheduled task that evaluates a pull request
+// again after a delay.
+const TaskEvaluate = "evaluate"
+
+// evaluationTask is the data of a TaskEvaluate or TaskUpdate task.
+type evaluationTask struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+}
+
+// scheduleEvaluation processes the pull request again after the delay, using
+// fresh pull request data. A pending evaluation of the pull request is
+// replaced.
+func (b *Base) scheduleEvaluation(ctx context.Context, pullCtx pull.Context, client *github.Client, delay time.Duration) {
+	if b.Scheduler == nil {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	logger.Debug().Msgf("Scheduling re-evaluation of %s in %s", pullCtx.Locator(), delay)
+
+	task := evaluationTask{Owner: pullCtx.Owner(), Repo: pullCtx.Repo(), Number: pullCtx.Number()}
+	if err := b.Scheduler.Schedule(ctx, TaskEvaluate, pullCtx.Locator(), time.Now().Add(delay), task); err != nil {
+		logger.Error().Err(err).Msg("Failed to schedule re-evaluation")
+	}
+}
+
+// RunEvaluationTask evaluates the pull request of a TaskEvaluate task, if it
+// is still open.
+func (b *Base) RunEvaluationTask(ctx context.Context, data json.RawMessage) error {
+	var task evaluationTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return errors.Wrap(err, "invalid evaluation task")
+	}
+
+	client, err := b.installationClient(ctx, task.Owner)
+	if err != nil {
+		return err
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, task.Owner, task.Repo, task.Number)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pull request %s/%s#%d for delayed evaluation", task.Owner, task.Repo, task.Number)
+	}
+	if pr.GetState() != "open" {
+		zerolog.Ctx(ctx).Debug().Msg("Pull request is no longer open, skipping delayed evaluation")
+		return nil
+	}
+
+	pullCtx := b.pullContext(ctx, client, pr, task.Owner, task.Repo, task.Number)
+	return b.ProcessPullRequest(ctx, pullCtx, client, pr)
+}
+
+// TaskUpdate is the kind of scheduled task that tries to update a pull
+// request again after an update was skipped.
+const TaskUpdate = "update"
+
+// scheduleUpdateRetry tries to update the pull request again after the
+// delay, using fresh pull request data. A pending retry of the pull request
+// is replaced.
+func (b *Base) scheduleUpdateRetry(ctx context.Context, pullCtx pull.Context, delay time.Duration) {
+	if b.Scheduler == nil {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx)
+	logger.Debug().Msgf("Scheduling update retry of %s in %s", pullCtx.Locator(), delay)
+
+	task := evaluationTask{Owner: pullCtx.Owner(), Repo: pullCtx.Repo(), Number: pullCtx.Number()}
+	if err := b.Scheduler.Schedule(ctx, TaskUpdate, pullCtx.Locator(), time.Now().Add(delay), task); err != nil {
+		logger.Error().Err(err).Msg("Failed to schedule update retry")
+	}
+}
+
+// RunUpdateTask updates the pull request of a TaskUpdate task, if it is
+// still open.
+func (b *Base) RunUpdateTask(ctx context.Context, data json.RawMessage) error {
+	var task evaluationTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return errors.Wrap(err, "invalid update task")
+	}
+
+	client, err := b.installationClient(ctx, task.Owner)
+	if err != nil {
+		return err
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, task.Owner, task.Repo, task.Number)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pull request %s/%s#%d for update retry", task.Owner, task.Repo, task.Number)
+	}
+	if pr.GetState() != "open" {
+		zerolog.Ctx(ctx).Debug().Msg("Pull request is no longer open, skipping update retry")
+		return nil
+	}
+
+	pullCtx := b.pullContext(ctx, client, pr, task.Owner, task.Repo, task.Number)
+	return b.UpdatePullRequest(ctx, pullCtx, client, pr, pr.GetBase().GetRef(), bulldozer.TriggerRetry)
+}
+
+func (b *Base) UpdatePullRequest(ctx context.Context, pullCtx pull.Context, client *github.Client, pr *github.PullRequest, baseRef string, trigger bulldozer.UpdateTrigger) (err error) {
+	ctx = withCorrelationID(b.withServices(ctx), pullCtx)
 	logger := zerolog.Ctx(ctx)
 
+	var configHash string
+	defer b.reportFailure(ctx, pullCtx, &configHash, &err)
+
+	if paused, err := b.repositoryPaused(ctx, pullCtx); err != nil || paused {
+		return err
+	}
+
 	bulldozerConfig, err := b.ConfigForPR(ctx, client, pr)
 	if err != nil {
 		return errors.Wrap(err, "failed to fetch configuration")
@@ -78,20 +621,135 @@ func (b *Base) UpdatePullRequest(ctx context.Context, pullCtx pull.Context, clie
 	default:
 		logger.Debug().Msgf("Bulldozer configuration is valid for %q", bulldozerConfig.String())
 		config := *bulldozerConfig.Config
+		configHash = bulldozer.ConfigHash(config.Update)
+		ctx = b.withNotifications(ctx, config.Notifications)
 
-		shouldUpdate, err := bulldozer.ShouldUpdatePR(ctx, pullCtx, config.Update)
-
+		decision, err := bulldozer.EvaluateUpdate(ctx, pullCtx, config.Update, config.Merge)
 		if err != nil {
 			return errors.Wrap(err, "unable to determine update status")
 		}
+		bulldozer.RecordDecision(ctx, pullCtx, audit.TypeUpdateDecision, decision, config.Update)
 
-		if shouldUpdate {
+		if decision.Eligible {
 			logger.Debug().Msg("Pull request should be updated")
-			if err := bulldozer.UpdatePR(ctx, pullCtx, client, config.Update, baseRef); err != nil {
-				return errors.Wrap(err, "failed to update pull request")
-			}
+			b.scheduleUpdate(ctx, pullCtx, client, config, baseRef, trigger)
 		}
 	}
 
 	return nil
 }
+
+// resumeUpdate updates the pull request if its update may have been deferred
+// while its checks were running.
+func (b *Base) resumeUpdate(ctx context.Context, pullCtx pull.Context, client *github.Client, pr *github.PullRequest) error {
+	bulldozerConfig, err := b.ConfigForPR(ctx, client, pr)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch configuration")
+	}
+	if bulldozerConfig.Missing() || bulldozerConfig.Invalid() || !bulldozerConfig.Config.Update.WaitForChecks {
+		return nil
+	}
+	return b.UpdatePullRequest(ctx, pullCtx, client, pr, pr.GetBase().GetRef(), bulldozer.TriggerChecksCompleted)
+}
+
+// scheduleUpdate updates the pull request in the background, using the update
+// scheduler if one is configured.
+func (b *Base) scheduleUpdate(ctx context.Context, pullCtx pull.Context, client *github.Client, config bulldozer.Config, baseRef string, trigger bulldozer.UpdateTrigger) {
+	logger := zerolog.Ctx(ctx)
+
+	update := func() {
+		ctx := b.withNotifications(b.withServices(logger.WithContext(context.Background())), config.Notifications)
+
+		ran := b.Operations.Run(func() {
+			unlock, err := b.lock(ctx, pullRequestLock(pullCtx))
+			if err != nil {
+				logger.Error().Err(err).Msg("Error updating pull request")
+				return
+			}
+			defer unlock()
+
+			retry, err := bulldozer.UpdatePR(ctx, pullCtx, client, config.Update, config.Merge, baseRef, trigger)
+			if err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msg("Error updating pull request")
+			}
+			if retry > 0 {
+				b.scheduleUpdateRetry(ctx, pullCtx, retry)
+			}
+		})
+		if !ran {
+			logger.Info().Msgf("Skipping update of %s because the server is shutting down", pullCtx.Locator())
+		}
+	}
+
+	if b.UpdateScheduler == nil {
+		go update()
+		return
+	}
+
+	logger.Debug().Msgf("Scheduling update of %s", pullCtx.Locator())
+	b.UpdateScheduler.Schedule(pullCtx.Owner(), pullCtx.Repo(), pullCtx.Locator(), update)
+}
+
+// sortForUpdate groups pull requests by base branch, in the order in which
+// the branches first appear, and orders each group using the update order in
+// the configuration of its branch.
+func (b *Base) sortForUpdate(ctx context.Context, client *github.Client, prs []*github.PullRequest) {
+	var bases []string
+	byBase := make(map[string][]*github.PullRequest)
+	for _, pr := range prs {
+		base := pr.GetBase().GetRef()
+		if _, ok := byBase[base]; !ok {
+			bases = append(bases, base)
+		}
+		byBase[base] = append(byBase[base], pr)
+	}
+
+	sorted := make([]*github.PullRequest, 0, len(prs))
+	for _, base := range bases {
+		b.sortBaseForUpdate(ctx, client, byBase[base])
+		sorted = append(sorted, byBase[base]...)
+	}
+	copy(prs, sorted)
+}
+
+// sortBaseForUpdate orders pull requests with the same base branch using the
+// update order in the configuration of that branch.
+func (b *Base) sortBaseForUpdate(ctx context.Context, client *github.Client, prs []*github.PullRequest) {
+	if len(prs) < 2 {
+		return
+	}
+
+	bulldozerConfig, err := b.ConfigForPR(ctx, client, prs[0])
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(errors.WithStack(err)).Msg("Failed to fetch configuration to order updates")
+		return
+	}
+	if bulldozerConfig.Missing() || bulldozerConfig.Invalid() {
+		return
+	}
+
+	positions := make(map[int]int)
+	if b.MergeQueue != nil {
+		base := prs[0].GetBase()
+		key := bulldozer.QueueKey(base.GetRepo().GetOwner().GetLogin(), base.GetRepo().GetName(), base.GetRef())
+		for i, entry := range b.MergeQueue.Entries(key) {
+			positions[entry.Number] = i
+		}
+	}
+
+	bulldozer.SortForUpdate(prs, positions, bulldozerConfig.Config.Update)
+}
+
+// pullContext returns the context used to evaluate a pull request. If
+// snapshots are enabled, the data of the pull request is loaded with a
+// single GraphQL query, falling back to the REST API if the query fails.
+func (b *Base) pullContext(ctx context.Context, client *github.Client, pr *github.PullRequest, owner, repo string, number int) pull.Context {
+	if b.GraphQLSnapshots {
+		pullCtx, err := pull.NewSnapshotContext(ctx, client, pr, owner, repo, number)
+		if err == nil {
+			return pullCtx
+		}
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to load pull request snapshot, falling back to REST API")
+	}
+	return pull.NewGithubContext(client, pr, owner, repo, number)
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/pull"
+)
+
+// branchProtectionRuleEvent is the payload of a branch_protection_rule event,
+// which the client does not support.
+type branchProtectionRuleEvent struct {
+	Action string `json:"action"`
+	Rule   struct {
+		// Name is the branch name pattern of the rule
+		Name string `json:"name"`
+	} `json:"rule"`
+	Changes struct {
+		Name struct {
+			// From is the previous pattern of a renamed rule
+			From string `json:"from"`
+		} `json:"name"`
+	} `json:"changes"`
+	Repo         *github.Repository   `json:"repository"`
+	Installation *github.Installation `json:"installation"`
+}
+
+func (e *branchProtectionRuleEvent) GetInstallation() *github.Installation {
+	return e.Installation
+}
+
+// BranchProtectionRule re-evaluates open pull requests when the protection of
+// their base branch changes, since new requirements may block pull requests
+// that were eligible and removed requirements may allow merges or updates.
+type BranchProtectionRule struct {
+	Base
+}
+
+func (h *BranchProtectionRule) Handles() []string {
+	return []string{"branch_protection_rule"}
+}
+
+func (h *BranchProtectionRule) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event branchProtectionRuleEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse branch protection rule event payload")
+	}
+
+	repo := event.Repo
+	owner := repo.GetOwner().GetLogin()
+	repoName := repo.GetName()
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	ctx, logger := githubapp.PrepareRepoContext(ctx, installationID, repo)
+
+	client, err := h.ClientCreator.NewInstallationClient(installationID)
+	if err != nil {
+		return errors.Wrap(err, "failed to instantiate github client")
+	}
+
+	prs, err := pull.ListOpenPullRequests(ctx, client, owner, repoName)
+	if err != nil {
+		return errors.Wrap(err, "failed to list open pull requests")
+	}
+
+	logger.Debug().Msgf("Received %s branch protection rule event for %q", event.Action, event.Rule.Name)
+
+	matching := affectedPullRequests(&event, prs)
+
+	if len(matching) == 0 {
+		logger.Debug().Msg("Doing nothing since branch protection rule affects no open pull requests")
+		return nil
+	}
+
+	h.sortForUpdate(ctx, client, matching)
+
+	for _, pr := range matching {
+		pullCtx := h.pullContext(ctx, client, pr, owner, repoName, pr.GetNumber())
+		logger := logger.With().Int(githubapp.LogKeyPRNum, pr.GetNumber()).Logger()
+
+		if err := h.ProcessPullRequest(logger.WithContext(ctx), pullCtx, client, pr); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Error processing pull request")
+		}
+		if err := h.UpdatePullRequest(logger.WithContext(ctx), pullCtx, client, pr, pr.GetBase().GetRef(), bulldozer.TriggerBranchProtection); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Error updating pull request")
+		}
+	}
+
+	return nil
+}
+
+// affectedPullRequests returns the pull requests whose base branch matches
+// the pattern of the rule. When a rule is renamed, the branches of its old
+// pattern lose their protection, so their pull requests are affected too.
+func affectedPullRequests(event *branchProtectionRuleEvent, prs []*github.PullRequest) []*github.PullRequest {
+	patterns := []string{event.Rule.Name}
+	if from := event.Changes.Name.From; from != "" && from != event.Rule.Name {
+		patterns = append(patterns, from)
+	}
+
+	var matching []*github.PullRequest
+	for _, pr := range prs {
+		for _, pattern := range patterns {
+			if bulldozer.MatchesBranchRule(pattern, pr.GetBase().GetRef()) {
+				matching = append(matching, pr)
+				break
+			}
+		}
+	}
+	return matching
+}
+
+// type assertion
+var _ githubapp.EventHandler = &BranchProtectionRule{}
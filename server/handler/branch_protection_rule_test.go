@@ -0,0 +1,54 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAffectedPullRequests(t *testing.T) {
+	newPR := func(number int, base string) *github.PullRequest {
+		return &github.PullRequest{
+			Number: github.Int(number),
+			Base:   &github.PullRequestBranch{Ref: github.String(base)},
+		}
+	}
+	prs := []*github.PullRequest{newPR(1, "main"), newPR(2, "release/1.0"), newPR(3, "develop")}
+
+	numbers := func(prs []*github.PullRequest) []int {
+		var n []int
+		for _, pr := range prs {
+			n = append(n, pr.GetNumber())
+		}
+		return n
+	}
+
+	var created branchProtectionRuleEvent
+	require.NoError(t, json.Unmarshal([]byte(`{"action": "created", "rule": {"name": "release/*"}}`), &created))
+	assert.Equal(t, []int{2}, numbers(affectedPullRequests(&created, prs)))
+
+	var renamed branchProtectionRuleEvent
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"action": "edited",
+		"rule": {"name": "release/*"},
+		"changes": {"name": {"from": "main"}}
+	}`), &renamed))
+	assert.Equal(t, []int{1, 2}, numbers(affectedPullRequests(&renamed, prs)), "branches of the old pattern are affected")
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/state"
+)
+
+// CatchUp evaluates the open pull requests in every repository the app is
+// installed in, so that pull requests that became eligible while the server
+// was down or while webhooks were lost are merged without a new event.
+type CatchUp struct {
+	Base
+
+	// If positive, the scan is repeated at this interval after the first
+	// scan on startup
+	Interval time.Duration
+}
+
+const (
+	// TaskCatchUp is the kind of scheduled task that runs the catch-up scan.
+	TaskCatchUp = "catch_up"
+
+	// TaskCatchUpEvaluate is the kind of scheduled task that evaluates a
+	// pull request found by the catch-up scan.
+	TaskCatchUpEvaluate = "catch_up_evaluate"
+
+	// catchUpLock is held while a server scans, and catchUpLockTTL limits
+	// how long it is held if the server stops
+	catchUpLock    = "catch-up"
+	catchUpLockTTL = time.Hour
+
+	// catchUpSpacing is the delay between the evaluations enqueued by a
+	// scan, so that a scan does not evaluate every pull request at once
+	catchUpSpacing = time.Second
+)
+
+// Start schedules a scan of the installations now and, if the interval is
+// positive, every interval. The scans run when the scheduler of the handler
+// is started.
+func (c *CatchUp) Start(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	c.Scheduler.Register(TaskCatchUp, func(ctx context.Context, data json.RawMessage) error {
+		c.Scan(ctx)
+		return nil
+	})
+	c.Scheduler.Register(TaskCatchUpEvaluate, c.runEvaluation)
+	if err := c.Scheduler.Schedule(ctx, TaskCatchUp, "startup", time.Now(), nil); err != nil {
+		logger.Error().Err(err).Msg("Failed to schedule catch-up scan")
+	}
+	if c.Interval > 0 {
+		if err := c.Scheduler.Every(ctx, TaskCatchUp, "periodic", c.Interval); err != nil {
+			logger.Error().Err(err).Msg("Failed to schedule catch-up scan")
+		}
+	}
+}
+
+// Scan lists the open pull requests in every repository of every
+// installation of the app and schedules an evaluation of each one. Only one
+// of the servers sharing the state store scans at a time, and evaluations
+// that are still pending from an earlier scan are replaced rather than
+// repeated.
+func (c *CatchUp) Scan(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	release, ok, err := state.TryLock(ctx, state.Ctx(c.withServices(ctx)), catchUpLock, catchUpLockTTL)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to lock catch-up scan")
+		return
+	}
+	if !ok {
+		logger.Info().Msg("Skipping catch-up scan, another server is running it")
+		return
+	}
+	defer release()
+
+	appClient, err := c.ClientCreator.NewAppClient()
+	if err != nil {
+		logger.Error().Err(errors.WithStack(err)).Msg("Failed to instantiate github app client for catch-up scan")
+		return
+	}
+
+	installations, err := githubapp.NewInstallationsService(appClient).ListAll(ctx)
+	if err != nil {
+		logger.Error().Err(errors.WithStack(err)).Msg("Failed to list installations for catch-up scan")
+		return
+	}
+
+	logger.Info().Msgf("Starting catch-up scan of %d installations", len(installations))
+	at := time.Now()
+	for _, installation := range installations {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.scanInstallation(ctx, installation, &at); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to scan installation %d of %s", installation.ID, installation.Owner)
+		}
+	}
+	logger.Info().Msg("Finished catch-up scan")
+}
+
+func (c *CatchUp) scanInstallation(ctx context.Context, installation githubapp.Installation, at *time.Time) error {
+	if until := c.RateLimits.DeferUntil(installation.Owner, time.Now()); !until.IsZero() {
+		zerolog.Ctx(ctx).Info().Msgf("Skipping catch-up scan of %s until the rate limit resets at %s", installation.Owner, until.Format(time.RFC3339))
+		return nil
+	}
+
+	client, err := c.ClientCreator.NewInstallationClient(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to instantiate github client")
+	}
+
+	var repositories []*github.Repository
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		repos, res, err := client.Apps.ListRepos(ctx, opt)
+		if err != nil {
+			return errors.Wrap(err, "failed to list installation repositories")
+		}
+		repositories = append(repositories, repos...)
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+
+	for _, repository := range repositories {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if repository.GetArchived() {
+			continue
+		}
+
+		owner := repository.GetOwner().GetLogin()
+		repo := repository.GetName()
+		if err := c.scanRepository(ctx, client, owner, repo, at); err != nil {
+			zerolog.Ctx(ctx).Error().Err(errors.WithStack(err)).Msgf("Failed to scan %s/%s for missed pull requests", owner, repo)
+		}
+	}
+	return nil
+}
+
+// scanRepository schedules an evaluation of each open pull request in the
+// repository, spaced from the time at.
+func (c *CatchUp) scanRepository(ctx context.Context, client *github.Client, owner, repo string, at *time.Time) error {
+	prs, err := pull.ListOpenPullRequests(ctx, client, owner, repo)
+	if err != nil {
+		return errors.Wrap(err, "failed to list open pull requests")
+	}
+
+	zerolog.Ctx(ctx).Debug().Msgf("Catching up on %d open pull requests in %s/%s", len(prs), owner, repo)
+
+	for _, pr := range prs {
+		task := evaluationTask{Owner: owner, Repo: repo, Number: pr.GetNumber()}
+		id := fmt.Sprintf("%s/%s#%d", owner, repo, pr.GetNumber())
+		if err := c.Scheduler.Schedule(ctx, TaskCatchUpEvaluate, id, *at, task); err != nil {
+			return err
+		}
+		*at = at.Add(catchUpSpacing)
+	}
+	return nil
+}
+
+// runEvaluation evaluates a pull request found by the catch-up scan. If the
+// owner is close to its rate limit, the evaluation is postponed until the
+// limit resets.
+func (c *CatchUp) runEvaluation(ctx context.Context, data json.RawMessage) error {
+	var task evaluationTask
+	if err := json.Unmarshal(data, &task); err != nil {
+		return errors.Wrap(err, "invalid catch-up evaluation task")
+	}
+
+	if until := c.RateLimits.DeferUntil(task.Owner, time.Now()); !until.IsZero() {
+		zerolog.Ctx(ctx).Debug().Msgf("Postponing catch-up evaluation until the rate limit resets at %s", until.Format(time.RFC3339))
+		id := fmt.Sprintf("%s/%s#%d", task.Owner, task.Repo, task.Number)
+		return c.Scheduler.Schedule(ctx, TaskCatchUpEvaluate, id, until, task)
+	}
+	return c.RunEvaluationTask(ctx, data)
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+func TestCatchUpScanLocked(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore()
+	c := &CatchUp{Base: Base{StateStore: store, Scheduler: &Scheduler{Store: store}}}
+
+	// another server is scanning; the scan returns before using the
+	// missing client creator
+	release, ok, err := state.TryLock(ctx, store, catchUpLock, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+	defer release()
+
+	c.Scan(ctx)
+}
+
+func TestCatchUpScanRepository(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/o/r/pulls", r.URL.Path)
+		_, _ = w.Write([]byte(`[{"number": 1}, {"number": 2}]`))
+	}))
+	defer srv.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+
+	store := state.NewMemoryStore()
+	c := &CatchUp{Base: Base{Scheduler: &Scheduler{Store: store}}}
+
+	start := time.Now().UTC()
+	at := start
+	require.NoError(t, c.scanRepository(ctx, client, "o", "r", &at))
+	require.NoError(t, c.scanRepository(ctx, client, "o", "r", &at))
+
+	tasks, err := c.Scheduler.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, tasks, 2, "evaluations enqueued again replace the pending ones")
+	assert.Equal(t, "o/r#1", tasks[0].ID)
+	assert.Equal(t, TaskCatchUpEvaluate, tasks[0].Kind)
+	assert.Equal(t, start.Add(2*catchUpSpacing), tasks[0].RunAt, "evaluations are spaced out")
+	assert.Equal(t, start.Add(3*catchUpSpacing), tasks[1].RunAt)
+}
+
+func TestCatchUpEvaluationRateLimited(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore()
+
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	limits := NewRateLimits(0)
+	limits.Observe("o", &http.Response{Header: http.Header{
+		"X-Ratelimit-Limit":     {"5000"},
+		"X-Ratelimit-Remaining": {"10"},
+		"X-Ratelimit-Reset":     {strconv.FormatInt(reset.Unix(), 10)},
+	}})
+	c := &CatchUp{Base: Base{Scheduler: &Scheduler{Store: store}, RateLimits: limits}}
+
+	data, err := json.Marshal(evaluationTask{Owner: "o", Repo: "r", Number: 1})
+	require.NoError(t, err)
+	require.NoError(t, c.runEvaluation(ctx, data))
+
+	tasks, err := c.Scheduler.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.True(t, reset.Equal(tasks[0].RunAt), "evaluations are postponed until the rate limit resets")
+}
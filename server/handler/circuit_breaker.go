@@ -0,0 +1,267 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultCircuitBreakerWindow       = time.Minute
+	DefaultCircuitBreakerMinRequests  = 20
+	DefaultCircuitBreakerFailureRatio = 0.5
+	DefaultCircuitBreakerCooldown     = 30 * time.Second
+
+	MetricsKeyCircuitOpen  = "bulldozer.github.circuit_open"
+	MetricsKeyCircuitTrips = "bulldozer.github.circuit_trips"
+)
+
+// CircuitBreaker stops requests to GitHub for an owner when many of them fail
+// with server errors or transport errors, like during a GitHub incident, instead of
+// retrying merges and updates that are bound to fail. Each GitHub App
+// installation belongs to a single owner, so each installation has its own
+// circuit.
+//
+// The circuit of an owner opens when at least MinRequests requests were sent
+// in the current Window and at least FailureRatio of them failed. While it
+// is open, requests fail with CircuitOpenError without being sent. After
+// Cooldown, a single request is sent to probe GitHub: if it succeeds, the
+// circuit closes, otherwise it stays open for another Cooldown. It is safe
+// for concurrent use.
+type CircuitBreaker struct {
+	Window       time.Duration
+	MinRequests  int
+	FailureRatio float64
+	Cooldown     time.Duration
+
+	// Registry receives a gauge of the number of open circuits and a
+	// counter of trips. If nil, the default registry is used.
+	Registry metrics.Registry
+
+	// OnOpen and OnClose, if set, are called when the circuit of an owner
+	// opens or closes.
+	OnOpen  func(ctx context.Context, owner string)
+	OnClose func(ctx context.Context, owner string)
+
+	lock    sync.Mutex
+	circuit map[string]*circuit
+}
+
+type circuit struct {
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	openUntil time.Time
+	probing   bool
+}
+
+func (c *circuit) open() bool {
+	return !c.openUntil.IsZero()
+}
+
+// CircuitOpenError is returned instead of sending requests for an owner while
+// its circuit is open.
+type CircuitOpenError struct {
+	Owner string
+	Until time.Time
+}
+
+func (err CircuitOpenError) Error() string {
+	return fmt.Sprintf("not sending request for %s while GitHub is failing, next attempt at %s", err.Owner, err.Until.Format(time.RFC3339))
+}
+
+// Open returns the owners with open circuits and when each will be probed.
+func (b *CircuitBreaker) Open() map[string]time.Time {
+	open := make(map[string]time.Time)
+	if b == nil {
+		return open
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for owner, c := range b.circuit {
+		if c.open() {
+			open[owner] = c.openUntil
+		}
+	}
+	return open
+}
+
+// allow returns true if a request for the owner may be sent. If the circuit
+// is open and the cooldown has passed, the request is the probe.
+func (b *CircuitBreaker) allow(owner string, now time.Time) (bool, bool, time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c := b.circuit[owner]
+	if c == nil || !c.open() {
+		return true, false, time.Time{}
+	}
+	if c.probing || now.Before(c.openUntil) {
+		return false, false, c.openUntil
+	}
+	c.probing = true
+	return true, true, time.Time{}
+}
+
+// record records the result of a request for the owner and returns whether
+// the circuit opened or closed as a result.
+func (b *CircuitBreaker) record(owner string, probe, failed bool, now time.Time) (opened, closed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.circuit == nil {
+		b.circuit = make(map[string]*circuit)
+	}
+	c := b.circuit[owner]
+	if c == nil {
+		c = &circuit{windowStart: now}
+		b.circuit[owner] = c
+	}
+
+	if probe {
+		c.probing = false
+		if failed {
+			c.openUntil = now.Add(b.cooldown())
+			return false, false
+		}
+		*c = circuit{windowStart: now}
+		b.updateOpen()
+		return false, true
+	}
+	if c.open() {
+		return false, false
+	}
+
+	if now.Sub(c.windowStart) >= b.window() {
+		c.windowStart, c.requests, c.failures = now, 0, 0
+	}
+	c.requests++
+	if failed {
+		c.failures++
+	}
+
+	if c.requests >= b.minRequests() && float64(c.failures) >= b.failureRatio()*float64(c.requests) {
+		c.openUntil = now.Add(b.cooldown())
+		metrics.GetOrRegisterCounter(MetricsKeyCircuitTrips, b.registry()).Inc(1)
+		b.updateOpen()
+		return true, false
+	}
+	return false, false
+}
+
+func (b *CircuitBreaker) updateOpen() {
+	var open int64
+	for _, c := range b.circuit {
+		if c.open() {
+			open++
+		}
+	}
+	metrics.GetOrRegisterGauge(MetricsKeyCircuitOpen, b.registry()).Update(open)
+}
+
+// Middleware returns client middleware that counts failed requests and stops
+// requests for owners with open circuits. Requests that do not belong to an
+// owner are always sent.
+func (b *CircuitBreaker) Middleware() githubapp.ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			owner := pathOwner(req.URL.Path)
+			if owner == "" {
+				return next.RoundTrip(req)
+			}
+
+			allowed, probe, until := b.allow(owner, time.Now())
+			if !allowed {
+				return nil, CircuitOpenError{Owner: owner, Until: until}
+			}
+
+			res, err := next.RoundTrip(req)
+
+			logger := zerolog.Ctx(req.Context())
+			opened, closed := b.record(owner, probe, isOutage(req.Context(), res, err), time.Now())
+			switch {
+			case opened:
+				logger.Warn().Msgf("GitHub requests for %s are failing, stopping requests for %s", owner, b.cooldown())
+				if b.OnOpen != nil {
+					b.OnOpen(req.Context(), owner)
+				}
+			case closed:
+				logger.Info().Msgf("GitHub requests for %s succeed again, resuming requests", owner)
+				if b.OnClose != nil {
+					b.OnClose(req.Context(), owner)
+				}
+			}
+			return res, err
+		})
+	}
+}
+
+// isOutage returns true if the request failed in a way that suggests GitHub
+// is unavailable: any transport error, such as a timeout, a refused
+// connection, or a failed DNS lookup, or a server error. Requests canceled
+// by bulldozer are not failures.
+func isOutage(ctx context.Context, res *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() != context.Canceled && errors.Cause(err) != context.Canceled
+	}
+	return res != nil && res.StatusCode >= 500
+}
+
+func (b *CircuitBreaker) window() time.Duration {
+	if b.Window <= 0 {
+		return DefaultCircuitBreakerWindow
+	}
+	return b.Window
+}
+
+func (b *CircuitBreaker) minRequests() int {
+	if b.MinRequests <= 0 {
+		return DefaultCircuitBreakerMinRequests
+	}
+	return b.MinRequests
+}
+
+func (b *CircuitBreaker) failureRatio() float64 {
+	if b.FailureRatio <= 0 {
+		return DefaultCircuitBreakerFailureRatio
+	}
+	return b.FailureRatio
+}
+
+func (b *CircuitBreaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return DefaultCircuitBreakerCooldown
+	}
+	return b.Cooldown
+}
+
+func (b *CircuitBreaker) registry() metrics.Registry {
+	if b.Registry == nil {
+		return metrics.DefaultRegistry
+	}
+	return b.Registry
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsOutage(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := map[string]struct {
+		ctx    context.Context
+		res    *http.Response
+		err    error
+		outage bool
+	}{
+		"success":            {res: &http.Response{StatusCode: http.StatusOK}},
+		"client error":       {res: &http.Response{StatusCode: http.StatusNotFound}},
+		"server error":       {res: &http.Response{StatusCode: http.StatusBadGateway}, outage: true},
+		"timeout":            {err: context.DeadlineExceeded, outage: true},
+		"connection refused": {err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, outage: true},
+		"dns failure":        {err: &net.DNSError{Err: "no such host", Name: "api.github.com"}, outage: true},
+		"reset":              {err: errors.New("read: connection reset by peer"), outage: true},
+		"canceled error":     {err: errors.Wrap(context.Canceled, "request failed")},
+		"canceled context":   {ctx: canceled, err: errors.New("read: use of closed network connection")},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := test.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			assert.Equal(t, test.outage, isOutage(ctx, test.res, test.err))
+		})
+	}
+}
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	b := &CircuitBreaker{MinRequests: 2, Cooldown: time.Hour, Registry: metrics.NewRegistry()}
+
+	var opened []string
+	b.OnOpen = func(ctx context.Context, owner string) {
+		opened = append(opened, owner)
+	}
+
+	sent := 0
+	transport := b.Middleware()(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent++
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}))
+
+	get := func(path string) error {
+		req, err := http.NewRequest(http.MethodGet, "https://api.github.com"+path, nil)
+		require.NoError(t, err)
+		_, err = transport.RoundTrip(req)
+		return err
+	}
+
+	assert.Error(t, get("/repos/palantir/bulldozer"))
+	assert.Error(t, get("/repos/palantir/bulldozer/pulls"))
+	assert.Equal(t, []string{"palantir"}, opened, "refused connections open the circuit")
+	assert.Contains(t, b.Open(), "palantir")
+
+	err := get("/repos/palantir/bulldozer")
+	assert.IsType(t, CircuitOpenError{}, err)
+	assert.Equal(t, 2, sent, "requests are not sent while the circuit is open")
+
+	assert.Error(t, get("/repos/other/repo"))
+	assert.Equal(t, 3, sent, "other owners have their own circuits")
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	b := &CircuitBreaker{MinRequests: 1, Cooldown: time.Minute, Registry: metrics.NewRegistry()}
+	now := time.Now()
+
+	opened, _ := b.record("palantir", false, true, now)
+	require.True(t, opened)
+
+	allowed, probe, _ := b.allow("palantir", now.Add(2*time.Minute))
+	require.True(t, allowed)
+	require.True(t, probe)
+
+	_, closed := b.record("palantir", true, true, now.Add(2*time.Minute))
+	assert.False(t, closed, "a failed probe keeps the circuit open")
+	assert.Contains(t, b.Open(), "palantir")
+
+	allowed, probe, _ = b.allow("palantir", now.Add(4*time.Minute))
+	require.True(t, allowed)
+	require.True(t, probe)
+
+	_, closed = b.record("palantir", true, false, now.Add(4*time.Minute))
+	assert.True(t, closed, "a successful probe closes the circuit")
+	assert.Empty(t, b.Open())
+}
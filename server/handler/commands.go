@@ -0,0 +1,225 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/pull"
+)
+
+// RunCommand runs a comment command on behalf of the user. Users without
+// write permission on the repository receive a reply instead.
+func (b *Base) RunCommand(ctx context.Context, pullCtx pull.Context, client *github.Client, pr *github.PullRequest, command bulldozer.Command, user string) error {
+	ctx = withCorrelationID(b.withServices(ctx), pullCtx)
+	logger := zerolog.Ctx(ctx)
+	owner, repo, number := pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number()
+
+	if !command.Valid() {
+		return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s `%s %s` is not a known command. Supported commands are `%s`, `%s`, `%s`, `%s`, `%s`, and `%s`.",
+			user, bulldozer.CommandPrefix, command, bulldozer.CommandHold, bulldozer.CommandRelease, bulldozer.CommandMergeNow, bulldozer.CommandPauseUpdates, bulldozer.CommandResumeUpdates, bulldozer.CommandUpdate))
+	}
+
+	allowed, err := bulldozer.CanRunCommands(ctx, client, owner, repo, user)
+	if err != nil {
+		return err
+	}
+	if command.AuthorMayRun() && user == pr.GetUser().GetLogin() {
+		allowed = true
+	}
+	if !allowed {
+		logger.Info().Msgf("Ignoring %q command from %s, who does not have write permission", command, user)
+		if command.AuthorMayRun() {
+			return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s only the author of this pull request and users with write permission on this repository can run `%s %s`.", user, bulldozer.CommandPrefix, command))
+		}
+		return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s only users with write permission on this repository can run `%s %s`.", user, bulldozer.CommandPrefix, command))
+	}
+
+	logger.Info().Msgf("Running %q command from %s", command, user)
+
+	switch command {
+	case bulldozer.CommandHold:
+		return bulldozer.HoldPR(ctx, client, owner, repo, number, user)
+
+	case bulldozer.CommandRelease:
+		if err := bulldozer.ReleasePR(ctx, client, owner, repo, number); err != nil {
+			return err
+		}
+
+		// the pull request is fetched again so the evaluation does not see
+		// the deleted hold comment
+		return b.reprocess(ctx, client, owner, repo, number)
+
+	case bulldozer.CommandPauseUpdates:
+		return bulldozer.PauseUpdates(ctx, client, owner, repo, number, user)
+
+	case bulldozer.CommandResumeUpdates:
+		if err := bulldozer.ResumeUpdates(ctx, client, owner, repo, number); err != nil {
+			return err
+		}
+
+		freshPR, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get pull request %s/%s#%d", owner, repo, number)
+		}
+		freshCtx := pull.NewGithubContext(client, freshPR, owner, repo, number)
+		return b.UpdatePullRequest(ctx, freshCtx, client, freshPR, freshPR.GetBase().GetRef(), bulldozer.TriggerCommand)
+
+	case bulldozer.CommandUpdate:
+		return b.updateNow(ctx, client, pullCtx, pr, user)
+
+	case bulldozer.CommandMergeNow:
+		if err := bulldozer.ReleasePR(ctx, client, owner, repo, number); err != nil {
+			return err
+		}
+		return b.mergeNow(ctx, client, pullCtx, pr, user)
+	}
+
+	return nil
+}
+
+// mergeNow merges the pull request if it satisfies every requirement except
+// the whitelist, bypassing the merge queue.
+func (b *Base) mergeNow(ctx context.Context, client *github.Client, pullCtx pull.Context, pr *github.PullRequest, user string) error {
+	if paused, err := b.repositoryPaused(ctx, pullCtx); err != nil || paused {
+		if paused {
+			return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s bulldozer is paused for this repository.", user))
+		}
+		return err
+	}
+
+	bulldozerConfig, err := b.ConfigForPR(ctx, client, pr)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch configuration")
+	}
+	if bulldozerConfig.Missing() || bulldozerConfig.Invalid() {
+		return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s this repository does not have a valid bulldozer configuration.", user))
+	}
+
+	mergeConfig := bulldozerConfig.Config.Merge
+	mergeConfig.Whitelist = bulldozer.Signals{}
+	ctx = b.withNotifications(ctx, bulldozerConfig.Config.Notifications)
+
+	if err := requireBotLogin(ctx); err != nil {
+		return err
+	}
+	freshCtx := pull.NewGithubContext(client, pr, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+	shouldMerge, err := bulldozer.ShouldMergePR(ctx, freshCtx, mergeConfig)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine merge status")
+	}
+	if !shouldMerge {
+		return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s this pull request cannot be merged yet because it does not satisfy the other merge requirements.", user))
+	}
+
+	unlock, err := b.lock(ctx, pullRequestLock(pullCtx))
+	if err != nil {
+		return err
+	}
+	defer func() { unlock() }()
+
+	release, err := b.MergeLimiter.Acquire(ctx, pullCtx.Owner()+"/"+pullCtx.Repo())
+	if err != nil {
+		if errors.Cause(err) == ErrQueueFull {
+			return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s too many merges are waiting, please try again later.", user))
+		}
+		return err
+	}
+	defer func() { release() }()
+
+	unlockBase, err := b.lock(ctx, baseBranchLock(pullCtx, pr))
+	if err != nil {
+		return err
+	}
+	defer func() { unlockBase() }()
+
+	if halted, err := b.mergeHalted(ctx, client, pullCtx); err != nil || halted {
+		if halted {
+			return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s merges are stopped for this organization.", user))
+		}
+		return err
+	}
+
+	if !b.startMerge(ctx, freshCtx, client, mergeConfig, bulldozerConfig.Config.Notifications, unlockBase, unlock, release) {
+		return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s bulldozer is restarting, please try again later.", user))
+	}
+	// the merge releases the locks and its slot when it finishes
+	unlock, unlockBase, release = func() {}, func() {}, func() {}
+	return nil
+}
+
+// updateNow updates the pull request if it is out of date, ignoring update
+// signals, pauses, and the conditions that delay updates.
+func (b *Base) updateNow(ctx context.Context, client *github.Client, pullCtx pull.Context, pr *github.PullRequest, user string) error {
+	if paused, err := b.repositoryPaused(ctx, pullCtx); err != nil || paused {
+		if paused {
+			return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s bulldozer is paused for this repository.", user))
+		}
+		return err
+	}
+
+	bulldozerConfig, err := b.ConfigForPR(ctx, client, pr)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch configuration")
+	}
+	if bulldozerConfig.Missing() || bulldozerConfig.Invalid() {
+		return b.replyToCommand(ctx, client, pullCtx, fmt.Sprintf("@%s this repository does not have a valid bulldozer configuration.", user))
+	}
+
+	updateConfig := bulldozerConfig.Config.Update
+	updateConfig.MinCommitsBehind = 0
+	updateConfig.MinTimeBehind = 0
+	updateConfig.WaitForChecks = false
+
+	logger := zerolog.Ctx(ctx)
+	ctx = b.withNotifications(b.withServices(logger.WithContext(context.Background())), bulldozerConfig.Config.Notifications)
+	b.Operations.Go(func() {
+		unlock, err := b.lock(ctx, pullRequestLock(pullCtx))
+		if err != nil {
+			logger.Error().Err(err).Msg("Error updating pull request")
+			return
+		}
+		defer unlock()
+
+		if _, err := bulldozer.UpdatePR(ctx, pullCtx, client, updateConfig, bulldozerConfig.Config.Merge, pr.GetBase().GetRef(), bulldozer.TriggerCommand); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Error updating pull request")
+		}
+	})
+
+	return nil
+}
+
+// reprocess fetches the pull request and processes it.
+func (b *Base) reprocess(ctx context.Context, client *github.Client, owner, repo string, number int) error {
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pull request %s/%s#%d", owner, repo, number)
+	}
+
+	pullCtx := pull.NewGithubContext(client, pr, owner, repo, number)
+	return b.ProcessPullRequest(ctx, pullCtx, client, pr)
+}
+
+func (b *Base) replyToCommand(ctx context.Context, client *github.Client, pullCtx pull.Context, body string) error {
+	comment := &github.IssueComment{Body: github.String(body)}
+	_, _, err := client.Issues.CreateComment(ctx, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number(), comment)
+	return errors.Wrap(err, "failed to reply to command")
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/pull"
+)
+
+// LogKeyCorrelationID is the log field that identifies the processing of a
+// pull request for a webhook delivery. All lines logged while processing the
+// pull request, including by background merges and updates, have the same
+// value.
+const LogKeyCorrelationID = "correlation_id"
+
+type deliveryIDCtxKey struct{}
+type correlationIDCtxKey struct{}
+
+// Correlate returns a handler that makes the delivery ID available to the
+// correlation IDs of the pull requests that h processes.
+func Correlate(h githubapp.EventHandler) githubapp.EventHandler {
+	return &correlatedHandler{EventHandler: h}
+}
+
+type correlatedHandler struct {
+	githubapp.EventHandler
+}
+
+func (h *correlatedHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	return h.EventHandler.Handle(context.WithValue(ctx, deliveryIDCtxKey{}, deliveryID), eventType, deliveryID, payload)
+}
+
+// CorrelationID returns the correlation ID for processing a pull request.
+// Pull requests processed outside of a webhook delivery, like by sweeps, have
+// an empty delivery ID.
+func CorrelationID(deliveryID, owner, repo string, number int) string {
+	if deliveryID == "" {
+		return fmt.Sprintf("%s/%s#%d", owner, repo, number)
+	}
+	return fmt.Sprintf("%s:%s/%s#%d", deliveryID, owner, repo, number)
+}
+
+// withCorrelationID adds the correlation ID and the pull request to the
+// logger of the context, unless they were already added.
+func withCorrelationID(ctx context.Context, pullCtx pull.Context) context.Context {
+	deliveryID, _ := ctx.Value(deliveryIDCtxKey{}).(string)
+	id := CorrelationID(deliveryID, pullCtx.Owner(), pullCtx.Repo(), pullCtx.Number())
+	if current, _ := ctx.Value(correlationIDCtxKey{}).(string); current == id {
+		return ctx
+	}
+
+	logger := zerolog.Ctx(ctx).With().
+		Str(LogKeyCorrelationID, id).
+		Logger()
+	return context.WithValue(logger.WithContext(ctx), correlationIDCtxKey{}, id)
+}
@@ -0,0 +1,218 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	recentMergesKey = "dashboard/merges"
+	recentErrorsKey = "dashboard/errors"
+
+	// recentLimit is the number of merges and errors kept for the dashboard
+	recentLimit = 25
+
+	// recentLockTTL and recentLockWait limit how long the lock on a stored
+	// list is held and waited for
+	recentLockTTL  = 30 * time.Second
+	recentLockWait = 10 * time.Second
+)
+
+// Activity is an audit sink that keeps the most recent merges and failures
+// in the state store, for the dashboard.
+type Activity struct {
+	Store state.Store
+}
+
+func (a *Activity) Record(ctx context.Context, event audit.Event) error {
+	var key string
+	switch {
+	case event.Type == audit.TypeMerge && event.Result == audit.ResultMerged:
+		key = recentMergesKey
+	case event.Result == audit.ResultFailed:
+		key = recentErrorsKey
+	default:
+		return nil
+	}
+
+	// the lock is in the store so that servers sharing it do not overwrite
+	// each other's events
+	waitCtx, cancel := context.WithTimeout(ctx, recentLockWait)
+	defer cancel()
+	unlock, err := state.WaitLock(waitCtx, a.Store, key, recentLockTTL)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	events, err := a.Recent(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	events = append([]audit.Event{event}, events...)
+	if len(events) > recentLimit {
+		events = events[:recentLimit]
+	}
+
+	b, err := json.Marshal(events)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal recent events")
+	}
+	return a.Store.Set(ctx, key, b, 0)
+}
+
+// Recent returns the stored events for the key, newest first.
+func (a *Activity) Recent(ctx context.Context, key string) ([]audit.Event, error) {
+	b, ok, err := a.Store.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, errors.Wrapf(err, "failed to get %q", key)
+	}
+
+	var events []audit.Event
+	if err := json.Unmarshal(b, &events); err != nil {
+		return nil, errors.Wrapf(err, "invalid recent events %q", key)
+	}
+	return events, nil
+}
+
+type dashboardQueue struct {
+	Key     string
+	Entries []bulldozer.QueueEntry
+}
+
+type dashboardData struct {
+	Queues []dashboardQueue
+	Merges []audit.Event
+	Pauses []bulldozer.Pause
+	Paused []bulldozer.RepositoryPause
+	Errors []audit.Event
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>bulldozer</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>bulldozer</h1>
+
+<h2>Merge queues</h2>
+{{range .Queues}}
+<h3>{{.Key}}</h3>
+<table>
+<tr><th>Position</th><th>Pull request</th><th>Head</th><th>Enqueued</th></tr>
+{{range $i, $e := .Entries}}<tr><td>{{$i}}</td><td>#{{$e.Number}}</td><td>{{$e.HeadRef}} ({{$e.HeadSHA}})</td><td>{{$e.EnqueuedAt.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{end}}</table>
+{{else}}<p>No pull requests are queued.</p>
+{{end}}
+
+<h2>Recently merged</h2>
+{{if .Merges}}<table>
+<tr><th>Time</th><th>Pull request</th><th>Method</th><th>Commit</th><th>Trigger</th></tr>
+{{range .Merges}}<tr><td>{{.Time.Format "2006-01-02 15:04:05 MST"}}</td><td>{{.Owner}}/{{.Repo}}#{{.Number}}</td><td>{{.Method}}</td><td>{{.MergeSHA}}</td><td>{{.Trigger}}</td></tr>
+{{end}}</table>
+{{else}}<p>No merges since the server started.</p>
+{{end}}
+
+<h2>Paused</h2>
+{{if .Paused}}<table>
+<tr><th>Repository</th><th>By</th><th>Reason</th><th>Since</th></tr>
+{{range .Paused}}<tr><td>{{.}}</td><td>{{.User}}</td><td>{{.Reason}}</td><td>{{.Since.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Pauses}}<table>
+<tr><th>Pull request</th><th>Paused</th><th>By</th><th>Since</th></tr>
+{{range .Pauses}}<tr><td>{{.Owner}}/{{.Repo}}#{{.Number}}</td><td>{{.Kind}}</td><td>{{.User}}</td><td>{{.Since.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{end}}</table>
+{{else if not .Paused}}<p>Nothing is paused.</p>
+{{end}}
+
+<h2>Recent errors</h2>
+{{if .Errors}}<table>
+<tr><th>Time</th><th>Action</th><th>Pull request</th><th>Error</th></tr>
+{{range .Errors}}<tr><td>{{.Time.Format "2006-01-02 15:04:05 MST"}}</td><td>{{.Type}}</td><td>{{.Owner}}/{{.Repo}}#{{.Number}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+{{else}}<p>No errors since the server started.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// Dashboard serves a page showing the merge queues, recent merges, paused
+// repositories and pull requests, and recent errors of the server.
+func Dashboard(queue *bulldozer.MergeQueue, store state.Store, activity *Activity) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := state.WithStore(r.Context(), store)
+		logger := zerolog.Ctx(ctx)
+
+		var data dashboardData
+		for _, key := range queue.Keys() {
+			data.Queues = append(data.Queues, dashboardQueue{Key: key, Entries: queue.Entries(key)})
+		}
+
+		var err error
+		if data.Merges, err = activity.Recent(ctx, recentMergesKey); err == nil {
+			if data.Errors, err = activity.Recent(ctx, recentErrorsKey); err == nil {
+				if data.Pauses, err = bulldozer.ListPauses(ctx); err == nil {
+					data.Paused, err = bulldozer.ListRepositoryPauses(ctx)
+				}
+			}
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to load dashboard data")
+			http.Error(w, "failed to load dashboard data", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(w, data); err != nil {
+			logger.Error().Err(err).Msg("Failed to render dashboard")
+		}
+	})
+}
+
+// RequireBasicAuth only allows requests with the username and password to
+// reach the handler.
+func RequireBasicAuth(username, password string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(username)) != 1 || subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="bulldozer"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/state"
+)
+
+func TestActivitySharedStore(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore()
+
+	// two servers sharing a store must not overwrite each other's events
+	servers := []*Activity{{Store: store}, {Store: store}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(number int) {
+			defer wg.Done()
+			event := audit.Event{Type: audit.TypeMerge, Result: audit.ResultMerged, Number: number}
+			assert.NoError(t, servers[number%2].Record(ctx, event))
+		}(i)
+	}
+	wg.Wait()
+
+	events, err := servers[0].Recent(ctx, recentMergesKey)
+	require.NoError(t, err)
+
+	numbers := make(map[int]bool)
+	for _, event := range events {
+		numbers[event.Number] = true
+	}
+	assert.Len(t, numbers, 8)
+}
@@ -0,0 +1,236 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	deadLetterPrefix = "dead-letters/"
+
+	// DefaultDeadLetterTTL is how long failed deliveries are kept if the
+	// dead letter store does not set a TTL
+	DefaultDeadLetterTTL = 7 * 24 * time.Hour
+)
+
+// DeadLetter is a webhook delivery that failed processing.
+type DeadLetter struct {
+	DeliveryID string          `json:"delivery_id"`
+	EventType  string          `json:"event_type"`
+	Payload    json.RawMessage `json:"payload"`
+	Error      string          `json:"error"`
+	Attempts   int             `json:"attempts"`
+	FailedAt   time.Time       `json:"failed_at"`
+}
+
+// DeadLetters keeps webhook deliveries that fail processing in the state
+// store, so that they can be inspected and replayed after the cause of the
+// failure is fixed.
+type DeadLetters struct {
+	Store state.Store
+	TTL   time.Duration
+
+	lock     sync.Mutex
+	handlers map[string]githubapp.EventHandler
+}
+
+// Wrap returns a handler that stores the deliveries that h fails to process.
+// Only wrapped handlers can replay deliveries.
+func (d *DeadLetters) Wrap(h githubapp.EventHandler) githubapp.EventHandler {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.handlers == nil {
+		d.handlers = make(map[string]githubapp.EventHandler)
+	}
+	for _, eventType := range h.Handles() {
+		if _, ok := d.handlers[eventType]; !ok {
+			d.handlers[eventType] = h
+		}
+	}
+	return &deadLetterHandler{EventHandler: h, letters: d}
+}
+
+type deadLetterHandler struct {
+	githubapp.EventHandler
+	letters *DeadLetters
+}
+
+func (h *deadLetterHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	err := h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+	if err != nil {
+		letter := DeadLetter{
+			DeliveryID: deliveryID,
+			EventType:  eventType,
+			Payload:    json.RawMessage(payload),
+			Error:      err.Error(),
+			Attempts:   1,
+			FailedAt:   time.Now().UTC(),
+		}
+		if serr := h.letters.save(ctx, letter); serr != nil {
+			zerolog.Ctx(ctx).Error().Err(serr).Msgf("Failed to store dead letter for delivery %s", deliveryID)
+		}
+	}
+	return err
+}
+
+func (d *DeadLetters) save(ctx context.Context, letter DeadLetter) error {
+	b, err := json.Marshal(letter)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal dead letter")
+	}
+
+	ttl := d.TTL
+	if ttl <= 0 {
+		ttl = DefaultDeadLetterTTL
+	}
+	return d.Store.Set(ctx, deadLetterPrefix+letter.DeliveryID, b, ttl)
+}
+
+// Get returns the dead letter for the delivery and true, or false if there is
+// no dead letter for the delivery.
+func (d *DeadLetters) Get(ctx context.Context, deliveryID string) (DeadLetter, bool, error) {
+	b, ok, err := d.Store.Get(ctx, deadLetterPrefix+deliveryID)
+	if err != nil || !ok {
+		return DeadLetter{}, false, errors.Wrapf(err, "failed to get dead letter %s", deliveryID)
+	}
+
+	var letter DeadLetter
+	if err := json.Unmarshal(b, &letter); err != nil {
+		return DeadLetter{}, false, errors.Wrapf(err, "invalid dead letter %s", deliveryID)
+	}
+	return letter, true, nil
+}
+
+// List returns the stored dead letters, ordered by delivery ID.
+func (d *DeadLetters) List(ctx context.Context) ([]DeadLetter, error) {
+	keys, err := d.Store.Keys(ctx, deadLetterPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list dead letters")
+	}
+
+	letters := []DeadLetter{}
+	for _, key := range keys {
+		letter, ok, err := d.Get(ctx, strings.TrimPrefix(key, deadLetterPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			letters = append(letters, letter)
+		}
+	}
+	return letters, nil
+}
+
+// Delete discards the dead letter for the delivery.
+func (d *DeadLetters) Delete(ctx context.Context, deliveryID string) error {
+	return errors.Wrapf(d.Store.Delete(ctx, deadLetterPrefix+deliveryID), "failed to delete dead letter %s", deliveryID)
+}
+
+// Replay processes a dead letter again with the handler for its event type.
+// If processing succeeds, the dead letter is deleted; otherwise, its error
+// and number of attempts are updated.
+func (d *DeadLetters) Replay(ctx context.Context, letter DeadLetter) error {
+	d.lock.Lock()
+	h, ok := d.handlers[letter.EventType]
+	d.lock.Unlock()
+	if !ok {
+		return errors.Errorf("no handler for %q events", letter.EventType)
+	}
+
+	logger := zerolog.Ctx(ctx).With().
+		Str(githubapp.LogKeyEventType, letter.EventType).
+		Str(githubapp.LogKeyDeliveryID, letter.DeliveryID).
+		Logger()
+	ctx = logger.WithContext(ctx)
+
+	logger.Info().Msgf("Replaying dead letter after %d failed attempts", letter.Attempts)
+	if err := h.Handle(ctx, letter.EventType, letter.DeliveryID, letter.Payload); err != nil {
+		letter.Error = err.Error()
+		letter.Attempts++
+		letter.FailedAt = time.Now().UTC()
+		if serr := d.save(ctx, letter); serr != nil {
+			logger.Error().Err(serr).Msg("Failed to update dead letter")
+		}
+		return err
+	}
+	return d.Delete(ctx, letter.DeliveryID)
+}
+
+// ListDeadLetters serves the stored dead letters as JSON.
+func ListDeadLetters(d *DeadLetters) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		letters, err := d.List(r.Context())
+		if err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to list dead letters")
+			http.Error(w, "failed to list dead letters", http.StatusInternalServerError)
+			return
+		}
+		baseapp.WriteJSON(w, http.StatusOK, letters)
+	})
+}
+
+// ReplayDeadLetter replays the dead letter with the delivery ID in the path.
+// It responds with the error if processing fails again.
+func ReplayDeadLetter(d *DeadLetters) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		deliveryID := pat.Param(r, "delivery")
+
+		letter, ok, err := d.Get(ctx, deliveryID)
+		switch {
+		case err != nil:
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to get dead letter")
+			http.Error(w, "failed to get dead letter", http.StatusInternalServerError)
+			return
+		case !ok:
+			http.Error(w, "dead letter not found", http.StatusNotFound)
+			return
+		}
+
+		if err := d.Replay(ctx, letter); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to replay dead letter")
+			baseapp.WriteJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// DeleteDeadLetter discards the dead letter with the delivery ID in the path.
+func DeleteDeadLetter(d *DeadLetters) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := d.Delete(r.Context(), pat.Param(r, "delivery")); err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to delete dead letter")
+			http.Error(w, "failed to delete dead letter", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"goji.io"
+	"goji.io/pat"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+func TestDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	d := &DeadLetters{Store: state.NewMemoryStore()}
+	h := &failingHandler{}
+	wrapped := d.Wrap(h)
+
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "d1", []byte(`{"number": 1}`)))
+
+	h.err = errors.New("failed")
+	assert.Error(t, wrapped.Handle(ctx, "pull_request", "d2", []byte(`{"number": 2}`)))
+
+	letters, err := d.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, letters, 1, "only failed deliveries are kept")
+	assert.Equal(t, "d2", letters[0].DeliveryID)
+	assert.Equal(t, "pull_request", letters[0].EventType)
+	assert.JSONEq(t, `{"number": 2}`, string(letters[0].Payload))
+	assert.Equal(t, "failed", letters[0].Error)
+	assert.Equal(t, 1, letters[0].Attempts)
+
+	h.err = errors.New("failed again")
+	assert.Error(t, d.Replay(ctx, letters[0]))
+
+	letter, ok, err := d.Get(ctx, "d2")
+	require.NoError(t, err)
+	require.True(t, ok, "dead letters are kept if replaying fails")
+	assert.Equal(t, "failed again", letter.Error)
+	assert.Equal(t, 2, letter.Attempts)
+
+	h.err = nil
+	require.NoError(t, d.Replay(ctx, letter))
+
+	_, ok, err = d.Get(ctx, "d2")
+	require.NoError(t, err)
+	assert.False(t, ok, "dead letters are deleted after replaying succeeds")
+	assert.Equal(t, []string{"d1", "d2", "d2", "d2"}, h.handled)
+
+	assert.Error(t, d.Replay(ctx, DeadLetter{DeliveryID: "d3", EventType: "issue_comment"}), "only wrapped handlers replay deliveries")
+}
+
+func TestDeadLetterEndpoints(t *testing.T) {
+	ctx := context.Background()
+	d := &DeadLetters{Store: state.NewMemoryStore()}
+	h := &failingHandler{err: errors.New("failed")}
+	wrapped := d.Wrap(h)
+
+	assert.Error(t, wrapped.Handle(ctx, "pull_request", "d1", []byte(`{}`)))
+	assert.Error(t, wrapped.Handle(ctx, "pull_request", "d2", []byte(`{}`)))
+
+	mux := goji.NewMux()
+	mux.Handle(pat.Get("/api/dead-letters"), ListDeadLetters(d))
+	mux.Handle(pat.Post("/api/dead-letters/:delivery/replay"), ReplayDeadLetter(d))
+	mux.Handle(pat.Delete("/api/dead-letters/:delivery"), DeleteDeadLetter(d))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := serve(http.MethodGet, "/api/dead-letters")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var letters []DeadLetter
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &letters))
+	require.Len(t, letters, 2)
+	assert.Equal(t, "d1", letters[0].DeliveryID)
+	assert.Equal(t, "d2", letters[1].DeliveryID)
+
+	assert.Equal(t, http.StatusBadGateway, serve(http.MethodPost, "/api/dead-letters/d1/replay").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/api/dead-letters/d3/replay").Code)
+
+	h.err = nil
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodPost, "/api/dead-letters/d1/replay").Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/dead-letters/d2").Code)
+
+	letters, err := d.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, letters)
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	deliveryPrefix = "deliveries/"
+
+	// DefaultDeliveryDedupTTL is how long delivery IDs are remembered if the
+	// deduplicator does not set a TTL
+	DefaultDeliveryDedupTTL = 24 * time.Hour
+
+	// deliveryClaimTTL is how long a delivery is claimed while it is handled;
+	// if the server stops before finishing, the delivery can be handled again
+	// after the claim expires
+	deliveryClaimTTL = 15 * time.Minute
+)
+
+var (
+	deliveryProcessing = []byte("processing")
+	deliveryDone       = []byte("done")
+)
+
+// Deduplicator skips webhook deliveries that were already received, by this
+// server or by another server sharing the state store. GitHub redelivers
+// webhooks, load balancers retry requests, and message queues deliver
+// messages more than once, and processing a delivery twice can comment or
+// update a pull request twice. It is the only deduplication of deliveries,
+// whether they are received over HTTP or from a message queue.
+type Deduplicator struct {
+	Store state.Store
+	TTL   time.Duration
+}
+
+// Wrap returns a handler that only passes the first delivery with each ID to
+// h. If h fails, the ID is forgotten so that the delivery can be retried.
+func (d *Deduplicator) Wrap(h githubapp.EventHandler) githubapp.EventHandler {
+	return &dedupHandler{EventHandler: h, dedup: d}
+}
+
+type dedupHandler struct {
+	githubapp.EventHandler
+	dedup *Deduplicator
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	if deliveryID == "" {
+		return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+	}
+
+	logger := zerolog.Ctx(ctx)
+	key := deliveryPrefix + deliveryID
+
+	claimed, err := h.dedup.Store.SetIfAbsent(ctx, key, deliveryProcessing, deliveryClaimTTL)
+	switch {
+	case err != nil:
+		logger.Error().Err(err).Msg("Failed to check for duplicate delivery, handling it anyway")
+		return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+	case !claimed:
+		value, _, err := h.dedup.Store.Get(ctx, key)
+		if err != nil {
+			return errors.Wrap(err, "failed to check for duplicate delivery")
+		}
+		// message queues redeliver the message later, in case the server
+		// handling the delivery fails
+		if bytes.Equal(value, deliveryProcessing) && isInline(ctx) {
+			return errors.Errorf("delivery %s is being handled by another server", deliveryID)
+		}
+		logger.Info().Msgf("Skipping duplicate delivery %s", deliveryID)
+		return nil
+	}
+
+	if err := h.EventHandler.Handle(ctx, eventType, deliveryID, payload); err != nil {
+		if _, derr := h.dedup.Store.CompareAndDelete(ctx, key, deliveryProcessing); derr != nil {
+			logger.Error().Err(derr).Msg("Failed to forget failed delivery")
+		}
+		return err
+	}
+
+	ttl := h.dedup.TTL
+	if ttl <= 0 {
+		ttl = DefaultDeliveryDedupTTL
+	}
+	if err := h.dedup.Store.Set(ctx, key, deliveryDone, ttl); err != nil {
+		logger.Error().Err(err).Msg("Failed to record handled delivery")
+	}
+	return nil
+}
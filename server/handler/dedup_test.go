@@ -0,0 +1,87 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+type failingHandler struct {
+	handled []string
+	err     error
+}
+
+func (h *failingHandler) Handles() []string {
+	return []string{"pull_request"}
+}
+
+func (h *failingHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h.handled = append(h.handled, deliveryID)
+	return h.err
+}
+
+func TestDeduplicator(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore()
+	h := &failingHandler{}
+	wrapped := (&Deduplicator{Store: store}).Wrap(h)
+
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "d1", nil))
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "d1", nil))
+	assert.Equal(t, []string{"d1"}, h.handled, "duplicate deliveries are skipped")
+
+	h.err = errors.New("failed")
+	assert.Error(t, wrapped.Handle(ctx, "pull_request", "d2", nil))
+
+	h.err = nil
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "d2", nil))
+	assert.Equal(t, []string{"d1", "d2", "d2"}, h.handled, "failed deliveries are handled again")
+
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "", nil))
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "", nil))
+	assert.Equal(t, []string{"d1", "d2", "d2", "", ""}, h.handled, "deliveries without IDs are always handled")
+}
+
+func TestDeduplicatorInProgress(t *testing.T) {
+	ctx := context.Background()
+	store := state.NewMemoryStore()
+	h := &failingHandler{}
+	wrapped := (&Deduplicator{Store: store}).Wrap(h)
+
+	// another server claimed the delivery but has not finished it
+	_, err := store.SetIfAbsent(ctx, deliveryPrefix+"d1", deliveryProcessing, time.Minute)
+	require.NoError(t, err)
+
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "d1", nil), "webhooks are skipped")
+	assert.Error(t, wrapped.Handle(WithInline(ctx), "pull_request", "d1", nil), "queued messages are delivered again")
+	assert.Empty(t, h.handled)
+
+	require.NoError(t, store.Delete(ctx, deliveryPrefix+"d1"))
+	require.NoError(t, wrapped.Handle(WithInline(ctx), "pull_request", "d1", nil))
+	assert.Equal(t, []string{"d1"}, h.handled)
+
+	value, ok, err := store.Get(ctx, deliveryPrefix+"d1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, deliveryDone, value, "handled deliveries are recorded after they succeed")
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/scm"
+)
+
+// giteaEvent is the subset of Gitea pull request, review, comment, and
+// status webhook payloads that identifies the pull requests.
+type giteaEvent struct {
+	Repository struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+	Action      string `json:"action"`
+	PullRequest *struct {
+		Number int    `json:"number"`
+		State  string `json:"state"`
+		Head   struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Issue *struct {
+		Number      int         `json:"number"`
+		State       string      `json:"state"`
+		PullRequest interface{} `json:"pull_request"`
+	} `json:"issue"`
+	SHA string `json:"sha"`
+}
+
+// GiteaWebhook returns a handler for webhooks from a Gitea or Forgejo server.
+// Pull requests affected by pull request, review, comment, and status
+// events are evaluated in the background with the configuration on their
+// base branch.
+func (b *Base) GiteaWebhook(provider *scm.Gitea, secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := zerolog.Ctx(r.Context())
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxProviderPayload))
+		if err != nil {
+			http.Error(w, "failed to read payload", http.StatusBadRequest)
+			return
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		_, _ = mac.Write(body)
+		signature, err := hex.DecodeString(r.Header.Get("X-Gitea-Signature"))
+		if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var event giteaEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		owner, repo := event.Repository.Owner.Login, event.Repository.Name
+		eventType := r.Header.Get("X-Gitea-Event")
+
+		eventLogger := logger.With().Str("gitea_event", eventType).Str("gitea_repository", owner+"/"+repo).Logger()
+		ctx := eventLogger.WithContext(b.withServices(context.Background()))
+
+		if eventType == "pull_request" && event.Action == "synchronized" && event.PullRequest != nil {
+			bulldozer.RecordPush(ctx, owner, repo, event.PullRequest.Head.SHA, time.Now())
+		}
+
+		b.Operations.Go(func() {
+			logger := zerolog.Ctx(ctx)
+
+			numbers, err := giteaPullRequests(ctx, provider, eventType, event)
+			if err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msg("Failed to determine pull requests of event")
+				return
+			}
+			for _, number := range numbers {
+				logger := logger.With().Int("gitea_pull_request", number).Logger()
+				if err := b.processProviderPR(logger.WithContext(ctx), provider, owner, repo, number); err != nil {
+					logger.Error().Err(errors.WithStack(err)).Msg("Error processing pull request")
+				}
+			}
+		})
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// giteaPullRequests returns the open pull requests affected by the event.
+func giteaPullRequests(ctx context.Context, provider *scm.Gitea, eventType string, event giteaEvent) ([]int, error) {
+	switch {
+	case eventType == "status":
+		return provider.OpenPullRequestsForSHA(ctx, event.Repository.Owner.Login, event.Repository.Name, event.SHA)
+	case eventType == "issue_comment":
+		if event.Issue != nil && event.Issue.PullRequest != nil && event.Issue.State == "open" {
+			return []int{event.Issue.Number}, nil
+		}
+	case strings.HasPrefix(eventType, "pull_request"):
+		if event.PullRequest != nil && event.PullRequest.State == "open" {
+			return []int{event.PullRequest.Number}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/scm"
+)
+
+// maxProviderPayload limits the size of webhook payloads from providers other
+// than GitHub
+const maxProviderPayload = 25 << 20
+
+// gitlabEvent is the subset of GitLab merge request, note, and pipeline
+// webhook payloads that identifies the merge request.
+type gitlabEvent struct {
+	ObjectKind string `json:"object_kind"`
+	Project    struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID        int    `json:"iid"`
+		State      string `json:"state"`
+		Action     string `json:"action"`
+		OldRev     string `json:"oldrev"`
+		LastCommit struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+	MergeRequest *struct {
+		IID   int    `json:"iid"`
+		State string `json:"state"`
+	} `json:"merge_request"`
+}
+
+// mergeRequest returns the merge request of the event, or zero if the event
+// does not affect an open merge request.
+func (e gitlabEvent) mergeRequest() int {
+	switch e.ObjectKind {
+	case "merge_request":
+		if e.ObjectAttributes.State == "opened" {
+			return e.ObjectAttributes.IID
+		}
+	case "note", "pipeline":
+		if e.MergeRequest != nil && e.MergeRequest.State == "opened" {
+			return e.MergeRequest.IID
+		}
+	}
+	return 0
+}
+
+// pushedSHA returns the new head of the merge request if the event reports a
+// push to its source branch.
+func (e gitlabEvent) pushedSHA() string {
+	if e.ObjectKind == "merge_request" && e.ObjectAttributes.Action == "update" && e.ObjectAttributes.OldRev != "" {
+		return e.ObjectAttributes.LastCommit.ID
+	}
+	return ""
+}
+
+// GitLabWebhook returns a handler for merge request, comment, and pipeline
+// webhooks from a GitLab server. Each affected merge request is evaluated in
+// the background with the configuration on its target branch.
+func (b *Base) GitLabWebhook(provider *scm.GitLab, secret string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := zerolog.Ctx(r.Context())
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxProviderPayload))
+		if err != nil {
+			http.Error(w, "failed to read payload", http.StatusBadRequest)
+			return
+		}
+
+		var event gitlabEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		path := event.Project.PathWithNamespace
+		i := strings.LastIndex(path, "/")
+		number := event.mergeRequest()
+		if i < 0 || number == 0 {
+			logger.Debug().Msgf("Doing nothing since %s event affects no open merge request", event.ObjectKind)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		owner, repo := path[:i], path[i+1:]
+
+		mrLogger := logger.With().Str("gitlab_project", path).Int("gitlab_merge_request", number).Logger()
+		ctx := mrLogger.WithContext(b.withServices(context.Background()))
+
+		if sha := event.pushedSHA(); sha != "" {
+			bulldozer.RecordPush(ctx, owner, repo, sha, time.Now())
+		}
+
+		b.Operations.Go(func() {
+			if err := b.processProviderPR(ctx, provider, owner, repo, number); err != nil {
+				zerolog.Ctx(ctx).Error().Err(errors.WithStack(err)).Msg("Error processing merge request")
+			}
+		})
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// processProviderPR evaluates and merges or updates a pull request of a
+// provider other than GitHub, holding its lock.
+func (b *Base) processProviderPR(ctx context.Context, provider scm.Provider, owner, repo string, number int) error {
+	unlock, err := b.lock(ctx, fmt.Sprintf("pr/%s/%s/%s#%d", provider.Name(), owner, repo, number))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return bulldozer.ProcessProviderPR(ctx, provider, b.ConfigFetcher, owner, repo, number)
+}
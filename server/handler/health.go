@@ -15,16 +15,34 @@
 package handler
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 
+	"github.com/palantir/bulldozer/state"
 	"github.com/palantir/bulldozer/version"
 )
 
+// readinessTimeout limits the time spent checking each dependency.
+const readinessTimeout = 5 * time.Second
+
 type HealthCheck struct {
 	Status  string `json:"status"`
 	Version string `json:"version"`
+
+	// Checks maps the name of each readiness check to "ok" or its error
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// ReadinessCheck returns an error if a dependency of the server is not ready.
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
 }
 
 func Health() http.Handler {
@@ -32,3 +50,89 @@ func Health() http.Handler {
 		baseapp.WriteJSON(w, http.StatusOK, &HealthCheck{Status: "ok", Version: version.GetVersion()})
 	})
 }
+
+// Live reports that the server is running. It does not check dependencies,
+// so a failure means the process should be restarted.
+func Live() http.Handler {
+	return Health()
+}
+
+// Ready reports whether every check passes, responding with 503 Service
+// Unavailable if any check fails.
+func Ready(checks ...ReadinessCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := zerolog.Ctx(r.Context())
+
+		result := &HealthCheck{Status: "ok", Version: version.GetVersion(), Checks: make(map[string]string)}
+		for _, c := range checks {
+			ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+			err := c.Check(ctx)
+			cancel()
+
+			if err != nil {
+				logger.Warn().Err(err).Msgf("Readiness check %s failed", c.Name)
+				result.Status = "unavailable"
+				result.Checks[c.Name] = err.Error()
+			} else {
+				result.Checks[c.Name] = "ok"
+			}
+		}
+
+		status := http.StatusOK
+		if result.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		baseapp.WriteJSON(w, status, result)
+	})
+}
+
+// GithubAppCheck verifies that the server can authenticate as the GitHub App.
+func GithubAppCheck(cc githubapp.ClientCreator) ReadinessCheck {
+	return ReadinessCheck{
+		Name: "github_app",
+		Check: func(ctx context.Context) error {
+			client, err := cc.NewAppClient()
+			if err != nil {
+				return errors.Wrap(err, "failed to instantiate github app client")
+			}
+			if _, _, err := client.Apps.Get(ctx, ""); err != nil {
+				return errors.Wrap(err, "failed to authenticate as github app")
+			}
+			return nil
+		},
+	}
+}
+
+// WebhookSecretCheck verifies that a webhook secret is configured.
+func WebhookSecretCheck(secret string) ReadinessCheck {
+	return ReadinessCheck{
+		Name: "webhook_secret",
+		Check: func(ctx context.Context) error {
+			if secret == "" {
+				return errors.New("webhook secret is not configured")
+			}
+			return nil
+		},
+	}
+}
+
+// StateStoreCheck verifies that the store can write and read a key.
+func StateStoreCheck(store state.Store) ReadinessCheck {
+	return ReadinessCheck{
+		Name: "state_store",
+		Check: func(ctx context.Context) error {
+			const key = "health/ready"
+			if err := store.Set(ctx, key, []byte(time.Now().UTC().Format(time.RFC3339)), time.Minute); err != nil {
+				return errors.Wrap(err, "failed to write to state store")
+			}
+			_, ok, err := store.Get(ctx, key)
+			if err != nil {
+				return errors.Wrap(err, "failed to read from state store")
+			}
+			if !ok {
+				return errors.New("state store lost a written key")
+			}
+			return nil
+		},
+	}
+}
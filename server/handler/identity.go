@@ -0,0 +1,66 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+)
+
+// AppIdentity finds and remembers the login of the bot user of the GitHub
+// App, which authors the comments bulldozer writes.
+type AppIdentity struct {
+	ClientCreator githubapp.ClientCreator
+
+	lock  sync.Mutex
+	login string
+}
+
+// Login returns the login of the bot user of the app, such as
+// "bulldozer[bot]". It is looked up until the first lookup succeeds.
+func (i *AppIdentity) Login(ctx context.Context) (string, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.login != "" {
+		return i.login, nil
+	}
+
+	client, err := i.ClientCreator.NewAppClient()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to instantiate github app client")
+	}
+
+	// the vendored client does not expose the slug of the app
+	req, err := client.NewRequest("GET", "app", nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create app request")
+	}
+	var app struct {
+		Slug string `json:"slug"`
+	}
+	if _, err := client.Do(ctx, req, &app); err != nil {
+		return "", errors.Wrap(err, "failed to get github app")
+	}
+	if app.Slug == "" {
+		return "", errors.New("github app has no slug")
+	}
+
+	i.login = app.Slug + "[bot]"
+	return i.login, nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	installationStatsPrefix = "installation-stats/"
+
+	statEvents   = "events"
+	statFailures = "failures"
+	statMerges   = "merges"
+	statUpdates  = "updates"
+)
+
+// InstallationStats counts the events, failures, merges, and updates of each
+// installation, identified by its owner. Counts are kept in the state store,
+// so servers that share a store report the same totals. It is an audit.Sink
+// for merges and updates and wraps event handlers for events and failures.
+type InstallationStats struct {
+	Store state.Store
+}
+
+// InstallationStatus is the JSON form of the statistics of an installation.
+type InstallationStatus struct {
+	Owner      string           `json:"owner"`
+	Events     int64            `json:"events"`
+	Failures   int64            `json:"failures"`
+	Merges     int64            `json:"merges"`
+	Updates    int64            `json:"updates"`
+	QueueDepth int              `json:"queue_depth"`
+	RateLimit  *RateLimitStatus `json:"rate_limit,omitempty"`
+}
+
+// Wrap returns a handler that counts the deliveries handled by h and the
+// deliveries that failed.
+func (s *InstallationStats) Wrap(h githubapp.EventHandler) githubapp.EventHandler {
+	return &statsHandler{EventHandler: h, stats: s}
+}
+
+type statsHandler struct {
+	githubapp.EventHandler
+	stats *InstallationStats
+}
+
+func (h *statsHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	err := h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+
+	var event struct {
+		Repository struct {
+			Owner struct {
+				Login string `json:"login"`
+			} `json:"owner"`
+		} `json:"repository"`
+		Installation struct {
+			Account struct {
+				Login string `json:"login"`
+			} `json:"account"`
+		} `json:"installation"`
+	}
+	_ = json.Unmarshal(payload, &event)
+
+	owner := event.Repository.Owner.Login
+	if owner == "" {
+		owner = event.Installation.Account.Login
+	}
+	if owner != "" {
+		h.stats.increment(ctx, owner, statEvents)
+		if err != nil {
+			h.stats.increment(ctx, owner, statFailures)
+		}
+	}
+	return err
+}
+
+func (s *InstallationStats) Record(ctx context.Context, event audit.Event) error {
+	switch {
+	case event.Type == audit.TypeMerge && event.Result == audit.ResultMerged:
+		s.increment(ctx, event.Owner, statMerges)
+	case event.Type == audit.TypeUpdate && event.Result == audit.ResultUpdated:
+		s.increment(ctx, event.Owner, statUpdates)
+	}
+	return nil
+}
+
+func (s *InstallationStats) increment(ctx context.Context, owner, stat string) {
+	if _, err := s.Store.Increment(ctx, installationStatsPrefix+owner+"/"+stat, 0); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msgf("Failed to count %s of %s", stat, owner)
+	}
+}
+
+// Counts returns the counts of each owner.
+func (s *InstallationStats) Counts(ctx context.Context) (map[string]*InstallationStatus, error) {
+	keys, err := s.Store.Keys(ctx, installationStatsPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list installation statistics")
+	}
+
+	counts := make(map[string]*InstallationStatus)
+	for _, key := range keys {
+		parts := strings.SplitN(strings.TrimPrefix(key, installationStatsPrefix), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		value, ok, err := s.Store.Get(ctx, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get %s", key)
+		}
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseInt(string(value), 10, 64)
+
+		status := statusFor(counts, parts[0])
+		switch parts[1] {
+		case statEvents:
+			status.Events = n
+		case statFailures:
+			status.Failures = n
+		case statMerges:
+			status.Merges = n
+		case statUpdates:
+			status.Updates = n
+		}
+	}
+	return counts, nil
+}
+
+func statusFor(counts map[string]*InstallationStatus, owner string) *InstallationStatus {
+	status, ok := counts[owner]
+	if !ok {
+		status = &InstallationStatus{Owner: owner}
+		counts[owner] = status
+	}
+	return status
+}
+
+// InstallationStatsHandler serves the statistics of every installation as
+// JSON, with the number of pull requests in the merge queues and the last
+// observed rate limit of each installation.
+func InstallationStatsHandler(stats *InstallationStats, queues []*bulldozer.MergeQueue, rateLimits []*RateLimits) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counts, err := stats.Counts(r.Context())
+		if err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to get installation statistics")
+			http.Error(w, "failed to get installation statistics", http.StatusInternalServerError)
+			return
+		}
+
+		for _, q := range queues {
+			if q == nil {
+				continue
+			}
+			for _, key := range q.Keys() {
+				owner := strings.SplitN(key, "/", 2)[0]
+				statusFor(counts, owner).QueueDepth += len(q.Entries(key))
+			}
+		}
+		for _, rl := range rateLimits {
+			for owner, status := range rl.Status() {
+				status := status
+				statusFor(counts, owner).RateLimit = &status
+			}
+		}
+
+		installations := make([]*InstallationStatus, 0, len(counts))
+		for _, status := range counts {
+			installations = append(installations, status)
+		}
+		sort.Slice(installations, func(i, j int) bool {
+			return installations[i].Owner < installations[j].Owner
+		})
+
+		baseapp.WriteJSON(w, http.StatusOK, installations)
+	})
+}
@@ -22,7 +22,7 @@ import (
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
 
-	"github.com/palantir/bulldozer/pull"
+	"github.com/palantir/bulldozer/bulldozer"
 )
 
 type IssueComment struct {
@@ -55,7 +55,14 @@ func (h *IssueComment) Handle(ctx context.Context, eventType, deliveryID string,
 	if err != nil {
 		return errors.Wrapf(err, "failed to get pull request %s/%s#%d", owner, repoName, number)
 	}
-	pullCtx := pull.NewGithubContext(client, pr, owner, repoName, number)
+	pullCtx := h.pullContext(ctx, client, pr, owner, repoName, number)
+
+	if command, ok := bulldozer.ParseCommand(event.GetComment().GetBody()); ok && event.GetAction() == "created" {
+		if err := h.RunCommand(ctx, pullCtx, client, pr, command, event.GetComment().GetUser().GetLogin()); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msgf("Error running %q command", command)
+		}
+		return nil
+	}
 
 	if err := h.ProcessPullRequest(ctx, pullCtx, client, pr); err != nil {
 		logger.Error().Err(errors.WithStack(err)).Msg("Error processing pull request")
@@ -0,0 +1,380 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	maintenanceQueue = "maintenance"
+
+	// maintenanceKey holds the state of maintenance mode. If the key does
+	// not exist, maintenance mode is off.
+	maintenanceKey = "maintenance/state"
+
+	maintenanceOn       = "on"
+	maintenanceDraining = "draining"
+
+	// maintenanceLock is held by the server that drains the buffer, so that
+	// buffered deliveries are processed one at a time, in order
+	maintenanceLock = "maintenance-drain"
+
+	// maintenancePollInterval is how often servers check for a buffer to
+	// drain, such as a buffer left by a server that stopped while draining
+	maintenancePollInterval = 5 * time.Second
+)
+
+// Maintenance buffers webhook deliveries in the state store instead of
+// processing them while maintenance mode is on, for example while the state
+// store is migrated. The state of maintenance mode is kept in the store too,
+// so that turning it on through one server stops all servers that share the
+// store. When maintenance ends, one server processes the buffered deliveries
+// in the order they were received. Deliveries that arrive while the buffer
+// is drained are buffered too, so that order is kept.
+type Maintenance struct {
+	Store state.Store
+
+	// Operations tracks the deliveries being drained, so that shutdown can
+	// wait for them. Deliveries that have not started stay in the store.
+	Operations *Operations
+
+	lock     sync.Mutex
+	handlers map[string]githubapp.EventHandler
+	wake     chan struct{}
+}
+
+// MaintenanceStatus is the state of maintenance mode served by the admin
+// endpoints.
+type MaintenanceStatus struct {
+	Enabled  bool `json:"enabled"`
+	Draining bool `json:"draining"`
+	Buffered int  `json:"buffered"`
+}
+
+// Wrap returns a handler that buffers deliveries for h during maintenance.
+func (m *Maintenance) Wrap(h githubapp.EventHandler) githubapp.EventHandler {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.init()
+	for _, eventType := range h.Handles() {
+		if _, ok := m.handlers[eventType]; !ok {
+			m.handlers[eventType] = h
+		}
+	}
+	return &maintenanceHandler{EventHandler: h, maintenance: m}
+}
+
+func (m *Maintenance) init() {
+	if m.handlers == nil {
+		m.handlers = make(map[string]githubapp.EventHandler)
+		m.wake = make(chan struct{}, 1)
+	}
+}
+
+type maintenanceHandler struct {
+	githubapp.EventHandler
+	maintenance *Maintenance
+}
+
+func (h *maintenanceHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	m := h.maintenance
+
+	mode, err := m.mode(ctx)
+	if err != nil {
+		return err
+	}
+	if mode == "" {
+		return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+	}
+
+	b, err := json.Marshal(Delivery{
+		DeliveryID: deliveryID,
+		EventType:  eventType,
+		Payload:    json.RawMessage(payload),
+		ReceivedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal delivery")
+	}
+	if err := m.Store.Enqueue(ctx, maintenanceQueue, b); err != nil {
+		return errors.Wrapf(err, "failed to buffer delivery %s", deliveryID)
+	}
+
+	zerolog.Ctx(ctx).Debug().Msgf("Buffered delivery %s during maintenance", deliveryID)
+	return nil
+}
+
+// mode returns maintenanceOn, maintenanceDraining, or an empty string if
+// maintenance mode is off.
+func (m *Maintenance) mode(ctx context.Context) (string, error) {
+	b, ok, err := m.Store.Get(ctx, maintenanceKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get maintenance state")
+	}
+	if !ok {
+		return "", nil
+	}
+	return string(b), nil
+}
+
+// Enable starts buffering deliveries on all servers that share the store.
+func (m *Maintenance) Enable(ctx context.Context) error {
+	return errors.Wrap(m.Store.Set(ctx, maintenanceKey, []byte(maintenanceOn), 0), "failed to enable maintenance mode")
+}
+
+// Disable ends maintenance. The buffered deliveries are processed in the
+// background by one of the servers that share the store; Disable returns
+// immediately.
+func (m *Maintenance) Disable(ctx context.Context) error {
+	mode, err := m.mode(ctx)
+	if err != nil || mode != maintenanceOn {
+		return err
+	}
+	if err := m.Store.Set(ctx, maintenanceKey, []byte(maintenanceDraining), 0); err != nil {
+		return errors.Wrap(err, "failed to disable maintenance mode")
+	}
+
+	m.lock.Lock()
+	m.init()
+	m.lock.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Status returns the current state and the number of buffered deliveries.
+func (m *Maintenance) Status(ctx context.Context) (MaintenanceStatus, error) {
+	mode, err := m.mode(ctx)
+	if err != nil {
+		return MaintenanceStatus{}, err
+	}
+	n, err := m.Store.QueueLength(ctx, maintenanceQueue)
+	if err != nil {
+		return MaintenanceStatus{}, errors.Wrap(err, "failed to count buffered deliveries")
+	}
+	return MaintenanceStatus{
+		Enabled:  mode == maintenanceOn,
+		Draining: mode == maintenanceDraining,
+		Buffered: n,
+	}, nil
+}
+
+// Start drains the buffer when maintenance ends, including buffers left by
+// a previous run, until the context is canceled. It returns immediately.
+func (m *Maintenance) Start(ctx context.Context) {
+	m.lock.Lock()
+	m.init()
+	m.lock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(maintenancePollInterval)
+		defer ticker.Stop()
+
+		for {
+			m.check(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-m.wake:
+			}
+		}
+	}()
+}
+
+// check drains the buffer if maintenance mode is not on and no other server
+// is draining it.
+func (m *Maintenance) check(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	mode, err := m.mode(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to check maintenance mode")
+		return
+	}
+	switch mode {
+	case maintenanceOn:
+		return
+	case "":
+		// deliveries are left in the buffer by a server that stopped while
+		// draining, or buffered by a server that saw maintenance mode as the
+		// buffer was drained
+		n, err := m.Store.QueueLength(ctx, maintenanceQueue)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to count buffered deliveries")
+			return
+		}
+		if n == 0 {
+			return
+		}
+		if ok, err := m.Store.SetIfAbsent(ctx, maintenanceKey, []byte(maintenanceDraining), 0); err != nil || !ok {
+			return
+		}
+	}
+
+	release, ok, err := state.TryLock(ctx, m.Store, maintenanceLock, workClaimTTL)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to lock the maintenance buffer")
+		return
+	}
+	if !ok {
+		return
+	}
+	defer release()
+
+	m.drain(ctx)
+}
+
+func (m *Maintenance) drain(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+	logger.Info().Msg("Processing deliveries buffered during maintenance")
+
+	for ctx.Err() == nil {
+		// maintenance may start again while draining
+		mode, err := m.mode(ctx)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to check maintenance mode")
+			return
+		}
+		if mode != maintenanceDraining {
+			return
+		}
+
+		id, b, ok, err := m.Store.Dequeue(ctx, maintenanceQueue, workClaimTTL)
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to take delivery from the maintenance buffer")
+			return
+		}
+		if !ok {
+			if _, err := m.Store.CompareAndDelete(ctx, maintenanceKey, []byte(maintenanceDraining)); err != nil {
+				logger.Error().Err(err).Msg("Failed to end maintenance mode")
+				return
+			}
+			logger.Info().Msg("Finished processing buffered deliveries")
+			return
+		}
+
+		// processing continues after ctx is canceled, so that shutdown
+		// does not interrupt a merge or update
+		processCtx := logger.WithContext(context.Background())
+		if !m.Operations.Run(func() { m.process(processCtx, id, b) }) {
+			return
+		}
+	}
+}
+
+func (m *Maintenance) process(ctx context.Context, id string, b []byte) {
+	logger := zerolog.Ctx(ctx)
+
+	var d Delivery
+	if err := json.Unmarshal(b, &d); err != nil {
+		logger.Error().Err(err).Msgf("Discarding invalid buffered delivery %s", id)
+	} else {
+		m.lock.Lock()
+		h, ok := m.handlers[d.EventType]
+		m.lock.Unlock()
+
+		if ok {
+			dlogger := logger.With().
+				Str(githubapp.LogKeyEventType, d.EventType).
+				Str(githubapp.LogKeyDeliveryID, d.DeliveryID).
+				Logger()
+
+			dlogger.Debug().Msgf("Processing delivery buffered for %s", time.Since(d.ReceivedAt))
+			if err := h.Handle(dlogger.WithContext(ctx), d.EventType, d.DeliveryID, d.Payload); err != nil {
+				dlogger.Error().Err(errors.WithStack(err)).Msg("Unexpected error handling buffered webhook")
+			}
+		}
+	}
+
+	if err := m.Store.Ack(ctx, maintenanceQueue, id); err != nil {
+		logger.Error().Err(err).Msgf("Failed to remove buffered delivery %s", id)
+	}
+}
+
+// MaintenanceStatusHandler serves the maintenance status of the first
+// Maintenance as JSON, with the buffered deliveries of all of them.
+func MaintenanceStatusHandler(ms ...*Maintenance) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status MaintenanceStatus
+		for i, m := range ms {
+			s, err := m.Status(r.Context())
+			if err != nil {
+				zerolog.Ctx(r.Context()).Error().Err(err).Msg("Failed to get maintenance status")
+				http.Error(w, "failed to get maintenance status", http.StatusInternalServerError)
+				return
+			}
+			if i == 0 {
+				status.Enabled, status.Draining = s.Enabled, s.Draining
+			}
+			status.Buffered += s.Buffered
+		}
+		baseapp.WriteJSON(w, http.StatusOK, status)
+	})
+}
+
+// EnableMaintenance starts buffering webhook deliveries.
+func EnableMaintenance(ms ...*Maintenance) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := zerolog.Ctx(r.Context())
+		for _, m := range ms {
+			if err := m.Enable(r.Context()); err != nil {
+				logger.Error().Err(err).Msg("Failed to enable maintenance mode")
+				http.Error(w, "failed to enable maintenance mode", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		user, _, _ := r.BasicAuth()
+		logger.Warn().Msgf("Maintenance mode enabled by %s", user)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// DisableMaintenance ends maintenance mode and processes the buffered
+// deliveries in the background.
+func DisableMaintenance(ms ...*Maintenance) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := zerolog.Ctx(r.Context())
+		for _, m := range ms {
+			if err := m.Disable(r.Context()); err != nil {
+				logger.Error().Err(err).Msg("Failed to disable maintenance mode")
+				http.Error(w, "failed to disable maintenance mode", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		user, _, _ := r.BasicAuth()
+		logger.Warn().Msgf("Maintenance mode disabled by %s", user)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+func TestMaintenance(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := state.NewMemoryStore()
+	h := &recordingHandler{handled: make(chan string, 3)}
+
+	// two servers share the store
+	m := &Maintenance{Store: store, Operations: &Operations{}}
+	wrapped := m.Wrap(h)
+	other := &Maintenance{Store: store, Operations: &Operations{}}
+	otherWrapped := other.Wrap(h)
+
+	require.NoError(t, m.Enable(ctx))
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "delivery-1", []byte(`{}`)))
+	require.NoError(t, otherWrapped.Handle(ctx, "pull_request", "delivery-2", []byte(`{}`)))
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "delivery-3", []byte(`{}`)))
+	assert.Len(t, h.handled, 0, "deliveries are buffered on every server")
+
+	status, err := other.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, MaintenanceStatus{Enabled: true, Buffered: 3}, status)
+
+	other.Start(ctx)
+	require.NoError(t, other.Disable(ctx))
+
+	for _, id := range []string{"delivery-1", "delivery-2", "delivery-3"} {
+		select {
+		case handled := <-h.handled:
+			assert.Equal(t, id, handled)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivery %s was not processed", id)
+		}
+	}
+
+	// maintenance ends when the buffer is drained
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		status, err = m.Status(ctx)
+		require.NoError(t, err)
+		if status == (MaintenanceStatus{}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("maintenance did not end: %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	require.NoError(t, other.Operations.Drain(context.Background()))
+
+	require.NoError(t, wrapped.Handle(context.Background(), "pull_request", "delivery-4", []byte(`{}`)))
+	assert.Equal(t, "delivery-4", <-h.handled, "deliveries are processed after maintenance")
+}
+
+func TestMaintenanceLeftoverBuffer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := state.NewMemoryStore()
+	h := &recordingHandler{handled: make(chan string, 1)}
+
+	// a server stopped before draining its buffer
+	require.NoError(t, store.Enqueue(ctx, maintenanceQueue, []byte(`{"delivery_id": "delivery-1", "event_type": "pull_request", "payload": {}}`)))
+
+	m := &Maintenance{Store: store, Operations: &Operations{}}
+	m.Wrap(h)
+	m.Start(ctx)
+
+	select {
+	case handled := <-h.handled:
+		assert.Equal(t, "delivery-1", handled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("buffered delivery was not processed")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Operations tracks merges, updates, and other operations that run in the
+// background, so that the server can wait for them to finish before it
+// stops. A nil Operations runs every operation without tracking it.
+type Operations struct {
+	lock     sync.Mutex
+	wg       sync.WaitGroup
+	draining bool
+}
+
+// Run runs the operation and returns true, unless the server is draining,
+// in which case the operation is skipped and Run returns false. Skipped
+// operations are retried by later events, sweeps, or the next server.
+func (o *Operations) Run(op func()) bool {
+	if o == nil {
+		op()
+		return true
+	}
+
+	o.lock.Lock()
+	if o.draining {
+		o.lock.Unlock()
+		return false
+	}
+	o.wg.Add(1)
+	o.lock.Unlock()
+
+	defer o.wg.Done()
+	op()
+	return true
+}
+
+// Go is like Run, but runs the operation in a new goroutine. It returns false
+// if the operation was skipped because the server is draining.
+func (o *Operations) Go(op func()) bool {
+	if o == nil {
+		go op()
+		return true
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.draining {
+		return false
+	}
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		op()
+	}()
+	return true
+}
+
+// Drain stops new operations from starting and waits for the running
+// operations to finish or for the context to be done.
+func (o *Operations) Drain(ctx context.Context) error {
+	o.lock.Lock()
+	o.draining = true
+	o.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "operations did not finish before the deadline")
+	}
+}
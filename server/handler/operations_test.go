@@ -0,0 +1,56 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationsDrain(t *testing.T) {
+	o := &Operations{}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	o.Go(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, o.Drain(ctx), "draining waits for running operations")
+
+	ran := false
+	assert.False(t, o.Run(func() { ran = true }), "operations are skipped while draining")
+	o.Go(func() { ran = true })
+
+	close(release)
+	require.NoError(t, o.Drain(context.Background()))
+	assert.False(t, ran)
+}
+
+func TestNilOperations(t *testing.T) {
+	var o *Operations
+
+	ran := false
+	assert.True(t, o.Run(func() { ran = true }))
+	assert.True(t, ran, "nil operations run without tracking")
+}
@@ -0,0 +1,366 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+)
+
+const (
+	MetricsKeyWebhookQueueDepth = "bulldozer.webhooks.queue_depth"
+	MetricsKeyWebhooksDropped   = "bulldozer.webhooks.dropped"
+	MetricsKeyMergesWaiting     = "bulldozer.merges.waiting"
+	MetricsKeyMergesDropped     = "bulldozer.merges.dropped"
+)
+
+// OverflowPolicy decides what happens to work that arrives when a queue is
+// full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock waits until the queue has room
+	OverflowBlock OverflowPolicy = "block"
+
+	// OverflowDrop discards the work and increments a counter
+	OverflowDrop OverflowPolicy = "drop"
+)
+
+func (p OverflowPolicy) Valid() bool {
+	switch p {
+	case "", OverflowBlock, OverflowDrop:
+		return true
+	}
+	return false
+}
+
+// ErrQueueFull is returned when work is dropped because its queue is full.
+var ErrQueueFull = errors.New("queue is full")
+
+// ErrDraining is returned when a delivery is not handled because the server
+// is shutting down.
+var ErrDraining = errors.New("server is shutting down")
+
+type inlineCtxKey struct{}
+
+// WithInline returns a context in which the WebhookPool and the WorkQueue
+// handle deliveries before returning, instead of in the background. Callers
+// that act on the result, like consumers that acknowledge a message only
+// after it is handled, use it to learn whether handling succeeded.
+func WithInline(ctx context.Context) context.Context {
+	return context.WithValue(ctx, inlineCtxKey{}, true)
+}
+
+func isInline(ctx context.Context) bool {
+	inline, _ := ctx.Value(inlineCtxKey{}).(bool)
+	return inline
+}
+
+// handleInline handles a delivery in the calling goroutine, tracked by ops.
+func handleInline(ctx context.Context, ops *Operations, h githubapp.EventHandler, eventType, deliveryID string, payload []byte) error {
+	var err error
+	if !ops.Run(func() { err = h.Handle(ctx, eventType, deliveryID, payload) }) {
+		return errors.Wrapf(ErrDraining, "delivery %s was not handled", deliveryID)
+	}
+	return err
+}
+
+// WebhookPool processes webhook deliveries with a fixed number of workers
+// after they are acknowledged, instead of in the request that delivered them.
+// Deliveries wait in a queue of QueueSize; when it is full, the Overflow
+// policy either holds the request until there is room or drops the delivery.
+// When the pool stops, the workers handle the deliveries left in the queue
+// before they exit; deliveries are lost if the server stops before that, so
+// use the WorkQueue to keep them.
+type WebhookPool struct {
+	Workers   int
+	QueueSize int
+	Overflow  OverflowPolicy
+
+	Registry   metrics.Registry
+	Operations *Operations
+
+	once    sync.Once
+	work    chan webhookTask
+	running sync.WaitGroup
+}
+
+type webhookTask struct {
+	ctx        context.Context
+	handler    githubapp.EventHandler
+	eventType  string
+	deliveryID string
+	payload    []byte
+}
+
+func (p *WebhookPool) init() {
+	p.once.Do(func() {
+		p.work = make(chan webhookTask, p.QueueSize)
+	})
+}
+
+// Wrap returns a handler that queues deliveries for h in the pool.
+func (p *WebhookPool) Wrap(h githubapp.EventHandler) githubapp.EventHandler {
+	p.init()
+	return &pooledHandler{EventHandler: h, pool: p}
+}
+
+type pooledHandler struct {
+	githubapp.EventHandler
+	pool *WebhookPool
+}
+
+func (h *pooledHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	if isInline(ctx) {
+		return handleInline(ctx, h.pool.Operations, h.EventHandler, eventType, deliveryID, payload)
+	}
+
+	task := webhookTask{
+		// processing continues after the request finishes
+		ctx:        zerolog.Ctx(ctx).WithContext(context.Background()),
+		handler:    h.EventHandler,
+		eventType:  eventType,
+		deliveryID: deliveryID,
+		payload:    payload,
+	}
+
+	select {
+	case h.pool.work <- task:
+		h.pool.updateDepth()
+		return nil
+	default:
+	}
+
+	if h.pool.Overflow == OverflowDrop {
+		if h.pool.Registry != nil {
+			metrics.GetOrRegisterCounter(MetricsKeyWebhooksDropped, h.pool.Registry).Inc(1)
+		}
+		return errors.Wrapf(ErrQueueFull, "dropped delivery %s", deliveryID)
+	}
+
+	select {
+	case h.pool.work <- task:
+		h.pool.updateDepth()
+		return nil
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "delivery %s was not queued", deliveryID)
+	}
+}
+
+// Start starts the workers, which run until the context is canceled and the
+// queue is empty. It returns immediately.
+func (p *WebhookPool) Start(ctx context.Context) {
+	p.init()
+
+	workers := p.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	p.running.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker(ctx)
+	}
+}
+
+// Wait waits for the workers to exit after the context passed to Start is
+// canceled, or for ctx to be done. It must be called before the Operations of
+// the pool are drained, so that deliveries left in the queue are handled.
+func (p *WebhookPool) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "%d queued webhooks were not handled before the deadline", p.Depth())
+	}
+}
+
+func (p *WebhookPool) worker(ctx context.Context) {
+	defer p.running.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			p.drain()
+			return
+		case task := <-p.work:
+			p.handle(task)
+		}
+	}
+}
+
+// drain handles the deliveries left in the queue when the pool stops.
+func (p *WebhookPool) drain() {
+	for {
+		select {
+		case task := <-p.work:
+			p.handle(task)
+		default:
+			return
+		}
+	}
+}
+
+func (p *WebhookPool) handle(task webhookTask) {
+	p.updateDepth()
+	p.Operations.Run(func() {
+		if err := task.handler.Handle(task.ctx, task.eventType, task.deliveryID, task.payload); err != nil {
+			zerolog.Ctx(task.ctx).Error().Err(errors.WithStack(err)).Msgf("Unexpected error handling webhook %s", task.deliveryID)
+		}
+	})
+}
+
+// Depth returns the number of deliveries waiting in the queue.
+func (p *WebhookPool) Depth() int {
+	p.init()
+	return len(p.work)
+}
+
+func (p *WebhookPool) updateDepth() {
+	if p.Registry != nil {
+		metrics.GetOrRegisterGauge(MetricsKeyWebhookQueueDepth, p.Registry).Update(int64(len(p.work)))
+	}
+}
+
+// MergeLimiter limits the number of merges that run at the same time on the
+// server and in each repository. Merges wait for a free slot; if QueueSize
+// merges are already waiting and the Overflow policy is OverflowDrop, new
+// merges are dropped and retried on the next event for the pull request. A
+// nil MergeLimiter does not limit merges.
+type MergeLimiter struct {
+	Registry metrics.Registry
+
+	max        int
+	maxPerRepo int
+	queueSize  int
+	overflow   OverflowPolicy
+
+	lock    sync.Mutex
+	running int
+	byRepo  map[string]int
+	waiting int
+	changed chan struct{}
+}
+
+// NewMergeLimiter creates a limiter. Non-positive limits are unlimited.
+func NewMergeLimiter(max, maxPerRepo, queueSize int, overflow OverflowPolicy) *MergeLimiter {
+	return &MergeLimiter{
+		max:        max,
+		maxPerRepo: maxPerRepo,
+		queueSize:  queueSize,
+		overflow:   overflow,
+		byRepo:     make(map[string]int),
+		changed:    make(chan struct{}),
+	}
+}
+
+// Acquire waits for a free slot in the repository and returns a function
+// that releases it.
+func (l *MergeLimiter) Acquire(ctx context.Context, repo string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	l.lock.Lock()
+	if !l.available(repo) && l.overflow == OverflowDrop && l.queueSize > 0 && l.waiting >= l.queueSize {
+		l.lock.Unlock()
+		if l.Registry != nil {
+			metrics.GetOrRegisterCounter(MetricsKeyMergesDropped, l.Registry).Inc(1)
+		}
+		return nil, errors.Wrapf(ErrQueueFull, "dropped merge in %s", repo)
+	}
+
+	l.setWaiting(l.waiting + 1)
+	for !l.available(repo) {
+		changed := l.changed
+		l.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			l.lock.Lock()
+			l.setWaiting(l.waiting - 1)
+			l.lock.Unlock()
+			return nil, errors.Wrap(ctx.Err(), "gave up waiting to merge")
+		}
+		l.lock.Lock()
+	}
+	l.setWaiting(l.waiting - 1)
+	l.running++
+	l.byRepo[repo]++
+	l.lock.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+
+			l.running--
+			if l.byRepo[repo]--; l.byRepo[repo] == 0 {
+				delete(l.byRepo, repo)
+			}
+			close(l.changed)
+			l.changed = make(chan struct{})
+		})
+	}, nil
+}
+
+// MergeLimiterStats is a snapshot of the merges in a MergeLimiter.
+type MergeLimiterStats struct {
+	Running       int            `json:"running"`
+	Waiting       int            `json:"waiting"`
+	RunningByRepo map[string]int `json:"running_by_repo"`
+}
+
+// Stats returns the number of running and waiting merges.
+func (l *MergeLimiter) Stats() MergeLimiterStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	stats := MergeLimiterStats{
+		Running:       l.running,
+		Waiting:       l.waiting,
+		RunningByRepo: make(map[string]int, len(l.byRepo)),
+	}
+	for repo, n := range l.byRepo {
+		stats.RunningByRepo[repo] = n
+	}
+	return stats
+}
+
+// available returns true if a merge can start in the repository. The caller
+// must hold the lock.
+func (l *MergeLimiter) available(repo string) bool {
+	return (l.max <= 0 || l.running < l.max) && (l.maxPerRepo <= 0 || l.byRepo[repo] < l.maxPerRepo)
+}
+
+// setWaiting updates the number of waiting merges. The caller must hold the
+// lock.
+func (l *MergeLimiter) setWaiting(n int) {
+	l.waiting = n
+	if l.Registry != nil {
+		metrics.GetOrRegisterGauge(MetricsKeyMergesWaiting, l.Registry).Update(int64(n))
+	}
+}
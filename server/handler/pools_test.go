@@ -0,0 +1,51 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookPoolDrainsOnStop(t *testing.T) {
+	h := &recordingHandler{handled: make(chan string, 3)}
+	p := &WebhookPool{Workers: 2, QueueSize: 3, Operations: &Operations{}}
+	wrapped := p.Wrap(h)
+
+	for _, id := range []string{"d1", "d2", "d3"} {
+		require.NoError(t, wrapped.Handle(context.Background(), "pull_request", id, []byte(`{}`)))
+	}
+
+	// the pool is stopped before its workers take the queued deliveries
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Start(ctx)
+
+	require.NoError(t, p.Wait(context.Background()))
+	require.NoError(t, p.Operations.Drain(context.Background()))
+	close(h.handled)
+
+	var handled []string
+	for id := range h.handled {
+		handled = append(handled, id)
+	}
+	sort.Strings(handled)
+	assert.Equal(t, []string{"d1", "d2", "d3"}, handled, "queued deliveries are handled before the workers exit")
+	assert.Equal(t, 0, p.Depth())
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/bulldozer"
+)
+
+type PullRequest struct {
+	Base
+}
+
+func (h *PullRequest) Handles() []string {
+	return []string{"pull_request"}
+}
+
+func (h *PullRequest) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event github.PullRequestEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errors.Wrap(err, "failed to parse pull request event payload")
+	}
+
+	repo := event.GetRepo()
+	owner := repo.GetOwner().GetLogin()
+	repoName := repo.GetName()
+	number := event.GetNumber()
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	ctx, logger := githubapp.PreparePRContext(ctx, installationID, repo, number)
+
+	switch event.GetAction() {
+	case "labeled", "ready_for_review", "edited", "closed":
+	case "synchronize":
+		pr := event.GetPullRequest()
+		bulldozer.RecordPush(h.withServices(ctx), owner, repoName, pr.GetHead().GetSHA(), pr.GetUpdatedAt())
+		return nil
+	default:
+		logger.Debug().Msgf("Doing nothing since pull request action was %q", event.GetAction())
+		return nil
+	}
+
+	client, err := h.ClientCreator.NewInstallationClient(installationID)
+	if err != nil {
+		return errors.Wrap(err, "failed to instantiate github client")
+	}
+
+	if event.GetAction() == "closed" {
+		bulldozer.ForgetPauses(h.withServices(ctx), owner, repoName, number)
+		bulldozer.ForgetQueueRemoval(h.withServices(ctx), owner, repoName, number)
+		if event.GetPullRequest().GetMerged() {
+			h.dequeue(ctx, client, event.GetPullRequest(), "success", "This pull request was merged.")
+		} else {
+			h.dequeue(ctx, client, event.GetPullRequest(), "neutral", "This pull request was closed.")
+		}
+		return nil
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repoName, number)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pull request %s/%s#%d", owner, repoName, number)
+	}
+	pullCtx := h.pullContext(ctx, client, pr, owner, repoName, number)
+
+	if err := h.ProcessPullRequest(ctx, pullCtx, client, pr); err != nil {
+		logger.Error().Err(errors.WithStack(err)).Msg("Error processing pull request")
+	}
+
+	return nil
+}
+
+// type assertion
+var _ githubapp.EventHandler = &PullRequest{}
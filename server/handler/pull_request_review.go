@@ -21,8 +21,6 @@ import (
 	"github.com/google/go-github/github"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
-
-	"github.com/palantir/bulldozer/pull"
 )
 
 type PullRequestReview struct {
@@ -55,7 +53,7 @@ func (h *PullRequestReview) Handle(ctx context.Context, eventType, deliveryID st
 	if err != nil {
 		return errors.Wrapf(err, "failed to get pull request %s/%s#%d", owner, repoName, number)
 	}
-	pullCtx := pull.NewGithubContext(client, pr, owner, repoName, number)
+	pullCtx := h.pullContext(ctx, client, pr, owner, repoName, number)
 
 	if err := h.ProcessPullRequest(ctx, pullCtx, client, pr); err != nil {
 		logger.Error().Err(errors.WithStack(err)).Msg("Error processing pull request")
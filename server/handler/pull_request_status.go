@@ -0,0 +1,281 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/bulldozer"
+)
+
+// PullRequestState is the view of a pull request returned by the status API.
+type PullRequestState struct {
+	Config string            `json:"config"`
+	Valid  bool              `json:"valid"`
+	Error  string            `json:"error,omitempty"`
+	Merge  *DecisionStatus   `json:"merge,omitempty"`
+	Update *DecisionStatus   `json:"update,omitempty"`
+	Queue  *QueuePosition    `json:"queue,omitempty"`
+	Policy *bulldozer.Config `json:"policy,omitempty"`
+
+	// LastUpdate is the most recent update attempt, if any
+	LastUpdate *audit.Event `json:"last_update,omitempty"`
+}
+
+// DecisionStatus is the JSON form of a bulldozer.Decision.
+type DecisionStatus struct {
+	Eligible bool     `json:"eligible"`
+	Signals  []string `json:"signals"`
+	Reasons  []string `json:"reasons"`
+}
+
+// QueuePosition is the zero-based position of a pull request in the merge
+// queue of its base branch.
+type QueuePosition struct {
+	Key      string `json:"key"`
+	Position int    `json:"position"`
+}
+
+func newDecisionStatus(d bulldozer.Decision) *DecisionStatus {
+	s := &DecisionStatus{Eligible: d.Eligible, Signals: d.Signals, Reasons: d.Reasons}
+	if s.Signals == nil {
+		s.Signals = []string{}
+	}
+	if s.Reasons == nil {
+		s.Reasons = []string{}
+	}
+	return s
+}
+
+// PullRequestStatus serves the evaluated configuration, merge and update
+// decisions, queue position, and last update attempt of a pull request at
+// /api/repos/:owner/:repo/pulls/:number/status. Nothing is changed.
+func (b *Base) PullRequestStatus() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := b.withServices(r.Context())
+		logger := zerolog.Ctx(ctx)
+
+		owner, repo := pat.Param(r, "owner"), pat.Param(r, "repo")
+		number, err := strconv.Atoi(pat.Param(r, "number"))
+		if err != nil {
+			http.Error(w, "invalid pull request number", http.StatusBadRequest)
+			return
+		}
+
+		status, err := b.pullRequestStatus(ctx, owner, repo, number)
+		if err != nil {
+			if rerr, ok := errors.Cause(err).(*github.ErrorResponse); ok && rerr.Response.StatusCode == http.StatusNotFound {
+				http.Error(w, "pull request not found", http.StatusNotFound)
+				return
+			}
+			logger.Error().Err(err).Msgf("Failed to get status of %s/%s#%d", owner, repo, number)
+			http.Error(w, "failed to get pull request status", http.StatusInternalServerError)
+			return
+		}
+
+		baseapp.WriteJSON(w, http.StatusOK, status)
+	})
+}
+
+// EvaluatePullRequest schedules an evaluation of the pull request at
+// /api/repos/:owner/:repo/pulls/:number/evaluate, as if an event had been
+// received for it, merging it if it is eligible. It responds as soon as the
+// evaluation is scheduled; the status endpoint shows the result. It is useful
+// when something bulldozer depends on changed without a webhook, such as the
+// members of a team.
+func (b *Base) EvaluatePullRequest() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := b.withServices(r.Context())
+		logger := zerolog.Ctx(ctx)
+
+		owner, repo := pat.Param(r, "owner"), pat.Param(r, "repo")
+		number, err := strconv.Atoi(pat.Param(r, "number"))
+		if err != nil {
+			http.Error(w, "invalid pull request number", http.StatusBadRequest)
+			return
+		}
+		if b.Scheduler == nil {
+			http.Error(w, "evaluations cannot be scheduled", http.StatusServiceUnavailable)
+			return
+		}
+
+		open, err := b.scheduleRequestedEvaluation(ctx, owner, repo, number)
+		switch {
+		case err == nil && !open:
+			http.Error(w, "pull request is not open", http.StatusConflict)
+		case err == nil:
+			user, _, _ := r.BasicAuth()
+			logger.Info().Msgf("Evaluation of pull request %s/%s#%d scheduled on request of %s", owner, repo, number, user)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			if rerr, ok := errors.Cause(err).(*github.ErrorResponse); ok && rerr.Response.StatusCode == http.StatusNotFound {
+				http.Error(w, "pull request not found", http.StatusNotFound)
+				return
+			}
+			logger.Error().Err(err).Msgf("Failed to schedule evaluation of %s/%s#%d", owner, repo, number)
+			http.Error(w, "failed to schedule evaluation", http.StatusInternalServerError)
+		}
+	})
+}
+
+// scheduleRequestedEvaluation schedules an immediate TaskEvaluate task for the
+// pull request, replacing any pending evaluation. It returns false if the pull
+// request is not open.
+func (b *Base) scheduleRequestedEvaluation(ctx context.Context, owner, repo string, number int) (bool, error) {
+	client, err := b.installationClient(ctx, owner)
+	if err != nil {
+		return false, err
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get pull request %s/%s#%d", owner, repo, number)
+	}
+	if pr.GetState() != "open" {
+		return false, nil
+	}
+
+	task := evaluationTask{Owner: owner, Repo: repo, Number: number}
+	id := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+	return true, b.Scheduler.Schedule(ctx, TaskEvaluate, id, time.Now(), task)
+}
+
+// CheckPullRequest evaluates the pull request and returns its state without
+// changing anything.
+func (b *Base) CheckPullRequest(ctx context.Context, owner, repo string, number int) (*PullRequestState, error) {
+	return b.pullRequestStatus(b.withServices(ctx), owner, repo, number)
+}
+
+// installationClient returns a client for the installation of the app in
+// the owner's account.
+func (b *Base) installationClient(ctx context.Context, owner string) (*github.Client, error) {
+	appClient, err := b.NewAppClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to instantiate github app client")
+	}
+
+	installation, err := githubapp.NewInstallationsService(appClient).GetByOwner(ctx, owner)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find installation for %s", owner)
+	}
+
+	client, err := b.NewInstallationClient(installation.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to instantiate github client")
+	}
+	return client, nil
+}
+
+// repositoryClient returns a client for the installation of the app on the
+// repository, or nil if the app is not installed on it. It implements
+// bulldozer.InstallationClients.
+func (b *Base) repositoryClient(ctx context.Context, owner, repo string) (*github.Client, error) {
+	appClient, err := b.NewAppClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to instantiate github app client")
+	}
+
+	installation, _, err := appClient.Apps.FindRepositoryInstallation(ctx, owner, repo)
+	if err != nil {
+		if rerr, ok := err.(*github.ErrorResponse); ok && rerr.Response.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to find installation for %s/%s", owner, repo)
+	}
+
+	client, err := b.NewInstallationClient(installation.GetID())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to instantiate github client")
+	}
+	return client, nil
+}
+
+func (b *Base) pullRequestStatus(ctx context.Context, owner, repo string, number int) (*PullRequestState, error) {
+	client, err := b.installationClient(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get pull request %s/%s#%d", owner, repo, number)
+	}
+	pullCtx := b.pullContext(ctx, client, pr, owner, repo, number)
+
+	bulldozerConfig, err := b.ConfigForPR(ctx, client, pr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch configuration")
+	}
+
+	status := &PullRequestState{Config: bulldozerConfig.String()}
+	switch {
+	case bulldozerConfig.Missing():
+		status.Error = "no bulldozer configuration"
+		return status, nil
+	case bulldozerConfig.Invalid():
+		status.Error = bulldozerConfig.Error.Error()
+		return status, nil
+	}
+	config := *bulldozerConfig.Config
+	status.Valid = true
+	status.Policy = &config
+
+	if err := requireBotLogin(ctx); err != nil {
+		return nil, err
+	}
+	mergeDecision, err := bulldozer.AssessPR(ctx, pullCtx, config.Merge)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to determine merge status")
+	}
+	status.Merge = newDecisionStatus(mergeDecision)
+
+	updateDecision, err := bulldozer.EvaluateUpdate(ctx, pullCtx, config.Update, config.Merge)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to determine update status")
+	}
+	status.Update = newDecisionStatus(updateDecision)
+
+	if b.MergeQueue != nil {
+		key := bulldozer.QueueKey(owner, repo, pr.GetBase().GetRef())
+		for i, entry := range b.MergeQueue.Entries(key) {
+			if entry.Number == number {
+				status.Queue = &QueuePosition{Key: key, Position: i}
+				break
+			}
+		}
+	}
+
+	lastUpdate, ok, err := bulldozer.LastUpdateAttempt(ctx, pullCtx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get last update attempt")
+	}
+	if ok {
+		status.LastUpdate = &lastUpdate
+	}
+
+	return status, nil
+}
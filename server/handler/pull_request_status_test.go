@@ -0,0 +1,94 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"goji.io"
+	"goji.io/pat"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+// fakeClientCreator creates clients for a test server. Other methods of the
+// interface are not implemented.
+type fakeClientCreator struct {
+	githubapp.ClientCreator
+	baseURL string
+}
+
+func (c *fakeClientCreator) client() *github.Client {
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(c.baseURL + "/")
+	return client
+}
+
+func (c *fakeClientCreator) NewAppClient() (*github.Client, error) {
+	return c.client(), nil
+}
+
+func (c *fakeClientCreator) NewInstallationClient(installationID int64) (*github.Client, error) {
+	return c.client(), nil
+}
+
+func TestEvaluatePullRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/orgs/o/installation":
+			_, _ = w.Write([]byte(`{"id": 1, "account": {"login": "o"}}`))
+		case "/repos/o/r/pulls/1":
+			_, _ = w.Write([]byte(`{"number": 1, "state": "open"}`))
+		case "/repos/o/r/pulls/2":
+			_, _ = w.Write([]byte(`{"number": 2, "state": "closed"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	store := state.NewMemoryStore()
+	b := &Base{
+		ClientCreator: &fakeClientCreator{baseURL: srv.URL},
+		Scheduler:     &Scheduler{Store: store},
+	}
+	mux := goji.NewMux()
+	mux.Handle(pat.Post("/api/repos/:owner/:repo/pulls/:number/evaluate"), b.EvaluatePullRequest())
+
+	evaluate := func(number string) int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/repos/o/r/pulls/"+number+"/evaluate", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusAccepted, evaluate("1"))
+	assert.Equal(t, http.StatusConflict, evaluate("2"))
+	assert.Equal(t, http.StatusNotFound, evaluate("3"))
+	assert.Equal(t, http.StatusBadRequest, evaluate("x"))
+
+	tasks, err := b.Scheduler.Pending(context.Background())
+	require.NoError(t, err)
+	require.Len(t, tasks, 1, "only open pull requests are evaluated")
+	assert.Equal(t, TaskEvaluate, tasks[0].Kind)
+	assert.Equal(t, "o/r#1", tasks[0].ID)
+}
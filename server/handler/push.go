@@ -22,6 +22,7 @@ import (
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
 
+	"github.com/palantir/bulldozer/bulldozer"
 	"github.com/palantir/bulldozer/pull"
 )
 
@@ -60,6 +61,12 @@ func (h *Push) Handle(ctx context.Context, eventType, deliveryID string, payload
 		return errors.Wrap(err, "failed to instantiate github client")
 	}
 
+	if defaultBranch := repo.GetDefaultBranch(); baseRef == "refs/heads/"+defaultBranch {
+		if err := h.syncBranches(ctx, client, owner, repoName, defaultBranch); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Error syncing branches with the default branch")
+		}
+	}
+
 	prs, err := pull.ListOpenPullRequestsForRef(ctx, client, owner, repoName, baseRef)
 	if err != nil {
 		return errors.Wrap(err, "failed to determine open pull requests matching the push change")
@@ -72,12 +79,14 @@ func (h *Push) Handle(ctx context.Context, eventType, deliveryID string, payload
 		return nil
 	}
 
+	h.sortForUpdate(ctx, client, prs)
+
 	for _, pr := range prs {
-		pullCtx := pull.NewGithubContext(client, pr, owner, repoName, pr.GetNumber())
+		pullCtx := h.pullContext(ctx, client, pr, owner, repoName, pr.GetNumber())
 		logger := logger.With().Int(githubapp.LogKeyPRNum, pr.GetNumber()).Logger()
 
 		logger.Debug().Msgf("checking status for updated sha %s", baseRef)
-		if err := h.UpdatePullRequest(logger.WithContext(ctx), pullCtx, client, pr, baseRef); err != nil {
+		if err := h.UpdatePullRequest(logger.WithContext(ctx), pullCtx, client, pr, baseRef, bulldozer.TriggerPush); err != nil {
 			logger.Error().Err(errors.WithStack(err)).Msg("Error updating pull request")
 		}
 	}
@@ -0,0 +1,138 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/bulldozer"
+)
+
+// enqueue adds the pull request to the merge queue for its base branch and
+// returns its zero-based position.
+func (b *Base) enqueue(ctx context.Context, client *github.Client, pr *github.PullRequest) int {
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	key := bulldozer.QueueKey(owner, repo, pr.GetBase().GetRef())
+
+	queued := queuePosition(b.MergeQueue.Entries(key), pr.GetNumber()) >= 0
+	position := b.MergeQueue.Add(key, bulldozer.QueueEntry{
+		Number:  pr.GetNumber(),
+		HeadSHA: pr.GetHead().GetSHA(),
+		HeadRef: pr.GetHead().GetRef(),
+	})
+	b.publishQueue(ctx, client, owner, repo, key)
+
+	if !queued {
+		audit.Record(ctx, audit.Event{
+			Type:   audit.TypeQueue,
+			Owner:  owner,
+			Repo:   repo,
+			Number: pr.GetNumber(),
+			SHA:    pr.GetHead().GetSHA(),
+			Result: audit.ResultQueued,
+			Detail: fmt.Sprintf("position %d in %s", position+1, key),
+		})
+	}
+
+	return position
+}
+
+// dequeue removes the pull request from the merge queue for its base branch,
+// if it is queued, and completes its queue check run. If the pull request was
+// at the head of the queue, the next pull request is processed.
+func (b *Base) dequeue(ctx context.Context, client *github.Client, pr *github.PullRequest, conclusion, summary string) {
+	if b.MergeQueue == nil {
+		return
+	}
+
+	owner := pr.GetBase().GetRepo().GetOwner().GetLogin()
+	repo := pr.GetBase().GetRepo().GetName()
+	key := bulldozer.QueueKey(owner, repo, pr.GetBase().GetRef())
+
+	b.removeFromQueue(ctx, client, owner, repo, key, pr.GetNumber(), conclusion, summary)
+}
+
+// removeFromQueue removes the pull request from the queue, if it is queued,
+// and completes its queue check run. If the pull request was at the head of
+// the queue, the next pull request is processed. The position is determined
+// by the removal itself, so concurrent removals advance the queue once.
+func (b *Base) removeFromQueue(ctx context.Context, client *github.Client, owner, repo, key string, number int, conclusion, summary string) (bulldozer.QueueEntry, bool) {
+	logger := zerolog.Ctx(ctx)
+
+	entry, position, ok := b.MergeQueue.Remove(key, number)
+	if !ok {
+		return entry, false
+	}
+
+	if err := bulldozer.CompleteQueueCheck(ctx, client, owner, repo, entry, conclusion, summary); err != nil {
+		logger.Error().Err(errors.WithStack(err)).Msgf("Failed to complete queue check run for %s/%s#%d", owner, repo, entry.Number)
+	}
+	b.publishQueue(ctx, client, owner, repo, key)
+
+	if position == 0 {
+		b.advanceQueue(ctx, client, owner, repo, key)
+	}
+	return entry, true
+}
+
+// publishQueue updates the queue check runs of all pull requests in the queue.
+func (b *Base) publishQueue(ctx context.Context, client *github.Client, owner, repo, key string) {
+	logger := zerolog.Ctx(ctx)
+
+	entries := b.MergeQueue.Entries(key)
+	for i, entry := range entries {
+		wait := b.MergeQueue.EstimatedWait(key, i)
+		if err := bulldozer.PublishQueuePosition(ctx, client, owner, repo, entries, i, wait); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to publish queue position for %s/%s#%d", owner, repo, entry.Number)
+		}
+	}
+}
+
+// advanceQueue processes the pull request at the head of the queue, which
+// merges it if it is still eligible or removes it from the queue otherwise.
+func (b *Base) advanceQueue(ctx context.Context, client *github.Client, owner, repo, key string) {
+	logger := zerolog.Ctx(ctx)
+
+	entries := b.MergeQueue.Entries(key)
+	if len(entries) == 0 {
+		return
+	}
+	number := entries[0].Number
+
+	ctx = logger.WithContext(context.Background())
+	b.Operations.Go(func() {
+		pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+		if err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to get pull request %s/%s#%d at the head of the merge queue", owner, repo, number)
+			return
+		}
+		if pr.GetState() != "open" {
+			b.dequeue(ctx, client, pr, "neutral", "This pull request was closed.")
+			return
+		}
+
+		pullCtx := b.pullContext(ctx, client, pr, owner, repo, number)
+		if err := b.ProcessPullRequest(ctx, pullCtx, client, pr); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Error processing pull request")
+		}
+	})
+}
@@ -0,0 +1,268 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+
+	"github.com/palantir/bulldozer/audit"
+	"github.com/palantir/bulldozer/bulldozer"
+)
+
+// RepositoryQueue is the view of a merge queue returned by the queue API.
+type RepositoryQueue struct {
+	Key     string              `json:"key"`
+	Entries []QueuedPullRequest `json:"entries"`
+}
+
+// QueuedPullRequest is the view of a merge queue entry returned by the queue
+// API.
+type QueuedPullRequest struct {
+	Number        int       `json:"number"`
+	HeadSHA       string    `json:"head_sha"`
+	HeadRef       string    `json:"head_ref"`
+	EnqueuedAt    time.Time `json:"enqueued_at"`
+	EstimatedWait string    `json:"estimated_wait,omitempty"`
+}
+
+// ListQueues serves the merge queues of the repository at
+// /admin/queues/:owner/:repo as JSON, one queue per base branch.
+func (b *Base) ListQueues() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		owner, repo := pat.Param(r, "owner"), pat.Param(r, "repo")
+
+		queues := []RepositoryQueue{}
+		for _, key := range b.queueKeys(owner, repo) {
+			queue := RepositoryQueue{Key: key, Entries: []QueuedPullRequest{}}
+			for i, entry := range b.MergeQueue.Entries(key) {
+				queued := QueuedPullRequest{
+					Number:     entry.Number,
+					HeadSHA:    entry.HeadSHA,
+					HeadRef:    entry.HeadRef,
+					EnqueuedAt: entry.EnqueuedAt,
+				}
+				if wait := b.MergeQueue.EstimatedWait(key, i); wait > 0 {
+					queued.EstimatedWait = wait.Round(time.Second).String()
+				}
+				queue.Entries = append(queue.Entries, queued)
+			}
+			if len(queue.Entries) > 0 {
+				queues = append(queues, queue)
+			}
+		}
+		baseapp.WriteJSON(w, http.StatusOK, queues)
+	})
+}
+
+// RemoveFromQueue removes the pull request at
+// /admin/queues/:owner/:repo/:number from its merge queue without changing
+// its labels. The pull request does not rejoin the queue until its head
+// changes. The body may be a JSON object with a "reason" for the removal.
+func (b *Base) RemoveFromQueue() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := b.withServices(r.Context())
+		logger := zerolog.Ctx(ctx)
+
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if !decodeQueueBody(w, r, &body) {
+			return
+		}
+
+		owner, repo, number, key, ok := b.queuedPullRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, err := b.installationClient(ctx, owner)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to remove %s/%s#%d from the merge queue", owner, repo, number)
+			http.Error(w, "failed to remove pull request from the merge queue", http.StatusInternalServerError)
+			return
+		}
+
+		user, _, _ := r.BasicAuth()
+		summary := fmt.Sprintf("This pull request was removed from the merge queue by %s.", user)
+		if body.Reason != "" {
+			summary += " " + body.Reason
+		}
+
+		entry, ok := b.removeFromQueue(ctx, client, owner, repo, key, number, "neutral", summary)
+		if !ok {
+			http.Error(w, "pull request is not queued", http.StatusNotFound)
+			return
+		}
+
+		removal := bulldozer.QueueRemoval{
+			Owner:   owner,
+			Repo:    repo,
+			Number:  number,
+			HeadSHA: entry.HeadSHA,
+			User:    user,
+			Reason:  body.Reason,
+		}
+		if err := bulldozer.RecordQueueRemoval(ctx, removal); err != nil {
+			logger.Error().Err(err).Msg("Failed to record queue removal")
+		}
+
+		audit.Record(ctx, audit.Event{
+			Type:   audit.TypeQueue,
+			Owner:  owner,
+			Repo:   repo,
+			Number: number,
+			SHA:    entry.HeadSHA,
+			Result: audit.ResultRemoved,
+			Detail: body.Reason,
+			User:   user,
+		})
+
+		logger.Warn().Msgf("Pull request %s/%s#%d removed from the merge queue by %s: %s", owner, repo, number, user, body.Reason)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// MoveInQueue moves the pull request at
+// /admin/queues/:owner/:repo/:number/position to the zero-based "position"
+// in the JSON body and serves the reordered queue.
+func (b *Base) MoveInQueue() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := b.withServices(r.Context())
+		logger := zerolog.Ctx(ctx)
+
+		var body struct {
+			Position *int `json:"position"`
+		}
+		if !decodeQueueBody(w, r, &body) {
+			return
+		}
+		if body.Position == nil {
+			http.Error(w, "missing position", http.StatusBadRequest)
+			return
+		}
+
+		owner, repo, number, key, ok := b.queuedPullRequest(w, r)
+		if !ok {
+			return
+		}
+
+		client, err := b.installationClient(ctx, owner)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to move %s/%s#%d in the merge queue", owner, repo, number)
+			http.Error(w, "failed to move pull request in the merge queue", http.StatusInternalServerError)
+			return
+		}
+
+		entries := b.MergeQueue.Entries(key)
+		from := queuePosition(entries, number)
+		to, ok := b.MergeQueue.Move(key, number, *body.Position)
+		if !ok || from < 0 {
+			http.Error(w, "pull request is not queued", http.StatusNotFound)
+			return
+		}
+
+		b.publishQueue(ctx, client, owner, repo, key)
+		if to != from && (to == 0 || from == 0) {
+			b.advanceQueue(ctx, client, owner, repo, key)
+		}
+
+		user, _, _ := r.BasicAuth()
+		audit.Record(ctx, audit.Event{
+			Type:   audit.TypeQueue,
+			Owner:  owner,
+			Repo:   repo,
+			Number: number,
+			SHA:    entries[from].HeadSHA,
+			Result: audit.ResultReordered,
+			Detail: fmt.Sprintf("moved from position %d to %d", from, to),
+			User:   user,
+		})
+
+		logger.Warn().Msgf("Pull request %s/%s#%d moved from position %d to %d in the merge queue by %s", owner, repo, number, from, to, user)
+		baseapp.WriteJSON(w, http.StatusOK, QueuePosition{Key: key, Position: to})
+	})
+}
+
+// queueKeys returns the sorted keys of the non-empty merge queues of the
+// repository. Owners and repositories are compared case-insensitively.
+func (b *Base) queueKeys(owner, repo string) []string {
+	if b.MergeQueue == nil {
+		return nil
+	}
+
+	prefix := strings.ToLower(bulldozer.QueueKey(owner, repo, ""))
+
+	var keys []string
+	for _, key := range b.MergeQueue.Keys() {
+		if strings.HasPrefix(strings.ToLower(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// queuedPullRequest returns the pull request in the path and the key of the
+// merge queue it is in. If the pull request is not queued, an error is
+// written to the response.
+func (b *Base) queuedPullRequest(w http.ResponseWriter, r *http.Request) (owner, repo string, number int, key string, ok bool) {
+	owner, repo = pat.Param(r, "owner"), pat.Param(r, "repo")
+	number, err := strconv.Atoi(pat.Param(r, "number"))
+	if err != nil {
+		http.Error(w, "invalid pull request number", http.StatusBadRequest)
+		return
+	}
+
+	for _, k := range b.queueKeys(owner, repo) {
+		if queuePosition(b.MergeQueue.Entries(k), number) >= 0 {
+			return owner, repo, number, k, true
+		}
+	}
+	http.Error(w, "pull request is not queued", http.StatusNotFound)
+	return
+}
+
+// queuePosition returns the position of the pull request in the entries, or
+// -1 if it is not present.
+func queuePosition(entries []bulldozer.QueueEntry, number int) int {
+	for i, entry := range entries {
+		if entry.Number == number {
+			return i
+		}
+	}
+	return -1
+}
+
+// decodeQueueBody decodes the optional JSON body of a queue request, writing
+// an error to the response if it is invalid.
+func decodeQueueBody(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,266 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultRateLimitReserve is the fraction of the rate limit kept for
+	// merges and other work that responds to events.
+	DefaultRateLimitReserve = 0.2
+
+	// DefaultSecondaryRateLimitBackoff is how long requests for an owner
+	// are stopped after a secondary rate limit response without a
+	// Retry-After header.
+	DefaultSecondaryRateLimitBackoff = time.Minute
+
+	MetricsKeySecondaryRateLimits = "bulldozer.github.secondary_rate_limits"
+)
+
+// RateLimits tracks the GitHub rate limit of each owner from the headers of
+// API responses. Each GitHub App installation belongs to a single owner and
+// has its own limit. Low-priority work, such as updates and sweeps, is
+// deferred while the remaining requests of an owner are below the reserve,
+// so that merges can still happen.
+//
+// When GitHub responds with a secondary rate limit, every request for the
+// owner fails without being sent until the time in the Retry-After header,
+// so that retries do not extend the limit. It is safe for concurrent use.
+type RateLimits struct {
+	// Registry receives a counter of secondary rate limit responses. If
+	// nil, the default registry is used.
+	Registry metrics.Registry
+
+	reserve float64
+
+	lock         sync.Mutex
+	byOwner      map[string]rateLimit
+	blockedUntil map[string]time.Time
+}
+
+// SecondaryRateLimitError is returned instead of sending requests for an
+// owner that is backing off from a secondary rate limit.
+type SecondaryRateLimitError struct {
+	Owner string
+	Until time.Time
+}
+
+func (err SecondaryRateLimitError) Error() string {
+	return fmt.Sprintf("not sending request for %s until secondary rate limit ends at %s", err.Owner, err.Until.Format(time.RFC3339))
+}
+
+type rateLimit struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// NewRateLimits creates a tracker that defers low-priority work when less
+// than the reserve fraction of the limit remains. Non-positive values use
+// DefaultRateLimitReserve.
+func NewRateLimits(reserve float64) *RateLimits {
+	if reserve <= 0 {
+		reserve = DefaultRateLimitReserve
+	}
+	return &RateLimits{
+		reserve:      reserve,
+		byOwner:      make(map[string]rateLimit),
+		blockedUntil: make(map[string]time.Time),
+	}
+}
+
+// Observe records the rate limit headers of a response to a request for a
+// resource of the owner.
+func (r *RateLimits) Observe(owner string, res *http.Response) {
+	limit, err := strconv.Atoi(res.Header.Get("X-RateLimit-Limit"))
+	if err != nil || owner == "" {
+		return
+	}
+	remaining, err := strconv.Atoi(res.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.byOwner[owner] = rateLimit{limit: limit, remaining: remaining, reset: time.Unix(reset, 0)}
+}
+
+// DeferUntil returns the time when low-priority work for the owner may
+// resume, or the zero time if it may run now.
+func (r *RateLimits) DeferUntil(owner string, now time.Time) time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if until, ok := r.blockedUntil[owner]; ok && now.Before(until) {
+		return until
+	}
+
+	rl, ok := r.byOwner[owner]
+	if !ok || !now.Before(rl.reset) {
+		return time.Time{}
+	}
+	if float64(rl.remaining) >= r.reserve*float64(rl.limit) {
+		return time.Time{}
+	}
+	return rl.reset
+}
+
+// RateLimitStatus is the last rate limit observed for an owner.
+type RateLimitStatus struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// Status returns the last rate limit observed for each owner.
+func (r *RateLimits) Status() map[string]RateLimitStatus {
+	status := make(map[string]RateLimitStatus)
+	if r == nil {
+		return status
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for owner, rl := range r.byOwner {
+		status[owner] = RateLimitStatus{Limit: rl.limit, Remaining: rl.remaining, Reset: rl.reset}
+	}
+	return status
+}
+
+// Block stops requests for the owner until the time.
+func (r *RateLimits) Block(owner string, until time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if until.After(r.blockedUntil[owner]) {
+		r.blockedUntil[owner] = until
+	}
+}
+
+// blocked returns the end of the secondary rate limit of the owner, or false
+// if requests for the owner may be sent.
+func (r *RateLimits) blocked(owner string, now time.Time) (time.Time, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	until, ok := r.blockedUntil[owner]
+	if ok && !now.Before(until) {
+		delete(r.blockedUntil, owner)
+		return time.Time{}, false
+	}
+	return until, ok
+}
+
+// Middleware returns client middleware that observes the rate limit headers
+// of every response and stops requests for owners that hit a secondary rate
+// limit.
+func (r *RateLimits) Middleware() githubapp.ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			owner := pathOwner(req.URL.Path)
+			if until, ok := r.blocked(owner, time.Now()); ok {
+				return nil, SecondaryRateLimitError{Owner: owner, Until: until}
+			}
+
+			res, err := next.RoundTrip(req)
+			if res == nil {
+				return res, err
+			}
+
+			r.Observe(owner, res)
+			if wait, ok := secondaryRateLimit(res); ok && owner != "" {
+				until := time.Now().Add(wait)
+				r.Block(owner, until)
+
+				registry := r.Registry
+				if registry == nil {
+					registry = metrics.DefaultRegistry
+				}
+				metrics.GetOrRegisterCounter(MetricsKeySecondaryRateLimits, registry).Inc(1)
+				zerolog.Ctx(req.Context()).Warn().Msgf("GitHub secondary rate limit for %s, stopping requests until %s", owner, until.Format(time.RFC3339))
+			}
+			return res, err
+		})
+	}
+}
+
+// secondaryRateLimit returns how long to wait if the response is a secondary
+// rate limit. The body of the response is preserved.
+func secondaryRateLimit(res *http.Response) (time.Duration, bool) {
+	if res.StatusCode != http.StatusForbidden && res.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if res.Body == nil {
+		return 0, false
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 0, false
+	}
+
+	msg := strings.ToLower(string(body))
+	if strings.Contains(msg, "secondary rate limit") || strings.Contains(msg, "abuse detection") {
+		return DefaultSecondaryRateLimitBackoff, true
+	}
+	return 0, false
+}
+
+// pathOwner returns the owner of the repository in a GitHub API path, if the
+// path refers to a repository.
+func pathOwner(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "repos" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return fn(r)
+}
@@ -0,0 +1,171 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitHeader returns a response with the rate limit headers.
+func rateLimitHeader(limit, remaining int, reset time.Time) *http.Response {
+	res := &http.Response{Header: make(http.Header)}
+	res.Header.Set("X-RateLimit-Limit", fmt.Sprint(limit))
+	res.Header.Set("X-RateLimit-Remaining", fmt.Sprint(remaining))
+	res.Header.Set("X-RateLimit-Reset", fmt.Sprint(reset.Unix()))
+	return res
+}
+
+func TestRateLimitsDeferUntil(t *testing.T) {
+	now := time.Now()
+	reset := now.Add(time.Hour).Truncate(time.Second)
+
+	r := NewRateLimits(0.2)
+	r.Observe("above", rateLimitHeader(5000, 1000, reset))
+	r.Observe("below", rateLimitHeader(5000, 999, reset))
+	r.Observe("expired", rateLimitHeader(5000, 0, now.Add(-time.Minute)))
+	r.Observe("", rateLimitHeader(5000, 0, reset))
+	r.Observe("invalid", &http.Response{Header: make(http.Header)})
+
+	assert.True(t, r.DeferUntil("above", now).IsZero(), "work runs while the reserve remains")
+	assert.Equal(t, reset, r.DeferUntil("below", now), "work is deferred until the limit resets")
+	assert.True(t, r.DeferUntil("expired", now).IsZero(), "work runs after the limit resets")
+	assert.True(t, r.DeferUntil("invalid", now).IsZero())
+	assert.True(t, r.DeferUntil("unknown", now).IsZero())
+	assert.Len(t, r.Status(), 3, "responses without an owner or headers are ignored")
+
+	var nilLimits *RateLimits
+	assert.True(t, nilLimits.DeferUntil("below", now).IsZero(), "nil rate limits never defer work")
+}
+
+func TestRateLimitsMiddleware(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "10")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(reset.Unix()))
+	}))
+	defer srv.Close()
+
+	r := NewRateLimits(0)
+	client := &http.Client{Transport: r.Middleware()(http.DefaultTransport)}
+
+	res, err := client.Get(srv.URL + "/repos/o/r/pulls/1")
+	require.NoError(t, err)
+	_ = res.Body.Close()
+
+	status := r.Status()
+	require.Contains(t, status, "o")
+	assert.Equal(t, RateLimitStatus{Limit: 5000, Remaining: 10, Reset: reset}, status["o"])
+	assert.Equal(t, reset, r.DeferUntil("o", time.Now()))
+}
+
+func TestPathOwner(t *testing.T) {
+	tests := map[string]string{
+		"/repos/o/r/pulls/1":          "o",
+		"/api/v3/repos/o/r/git/refs":  "o",
+		"/installation/repositories":  "",
+		"/repos":                      "",
+		"/app/installations/1/tokens": "",
+	}
+	for path, owner := range tests {
+		assert.Equal(t, owner, pathOwner(path), path)
+	}
+}
+
+func TestRateLimitsSecondaryRateLimit(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/repos/retry/r/pulls":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusForbidden)
+		case "/repos/message/r/pulls":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message": "You have exceeded a secondary rate limit."}`))
+		case "/repos/forbidden/r/pulls":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message": "Resource not accessible by integration"}`))
+		}
+	}))
+	defer srv.Close()
+
+	registry := metrics.NewRegistry()
+	r := NewRateLimits(0)
+	r.Registry = registry
+	client := &http.Client{Transport: r.Middleware()(http.DefaultTransport)}
+
+	get := func(owner string) (string, error) {
+		res, err := client.Get(srv.URL + "/repos/" + owner + "/r/pulls")
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = res.Body.Close() }()
+		body, err := ioutil.ReadAll(res.Body)
+		return string(body), err
+	}
+
+	start := time.Now()
+	for _, owner := range []string{"retry", "message", "forbidden"} {
+		_, err := get(owner)
+		require.NoError(t, err)
+	}
+
+	body, err := get("message")
+	assert.Error(t, err, "requests are not sent during a secondary rate limit")
+	assert.Empty(t, body)
+
+	var serr SecondaryRateLimitError
+	require.True(t, errors.As(err, &serr))
+	assert.Equal(t, "message", serr.Owner)
+	assert.False(t, serr.Until.Before(start.Add(DefaultSecondaryRateLimitBackoff)), "the default backoff is used without Retry-After")
+
+	_, err = get("retry")
+	require.True(t, errors.As(err, &serr))
+	assert.False(t, serr.Until.Before(start.Add(time.Minute)), "the Retry-After header sets the backoff")
+	assert.Equal(t, serr.Until, r.DeferUntil("retry", time.Now()), "low-priority work is deferred during the backoff")
+
+	body, err = get("forbidden")
+	require.NoError(t, err, "other forbidden responses do not stop requests")
+	assert.Contains(t, body, "Resource not accessible", "the body of the response is preserved")
+
+	assert.Equal(t, []string{"/repos/retry/r/pulls", "/repos/message/r/pulls", "/repos/forbidden/r/pulls", "/repos/forbidden/r/pulls"}, requests)
+	assert.Equal(t, int64(2), metrics.GetOrRegisterCounter(MetricsKeySecondaryRateLimits, registry).Count())
+}
+
+func TestRateLimitsBlockExpires(t *testing.T) {
+	now := time.Now()
+	r := NewRateLimits(0)
+	r.Block("o", now.Add(time.Minute))
+	r.Block("o", now.Add(time.Second))
+
+	until, ok := r.blocked("o", now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Minute), until, "a shorter block does not end a longer one")
+
+	_, ok = r.blocked("o", now.Add(time.Minute))
+	assert.False(t, ok, "requests resume when the block ends")
+	assert.True(t, r.DeferUntil("o", now).IsZero())
+}
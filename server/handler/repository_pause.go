@@ -0,0 +1,108 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/palantir/go-baseapp/baseapp"
+	"github.com/rs/zerolog"
+	"goji.io/pat"
+	"goji.io/pattern"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/state"
+)
+
+// ListRepositoryPauses serves the paused repositories and owners as JSON.
+func ListRepositoryPauses(store state.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := state.WithStore(r.Context(), store)
+
+		pauses, err := bulldozer.ListRepositoryPauses(ctx)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to list repository pauses")
+			http.Error(w, "failed to list repository pauses", http.StatusInternalServerError)
+			return
+		}
+		if pauses == nil {
+			pauses = []bulldozer.RepositoryPause{}
+		}
+		baseapp.WriteJSON(w, http.StatusOK, pauses)
+	})
+}
+
+// PauseRepository pauses the owner and optional repository in the path. The
+// body may be a JSON object with a "reason" for the pause.
+func PauseRepository(store state.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := state.WithStore(r.Context(), store)
+		logger := zerolog.Ctx(ctx)
+
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		user, _, _ := r.BasicAuth()
+		pause := bulldozer.RepositoryPause{
+			Owner:  pat.Param(r, "owner"),
+			Repo:   repoParam(r),
+			User:   user,
+			Reason: body.Reason,
+		}
+		if err := bulldozer.PauseRepository(ctx, pause); err != nil {
+			logger.Error().Err(err).Msg("Failed to pause repository")
+			http.Error(w, "failed to pause repository", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Warn().Msgf("Processing of %s paused by %s: %s", pause, user, pause.Reason)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ResumeRepository removes the pause of the owner and optional repository in
+// the path. Pull requests are processed again on their next event or sweep.
+func ResumeRepository(store state.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := state.WithStore(r.Context(), store)
+		logger := zerolog.Ctx(ctx)
+
+		owner, repo := pat.Param(r, "owner"), repoParam(r)
+		if err := bulldozer.ResumeRepository(ctx, owner, repo); err != nil {
+			logger.Error().Err(err).Msg("Failed to resume repository")
+			http.Error(w, "failed to resume repository", http.StatusInternalServerError)
+			return
+		}
+
+		user, _, _ := r.BasicAuth()
+		logger.Warn().Msgf("Processing of %s resumed by %s", bulldozer.RepositoryPause{Owner: owner, Repo: repo}, user)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// repoParam returns the repository in the path, or an empty string if the
+// route only has an owner.
+func repoParam(r *http.Request) string {
+	repo, _ := r.Context().Value(pattern.Variable("repo")).(string)
+	return repo
+}
@@ -0,0 +1,358 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	taskPrefix      = "schedule/"
+	taskClaimPrefix = "schedule-claims/"
+	taskClaimTTL    = time.Hour
+
+	// DefaultSchedulerPollInterval is how often the scheduler checks for due
+	// tasks if the scheduler does not set an interval
+	DefaultSchedulerPollInterval = 5 * time.Second
+
+	// maxTaskAttempts is how many times a one-time task runs before it is
+	// discarded, if it keeps failing
+	maxTaskAttempts = 5
+
+	// taskRetryDelay is the delay before the first retry of a failed task,
+	// doubling for every further attempt up to maxTaskRetryDelay
+	taskRetryDelay    = 30 * time.Second
+	maxTaskRetryDelay = time.Hour
+)
+
+// ScheduledTask is work that runs at a later time. Tasks are kept in the
+// state store, so they run even if the server that scheduled them restarts,
+// and each run happens on only one of the servers sharing the store.
+type ScheduledTask struct {
+	Kind string `json:"kind"`
+
+	// ID identifies the task among tasks of the same kind. Scheduling a task
+	// replaces the pending task with the same kind and ID.
+	ID string `json:"id"`
+
+	RunAt time.Time       `json:"run_at"`
+	Data  json.RawMessage `json:"data,omitempty"`
+
+	// Interval, if positive, makes the task recurring: after each run, it
+	// is scheduled again for Interval later
+	Interval time.Duration `json:"interval,omitempty"`
+
+	// Attempts counts the failed runs of a one-time task
+	Attempts int `json:"attempts,omitempty"`
+
+	// version is the stored value the task was loaded from, so that the
+	// task is only changed if it was not replaced since
+	version []byte
+}
+
+func (t ScheduledTask) key() string {
+	return taskPrefix + t.Kind + "/" + t.ID
+}
+
+// TaskFunc runs a task with its data. If it returns an error, a one-time task
+// is retried with exponential backoff.
+type TaskFunc func(ctx context.Context, data json.RawMessage) error
+
+// Scheduler runs delayed and recurring tasks. Each kind of task must be
+// registered with the function that runs it before the scheduler is started;
+// tasks of unknown kinds are left in the store.
+type Scheduler struct {
+	Store        state.Store
+	Operations   *Operations
+	PollInterval time.Duration
+
+	lock     sync.Mutex
+	funcs    map[string]TaskFunc
+	inFlight map[string]bool
+	notify   chan struct{}
+	once     sync.Once
+}
+
+func (s *Scheduler) init() {
+	s.once.Do(func() {
+		s.notify = make(chan struct{}, 1)
+	})
+}
+
+// Register sets the function that runs tasks of the kind.
+func (s *Scheduler) Register(kind string, fn TaskFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.funcs == nil {
+		s.funcs = make(map[string]TaskFunc)
+	}
+	s.funcs[kind] = fn
+}
+
+// Schedule runs a task of the kind at the time, replacing any pending task
+// with the same kind and ID. The data is marshaled as JSON.
+func (s *Scheduler) Schedule(ctx context.Context, kind, id string, at time.Time, data interface{}) error {
+	task := ScheduledTask{Kind: kind, ID: id, RunAt: at.UTC()}
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to marshal data of %s task %s", kind, id)
+		}
+		task.Data = b
+	}
+	return s.save(ctx, task)
+}
+
+// Every runs a task of the kind every interval, starting one interval from
+// now. If the task is already scheduled with the same interval, for example
+// by another server or before a restart, it is left unchanged.
+func (s *Scheduler) Every(ctx context.Context, kind, id string, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.Errorf("invalid interval %s for %s task %s", interval, kind, id)
+	}
+
+	task := ScheduledTask{Kind: kind, ID: id}
+	if existing, ok, err := s.load(ctx, task.key()); err != nil {
+		return err
+	} else if ok && existing.Interval == interval {
+		return nil
+	}
+
+	task.RunAt = time.Now().UTC().Add(interval)
+	task.Interval = interval
+	return s.save(ctx, task)
+}
+
+// Cancel removes the pending task with the kind and ID, if it exists.
+func (s *Scheduler) Cancel(ctx context.Context, kind, id string) error {
+	task := ScheduledTask{Kind: kind, ID: id}
+	return errors.Wrapf(s.Store.Delete(ctx, task.key()), "failed to cancel %s task %s", kind, id)
+}
+
+// Pending returns the scheduled tasks, ordered by the time they run.
+func (s *Scheduler) Pending(ctx context.Context) ([]ScheduledTask, error) {
+	keys, err := s.Store.Keys(ctx, taskPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list scheduled tasks")
+	}
+
+	var tasks []ScheduledTask
+	for _, key := range keys {
+		task, ok, err := s.load(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].RunAt.Before(tasks[j].RunAt)
+	})
+	return tasks, nil
+}
+
+// Start runs due tasks until the context is canceled. It returns
+// immediately.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.init()
+
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = DefaultSchedulerPollInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.poll(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.notify:
+			}
+		}
+	}()
+}
+
+// poll starts the due tasks that are not already running on this server.
+func (s *Scheduler) poll(ctx context.Context) {
+	tasks, err := s.Pending(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to list scheduled tasks")
+		return
+	}
+
+	now := time.Now()
+	for _, task := range tasks {
+		if task.RunAt.After(now) {
+			break
+		}
+
+		s.lock.Lock()
+		fn, ok := s.funcs[task.Kind]
+		busy := s.inFlight[task.key()]
+		if ok && !busy {
+			if s.inFlight == nil {
+				s.inFlight = make(map[string]bool)
+			}
+			s.inFlight[task.key()] = true
+		}
+		s.lock.Unlock()
+		if !ok || busy {
+			continue
+		}
+
+		task := task
+		// tasks continue after ctx is canceled, so that shutdown does not
+		// interrupt a merge or update
+		runCtx := zerolog.Ctx(ctx).WithContext(context.Background())
+		s.Operations.Go(func() {
+			defer func() {
+				s.lock.Lock()
+				delete(s.inFlight, task.key())
+				s.lock.Unlock()
+			}()
+			s.run(runCtx, task, fn)
+		})
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, task ScheduledTask, fn TaskFunc) {
+	logger := zerolog.Ctx(ctx).With().Str("task_kind", task.Kind).Str("task_id", task.ID).Logger()
+	ctx = logger.WithContext(ctx)
+
+	claim := fmt.Sprintf("%s%s/%s/%d", taskClaimPrefix, task.Kind, task.ID, task.RunAt.UnixNano())
+	claims, err := s.Store.Increment(ctx, claim, taskClaimTTL)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to claim scheduled task")
+		return
+	}
+	if claims > 1 {
+		// another server is running the task
+		return
+	}
+
+	runErr := fn(ctx, task.Data)
+
+	// the task may have been replaced or canceled while it ran, in which
+	// case the new task is kept; otherwise it is removed before it is
+	// rescheduled, so that a replacement is never overwritten
+	removed, err := s.Store.CompareAndDelete(ctx, task.key(), task.version)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to remove scheduled task")
+		return
+	}
+	if !removed {
+		return
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case task.Interval > 0:
+		if runErr != nil {
+			logger.Error().Err(errors.WithStack(runErr)).Msg("Recurring task failed")
+		}
+		task.RunAt = task.RunAt.Add(task.Interval)
+		if task.RunAt.Before(now) {
+			task.RunAt = now.Add(task.Interval)
+		}
+	case runErr != nil:
+		task.Attempts++
+		if task.Attempts >= maxTaskAttempts {
+			logger.Error().Err(errors.WithStack(runErr)).Msgf("Scheduled task failed %d times, discarding it", task.Attempts)
+			return
+		}
+		delay := taskRetryDelay << uint(task.Attempts-1)
+		if delay > maxTaskRetryDelay {
+			delay = maxTaskRetryDelay
+		}
+		logger.Warn().Err(runErr).Msgf("Scheduled task failed, retrying in %s", delay)
+		task.RunAt = now.Add(delay)
+	default:
+		return
+	}
+
+	// a task scheduled since it was removed replaces the rescheduled task
+	if err := s.reschedule(ctx, task); err != nil {
+		logger.Error().Err(err).Msg("Failed to reschedule task")
+	}
+}
+
+func (s *Scheduler) load(ctx context.Context, key string) (ScheduledTask, bool, error) {
+	var task ScheduledTask
+
+	b, ok, err := s.Store.Get(ctx, key)
+	if err != nil || !ok {
+		return task, false, errors.Wrapf(err, "failed to get scheduled task %s", key)
+	}
+	if err := json.Unmarshal(b, &task); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msgf("Discarding invalid scheduled task %s", key)
+		_ = s.Store.Delete(ctx, key)
+		return task, false, nil
+	}
+	task.version = b
+	return task, true, nil
+}
+
+func (s *Scheduler) save(ctx context.Context, task ScheduledTask) error {
+	b, err := json.Marshal(task)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal %s task %s", task.Kind, task.ID)
+	}
+	if err := s.Store.Set(ctx, task.key(), b, 0); err != nil {
+		return errors.Wrapf(err, "failed to schedule %s task %s", task.Kind, task.ID)
+	}
+	s.wake()
+	return nil
+}
+
+// reschedule saves the task unless another task with the same kind and ID
+// was scheduled.
+func (s *Scheduler) reschedule(ctx context.Context, task ScheduledTask) error {
+	b, err := json.Marshal(task)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal %s task %s", task.Kind, task.ID)
+	}
+	if _, err := s.Store.SetIfAbsent(ctx, task.key(), b, 0); err != nil {
+		return errors.Wrapf(err, "failed to schedule %s task %s", task.Kind, task.ID)
+	}
+	s.wake()
+	return nil
+}
+
+// wake makes the scheduler check for due tasks.
+func (s *Scheduler) wake() {
+	s.init()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+// dueTask returns the only pending task of the scheduler.
+func dueTask(t *testing.T, s *Scheduler) ScheduledTask {
+	tasks, err := s.Pending(context.Background())
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	return tasks[0]
+}
+
+func TestSchedulerRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("oneTime", func(t *testing.T) {
+		s := &Scheduler{Store: state.NewMemoryStore()}
+		require.NoError(t, s.Schedule(ctx, "test", "1", time.Now(), "data"))
+
+		var ran []string
+		s.run(ctx, dueTask(t, s), func(ctx context.Context, data json.RawMessage) error {
+			ran = append(ran, string(data))
+			return nil
+		})
+
+		assert.Equal(t, []string{`"data"`}, ran)
+		tasks, err := s.Pending(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, tasks, "tasks that succeed are removed")
+	})
+
+	t.Run("replacedWhileRunning", func(t *testing.T) {
+		s := &Scheduler{Store: state.NewMemoryStore()}
+		require.NoError(t, s.Schedule(ctx, "test", "1", time.Now(), "old"))
+
+		later := time.Now().Add(time.Hour).UTC()
+		s.run(ctx, dueTask(t, s), func(ctx context.Context, data json.RawMessage) error {
+			return s.Schedule(ctx, "test", "1", later, "new")
+		})
+
+		task := dueTask(t, s)
+		assert.True(t, later.Equal(task.RunAt), "tasks replaced while running are kept")
+		assert.Equal(t, `"new"`, string(task.Data))
+	})
+
+	t.Run("canceledWhileRunning", func(t *testing.T) {
+		s := &Scheduler{Store: state.NewMemoryStore()}
+		require.NoError(t, s.Schedule(ctx, "test", "1", time.Now(), nil))
+
+		s.run(ctx, dueTask(t, s), func(ctx context.Context, data json.RawMessage) error {
+			require.NoError(t, s.Cancel(ctx, "test", "1"))
+			return errors.New("failed")
+		})
+
+		tasks, err := s.Pending(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, tasks, "canceled tasks are not retried")
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		s := &Scheduler{Store: state.NewMemoryStore()}
+		require.NoError(t, s.Schedule(ctx, "test", "1", time.Now(), nil))
+
+		s.run(ctx, dueTask(t, s), func(ctx context.Context, data json.RawMessage) error {
+			return errors.New("failed")
+		})
+
+		task := dueTask(t, s)
+		assert.Equal(t, 1, task.Attempts)
+		assert.True(t, task.RunAt.After(time.Now()), "failed tasks are retried later")
+	})
+
+	t.Run("recurring", func(t *testing.T) {
+		s := &Scheduler{Store: state.NewMemoryStore()}
+		require.NoError(t, s.Every(ctx, "test", "1", time.Minute))
+		task := dueTask(t, s)
+
+		s.run(ctx, task, func(ctx context.Context, data json.RawMessage) error {
+			return nil
+		})
+
+		next := dueTask(t, s)
+		assert.Equal(t, task.RunAt.Add(time.Minute), next.RunAt)
+		assert.Equal(t, time.Minute, next.Interval)
+	})
+}
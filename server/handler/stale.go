@@ -0,0 +1,67 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/pull"
+)
+
+// handleStale nudges the author of a stale pull request that was updated by
+// an earlier sweep, or marks the pull request so that the update started by
+// this sweep is followed by a nudge.
+func (b *Base) handleStale(ctx context.Context, pullCtx pull.Context, client *github.Client, pr *github.PullRequest) error {
+	ctx = b.withServices(ctx)
+	logger := zerolog.Ctx(ctx)
+
+	bulldozerConfig, err := b.ConfigForPR(ctx, client, pr)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch configuration")
+	}
+	if bulldozerConfig.Missing() || bulldozerConfig.Invalid() {
+		return nil
+	}
+	config := *bulldozerConfig.Config
+
+	if !config.Update.Stale.Enabled() {
+		return nil
+	}
+
+	if err := bulldozer.NudgeStalePR(ctx, pullCtx, client, config.Update, config.Merge); err != nil {
+		return err
+	}
+
+	if !bulldozer.IsStale(pr, config.Update.Stale, time.Now()) {
+		return nil
+	}
+
+	shouldUpdate, err := bulldozer.ShouldUpdatePR(ctx, pullCtx, config.Update, config.Merge)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine update status")
+	}
+	if !shouldUpdate {
+		return nil
+	}
+
+	logger.Debug().Msgf("Pull request has had no activity for %d days", config.Update.Stale.Days)
+	return bulldozer.MarkStale(ctx, pullCtx, pr)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
 
+	"github.com/palantir/bulldozer/bulldozer"
 	"github.com/palantir/bulldozer/pull"
 )
 
@@ -45,10 +46,14 @@ func (h *Status) Handle(ctx context.Context, eventType, deliveryID string, paylo
 	installationID := githubapp.GetInstallationIDFromEvent(&event)
 	ctx, logger := githubapp.PrepareRepoContext(ctx, installationID, repo)
 
-	if event.GetState() != "success" {
+	if event.GetState() == "pending" {
 		logger.Debug().Msgf("Doing nothing since context state for %q was %q", event.GetContext(), event.GetState())
 		return nil
 	}
+	if bulldozer.IsOwnCheck(event.GetContext()) {
+		logger.Debug().Msgf("Doing nothing since status %q was published by bulldozer", event.GetContext())
+		return nil
+	}
 
 	client, err := h.ClientCreator.NewInstallationClient(installationID)
 	if err != nil {
@@ -66,10 +71,15 @@ func (h *Status) Handle(ctx context.Context, eventType, deliveryID string, paylo
 	}
 
 	for _, pr := range prs {
-		pullCtx := pull.NewGithubContext(client, pr, owner, repoName, pr.GetNumber())
+		pullCtx := h.pullContext(ctx, client, pr, owner, repoName, pr.GetNumber())
 		logger := logger.With().Int(githubapp.LogKeyPRNum, pr.GetNumber()).Logger()
-		if err := h.ProcessPullRequest(logger.WithContext(ctx), pullCtx, client, pr); err != nil {
-			logger.Error().Err(errors.WithStack(err)).Msg("Error processing pull request")
+		if event.GetState() == "success" {
+			if err := h.ProcessPullRequest(logger.WithContext(ctx), pullCtx, client, pr); err != nil {
+				logger.Error().Err(errors.WithStack(err)).Msg("Error processing pull request")
+			}
+		}
+		if err := h.resumeUpdate(logger.WithContext(ctx), pullCtx, client, pr); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Error updating pull request")
 		}
 	}
 
@@ -0,0 +1,120 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/pull"
+)
+
+// UpdateSweep periodically updates the open pull requests in a set of
+// repositories, so that pull requests are kept up to date even if push events
+// are missed.
+type UpdateSweep struct {
+	Base
+
+	Interval time.Duration
+
+	// Repositories are the "owner/name" repositories to sweep
+	Repositories []string
+}
+
+// TaskUpdateSweep is the kind of the recurring scheduled task that runs the
+// update sweep.
+const TaskUpdateSweep = "update_sweep"
+
+// Start schedules a sweep of the repositories every interval. The sweeps run
+// when the scheduler of the handler is started.
+func (s *UpdateSweep) Start(ctx context.Context) {
+	s.Scheduler.Register(TaskUpdateSweep, func(ctx context.Context, data json.RawMessage) error {
+		s.Sweep(ctx)
+		return nil
+	})
+	if err := s.Scheduler.Every(ctx, TaskUpdateSweep, "repositories", s.Interval); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to schedule update sweep")
+	}
+}
+
+// Sweep updates the open pull requests in each repository that are out of
+// date and have the update signal, and nudges the authors of stale pull
+// requests after updating them.
+func (s *UpdateSweep) Sweep(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	for _, fullName := range s.Repositories {
+		parts := strings.SplitN(fullName, "/", 2)
+		if len(parts) != 2 {
+			logger.Error().Msgf("Invalid repository %q in update sweep, expected owner/name", fullName)
+			continue
+		}
+
+		if err := s.sweepRepository(ctx, parts[0], parts[1]); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to sweep %s for out of date pull requests", fullName)
+		}
+	}
+}
+
+func (s *UpdateSweep) sweepRepository(ctx context.Context, owner, repo string) error {
+	if until := s.RateLimits.DeferUntil(owner, time.Now()); !until.IsZero() {
+		zerolog.Ctx(ctx).Info().Msgf("Skipping sweep of %s/%s until the rate limit resets at %s", owner, repo, until.Format(time.RFC3339))
+		return nil
+	}
+
+	appClient, err := s.ClientCreator.NewAppClient()
+	if err != nil {
+		return errors.Wrap(err, "failed to instantiate github app client")
+	}
+
+	installation, err := githubapp.NewInstallationsService(appClient).GetByOwner(ctx, owner)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find installation for %s", owner)
+	}
+
+	client, err := s.ClientCreator.NewInstallationClient(installation.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to instantiate github client")
+	}
+
+	prs, err := pull.ListOpenPullRequests(ctx, client, owner, repo)
+	if err != nil {
+		return errors.Wrap(err, "failed to list open pull requests")
+	}
+
+	zerolog.Ctx(ctx).Debug().Msgf("Sweeping %d open pull requests in %s/%s", len(prs), owner, repo)
+
+	s.sortForUpdate(ctx, client, prs)
+
+	for _, pr := range prs {
+		pullCtx := pull.NewGithubContext(client, pr, owner, repo, pr.GetNumber())
+		logger := zerolog.Ctx(ctx).With().Str(githubapp.LogKeyRepositoryOwner, owner).Str(githubapp.LogKeyRepositoryName, repo).Int(githubapp.LogKeyPRNum, pr.GetNumber()).Logger()
+
+		if err := s.handleStale(logger.WithContext(ctx), pullCtx, client, pr); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Error handling stale pull request")
+		}
+		if err := s.UpdatePullRequest(logger.WithContext(ctx), pullCtx, client, pr, pr.GetBase().GetRef(), bulldozer.TriggerSweep); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msg("Error updating pull request")
+		}
+	}
+	return nil
+}
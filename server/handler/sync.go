@@ -0,0 +1,50 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"github.com/google/go-github/github"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/bulldozer"
+)
+
+// syncBranches brings the branches listed in the configuration on the default
+// branch up to date with the default branch.
+func (b *Base) syncBranches(ctx context.Context, client *github.Client, owner, repo, defaultBranch string) error {
+	logger := zerolog.Ctx(ctx)
+
+	bulldozerConfig, err := b.ConfigForRef(ctx, client, owner, repo, defaultBranch)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch configuration")
+	}
+	if bulldozerConfig.Missing() || bulldozerConfig.Invalid() {
+		return nil
+	}
+
+	syncConfig := bulldozerConfig.Config.Update.Sync
+	for _, target := range syncConfig.Branches {
+		if target == defaultBranch {
+			continue
+		}
+		if err := bulldozer.SyncBranch(ctx, client, owner, repo, defaultBranch, target, syncConfig); err != nil {
+			logger.Error().Err(errors.WithStack(err)).Msgf("Failed to sync %s with %s", target, defaultBranch)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUpdateDelay                 = 10 * time.Second
+	DefaultMaxUpdateDelay              = 2 * time.Minute
+	DefaultMaxConcurrentUpdates        = 16
+	DefaultMaxConcurrentUpdatesPerRepo = 4
+)
+
+// UpdateScheduler coalesces and throttles pull request updates. When the
+// base branch receives several pushes in quick succession, each pull request
+// is updated once after the pushes stop, or after the maximum delay if they
+// do not stop.
+//
+// Updates share a server-wide limit on concurrency and a smaller limit in
+// each repository. When updates are waiting for a free slot, owners take
+// turns, so that a repository with many pull requests cannot delay updates in
+// other installations. Within a repository, updates start in the order they
+// were last scheduled.
+type UpdateScheduler struct {
+	// RateLimits, if set, defers the updates of owners that are close to
+	// their GitHub rate limit until the limit resets
+	RateLimits *RateLimits
+
+	delay         time.Duration
+	maxDelay      time.Duration
+	maxConcurrent int
+	maxPerRepo    int
+
+	lock    sync.Mutex
+	batches map[string]*updateBatch
+
+	// waiting holds the updates ready to run for each owner; owners lists
+	// the owners with waiting updates in the order they take turns
+	waiting map[string][]updateTask
+	owners  []string
+	turn    int
+
+	running       int
+	runningByRepo map[string]int
+
+	// retry dispatches deferred updates when the earliest rate limit resets
+	retry   *time.Timer
+	retryAt time.Time
+}
+
+// updateBatch is the set of pending updates in a repository.
+type updateBatch struct {
+	timer   *time.Timer
+	first   time.Time
+	started bool
+	keys    []string
+	updates map[string]func()
+}
+
+type updateTask struct {
+	repo   string
+	update func()
+}
+
+// NewUpdateScheduler creates a scheduler that waits for the delay after the
+// last request to update a pull request before updating it, but no longer
+// than maxDelay after the first request. Non-positive values use the
+// defaults.
+func NewUpdateScheduler(delay, maxDelay time.Duration, maxConcurrent, maxConcurrentPerRepo int) *UpdateScheduler {
+	if delay <= 0 {
+		delay = DefaultUpdateDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxUpdateDelay
+	}
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxConcurrentUpdates
+	}
+	if maxConcurrentPerRepo <= 0 {
+		maxConcurrentPerRepo = DefaultMaxConcurrentUpdatesPerRepo
+	}
+
+	return &UpdateScheduler{
+		delay:         delay,
+		maxDelay:      maxDelay,
+		maxConcurrent: maxConcurrent,
+		maxPerRepo:    maxConcurrentPerRepo,
+		batches:       make(map[string]*updateBatch),
+		waiting:       make(map[string][]updateTask),
+		runningByRepo: make(map[string]int),
+	}
+}
+
+// Schedule runs update once no updates have been scheduled in the repository
+// for the delay, or once the maximum delay has passed since the first update
+// of the batch was scheduled, so that a steady stream of pushes does not
+// postpone updates forever. If an update is already pending for the pull
+// request, it is replaced and moves to the end of the order. Each GitHub App installation
+// belongs to a single owner, so owners identify installations for fairness.
+func (s *UpdateScheduler) Schedule(owner, repo, pullRequest string, update func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fullName := owner + "/" + repo
+
+	batch, ok := s.batches[fullName]
+	if !ok {
+		batch = &updateBatch{first: time.Now(), updates: make(map[string]func())}
+		s.batches[fullName] = batch
+		batch.timer = time.AfterFunc(s.delay, func() { s.run(owner, fullName, batch) })
+	} else {
+		wait := s.delay
+		if remaining := s.maxDelay - time.Since(batch.first); remaining < wait {
+			wait = remaining
+		}
+		batch.timer.Reset(wait)
+	}
+
+	if _, pending := batch.updates[pullRequest]; pending {
+		for i, key := range batch.keys {
+			if key == pullRequest {
+				batch.keys = append(batch.keys[:i], batch.keys[i+1:]...)
+				break
+			}
+		}
+	}
+	batch.keys = append(batch.keys, pullRequest)
+	batch.updates[pullRequest] = update
+}
+
+// run moves the updates in the batch to the waiting updates of the owner and
+// starts as many updates as the limits allow.
+func (s *UpdateScheduler) run(owner, fullName string, batch *updateBatch) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the timer may fire again if it was reset while this batch was starting
+	if batch.started {
+		return
+	}
+	batch.started = true
+	if s.batches[fullName] == batch {
+		delete(s.batches, fullName)
+	}
+
+	if _, ok := s.waiting[owner]; !ok {
+		s.owners = append(s.owners, owner)
+	}
+	for _, key := range batch.keys {
+		s.waiting[owner] = append(s.waiting[owner], updateTask{repo: fullName, update: batch.updates[key]})
+	}
+
+	s.dispatch()
+}
+
+// dispatch starts waiting updates until the server-wide limit is reached or
+// no waiting update has a free slot in its repository. Each owner starts at
+// most one update per turn. The caller must hold the lock.
+func (s *UpdateScheduler) dispatch() {
+	for s.running < s.maxConcurrent && len(s.owners) > 0 {
+		started := false
+		for i := 0; i < len(s.owners) && s.running < s.maxConcurrent; i++ {
+			if s.turn >= len(s.owners) {
+				s.turn = 0
+			}
+			owner := s.owners[s.turn]
+
+			if task, ok := s.next(owner); ok {
+				s.start(task)
+				started = true
+			}
+
+			if len(s.waiting[owner]) == 0 {
+				delete(s.waiting, owner)
+				s.owners = append(s.owners[:s.turn], s.owners[s.turn+1:]...)
+			} else {
+				s.turn++
+			}
+		}
+		if !started {
+			return
+		}
+	}
+}
+
+// next removes and returns the first waiting update of the owner whose
+// repository has a free slot. The caller must hold the lock.
+func (s *UpdateScheduler) next(owner string) (updateTask, bool) {
+	if until := s.RateLimits.DeferUntil(owner, time.Now()); !until.IsZero() {
+		s.retryAfter(until)
+		return updateTask{}, false
+	}
+
+	tasks := s.waiting[owner]
+	for i, task := range tasks {
+		if s.runningByRepo[task.repo] < s.maxPerRepo {
+			s.waiting[owner] = append(tasks[:i], tasks[i+1:]...)
+			return task, true
+		}
+	}
+	return updateTask{}, false
+}
+
+// retryAfter dispatches waiting updates again at the time, unless a retry is
+// already scheduled before it. The caller must hold the lock.
+func (s *UpdateScheduler) retryAfter(t time.Time) {
+	if s.retry != nil && !s.retryAt.After(t) {
+		return
+	}
+	if s.retry != nil {
+		s.retry.Stop()
+	}
+
+	s.retryAt = t
+	s.retry = time.AfterFunc(time.Until(t), func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		s.retry = nil
+		s.dispatch()
+	})
+}
+
+// start runs the update in the background and dispatches more updates when
+// it finishes. The caller must hold the lock.
+func (s *UpdateScheduler) start(task updateTask) {
+	s.running++
+	s.runningByRepo[task.repo]++
+
+	go func() {
+		defer func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+
+			s.running--
+			if s.runningByRepo[task.repo]--; s.runningByRepo[task.repo] == 0 {
+				delete(s.runningByRepo, task.repo)
+			}
+			s.dispatch()
+		}()
+		task.update()
+	}()
+}
+
+// UpdateSchedulerStats is a snapshot of the updates in an UpdateScheduler.
+type UpdateSchedulerStats struct {
+	// Pending is the number of updates waiting for pushes to stop
+	Pending int `json:"pending"`
+
+	// Waiting is the number of updates waiting for a free slot
+	Waiting int `json:"waiting"`
+
+	Running       int            `json:"running"`
+	RunningByRepo map[string]int `json:"running_by_repo"`
+}
+
+// Stats returns the number of pending, waiting, and running updates.
+func (s *UpdateScheduler) Stats() UpdateSchedulerStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := UpdateSchedulerStats{
+		Running:       s.running,
+		RunningByRepo: make(map[string]int, len(s.runningByRepo)),
+	}
+	for _, batch := range s.batches {
+		stats.Pending += len(batch.keys)
+	}
+	for _, tasks := range s.waiting {
+		stats.Waiting += len(tasks)
+	}
+	for repo, n := range s.runningByRepo {
+		stats.RunningByRepo[repo] = n
+	}
+	return stats
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateSchedulerCoalesces(t *testing.T) {
+	s := NewUpdateScheduler(50*time.Millisecond, time.Minute, 1, 1)
+
+	ran := make(chan string, 3)
+	s.Schedule("palantir", "bulldozer", "1", func() { ran <- "first" })
+	s.Schedule("palantir", "bulldozer", "1", func() { ran <- "second" })
+	assert.Equal(t, 1, s.Stats().Pending)
+
+	select {
+	case update := <-ran:
+		assert.Equal(t, "second", update, "the latest update of a pull request replaces earlier ones")
+	case <-time.After(5 * time.Second):
+		t.Fatal("update did not run")
+	}
+
+	select {
+	case update := <-ran:
+		t.Fatalf("unexpected update %s", update)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestUpdateSchedulerMaxDelay(t *testing.T) {
+	s := NewUpdateScheduler(100*time.Millisecond, 300*time.Millisecond, 1, 1)
+
+	ran := make(chan time.Time, 1)
+	start := time.Now()
+
+	// events arrive more often than the delay, so the batch only runs
+	// because of the maximum delay
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			s.Schedule("palantir", "bulldozer", "1", func() {
+				select {
+				case ran <- time.Now():
+				default:
+				}
+			})
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	select {
+	case at := <-ran:
+		assert.True(t, at.Sub(start) >= 300*time.Millisecond, "ran after %s", at.Sub(start))
+	case <-time.After(5 * time.Second):
+		t.Fatal("a steady stream of events postponed the update")
+	}
+}
+
+func TestUpdateSchedulerFairness(t *testing.T) {
+	s := NewUpdateScheduler(10*time.Millisecond, time.Minute, 1, 1)
+
+	var lock sync.Mutex
+	var order []string
+	release := make(chan struct{})
+	finished := make(chan struct{}, 4)
+	update := func(name string) func() {
+		return func() {
+			lock.Lock()
+			order = append(order, name)
+			lock.Unlock()
+
+			<-release
+			finished <- struct{}{}
+		}
+	}
+
+	s.Schedule("a", "one", "1", update("a/one#1"))
+	s.Schedule("a", "one", "2", update("a/one#2"))
+	s.Schedule("a", "one", "3", update("a/one#3"))
+	waitForStats(t, s, func(stats UpdateSchedulerStats) bool { return stats.Running == 1 && stats.Waiting == 2 })
+
+	s.Schedule("b", "two", "1", update("b/two#1"))
+	waitForStats(t, s, func(stats UpdateSchedulerStats) bool { return stats.Waiting == 3 })
+
+	for i := 0; i < 4; i++ {
+		release <- struct{}{}
+		<-finished
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"a/one#1", "b/two#1", "a/one#2", "a/one#3"}, order, "owners take turns")
+}
+
+func TestUpdateSchedulerRepositoryLimit(t *testing.T) {
+	s := NewUpdateScheduler(10*time.Millisecond, time.Minute, 4, 1)
+
+	release := make(chan struct{})
+	finished := make(chan struct{}, 3)
+	update := func() {
+		<-release
+		finished <- struct{}{}
+	}
+
+	s.Schedule("a", "one", "1", update)
+	s.Schedule("a", "one", "2", update)
+	s.Schedule("a", "two", "1", update)
+	waitForStats(t, s, func(stats UpdateSchedulerStats) bool { return stats.Running == 2 })
+
+	stats := s.Stats()
+	assert.Equal(t, 1, stats.Waiting)
+	assert.Equal(t, map[string]int{"a/one": 1, "a/two": 1}, stats.RunningByRepo)
+
+	for i := 0; i < 3; i++ {
+		release <- struct{}{}
+		<-finished
+	}
+	waitForStats(t, s, func(stats UpdateSchedulerStats) bool { return stats.Running == 0 })
+	assert.Equal(t, UpdateSchedulerStats{RunningByRepo: map[string]int{}}, s.Stats())
+}
+
+func waitForStats(t *testing.T, s *UpdateScheduler, ok func(UpdateSchedulerStats) bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !ok(s.Stats()) {
+		require.True(t, time.Now().Before(deadline), "unexpected scheduler stats %+v", s.Stats())
+		time.Sleep(5 * time.Millisecond)
+	}
+}
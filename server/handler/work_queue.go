@@ -0,0 +1,225 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+const (
+	workQueue = "work"
+
+	// DefaultWorkers is the number of deliveries processed at once if the
+	// work queue does not set a number
+	DefaultWorkers = 4
+
+	// workPollInterval is how often idle workers check the queue for
+	// deliveries queued by other servers or left by a previous run
+	workPollInterval = 5 * time.Second
+
+	// workClaimTTL is how long a delivery is reserved for the server that
+	// claimed it. If the server stops before finishing, another server
+	// processes the delivery after the claim expires.
+	workClaimTTL = 10 * time.Minute
+)
+
+// Delivery is a webhook delivery waiting in the work queue.
+type Delivery struct {
+	DeliveryID string          `json:"delivery_id"`
+	EventType  string          `json:"event_type"`
+	Payload    json.RawMessage `json:"payload"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// WorkQueue stores webhook deliveries in the state store and processes them
+// in the background, so that deliveries are not lost if the server stops
+// before processing them. With a persistent store, deliveries received
+// before a restart are processed after it, and servers that share the store
+// share the work.
+type WorkQueue struct {
+	Store   state.Store
+	Workers int
+
+	// Operations tracks the deliveries being processed, so that shutdown can
+	// wait for them. Deliveries that have not started when the server
+	// drains stay in the store for the next server.
+	Operations *Operations
+
+	lock     sync.Mutex
+	handlers map[string]githubapp.EventHandler
+	notify   chan struct{}
+}
+
+// Wrap returns a handler that queues deliveries for h instead of processing
+// them immediately.
+func (q *WorkQueue) Wrap(h githubapp.EventHandler) githubapp.EventHandler {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.init()
+	for _, eventType := range h.Handles() {
+		if _, ok := q.handlers[eventType]; !ok {
+			q.handlers[eventType] = h
+		}
+	}
+	return &queuedHandler{EventHandler: h, queue: q}
+}
+
+func (q *WorkQueue) init() {
+	if q.handlers == nil {
+		q.handlers = make(map[string]githubapp.EventHandler)
+		q.notify = make(chan struct{}, 1)
+	}
+}
+
+type queuedHandler struct {
+	githubapp.EventHandler
+	queue *WorkQueue
+}
+
+func (h *queuedHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	if isInline(ctx) {
+		return handleInline(ctx, h.queue.Operations, h.EventHandler, eventType, deliveryID, payload)
+	}
+	return h.queue.Add(ctx, Delivery{
+		DeliveryID: deliveryID,
+		EventType:  eventType,
+		Payload:    json.RawMessage(payload),
+		ReceivedAt: time.Now().UTC(),
+	})
+}
+
+// Add stores the delivery for processing.
+func (q *WorkQueue) Add(ctx context.Context, d Delivery) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal delivery")
+	}
+
+	if err := q.Store.Enqueue(ctx, workQueue, b); err != nil {
+		return errors.Wrapf(err, "failed to queue delivery %s", d.DeliveryID)
+	}
+
+	zerolog.Ctx(ctx).Debug().Msgf("Queued delivery %s", d.DeliveryID)
+	q.wake()
+	return nil
+}
+
+// wake starts an idle worker, if there is one.
+func (q *WorkQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Start processes queued deliveries until the context is canceled. It
+// returns immediately.
+func (q *WorkQueue) Start(ctx context.Context) {
+	q.lock.Lock()
+	q.init()
+	q.lock.Unlock()
+
+	workers := q.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker(ctx)
+	}
+}
+
+func (q *WorkQueue) worker(ctx context.Context) {
+	ticker := time.NewTicker(workPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// processing continues after ctx is canceled, so that shutdown
+		// does not interrupt a merge or update. Deliveries are not taken
+		// from the queue once the server drains.
+		processCtx := zerolog.Ctx(ctx).WithContext(context.Background())
+
+		var processed bool
+		q.Operations.Run(func() { processed = q.next(processCtx) })
+		if processed && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.notify:
+		}
+	}
+}
+
+// next takes the oldest delivery from the queue and processes it. It returns
+// false if the queue is empty.
+func (q *WorkQueue) next(ctx context.Context) bool {
+	logger := zerolog.Ctx(ctx)
+
+	id, b, ok, err := q.Store.Dequeue(ctx, workQueue, workClaimTTL)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to take delivery from the queue")
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	// there may be more deliveries for the other workers
+	q.wake()
+
+	var d Delivery
+	if err := json.Unmarshal(b, &d); err != nil {
+		logger.Error().Err(err).Msgf("Discarding invalid queued delivery %s", id)
+		q.finish(ctx, id)
+		return true
+	}
+
+	q.lock.Lock()
+	h, ok := q.handlers[d.EventType]
+	q.lock.Unlock()
+
+	if ok {
+		dlogger := logger.With().
+			Str(githubapp.LogKeyEventType, d.EventType).
+			Str(githubapp.LogKeyDeliveryID, d.DeliveryID).
+			Logger()
+
+		dlogger.Debug().Msgf("Processing delivery queued for %s", time.Since(d.ReceivedAt))
+		if err := h.Handle(dlogger.WithContext(ctx), d.EventType, d.DeliveryID, d.Payload); err != nil {
+			dlogger.Error().Err(errors.WithStack(err)).Msg("Unexpected error handling queued webhook")
+		}
+	}
+	q.finish(ctx, id)
+	return true
+}
+
+func (q *WorkQueue) finish(ctx context.Context, id string) {
+	if err := q.Store.Ack(ctx, workQueue, id); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msgf("Failed to remove queued delivery %s", id)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/palantir/bulldozer/state"
+)
+
+type recordingHandler struct {
+	handled chan string
+}
+
+func (h *recordingHandler) Handles() []string {
+	return []string{"pull_request"}
+}
+
+func (h *recordingHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h.handled <- deliveryID
+	return nil
+}
+
+func TestWorkQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := state.NewMemoryStore()
+	h := &recordingHandler{handled: make(chan string, 2)}
+
+	// deliveries queued before the server started are processed
+	previous := &WorkQueue{Store: store}
+	require.NoError(t, previous.Wrap(h).Handle(ctx, "pull_request", "delivery-1", []byte(`{}`)))
+
+	q := &WorkQueue{Store: store, Workers: 1, Operations: &Operations{}}
+	wrapped := q.Wrap(h)
+	q.Start(ctx)
+
+	require.NoError(t, wrapped.Handle(ctx, "pull_request", "delivery-2", []byte(`{}`)))
+
+	for _, id := range []string{"delivery-1", "delivery-2"} {
+		select {
+		case handled := <-h.handled:
+			assert.Equal(t, id, handled)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("delivery %s was not processed", id)
+		}
+	}
+
+	cancel()
+	require.NoError(t, q.Operations.Drain(context.Background()))
+
+	_, _, ok, err := store.Dequeue(context.Background(), workQueue, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "processed deliveries are removed from the queue")
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/version"
+)
+
+// OnboardRepositories opens pull requests that add the configuration in
+// onboarding to the repositories of the owner that the GitHub App of the
+// configuration is installed in. Unless the onboarding is a dry run, the
+// pull requests are opened by the App.
+func OnboardRepositories(ctx context.Context, c *Config, owner string, onboarding *bulldozer.Onboarding) ([]bulldozer.OnboardingResult, error) {
+	c.Options.fillDefaults()
+
+	onboarding.Fetcher = bulldozer.NewConfigFetcher(c.Options.ConfigurationPath, c.Options.ConfigurationV0Paths)
+	if err := onboarding.Validate(); err != nil {
+		return nil, err
+	}
+
+	clientCreator, err := githubapp.NewDefaultCachingClientCreator(
+		c.Github,
+		githubapp.WithClientUserAgent(fmt.Sprintf("%s/%s", c.Options.AppName, version.GetVersion())),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize Github client creator")
+	}
+
+	appClient, err := clientCreator.NewAppClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create app client")
+	}
+	installation, _, err := appClient.Apps.FindOrganizationInstallation(ctx, owner)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find installation for %s", owner)
+	}
+
+	client, err := clientCreator.NewInstallationClient(installation.GetID())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create installation client")
+	}
+
+	var repositories []*github.Repository
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		repos, res, err := client.Apps.ListRepos(ctx, opt)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list installation repositories")
+		}
+		repositories = append(repositories, repos...)
+		if res.NextPage == 0 {
+			break
+		}
+		opt.Page = res.NextPage
+	}
+
+	return onboarding.Run(ctx, client, repositories), nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/palantir/go-githubapp/githubapp"
+
+	"github.com/palantir/bulldozer/outcome"
+)
+
+// outcomeMiddleware counts the GitHub requests made while evaluating a pull
+// request, for the outcome log.
+func outcomeMiddleware() githubapp.ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			outcome.CountRequest(r.Context())
+			return next.RoundTrip(r)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+
+	"github.com/palantir/bulldozer/report"
+)
+
+// reportHandler returns a handler that reports the errors that h returns and
+// the panics in h to the reporter. Panics are recovered and returned as
+// errors, so that the server keeps handling other deliveries.
+func reportHandler(reporter report.ErrorReporter, h githubapp.EventHandler) githubapp.EventHandler {
+	return &reportingHandler{EventHandler: h, reporter: reporter}
+}
+
+type reportingHandler struct {
+	githubapp.EventHandler
+	reporter report.ErrorReporter
+}
+
+func (h *reportingHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) (err error) {
+	ctx = report.WithReporter(ctx, h.reporter)
+	details := report.Details{
+		EventType:  eventType,
+		DeliveryID: deliveryID,
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			details.Panic = true
+			details.Stack = string(debug.Stack())
+			err = errors.Errorf("panic handling %s delivery %s: %v", eventType, deliveryID, r)
+		}
+		report.Report(ctx, err, details)
+	}()
+
+	return h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+}
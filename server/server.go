@@ -15,25 +15,54 @@
 package server
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/palantir/go-baseapp/baseapp"
 	"github.com/palantir/go-baseapp/baseapp/datadog"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
 	"github.com/rs/zerolog"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"goji.io/pat"
 
+	"github.com/palantir/bulldozer/alert"
+	"github.com/palantir/bulldozer/audit"
 	"github.com/palantir/bulldozer/bulldozer"
+	"github.com/palantir/bulldozer/ingest"
+	"github.com/palantir/bulldozer/jira"
+	"github.com/palantir/bulldozer/notify"
+	"github.com/palantir/bulldozer/outcome"
+	"github.com/palantir/bulldozer/report"
+	"github.com/palantir/bulldozer/scm"
 	"github.com/palantir/bulldozer/server/handler"
+	"github.com/palantir/bulldozer/state"
+	"github.com/palantir/bulldozer/tracing"
 	"github.com/palantir/bulldozer/version"
 )
 
 type Server struct {
-	config *Config
-	base   *baseapp.Server
+	config     *Config
+	base       *baseapp.Server
+	apps       []*githubApp
+	operations *handler.Operations
+	tracer     *sdktrace.TracerProvider
+	kafka      *audit.KafkaSink
+	buffered   []*audit.BufferedSink
+	notify     *notify.Queue
+	sentry     *report.SentryReporter
+	statsd     *statsdEmitter
+	webhooks   *handler.WebhookPool
+	archive    *payloadArchive
+	consumers  []*ingest.Consumer
 }
 
 // New instantiates a new Server.
@@ -50,45 +79,312 @@ func New(c *Config) (*Server, error) {
 		return nil, errors.Wrap(err, "failed to initialize base server")
 	}
 
-	userAgent := fmt.Sprintf("%s/%s", c.Options.AppName, version.GetVersion())
-	clientCreator, err := githubapp.NewDefaultCachingClientCreator(
-		c.Github,
-		githubapp.WithClientUserAgent(userAgent),
-		githubapp.WithClientMiddleware(
-			githubapp.ClientLogging(zerolog.DebugLevel),
-			githubapp.ClientMetrics(base.Registry()),
-		),
-	)
+	var stateStore state.Store = state.NewMemoryStore()
+	if c.State.Redis.Address != "" {
+		stateStore = state.NewRedisStore(c.State.Redis)
+	}
+
+	auditSink, buffered, err := newAuditSink(c.Audit, logger)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to initialize Github client creator")
+		return nil, errors.Wrap(err, "failed to initialize audit sinks")
+	}
+
+	// the kafka sink buffers events, so the server closes it on shutdown
+	var kafka *audit.KafkaSink
+	if c.Audit.Kafka.Enabled() {
+		kafka, err = audit.NewKafkaSink(c.Audit.Kafka, logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize audit sinks")
+		}
+		if auditSink != nil {
+			auditSink = audit.MultiSink{auditSink, kafka}
+		} else {
+			auditSink = kafka
+		}
+	}
+
+	var errorReporter report.ErrorReporter
+	var sentry *report.SentryReporter
+	if c.Sentry.DSN != "" {
+		sentry, err = report.NewSentryReporter(c.Sentry, version.GetVersion())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize error reporting")
+		}
+		errorReporter = sentry
+	}
+
+	alerts := alert.New(c.Alerts, stateStore)
+
+	var tracer *sdktrace.TracerProvider
+	if c.Tracing.Enabled() {
+		tracer, err = tracing.NewTracerProvider(c.Tracing)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize tracing")
+		}
+	}
+
+	var emitter *statsdEmitter
+	if c.Statsd.Enabled() {
+		for _, tag := range c.Statsd.EventTags {
+			switch tag {
+			case EventTagOrg, EventTagRepo, EventTagEventType:
+			default:
+				return nil, errors.Errorf("invalid statsd event tag %q", tag)
+			}
+		}
+
+		emitter, err = newStatsdEmitter(base.Registry(), c.Statsd)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize statsd emitter")
+		}
+	}
+
+	if c.Options.DryRun {
+		logger.Warn().Msg("Dry run enabled, bulldozer will not change anything on GitHub")
+	}
+
+	operations := &handler.Operations{}
+
+	concurrency := c.Options.Concurrency
+	if !concurrency.Webhooks.Overflow.Valid() || !concurrency.Merges.Overflow.Valid() {
+		return nil, errors.New("invalid concurrency overflow policy, expected \"block\" or \"drop\"")
+	}
+
+	var webhookPool *handler.WebhookPool
+	if concurrency.Webhooks.Workers > 0 && !c.Options.WorkQueue.Enabled {
+		webhookPool = &handler.WebhookPool{
+			Workers:    concurrency.Webhooks.Workers,
+			QueueSize:  concurrency.Webhooks.QueueSize,
+			Overflow:   concurrency.Webhooks.Overflow,
+			Registry:   base.Registry(),
+			Operations: operations,
+		}
+	}
+
+	var mergeLimiter *handler.MergeLimiter
+	if m := concurrency.Merges; m.Workers > 0 || m.MaxPerRepo > 0 {
+		mergeLimiter = handler.NewMergeLimiter(m.Workers, m.MaxPerRepo, m.QueueSize, m.Overflow)
+		mergeLimiter.Registry = base.Registry()
 	}
 
-	baseHandler := handler.Base{
-		ClientCreator: clientCreator,
-		ConfigFetcher: bulldozer.NewConfigFetcher(c.Options.ConfigurationPath, c.Options.ConfigurationV0Paths),
+	var payloads *payloadArchive
+	if c.Archive.Enabled() {
+		payloads = newPayloadArchive(c.Archive, operations)
 	}
 
-	webhookHandler := githubapp.NewDefaultEventDispatcher(c.Github,
-		&handler.IssueComment{Base: baseHandler},
-		&handler.PullRequestReview{Base: baseHandler},
-		&handler.Push{Base: baseHandler},
-		&handler.Status{Base: baseHandler},
-	)
+	outcomes, err := outcome.New(c.Outcomes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize outcome log")
+	}
+
+	notifiers, err := notify.New(c.Notifications)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize notifications")
+	}
+	var notifyQueue *notify.Queue
+	if len(notifiers) > 0 {
+		notifyQueue = notify.NewQueue(c.Notifications)
+	}
+
+	services := appServices{
+		registry:      base.Registry(),
+		stateStore:    stateStore,
+		auditSink:     auditSink,
+		errorReporter: errorReporter,
+		tracer:        tracer,
+		statsd:        emitter,
+		operations:    operations,
+		webhookPool:   webhookPool,
+		mergeLimiter:  mergeLimiter,
+		archive:       payloads,
+		admin:         c.Admin.Enabled(),
+		outcomes:      outcomes,
+		notifiers:     notifiers,
+		notifyQueue:   notifyQueue,
+		alerts:        alerts,
+	}
+	if c.Jira.Enabled() {
+		if len(c.Jira.Projects) == 0 {
+			return nil, errors.New("jira requires the projects whose issues may be transitioned")
+		}
+		services.jira = jira.NewClient(c.Jira)
+	}
+
+	primary, err := newGithubApp(c, "", c.Github, c.Options.Updates.SweepRepositories, c.Options.PreviousWebhookSecrets, services)
+	if err != nil {
+		return nil, err
+	}
+	apps := []*githubApp{primary}
+
+	names := make(map[string]bool)
+	for _, ac := range c.Apps {
+		if ac.Name == "" || names[ac.Name] {
+			return nil, errors.Errorf("additional GitHub Apps must have unique, non-empty names: %q", ac.Name)
+		}
+		names[ac.Name] = true
+
+		app, err := newGithubApp(c, ac.Name, ac.Github, ac.SweepRepositories, ac.PreviousWebhookSecrets, services)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to initialize GitHub App %q", ac.Name)
+		}
+		apps = append(apps, app)
+	}
 
 	mux := base.Mux()
 
-	// webhook route
-	mux.Handle(pat.Post(githubapp.DefaultWebhookRoute), webhookHandler)
+	// webhook routes
+	webhooks := func(h http.Handler) http.Handler {
+		if c.Logging.Access.Enabled {
+			return accessLogHandler(c.Logging.Access, h)
+		}
+		return h
+	}
+	mux.Handle(pat.Post(githubapp.DefaultWebhookRoute), webhooks(webhookRouter(apps)))
+	for _, app := range apps[1:] {
+		mux.Handle(pat.Post(githubapp.DefaultWebhookRoute+"/"+app.name), webhooks(app.dispatcher))
+	}
+	if c.GitLab.Enabled() {
+		if c.GitLab.WebhookSecret == "" {
+			return nil, errors.New("gitlab requires a webhook secret")
+		}
+		mux.Handle(pat.Post("/api/gitlab/hook"), webhooks(primary.base.GitLabWebhook(scm.NewGitLab(c.GitLab), c.GitLab.WebhookSecret)))
+	}
+	if c.Gitea.Enabled() {
+		if c.Gitea.WebhookSecret == "" {
+			return nil, errors.New("gitea requires a webhook secret")
+		}
+		mux.Handle(pat.Post("/api/gitea/hook"), webhooks(primary.base.GiteaWebhook(scm.NewGitea(c.Gitea), c.Gitea.WebhookSecret)))
+	}
+
+	// deliveries from message queues are handled like webhooks
+	sources, err := c.Ingest.Sources()
+	if err != nil {
+		return nil, err
+	}
+	var consumers []*ingest.Consumer
+	for _, source := range sources {
+		consumers = append(consumers, &ingest.Consumer{
+			Source:  source,
+			Handler: inline(webhooks(webhookRouter(apps))),
+		})
+	}
 
 	// any additional API routes
+	readinessChecks := []handler.ReadinessCheck{
+		handler.StateStoreCheck(stateStore),
+	}
+	for _, app := range apps {
+		appCheck := handler.GithubAppCheck(app.clientCreator)
+		secretCheck := handler.WebhookSecretCheck(app.config.App.WebhookSecret)
+		if app.name != "" {
+			appCheck.Name += "_" + app.name
+			secretCheck.Name += "_" + app.name
+		}
+		readinessChecks = append(readinessChecks, appCheck, secretCheck)
+	}
+
 	mux.Handle(pat.Get("/api/health"), handler.Health())
+	mux.Handle(pat.Get("/health/live"), handler.Live())
+	mux.Handle(pat.Get("/health/ready"), handler.Ready(readinessChecks...))
+
+	if c.Admin.Enabled() {
+		auth := func(h http.Handler) http.Handler {
+			return handler.RequireBasicAuth(c.Admin.Username, c.Admin.Password, h)
+		}
+
+		for _, app := range apps {
+			prefix, apiPrefix := "/admin", "/api"
+			if app.name != "" {
+				prefix = "/admin/apps/" + app.name
+				apiPrefix = "/api/apps/" + app.name
+			}
+			mux.Handle(pat.Get(prefix+"/dashboard"), auth(handler.Dashboard(app.base.MergeQueue, app.store, app.activity)))
+			mux.Handle(pat.Get(apiPrefix+"/repos/:owner/:repo/pulls/:number/status"), auth(app.base.PullRequestStatus()))
+			mux.Handle(pat.Post(apiPrefix+"/repos/:owner/:repo/pulls/:number/evaluate"), auth(app.base.EvaluatePullRequest()))
+			mux.Handle(pat.Get(prefix+"/installations"), auth(handler.InstallationStatsHandler(app.stats, []*bulldozer.MergeQueue{app.base.MergeQueue}, []*handler.RateLimits{app.base.RateLimits})))
+			mux.Handle(pat.Get(prefix+"/pauses"), auth(handler.ListRepositoryPauses(app.store)))
+			mux.Handle(pat.Put(prefix+"/pauses/:owner"), auth(handler.PauseRepository(app.store)))
+			mux.Handle(pat.Put(prefix+"/pauses/:owner/:repo"), auth(handler.PauseRepository(app.store)))
+			mux.Handle(pat.Delete(prefix+"/pauses/:owner"), auth(handler.ResumeRepository(app.store)))
+			mux.Handle(pat.Delete(prefix+"/pauses/:owner/:repo"), auth(handler.ResumeRepository(app.store)))
+			mux.Handle(pat.Get(prefix+"/dead-letters"), auth(handler.ListDeadLetters(app.deadLetters)))
+			mux.Handle(pat.Post(prefix+"/dead-letters/:delivery/replay"), auth(handler.ReplayDeadLetter(app.deadLetters)))
+			mux.Handle(pat.Delete(prefix+"/dead-letters/:delivery"), auth(handler.DeleteDeadLetter(app.deadLetters)))
+			mux.Handle(pat.Get(prefix+"/queues/:owner/:repo"), auth(app.base.ListQueues()))
+			mux.Handle(pat.Delete(prefix+"/queues/:owner/:repo/:number"), auth(app.base.RemoveFromQueue()))
+			mux.Handle(pat.Put(prefix+"/queues/:owner/:repo/:number/position"), auth(app.base.MoveInQueue()))
+		}
+		var maintenance []*handler.Maintenance
+		for _, app := range apps {
+			maintenance = append(maintenance, app.maintenance)
+		}
+		mux.Handle(pat.Get("/admin/maintenance"), auth(handler.MaintenanceStatusHandler(maintenance...)))
+		mux.Handle(pat.Put("/admin/maintenance"), auth(handler.EnableMaintenance(maintenance...)))
+		mux.Handle(pat.Delete("/admin/maintenance"), auth(handler.DisableMaintenance(maintenance...)))
+
+		if c.Admin.Debug {
+			registerDebugRoutes(mux, auth, apps, webhookPool, mergeLimiter)
+		}
+	}
 
 	return &Server{
-		config: c,
-		base:   base,
+		config:     c,
+		base:       base,
+		apps:       apps,
+		operations: operations,
+		tracer:     tracer,
+		kafka:      kafka,
+		buffered:   buffered,
+		notify:     notifyQueue,
+		sentry:     sentry,
+		statsd:     emitter,
+		webhooks:   webhookPool,
+		archive:    payloads,
+		consumers:  consumers,
 	}, nil
 }
 
+// newAuditSink returns the configured sinks, or nil if none is configured.
+// Sinks that send events over the network record them in the background, so
+// the server closes the returned buffered sinks on shutdown.
+func newAuditSink(c AuditConfig, logger zerolog.Logger) (audit.Sink, []*audit.BufferedSink, error) {
+	var sinks audit.MultiSink
+	var buffered []*audit.BufferedSink
+
+	if c.Stdout {
+		sinks = append(sinks, audit.NewWriterSink(os.Stdout))
+	}
+
+	if c.File != "" {
+		fileSink, err := audit.NewFileSink(c.File, int64(c.FileMaxSizeMB)*1024*1024, c.FileMaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		sinks = append(sinks, fileSink)
+	}
+
+	if c.HTTP.URL != "" {
+		httpSink := audit.NewHTTPSink(c.HTTP.URL, c.HTTP.Headers)
+		httpSink.CloudEvents = c.HTTP.CloudEvents
+		buffered = append(buffered, audit.NewBufferedSink(httpSink, logger))
+	}
+
+	if c.S3.Bucket != "" {
+		if c.S3.Region == "" {
+			return nil, nil, errors.New("audit S3 bucket requires a region")
+		}
+		buffered = append(buffered, audit.NewBufferedSink(audit.NewS3Sink(c.S3), logger))
+	}
+
+	for _, s := range buffered {
+		sinks = append(sinks, s)
+	}
+	if len(sinks) == 0 {
+		return nil, nil, nil
+	}
+	return sinks, buffered, nil
+}
+
 func configureLogger(c LoggingConfig) (zerolog.Logger, error) {
 	out := io.Writer(os.Stdout)
 	if c.Text {
@@ -104,12 +400,143 @@ func configureLogger(c LoggingConfig) (zerolog.Logger, error) {
 	return zerolog.New(out).With().Timestamp().Logger(), nil
 }
 
-// Start is blocking and long-running
+// Start is blocking and long-running. When the process receives SIGTERM or
+// SIGINT, the server stops accepting requests, waits for running merges and
+// updates to finish, and returns nil.
 func (s *Server) Start() error {
 	if s.config.Datadog.Address != "" {
 		if err := datadog.StartEmitter(s.base, s.config.Datadog); err != nil {
 			return err
 		}
 	}
-	return s.base.Start()
+
+	logger := s.base.Logger()
+	background, stopBackground := context.WithCancel(logger.WithContext(context.Background()))
+	defer stopBackground()
+
+	if s.archive != nil {
+		go s.archive.Run(background)
+	}
+	if s.webhooks != nil {
+		s.webhooks.Start(background)
+	}
+	for _, consumer := range s.consumers {
+		go consumer.Run(background)
+	}
+	for _, app := range s.apps {
+		if app.sweep != nil {
+			app.sweep.Start(background)
+		}
+		if app.workQueue != nil {
+			app.workQueue.Start(background)
+		}
+		app.maintenance.Start(background)
+		if app.catchUp != nil {
+			app.catchUp.Start(background)
+		}
+		app.scheduler.Start(background)
+	}
+	if s.notify != nil {
+		s.notify.Start(background)
+	}
+	if s.statsd != nil {
+		go s.statsd.Run(background, s.config.Statsd.Interval)
+	}
+
+	registry := s.base.Registry()
+	baseapp.RegisterDefaultMetrics(registry)
+	go collectRuntimeMetrics(background, registry)
+
+	httpConfig := s.base.HTTPConfig()
+	addr := httpConfig.Address + ":" + strconv.Itoa(httpConfig.Port)
+	httpServer := &http.Server{Addr: addr, Handler: s.base.Mux()}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	errs := make(chan error, 1)
+	go func() {
+		logger.Info().Msgf("Server listening on %s", addr)
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	timeout := s.config.Options.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		logger.Info().Msgf("Received %s, shutting down within %s", sig, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// stop accepting webhooks and wait for the ones being handled
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to finish handling requests before shutting down")
+	}
+
+	// queued deliveries that have not started stay in the state store, while
+	// deliveries waiting for a webhook worker are handled before draining
+	stopBackground()
+	if s.webhooks != nil {
+		if err := s.webhooks.Wait(ctx); err != nil {
+			logger.Error().Err(err).Msg("Failed to handle queued webhooks before shutting down")
+		}
+	}
+	if err := s.operations.Drain(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to finish merges and updates before shutting down")
+		return nil
+	}
+	if s.tracer != nil {
+		if err := s.tracer.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("Failed to export spans before shutting down")
+		}
+	}
+	if err := s.kafka.Close(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to produce audit events to kafka before shutting down")
+	}
+	for _, sink := range s.buffered {
+		if err := sink.Close(ctx); err != nil {
+			logger.Error().Err(err).Msg("Failed to record audit events before shutting down")
+		}
+	}
+	if err := s.notify.Flush(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to send notifications before shutting down")
+	}
+	if err := s.sentry.Flush(ctx); err != nil {
+		logger.Error().Err(err).Msg("Failed to report errors before shutting down")
+	}
+
+	logger.Info().Msg("Server stopped")
+	return nil
+}
+
+// collectRuntimeMetrics updates the default runtime metrics of the registry
+// until the context is canceled.
+func collectRuntimeMetrics(ctx context.Context, registry metrics.Registry) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	var memStats runtime.MemStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if g, ok := registry.Get(baseapp.MetricsKeyNumGoroutines).(metrics.Gauge); ok {
+			g.Update(int64(runtime.NumGoroutine()))
+		}
+		if g, ok := registry.Get(baseapp.MetricsKeyMemoryUsed).(metrics.Gauge); ok {
+			runtime.ReadMemStats(&memStats)
+			g.Update(int64(memStats.Alloc))
+		}
+	}
 }
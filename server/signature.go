@@ -0,0 +1,97 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/google/go-github/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+)
+
+const (
+	signatureHeader       = "X-Hub-Signature"
+	signatureSHA256Header = "X-Hub-Signature-256"
+)
+
+// signatureDispatcher verifies the signature of webhook deliveries with any
+// of several secrets, so that the secret can be rotated without rejecting
+// deliveries signed with the previous one, and dispatches each delivery to
+// the handlers. The SHA-256 signature is used if GitHub sent one.
+type signatureDispatcher struct {
+	secrets     []string
+	dispatchers []http.Handler
+}
+
+// newSignatureDispatcher returns a dispatcher that accepts deliveries signed
+// with any of the non-empty secrets. If there are none, every delivery is
+// rejected, like by the default dispatcher.
+func newSignatureDispatcher(secrets []string, handlers ...githubapp.EventHandler) http.Handler {
+	d := &signatureDispatcher{}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		d.secrets = append(d.secrets, secret)
+		d.dispatchers = append(d.dispatchers, githubapp.NewEventDispatcher(handlers, secret, nil))
+	}
+	if len(d.secrets) == 0 {
+		return githubapp.NewEventDispatcher(handlers, "", nil)
+	}
+	return d
+}
+
+func (d *signatureDispatcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-GitHub-Event") == "" {
+		d.dispatchers[0].ServeHTTP(w, r)
+		return
+	}
+
+	logger := zerolog.Ctx(r.Context())
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to read webhook payload")
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	signature := r.Header.Get(signatureSHA256Header)
+	if signature == "" {
+		signature = r.Header.Get(signatureHeader)
+	}
+
+	for i, secret := range d.secrets {
+		if github.ValidateSignature(signature, body, []byte(secret)) != nil {
+			continue
+		}
+		if i > 0 {
+			logger.Debug().Msgf("Webhook payload is signed with previous secret %d", i)
+		}
+
+		// the dispatcher validates the signature again using the header
+		// that older GitHub versions send, so pass the verified signature
+		r.Header.Set(signatureHeader, signature)
+		d.dispatchers[i].ServeHTTP(w, r)
+		return
+	}
+
+	logger.Warn().Str(githubapp.LogKeyDeliveryID, r.Header.Get("X-GitHub-Delivery")).Msg("Webhook payload signature does not match any secret")
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
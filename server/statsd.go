@@ -0,0 +1,245 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-go/statsd"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/pkg/errors"
+	"github.com/rcrowley/go-metrics"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DefaultStatsdAddress  = "127.0.0.1:8125"
+	DefaultStatsdInterval = 10 * time.Second
+
+	// MetricsKeyWebhooks counts webhook deliveries and MetricsKeyWebhookDuration
+	// times their handling. The registry keeps the totals; the statsd
+	// emitter sends them tagged with the event tags of the statsd config.
+	MetricsKeyWebhooks        = "bulldozer.webhooks"
+	MetricsKeyWebhookDuration = "bulldozer.webhooks.duration"
+
+	EventTagOrg       = "org"
+	EventTagRepo      = "repo"
+	EventTagEventType = "event_type"
+)
+
+// StatsdConfig configures pushing metrics to a StatsD or DogStatsD server.
+// Pushing is disabled unless an address is set.
+type StatsdConfig struct {
+	Address  string        `yaml:"address"`
+	Interval time.Duration `yaml:"interval"`
+	Prefix   string        `yaml:"prefix"`
+
+	// If true, tags are sent using the DogStatsD format. Otherwise, tags of
+	// metrics are appended to their names and global tags are not sent.
+	DogStatsD bool     `yaml:"dogstatsd"`
+	Tags      []string `yaml:"tags"`
+
+	// EventTags are the dimensions added to the webhook metrics: any of
+	// "org", "repo", and "event_type"
+	EventTags []string `yaml:"event_tags"`
+}
+
+func (c StatsdConfig) Enabled() bool {
+	return c.Address != ""
+}
+
+// statsdEmitter pushes the metrics of a registry to a StatsD server.
+type statsdEmitter struct {
+	registry  metrics.Registry
+	client    *statsd.Client
+	dogstatsd bool
+
+	// eventTags are sent with every webhook, instead of the untagged webhook
+	// metrics of the registry
+	eventTags []string
+
+	// counts are the last values sent for each counter, since StatsD counts
+	// are deltas
+	counts map[string]int64
+}
+
+func newStatsdEmitter(registry metrics.Registry, c StatsdConfig) (*statsdEmitter, error) {
+	address := c.Address
+	if address == "" {
+		address = DefaultStatsdAddress
+	}
+
+	client, err := statsd.New(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create statsd client")
+	}
+	client.Namespace = c.Prefix
+	if c.DogStatsD {
+		client.Tags = append(client.Tags, c.Tags...)
+	}
+
+	return &statsdEmitter{
+		registry:  registry,
+		client:    client,
+		dogstatsd: c.DogStatsD,
+		eventTags: c.EventTags,
+		counts:    make(map[string]int64),
+	}, nil
+}
+
+// Run pushes metrics at the interval until the context is canceled.
+func (e *statsdEmitter) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultStatsdInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.flush()
+			_ = e.client.Close()
+			return
+		case <-ticker.C:
+			e.flush()
+		}
+	}
+}
+
+func (e *statsdEmitter) flush() {
+	e.registry.Each(func(name string, i interface{}) {
+		if len(e.eventTags) > 0 && (name == MetricsKeyWebhooks || name == MetricsKeyWebhookDuration) {
+			return
+		}
+
+		switch m := i.(type) {
+		case metrics.Counter:
+			count := m.Count()
+			_ = e.client.Count(name, count-e.counts[name], nil, 1)
+			e.counts[name] = count
+		case metrics.Gauge:
+			_ = e.client.Gauge(name, float64(m.Value()), nil, 1)
+		case metrics.GaugeFloat64:
+			_ = e.client.Gauge(name, m.Value(), nil, 1)
+		case metrics.Histogram:
+			s := m.Snapshot()
+			_ = e.client.Gauge(name+".count", float64(s.Count()), nil, 1)
+			_ = e.client.Gauge(name+".max", float64(s.Max()), nil, 1)
+			_ = e.client.Gauge(name+".mean", s.Mean(), nil, 1)
+			_ = e.client.Gauge(name+".p95", s.Percentile(0.95), nil, 1)
+		case metrics.Meter:
+			s := m.Snapshot()
+			_ = e.client.Gauge(name+".count", float64(s.Count()), nil, 1)
+			_ = e.client.Gauge(name+".rate1", s.Rate1(), nil, 1)
+		case metrics.Timer:
+			s := m.Snapshot()
+			_ = e.client.Gauge(name+".count", float64(s.Count()), nil, 1)
+			_ = e.client.Gauge(name+".max", millis(float64(s.Max())), nil, 1)
+			_ = e.client.Gauge(name+".mean", millis(s.Mean()), nil, 1)
+			_ = e.client.Gauge(name+".p95", millis(s.Percentile(0.95)), nil, 1)
+		}
+	})
+	_ = e.client.Flush()
+}
+
+func millis(nanos float64) float64 {
+	return nanos / float64(time.Millisecond)
+}
+
+// webhook sends the webhook metrics of a delivery, tagged with the event
+// tags. Tags are only sent to the StatsD server, so that the registry does not
+// keep a metric for every repository.
+func (e *statsdEmitter) webhook(eventType, owner, repository string, d time.Duration) {
+	var tags []string
+	for _, tag := range e.eventTags {
+		switch tag {
+		case EventTagOrg:
+			tags = append(tags, EventTagOrg+":"+owner)
+		case EventTagRepo:
+			tags = append(tags, EventTagRepo+":"+repository)
+		case EventTagEventType:
+			tags = append(tags, EventTagEventType+":"+eventType)
+		}
+	}
+
+	name, tags := e.nameAndTags(MetricsKeyWebhooks, tags)
+	_ = e.client.Count(name, 1, tags, 1)
+
+	name, tags = e.nameAndTags(MetricsKeyWebhookDuration, tags)
+	_ = e.client.Timing(name, d, tags, 1)
+}
+
+var unsafeStatsdChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// nameAndTags returns the metric name and the tags to send. Without
+// DogStatsD, the tag values are appended to the name instead.
+func (e *statsdEmitter) nameAndTags(name string, tags []string) (string, []string) {
+	if e.dogstatsd {
+		return name, tags
+	}
+
+	for _, tag := range tags {
+		if j := strings.IndexByte(tag, ':'); j >= 0 {
+			tag = tag[j+1:]
+		}
+		name += "." + unsafeStatsdChars.ReplaceAllString(tag, "_")
+	}
+	return name, nil
+}
+
+// metricsHandler returns a handler that counts and times the deliveries that
+// h handles. If the emitter is set and has event tags, it also sends the
+// tagged metrics of each delivery.
+func metricsHandler(registry metrics.Registry, emitter *statsdEmitter, h githubapp.EventHandler) githubapp.EventHandler {
+	return &measuredHandler{EventHandler: h, registry: registry, emitter: emitter}
+}
+
+type measuredHandler struct {
+	githubapp.EventHandler
+	registry metrics.Registry
+	emitter  *statsdEmitter
+}
+
+func (h *measuredHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	start := time.Now()
+	err := h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+
+	metrics.GetOrRegisterCounter(MetricsKeyWebhooks, h.registry).Inc(1)
+	metrics.GetOrRegisterTimer(MetricsKeyWebhookDuration, h.registry).UpdateSince(start)
+
+	if h.emitter == nil || len(h.emitter.eventTags) == 0 {
+		return err
+	}
+
+	var event struct {
+		Repository struct {
+			FullName string `json:"full_name"`
+			Owner    struct {
+				Login string `json:"login"`
+			} `json:"owner"`
+		} `json:"repository"`
+	}
+	if jerr := json.Unmarshal(payload, &event); jerr != nil {
+		zerolog.Ctx(ctx).Debug().Err(jerr).Msg("Failed to parse payload for webhook metrics")
+	}
+	h.emitter.webhook(eventType, event.Repository.Owner.Login, event.Repository.FullName, time.Since(start))
+	return err
+}
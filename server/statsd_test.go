@@ -0,0 +1,89 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statsdPackets starts a UDP server and returns its address and a function
+// that returns the lines received so far.
+func statsdPackets(t *testing.T) (string, func() []string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn.LocalAddr().String(), func() []string {
+		var lines []string
+		buf := make([]byte, 65536)
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return lines
+			}
+			lines = append(lines, strings.Split(strings.TrimSpace(string(buf[:n])), "\n")...)
+		}
+	}
+}
+
+func TestMetricsHandlerTags(t *testing.T) {
+	address, received := statsdPackets(t)
+	registry := metrics.NewRegistry()
+
+	emitter, err := newStatsdEmitter(registry, StatsdConfig{
+		Address:   address,
+		DogStatsD: true,
+		EventTags: []string{EventTagRepo, EventTagEventType},
+	})
+	require.NoError(t, err)
+
+	h := metricsHandler(registry, emitter, noopHandler{})
+	payload := []byte(`{"repository": {"full_name": "palantir/bulldozer", "owner": {"login": "palantir"}}}`)
+	require.NoError(t, h.Handle(context.Background(), "pull_request", "d1", payload))
+	emitter.flush()
+
+	var names []string
+	registry.Each(func(name string, _ interface{}) {
+		names = append(names, name)
+	})
+	assert.ElementsMatch(t, []string{MetricsKeyWebhooks, MetricsKeyWebhookDuration}, names, "the registry only has untagged metrics")
+
+	lines := received()
+	assert.Contains(t, lines, "bulldozer.webhooks:1|c|#repo:palantir/bulldozer,event_type:pull_request")
+	for _, line := range lines {
+		assert.Contains(t, line, "#repo:palantir/bulldozer", "untagged webhook metrics are not sent: %s", line)
+	}
+}
+
+func TestStatsdNameAndTags(t *testing.T) {
+	e := &statsdEmitter{}
+	name, tags := e.nameAndTags(MetricsKeyWebhooks, []string{"org:palantir", "repo:palantir/bulldozer"})
+	assert.Equal(t, "bulldozer.webhooks.palantir.palantir_bulldozer", name)
+	assert.Empty(t, tags)
+
+	e.dogstatsd = true
+	name, tags = e.nameAndTags(MetricsKeyWebhooks, []string{"org:palantir"})
+	assert.Equal(t, MetricsKeyWebhooks, name)
+	assert.Equal(t, []string{"org:palantir"}, tags)
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/palantir/go-githubapp/githubapp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/palantir/bulldozer/tracing"
+)
+
+// traceHandler returns a handler that records a span for each delivery that
+// h handles. Spans started while handling the delivery, including those for
+// requests to GitHub, are part of the same trace.
+func traceHandler(provider trace.TracerProvider, h githubapp.EventHandler) githubapp.EventHandler {
+	return &tracedHandler{EventHandler: h, tracer: provider.Tracer(tracing.InstrumentationName)}
+}
+
+type tracedHandler struct {
+	githubapp.EventHandler
+	tracer trace.Tracer
+}
+
+func (h *tracedHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	ctx, span := h.tracer.Start(ctx, "webhook "+eventType, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("github.event", eventType),
+		attribute.String("github.delivery_id", deliveryID),
+	)
+
+	err := h.EventHandler.Handle(ctx, eventType, deliveryID, payload)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// tracingMiddleware records a span for each request to GitHub that is sent
+// with a traced context.
+func tracingMiddleware() githubapp.ClientMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			_, span := tracing.Start(r.Context(), "github "+r.Method, trace.WithSpanKind(trace.SpanKindClient))
+			defer span.End()
+
+			span.SetAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+			)
+
+			res, err := next.RoundTrip(r)
+			if err != nil {
+				tracing.RecordError(span, err)
+				return res, err
+			}
+			span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+			return res, nil
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const lockPrefix = "lock/"
+
+// lockPollInterval is how often WaitLock retries a held lock.
+const lockPollInterval = 250 * time.Millisecond
+
+// TryLock acquires the lock with the name if no one holds it, returning a
+// function that releases it. The lock is released automatically after ttl,
+// so that locks held by servers that stop are not held forever. With a store
+// shared by several servers, at most one of them holds a lock at a time.
+//
+// Each acquisition stores a random token, and releasing only deletes the
+// lock if it still has the token, so that a holder whose lock expired does
+// not release the lock of the next holder.
+func TryLock(ctx context.Context, store Store, name string, ttl time.Duration) (func(), bool, error) {
+	key := lockPrefix + name
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, false, errors.Wrap(err, "failed to generate lock token")
+	}
+	token = []byte(hex.EncodeToString(token))
+
+	ok, err := store.SetIfAbsent(ctx, key, token, ttl)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to acquire lock %q", name)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+
+	release := func() {
+		// use a new context so the lock is released if ctx was canceled
+		_, _ = store.CompareAndDelete(context.Background(), key, token)
+	}
+	return release, true, nil
+}
+
+// WaitLock acquires the lock with the name, waiting until it is released or
+// the context is done. See TryLock for details.
+func WaitLock(ctx context.Context, store Store, name string, ttl time.Duration) (func(), error) {
+	for {
+		release, ok, err := TryLock(ctx, store, name, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return release, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "timed out waiting for lock %q", name)
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
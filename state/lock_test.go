@@ -0,0 +1,79 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	s, advance := newTestMemoryStore()
+
+	release, ok, err := TryLock(ctx, s, "pr", time.Hour)
+	require.Nil(t, err)
+	require.True(t, ok)
+
+	_, ok, err = TryLock(ctx, s, "pr", time.Hour)
+	require.Nil(t, err)
+	assert.False(t, ok, "held locks cannot be acquired")
+
+	_, ok, err = TryLock(ctx, s, "other", time.Hour)
+	require.Nil(t, err)
+	assert.True(t, ok, "locks are independent")
+
+	release()
+	release, ok, err = TryLock(ctx, s, "pr", time.Hour)
+	require.Nil(t, err)
+	assert.True(t, ok, "released locks can be acquired")
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = WaitLock(timeoutCtx, s, "pr", time.Hour)
+	assert.Error(t, err, "waiting stops when the context is done")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	release, err = WaitLock(ctx, s, "pr", time.Hour)
+	require.Nil(t, err)
+	release()
+
+	_, ok, err = TryLock(ctx, s, "expiring", time.Millisecond)
+	require.Nil(t, err)
+	require.True(t, ok)
+	advance(time.Millisecond)
+	_, ok, err = TryLock(ctx, s, "expiring", time.Millisecond)
+	require.Nil(t, err)
+	assert.True(t, ok, "locks expire")
+
+	expired, ok, err := TryLock(ctx, s, "reacquired", time.Millisecond)
+	require.Nil(t, err)
+	require.True(t, ok)
+	advance(time.Millisecond)
+	_, ok, err = TryLock(ctx, s, "reacquired", time.Hour)
+	require.Nil(t, err)
+	require.True(t, ok)
+	expired()
+	_, ok, err = TryLock(ctx, s, "reacquired", time.Hour)
+	require.Nil(t, err)
+	assert.False(t, ok, "releasing an expired lock does not release the next holder's lock")
+}
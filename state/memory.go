@@ -0,0 +1,262 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// memorySweepInterval is the shortest time between removals of all expired
+// entries of a MemoryStore
+const memorySweepInterval = time.Minute
+
+// MemoryStore is a Store that keeps values in memory. Values are lost when
+// the server restarts. Expired values are removed when they are read and,
+// at most once per memorySweepInterval, when values are written, so that
+// keys that are never read again do not grow the store without limit.
+type MemoryStore struct {
+	lock      sync.Mutex
+	entries   map[string]memoryEntry
+	queues    map[string][]memoryQueueEntry
+	lastID    int64
+	lastSweep time.Time
+
+	// now returns the current time; tests replace it to expire entries
+	now func() time.Time
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+type memoryQueueEntry struct {
+	id           string
+	value        []byte
+	claimedUntil time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		queues:  make(map[string][]memoryQueueEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.lookup(key, s.now())
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]byte(nil), e.value...), true, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	e := memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		e.expiresAt = now.Add(ttl)
+	}
+	s.entries[key] = e
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if _, ok := s.lookup(key, now); ok {
+		return false, nil
+	}
+
+	e := memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		e.expiresAt = now.Add(ttl)
+	}
+	s.entries[key] = e
+	return true, nil
+}
+
+func (s *MemoryStore) CompareAndDelete(ctx context.Context, key string, value []byte) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e, ok := s.lookup(key, s.now())
+	if !ok || !bytes.Equal(e.value, value) {
+		return false, nil
+	}
+	delete(s.entries, key)
+	return true, nil
+}
+
+func (s *MemoryStore) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	e, ok := s.lookup(key, now)
+	if !ok {
+		e = memoryEntry{value: []byte("0")}
+		if ttl > 0 {
+			e.expiresAt = now.Add(ttl)
+		}
+	}
+
+	n, err := strconv.ParseInt(string(e.value), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "value of %q is not a counter", key)
+	}
+	n++
+
+	e.value = []byte(strconv.FormatInt(n, 10))
+	s.entries[key] = e
+	return n, nil
+}
+
+func (s *MemoryStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+
+	var keys []string
+	for key := range s.entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if _, ok := s.lookup(key, now); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *MemoryStore) Enqueue(ctx context.Context, queue string, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastID++
+	s.queues[queue] = append(s.queues[queue], memoryQueueEntry{
+		id:    strconv.FormatInt(s.lastID, 10),
+		value: append([]byte(nil), value...),
+	})
+	return nil
+}
+
+func (s *MemoryStore) Dequeue(ctx context.Context, queue string, claim time.Duration) (string, []byte, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	entries := s.queues[queue]
+	for i := range entries {
+		if now.Before(entries[i].claimedUntil) {
+			continue
+		}
+		entries[i].claimedUntil = now.Add(claim)
+		return entries[i].id, append([]byte(nil), entries[i].value...), true, nil
+	}
+	return "", nil, false, nil
+}
+
+func (s *MemoryStore) Ack(ctx context.Context, queue, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	entries := s.queues[queue]
+	for i := range entries {
+		if entries[i].id == id {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(entries) == 0 {
+		delete(s.queues, queue)
+	} else {
+		s.queues[queue] = entries
+	}
+	return nil
+}
+
+func (s *MemoryStore) QueueLength(ctx context.Context, queue string) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.queues[queue]), nil
+}
+
+// lookup returns the unexpired entry for the key, removing it if it expired.
+// The caller must hold the lock.
+func (s *MemoryStore) lookup(key string, now time.Time) (memoryEntry, bool) {
+	e, ok := s.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if e.expired(now) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return e, true
+}
+
+// sweep removes all expired entries if they were not removed within the
+// last memorySweepInterval. The caller must hold the lock.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMemoryStore returns a memory store whose time only moves when the
+// returned function is called.
+func newTestMemoryStore() (*MemoryStore, func(time.Duration)) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s, advance := newTestMemoryStore()
+
+	_, ok, err := s.Get(ctx, "missing")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	require.Nil(t, s.Set(ctx, "key", []byte("value"), 0))
+	value, ok, err := s.Get(ctx, "key")
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "value", string(value))
+
+	require.Nil(t, s.Delete(ctx, "key"))
+	_, ok, _ = s.Get(ctx, "key")
+	assert.False(t, ok)
+
+	n, err := s.Increment(ctx, "counter", 0)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = s.Increment(ctx, "counter", 0)
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	_, err = s.Increment(ctx, "counter-expiring", time.Millisecond)
+	require.Nil(t, err)
+	advance(time.Millisecond)
+	n, err = s.Increment(ctx, "counter-expiring", time.Hour)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), n, "expired counters restart")
+
+	set, err := s.SetIfAbsent(ctx, "once", []byte("a"), 0)
+	require.Nil(t, err)
+	assert.True(t, set)
+	set, err = s.SetIfAbsent(ctx, "once", []byte("b"), 0)
+	require.Nil(t, err)
+	assert.False(t, set, "existing keys are not overwritten")
+
+	deleted, err := s.CompareAndDelete(ctx, "once", []byte("b"))
+	require.Nil(t, err)
+	assert.False(t, deleted, "keys with other values are not deleted")
+	deleted, err = s.CompareAndDelete(ctx, "once", []byte("a"))
+	require.Nil(t, err)
+	assert.True(t, deleted)
+	_, ok, _ = s.Get(ctx, "once")
+	assert.False(t, ok)
+
+	require.Nil(t, s.Set(ctx, "paused/b", nil, 0))
+	require.Nil(t, s.Set(ctx, "paused/a", nil, 0))
+	require.Nil(t, s.Set(ctx, "paused/expired", nil, time.Millisecond))
+	advance(time.Millisecond)
+	keys, err := s.Keys(ctx, "paused/")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"paused/a", "paused/b"}, keys)
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	s, advance := newTestMemoryStore()
+
+	require.Nil(t, s.Set(ctx, "expiring", []byte("a"), time.Minute))
+	require.Nil(t, s.Set(ctx, "kept", []byte("b"), 0))
+	require.Nil(t, s.Set(ctx, "later", []byte("c"), time.Hour))
+
+	advance(time.Minute)
+	require.Nil(t, s.Set(ctx, "other", []byte("d"), 0))
+	assert.Len(t, s.entries, 3, "expired entries are removed by writes")
+	assert.NotContains(t, s.entries, "expiring")
+
+	require.Nil(t, s.Set(ctx, "expiring", []byte("a"), time.Second))
+	advance(time.Second)
+	require.Nil(t, s.Set(ctx, "other", []byte("d"), 0))
+	assert.Contains(t, s.entries, "expiring", "entries are removed at most once per interval")
+
+	advance(memorySweepInterval)
+	_, err := s.Increment(ctx, "counter", 0)
+	require.Nil(t, err)
+	assert.NotContains(t, s.entries, "expiring")
+	assert.Contains(t, s.entries, "later")
+}
+
+func TestMemoryStoreQueue(t *testing.T) {
+	ctx := context.Background()
+	s, advance := newTestMemoryStore()
+
+	_, _, ok, err := s.Dequeue(ctx, "work", time.Hour)
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	require.Nil(t, s.Enqueue(ctx, "work", []byte("a")))
+	require.Nil(t, s.Enqueue(ctx, "work", []byte("b")))
+
+	id, value, ok, err := s.Dequeue(ctx, "work", time.Hour)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "a", string(value))
+
+	_, value, ok, err = s.Dequeue(ctx, "work", time.Millisecond)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "b", string(value), "claimed values are not delivered twice")
+
+	n, err := s.QueueLength(ctx, "work")
+	require.Nil(t, err)
+	assert.Equal(t, 2, n, "claimed values are counted")
+
+	require.Nil(t, s.Ack(ctx, "work", id))
+	advance(time.Millisecond)
+
+	n, err = s.QueueLength(ctx, "work")
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	_, value, ok, err = s.Dequeue(ctx, "work", time.Hour)
+	require.Nil(t, err)
+	require.True(t, ok, "values are delivered again when their claim expires")
+	assert.Equal(t, "b", string(value))
+
+	_, _, ok, err = s.Dequeue(ctx, "work", time.Hour)
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
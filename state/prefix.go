@@ -0,0 +1,83 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// PrefixStore is a Store that keeps its keys in another store, under a
+// prefix, so that several users of the store do not see each other's keys.
+type PrefixStore struct {
+	Store  Store
+	Prefix string
+}
+
+func WithPrefix(store Store, prefix string) *PrefixStore {
+	return &PrefixStore{Store: store, Prefix: prefix}
+}
+
+func (s *PrefixStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return s.Store.Get(ctx, s.Prefix+key)
+}
+
+func (s *PrefixStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.Store.Set(ctx, s.Prefix+key, value, ttl)
+}
+
+func (s *PrefixStore) Delete(ctx context.Context, key string) error {
+	return s.Store.Delete(ctx, s.Prefix+key)
+}
+
+func (s *PrefixStore) SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return s.Store.SetIfAbsent(ctx, s.Prefix+key, value, ttl)
+}
+
+func (s *PrefixStore) CompareAndDelete(ctx context.Context, key string, value []byte) (bool, error) {
+	return s.Store.CompareAndDelete(ctx, s.Prefix+key, value)
+}
+
+func (s *PrefixStore) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	return s.Store.Increment(ctx, s.Prefix+key, ttl)
+}
+
+func (s *PrefixStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := s.Store.Keys(ctx, s.Prefix+prefix)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, s.Prefix)
+	}
+	return keys, nil
+}
+
+func (s *PrefixStore) Enqueue(ctx context.Context, queue string, value []byte) error {
+	return s.Store.Enqueue(ctx, s.Prefix+queue, value)
+}
+
+func (s *PrefixStore) Dequeue(ctx context.Context, queue string, claim time.Duration) (string, []byte, bool, error) {
+	return s.Store.Dequeue(ctx, s.Prefix+queue, claim)
+}
+
+func (s *PrefixStore) Ack(ctx context.Context, queue, id string) error {
+	return s.Store.Ack(ctx, s.Prefix+queue, id)
+}
+
+func (s *PrefixStore) QueueLength(ctx context.Context, queue string) (int, error) {
+	return s.Store.QueueLength(ctx, s.Prefix+queue)
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixStore(t *testing.T) {
+	ctx := context.Background()
+	base := NewMemoryStore()
+	s := WithPrefix(base, "apps/ghe/")
+
+	require.Nil(t, s.Set(ctx, "work/1", []byte("value"), 0))
+	require.Nil(t, base.Set(ctx, "work/2", []byte("other"), 0))
+
+	value, ok, err := base.Get(ctx, "apps/ghe/work/1")
+	require.Nil(t, err)
+	assert.True(t, ok, "keys are stored under the prefix")
+	assert.Equal(t, "value", string(value))
+
+	keys, err := s.Keys(ctx, "work/")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"work/1"}, keys, "keys outside the prefix are not listed")
+
+	n, err := s.Increment(ctx, "counter", 0)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	require.Nil(t, s.Delete(ctx, "work/1"))
+	_, ok, err = base.Get(ctx, "apps/ghe/work/1")
+	require.Nil(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,348 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	// redisTimeout limits connecting and each command if the context has no
+	// deadline
+	redisTimeout = 5 * time.Second
+
+	// redisMaxIdle is the number of idle connections kept for reuse
+	redisMaxIdle = 8
+
+	// redisIdleTimeout is how long an idle connection is kept
+	redisIdleTimeout = 5 * time.Minute
+
+	// redisGroup is the consumer group that reads queues. All servers are in
+	// the same group, so that each value is delivered to one server.
+	redisGroup = "bulldozer"
+)
+
+// incrementScript increments a counter and sets its expiration if the counter
+// is new, atomically.
+var incrementScript = redis.NewScript(1, `local n = redis.call("INCR", KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end
+return n`)
+
+// compareAndDeleteScript deletes a key if it has the value, atomically.
+var compareAndDeleteScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end
+return 0`)
+
+// RedisConfig configures the connection to a Redis server.
+type RedisConfig struct {
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+
+	// Prefix is prepended to every key, so that several servers can share
+	// a database
+	Prefix string `yaml:"prefix"`
+}
+
+// RedisStore is a Store that keeps values in Redis, so that they survive
+// restarts of the server and are shared by all servers using the database.
+// Queues are Redis streams read by a consumer group, which requires Redis
+// 6.2 or later.
+type RedisStore struct {
+	config   RedisConfig
+	pool     *redis.Pool
+	consumer string
+}
+
+func NewRedisStore(c RedisConfig) *RedisStore {
+	return &RedisStore{
+		config: c,
+		pool: &redis.Pool{
+			MaxIdle:     redisMaxIdle,
+			IdleTimeout: redisIdleTimeout,
+			DialContext: func(ctx context.Context) (redis.Conn, error) {
+				conn, err := redis.DialContext(ctx, "tcp", c.Address,
+					redis.DialPassword(c.Password),
+					redis.DialDatabase(c.DB),
+					redis.DialConnectTimeout(redisTimeout),
+					redis.DialReadTimeout(redisTimeout),
+					redis.DialWriteTimeout(redisTimeout),
+				)
+				return conn, errors.Wrapf(err, "failed to connect to redis at %s", c.Address)
+			},
+		},
+		consumer: consumerName(),
+	}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b, err := redis.Bytes(s.do(ctx, "GET", s.config.Prefix+key))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "failed to get %q", key)
+	}
+	return b, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []interface{}{s.config.Prefix + key, value}
+	if ttl > 0 {
+		args = append(args, "PX", durationMillis(ttl))
+	}
+	_, err := s.do(ctx, "SET", args...)
+	return errors.Wrapf(err, "failed to set %q", key)
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	_, err := s.do(ctx, "DEL", s.config.Prefix+key)
+	return errors.Wrapf(err, "failed to delete %q", key)
+}
+
+func (s *RedisStore) SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	args := []interface{}{s.config.Prefix + key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", durationMillis(ttl))
+	}
+	reply, err := s.do(ctx, "SET", args...)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to set %q", key)
+	}
+	return reply != nil, nil
+}
+
+func (s *RedisStore) CompareAndDelete(ctx context.Context, key string, value []byte) (bool, error) {
+	n, err := redis.Int64(s.eval(ctx, compareAndDeleteScript, s.config.Prefix+key, value))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to delete %q", key)
+	}
+	return n > 0, nil
+}
+
+func (s *RedisStore) Increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	var millis int64
+	if ttl > 0 {
+		millis = durationMillis(ttl)
+	}
+
+	n, err := redis.Int64(s.eval(ctx, incrementScript, s.config.Prefix+key, millis))
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to increment %q", key)
+	}
+	return n, nil
+}
+
+func (s *RedisStore) Keys(ctx context.Context, prefix string) ([]string, error) {
+	pattern := escapeGlob(s.config.Prefix+prefix) + "*"
+
+	seen := make(map[string]bool)
+	cursor := 0
+	for {
+		values, err := redis.Values(s.do(ctx, "SCAN", cursor, "MATCH", pattern, "COUNT", 100))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to scan keys with prefix %q", prefix)
+		}
+
+		var keys []string
+		if _, err := redis.Scan(values, &cursor, &keys); err != nil {
+			return nil, errors.Wrap(err, "unexpected reply to SCAN")
+		}
+		for _, k := range keys {
+			seen[strings.TrimPrefix(k, s.config.Prefix)] = true
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *RedisStore) Enqueue(ctx context.Context, queue string, value []byte) error {
+	_, err := s.do(ctx, "XADD", s.config.Prefix+queue, "*", "value", value)
+	return errors.Wrapf(err, "failed to add to queue %q", queue)
+}
+
+func (s *RedisStore) Dequeue(ctx context.Context, queue string, claim time.Duration) (string, []byte, bool, error) {
+	key := s.config.Prefix + queue
+
+	// values claimed by a server that did not acknowledge them in time come
+	// first, because they are older than any value not yet delivered
+	reply, err := s.do(ctx, "XAUTOCLAIM", key, redisGroup, s.consumer, durationMillis(claim), "0-0", "COUNT", 1)
+	if isNoGroup(err) {
+		if err := s.createGroup(ctx, key); err != nil {
+			return "", nil, false, errors.Wrapf(err, "failed to create group for queue %q", queue)
+		}
+		reply, err = s.do(ctx, "XAUTOCLAIM", key, redisGroup, s.consumer, durationMillis(claim), "0-0", "COUNT", 1)
+	}
+	if err != nil {
+		return "", nil, false, errors.Wrapf(err, "failed to claim from queue %q", queue)
+	}
+
+	parts, err := redis.Values(reply, nil)
+	if err != nil || len(parts) < 2 {
+		return "", nil, false, errors.Errorf("unexpected reply to XAUTOCLAIM: %v", reply)
+	}
+	if id, value, ok, err := streamEntry(parts[1]); ok || err != nil {
+		return id, value, ok, err
+	}
+
+	reply, err = s.do(ctx, "XREADGROUP", "GROUP", redisGroup, s.consumer, "COUNT", 1, "STREAMS", key, ">")
+	if err != nil {
+		return "", nil, false, errors.Wrapf(err, "failed to read from queue %q", queue)
+	}
+	if reply == nil {
+		return "", nil, false, nil
+	}
+
+	// the reply has one [key, entries] pair for the one stream
+	streams, err := redis.Values(reply, nil)
+	if err != nil || len(streams) != 1 {
+		return "", nil, false, errors.Errorf("unexpected reply to XREADGROUP: %v", reply)
+	}
+	stream, err := redis.Values(streams[0], nil)
+	if err != nil || len(stream) != 2 {
+		return "", nil, false, errors.Errorf("unexpected reply to XREADGROUP: %v", reply)
+	}
+	return streamEntry(stream[1])
+}
+
+func (s *RedisStore) Ack(ctx context.Context, queue, id string) error {
+	key := s.config.Prefix + queue
+	if _, err := s.do(ctx, "XACK", key, redisGroup, id); err != nil {
+		return errors.Wrapf(err, "failed to acknowledge %s in queue %q", id, queue)
+	}
+	_, err := s.do(ctx, "XDEL", key, id)
+	return errors.Wrapf(err, "failed to remove %s from queue %q", id, queue)
+}
+
+func (s *RedisStore) QueueLength(ctx context.Context, queue string) (int, error) {
+	n, err := redis.Int(s.do(ctx, "XLEN", s.config.Prefix+queue))
+	return n, errors.Wrapf(err, "failed to get the length of queue %q", queue)
+}
+
+func (s *RedisStore) createGroup(ctx context.Context, key string) error {
+	// reading from the start of the stream includes values added before
+	// the group existed
+	_, err := s.do(ctx, "XGROUP", "CREATE", key, redisGroup, "0", "MKSTREAM")
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		// another server created the group
+		return nil
+	}
+	return err
+}
+
+// do runs a command on a connection from the pool.
+func (s *RedisStore) do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	return redis.DoContext(conn, ctx, cmd, args...)
+}
+
+// eval runs a script on a connection from the pool.
+func (s *RedisStore) eval(ctx context.Context, script *redis.Script, keysAndArgs ...interface{}) (interface{}, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	return script.DoContext(ctx, conn, keysAndArgs...)
+}
+
+// streamEntry returns the ID and value of the first entry in a list of
+// stream entries, or false if the list is empty.
+func streamEntry(reply interface{}) (string, []byte, bool, error) {
+	entries, err := redis.Values(reply, nil)
+	if err != nil {
+		return "", nil, false, errors.Wrap(err, "unexpected stream entries")
+	}
+	for _, entry := range entries {
+		parts, err := redis.Values(entry, nil)
+		if err != nil || len(parts) != 2 {
+			return "", nil, false, errors.Errorf("unexpected stream entry: %v", entry)
+		}
+		id, err := redis.String(parts[0], nil)
+		if err != nil {
+			return "", nil, false, errors.Wrap(err, "unexpected stream entry ID")
+		}
+
+		// entries deleted while they were claimed have no fields
+		fields, _ := redis.ByteSlices(parts[1], nil)
+		for i := 0; i+1 < len(fields); i += 2 {
+			if string(fields[i]) == "value" {
+				return id, fields[i+1], true, nil
+			}
+		}
+	}
+	return "", nil, false, nil
+}
+
+func isNoGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
+
+// consumerName returns a name for this server in consumer groups.
+func consumerName() string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "bulldozer"
+	}
+
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// escapeGlob escapes the characters that have a special meaning in Redis
+// patterns.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func durationMillis(d time.Duration) int64 {
+	ms := int64(d / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	return ms
+}
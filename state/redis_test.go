@@ -0,0 +1,178 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	s := NewRedisStore(RedisConfig{Address: mr.Addr(), Prefix: "bulldozer/"})
+
+	_, ok, err := s.Get(ctx, "missing")
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	require.Nil(t, s.Set(ctx, "key", []byte("value"), 0))
+	value, ok, err := s.Get(ctx, "key")
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "value", string(value))
+	assert.True(t, mr.Exists("bulldozer/key"), "keys are stored under the prefix")
+
+	require.Nil(t, s.Delete(ctx, "key"))
+	_, ok, _ = s.Get(ctx, "key")
+	assert.False(t, ok)
+
+	require.Nil(t, s.Set(ctx, "expiring", []byte("value"), time.Minute))
+	mr.FastForward(2 * time.Minute)
+	_, ok, _ = s.Get(ctx, "expiring")
+	assert.False(t, ok)
+
+	n, err := s.Increment(ctx, "counter", time.Minute)
+	require.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = s.Increment(ctx, "counter", time.Hour)
+	require.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, time.Minute, mr.TTL("bulldozer/counter"), "incrementing does not change the expiration")
+
+	set, err := s.SetIfAbsent(ctx, "once", []byte("a"), time.Minute)
+	require.Nil(t, err)
+	assert.True(t, set)
+	set, err = s.SetIfAbsent(ctx, "once", []byte("b"), 0)
+	require.Nil(t, err)
+	assert.False(t, set, "existing keys are not overwritten")
+
+	deleted, err := s.CompareAndDelete(ctx, "once", []byte("b"))
+	require.Nil(t, err)
+	assert.False(t, deleted, "keys with other values are not deleted")
+	deleted, err = s.CompareAndDelete(ctx, "once", []byte("a"))
+	require.Nil(t, err)
+	assert.True(t, deleted)
+
+	require.Nil(t, s.Set(ctx, "paused/b", nil, 0))
+	require.Nil(t, s.Set(ctx, "paused/a", nil, 0))
+	require.Nil(t, s.Set(ctx, "paused/*", nil, 0))
+	require.Nil(t, s.Set(ctx, "pausedx", nil, 0))
+	keys, err := s.Keys(ctx, "paused/")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"paused/*", "paused/a", "paused/b"}, keys)
+}
+
+func TestRedisStoreQueue(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	mr.SetTime(now)
+
+	s := NewRedisStore(RedisConfig{Address: mr.Addr()})
+	other := NewRedisStore(RedisConfig{Address: mr.Addr()})
+
+	_, _, ok, err := s.Dequeue(ctx, "work", time.Minute)
+	require.Nil(t, err)
+	assert.False(t, ok, "empty queues have no values")
+
+	require.Nil(t, s.Enqueue(ctx, "work", []byte("a")))
+	require.Nil(t, other.Enqueue(ctx, "work", []byte("b")))
+
+	id, value, ok, err := s.Dequeue(ctx, "work", time.Minute)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "a", string(value))
+
+	_, value, ok, err = other.Dequeue(ctx, "work", time.Minute)
+	require.Nil(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "b", string(value), "claimed values are not delivered twice")
+
+	_, _, ok, err = other.Dequeue(ctx, "work", time.Minute)
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	n, err := s.QueueLength(ctx, "work")
+	require.Nil(t, err)
+	assert.Equal(t, 2, n, "claimed values are counted")
+
+	require.Nil(t, s.Ack(ctx, "work", id))
+
+	n, err = other.QueueLength(ctx, "work")
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	mr.SetTime(now.Add(2 * time.Minute))
+	_, value, ok, err = s.Dequeue(ctx, "work", time.Minute)
+	require.Nil(t, err)
+	require.True(t, ok, "values are delivered again when their claim expires")
+	assert.Equal(t, "b", string(value))
+
+	_, _, ok, err = s.Dequeue(ctx, "work", time.Minute)
+	require.Nil(t, err)
+	assert.False(t, ok, "acknowledged values are not delivered again")
+}
+
+func TestRedisStoreConnection(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+
+	s := NewRedisStore(RedisConfig{Address: mr.Addr(), Password: "secret", DB: 2})
+	require.Nil(t, s.Set(ctx, "key", []byte("value"), 0))
+	assert.True(t, mr.DB(2).Exists("key"), "the configured database is selected")
+
+	s = NewRedisStore(RedisConfig{Address: mr.Addr(), Password: "wrong"})
+	_, _, err := s.Get(ctx, "key")
+	assert.Error(t, err, "authentication errors are returned")
+
+	addr := mr.Addr()
+	mr.Close()
+	s = NewRedisStore(RedisConfig{Address: addr})
+	_, _, err = s.Get(ctx, "key")
+	assert.Error(t, err, "connection errors are returned")
+}
+
+func TestRedisStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	s := NewRedisStore(RedisConfig{Address: mr.Addr()})
+
+	require.Nil(t, mr.Set("text", "value"))
+	_, err := s.Increment(ctx, "text", 0)
+	assert.Error(t, err, "incrementing a value that is not a counter fails")
+
+	// the connection is still usable after an error reply
+	require.Nil(t, s.Set(ctx, "key", []byte("value"), 0))
+
+	mr.SetError("LOADING")
+	_, _, err = s.Get(ctx, "key")
+	assert.Error(t, err)
+	mr.SetError("")
+
+	_, ok, err := s.Get(ctx, "key")
+	require.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestEscapeGlob(t *testing.T) {
+	assert.Equal(t, `paused/\*\?\[a\]\\`, escapeGlob(`paused/*?[a]\`))
+}
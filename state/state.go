@@ -0,0 +1,93 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package state stores small amounts of data that bulldozer needs to keep
+// between events, such as counters and flags.
+package state
+
+import (
+	"context"
+	"time"
+)
+
+// Store is a key-value store with expiring keys. Implementations must be safe
+// for concurrent use.
+type Store interface {
+	// Get returns the value of the key and true, or false if the key does
+	// not exist or has expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set sets the value of the key. If ttl is positive, the key expires
+	// after the duration.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes the key, if it exists.
+	Delete(ctx context.Context, key string) error
+
+	// SetIfAbsent sets the value of the key like Set, but only if the key
+	// does not exist or has expired. It returns true if the value was set.
+	SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// CompareAndDelete atomically removes the key if its value equals the
+	// value. It returns true if the key was removed.
+	CompareAndDelete(ctx context.Context, key string, value []byte) (bool, error)
+
+	// Increment atomically adds one to the counter stored at the key and
+	// returns the new value. If the key does not exist, it is created with
+	// the value 1 and expires after ttl, if ttl is positive. Incrementing an
+	// existing key does not change its expiration.
+	Increment(ctx context.Context, key string, ttl time.Duration) (int64, error)
+
+	// Keys returns the unexpired keys that start with the prefix, in sorted
+	// order. Listing keys may be slow in large stores and should not be done
+	// on every event.
+	Keys(ctx context.Context, prefix string) ([]string, error)
+
+	// Enqueue appends the value to the named queue.
+	Enqueue(ctx context.Context, queue string, value []byte) error
+
+	// Dequeue returns the ID and value of the oldest value in the queue that
+	// is not claimed, and true, or false if there is no such value. The
+	// value is claimed for the duration of claim and is returned again by a
+	// later call, possibly by another server, if it is not acknowledged
+	// before the claim expires.
+	Dequeue(ctx context.Context, queue string, claim time.Duration) (string, []byte, bool, error)
+
+	// Ack removes the value with the ID from the queue.
+	Ack(ctx context.Context, queue, id string) error
+
+	// QueueLength returns the number of values in the queue that were not
+	// acknowledged, including claimed values.
+	QueueLength(ctx context.Context, queue string) (int, error)
+}
+
+type storeCtxKey struct{}
+
+// WithStore returns a context that uses the store.
+func WithStore(ctx context.Context, store Store) context.Context {
+	return context.WithValue(ctx, storeCtxKey{}, store)
+}
+
+// defaultStore is used by contexts without a store, so that state is still
+// shared within the process.
+var defaultStore = NewMemoryStore()
+
+// Ctx returns the store associated with the context. If the context has no
+// store, a shared in-memory store is returned.
+func Ctx(ctx context.Context) Store {
+	if s, ok := ctx.Value(storeCtxKey{}).(Store); ok {
+		return s
+	}
+	return defaultStore
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing records spans for the work bulldozer does, like handling
+// webhooks, fetching configuration, evaluating pull requests, and calling
+// GitHub, with the OpenTelemetry SDK, and exports them to a collector using
+// OTLP over HTTP.
+package tracing
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	DefaultServiceName = "bulldozer"
+
+	// InstrumentationName identifies the spans that bulldozer records
+	InstrumentationName = "github.com/palantir/bulldozer"
+)
+
+// Config configures the export of spans. Tracing is disabled unless an
+// endpoint is set.
+type Config struct {
+	// Endpoint is the OTLP/HTTP traces URL of a collector, like
+	// "http://localhost:4318/v1/traces"
+	Endpoint    string            `yaml:"endpoint"`
+	Headers     map[string]string `yaml:"headers"`
+	ServiceName string            `yaml:"service_name"`
+}
+
+func (c Config) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// NewTracerProvider returns a provider that exports spans in batches to the
+// collector in the configuration. Callers must shut down the provider to
+// export the remaining spans.
+func NewTracerProvider(c Config) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(c.Endpoint),
+		otlptracehttp.WithHeaders(c.Headers),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create span exporter")
+	}
+
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	), nil
+}
+
+// Start starts a span that is a child of the current span of the context,
+// using the provider of that span. If the context has no span, the span is
+// not recorded. It returns a context with the new span as the current span.
+// Callers must call End on the span.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(InstrumentationName)
+	return tracer.Start(ctx, name, opts...)
+}
+
+// RecordError records the error on the span and marks the span as failed, if
+// err is not nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Palantir Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStart(t *testing.T) {
+	ctx, span := Start(context.Background(), "untraced")
+	assert.False(t, span.IsRecording(), "spans are not recorded without a parent span")
+	span.End()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	ctx, root := provider.Tracer(InstrumentationName).Start(ctx, "root")
+	_, child := Start(ctx, "child")
+	RecordError(child, errors.New("failed"))
+	RecordError(child, nil)
+	child.End()
+	root.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name())
+	assert.Equal(t, spans[1].SpanContext().TraceID(), spans[0].SpanContext().TraceID())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "failed", spans[0].Status().Description)
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var req coltracepb.ExportTraceServiceRequest
+		require.NoError(t, proto.Unmarshal(b, &req))
+		requests <- &req
+	}))
+	defer srv.Close()
+
+	provider, err := NewTracerProvider(Config{
+		Endpoint: srv.URL + "/v1/traces",
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+	})
+	require.NoError(t, err)
+
+	_, span := provider.Tracer(InstrumentationName).Start(context.Background(), "webhook pull_request")
+	span.End()
+	require.NoError(t, provider.Shutdown(context.Background()), "shutting down exports the remaining spans")
+
+	req := <-requests
+	require.Len(t, req.ResourceSpans, 1)
+
+	var serviceName string
+	for _, attr := range req.ResourceSpans[0].Resource.Attributes {
+		if attr.Key == "service.name" {
+			serviceName = attr.Value.GetStringValue()
+		}
+	}
+	assert.Equal(t, DefaultServiceName, serviceName)
+
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	assert.Equal(t, "webhook pull_request", spans[0].Name)
+}